@@ -81,6 +81,10 @@ func convertServerConfig(agentConfig *Config, logOutput io.Writer) (*uconf.Serve
 	if agentConfig.NodeName != "" {
 		conf.NodeName = agentConfig.NodeName
 	}
+	if agentConfig.DevMode {
+		conf.DevMode = true
+		conf.Bootstrap = true
+	}
 	if agentConfig.Server.BootstrapExpect > 0 {
 		if agentConfig.Server.BootstrapExpect == 1 {
 			conf.Bootstrap = true
@@ -100,6 +104,31 @@ func convertServerConfig(agentConfig *Config, logOutput io.Writer) (*uconf.Serve
 	if len(agentConfig.Server.EnabledSchedulers) != 0 {
 		conf.EnabledSchedulers = agentConfig.Server.EnabledSchedulers
 	}
+	if alg := agentConfig.Server.SchedulerAlgorithm; alg != "" {
+		if !umodel.ValidSchedulerAlgorithm(alg) {
+			return nil, fmt.Errorf("scheduler_algorithm: must be %q or %q, not %q",
+				umodel.SchedulerAlgorithmSpread, umodel.SchedulerAlgorithmBinpack, alg)
+		}
+		conf.SchedulerAlgorithm = alg
+	}
+	if agentConfig.Server.MaxFullCopies < 0 {
+		return nil, fmt.Errorf("max_full_copies: must be positive or 0, not %d", agentConfig.Server.MaxFullCopies)
+	}
+	conf.MaxFullCopies = agentConfig.Server.MaxFullCopies
+	if agentConfig.Server.Admission != nil {
+		conf.Admission = agentConfig.Server.Admission.SetDefault()
+	}
+	for ns, w := range agentConfig.Server.EvalNamespaceWeights {
+		if w < 1 {
+			return nil, fmt.Errorf("eval_namespace_weights: weight of namespace %q must be at least 1", ns)
+		}
+	}
+	conf.EvalNamespaceWeights = agentConfig.Server.EvalNamespaceWeights
+	keyring, err := uconf.ParseTransitKeyring(agentConfig.Server.TransitKeyring)
+	if err != nil {
+		return nil, fmt.Errorf("transit_keyring: %v", err)
+	}
+	conf.TransitKeyring = keyring
 
 	switch agentConfig.Profile {
 	case "wan":
@@ -144,6 +173,20 @@ func convertServerConfig(agentConfig *Config, logOutput io.Writer) (*uconf.Serve
 		}
 		conf.HeartbeatGrace = dur
 	}
+	if evalDeadline := agentConfig.Server.EvalDeadline; evalDeadline != "" {
+		dur, err := time.ParseDuration(evalDeadline)
+		if err != nil {
+			return nil, err
+		}
+		conf.EvalDeadline = dur
+	}
+	if threshold := agentConfig.Server.SlowApplyThreshold; threshold != "" {
+		dur, err := time.ParseDuration(threshold)
+		if err != nil {
+			return nil, err
+		}
+		conf.SlowApplyThreshold = dur
+	}
 
 	if *agentConfig.Consul.AutoAdvertise && agentConfig.Consul.ServerServiceName == "" {
 		return nil, fmt.Errorf("server_service_name must be set when auto_advertise is enabled")
@@ -182,6 +225,15 @@ func (a *Agent) clientConfig() (*uconf.ClientConfig, error) {
 		conf.StateDir = filepath.Join(a.config.DataDir, "agent")
 	}
 	conf.Servers = a.config.Client.Servers
+	if a.config.Client.AllocDir != "" {
+		conf.AllocDir = a.config.Client.AllocDir
+	} else if a.config.DataDir != "" {
+		conf.AllocDir = filepath.Join(a.config.DataDir, "alloc")
+	}
+	conf.AllocDiskQuotaMB = a.config.Client.AllocDiskQuotaMB
+	if a.config.Client.AllocGCRetention != 0 {
+		conf.AllocGCRetention = a.config.Client.AllocGCRetention
+	}
 
 	// Setup the node
 	conf.Node = new(umodel.Node)
@@ -206,6 +258,7 @@ func (a *Agent) clientConfig() (*uconf.ClientConfig, error) {
 	conf.PublishAllocationMetrics = a.config.Metric.PublishAllocationMetrics
 
 	conf.NoHostUUID = a.config.Client.NoHostUUID
+	conf.LogShipping = a.config.Client.LogShipping
 
 	return conf, nil
 }
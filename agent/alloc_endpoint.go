@@ -9,7 +9,9 @@ package agent
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	umodel "github.com/actiontech/dtle/internal/models"
 )
@@ -20,10 +22,13 @@ var (
 
 const (
 	resourceNotFoundErr = "resource not found"
+
+	// maxEventsWait bounds the wait of a request for the events of an allocation
+	maxEventsWait = 5 * time.Minute
 )
 
 func (s *HTTPServer) AllocsRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
-	s.logger.Debugf("HTTPServer.AllocsRequest")
+	s.requestLogger(req).Debugf("HTTPServer.AllocsRequest")
 	if req.Method != "GET" {
 		return nil, CodedError(405, ErrInvalidMethod)
 	}
@@ -34,7 +39,7 @@ func (s *HTTPServer) AllocsRequest(resp http.ResponseWriter, req *http.Request)
 	}
 
 	var out umodel.AllocListResponse
-	s.logger.Debugf("HTTPServer.AllocsRequest: call rpc")
+	s.requestLogger(req).Debugf("HTTPServer.AllocsRequest: call rpc")
 	if err := s.agent.RPC("Alloc.List", &args, &out); err != nil {
 		return nil, err
 	}
@@ -94,6 +99,12 @@ func (s *HTTPServer) ClientAllocRequest(resp http.ResponseWriter, req *http.Requ
 	switch tokens[1] {
 	case "stats":
 		return s.allocStats(allocID, resp, req)
+	case "events":
+		return s.allocEvents(allocID, resp, req)
+	case "rescan":
+		return s.allocRescan(allocID, resp, req)
+	case "health":
+		return s.allocHealth(allocID, resp, req)
 	}
 
 	return nil, CodedError(404, resourceNotFoundErr)
@@ -109,3 +120,50 @@ func (s *HTTPServer) allocStats(allocID string, resp http.ResponseWriter, req *h
 	task := req.URL.Query().Get("task")
 	return aStats.LatestAllocStats(task)
 }
+
+func (s *HTTPServer) allocRescan(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	return s.agent.client.RescanAlloc(allocID)
+}
+
+func (s *HTTPServer) allocHealth(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	return s.agent.client.AllocHealth(allocID)
+}
+
+func (s *HTTPServer) allocEvents(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	query := req.URL.Query()
+	var index uint64
+	if i := query.Get("index"); i != "" {
+		var err error
+		if index, err = strconv.ParseUint(i, 10, 64); err != nil {
+			return nil, CodedError(400, fmt.Sprintf("invalid index: %v", i))
+		}
+	}
+	max := 100
+	if m := query.Get("max"); m != "" {
+		var err error
+		if max, err = strconv.Atoi(m); err != nil || max <= 0 {
+			return nil, CodedError(400, fmt.Sprintf("invalid max: %v", m))
+		}
+	}
+	var wait time.Duration
+	if w := query.Get("wait"); w != "" {
+		var err error
+		if wait, err = time.ParseDuration(w); err != nil {
+			return nil, CodedError(400, fmt.Sprintf("invalid wait: %v", w))
+		}
+		if wait > maxEventsWait {
+			wait = maxEventsWait
+		}
+	}
+
+	return s.agent.client.GetAllocEvents(allocID, query.Get("task"), index, max, wait)
+}
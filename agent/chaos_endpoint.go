@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"net/http"
+
+	"github.com/actiontech/dtle/internal/chaos"
+)
+
+// chaosInjectResponse is the response of injecting a fault
+type chaosInjectResponse struct {
+	// Fault is nil for chaos.FaultKill, which is not kept
+	Fault *chaos.Fault
+	// Killed is the number of tasks killed by chaos.FaultKill
+	Killed int
+}
+
+// AgentChaosRequest lists (GET), injects (PUT or POST) and clears (DELETE)
+// the faults injected into the tasks of this agent. DELETE clears the fault
+// of the "id" parameter, or all faults without it.
+// It is only registered in builds with the chaos tag.
+func (s *HTTPServer) AgentChaosRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	switch req.Method {
+	case "GET":
+		return chaos.Faults(), nil
+	case "PUT", "POST":
+		var fault chaos.Fault
+		if err := decodeBody(req, &fault); err != nil {
+			return nil, CodedError(400, err.Error())
+		}
+		killed, err := chaos.Inject(&fault)
+		if err != nil {
+			return nil, CodedError(400, err.Error())
+		}
+		s.requestLogger(req).Warnf("http: chaos: injected fault %v of type %v, job %q, killed %v tasks",
+			fault.ID, fault.Type, fault.JobID, killed)
+		out := &chaosInjectResponse{Killed: killed}
+		if fault.Type != chaos.FaultKill {
+			out.Fault = &fault
+		}
+		return out, nil
+	case "DELETE":
+		id := req.URL.Query().Get("id")
+		if !chaos.Clear(id) {
+			return nil, CodedError(404, "fault not found")
+		}
+		return nil, nil
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
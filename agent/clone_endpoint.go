@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/actiontech/dtle/api"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// jobClone registers a new job with the config of the job jobName and the
+// changes of the request.
+func (s *HTTPServer) jobClone(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	var args api.JobCloneRequest
+	if err := decodeBody(req, &args); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	region := args.Region
+	s.parseRegion(req, &region)
+
+	existing, err := s.getJob(region, jobName)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, CodedError(404, "job not found")
+	}
+	job, err := cloneJob(existing, &args)
+	if err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	// registering the ID of an existing job would update it
+	if other, err := s.getJob(region, job.ID); err != nil {
+		return nil, err
+	} else if other != nil {
+		return nil, CodedError(409, fmt.Sprintf("job %v already exists", job.ID))
+	}
+
+	reply := &api.JobCloneResponse{
+		ID:   job.ID,
+		Name: job.Name,
+	}
+	if args.SkipFullCopy {
+		if reply.Gtid, err = sourceGtidExecuted(req.Context(), job); err != nil {
+			return nil, err
+		}
+		setJobGtid(job, reply.Gtid)
+	}
+
+	regReq := models.JobRegisterRequest{
+		Job:          job,
+		WriteRequest: models.WriteRequest{Region: region},
+	}
+	var out models.JobResponse
+	if err := s.agent.RPC("Job.Register", &regReq, &out); err != nil {
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	reply.EvalID = out.EvalID
+	return reply, nil
+}
+
+func (s *HTTPServer) getJob(region, jobID string) (*models.Job, error) {
+	args := models.JobSpecificRequest{
+		JobID:        jobID,
+		QueryOptions: models.QueryOptions{Region: region},
+	}
+	var out models.SingleJobResponse
+	if err := s.agent.RPC("Job.GetJob", &args, &out); err != nil {
+		return nil, err
+	}
+	return out.Job, nil
+}
+
+// cloneJob returns a new job with the config of existing and the changes of
+// args. The state of existing, e.g. its status and its owner, is not kept.
+func cloneJob(existing *models.Job, args *api.JobCloneRequest) (*models.Job, error) {
+	job := existing.Copy()
+	job.ID = args.ID
+	if job.ID == "" {
+		job.ID = models.GenerateUUID()
+	}
+	job.Name = args.Name
+	if job.Name == "" {
+		job.Name = job.ID
+	}
+	if job.ID == existing.ID {
+		return nil, fmt.Errorf("the clone of job %v needs another ID", existing.ID)
+	}
+	job.Owner = ""
+	job.SpecHash = ""
+	job.Status = ""
+	job.StatusDescription = ""
+	job.Failure = nil
+	job.GroupStates = nil
+	job.EnforceIndex = false
+	job.CreateIndex = 0
+	job.ModifyIndex = 0
+	job.JobModifyIndex = 0
+
+	for _, t := range job.Tasks {
+		// the clone copies its rows again
+		delete(t.Config, "CopyProgress")
+	}
+	for taskType, changes := range args.Config {
+		t := job.LookupTask(taskType)
+		if t == nil {
+			return nil, fmt.Errorf("job %v has no task %v", existing.ID, taskType)
+		}
+		if t.Config == nil {
+			t.Config = make(map[string]interface{})
+		}
+		mergeConfig(t.Config, changes)
+	}
+	return job, nil
+}
+
+// mergeConfig sets the values of changes in config. An object in both is
+// merged key by key.
+func mergeConfig(config, changes map[string]interface{}) {
+	for k, v := range changes {
+		if change, ok := v.(map[string]interface{}); ok {
+			if current, ok := config[k].(map[string]interface{}); ok {
+				mergeConfig(current, change)
+				continue
+			}
+		}
+		config[k] = v
+	}
+}
+
+// sourceGtidExecuted reads the GTID set executed on the source of the MySQL
+// Src task of job.
+func sourceGtidExecuted(ctx context.Context, job *models.Job) (string, error) {
+	src := job.LookupTask(models.TaskTypeSrc)
+	if src == nil || src.Driver != models.TaskDriverMySQL {
+		return "", CodedError(400, "SkipFullCopy needs a MySQL Src task")
+	}
+	var srcConfig config.MySQLDriverConfig
+	if err := mapstructure.WeakDecode(src.Config, &srcConfig); err != nil {
+		return "", err
+	}
+	if srcConfig.ConnectionConfig == nil {
+		return "", CodedError(400, "missing ConnectionConfig of the Src task")
+	}
+
+	db, err := sql.CreateDB(srcConfig.ConnectionConfig.GetDBUri())
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(ctx, srcConfig.QueryTimeout())
+	defer cancel()
+	coord, err := base.GetSelfBinlogCoordinates(ctx, db)
+	if err != nil {
+		return "", fmt.Errorf("reading the executed GTID set of the source: %v", err)
+	}
+	return coord.GtidSet, nil
+}
+
+// setJobGtid makes the tasks of job start at gtid, as given by the Gtid of
+// the spec of a job.
+func setJobGtid(job *models.Job, gtid string) {
+	for _, t := range job.Tasks {
+		if t.Type != models.TaskTypeSrc && t.Type != models.TaskTypeDest && t.Type != models.TaskTypeDestStandby {
+			continue
+		}
+		if t.Config == nil {
+			t.Config = make(map[string]interface{})
+		}
+		if t.Type == models.TaskTypeSrc {
+			delete(t.Config, "GtidStart")
+			delete(t.Config, "DumpSource")
+		}
+		t.Config["Gtid"] = gtid
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/api"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestCloneJob(t *testing.T) {
+	existing := &models.Job{
+		ID:     "j1",
+		Name:   "j1",
+		Owner:  "op",
+		Status: models.JobStatusRunning,
+		Tasks: []*models.Task{
+			{Type: models.TaskTypeSrc, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{
+				"GtidStart": "uuid:1-10",
+				"ConnectionConfig": map[string]interface{}{
+					"Host": "10.0.0.1", "Port": 3306,
+				},
+			}},
+			{Type: models.TaskTypeDest, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{
+				"ConnectionConfig": map[string]interface{}{
+					"Host": "10.0.0.2", "Port": 3306, "User": "u",
+				},
+			}},
+		},
+	}
+	args := &api.JobCloneRequest{
+		ID: "j2",
+		Config: map[string]map[string]interface{}{
+			"Dest": {"ConnectionConfig": map[string]interface{}{"Host": "10.0.0.3"}},
+		},
+	}
+
+	job, err := cloneJob(existing, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "j2" || job.Name != "j2" || job.Owner != "" || job.Status != "" {
+		t.Errorf("clone is %v %v owned by %q %q", job.ID, job.Name, job.Owner, job.Status)
+	}
+	wantDest := map[string]interface{}{
+		"ConnectionConfig": map[string]interface{}{
+			"Host": "10.0.0.3", "Port": 3306, "User": "u",
+		},
+	}
+	if dest := job.LookupTask(models.TaskTypeDest).Config; !reflect.DeepEqual(dest, wantDest) {
+		t.Errorf("config of Dest is %v, want %v", dest, wantDest)
+	}
+	// the existing job is unchanged
+	if host := existing.Tasks[1].Config["ConnectionConfig"].(map[string]interface{})["Host"]; host != "10.0.0.2" {
+		t.Errorf("host of the existing job changed to %v", host)
+	}
+
+	setJobGtid(job, "uuid:1-20")
+	src := job.LookupTask(models.TaskTypeSrc).Config
+	if src["Gtid"] != "uuid:1-20" || src["GtidStart"] != nil {
+		t.Errorf("config of Src is %v", src)
+	}
+	if gtid := job.LookupTask(models.TaskTypeDest).Config["Gtid"]; gtid != "uuid:1-20" {
+		t.Errorf("Gtid of Dest is %v", gtid)
+	}
+
+	if _, err := cloneJob(existing, &api.JobCloneRequest{ID: "j1"}); err == nil {
+		t.Errorf("clone with the ID of the job succeeded")
+	}
+	if _, err := cloneJob(existing, &api.JobCloneRequest{Config: map[string]map[string]interface{}{
+		models.TaskTypeDestStandby: {"Gtid": ""},
+	}}); err == nil {
+		t.Errorf("clone changing a missing task succeeded")
+	}
+}
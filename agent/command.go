@@ -13,7 +13,6 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -37,6 +36,9 @@ const gracefulTimeout = 5 * time.Second
 // The command will not end unless a shutdown message is sent on the
 // ShutdownCh. If two messages are sent on the ShutdownCh it will forcibly
 // exit.
+// interval of updating the health file
+const healthFileInterval = 10 * time.Second
+
 type Command struct {
 	Version    string
 	Revision   string
@@ -49,11 +51,19 @@ type Command struct {
 	logger         *ulog.Logger
 	logOutput      io.Writer
 	retryJoinErrCh chan struct{}
+
+	// pidFile and healthFile are written if set by the flags
+	pidFile    string
+	healthFile string
+
+	// devJob registers the example job of dev mode
+	devJob bool
 }
 
 func (c *Command) readConfig() *Config {
 	var configPath []string
 	var servers string
+	var dev bool
 
 	// Make a new, empty config.
 	cmdConfig := &Config{
@@ -66,6 +76,8 @@ func (c *Command) readConfig() *Config {
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 
 	// Role options
+	flags.BoolVar(&dev, "dev", false, "")
+	flags.BoolVar(&c.devJob, "dev-job", false, "")
 	flags.BoolVar(&cmdConfig.Server.Enabled, "manager", false, "")
 	flags.BoolVar(&cmdConfig.Client.Enabled, "agent", false, "")
 
@@ -89,21 +101,12 @@ func (c *Command) readConfig() *Config {
 	flags.BoolVar(&cmdConfig.PprofSwitch, "pprof-switch", false, "")
 	flags.Int64Var(&cmdConfig.PprofTime, "pprof-time", 0, "")
 	flags.StringVar(&cmdConfig.NodeName, "node", "", "")
+	flags.StringVar(&c.healthFile, "health-file", "", "")
 
 	if err := flags.Parse(c.args); err != nil {
 		return nil
 	}
-
-	if cmdConfig.PidFile != "" {
-		f, err := os.Create(cmdConfig.PidFile)
-		if err != nil {
-			c.Ui.Error(fmt.Sprintf("Unable to create pidfile: %s", err))
-		}
-
-		fmt.Fprintf(f, "%d\n", os.Getpid())
-
-		f.Close()
-	}
+	c.pidFile = cmdConfig.PidFile
 
 	// Split the servers.
 	if servers != "" {
@@ -112,7 +115,14 @@ func (c *Command) readConfig() *Config {
 
 	// Load the configuration
 	var config *Config
-	config = DefaultConfig()
+	if dev {
+		config = DevConfig()
+	} else if c.devJob {
+		c.Ui.Error("-dev-job requires -dev")
+		return nil
+	} else {
+		config = DefaultConfig()
+	}
 	for _, path := range configPath {
 		current, err := LoadConfig(path)
 		if err != nil {
@@ -148,41 +158,13 @@ func (c *Command) readConfig() *Config {
 		return nil
 	}
 
-	// Parse the RetryInterval.
-	dur, err := time.ParseDuration(config.Server.RetryInterval)
-	if err != nil {
-		c.Ui.Error(fmt.Sprintf("Error parsing retry interval: %s", err))
+	if err := config.Validate(); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error validating the configuration: %s", err))
 		return nil
 	}
-	config.Server.retryInterval = dur
 
-	// Check that the server is running in at least one mode.
-	if !(config.Server.Enabled || config.Client.Enabled) {
-		c.Ui.Error("Must specify either manager or agent mode for the server.")
-		return nil
-	}
-
-	// Verify the paths are absolute.
-	dirs := map[string]string{
-		"data-dir":  config.DataDir,
-		"state-dir": config.Client.StateDir,
-	}
-	for k, dir := range dirs {
-		if dir == "" {
-			continue
-		}
-
-		if !filepath.IsAbs(dir) {
-			c.Ui.Error(fmt.Sprintf("%s must be given as an absolute path: got %v", k, dir))
-			return nil
-		}
-	}
-
-	// Ensure that we have the directories we neet to run.
-	if config.Server.Enabled && config.DataDir == "" {
-		c.Ui.Error("Must specify data directory")
-		return nil
-	}
+	// Parse the RetryInterval, checked by Validate.
+	config.Server.retryInterval, _ = time.ParseDuration(config.Server.RetryInterval)
 
 	return config
 }
@@ -278,9 +260,23 @@ func (c *Command) Run(args []string) int {
 		})
 	}
 
+	if c.pidFile != "" {
+		if err := writeFileAtomic(c.pidFile, []byte(fmt.Sprintf("%d\n", os.Getpid()))); err != nil {
+			c.logger.Errorf("Unable to create pidfile: %s", err)
+			return 1
+		}
+		defer os.Remove(c.pidFile)
+	}
+
 	// set global value
 	g.DtleSchemaName = config.DtleSchemaName
 
+	if n, err := raiseOpenFilesLimit(); err != nil {
+		c.logger.Warnf("Unable to raise the limit of open files: %v", err)
+	} else if n > 0 {
+		c.logger.Debugf("Limit of open files: %v", n)
+	}
+
 	// Initialize the metric
 	if err := c.setupMetric(config); err != nil {
 		c.logger.Errorf("Error initializing metric: %s", err)
@@ -338,6 +334,26 @@ func (c *Command) Run(args []string) int {
 	c.retryJoinErrCh = make(chan struct{})
 	go c.retryJoin(config)
 
+	if c.devJob {
+		go c.registerDevJob(config.Region)
+	}
+
+	// Tell systemd the agent is started, and that it is stopping once the
+	// signal is handled, before the deferred shutdowns.
+	if err := sdNotify("READY=1"); err != nil {
+		c.logger.Warnf("Unable to notify systemd: %v", err)
+	}
+	defer sdNotify("STOPPING=1")
+	watchdogInterval, err := sdWatchdogInterval()
+	if err != nil {
+		c.logger.Warnf("systemd watchdog: %v", err)
+	}
+	if watchdogInterval > 0 || c.healthFile != "" {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go c.reportHealth(watchdogInterval, stopCh)
+	}
+
 	// Wait for exit
 	return c.handleSignals(config)
 }
@@ -345,7 +361,7 @@ func (c *Command) Run(args []string) int {
 // handleSignals blocks until we get an exit-causing signal
 func (c *Command) handleSignals(config *Config) int {
 	signalCh := make(chan os.Signal, 4)
-	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGPIPE)
+	signal.Notify(signalCh, handledSignals...)
 
 	// Wait for a signal
 WAIT:
@@ -367,9 +383,11 @@ WAIT:
 
 	// Check if this is a SIGHUP
 	if sig == syscall.SIGHUP {
+		sdNotify("RELOADING=1")
 		if conf := c.handleReload(config); conf != nil {
 			*config = *conf
 		}
+		sdNotify("READY=1")
 		goto WAIT
 	}
 
@@ -409,6 +427,56 @@ WAIT:
 }
 
 // handleReload is invoked when we should reload our configs, e.g. SIGHUP
+// reportHealth pings the systemd watchdog and updates the health file while
+// the agent answers. A hung agent is restarted by systemd after WatchdogSec.
+func (c *Command) reportHealth(watchdogInterval time.Duration, stopCh chan struct{}) {
+	interval := healthFileInterval
+	if watchdogInterval > 0 && watchdogInterval/2 < interval {
+		interval = watchdogInterval / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Stats takes the locks of the server and the client. A check still
+	// running is not started again.
+	var statsCh chan struct{}
+	for {
+		if statsCh == nil {
+			statsCh = make(chan struct{})
+			go func(ch chan struct{}) {
+				c.agent.Stats()
+				close(ch)
+			}(statsCh)
+		}
+		select {
+		case <-statsCh:
+			statsCh = nil
+			if watchdogInterval > 0 {
+				if err := sdNotify("WATCHDOG=1"); err != nil {
+					c.logger.Warnf("Unable to ping systemd watchdog: %v", err)
+				}
+			}
+			if c.healthFile != "" {
+				status := fmt.Sprintf("ok %d\n", time.Now().Unix())
+				if err := writeFileAtomic(c.healthFile, []byte(status)); err != nil {
+					c.logger.Warnf("Unable to write health file: %v", err)
+				}
+			}
+		case <-time.After(interval):
+			c.logger.Warnf("Agent is unhealthy: no stats after %v", interval)
+		}
+
+		select {
+		case <-stopCh:
+			if c.healthFile != "" {
+				os.Remove(c.healthFile)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (c *Command) handleReload(config *Config) *Config {
 	c.logger.Printf("Reloading configuration...")
 	newConf := c.readConfig()
@@ -528,6 +596,24 @@ Usage: dtle server [options]
 
 General Options (agents and managers):
 
+  -dev
+    Start in dev mode: a manager and an agent in one process, bound to
+    127.0.0.1, logging to stdout at DEBUG level. The replicated log is
+    kept in memory and the agent state in a temporary directory, so
+    nothing persists across restarts. Not to be used in production.
+
+  -dev-job
+    With -dev, register an example job replicating database "dtle_dev"
+    from MySQL on 127.0.0.1:33061 to MySQL on 127.0.0.1:33062, with user
+    root and password rootroot, e.g. started by:
+
+      docker run -d -p 33061:3306 -e MYSQL_ROOT_PASSWORD=rootroot mysql:5.7 \
+        --server-id=1 --log-bin=mysql-bin --binlog-format=ROW \
+        --gtid-mode=ON --enforce-gtid-consistency
+      docker run -d -p 33062:3306 -e MYSQL_ROOT_PASSWORD=rootroot mysql:5.7 \
+        --server-id=2 --log-bin=mysql-bin --binlog-format=ROW \
+        --gtid-mode=ON --enforce-gtid-consistency
+
   -bind=<addr>
     The address the server will bind to for all of its various network
     services. The individual services that run bind to individual
@@ -551,11 +637,19 @@ General Options (agents and managers):
     The name of the datacenter this Dtle server is a member of. By
     default this is set to "dc1".
 
+  -health-file=<path>
+    A file rewritten with "ok <unix time>" every 10 seconds while the
+    server is healthy, for process supervisors without systemd. It is
+    removed on exit.
+
   -log-level=<level>
     Specify the verbosity level of Dtle's logs. Valid values include
     DEBUG, INFO, and WARN, in decreasing order of verbosity. The
     default is INFO.
 
+  -pid-file=<path>
+    A file the pid of the server is written to. It is removed on exit.
+
   -node=<name>
     The name of the local server. This name is used to identify the node
     in the cluster. The name must be unique per region. The default is
@@ -17,7 +17,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
+
 	uconf "github.com/actiontech/dtle/internal/config"
+	umodel "github.com/actiontech/dtle/internal/models"
 )
 
 // This is the default addr to all interfaces.
@@ -39,6 +42,10 @@ type Config struct {
 	// DataDir is the directory to store our store in
 	DataDir string `mapstructure:"data_dir"`
 
+	// DevMode runs a manager and an agent with their state in memory.
+	// It is set by the -dev flag only.
+	DevMode bool `mapstructure:"-"`
+
 	// PprofSwitch is the witch to open pprof
 	PprofSwitch bool `mapstructure:"pprof_switch"`
 
@@ -144,6 +151,22 @@ type ClientConfig struct {
 	// NoHostUUID disables using the host's UUID and will force generation of a
 	// random UUID.
 	NoHostUUID bool `mapstructure:"no_host_uuid"`
+
+	// AllocDir is the directory of the working directories of the
+	// allocations, <data_dir>/alloc by default.
+	AllocDir string `mapstructure:"alloc_dir"`
+
+	// AllocDiskQuotaMB is the default disk quota of an allocation, for the
+	// tasks which set none. 0 means no limit.
+	AllocDiskQuotaMB int `mapstructure:"alloc_disk_quota_mb"`
+
+	// AllocGCRetention is how long the directory of a terminal allocation is
+	// kept for inspection before it is garbage collected.
+	AllocGCRetention time.Duration `mapstructure:"alloc_gc_retention"`
+
+	// LogShipping ships the task logs and the error events of the jobs
+	// run by the agent to syslog, Kafka or an HTTP collector.
+	LogShipping *uconf.LogShippingConfig `mapstructure:"log_shipping"`
 }
 
 // ServerConfig is configuration specific to the server mode
@@ -168,10 +191,43 @@ type ServerConfig struct {
 	// that the workers dequeue for processing.
 	EnabledSchedulers []string `mapstructure:"enabled_schedulers"`
 
+	// SchedulerAlgorithm places the allocations of the jobs across the
+	// agents, "spread" (the default) for failure isolation or "binpack".
+	// A job may override it.
+	SchedulerAlgorithm string `mapstructure:"scheduler_algorithm"`
+
+	// MaxFullCopies is the number of the jobs of the cluster doing their
+	// full copy at once, the jobs starting one more being blocked until
+	// another one ends. 0 is no limit. A namespace quota limits its own jobs
+	// too.
+	MaxFullCopies int `mapstructure:"max_full_copies"`
+
+	// Admission runs admission controllers on the registered jobs, which
+	// may reject them or, through a webhook, change them.
+	Admission *uconf.AdmissionConfig `mapstructure:"admission"`
+
+	// EvalNamespaceWeights are the shares of the namespaces in the
+	// evaluations run by the schedulers, e.g. { payments = 3 }. The
+	// namespaces not listed have a weight of 1.
+	EvalNamespaceWeights map[string]int `mapstructure:"eval_namespace_weights"`
+
+	// TransitKeyring is the base64 keys of 32 bytes encrypting the messages
+	// of the jobs with EncryptTransit. The first one encrypts, the others
+	// still decrypt while the keyring is rotated.
+	TransitKeyring []string `mapstructure:"transit_keyring"`
+
 	// HeartbeatGrace is the grace period beyond the TTL to account for network,
 	// processing delays and clock skew before marking a node as "down".
 	HeartbeatGrace string `mapstructure:"heartbeat_grace"`
 
+	// EvalDeadline is how long a scheduler may process an evaluation before
+	// the evaluation is Nacked, e.g. "5m". "0" is no deadline.
+	EvalDeadline string `mapstructure:"eval_deadline"`
+
+	// SlowApplyThreshold is the time to apply a Raft log over which it is
+	// logged, e.g. "500ms". "0" logs none.
+	SlowApplyThreshold string `mapstructure:"slow_apply_threshold"`
+
 	// StartJoin is a list of addresses to attempt to join when the
 	// agent starts. If Serf is unable to communicate with any of these
 	// addresses, then the agent will error and exit.
@@ -247,11 +303,11 @@ type Node struct {
 func DefaultConfig() *Config {
 	return &Config{
 		LogLevel:    "INFO",
-		LogFile:     "/var/log/dtle/dtle.log",
+		LogFile:     defaultLogFile,
 		LogToStdout: false,
 		PprofSwitch: false,
 		PprofTime:   0,
-		PidFile:     "/var/run/dtle/dtle.pid",
+		PidFile:     defaultPidFile,
 		Region:      "global",
 		Datacenter:  "dc1",
 		BindAddr:    "0.0.0.0",
@@ -293,6 +349,103 @@ func DefaultConfig() *Config {
 	}
 }
 
+// DevConfig is a Config that is used for dev mode of the agent: a manager
+// and an agent on the loopback, which keep nothing on disk.
+func DevConfig() *Config {
+	conf := DefaultConfig()
+	conf.DevMode = true
+	conf.BindAddr = "127.0.0.1"
+	conf.LogLevel = "DEBUG"
+	conf.LogToStdout = true
+	conf.Server.Enabled = true
+	conf.Server.BootstrapExpect = 1
+	conf.Client.Enabled = true
+	return conf
+}
+
+// Validate checks the values of a loaded configuration which would stop the
+// agent from starting, or which it would silently ignore.
+func (c *Config) Validate() error {
+	var mErr multierror.Error
+	if c.Server == nil || c.Client == nil || !(c.Server.Enabled || c.Client.Enabled) {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Must specify either manager or agent mode for the server."))
+		return mErr.ErrorOrNil()
+	}
+
+	switch strings.ToUpper(c.LogLevel) {
+	case "", "PANIC", "FATAL", "ERROR", "WARN", "WARNING", "INFO", "DEBUG":
+	default:
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("log_level: unknown level %q", c.LogLevel))
+	}
+	switch c.Profile {
+	case "", "wan", "lan", "local":
+	default:
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("profile: must be %q, %q or %q, not %q", "wan", "lan", "local", c.Profile))
+	}
+
+	if _, err := time.ParseDuration(c.Server.RetryInterval); err != nil {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Error parsing retry interval: %s", err))
+	}
+	if c.Server.HeartbeatGrace != "" {
+		if _, err := time.ParseDuration(c.Server.HeartbeatGrace); err != nil {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("Error parsing heartbeat grace: %s", err))
+		}
+	}
+	if c.Server.EvalDeadline != "" {
+		if d, err := time.ParseDuration(c.Server.EvalDeadline); err != nil || d < 0 {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("eval_deadline: must be a positive duration or 0, not %q", c.Server.EvalDeadline))
+		}
+	}
+	if c.Server.SlowApplyThreshold != "" {
+		if d, err := time.ParseDuration(c.Server.SlowApplyThreshold); err != nil || d < 0 {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("slow_apply_threshold: must be a positive duration or 0, not %q", c.Server.SlowApplyThreshold))
+		}
+	}
+	if alg := c.Server.SchedulerAlgorithm; alg != "" && !umodel.ValidSchedulerAlgorithm(alg) {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("scheduler_algorithm: must be %q or %q, not %q",
+			umodel.SchedulerAlgorithmSpread, umodel.SchedulerAlgorithmBinpack, alg))
+	}
+	if c.Server.MaxFullCopies < 0 {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("max_full_copies: must be positive or 0, not %d", c.Server.MaxFullCopies))
+	}
+	for ns, w := range c.Server.EvalNamespaceWeights {
+		if w < 1 {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("eval_namespace_weights: weight of namespace %q must be at least 1", ns))
+		}
+	}
+	if _, err := uconf.ParseTransitKeyring(c.Server.TransitKeyring); err != nil {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("transit_keyring: %v", err))
+	}
+	if c.Server.Admission != nil {
+		if err := c.Server.Admission.Validate(); err != nil {
+			mErr.Errors = append(mErr.Errors, multierror.Prefix(err, "admission:"))
+		}
+	}
+	if c.Client.LogShipping != nil {
+		if err := c.Client.LogShipping.Validate(); err != nil {
+			mErr.Errors = append(mErr.Errors, multierror.Prefix(err, "log_shipping:"))
+		}
+	}
+
+	// Verify the paths are absolute.
+	dirs := map[string]string{
+		"data-dir":  c.DataDir,
+		"state-dir": c.Client.StateDir,
+	}
+	for k, dir := range dirs {
+		if dir != "" && !filepath.IsAbs(dir) {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("%s must be given as an absolute path: got %v", k, dir))
+		}
+	}
+
+	// Ensure that we have the directories we neet to run.
+	if c.Server.Enabled && c.DataDir == "" && !c.DevMode {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Must specify data directory"))
+	}
+
+	return mErr.ErrorOrNil()
+}
+
 // Listener can be used to get a new listener using a custom bind address.
 // If the bind provided address is empty, the BindAddr is used instead.
 func (c *Config) Listener(proto, addr string, port int) (net.Listener, error) {
@@ -334,6 +487,9 @@ func (c *Config) Merge(b *Config) *Config {
 	if b.DataDir != "" {
 		result.DataDir = b.DataDir
 	}
+	if b.DevMode {
+		result.DevMode = b.DevMode
+	}
 	if b.EnableUi {
 		result.EnableUi = b.EnableUi
 	}
@@ -556,9 +712,27 @@ func (a *ServerConfig) Merge(b *ServerConfig) *ServerConfig {
 	if b.NumSchedulers != 0 {
 		result.NumSchedulers = b.NumSchedulers
 	}
+	if b.SchedulerAlgorithm != "" {
+		result.SchedulerAlgorithm = b.SchedulerAlgorithm
+	}
+	if b.MaxFullCopies != 0 {
+		result.MaxFullCopies = b.MaxFullCopies
+	}
+	if b.Admission != nil {
+		result.Admission = result.Admission.Merge(b.Admission)
+	}
+	if len(b.TransitKeyring) != 0 {
+		result.TransitKeyring = b.TransitKeyring
+	}
 	if b.HeartbeatGrace != "" {
 		result.HeartbeatGrace = b.HeartbeatGrace
 	}
+	if b.EvalDeadline != "" {
+		result.EvalDeadline = b.EvalDeadline
+	}
+	if b.SlowApplyThreshold != "" {
+		result.SlowApplyThreshold = b.SlowApplyThreshold
+	}
 	if b.RetryMaxAttempts != 0 {
 		result.RetryMaxAttempts = b.RetryMaxAttempts
 	}
@@ -570,6 +744,16 @@ func (a *ServerConfig) Merge(b *ServerConfig) *ServerConfig {
 	result.EnabledSchedulers = append(result.EnabledSchedulers, b.EnabledSchedulers...)
 
 	// Copy the start join addresses
+	if len(b.EvalNamespaceWeights) != 0 {
+		result.EvalNamespaceWeights = make(map[string]int)
+		for ns, w := range a.EvalNamespaceWeights {
+			result.EvalNamespaceWeights[ns] = w
+		}
+		for ns, w := range b.EvalNamespaceWeights {
+			result.EvalNamespaceWeights[ns] = w
+		}
+	}
+
 	result.StartJoin = make([]string, 0, len(a.StartJoin)+len(b.StartJoin))
 	result.StartJoin = append(result.StartJoin, a.StartJoin...)
 	result.StartJoin = append(result.StartJoin, b.StartJoin...)
@@ -596,10 +780,23 @@ func (a *ClientConfig) Merge(b *ClientConfig) *ClientConfig {
 	if b.NoHostUUID {
 		result.NoHostUUID = b.NoHostUUID
 	}
+	if b.AllocDir != "" {
+		result.AllocDir = b.AllocDir
+	}
+	if b.AllocDiskQuotaMB != 0 {
+		result.AllocDiskQuotaMB = b.AllocDiskQuotaMB
+	}
+	if b.AllocGCRetention != 0 {
+		result.AllocGCRetention = b.AllocGCRetention
+	}
 
 	// Add the servers
 	result.Servers = append(result.Servers, b.Servers...)
 
+	if b.LogShipping != nil {
+		result.LogShipping = result.LogShipping.Merge(b.LogShipping)
+	}
+
 	return &result
 }
 
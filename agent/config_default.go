@@ -0,0 +1,173 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// defaultConfigTemplate is the configuration file written by DefaultConfigFile.
+// The values come from DefaultConfig, the options without a default are
+// commented out.
+var defaultConfigTemplate = template.Must(template.New("config").Parse(`# Configuration of a dtle server, running a manager and an agent.
+# Check it with "dtle config-validate <file>".
+
+region = "{{.Region}}"
+datacenter = "{{.Datacenter}}"
+# name = "node1"
+
+# The directory of the state, which must be an absolute path
+data_dir = "/opt/dtle/data"
+
+log_level = "{{.LogLevel}}"
+log_file = "{{.LogFile}}"
+log_to_stdout = {{.LogToStdout}}
+pid_file = "{{.PidFile}}"
+pprof_switch = {{.PprofSwitch}}
+pprof_time = {{.PprofTime}}
+
+bind_addr = "{{.BindAddr}}"
+
+# The memberlist profile: "lan" (the default), "wan" or "local"
+# profile = "lan"
+
+# leave_on_interrupt = false
+# leave_on_terminate = false
+
+# The schema of the dtle metadata (e.g. gtid_executed) in the databases
+dtle_schema_name = "{{.DtleSchemaName}}"
+
+ports {
+    http = {{.Ports.HTTP}}
+    rpc = {{.Ports.RPC}}
+    serf = {{.Ports.Serf}}
+    nats = {{.Ports.Nats}}
+}
+
+# The addresses bound, bind_addr by default
+# addresses {
+#     http = "0.0.0.0"
+#     rpc = "0.0.0.0"
+#     serf = "0.0.0.0"
+#     nats = "0.0.0.0"
+# }
+
+# The addresses advertised to the other nodes
+# advertise {
+#     http = "10.0.0.1:{{.Ports.HTTP}}"
+#     rpc = "10.0.0.1:{{.Ports.RPC}}"
+#     serf = "10.0.0.1:{{.Ports.Serf}}"
+#     nats = "10.0.0.1:{{.Ports.Nats}}"
+# }
+
+manager {
+    enabled = true
+
+    # Self-elect, should be 3 or 5 for production
+    bootstrap_expect = 1
+
+    # Addresses to attempt to join when the server starts
+    # join = [ "10.0.0.1", "10.0.0.2" ]
+    retry_max = {{.Server.RetryMaxAttempts}}
+    retry_interval = "{{.Server.RetryInterval}}"
+    heartbeat_grace = "{{.Server.HeartbeatGrace}}"
+
+    # num_schedulers = 4
+    # enabled_schedulers = [ "synchronous", "migration" ]
+
+    # Nack the evaluations a scheduler processes for longer, "0" for never
+    # eval_deadline = "5m"
+
+    # Log the Raft logs applied slower, "0" for none
+    # slow_apply_threshold = "500ms"
+
+    # Place the jobs on separate agents ("spread") or fill the agents
+    # already in use first ("binpack"). A job may override it.
+    # scheduler_algorithm = "spread"
+
+    # Run at most so many full copies of the jobs at once, the jobs starting
+    # another one waiting in blocked evaluations. 0 for no limit.
+    # max_full_copies = 10
+
+    # Keys encrypting the messages of the jobs with EncryptTransit, the same
+    # on all the managers: base64 of 32 random bytes (openssl rand -base64 32).
+    # The first key encrypts. Add a new key first to rotate the keyring.
+    # transit_keyring = [ "..." ]
+
+    # The shares of the namespaces in the evaluations, 1 by default
+    # eval_namespace_weights {
+    #     payments = 3
+    # }
+
+    # Check the registered jobs before they are committed
+    # admission {
+    #     job_name_pattern = "^[a-z]+-[a-z0-9-]+$"
+    #     forbid_drop = true
+    #     webhook_url = "http://127.0.0.1:8000/admit"
+    #     webhook_timeout = "10s"
+    #     webhook_fail_open = false
+    # }
+}
+
+agent {
+    enabled = true
+    managers = [ "127.0.0.1:{{.Ports.RPC}}" ]
+    no_host_uuid = {{.Client.NoHostUUID}}
+
+    # Working directories of the allocations, with a disk quota each
+    # alloc_dir = "/opt/dtle/data/alloc"
+    # alloc_disk_quota_mb = 10240
+    # alloc_gc_retention = "1h"
+
+    # Ship the task logs and error events of the jobs
+    # log_shipping {
+    #     level = "WARN"
+    #     syslog_address = "udp://127.0.0.1:514"
+    #     kafka_brokers = [ "127.0.0.1:9092" ]
+    #     kafka_topic = "dtle-logs"
+    #     http_url = "http://127.0.0.1:8080/logs"
+    # }
+}
+
+metric {
+    collection_interval = "{{.Metric.CollectionInterval}}"
+    disable_hostname = {{.Metric.DisableHostname}}
+    use_node_name = {{.Metric.UseNodeName}}
+    publish_allocation_metrics = {{.Metric.PublishAllocationMetrics}}
+    publish_node_metrics = {{.Metric.PublishNodeMetrics}}
+}
+
+network {
+    max_payload = {{.Network.MaxPayload}}
+}
+
+# consul {
+#     address = "127.0.0.1:8500"
+#     server_service_name = "{{.Consul.ServerServiceName}}"
+#     client_service_name = "{{.Consul.ClientServiceName}}"
+#     auto_advertise = true
+#     server_auto_join = true
+#     client_auto_join = true
+#     timeout = "{{.Consul.Timeout}}"
+# }
+
+# http_api_response_headers {
+#     Access-Control-Allow-Origin = "*"
+# }
+`))
+
+// DefaultConfigFile returns a configuration file of a server running a
+// manager and an agent, with all the options set to their defaults or
+// commented out.
+func DefaultConfigFile() (string, error) {
+	var buf bytes.Buffer
+	if err := defaultConfigTemplate.Execute(&buf, DefaultConfig()); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
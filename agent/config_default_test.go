@@ -0,0 +1,36 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfigFile(t *testing.T) {
+	content, err := DefaultConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseConfig(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("the default config file is not parsed: %v", err)
+	}
+	config := DefaultConfig().Merge(parsed)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("the default config file is not valid: %v", err)
+	}
+
+	// The values set in the file are the defaults
+	def := DefaultConfig()
+	if !reflect.DeepEqual(config.Ports, def.Ports) || !reflect.DeepEqual(config.Network, def.Network) ||
+		config.LogLevel != def.LogLevel || config.Server.RetryInterval != def.Server.RetryInterval ||
+		config.Server.HeartbeatGrace != def.Server.HeartbeatGrace || config.Metric.CollectionInterval != def.Metric.CollectionInterval {
+		t.Errorf("the default config file changes the defaults: %+v", config)
+	}
+}
@@ -105,8 +105,10 @@ func parseConfig(result *Config, list *ast.ObjectList) error {
 		"http_api_response_headers",
 		"dtle_schema_name",
 	}
+	// The unknown keys are all reported, with those of the blocks
+	var mErr *multierror.Error
 	if err := checkHCLKeys(list, valid); err != nil {
-		return multierror.Prefix(err, "config:")
+		mErr = multierror.Append(mErr, multierror.Prefix(err, "config:"))
 	}
 
 	// Decode the full thing into a map[string]interface for ease
@@ -132,55 +134,55 @@ func parseConfig(result *Config, list *ast.ObjectList) error {
 	// Parse ports
 	if o := list.Filter("ports"); len(o.Items) > 0 {
 		if err := parsePorts(&result.Ports, o); err != nil {
-			return multierror.Prefix(err, "ports ->")
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "ports ->"))
 		}
 	}
 
 	// Parse addresses
 	if o := list.Filter("addresses"); len(o.Items) > 0 {
 		if err := parseAddresses(&result.Addresses, o); err != nil {
-			return multierror.Prefix(err, "addresses ->")
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "addresses ->"))
 		}
 	}
 
 	// Parse advertise
 	if o := list.Filter("advertise"); len(o.Items) > 0 {
 		if err := parseAdvertise(&result.AdvertiseAddrs, o); err != nil {
-			return multierror.Prefix(err, "advertise ->")
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "advertise ->"))
 		}
 	}
 
 	// Parse client config
 	if o := list.Filter("agent"); len(o.Items) > 0 {
 		if err := parseClient(&result.Client, o); err != nil {
-			return multierror.Prefix(err, "agent ->")
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "agent ->"))
 		}
 	}
 
 	// Parse server config
 	if o := list.Filter("manager"); len(o.Items) > 0 {
 		if err := parseServer(&result.Server, o); err != nil {
-			return multierror.Prefix(err, "manager ->")
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "manager ->"))
 		}
 	}
 
 	// Parse metric config
 	if o := list.Filter("metric"); len(o.Items) > 0 {
 		if err := parseMetric(&result.Metric, o); err != nil {
-			return multierror.Prefix(err, "metric ->")
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "metric ->"))
 		}
 	}
 
 	if o := list.Filter("network"); len(o.Items) > 0 {
 		if err := parseNetwork(&result.Network, o); err != nil {
-			return multierror.Prefix(err, "network ->")
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "network ->"))
 		}
 	}
 
 	// Parse the consul config
 	if o := list.Filter("consul"); len(o.Items) > 0 {
 		if err := parseConsulConfig(&result.Consul, o); err != nil {
-			return multierror.Prefix(err, "consul ->")
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "consul ->"))
 		}
 	}
 
@@ -198,7 +200,7 @@ func parseConfig(result *Config, list *ast.ObjectList) error {
 		}
 	}
 
-	return nil
+	return mErr.ErrorOrNil()
 }
 
 func parsePorts(result **Ports, list *ast.ObjectList) error {
@@ -321,11 +323,16 @@ func parseClient(result **ClientConfig, list *ast.ObjectList) error {
 	valid := []string{
 		"enabled",
 		"managers",
-		"stats",
+		"state_dir",
 		"no_host_uuid",
+		"alloc_dir",
+		"alloc_disk_quota_mb",
+		"alloc_gc_retention",
+		"log_shipping",
 	}
+	var mErr *multierror.Error
 	if err := checkHCLKeys(listVal, valid); err != nil {
-		return err
+		mErr = multierror.Append(mErr, err)
 	}
 
 	var m map[string]interface{}
@@ -333,7 +340,7 @@ func parseClient(result **ClientConfig, list *ast.ObjectList) error {
 		return err
 	}
 
-	delete(m, "stats")
+	delete(m, "log_shipping")
 
 	var config ClientConfig
 	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
@@ -348,7 +355,64 @@ func parseClient(result **ClientConfig, list *ast.ObjectList) error {
 		return err
 	}
 
+	if o := listVal.Filter("log_shipping"); len(o.Items) > 0 {
+		if err := parseLogShipping(&config.LogShipping, o); err != nil {
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "log_shipping ->"))
+		}
+	}
+
 	*result = &config
+	return mErr.ErrorOrNil()
+}
+
+func parseLogShipping(result **config.LogShippingConfig, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'log_shipping' block allowed")
+	}
+
+	listVal := list.Items[0].Val
+
+	// Check for invalid keys
+	valid := []string{
+		"level",
+		"events_only",
+		"syslog_address",
+		"syslog_tag",
+		"kafka_brokers",
+		"kafka_topic",
+		"http_url",
+		"http_headers",
+		"batch_size",
+		"flush_interval",
+		"buffer_size",
+	}
+	if err := checkHCLKeys(listVal, valid); err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, listVal); err != nil {
+		return err
+	}
+
+	var shipping config.LogShippingConfig
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           &shipping,
+	})
+	if err != nil {
+		return err
+	}
+	if err := dec.Decode(m); err != nil {
+		return err
+	}
+	if err := shipping.Validate(); err != nil {
+		return err
+	}
+
+	*result = &shipping
 	return nil
 }
 
@@ -378,13 +442,21 @@ func parseServer(result **ServerConfig, list *ast.ObjectList) error {
 		"ui_dir",
 		"num_schedulers",
 		"enabled_schedulers",
+		"scheduler_algorithm",
+		"max_full_copies",
+		"admission",
+		"eval_namespace_weights",
+		"transit_keyring",
 		"heartbeat_grace",
+		"eval_deadline",
+		"slow_apply_threshold",
 		"join",
 		"retry_max",
 		"retry_interval",
 	}
+	var mErr *multierror.Error
 	if err := checkHCLKeys(listVal, valid); err != nil {
-		return err
+		mErr = multierror.Append(mErr, err)
 	}
 
 	var m map[string]interface{}
@@ -392,12 +464,66 @@ func parseServer(result **ServerConfig, list *ast.ObjectList) error {
 		return err
 	}
 
+	delete(m, "admission")
+
 	var config ServerConfig
 	if err := mapstructure.WeakDecode(m, &config); err != nil {
 		return err
 	}
 
+	if o := listVal.Filter("admission"); len(o.Items) > 0 {
+		if err := parseAdmission(&config.Admission, o); err != nil {
+			mErr = multierror.Append(mErr, multierror.Prefix(err, "admission ->"))
+		}
+	}
+
 	*result = &config
+	return mErr.ErrorOrNil()
+}
+
+func parseAdmission(result **config.AdmissionConfig, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'admission' block allowed")
+	}
+
+	listVal := list.Items[0].Val
+
+	// Check for invalid keys
+	valid := []string{
+		"job_name_pattern",
+		"forbid_drop",
+		"webhook_url",
+		"webhook_headers",
+		"webhook_timeout",
+		"webhook_fail_open",
+	}
+	if err := checkHCLKeys(listVal, valid); err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, listVal); err != nil {
+		return err
+	}
+
+	var admission config.AdmissionConfig
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           &admission,
+	})
+	if err != nil {
+		return err
+	}
+	if err := dec.Decode(m); err != nil {
+		return err
+	}
+	if err := admission.Validate(); err != nil {
+		return err
+	}
+
+	*result = &admission
 	return nil
 }
 
@@ -412,7 +538,6 @@ func parseMetric(result **Metric, list *ast.ObjectList) error {
 
 	// Check for invalid keys
 	valid := []string{
-		"prometheus_address",
 		"disable_hostname",
 		"use_node_name",
 		"collection_interval",
@@ -548,7 +673,7 @@ func checkHCLKeys(node ast.Node, valid []string) error {
 		key := item.Keys[0].Token.Value().(string)
 		if _, ok := validMap[key]; !ok {
 			result = multierror.Append(result, fmt.Errorf(
-				"invalid key: %s", key))
+				"invalid key: %s (line %d)", key, item.Pos().Line))
 		}
 	}
 
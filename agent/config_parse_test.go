@@ -9,6 +9,7 @@ package agent
 import (
 	"io"
 	"reflect"
+	"strings"
 	"testing"
 	"github.com/actiontech/dtle/internal/config"
 
@@ -276,3 +277,45 @@ func Test_checkHCLKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestParseConfig_InvalidKeys(t *testing.T) {
+	in := `
+data_dir = "/opt/dtle/data"
+log_levle = "DEBUG"
+
+manager {
+    enabled = true
+    retry_intervall = "10s"
+    admission {
+        forbid_dorp = true
+    }
+}
+
+agent {
+    enabled = true
+    state_dir = "/opt/dtle/state"
+}
+`
+	_, err := ParseConfig(strings.NewReader(in))
+	if err == nil {
+		t.Fatal("the invalid keys were accepted")
+	}
+	for _, want := range []string{
+		"config: invalid key: log_levle (line 3)",
+		"manager -> invalid key: retry_intervall (line 7)",
+		"manager -> admission -> invalid key: forbid_dorp (line 9)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not have %q", err, want)
+		}
+	}
+
+	config, err := ParseConfig(strings.NewReader(strings.Replace(strings.Replace(strings.Replace(in,
+		"log_levle", "log_level", 1), "retry_intervall", "retry_interval", 1), "forbid_dorp", "forbid_drop", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.LogLevel != "DEBUG" || config.Server.RetryInterval != "10s" || config.Client.StateDir != "/opt/dtle/state" {
+		t.Errorf("config = %+v", config)
+	}
+}
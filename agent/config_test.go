@@ -9,6 +9,7 @@ package agent
 import (
 	"net"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 	uconf "github.com/actiontech/dtle/internal/config"
@@ -634,3 +635,32 @@ func Test_isTemporaryFile(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_Validate(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "manager or agent mode") {
+		t.Errorf("a config without any mode = %v", err)
+	}
+
+	config.Server.Enabled = true
+	config.DataDir = "/opt/dtle/data"
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	config.DataDir = "data"
+	config.LogLevel = "verbose"
+	config.Server.RetryInterval = "15"
+	config.Server.SchedulerAlgorithm = "random"
+	config.Server.MaxFullCopies = -1
+	config.Server.TransitKeyring = []string{"c2hvcnQ="}
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("the invalid config was accepted")
+	}
+	for _, want := range []string{"data-dir must be given as an absolute path", "log_level", "retry interval", "scheduler_algorithm", "max_full_copies", "transit_keyring"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not have %q", err, want)
+		}
+	}
+}
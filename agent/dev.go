@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"time"
+
+	"github.com/actiontech/dtle/api"
+	"github.com/actiontech/dtle/internal"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// The example job of -dev-job replicates a database between two MySQL
+// containers on the local host. See the help of -dev-job to start them.
+const (
+	devJobName     = "dev-job"
+	devJobDatabase = "dtle_dev"
+	devSrcPort     = 33061
+	devDestPort    = 33062
+
+	// registering is retried until the manager elected itself
+	devJobRetries       = 30
+	devJobRetryInterval = time.Second
+)
+
+// devJob is the example job registered by -dev-job.
+func devJob() *api.Job {
+	connection := func(port int) map[string]interface{} {
+		return map[string]interface{}{
+			"Host":     "127.0.0.1",
+			"Port":     port,
+			"User":     "root",
+			"Password": "rootroot",
+		}
+	}
+	return &api.Job{
+		ID:   internal.StringToPtr(devJobName),
+		Name: internal.StringToPtr(devJobName),
+		Type: internal.StringToPtr(models.JobTypeSync),
+		Tasks: []*api.Task{
+			{
+				Type:   models.TaskTypeSrc,
+				Driver: models.TaskDriverMySQL,
+				Config: map[string]interface{}{
+					"ReplicateDoDb":    []map[string]interface{}{{"TableSchema": devJobDatabase}},
+					"ConnectionConfig": connection(devSrcPort),
+				},
+			},
+			{
+				Type:   models.TaskTypeDest,
+				Driver: models.TaskDriverMySQL,
+				Config: map[string]interface{}{
+					"ConnectionConfig": connection(devDestPort),
+				},
+			},
+		},
+	}
+}
+
+// registerDevJob registers the example job once the manager has a leader.
+// It gives up if the agent is shut down.
+func (c *Command) registerDevJob(region string) {
+	job := ApiJobToStructJob(devJob(), 0)
+	req := models.JobRegisterRequest{
+		Job:          job,
+		WriteRequest: models.WriteRequest{Region: region},
+	}
+	var err error
+	for i := 0; i < devJobRetries; i++ {
+		var out models.JobResponse
+		if err = c.agent.RPC("Job.Register", &req, &out); err == nil {
+			c.logger.Printf("Registered the example job %v, replicating database %v from 127.0.0.1:%d to 127.0.0.1:%d",
+				job.ID, devJobDatabase, devSrcPort, devDestPort)
+			return
+		}
+		select {
+		case <-c.agent.shutdownCh:
+			return
+		case <-time.After(devJobRetryInterval):
+		}
+	}
+	c.logger.Errorf("Unable to register the example job: %v", err)
+}
@@ -0,0 +1,32 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestCommand_readConfigDev(t *testing.T) {
+	c := &Command{Ui: new(cli.MockUi), args: []string{"-dev", "-dev-job"}}
+	config := c.readConfig()
+	if config == nil {
+		t.Fatalf("readConfig() = nil, error %q", c.Ui.(*cli.MockUi).ErrorWriter.String())
+	}
+	if !config.DevMode || !config.Server.Enabled || !config.Client.Enabled || config.BindAddr != "127.0.0.1" {
+		t.Errorf("readConfig() = %+v", config)
+	}
+	if !c.devJob {
+		t.Errorf("devJob is not set")
+	}
+
+	c = &Command{Ui: new(cli.MockUi), args: []string{"-dev-job", "-agent"}}
+	if config := c.readConfig(); config != nil {
+		t.Errorf("readConfig() = %+v, want an error without -dev", config)
+	}
+}
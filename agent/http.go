@@ -8,6 +8,8 @@ package agent
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,10 +21,12 @@ import (
 	"net/http/pprof"
 
 	"github.com/NYTimes/gziphandler"
+	"github.com/hashicorp/raft"
 	"github.com/ugorji/go/codec"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"strings"
+	"github.com/actiontech/dtle/internal/chaos"
 	log "github.com/actiontech/dtle/internal/logger"
 	umodel "github.com/actiontech/dtle/internal/models"
 )
@@ -30,6 +34,13 @@ import (
 const (
 	// ErrInvalidMethod is used if the HTTP method is not supported
 	ErrInvalidMethod = "Invalid method"
+
+	// requestIDHeader carries the ID of a request, given by the client or
+	// set by the server, and is returned with the response
+	requestIDHeader = "X-Request-Id"
+
+	// maxRequestIDLen is the longest request ID taken from a client
+	maxRequestIDLen = 128
 )
 
 var (
@@ -56,14 +67,27 @@ type HTTPServer struct {
 
 // NewHTTPServer starts new HTTP server over the agent
 func NewHTTPServer(agent *Agent, config *Config, logOutput io.Writer) (*HTTPServer, error) {
-	// Start the listener
-	lnAddr, err := net.ResolveTCPAddr("tcp", config.normalizedAddrs.HTTP)
+	// Start the listener, unless systemd passes the socket
+	listeners, err := sdListeners()
 	if err != nil {
 		return nil, err
 	}
-	ln, err := config.Listener("tcp", lnAddr.IP.String(), lnAddr.Port)
-	if err != nil {
-		return nil, fmt.Errorf("failed to start HTTP listener: %v", err)
+	var ln net.Listener
+	if len(listeners) > 0 {
+		ln = listeners[0]
+		for _, l := range listeners[1:] {
+			l.Close()
+		}
+		agent.logger.Printf("http: Using the socket of systemd on %v", ln.Addr())
+	} else {
+		lnAddr, err := net.ResolveTCPAddr("tcp", config.normalizedAddrs.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		ln, err = config.Listener("tcp", lnAddr.IP.String(), lnAddr.Port)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start HTTP listener: %v", err)
+		}
 	}
 
 	// Create the mux
@@ -81,7 +105,7 @@ func NewHTTPServer(agent *Agent, config *Config, logOutput io.Writer) (*HTTPServ
 	srv.registerHandlers()
 
 	// Start the server
-	go http.Serve(ln, gziphandler.GzipHandler(mux))
+	go http.Serve(ln, withRequestID(gziphandler.GzipHandler(gunzipBody(mux))))
 	return srv, nil
 }
 
@@ -149,9 +173,13 @@ func (s *HTTPServer) registerHandlers() {
 	s.mux.HandleFunc("/v1/cloud/order", s.wrap(s.OrderCloudRequest))
 
 	s.mux.HandleFunc("/v1/jobs", s.wrap(s.JobsRequest))
+	s.mux.HandleFunc("/v1/jobs/reconcile", s.wrap(s.JobsReconcileRequest))
+	s.mux.HandleFunc("/v1/jobs/bulk", s.wrap(s.JobsBulkRequest))
 	s.mux.HandleFunc("/v1/job/renewal", s.wrap(s.JobsRenewalRequest))
 	s.mux.HandleFunc("/v1/job/info", s.wrap(s.JobsInfoRequest))
 	s.mux.HandleFunc("/v1/validate/job", s.wrap(s.ValidateJobRequest))
+	s.mux.HandleFunc("/v1/assess/job", s.wrap(s.AssessJobRequest))
+	s.mux.HandleFunc("/v1/convert/job", s.wrap(s.ConvertJobRequest))
 	s.mux.HandleFunc("/v1/job/", s.wrap(s.JobSpecificRequest))
 
 	s.mux.HandleFunc("/v1/nodes", s.wrap(s.NodesRequest))
@@ -164,6 +192,9 @@ func (s *HTTPServer) registerHandlers() {
 	s.mux.HandleFunc("/v1/evaluation/", s.wrap(s.EvalSpecificRequest))
 
 	s.mux.HandleFunc("/v1/agent/allocation/", s.wrap(s.ClientAllocRequest))
+	if chaos.Enabled {
+		s.mux.HandleFunc("/v1/agent/chaos", s.wrap(s.AgentChaosRequest))
+	}
 
 	s.mux.HandleFunc("/v1/self", s.wrap(s.AgentSelfRequest))
 	s.mux.HandleFunc("/v1/join", s.wrap(s.AgentJoinRequest))
@@ -178,6 +209,11 @@ func (s *HTTPServer) registerHandlers() {
 
 	s.mux.HandleFunc("/v1/operator/", s.wrap(s.OperatorRequest))
 
+	s.mux.HandleFunc("/v1/quotas", s.wrap(s.QuotasRequest))
+	s.mux.HandleFunc("/v1/quota/", s.wrap(s.QuotaSpecificRequest))
+
+	s.mux.HandleFunc("/v1/sla", s.wrap(s.SLAReportsRequest))
+
 	if s.agent.config.LogLevel == "DEBUG" {
 		s.mux.HandleFunc("/debug/pprof/", pprof.Index)
 		s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
@@ -190,6 +226,10 @@ func (s *HTTPServer) registerHandlers() {
 		s.mux.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir(s.uiDir))))
 	} else if s.agent.config.EnableUi {
 		s.mux.Handle("/", http.StripPrefix("/", http.FileServer(assetFS())))
+	} else {
+		s.mux.HandleFunc("/", s.wrap(func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+			return nil, CodedError(404, "Invalid URL path")
+		}))
 	}
 
 	s.mux.Handle("/metrics", promhttp.Handler())
@@ -218,31 +258,133 @@ func (e *codedError) Code() int {
 	return e.code
 }
 
+// HTTPError is the body of the error responses of the HTTP API
+type HTTPError struct {
+	// Code is the HTTP status code of the response
+	Code    int
+	Message string
+	// Retryable tells if the same request may succeed later, e.g. once a
+	// leader is elected
+	Retryable bool
+	// Index is the index of the state the request was served from, or 0
+	Index     uint64
+	RequestID string
+}
+
+// retryableErrors are the errors of the requests which may succeed later.
+// They are matched on their message, which is all that is left of an error
+// forwarded by RPC.
+var retryableErrors = []string{
+	umodel.ErrNoLeader.Error(),
+	umodel.ErrNoRegionPath.Error(),
+	raft.ErrNotLeader.Error(),
+	raft.ErrLeadershipLost.Error(),
+	"no servers",
+}
+
+// isRetryable returns if a request which failed with err and the status code
+// may be retried.
+func isRetryable(code int, err error) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	msg := err.Error()
+	for _, e := range retryableErrors {
+		if strings.Contains(msg, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeError writes err as an HTTPError, with the code of err if it is an
+// HTTPCodedError, 500 otherwise.
+func writeError(resp http.ResponseWriter, req *http.Request, err error) {
+	code := 500
+	if coded, ok := err.(HTTPCodedError); ok {
+		code = coded.Code()
+	}
+	body := &HTTPError{
+		Code:      code,
+		Message:   err.Error(),
+		Retryable: isRetryable(code, err),
+		RequestID: requestID(req),
+	}
+	if index := resp.Header().Get("X-Udup-Index"); index != "" {
+		body.Index, _ = strconv.ParseUint(index, 10, 64)
+	}
+	buf, _ := json.Marshal(body)
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(code)
+	resp.Write(buf)
+}
+
+type requestIDKey struct{}
+
+// withRequestID gives each request an ID, on its context and in the
+// X-Request-Id response header. The ID sent by the client is kept, so that
+// it can follow a request through its own logs.
+func withRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLen {
+			id = umodel.GenerateUUID()
+		}
+		resp.Header().Set(requestIDHeader, id)
+		h.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the ID given to req by withRequestID
+func requestID(req *http.Request) string {
+	id, _ := req.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns the logger of the handlers of req, which logs its ID
+func (s *HTTPServer) requestLogger(req *http.Request) *log.Entry {
+	return s.logger.WithField("request", requestID(req))
+}
+
+// gunzipBody decompresses the request bodies sent with
+// "Content-Encoding: gzip".
+func gunzipBody(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if strings.EqualFold(req.Header.Get("Content-Encoding"), "gzip") {
+			zr, err := gzip.NewReader(req.Body)
+			if err != nil {
+				writeError(resp, req, CodedError(400, fmt.Sprintf("Invalid gzip body: %v", err)))
+				return
+			}
+			req.Body = zr
+			req.Header.Del("Content-Encoding")
+			req.ContentLength = -1
+		}
+		h.ServeHTTP(resp, req)
+	})
+}
+
 // wrap is used to wrap functions to make them more convenient
 func (s *HTTPServer) wrap(handler func(resp http.ResponseWriter, req *http.Request) (interface{}, error)) func(resp http.ResponseWriter, req *http.Request) {
 	f := func(resp http.ResponseWriter, req *http.Request) {
 		setHeaders(resp, s.agent.config.HTTPAPIResponseHeaders)
+		logger := s.requestLogger(req)
 		// Invoke the handler
 		reqURL := req.URL.String()
 		start := time.Now()
 		defer func() {
-			s.logger.Debugf("http: Request %v (%v)", reqURL, time.Now().Sub(start))
+			logger.Debugf("http: Request %v (%v)", reqURL, time.Now().Sub(start))
 		}()
 		obj, err := handler(resp, req)
 
 		// Check for an error
 	HAS_ERR:
 		if err != nil {
-			s.logger.Errorf("http: Request %v, error: %v", reqURL, err)
-			code := 500
-			if http, ok := err.(HTTPCodedError); ok {
-				code = http.Code()
-			}
-			resp.WriteHeader(code)
-			resp.Write([]byte(err.Error()))
+			logger.Errorf("http: Request %v, error: %v", reqURL, err)
+			writeError(resp, req, err)
 			return
 		}
-
 		prettyPrint := false
 		if v, ok := req.URL.Query()["pretty"]; ok {
 			if len(v) > 0 && (len(v[0]) == 0 || v[0] != "0") {
@@ -320,8 +462,7 @@ func parseWait(resp http.ResponseWriter, req *http.Request, b *umodel.QueryOptio
 	if wait := query.Get("wait"); wait != "" {
 		dur, err := time.ParseDuration(wait)
 		if err != nil {
-			resp.WriteHeader(400)
-			resp.Write([]byte("Invalid wait time"))
+			writeError(resp, req, CodedError(400, "Invalid wait time"))
 			return true
 		}
 		b.MaxQueryTime = dur
@@ -329,8 +470,7 @@ func parseWait(resp http.ResponseWriter, req *http.Request, b *umodel.QueryOptio
 	if idx := query.Get("index"); idx != "" {
 		index, err := strconv.ParseUint(idx, 10, 64)
 		if err != nil {
-			resp.WriteHeader(400)
-			resp.Write([]byte("Invalid index"))
+			writeError(resp, req, CodedError(400, "Invalid index"))
 			return true
 		}
 		b.MinQueryIndex = index
@@ -338,12 +478,32 @@ func parseWait(resp http.ResponseWriter, req *http.Request, b *umodel.QueryOptio
 	return false
 }
 
-// parseConsistency is used to parse the ?stale query params.
-func parseConsistency(req *http.Request, b *umodel.QueryOptions) {
+// parseConsistency is used to parse the ?stale and ?consistent query params.
+// ?stale lets a follower serve the read from its own state, within a maximum
+// staleness if one is given (e.g. ?stale=5s). ?consistent forces the read
+// through the leader, which checks it still is the leader first.
+// Returns true on error
+func parseConsistency(resp http.ResponseWriter, req *http.Request, b *umodel.QueryOptions) bool {
 	query := req.URL.Query()
 	if _, ok := query["stale"]; ok {
 		b.AllowStale = true
+		if stale := query.Get("stale"); stale != "" && stale != "true" {
+			dur, err := time.ParseDuration(stale)
+			if err != nil || dur < 0 {
+				writeError(resp, req, CodedError(400, "Invalid stale time"))
+				return true
+			}
+			b.MaxStaleDuration = dur
+		}
+	}
+	if _, ok := query["consistent"]; ok {
+		b.RequireConsistent = true
 	}
+	if b.AllowStale && b.RequireConsistent {
+		writeError(resp, req, CodedError(400, "Cannot specify ?stale with ?consistent, conflicting semantics."))
+		return true
+	}
+	return false
 }
 
 // parsePrefix is used to parse the ?prefix query param
@@ -366,7 +526,9 @@ func (s *HTTPServer) parseRegion(req *http.Request, r *string) {
 // parse is a convenience method for endpoints that need to parse multiple flags
 func (s *HTTPServer) parse(resp http.ResponseWriter, req *http.Request, r *string, b *umodel.QueryOptions) bool {
 	s.parseRegion(req, r)
-	parseConsistency(req, b)
+	if parseConsistency(resp, req, b) {
+		return true
+	}
 	parsePrefix(req, b)
 	return parseWait(resp, req, b)
 }
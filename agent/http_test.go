@@ -8,10 +8,17 @@ package agent
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	_ "net/http/pprof"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 	log "github.com/actiontech/dtle/internal/logger"
@@ -206,6 +213,104 @@ func Test_codedError_Code(t *testing.T) {
 	}
 }
 
+func Test_writeError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		index string
+		want  HTTPError
+	}{
+		{name: "coded", err: CodedError(404, "job not found"), index: "12",
+			want: HTTPError{Code: 404, Message: "job not found", Index: 12}},
+		{name: "internal", err: errors.New("boom"),
+			want: HTTPError{Code: 500, Message: "boom"}},
+		{name: "no leader", err: fmt.Errorf("rpc error: %v", umodel.ErrNoLeader),
+			want: HTTPError{Code: 500, Message: "rpc error: No cluster leader", Retryable: true}},
+		{name: "unavailable", err: CodedError(503, "busy"),
+			want: HTTPError{Code: 503, Message: "busy", Retryable: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			if tt.index != "" {
+				resp.Header().Set("X-Udup-Index", tt.index)
+			}
+			var id string
+			withRequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				id = requestID(req)
+				writeError(w, req, tt.err)
+			})).ServeHTTP(resp, httptest.NewRequest("GET", "/v1/jobs", nil))
+
+			if resp.Code != tt.want.Code {
+				t.Errorf("code = %v, want %v", resp.Code, tt.want.Code)
+			}
+			if got := resp.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %v", got)
+			}
+			var got HTTPError
+			if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q: %v", resp.Body.String(), err)
+			}
+			tt.want.RequestID = id
+			if id == "" || resp.Header().Get(requestIDHeader) != id {
+				t.Errorf("request ID %q, header %q", id, resp.Header().Get(requestIDHeader))
+			}
+			if got != tt.want {
+				t.Errorf("writeError() wrote %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_withRequestID(t *testing.T) {
+	var id string
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id = requestID(req)
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/jobs", nil)
+	req.Header.Set(requestIDHeader, "client-id")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	if id != "client-id" || resp.Header().Get(requestIDHeader) != "client-id" {
+		t.Errorf("request ID %q, header %q, want the client's", id, resp.Header().Get(requestIDHeader))
+	}
+
+	req = httptest.NewRequest("GET", "/v1/jobs", nil)
+	req.Header.Set(requestIDHeader, strings.Repeat("x", maxRequestIDLen+1))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if len(id) != 36 {
+		t.Errorf("request ID %q, want a new one", id)
+	}
+}
+
+func Test_gunzipBody(t *testing.T) {
+	var got string
+	h := gunzipBody(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		got = string(b)
+	}))
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"Name":"job1"}`))
+	zw.Close()
+	req := httptest.NewRequest("POST", "/v1/jobs", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got != `{"Name":"job1"}` {
+		t.Errorf("body = %q", got)
+	}
+
+	req = httptest.NewRequest("POST", "/v1/jobs", strings.NewReader("plain"))
+	req.Header.Set("Content-Encoding", "gzip")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	if resp.Code != 400 {
+		t.Errorf("code = %v, want 400", resp.Code)
+	}
+}
+
 func TestHTTPServer_wrap(t *testing.T) {
 	type fields struct {
 		agent    *Agent
@@ -375,19 +480,36 @@ func Test_parseWait(t *testing.T) {
 }
 
 func Test_parseConsistency(t *testing.T) {
-	type args struct {
-		req *http.Request
-		b   *umodel.QueryOptions
-	}
 	tests := []struct {
-		name string
-		args args
+		name    string
+		query   string
+		want    umodel.QueryOptions
+		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{name: "default", query: ""},
+		{name: "stale", query: "?stale", want: umodel.QueryOptions{AllowStale: true}},
+		{name: "max stale", query: "?stale=5s", want: umodel.QueryOptions{AllowStale: true, MaxStaleDuration: 5 * time.Second}},
+		{name: "bad stale", query: "?stale=soon", wantErr: true},
+		{name: "consistent", query: "?consistent", want: umodel.QueryOptions{RequireConsistent: true}},
+		{name: "both", query: "?stale&consistent", wantErr: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			parseConsistency(tt.args.req, tt.args.b)
+			req := httptest.NewRequest("GET", "/v1/jobs"+tt.query, nil)
+			resp := httptest.NewRecorder()
+			var got umodel.QueryOptions
+			if err := parseConsistency(resp, req, &got); err != tt.wantErr {
+				t.Fatalf("parseConsistency() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if resp.Code != 400 {
+					t.Errorf("code = %v", resp.Code)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseConsistency() got %+v, want %+v", got, tt.want)
+			}
 		})
 	}
 }
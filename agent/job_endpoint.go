@@ -7,15 +7,21 @@
 package agent
 
 import (
+	gosql "database/sql"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
+	"github.com/satori/go.uuid"
+	gomysql "github.com/siddontang/go-mysql/mysql"
 
 	"github.com/actiontech/dtle/api"
+	"github.com/actiontech/dtle/internal/client/driver/mysql"
 	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/client/driver/warehouse"
 	"github.com/actiontech/dtle/internal/config"
 	"github.com/actiontech/dtle/internal/models"
 )
@@ -31,6 +37,44 @@ func (s *HTTPServer) JobsRequest(resp http.ResponseWriter, req *http.Request) (i
 	}
 }
 
+// JobsBulkRequest pauses, resumes, stops or re-evaluates the jobs selected by
+// IDs or filters at once.
+func (s *HTTPServer) JobsBulkRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	var bulkRequest api.JobBulkRequest
+	if err := decodeBody(req, &bulkRequest); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	args := models.JobBulkRequest{
+		Operation: bulkRequest.Operation,
+		JobIDs:    bulkRequest.JobIDs,
+		WriteRequest: models.WriteRequest{
+			Region: bulkRequest.Region,
+		},
+	}
+	s.parseRegion(req, &args.Region)
+	for _, expr := range append(bulkRequest.Filters, req.URL.Query()["filter"]...) {
+		f, err := models.ParseJobFilter(expr)
+		if err != nil {
+			return nil, CodedError(400, err.Error())
+		}
+		args.Filters = append(args.Filters, f)
+	}
+
+	var out models.JobBulkResponse
+	if err := s.agent.RPC("Job.Bulk", &args, &out); err != nil {
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	if out.Results == nil {
+		out.Results = make([]*models.JobBulkResult, 0)
+	}
+	return out, nil
+}
+
 func (s *HTTPServer) JobsRenewalRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	switch req.Method {
 	case "PUT":
@@ -85,9 +129,9 @@ func (s *HTTPServer) jobInfoRequest(resp http.ResponseWriter, req *http.Request)
 			if err != nil {
 				return nil, err
 			}
-			dbs, err := sql.ShowDatabases(db)
+			dbs, err := sql.ShowDatabases(req.Context(), db)
 			if err != nil {
-				s.logger.Errorf("jobInfoRequest err at connect/showdatabases: %v", err.Error())
+				s.requestLogger(req).Errorf("jobInfoRequest err at connect/showdatabases: %v", err.Error())
 				return nil, err
 			}
 			for dbIdx, dbName := range dbs {
@@ -96,7 +140,7 @@ func (s *HTTPServer) jobInfoRequest(resp http.ResponseWriter, req *http.Request)
 					Name: dbName,
 				}
 
-				tbs, err := sql.ShowTables(db, dbName, true)
+				tbs, err := sql.ShowTables(req.Context(), db, dbName, true)
 				if err != nil {
 					return nil, err
 				}
@@ -128,6 +172,15 @@ func (s *HTTPServer) jobListRequest(resp http.ResponseWriter, req *http.Request)
 		return nil, nil
 	}
 
+	args.Owner = req.URL.Query().Get("owner")
+	for _, expr := range req.URL.Query()["filter"] {
+		f, err := models.ParseJobFilter(expr)
+		if err != nil {
+			return nil, CodedError(400, err.Error())
+		}
+		args.Filters = append(args.Filters, f)
+	}
+
 	var out models.JobListResponse
 	if err := s.agent.RPC("Job.List", &args, &out); err != nil {
 		return nil, err
@@ -155,11 +208,320 @@ func (s *HTTPServer) JobSpecificRequest(resp http.ResponseWriter, req *http.Requ
 	case strings.HasSuffix(path, "/evaluations"):
 		jobName := strings.TrimSuffix(path, "/evaluations")
 		return s.jobEvaluations(resp, req, jobName)
+	case strings.HasSuffix(path, "/verify"):
+		jobName := strings.TrimSuffix(path, "/verify")
+		return s.jobVerify(resp, req, jobName)
+	case strings.HasSuffix(path, "/checksum"):
+		jobName := strings.TrimSuffix(path, "/checksum")
+		return s.jobChecksum(resp, req, jobName)
+	case strings.HasSuffix(path, "/conflicts"):
+		jobName := strings.TrimSuffix(path, "/conflicts")
+		return s.jobConflicts(resp, req, jobName)
+	case strings.HasSuffix(path, "/ddl-history"):
+		jobName := strings.TrimSuffix(path, "/ddl-history")
+		return s.jobDDLHistory(resp, req, jobName)
+	case strings.HasSuffix(path, "/evaluate"):
+		jobName := strings.TrimSuffix(path, "/evaluate")
+		return s.jobForceEvaluate(resp, req, jobName)
+	case strings.HasSuffix(path, "/rescan"):
+		jobName := strings.TrimSuffix(path, "/rescan")
+		return s.jobRescan(resp, req, jobName)
+	case strings.HasSuffix(path, "/stats"):
+		jobName := strings.TrimSuffix(path, "/stats")
+		return s.jobStats(resp, req, jobName)
+	case strings.HasSuffix(path, "/sla"):
+		jobName := strings.TrimSuffix(path, "/sla")
+		return s.jobSLA(resp, req, jobName)
+	case strings.HasSuffix(path, "/clone"):
+		jobName := strings.TrimSuffix(path, "/clone")
+		return s.jobClone(resp, req, jobName)
+	case strings.HasSuffix(path, "/tunables"):
+		jobName := strings.TrimSuffix(path, "/tunables")
+		return s.jobTune(resp, req, jobName)
+	case strings.HasSuffix(path, "/checkpoint"):
+		jobName := strings.TrimSuffix(path, "/checkpoint")
+		return s.jobCheckpoint(resp, req, jobName)
+	case strings.HasSuffix(path, "/skip-tx"):
+		jobName := strings.TrimSuffix(path, "/skip-tx")
+		return s.jobSkipTx(resp, req, jobName)
 	default:
 		return s.jobCRUD(resp, req, path)
 	}
 }
 
+func (s *HTTPServer) jobForceEvaluate(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	args := models.JobEvaluateRequest{
+		JobID: jobName,
+	}
+	s.parseRegion(req, &args.Region)
+
+	var out models.JobResponse
+	if err := s.agent.RPC("Job.Evaluate", &args, &out); err != nil {
+		if strings.Contains(err.Error(), "job not found") {
+			return nil, CodedError(404, "job not found")
+		}
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	return out, nil
+}
+
+// jobRescan makes the running Src tasks of the job pick up the source tables
+// created since they started. The tasks on other nodes are reached through
+// the HTTP API of their node.
+func (s *HTTPServer) jobRescan(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	args := models.JobSpecificRequest{
+		JobID: jobName,
+	}
+	s.parseRegion(req, &args.Region)
+
+	var allocs models.JobAllocationsResponse
+	if err := s.agent.RPC("Job.Allocations", &args, &allocs); err != nil {
+		return nil, err
+	}
+
+	out := make([]*models.AllocRescanResponse, 0, 1)
+	for _, alloc := range allocs.Allocations {
+		if alloc.Task != models.TaskTypeSrc || alloc.ClientStatus != models.AllocClientStatusRunning {
+			continue
+		}
+		r, err := s.rescanAlloc(args.Region, alloc)
+		if err != nil {
+			return nil, fmt.Errorf("rescan of alloc %v: %v", alloc.ID, err)
+		}
+		out = append(out, r)
+	}
+	if len(out) == 0 {
+		return nil, CodedError(400, "job has no running Src task")
+	}
+	return out, nil
+}
+
+// rescanAlloc runs the rescan of an allocation on its node.
+func (s *HTTPServer) rescanAlloc(region string, alloc *models.AllocListStub) (*models.AllocRescanResponse, error) {
+	if client := s.agent.client; client != nil && client.Node().ID == alloc.NodeID {
+		return client.RescanAlloc(alloc.ID)
+	}
+
+	args := models.NodeSpecificRequest{
+		NodeID:       alloc.NodeID,
+		QueryOptions: models.QueryOptions{Region: region},
+	}
+	var node models.SingleNodeResponse
+	if err := s.agent.RPC("Node.GetNode", &args, &node); err != nil {
+		return nil, err
+	}
+	if node.Node == nil {
+		return nil, fmt.Errorf("node %v not found", alloc.NodeID)
+	}
+	if node.Node.HTTPAddr == "" {
+		return nil, fmt.Errorf("http addr of node %v is not advertised", alloc.NodeID)
+	}
+	client, err := api.NewClient(api.DefaultConfig().CopyConfig(node.Node.HTTPAddr))
+	if err != nil {
+		return nil, err
+	}
+	r, err := client.Allocations().Rescan(&api.Allocation{ID: alloc.ID, NodeID: alloc.NodeID}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AllocRescanResponse{AllocID: r.AllocID, Tables: r.Tables}, nil
+}
+
+// jobTune sets the tunables of a running job, which its tasks apply without
+// being rescheduled.
+func (s *HTTPServer) jobTune(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "PATCH" && req.Method != "PUT" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	args := models.JobTuneRequest{
+		JobID: jobName,
+	}
+	if err := decodeBody(req, &args.Tunables); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	s.parseRegion(req, &args.Region)
+
+	var out models.JobResponse
+	if err := s.agent.RPC("Job.Tune", &args, &out); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, CodedError(404, err.Error())
+		}
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	return out, nil
+}
+
+// jobCheckpoint shows where the tasks of a job resume, or sets it for a
+// paused job.
+func (s *HTTPServer) jobCheckpoint(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	switch req.Method {
+	case "GET":
+		return s.jobCheckpointQuery(resp, req, jobName)
+	case "PUT", "POST":
+		return s.jobCheckpointUpdate(resp, req, jobName)
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
+
+func (s *HTTPServer) jobCheckpointQuery(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	args := models.JobSpecificRequest{
+		JobID: jobName,
+	}
+	if args.Region == "" {
+		args.Region = s.agent.config.Region
+	}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+
+	var out models.SingleJobResponse
+	if err := s.agent.RPC("Job.GetJob", &args, &out); err != nil {
+		return nil, err
+	}
+	setMeta(resp, &out.QueryMeta)
+	if out.Job == nil {
+		return nil, CodedError(404, "job not found")
+	}
+	dest := out.Job.LookupTask(models.TaskTypeDest)
+	if dest == nil {
+		return nil, CodedError(400, fmt.Sprintf("job has no task %v", models.TaskTypeDest))
+	}
+	gtid, progress, err := dest.Checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	return &models.JobCheckpointResponse{
+		JobID:        out.Job.ID,
+		Status:       out.Job.Status,
+		Gtid:         gtid,
+		CopyProgress: progress,
+	}, nil
+}
+
+func (s *HTTPServer) jobCheckpointUpdate(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	args := models.JobSetCheckpointRequest{
+		JobID: jobName,
+	}
+	if err := decodeBody(req, &args); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	args.JobID = jobName
+	if args.Gtid != "" {
+		if _, err := gomysql.ParseMysqlGTIDSet(args.Gtid); err != nil {
+			return nil, CodedError(400, fmt.Sprintf("invalid Gtid: %v", err))
+		}
+	}
+	s.parseRegion(req, &args.Region)
+
+	var out models.JobResponse
+	if err := s.agent.RPC("Job.SetCheckpoint", &args, &out); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, CodedError(404, err.Error())
+		}
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	return out, nil
+}
+
+// jobSkipTx arms a running job to skip its next transaction failing on the
+// target, or lists the transactions it skipped.
+func (s *HTTPServer) jobSkipTx(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	switch req.Method {
+	case "GET":
+		return s.jobSkippedTxs(resp, req, jobName)
+	case "PUT", "POST":
+		return s.jobSkipTxUpdate(resp, req, jobName)
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
+
+func (s *HTTPServer) jobSkippedTxs(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	limit, err := parseLimit(req)
+	if err != nil {
+		return nil, err
+	}
+	job, dstDB, err := s.jobTargetDB(resp, req, jobName)
+	if job == nil || err != nil {
+		return nil, err
+	}
+	defer dstDB.Close()
+
+	skipped, err := mysql.ListSkippedTxs(req.Context(), dstDB, job.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &models.JobSkippedTxsResponse{
+		JobID:   job.ID,
+		Skipped: skipped,
+	}, nil
+}
+
+func (s *HTTPServer) jobSkipTxUpdate(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	args := models.JobSkipTxRequest{
+		JobID: jobName,
+	}
+	if err := decodeBody(req, &args); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	args.JobID = jobName
+	if args.Gtid != "" {
+		gtid, err := parseGtid(args.Gtid)
+		if err != nil {
+			return nil, CodedError(400, fmt.Sprintf("invalid Gtid: %v", err))
+		}
+		args.Gtid = gtid
+	}
+	s.parseRegion(req, &args.Region)
+
+	var out models.JobSkipTxResponse
+	if err := s.agent.RPC("Job.SkipTx", &args, &out); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, CodedError(404, err.Error())
+		}
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	return out, nil
+}
+
+// parseGtid checks the GTID of a transaction, "uuid:number", and returns it
+// as the applier names it.
+func parseGtid(gtid string) (string, error) {
+	parts := strings.Split(gtid, ":")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("%q is not a transaction, as 'uuid:number'", gtid)
+	}
+	sid, err := uuid.FromString(parts[0])
+	if err != nil {
+		return "", err
+	}
+	gno, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || gno <= 0 {
+		return "", fmt.Errorf("bad transaction number in %q", gtid)
+	}
+	return fmt.Sprintf("%s:%d", sid, gno), nil
+}
+
 func (s *HTTPServer) jobAllocations(resp http.ResponseWriter, req *http.Request,
 	jobName string) (interface{}, error) {
 	if req.Method != "GET" {
@@ -217,6 +579,327 @@ func (s *HTTPServer) jobEvaluations(resp http.ResponseWriter, req *http.Request,
 	return out.Evaluations, nil
 }
 
+// jobStats returns the samples of the lag and the throughput of the job over
+// the ?period, an hour by default.
+func (s *HTTPServer) jobStats(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	args := models.JobStatsRequest{
+		JobID: jobName,
+	}
+	if period := req.URL.Query().Get("period"); period != "" {
+		d, err := time.ParseDuration(period)
+		if err != nil || d <= 0 {
+			return nil, CodedError(400, fmt.Sprintf("invalid period %q", period))
+		}
+		args.Period = d
+	}
+	if args.Region == "" {
+		args.Region = s.agent.config.Region
+	}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+
+	var out models.JobStatsResponse
+	if err := s.agent.RPC("Job.Stats", &args, &out); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, CodedError(404, err.Error())
+		}
+		return nil, err
+	}
+
+	setMeta(resp, &out.QueryMeta)
+	if out.Samples == nil {
+		out.Samples = make([]*models.JobStatsSample, 0)
+	}
+	return out.Samples, nil
+}
+
+// jobSLA returns the compliance of a job to its SLA.
+func (s *HTTPServer) jobSLA(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	args := models.JobSLARequest{
+		JobID: jobName,
+	}
+	if args.Region == "" {
+		args.Region = s.agent.config.Region
+	}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+
+	var out models.JobSLAResponse
+	if err := s.agent.RPC("Job.SLA", &args, &out); err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "has no SLA") {
+			return nil, CodedError(404, err.Error())
+		}
+		return nil, err
+	}
+
+	setMeta(resp, &out.QueryMeta)
+	return out.Report, nil
+}
+
+// jobVerify compares row counts of source and target of a MySQL to MySQL job.
+// Query parameters: maxpk=true to also compare MAX() of the primary key,
+// sum=<column> to also compare SUM() of a column.
+func (s *HTTPServer) jobVerify(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	maxPk, _ := strconv.ParseBool(req.URL.Query().Get("maxpk"))
+	opts := &mysql.VerifyOptions{
+		MaxPk:     maxPk,
+		SumColumn: req.URL.Query().Get("sum"),
+	}
+
+	args := models.JobSpecificRequest{
+		JobID: jobName,
+	}
+	if args.Region == "" {
+		args.Region = s.agent.config.Region
+	}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+
+	var out models.SingleJobResponse
+	if err := s.agent.RPC("Job.GetJob", &args, &out); err != nil {
+		return nil, err
+	}
+	setMeta(resp, &out.QueryMeta)
+	if out.Job == nil {
+		return nil, CodedError(404, "job not found")
+	}
+
+	var srcConfig, dstConfig *config.MySQLDriverConfig
+	for _, task := range out.Job.Tasks {
+		if task.Driver != models.TaskDriverMySQL {
+			return nil, CodedError(400, "verify is only supported between MySQL tasks")
+		}
+		var driverConfig config.MySQLDriverConfig
+		if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+			return nil, err
+		}
+		if driverConfig.ConnectionConfig == nil {
+			return nil, CodedError(400, fmt.Sprintf("missing ConnectionConfig of task %v", task.Type))
+		}
+		switch task.Type {
+		case models.TaskTypeSrc:
+			srcConfig = &driverConfig
+		case models.TaskTypeDest:
+			dstConfig = &driverConfig
+		}
+	}
+	if srcConfig == nil || dstConfig == nil {
+		return nil, CodedError(400, "job should have both Src and Dest tasks")
+	}
+
+	srcDB, err := sql.CreateDB(srcConfig.ConnectionConfig.GetDBUri())
+	if err != nil {
+		return nil, err
+	}
+	defer srcDB.Close()
+	dstDB, err := sql.CreateDB(dstConfig.ConnectionConfig.GetDBUri())
+	if err != nil {
+		return nil, err
+	}
+	defer dstDB.Close()
+
+	tables, err := mysql.VerifyTables(req.Context(), srcDB, dstDB, srcConfig.ReplicateDoDb, srcConfig.ReplicateIgnoreDb, opts)
+	if err != nil {
+		return nil, err
+	}
+	reply := &models.JobVerifyResponse{
+		JobID:  jobName,
+		Match:  true,
+		Tables: tables,
+	}
+	for _, tb := range tables {
+		if !tb.Match {
+			reply.Match = false
+		}
+	}
+	return reply, nil
+}
+
+// jobChecksum reports the tables compared by the last Checksum step of the
+// job which completed.
+func (s *HTTPServer) jobChecksum(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	args := models.JobSpecificRequest{
+		JobID: jobName,
+	}
+	if args.Region == "" {
+		args.Region = s.agent.config.Region
+	}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+
+	var out models.JobAllocationsResponse
+	if err := s.agent.RPC("Job.Allocations", &args, &out); err != nil {
+		return nil, err
+	}
+	setMeta(resp, &out.QueryMeta)
+
+	var report *models.JobChecksumResponse
+	for _, alloc := range out.Allocations {
+		if alloc.Task != models.TaskTypeChecksum {
+			continue
+		}
+		for _, state := range alloc.TaskStates {
+			for _, event := range state.Events {
+				if event.Type != models.TaskStepCompleted || (report != nil && !event.Time.After(report.Time)) {
+					continue
+				}
+				report = &models.JobChecksumResponse{
+					JobID:   jobName,
+					AllocID: alloc.ID,
+					Time:    event.Time,
+					Tables:  event.Checksums,
+				}
+			}
+		}
+	}
+	if report == nil {
+		return nil, CodedError(404, "no Checksum step of the job completed")
+	}
+	for _, table := range report.Tables {
+		if !table.Match {
+			report.DiffTables++
+		}
+	}
+	report.Match = report.DiffTables == 0
+	if report.Tables == nil {
+		report.Tables = make([]*models.TableChecksum, 0)
+	}
+	return report, nil
+}
+
+func (s *HTTPServer) jobConflicts(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	limit, err := parseLimit(req)
+	if err != nil {
+		return nil, err
+	}
+	job, dstDB, err := s.jobTargetDB(resp, req, jobName)
+	if job == nil || err != nil {
+		return nil, err
+	}
+	defer dstDB.Close()
+
+	conflicts, err := mysql.ListConflicts(req.Context(), dstDB, job.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &models.JobConflictsResponse{
+		JobID:     job.ID,
+		Conflicts: conflicts,
+	}, nil
+}
+
+func (s *HTTPServer) jobDDLHistory(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	limit, err := parseLimit(req)
+	if err != nil {
+		return nil, err
+	}
+	schema := req.URL.Query().Get("schema")
+	table := req.URL.Query().Get("table")
+	if table != "" && schema == "" {
+		return nil, CodedError(400, "table needs a schema")
+	}
+	job, dstDB, err := s.jobTargetDB(resp, req, jobName)
+	if job == nil || err != nil {
+		return nil, err
+	}
+	defer dstDB.Close()
+
+	ddls, err := mysql.ListDDLHistory(req.Context(), dstDB, job.ID, schema, table, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &models.JobDDLHistoryResponse{
+		JobID: job.ID,
+		DDLs:  ddls,
+	}, nil
+}
+
+// parseLimit reads the limit of the records to list, 100 by default
+func parseLimit(req *http.Request) (int, error) {
+	limit := 100
+	if l := req.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+			return 0, CodedError(400, fmt.Sprintf("invalid limit: %v", l))
+		}
+	}
+	return limit, nil
+}
+
+// jobTargetDB connects to the target of the MySQL Dest task of the job
+// jobName, where the applier records the job. The job is nil if the request
+// is answered already.
+func (s *HTTPServer) jobTargetDB(resp http.ResponseWriter, req *http.Request,
+	jobName string) (*models.Job, *gosql.DB, error) {
+	args := models.JobSpecificRequest{
+		JobID: jobName,
+	}
+	if args.Region == "" {
+		args.Region = s.agent.config.Region
+	}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil, nil
+	}
+
+	var out models.SingleJobResponse
+	if err := s.agent.RPC("Job.GetJob", &args, &out); err != nil {
+		return nil, nil, err
+	}
+	setMeta(resp, &out.QueryMeta)
+	if out.Job == nil {
+		return nil, nil, CodedError(404, "job not found")
+	}
+
+	var dstConfig *config.MySQLDriverConfig
+	for _, task := range out.Job.Tasks {
+		if task.Type != models.TaskTypeDest || task.Driver != models.TaskDriverMySQL {
+			continue
+		}
+		var driverConfig config.MySQLDriverConfig
+		if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+			return nil, nil, err
+		}
+		dstConfig = &driverConfig
+	}
+	if dstConfig == nil || dstConfig.ConnectionConfig == nil {
+		return nil, nil, CodedError(400, "job should have a MySQL Dest task")
+	}
+
+	dstDB, err := sql.CreateDB(dstConfig.ConnectionConfig.GetDBUri())
+	if err != nil {
+		return nil, nil, err
+	}
+	return out.Job, dstDB, nil
+}
+
 func (s *HTTPServer) jobCRUD(resp http.ResponseWriter, req *http.Request,
 	jobName string) (interface{}, error) {
 	switch req.Method {
@@ -261,7 +944,6 @@ func (s *HTTPServer) jobQuery(resp http.ResponseWriter, req *http.Request,
 func (s *HTTPServer) jobUpdate(resp http.ResponseWriter, req *http.Request,
 	jobName string) (interface{}, error) {
 	var args *api.Job
-	var trafficLimit int
 	if err := decodeBody(req, &args); err != nil {
 		return nil, CodedError(400, err.Error())
 	}
@@ -277,23 +959,9 @@ func (s *HTTPServer) jobUpdate(resp http.ResponseWriter, req *http.Request,
 	}
 	s.parseRegion(req, args.Region)
 
-	for _, order := range args.Orders {
-		argsOrder := models.OrderSpecificRequest{
-			OrderID: order,
-		}
-		if s.parse(resp, req, &argsOrder.Region, &argsOrder.QueryOptions) {
-			return nil, nil
-		}
-		var outOrder models.SingleOrderResponse
-		if err := s.agent.RPC("Order.GetOrder", &argsOrder, &outOrder); err != nil {
-			return nil, err
-		}
-
-		setMeta(resp, &outOrder.QueryMeta)
-		if outOrder.Order == nil {
-			return nil, CodedError(404, "order not found")
-		}
-		trafficLimit += outOrder.Order.TrafficAgainstLimits
+	trafficLimit, err := s.trafficLimit(*args.Region, args.Orders)
+	if err != nil {
+		return nil, err
 	}
 
 	sJob := ApiJobToStructJob(args, trafficLimit)
@@ -302,6 +970,7 @@ func (s *HTTPServer) jobUpdate(resp http.ResponseWriter, req *http.Request,
 		Job:            sJob,
 		EnforceIndex:   args.EnforceIndex,
 		JobModifyIndex: *args.JobModifyIndex,
+		WarmRestart:    args.WarmRestart,
 		WriteRequest: models.WriteRequest{
 			Region: *args.Region,
 		},
@@ -315,6 +984,26 @@ func (s *HTTPServer) jobUpdate(resp http.ResponseWriter, req *http.Request,
 	return out, nil
 }
 
+// trafficLimit sums the traffic limits of the orders of a job.
+func (s *HTTPServer) trafficLimit(region string, orders []string) (int, error) {
+	var trafficLimit int
+	for _, order := range orders {
+		argsOrder := models.OrderSpecificRequest{
+			OrderID:      order,
+			QueryOptions: models.QueryOptions{Region: region},
+		}
+		var outOrder models.SingleOrderResponse
+		if err := s.agent.RPC("Order.GetOrder", &argsOrder, &outOrder); err != nil {
+			return 0, err
+		}
+		if outOrder.Order == nil {
+			return 0, CodedError(404, "order not found")
+		}
+		trafficLimit += outOrder.Order.TrafficAgainstLimits
+	}
+	return trafficLimit, nil
+}
+
 func (s *HTTPServer) jobRenewalRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	var args *api.RenewalJobRequest
 	if err := decodeBody(req, &args); err != nil {
@@ -432,27 +1121,181 @@ func (s *HTTPServer) ValidateJobRequest(resp http.ResponseWriter, req *http.Requ
 	return out, nil
 }
 
+// AssessJobRequest reports the migration blockers of the source tables of a
+// job spec, before the job is registered.
+// Query parameters: scan=true to read the biggest BLOB/TEXT/JSON values of the tables.
+func (s *HTTPServer) AssessJobRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	var assessRequest api.JobAssessRequest
+	if err := decodeBody(req, &assessRequest); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	if assessRequest.Job == nil {
+		return nil, CodedError(400, "Job must be specified")
+	}
+	scan, _ := strconv.ParseBool(req.URL.Query().Get("scan"))
+
+	var srcConfig *config.MySQLDriverConfig
+	for _, task := range assessRequest.Job.Tasks {
+		if task.Type != models.TaskTypeSrc {
+			continue
+		}
+		if task.Driver != "" && task.Driver != models.TaskDriverMySQL {
+			return nil, CodedError(400, "assess is only supported on a MySQL Src task")
+		}
+		var driverConfig config.MySQLDriverConfig
+		if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+			return nil, CodedError(400, err.Error())
+		}
+		if driverConfig.ConnectionConfig == nil {
+			return nil, CodedError(400, "missing ConnectionConfig of the Src task")
+		}
+		srcConfig = &driverConfig
+	}
+	if srcConfig == nil {
+		return nil, CodedError(400, "job should have a Src task")
+	}
+
+	db, err := sql.CreateDB(srcConfig.ConnectionConfig.GetDBUri())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	opts := &mysql.AssessOptions{
+		MaxPayload: s.agent.config.Network.MaxPayload,
+		ScanBlobs:  scan,
+	}
+	tables, err := mysql.AssessTables(req.Context(), db, srcConfig.ReplicateDoDb, srcConfig.ReplicateIgnoreDb, opts)
+	if err != nil {
+		return nil, err
+	}
+	reply := &models.JobAssessResponse{
+		Tables: tables,
+	}
+	if assessRequest.Job.ID != nil {
+		reply.JobID = *assessRequest.Job.ID
+	}
+	for _, tb := range tables {
+		for _, issue := range tb.Issues {
+			if issue.Severity == models.AssessSeverityBlocker {
+				reply.Blockers++
+			} else {
+				reply.Warnings++
+			}
+		}
+	}
+	return reply, nil
+}
+
+// ConvertJobRequest reports the proposed target tables of a job spec with a
+// Warehouse Dest task, for review before CreateTables is set.
+func (s *HTTPServer) ConvertJobRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	var convertRequest api.JobConvertRequest
+	if err := decodeBody(req, &convertRequest); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	if convertRequest.Job == nil {
+		return nil, CodedError(400, "Job must be specified")
+	}
+
+	var srcConfig *config.MySQLDriverConfig
+	var destConfig *warehouse.WarehouseConfig
+	for _, task := range convertRequest.Job.Tasks {
+		switch {
+		case task.Type == models.TaskTypeSrc && (task.Driver == "" || task.Driver == models.TaskDriverMySQL):
+			var driverConfig config.MySQLDriverConfig
+			if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+				return nil, CodedError(400, err.Error())
+			}
+			if driverConfig.ConnectionConfig == nil {
+				return nil, CodedError(400, "missing ConnectionConfig of the Src task")
+			}
+			srcConfig = &driverConfig
+		case task.Type == models.TaskTypeDest && task.Driver == models.TaskDriverWarehouse:
+			var driverConfig warehouse.WarehouseConfig
+			if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+				return nil, CodedError(400, err.Error())
+			}
+			destConfig = &driverConfig
+		}
+	}
+	if srcConfig == nil || destConfig == nil {
+		return nil, CodedError(400, "conversion needs a MySQL Src task and a Warehouse Dest task")
+	}
+
+	db, err := sql.CreateDB(srcConfig.ConnectionConfig.GetDBUri())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tables, err := mysql.ListJobTables(req.Context(), db, srcConfig.ReplicateDoDb, srcConfig.ReplicateIgnoreDb)
+	if err != nil {
+		return nil, err
+	}
+	reply := &models.JobConvertResponse{
+		Target: strings.ToLower(destConfig.Type),
+	}
+	if convertRequest.Job.ID != nil {
+		reply.JobID = *convertRequest.Job.ID
+	}
+	for _, tb := range tables {
+		reply.Tables = append(reply.Tables, warehouse.ConvertTable(destConfig, tb))
+	}
+	return reply, nil
+}
+
 func ApiJobToStructJob(job *api.Job, trafficLimit int) *models.Job {
 	job.Canonicalize()
 
 	j := &models.Job{
-		Region:            *job.Region,
-		ID:                *job.ID,
-		Orders:            job.Orders,
-		Name:              *job.Name,
-		Failover:          job.Failover,
-		Type:              *job.Type,
-		Datacenters:       job.Datacenters,
-		Status:            *job.Status,
-		StatusDescription: *job.StatusDescription,
-		CreateIndex:       *job.CreateIndex,
-		ModifyIndex:       *job.ModifyIndex,
-		JobModifyIndex:    *job.JobModifyIndex,
+		Region:             *job.Region,
+		ID:                 *job.ID,
+		Orders:             job.Orders,
+		Name:               *job.Name,
+		Namespace:          *job.Namespace,
+		Owner:              *job.Owner,
+		Meta:               job.Meta,
+		Failover:           job.Failover,
+		Type:               *job.Type,
+		Datacenters:        job.Datacenters,
+		SchedulerAlgorithm: job.SchedulerAlgorithm,
+		EncryptTransit:     job.EncryptTransit,
+		Groups:             job.Groups,
+		Status:             *job.Status,
+		StatusDescription:  *job.StatusDescription,
+		CreateIndex:        *job.CreateIndex,
+		ModifyIndex:        *job.ModifyIndex,
+		JobModifyIndex:     *job.JobModifyIndex,
+	}
+	if job.SLA != nil {
+		j.SLA = &models.SLASpec{
+			MaxLagSeconds:      job.SLA.MaxLagSeconds,
+			MaxDowntimeSeconds: job.SLA.MaxDowntimeSeconds,
+		}
 	}
 
 	j.Tasks = make([]*models.Task, len(job.Tasks))
 	cfg := ""
+	exportOnly := false
 	for _, task := range job.Tasks {
+		if task.Type == models.TaskTypeDest && task.Driver == models.TaskDriverExport {
+			exportOnly = true
+		}
+	}
+	for _, task := range job.Tasks {
+		if task.Type == models.TaskTypeSrc && exportOnly {
+			// an export ends with the full copy
+			task.Config["SkipIncrementalCopy"] = true
+		}
 		if task.Type == models.TaskTypeSrc {
 			task.Config["TrafficAgainstLimits"] = trafficLimit
 			if task.Config["Gtid"] != nil {
@@ -464,10 +1307,34 @@ func ApiJobToStructJob(job *api.Job, trafficLimit int) *models.Job {
 			task.Driver = models.TaskDriverMySQL
 		}
 	}
+	var standby, dest *api.Task
+	for _, task := range job.Tasks {
+		switch task.Type {
+		case models.TaskTypeDestStandby:
+			standby = task
+		case models.TaskTypeDest:
+			dest = task
+		}
+	}
+	if standby != nil && dest != nil {
+		// the standby applies to the database of the Dest task unless
+		// configured otherwise
+		if standby.Config == nil {
+			standby.Config = make(map[string]interface{})
+		}
+		for k, v := range dest.Config {
+			if _, ok := standby.Config[k]; !ok {
+				standby.Config[k] = v
+			}
+		}
+	}
 	for i, task := range job.Tasks {
-		if task.Type == models.TaskTypeDest {
-			task.Leader = true
+		if task.Type == models.TaskTypeDest || task.Type == models.TaskTypeDestStandby {
+			task.Leader = task.Type == models.TaskTypeDest
 			task.Config["Gtid"] = cfg
+			if j.Type == models.JobTypeMigration {
+				task.Config["Migration"] = true
+			}
 		}
 		t := models.NewTask()
 		ApiTaskToStructsTask(task, t)
@@ -483,5 +1350,7 @@ func ApiTaskToStructsTask(apiTask *api.Task, structsTask *models.Task) {
 	structsTask.NodeName = apiTask.NodeName
 	structsTask.Driver = apiTask.Driver
 	structsTask.Leader = apiTask.Leader
+	structsTask.DiskQuotaMB = apiTask.DiskQuotaMB
+	structsTask.Group = apiTask.Group
 	structsTask.Config = apiTask.Config
 }
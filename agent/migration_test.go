@@ -0,0 +1,35 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/actiontech/dtle/api"
+	"github.com/actiontech/dtle/internal"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestApiJobToStructJob_Migration(t *testing.T) {
+	job := devJob()
+	job.Type = internal.StringToPtr(models.JobTypeMigration)
+	job.Tasks = append(job.Tasks, &api.Task{Type: models.TaskTypeDestStandby})
+
+	sJob := ApiJobToStructJob(job, 0)
+	if sJob.Type != models.JobTypeMigration {
+		t.Fatalf("job type = %v", sJob.Type)
+	}
+	for _, task := range sJob.Tasks {
+		if migration := task.Config["Migration"] == true; migration != (task.Type != models.TaskTypeSrc) {
+			t.Errorf("task %v: Migration = %v", task.Type, task.Config["Migration"])
+		}
+	}
+
+	if sJob := ApiJobToStructJob(devJob(), 0); sJob.LookupTask(models.TaskTypeDest).Config["Migration"] != nil {
+		t.Errorf("Migration of a synchronous job = %v", sJob.LookupTask(models.TaskTypeDest).Config["Migration"])
+	}
+}
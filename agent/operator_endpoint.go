@@ -7,7 +7,6 @@
 package agent
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
@@ -17,12 +16,20 @@ import (
 )
 
 func (s *HTTPServer) OperatorRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.URL.Path == "/v1/operator/state" {
+		return s.OperatorState(resp, req)
+	}
+	if req.URL.Path == "/v1/operator/plans" {
+		return s.OperatorPlanStats(resp, req)
+	}
 	path := strings.TrimPrefix(req.URL.Path, "/v1/operator/raft/")
 	switch {
 	case strings.HasPrefix(path, "configuration"):
 		return s.OperatorRaftConfiguration(resp, req)
 	case strings.HasPrefix(path, "peer"):
 		return s.OperatorRaftPeer(resp, req)
+	case strings.HasPrefix(path, "compact"):
+		return s.OperatorRaftCompact(resp, req)
 	default:
 		return nil, CodedError(404, ErrInvalidMethod)
 	}
@@ -32,8 +39,7 @@ func (s *HTTPServer) OperatorRequest(resp http.ResponseWriter, req *http.Request
 // This supports the stale query mode in case the cluster doesn't have a leader.
 func (s *HTTPServer) OperatorRaftConfiguration(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	if req.Method != "GET" {
-		resp.WriteHeader(http.StatusMethodNotAllowed)
-		return nil, nil
+		return nil, CodedError(http.StatusMethodNotAllowed, ErrInvalidMethod)
 	}
 
 	var args models.GenericRequest
@@ -53,8 +59,7 @@ func (s *HTTPServer) OperatorRaftConfiguration(resp http.ResponseWriter, req *ht
 // removing peers by address.
 /*func (s *HTTPServer) OperatorRaftPeer(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	if req.Method != "DELETE" {
-		resp.WriteHeader(http.StatusMethodNotAllowed)
-		return nil, nil
+		return nil, CodedError(http.StatusMethodNotAllowed, ErrInvalidMethod)
 	}
 
 	var args models.RaftPeerByAddressRequest
@@ -80,8 +85,7 @@ func (s *HTTPServer) OperatorRaftConfiguration(resp http.ResponseWriter, req *ht
 // removing peers by address.
 func (s *HTTPServer) OperatorRaftPeer(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	if req.Method != "DELETE" {
-		resp.WriteHeader(http.StatusMethodNotAllowed)
-		return nil, nil
+		return nil, CodedError(http.StatusMethodNotAllowed, ErrInvalidMethod)
 	}
 
 	var args models.RaftRemovePeerRequest
@@ -100,14 +104,10 @@ func (s *HTTPServer) OperatorRaftPeer(resp http.ResponseWriter, req *http.Reques
 	}
 
 	if !hasID && !hasAddress {
-		resp.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(resp, "Must specify either ?id with the server's ID or ?address with IP:port of peer to remove")
-		return nil, nil
+		return nil, CodedError(http.StatusBadRequest, "Must specify either ?id with the server's ID or ?address with IP:port of peer to remove")
 	}
 	if hasID && hasAddress {
-		resp.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(resp, "Must specify only one of ?id or ?address")
-		return nil, nil
+		return nil, CodedError(http.StatusBadRequest, "Must specify only one of ?id or ?address")
 	}
 
 	var reply struct{}
@@ -121,3 +121,77 @@ func (s *HTTPServer) OperatorRaftPeer(resp http.ResponseWriter, req *http.Reques
 
 	return nil, nil
 }
+
+// OperatorRaftCompact compacts the raft store of the manager of this agent.
+func (s *HTTPServer) OperatorRaftCompact(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(http.StatusMethodNotAllowed, ErrInvalidMethod)
+	}
+	if s.agent.Server() == nil {
+		return nil, CodedError(http.StatusBadRequest, "the agent is not a manager")
+	}
+
+	var args models.GenericRequest
+	s.parseRegion(req, &args.Region)
+
+	var reply models.RaftCompactResponse
+	if err := s.agent.RPC("Operator.RaftCompact", &args, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// OperatorPlanStats returns the outcome of the plans applied by the leader.
+func (s *HTTPServer) OperatorPlanStats(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	var args models.GenericRequest
+	if done := s.parse(resp, req, &args.Region, &args.QueryOptions); done {
+		return nil, nil
+	}
+
+	var reply models.PlanStatsResponse
+	if err := s.agent.RPC("Operator.PlanStats", &args, &reply); err != nil {
+		return nil, err
+	}
+	setMeta(resp, &reply.QueryMeta)
+	return reply.Stats, nil
+}
+
+// OperatorState exports the state of the cluster on GET, and imports an
+// exported state on PUT or POST.
+func (s *HTTPServer) OperatorState(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	switch req.Method {
+	case "GET":
+		var args models.GenericRequest
+		if done := s.parse(resp, req, &args.Region, &args.QueryOptions); done {
+			return nil, nil
+		}
+
+		var reply models.StateExportResponse
+		if err := s.agent.RPC("Operator.StateExport", &args, &reply); err != nil {
+			return nil, err
+		}
+		setMeta(resp, &reply.QueryMeta)
+		return reply.State, nil
+	case "PUT", "POST":
+		var args models.StateImportRequest
+		args.State = new(models.StateExport)
+		if err := decodeBody(req, args.State); err != nil {
+			return nil, CodedError(400, err.Error())
+		}
+		s.parseRegion(req, &args.Region)
+		args.Force = req.URL.Query().Get("force") == "true"
+
+		var reply models.StateImportResponse
+		if err := s.agent.RPC("Operator.StateImport", &args, &reply); err != nil {
+			return nil, err
+		}
+		setIndex(resp, reply.Index)
+		return reply, nil
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	defaultLogFile = "/var/log/dtle/dtle.log"
+	defaultPidFile = "/var/run/dtle/dtle.pid"
+)
+
+// handledSignals are the signals handleSignals waits for.
+var handledSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGPIPE}
+
+// raiseOpenFilesLimit raises the soft limit of open files to the hard limit.
+// Each job holds MySQL and NATS connections, and the limit of 1024 of most
+// distributions is reached by a few dozen jobs.
+func raiseOpenFilesLimit() (uint64, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, err
+	}
+	if limit.Cur >= limit.Max {
+		return uint64(limit.Cur), nil
+	}
+	limit.Cur = limit.Max
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, err
+	}
+	return uint64(limit.Cur), nil
+}
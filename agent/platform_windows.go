@@ -0,0 +1,34 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+var (
+	defaultLogFile = filepath.Join(programData(), "dtle", "dtle.log")
+	defaultPidFile = filepath.Join(programData(), "dtle", "dtle.pid")
+)
+
+func programData() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return `C:\ProgramData`
+}
+
+// handledSignals are the signals handleSignals waits for. There is no
+// SIGHUP on windows: the configuration is not reloaded.
+var handledSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// raiseOpenFilesLimit does nothing: windows has no limit of open handles per process.
+func raiseOpenFilesLimit() (uint64, error) {
+	return 0, nil
+}
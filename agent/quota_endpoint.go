@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// QuotasRequest lists the quotas and their usage on GET, and creates or
+// updates a quota on PUT or POST.
+func (s *HTTPServer) QuotasRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	switch req.Method {
+	case "GET":
+		return s.quotaList(resp, req)
+	case "PUT", "POST":
+		return s.quotaUpsert(resp, req)
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
+
+func (s *HTTPServer) quotaList(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	args := models.QuotaListRequest{}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+
+	var out models.QuotaListResponse
+	if err := s.agent.RPC("Quota.List", &args, &out); err != nil {
+		return nil, err
+	}
+
+	setMeta(resp, &out.QueryMeta)
+	if out.Usages == nil {
+		out.Usages = make([]*models.QuotaUsage, 0)
+	}
+	return out.Usages, nil
+}
+
+func (s *HTTPServer) quotaUpsert(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	args := models.QuotaUpsertRequest{Quota: new(models.QuotaSpec)}
+	if err := decodeBody(req, args.Quota); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	s.parseRegion(req, &args.Region)
+
+	var out models.GenericResponse
+	if err := s.agent.RPC("Quota.Upsert", &args, &out); err != nil {
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	return nil, nil
+}
+
+// QuotaSpecificRequest gets the quota of a namespace and its usage on GET,
+// and deletes it on DELETE.
+func (s *HTTPServer) QuotaSpecificRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	namespace := strings.TrimPrefix(req.URL.Path, "/v1/quota/")
+	if namespace == "" {
+		return nil, CodedError(400, "missing namespace")
+	}
+	switch req.Method {
+	case "GET":
+		return s.quotaQuery(resp, req, namespace)
+	case "DELETE":
+		return s.quotaDelete(resp, req, namespace)
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
+
+func (s *HTTPServer) quotaQuery(resp http.ResponseWriter, req *http.Request, namespace string) (interface{}, error) {
+	args := models.QuotaSpecificRequest{
+		Namespace: namespace,
+	}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+
+	var out models.SingleQuotaResponse
+	if err := s.agent.RPC("Quota.GetQuota", &args, &out); err != nil {
+		return nil, err
+	}
+
+	setMeta(resp, &out.QueryMeta)
+	if out.Usage == nil {
+		return nil, CodedError(404, "quota not found")
+	}
+	return out.Usage, nil
+}
+
+func (s *HTTPServer) quotaDelete(resp http.ResponseWriter, req *http.Request, namespace string) (interface{}, error) {
+	args := models.QuotaDeleteRequest{
+		Namespace: namespace,
+	}
+	s.parseRegion(req, &args.Region)
+
+	var out models.GenericResponse
+	if err := s.agent.RPC("Quota.Delete", &args, &out); err != nil {
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	return nil, nil
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/actiontech/dtle/api"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// JobsReconcileRequest makes the jobs of an owner, e.g. a Kubernetes
+// operator, match the desired set in the body. The owner does not track the
+// versions of the jobs: a job is matched by its name, and only registered
+// again if the hash of its spec changed since it was last applied.
+func (s *HTTPServer) JobsReconcileRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	var args api.JobReconcileRequest
+	if err := decodeBody(req, &args); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	if args.Owner == "" {
+		return nil, CodedError(400, "Owner hasn't been provided")
+	}
+	region := args.Region
+	s.parseRegion(req, &region)
+
+	listReq := models.JobListRequest{
+		Owner:        args.Owner,
+		QueryOptions: models.QueryOptions{Region: region},
+	}
+	var list models.JobListResponse
+	if err := s.agent.RPC("Job.List", &listReq, &list); err != nil {
+		return nil, err
+	}
+	owned := make(map[string]*models.JobListStub)
+	for _, stub := range list.Jobs {
+		owned[stub.Name] = stub
+	}
+
+	reply := &api.JobReconcileResponse{}
+	desired := make(map[string]bool)
+	for _, job := range args.Jobs {
+		r := &api.JobReconcileResult{}
+		if job.Name == nil {
+			r.Action, r.Error = api.JobReconcileFailed, "Job Name hasn't been provided"
+		} else if r.Name = *job.Name; desired[r.Name] {
+			r.Action, r.Error = api.JobReconcileFailed, "duplicate job name"
+		} else {
+			desired[r.Name] = true
+			if err := s.reconcileJob(&args, region, job, owned[r.Name], r); err != nil {
+				r.Action, r.Error = api.JobReconcileFailed, err.Error()
+			}
+		}
+		reply.Results = append(reply.Results, r)
+	}
+
+	if args.Prune {
+		for _, stub := range list.Jobs {
+			if desired[stub.Name] {
+				continue
+			}
+			r := &api.JobReconcileResult{
+				Name:     stub.Name,
+				ID:       stub.ID,
+				Action:   api.JobReconcilePruned,
+				SpecHash: stub.SpecHash,
+			}
+			if !args.DryRun {
+				if err := s.deregisterJob(region, stub.ID); err != nil {
+					r.Action, r.Error = api.JobReconcileFailed, err.Error()
+				}
+			}
+			reply.Results = append(reply.Results, r)
+		}
+	}
+	return reply, nil
+}
+
+// reconcileJob registers a desired job of the owner, if it is new or its
+// spec changed. existing is the job of the owner with the same name.
+func (s *HTTPServer) reconcileJob(args *api.JobReconcileRequest, region string, job *api.Job,
+	existing *models.JobListStub, r *api.JobReconcileResult) error {
+	job.Owner = &args.Owner
+	job.Region = &region
+	job.SpecHash = nil
+	hash, err := jobSpecHash(job)
+	if err != nil {
+		return err
+	}
+	r.SpecHash = hash
+
+	if existing != nil {
+		r.ID = existing.ID
+		if job.ID != nil && *job.ID != existing.ID {
+			return fmt.Errorf("job %v of the owner has ID %v, not %v", r.Name, existing.ID, *job.ID)
+		}
+		if existing.SpecHash == hash {
+			r.Action = api.JobReconcileUnchanged
+			return nil
+		}
+		if existing.Status != models.JobStatusRunning {
+			job.ID = &existing.ID
+			r.Action = api.JobReconcileUpdated
+		} else if !args.Replace {
+			r.Action = api.JobReconcileDrifted
+			r.Error = "the spec of a running job cannot be updated, set Replace to restart it"
+			return nil
+		} else if job.ID != nil {
+			return fmt.Errorf("a running job with a fixed ID cannot be replaced, remove the ID from the spec")
+		} else {
+			r.Action = api.JobReconcileReplaced
+		}
+	} else {
+		r.Action = api.JobReconcileCreated
+		if job.ID != nil {
+			if err := s.checkJobOwner(region, *job.ID, args.Owner); err != nil {
+				return err
+			}
+		}
+	}
+
+	if args.DryRun {
+		return nil
+	}
+	if r.Action == api.JobReconcileReplaced {
+		if err := s.deregisterJob(region, existing.ID); err != nil {
+			return err
+		}
+	}
+
+	trafficLimit, err := s.trafficLimit(region, job.Orders)
+	if err != nil {
+		return err
+	}
+	sJob := ApiJobToStructJob(job, trafficLimit)
+	sJob.SpecHash = hash
+	r.ID = sJob.ID
+
+	regReq := models.JobRegisterRequest{
+		Job:          sJob,
+		WriteRequest: models.WriteRequest{Region: region},
+	}
+	var out models.JobResponse
+	return s.agent.RPC("Job.Register", &regReq, &out)
+}
+
+// checkJobOwner fails if a job exists with the ID and is not of the owner,
+// not to take over a job registered otherwise.
+func (s *HTTPServer) checkJobOwner(region, jobID, owner string) error {
+	args := models.JobSpecificRequest{
+		JobID:        jobID,
+		QueryOptions: models.QueryOptions{Region: region},
+	}
+	var out models.SingleJobResponse
+	if err := s.agent.RPC("Job.GetJob", &args, &out); err != nil {
+		return err
+	}
+	if out.Job != nil && out.Job.Owner != owner {
+		return fmt.Errorf("job %v exists and is not owned by %v", jobID, owner)
+	}
+	return nil
+}
+
+func (s *HTTPServer) deregisterJob(region, jobID string) error {
+	args := models.JobDeregisterRequest{
+		JobID:        jobID,
+		WriteRequest: models.WriteRequest{Region: region},
+	}
+	var out models.JobResponse
+	return s.agent.RPC("Job.Deregister", &args, &out)
+}
+
+// jobSpecHash is the hash of a job spec as given by the owner, before the
+// defaults are set.
+func jobSpecHash(job *api.Job) (string, error) {
+	buf, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
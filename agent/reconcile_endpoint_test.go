@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/actiontech/dtle/api"
+)
+
+func TestJobSpecHash(t *testing.T) {
+	spec := `{"Name": "j1", "Owner": "op", "Tasks": [{"Type": "Src", "Config": {"Gtid": "", "ReplicateDoDb": [{"TableSchema": "db1"}]}}]}`
+	hash := func(spec string) string {
+		var job *api.Job
+		if err := json.Unmarshal([]byte(spec), &job); err != nil {
+			t.Fatal(err)
+		}
+		h, err := jobSpecHash(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	h1 := hash(spec)
+	if h2 := hash(spec); h1 != h2 {
+		t.Errorf("hash of the same spec changed: %v, %v", h1, h2)
+	}
+	// the keys of the task config are in any order
+	reordered := `{"Owner": "op", "Name": "j1", "Tasks": [{"Config": {"ReplicateDoDb": [{"TableSchema": "db1"}], "Gtid": ""}, "Type": "Src"}]}`
+	if h2 := hash(reordered); h1 != h2 {
+		t.Errorf("hash of a reordered spec changed: %v, %v", h1, h2)
+	}
+	changed := `{"Name": "j1", "Owner": "op", "Tasks": [{"Type": "Src", "Config": {"Gtid": "", "ReplicateDoDb": [{"TableSchema": "db2"}]}}]}`
+	if h2 := hash(changed); h1 == h2 {
+		t.Errorf("hash of a changed spec is the same: %v", h1)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// SLAReportsRequest returns the compliance of the jobs with an SLA over a
+// month. Query parameters: month=2006-01, the current month if not given,
+// and namespace to select the jobs of a namespace.
+func (s *HTTPServer) SLAReportsRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	args := models.SLAReportsRequest{
+		Namespace: req.URL.Query().Get("namespace"),
+	}
+	if month := req.URL.Query().Get("month"); month != "" {
+		t, err := time.Parse("2006-01", month)
+		if err != nil {
+			return nil, CodedError(400, fmt.Sprintf("invalid month %q", month))
+		}
+		args.Month = t
+	}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+
+	var out models.SLAReportsResponse
+	if err := s.agent.RPC("Job.SLAReports", &args, &out); err != nil {
+		return nil, err
+	}
+
+	setMeta(resp, &out.QueryMeta)
+	if out.Reports == nil {
+		out.Reports = make([]*models.SLAReport, 0)
+	}
+	return out.Reports, nil
+}
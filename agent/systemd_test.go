@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSdNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Unsetenv("NOTIFY_SOCKET")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("sdNotify() without systemd = %v", err)
+	}
+
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	os.Setenv("NOTIFY_SOCKET", socket)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Errorf("received %q, %v", buf[:n], err)
+	}
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	os.Setenv("WATCHDOG_USEC", "60000000")
+	if d, err := sdWatchdogInterval(); err != nil || d != time.Minute {
+		t.Errorf("sdWatchdogInterval() = %v, %v", d, err)
+	}
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if d, err := sdWatchdogInterval(); err != nil || d != 0 {
+		t.Errorf("sdWatchdogInterval() of another process = %v, %v", d, err)
+	}
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("WATCHDOG_USEC", "x")
+	if _, err := sdWatchdogInterval(); err == nil {
+		t.Errorf("sdWatchdogInterval() should fail on a bad WATCHDOG_USEC")
+	}
+}
+
+func TestSdListeners(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	if listeners, err := sdListeners(); err != nil || len(listeners) != 0 {
+		t.Errorf("sdListeners() of another process = %v, %v", listeners, err)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Errorf("LISTEN_FDS should be unset")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pidfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "run", "dtle.pid")
+	for _, data := range []string{"123\n", "45\n"} {
+		if err := writeFileAtomic(path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if bs, err := ioutil.ReadFile(path); err != nil || string(bs) != data {
+			t.Errorf("read %q, %v, want %q", bs, err, data)
+		}
+	}
+	if files, _ := ioutil.ReadDir(filepath.Dir(path)); len(files) != 1 {
+		t.Errorf("%v files left", len(files))
+	}
+}
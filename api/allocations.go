@@ -8,7 +8,9 @@ package api
 
 import (
 	"fmt"
+	"net/url"
 	"sort"
+	"strconv"
 	"time"
 )
 
@@ -73,6 +75,81 @@ func (a *Allocations) Stats(alloc *Allocation, q *QueryOptions) (*AllocStatistic
 	return &resp, err
 }
 
+// Events returns up to max changes captured after index by the watch-only
+// task of the allocation, waiting up to wait for one.
+func (a *Allocations) Events(alloc *Allocation, index uint64, max int, wait time.Duration, q *QueryOptions) (*AllocEventsResponse, error) {
+	node, _, err := a.client.Nodes().Info(alloc.NodeID, q)
+	if err != nil {
+		return nil, err
+	}
+	if node.Status == "down" {
+		return nil, NodeDownErr
+	}
+	if node.HTTPAddr == "" {
+		return nil, fmt.Errorf("http addr of the node where alloc %q is running is not advertised", alloc.ID)
+	}
+	client, err := NewClient(a.client.config.CopyConfig(node.HTTPAddr))
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{}
+	v.Set("index", strconv.FormatUint(index, 10))
+	if max > 0 {
+		v.Set("max", strconv.Itoa(max))
+	}
+	if wait > 0 {
+		v.Set("wait", wait.String())
+	}
+	var resp AllocEventsResponse
+	_, err = client.query("/v1/agent/allocation/"+alloc.ID+"/events?"+v.Encode(), &resp, nil)
+	return &resp, err
+}
+
+// Rescan makes the Src task of the allocation pick up the source tables
+// created since it started.
+func (a *Allocations) Rescan(alloc *Allocation, q *WriteOptions) (*AllocRescanResponse, error) {
+	node, _, err := a.client.Nodes().Info(alloc.NodeID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if node.Status == "down" {
+		return nil, NodeDownErr
+	}
+	if node.HTTPAddr == "" {
+		return nil, fmt.Errorf("http addr of the node where alloc %q is running is not advertised", alloc.ID)
+	}
+	client, err := NewClient(a.client.config.CopyConfig(node.HTTPAddr))
+	if err != nil {
+		return nil, err
+	}
+	var resp AllocRescanResponse
+	_, err = client.write("/v1/agent/allocation/"+alloc.ID+"/rescan", nil, &resp, q)
+	return &resp, err
+}
+
+// Health returns the health of the connections of the tasks of the
+// allocation.
+func (a *Allocations) Health(alloc *Allocation, q *QueryOptions) (*AllocHealthResponse, error) {
+	node, _, err := a.client.Nodes().Info(alloc.NodeID, q)
+	if err != nil {
+		return nil, err
+	}
+	if node.Status == "down" {
+		return nil, NodeDownErr
+	}
+	if node.HTTPAddr == "" {
+		return nil, fmt.Errorf("http addr of the node where alloc %q is running is not advertised", alloc.ID)
+	}
+	client, err := NewClient(a.client.config.CopyConfig(node.HTTPAddr))
+	if err != nil {
+		return nil, err
+	}
+	var resp AllocHealthResponse
+	_, err = client.query("/v1/agent/allocation/"+alloc.ID+"/health", &resp, nil)
+	return &resp, err
+}
+
 func (a *Allocations) GC(alloc *Allocation, q *QueryOptions) error {
 	node, _, err := a.client.Nodes().Info(alloc.NodeID, q)
 	if err != nil {
@@ -165,3 +242,56 @@ func (a AllocIndexSort) Less(i, j int) bool {
 func (a AllocIndexSort) Swap(i, j int) {
 	a[i], a[j] = a[j], a[i]
 }
+
+// AllocEventsResponse is the changes captured by a watch-only task.
+type AllocEventsResponse struct {
+	Events    []*ChangeEvent
+	LastIndex uint64
+}
+
+// AllocRescanResponse is the source tables a rescan added to the Src task
+// of an allocation, as "schema.table".
+type AllocRescanResponse struct {
+	AllocID string
+	Tables  []string
+}
+
+// ConnHealth is the health of a connection held by a task: source_binlog,
+// source_query, target or nats.
+type ConnHealth struct {
+	Name          string
+	Addr          string
+	Healthy       bool
+	Open          bool
+	LastActivity  time.Time
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// TaskHealth is the health of the connections of a task.
+type TaskHealth struct {
+	Task        string
+	Connections []*ConnHealth
+	Error       string
+}
+
+// AllocHealthResponse is the health of the tasks of an allocation.
+type AllocHealthResponse struct {
+	AllocID string
+	Healthy bool
+	Tasks   []*TaskHealth
+}
+
+// ChangeEvent is a decoded row change or DDL.
+type ChangeEvent struct {
+	Index     uint64
+	Gtid      string
+	Timestamp uint32
+	Schema    string
+	Table     string
+	DML       string
+	Query     string
+	Columns   []string
+	Before    []interface{}
+	After     []interface{}
+}
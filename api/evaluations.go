@@ -64,6 +64,7 @@ type Evaluation struct {
 	Type                 string
 	TriggeredBy          string
 	JobID                string
+	Namespace            string
 	JobModifyIndex       uint64
 	NodeID               string
 	NodeModifyIndex      uint64
@@ -74,6 +75,7 @@ type Evaluation struct {
 	PreviousEval         string
 	BlockedEval          string
 	FailedTGAllocs       map[string]*AllocationMetric
+	PlacementMetrics     map[string]*AllocationMetric
 	ClassEligibility     map[string]bool
 	EscapedComputedClass bool
 	AnnotatePlan         bool
@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/actiontech/dtle/internal"
 	"github.com/actiontech/dtle/internal/models"
@@ -42,6 +43,35 @@ func (j *Jobs) Validate(job *Job, q *WriteOptions) (*JobValidateResponse, *Write
 	return &resp, wm, err
 }
 
+// Assess reports the migration blockers of the source tables of a job,
+// without registering it. If scan is set, the biggest BLOB/TEXT/JSON values
+// are read from the tables.
+func (j *Jobs) Assess(job *Job, scan bool, q *WriteOptions) (*JobAssessResponse, *WriteMeta, error) {
+	var resp JobAssessResponse
+	req := &JobAssessRequest{Job: job}
+	if q != nil {
+		req.WriteRequest = WriteRequest{Region: q.Region}
+	}
+	endpoint := "/v1/assess/job"
+	if scan {
+		endpoint += "?scan=true"
+	}
+	wm, err := j.client.write(endpoint, req, &resp, q)
+	return &resp, wm, err
+}
+
+// Convert reports the proposed target tables of a job with a non-MySQL
+// target, without registering it.
+func (j *Jobs) Convert(job *Job, q *WriteOptions) (*JobConvertResponse, *WriteMeta, error) {
+	var resp JobConvertResponse
+	req := &JobConvertRequest{Job: job}
+	if q != nil {
+		req.WriteRequest = WriteRequest{Region: q.Region}
+	}
+	wm, err := j.client.write("/v1/convert/job", req, &resp, q)
+	return &resp, wm, err
+}
+
 // Register is used to register a new job. It returns the ID
 // of the evaluation, along with any errors encountered.
 func (j *Jobs) Register(job *Job, q *WriteOptions) (string, *WriteMeta, error) {
@@ -84,6 +114,79 @@ func (j *Jobs) List(q *QueryOptions) ([]*JobListStub, *QueryMeta, error) {
 	return resp, qm, nil
 }
 
+// OwnerList lists the jobs of an owner, with the hash of the spec last
+// applied by Reconcile.
+func (j *Jobs) OwnerList(owner string, q *QueryOptions) ([]*JobListStub, *QueryMeta, error) {
+	if q == nil {
+		q = &QueryOptions{}
+	}
+	if q.Params == nil {
+		q.Params = make(map[string]string)
+	}
+	q.Params["owner"] = owner
+	return j.List(q)
+}
+
+// Reconcile makes the jobs of an owner match the desired set: the new jobs
+// are registered, the changed ones are updated and, with Prune, the jobs of
+// the owner not in the set are deregistered. Jobs are matched by name, so
+// applying the same set again changes nothing.
+func (j *Jobs) Reconcile(req *JobReconcileRequest, q *WriteOptions) (*JobReconcileResponse, *WriteMeta, error) {
+	var resp JobReconcileResponse
+	if q != nil {
+		req.WriteRequest = WriteRequest{Region: q.Region}
+	}
+	wm, err := j.client.write("/v1/jobs/reconcile", req, &resp, q)
+	if err != nil {
+		return nil, wm, err
+	}
+	return &resp, wm, nil
+}
+
+// FilterList lists the jobs matching all the filters, e.g.
+// "meta.team==payments", "status!=dead" or "meta.env" for the jobs with an
+// env label.
+func (j *Jobs) FilterList(filters []string, q *QueryOptions) ([]*JobListStub, *QueryMeta, error) {
+	if q == nil {
+		q = &QueryOptions{}
+	}
+	q.Filters = filters
+	return j.List(q)
+}
+
+// Bulk pauses, resumes, stops or re-evaluates at once the jobs of the IDs,
+// or the jobs matching the filters if no IDs are given. See FilterList for
+// the filters.
+func (j *Jobs) Bulk(operation string, filters []string, jobIDs []string, q *WriteOptions) (*JobBulkResponse, *WriteMeta, error) {
+	var resp JobBulkResponse
+	req := &JobBulkRequest{
+		Operation: operation,
+		Filters:   filters,
+		JobIDs:    jobIDs,
+	}
+	if q != nil {
+		req.WriteRequest = WriteRequest{Region: q.Region}
+	}
+	wm, err := j.client.write("/v1/jobs/bulk", req, &resp, q)
+	if err != nil {
+		return nil, wm, err
+	}
+	return &resp, wm, nil
+}
+
+// Clone creates a job from the job jobID, with the changes of req.
+func (j *Jobs) Clone(jobID string, req *JobCloneRequest, q *WriteOptions) (*JobCloneResponse, *WriteMeta, error) {
+	var resp JobCloneResponse
+	if q != nil {
+		req.WriteRequest = WriteRequest{Region: q.Region}
+	}
+	wm, err := j.client.write("/v1/job/"+jobID+"/clone", req, &resp, q)
+	if err != nil {
+		return nil, wm, err
+	}
+	return &resp, wm, nil
+}
+
 // PrefixList is used to list all existing jobs that match the prefix.
 func (j *Jobs) PrefixList(prefix string) ([]*JobListStub, *QueryMeta, error) {
 	return j.List(&QueryOptions{Prefix: prefix})
@@ -132,6 +235,146 @@ func (j *Jobs) Evaluations(jobID string, q *QueryOptions) ([]*Evaluation, *Query
 	return resp, qm, nil
 }
 
+// Stats returns the samples of the lag and the throughput of a job over the
+// last period, an hour if it is 0.
+func (j *Jobs) Stats(jobID string, period time.Duration, q *QueryOptions) ([]*JobStatsSample, *QueryMeta, error) {
+	var resp []*JobStatsSample
+	u, err := url.Parse("/v1/job/" + jobID + "/stats")
+	if err != nil {
+		return nil, nil, err
+	}
+	if period > 0 {
+		v := u.Query()
+		v.Add("period", period.String())
+		u.RawQuery = v.Encode()
+	}
+
+	qm, err := j.client.query(u.String(), &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, qm, nil
+}
+
+// SLA returns the compliance of a job to its SLA, by day and by month.
+func (j *Jobs) SLA(jobID string, q *QueryOptions) (*SLAReport, *QueryMeta, error) {
+	var resp SLAReport
+	qm, err := j.client.query("/v1/job/"+jobID+"/sla", &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, qm, nil
+}
+
+// SLAReports returns the compliance of the jobs with an SLA over the month of
+// month, the current one if it is zero. namespace selects the jobs of a
+// namespace if not empty.
+func (j *Jobs) SLAReports(month time.Time, namespace string, q *QueryOptions) ([]*SLAReport, *QueryMeta, error) {
+	var resp []*SLAReport
+	u, err := url.Parse("/v1/sla")
+	if err != nil {
+		return nil, nil, err
+	}
+	v := u.Query()
+	if !month.IsZero() {
+		v.Add("month", month.Format("2006-01"))
+	}
+	if namespace != "" {
+		v.Add("namespace", namespace)
+	}
+	u.RawQuery = v.Encode()
+
+	qm, err := j.client.query(u.String(), &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, qm, nil
+}
+
+// Verify compares row counts of the source and target tables of a job.
+// If maxPk is set, MAX() of the primary key is compared as well, and so is
+// SUM() of sumColumn if it is not empty.
+func (j *Jobs) Verify(jobID string, maxPk bool, sumColumn string, q *QueryOptions) (*JobVerifyResponse, *QueryMeta, error) {
+	var resp JobVerifyResponse
+	u, err := url.Parse("/v1/job/" + jobID + "/verify")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v := u.Query()
+	v.Add("maxpk", strconv.FormatBool(maxPk))
+	if sumColumn != "" {
+		v.Add("sum", sumColumn)
+	}
+	u.RawQuery = v.Encode()
+
+	qm, err := j.client.query(u.String(), &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, qm, nil
+}
+
+// Conflicts lists the latest conflicts recorded on the target of a job.
+func (j *Jobs) Conflicts(jobID string, limit int, q *QueryOptions) (*JobConflictsResponse, *QueryMeta, error) {
+	var resp JobConflictsResponse
+	u, err := url.Parse("/v1/job/" + jobID + "/conflicts")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if limit > 0 {
+		v := u.Query()
+		v.Add("limit", strconv.Itoa(limit))
+		u.RawQuery = v.Encode()
+	}
+
+	qm, err := j.client.query(u.String(), &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, qm, nil
+}
+
+// Checksum reports the tables compared by the last Checksum step of a job
+// which completed.
+func (j *Jobs) Checksum(jobID string, q *QueryOptions) (*JobChecksumResponse, *QueryMeta, error) {
+	var resp JobChecksumResponse
+	qm, err := j.client.query("/v1/job/"+jobID+"/checksum", &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, qm, nil
+}
+
+// DDLHistory lists the latest DDLs executed on the target of a job, of the
+// table schema.table if given. An empty table is the whole schema.
+func (j *Jobs) DDLHistory(jobID, schema, table string, limit int, q *QueryOptions) (*JobDDLHistoryResponse, *QueryMeta, error) {
+	var resp JobDDLHistoryResponse
+	u, err := url.Parse("/v1/job/" + jobID + "/ddl-history")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v := u.Query()
+	if schema != "" {
+		v.Add("schema", schema)
+	}
+	if table != "" {
+		v.Add("table", table)
+	}
+	if limit > 0 {
+		v.Add("limit", strconv.Itoa(limit))
+	}
+	u.RawQuery = v.Encode()
+
+	qm, err := j.client.query(u.String(), &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, qm, nil
+}
+
 // Deregister is used to remove an existing job.
 func (j *Jobs) Deregister(jobID string, q *WriteOptions) (string, *WriteMeta, error) {
 	var resp deregisterJobResponse
@@ -152,6 +395,71 @@ func (j *Jobs) ForceEvaluate(jobID string, q *WriteOptions) (string, *WriteMeta,
 	return resp.EvalID, wm, nil
 }
 
+// Rescan makes the running Src tasks of the job pick up the source tables
+// created since they started, without restarting them.
+func (j *Jobs) Rescan(jobID string, q *WriteOptions) ([]*AllocRescanResponse, *WriteMeta, error) {
+	var resp []*AllocRescanResponse
+	wm, err := j.client.write("/v1/job/"+jobID+"/rescan", nil, &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, wm, nil
+}
+
+// Tune sets the tunables of the running tasks of the job, by task type, which
+// the tasks apply without restarting.
+func (j *Jobs) Tune(jobID string, tunables map[string]map[string]interface{}, q *WriteOptions) (*WriteMeta, error) {
+	return j.client.write("/v1/job/"+jobID+"/tunables", tunables, nil, q)
+}
+
+// Checkpoint returns where the tasks of the job resume.
+func (j *Jobs) Checkpoint(jobID string, q *QueryOptions) (*JobCheckpointResponse, *QueryMeta, error) {
+	var resp JobCheckpointResponse
+	qm, err := j.client.query("/v1/job/"+jobID+"/checkpoint", &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, qm, nil
+}
+
+// SetCheckpoint sets where the tasks of the paused job resume: the GTID set
+// executed, or the progress of the interrupted full copy.
+func (j *Jobs) SetCheckpoint(jobID string, req *JobSetCheckpointRequest, q *WriteOptions) (*WriteMeta, error) {
+	return j.client.write("/v1/job/"+jobID+"/checkpoint", req, nil, q)
+}
+
+// SkipTx arms the running job to skip its next transaction failing on the
+// target, which is recorded on the target with what it changed.
+func (j *Jobs) SkipTx(jobID string, req *JobSkipTxRequest, q *WriteOptions) (*JobSkipTxResponse, *WriteMeta, error) {
+	var resp JobSkipTxResponse
+	wm, err := j.client.write("/v1/job/"+jobID+"/skip-tx", req, &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, wm, nil
+}
+
+// SkippedTxs lists the latest transactions skipped on the target of a job.
+func (j *Jobs) SkippedTxs(jobID string, limit int, q *QueryOptions) (*JobSkippedTxsResponse, *QueryMeta, error) {
+	var resp JobSkippedTxsResponse
+	u, err := url.Parse("/v1/job/" + jobID + "/skip-tx")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if limit > 0 {
+		v := u.Query()
+		v.Add("limit", strconv.Itoa(limit))
+		u.RawQuery = v.Encode()
+	}
+
+	qm, err := j.client.query(u.String(), &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, qm, nil
+}
+
 func (j *Jobs) Plan(job *Job, diff bool, q *WriteOptions) (*JobPlanResponse, *WriteMeta, error) {
 	if job == nil {
 		return nil, nil, fmt.Errorf("must pass non-nil job")
@@ -181,20 +489,31 @@ func (j *Jobs) Summary(jobID string, q *QueryOptions) (*Job, *QueryMeta, error)
 
 // Job is used to serialize a job.
 type Job struct {
-	Region            *string
-	ID                *string
-	Orders            []string
-	Name              *string
-	Failover          bool
-	Type              *string
-	Datacenters       []string
-	Tasks             []*Task
-	Status            *string
-	StatusDescription *string
-	EnforceIndex      bool
-	CreateIndex       *uint64
-	ModifyIndex       *uint64
-	JobModifyIndex    *uint64
+	Region             *string
+	ID                 *string
+	Orders             []string
+	Name               *string
+	Namespace          *string
+	Owner              *string
+	SpecHash           *string
+	Meta               map[string]string
+	Failover           bool
+	Type               *string
+	Datacenters        []string
+	SchedulerAlgorithm string
+	EncryptTransit     bool
+	SLA                *SLASpec
+	Tasks              []*Task
+	Groups             []string
+	GroupStates        []*TaskGroupState
+	Status             *string
+	StatusDescription  *string
+	Failure            *FailureAnalysis
+	EnforceIndex       bool
+	WarmRestart        bool
+	CreateIndex        *uint64
+	ModifyIndex        *uint64
+	JobModifyIndex     *uint64
 }
 
 func (j *Job) Canonicalize() {
@@ -204,6 +523,12 @@ func (j *Job) Canonicalize() {
 	if j.Name == nil {
 		j.Name = internal.StringToPtr(*j.ID)
 	}
+	if j.Namespace == nil {
+		j.Namespace = internal.StringToPtr(models.DefaultNamespace)
+	}
+	if j.Owner == nil {
+		j.Owner = internal.StringToPtr("")
+	}
 	if j.Region == nil {
 		j.Region = internal.StringToPtr("global")
 	}
@@ -230,11 +555,35 @@ func (j *Job) Canonicalize() {
 	}
 }
 
+// TaskGroupState is the status of a task group of a job: pending, running
+// or complete.
+type TaskGroupState struct {
+	Name        string
+	Status      string
+	ModifyIndex uint64
+}
+
+// FailureAnalysis is the class of the last error of an allocation of a job
+// failing repeatedly, with a hint to fix it.
+type FailureAnalysis struct {
+	Class    string
+	Hint     string
+	Error    string
+	AllocID  string
+	Task     string
+	Failures int
+	Time     time.Time
+}
+
 // JobListStub is used to return a subset of information about
 // jobs during list operations.
 type JobListStub struct {
 	ID                string
 	Name              string
+	Namespace         string
+	Owner             string
+	SpecHash          string
+	Meta              map[string]string
 	Type              string
 	Status            string
 	StatusDescription string
@@ -282,6 +631,158 @@ type JobValidateRequest struct {
 	WriteRequest
 }
 
+// JobAssessRequest is used to assess a job
+type JobAssessRequest struct {
+	Job *Job
+	WriteRequest
+}
+
+// JobAssessResponse is the report of an assessment of the source of a job
+type JobAssessResponse struct {
+	JobID    string
+	Blockers int
+	Warnings int
+	Tables   []*TableAssessment
+}
+
+type TableAssessment struct {
+	TableSchema string
+	TableName   string
+	Issues      []*AssessIssue
+	Error       string
+}
+
+type AssessIssue struct {
+	// "blocker" or "warning"
+	Severity string
+	Check    string
+	Column   string
+	Message  string
+}
+
+// The operations of a bulk request
+const (
+	JobBulkPause    = "pause"
+	JobBulkResume   = "resume"
+	JobBulkStop     = "stop"
+	JobBulkEvaluate = "evaluate"
+)
+
+// JobBulkRequest selects jobs by IDs or filters for a bulk operation
+type JobBulkRequest struct {
+	Operation string
+	Filters   []string
+	JobIDs    []string
+	WriteRequest
+}
+
+// JobBulkResponse has the result of each selected job
+type JobBulkResponse struct {
+	Results []*JobBulkResult
+}
+
+type JobBulkResult struct {
+	JobID   string
+	Name    string
+	EvalID  string
+	Skipped bool
+	Error   string
+}
+
+// JobCloneRequest has the changes of a job cloned from an existing one. The
+// rest of the config of the existing job is kept.
+type JobCloneRequest struct {
+	// ID of the new job, generated if empty. Name defaults to the ID.
+	ID   string
+	Name string
+	// Config is merged into the config of the tasks, by task type, e.g.
+	// {"Dest": {"ConnectionConfig": {"Host": "10.0.0.2"}}}. An object is
+	// merged key by key, any other value replaces the one of the job.
+	Config map[string]map[string]interface{}
+	// SkipFullCopy starts the new job at the GTID set executed on the source
+	// when cloned, without copying the existing rows.
+	SkipFullCopy bool
+	WriteRequest
+}
+
+type JobCloneResponse struct {
+	ID   string
+	Name string
+	// Gtid is where the new job starts, with SkipFullCopy
+	Gtid   string
+	EvalID string
+}
+
+// The actions of a job in the reconciliation
+const (
+	JobReconcileCreated   = "created"
+	JobReconcileUpdated   = "updated"
+	JobReconcileReplaced  = "replaced"
+	JobReconcileUnchanged = "unchanged"
+	JobReconcileDrifted   = "drifted"
+	JobReconcilePruned    = "pruned"
+	JobReconcileFailed    = "failed"
+)
+
+// JobReconcileRequest is the desired set of jobs of an owner
+type JobReconcileRequest struct {
+	Owner string
+	Jobs  []*Job
+
+	// Prune deregisters the jobs of the owner which are not in Jobs.
+	Prune bool
+
+	// Replace deregisters a running job whose spec changed, and registers
+	// the new spec under a new ID. Without it the job is reported as drifted,
+	// since the spec of a running job cannot be updated in place.
+	Replace bool
+
+	// DryRun only reports the actions.
+	DryRun bool
+	WriteRequest
+}
+
+// JobReconcileResponse has the action taken on each job
+type JobReconcileResponse struct {
+	Results []*JobReconcileResult
+}
+
+type JobReconcileResult struct {
+	Name     string
+	ID       string
+	Action   string
+	SpecHash string
+	Error    string
+}
+
+// JobConvertRequest is used to get the schema conversion report of a job
+type JobConvertRequest struct {
+	Job *Job
+	WriteRequest
+}
+
+// JobConvertResponse has the proposed DDL of the target tables
+type JobConvertResponse struct {
+	JobID  string
+	Target string
+	Tables []*TableConversion
+}
+
+type TableConversion struct {
+	TableSchema string
+	TableName   string
+	Columns     []*ColumnConversion
+	Statement   string
+	Error       string
+}
+
+type ColumnConversion struct {
+	Name       string
+	SourceType string
+	TargetType string
+	Note       string
+}
+
 // JobValidateResponse is the response from validate request
 type JobValidateResponse struct {
 	// DriverConfigValidated indicates whether the agent validated the driver
@@ -295,6 +796,202 @@ type JobValidateResponse struct {
 	Error string
 }
 
+// JobVerifyResponse is the result of a quick verification of a job
+type JobVerifyResponse struct {
+	JobID  string
+	Match  bool
+	Tables []*TableVerifyResult
+}
+
+type TableVerifyResult struct {
+	TableSchema string
+	TableName   string
+	SourceRows  int64
+	TargetRows  int64
+	PkColumn    string
+	SourceMaxPk string
+	TargetMaxPk string
+	SumColumn   string
+	SourceSum   string
+	TargetSum   string
+	Match       bool
+	Error       string
+}
+
+// JobChecksumResponse is the report of the last Checksum step of a job
+type JobChecksumResponse struct {
+	JobID      string
+	AllocID    string
+	Time       time.Time
+	Match      bool
+	DiffTables int
+	Tables     []*TableChecksum
+}
+
+type TableChecksum struct {
+	TableSchema string
+	TableName   string
+	ChunkKey    []string
+	Chunks      int
+	DiffChunks  int
+	SourceRows  int64
+	TargetRows  int64
+	Match       bool
+	Error       string
+}
+
+// JobStatsSample is the lag and the throughput of a job over a minute
+type JobStatsSample struct {
+	Time           time.Time
+	LagSeconds     int64
+	TxPerSecond    float64
+	RowsPerSecond  float64
+	BytesPerSecond float64
+}
+
+// SLASpec is the service level of a job: the time over MaxLagSeconds, or
+// without samples, is out of the SLA, and may be MaxDowntimeSeconds a month.
+type SLASpec struct {
+	MaxLagSeconds      int64
+	MaxDowntimeSeconds int64
+}
+
+// SLAReport is the compliance of a job to its SLA
+type SLAReport struct {
+	JobID     string
+	Name      string
+	Namespace string
+	SLA       *SLASpec
+	Days      []*SLAWindow
+	Months    []*SLAWindow
+	Breaches  []*SLABreach
+	DownSince *time.Time
+}
+
+// SLAWindow is the compliance of a job over a day or a month. Met is only
+// set for the months.
+type SLAWindow struct {
+	Start            time.Time
+	MeasuredSeconds  int64
+	DownSeconds      int64
+	LagBreachSeconds int64
+	MaxLagSeconds    int64
+	Breaches         int
+	OutSeconds       int64
+	Compliance       float64
+	Met              bool
+}
+
+// SLABreach is a job going over its lag, or its downtime of the month
+type SLABreach struct {
+	JobID   string
+	Kind    string
+	Time    time.Time
+	Seconds int64
+}
+
+// JobConflictsResponse lists conflicts between the sources of a N->1 topology
+type JobConflictsResponse struct {
+	JobID     string
+	Conflicts []*ConflictRecord
+}
+
+type ConflictRecord struct {
+	ID          int64
+	Gtid        string
+	TableSchema string
+	TableName   string
+	PkValue     string
+	DML         string
+	Policy      string
+	Resolution  string
+	Incoming    string
+	Existing    string
+	CreatedAt   string
+}
+
+// JobCheckpointResponse is where the tasks of a job resume
+type JobCheckpointResponse struct {
+	JobID        string
+	Status       string
+	Gtid         string
+	CopyProgress *CopyProgress
+}
+
+type JobSetCheckpointRequest struct {
+	Gtid         string
+	CopyProgress *CopyProgress
+}
+
+type CopyProgress struct {
+	Gtid    string
+	LogFile string
+	LogPos  int64
+	Tables  map[string]*ChunkWatermark
+}
+
+type ChunkWatermark struct {
+	UniqueKey   string
+	Iteration   int64
+	LastMaxVals []string
+	Rows        int64
+	Done        bool
+}
+
+// JobSkipTxRequest arms a skip of the next failing transaction, of Gtid only
+// if set
+type JobSkipTxRequest struct {
+	Gtid   string
+	Reason string
+}
+
+type JobSkipTxResponse struct {
+	SkipID string
+}
+
+// JobSkippedTxsResponse lists the transactions skipped on the target of a job
+type JobSkippedTxsResponse struct {
+	JobID   string
+	Skipped []*SkippedTxRecord
+}
+
+type SkippedTxRecord struct {
+	ID         int64
+	SkipID     string
+	Gtid       string
+	LogFile    string
+	LogPos     int64
+	EventTime  string
+	Tables     []string
+	Rows       int64
+	Statements int64
+	Error      string
+	Events     string
+	Reason     string
+	SkippedAt  string
+}
+
+// JobDDLHistoryResponse lists the DDLs executed on the target of a job
+type JobDDLHistoryResponse struct {
+	JobID string
+	DDLs  []*DDLRecord
+}
+
+type DDLRecord struct {
+	ID            int64
+	Gtid          string
+	LogFile       string
+	LogPos        int64
+	EventTime     string
+	CurrentSchema string
+	TableSchema   string
+	TableName     string
+	Query         string
+	DurationMs    int64
+	IgnoredError  string
+	ExecutedAt    string
+}
+
 // JobUpdateRequest is used to update a job
 type JobRegisterRequest struct {
 	Job *Job
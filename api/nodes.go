@@ -77,10 +77,20 @@ type Node struct {
 	Status            string
 	StatusDescription string
 	StatusUpdatedAt   int64
+	Utilization       *NodeUtilization
 	CreateIndex       uint64
 	ModifyIndex       uint64
 }
 
+// NodeUtilization is the load of a node last reported by its heartbeats.
+type NodeUtilization struct {
+	CPUPercent         float64
+	MemoryPercent      float64
+	DiskPercent        float64
+	NetworkBytesPerSec float64
+	CollectedAt        int64
+}
+
 // NodeListStub is a subset of information returned during
 // node list operations.
 type NodeListStub struct {
@@ -6,6 +6,11 @@
 
 package api
 
+import (
+	"io"
+	"time"
+)
+
 // Operator can be used to perform low-level operator tasks for Nomad.
 type Operator struct {
 	c *Client
@@ -111,3 +116,146 @@ func (op *Operator) RaftRemovePeerByID(id string, q *WriteOptions) error {
 	resp.Body.Close()
 	return nil
 }
+
+// StateImportResponse tells the number of objects imported by StateImport.
+type StateImportResponse struct {
+	Nodes  int
+	Jobs   int
+	Orders int
+	Evals  int
+	Allocs int
+	Quotas int
+}
+
+// StateExport returns the jobs, orders, evaluations, allocations, nodes and
+// quotas of the cluster as JSON, for StateImport into a cluster of another
+// version. The caller closes the reader.
+func (op *Operator) StateExport(q *QueryOptions) (io.ReadCloser, error) {
+	r, err := op.c.newRequest("GET", "/v1/operator/state")
+	if err != nil {
+		return nil, err
+	}
+	r.setQueryOptions(q)
+	r.params.Set("pretty", "")
+	_, resp, err := requireOK(op.c.doRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// StateImport loads the JSON returned by StateExport. Unless forced, it is
+// refused if the cluster has jobs.
+func (op *Operator) StateImport(state io.Reader, force bool, q *WriteOptions) (*StateImportResponse, error) {
+	r, err := op.c.newRequest("PUT", "/v1/operator/state")
+	if err != nil {
+		return nil, err
+	}
+	r.setWriteOptions(q)
+	if force {
+		r.params.Set("force", "true")
+	}
+	r.body = state
+
+	_, resp, err := requireOK(op.c.doRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out StateImportResponse
+	if err := decodeBody(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RaftStoreStats are the size of the raft store of a manager and of its
+// free pages.
+type RaftStoreStats struct {
+	SizeBytes     int64
+	FreePages     int
+	PendingPages  int
+	FreeBytes     int
+	FreelistBytes int
+}
+
+// RaftCompactResponse is the raft store of a manager before and after its
+// compaction.
+type RaftCompactResponse struct {
+	Before   *RaftStoreStats
+	After    *RaftStoreStats
+	Duration time.Duration
+}
+
+// RaftCompact compacts the raft store of the manager the client talks to.
+// The raft writes of the manager wait for it.
+func (op *Operator) RaftCompact(q *WriteOptions) (*RaftCompactResponse, error) {
+	r, err := op.c.newRequest("PUT", "/v1/operator/raft/compact")
+	if err != nil {
+		return nil, err
+	}
+	r.setWriteOptions(q)
+
+	_, resp, err := requireOK(op.c.doRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out RaftCompactResponse
+	if err := decodeBody(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+const (
+	PlanRejectNodeMissing   = "node-missing"
+	PlanRejectNodeNotReady  = "node-not-ready"
+	PlanRejectAllocConflict = "alloc-conflict"
+)
+
+// PlanRejection is a node of a plan which was not committed.
+type PlanRejection struct {
+	Time   time.Time
+	EvalID string
+	JobID  string
+	NodeID string
+	Reason string
+	Detail string
+}
+
+// PlanEvalStats are the rejections of the plans of an evaluation.
+type PlanEvalStats struct {
+	EvalID       string
+	JobID        string
+	PartialPlans uint64
+	LastReason   string
+	LastDetail   string
+	LastTime     time.Time
+}
+
+// PlanStats are the outcomes of the plans applied by the leader since it
+// was elected. Rejections and Evals are the most recent first.
+type PlanStats struct {
+	Submitted     uint64
+	Applied       uint64
+	Partial       uint64
+	NoOp          uint64
+	Failed        uint64
+	RejectedNodes map[string]uint64
+	Rejections    []*PlanRejection
+	Evals         []*PlanEvalStats
+}
+
+// PlanStats returns the outcome of the plans applied by the leader, and why
+// the nodes of partially committed plans were rejected.
+func (op *Operator) PlanStats(q *QueryOptions) (*PlanStats, *QueryMeta, error) {
+	var resp PlanStats
+	qm, err := op.c.query("/v1/operator/plans", &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, qm, nil
+}
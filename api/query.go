@@ -32,6 +32,15 @@ type QueryOptions struct {
 	// a read. This allows for lower latency and higher throughput
 	AllowStale bool
 
+	// MaxStale bounds the staleness of an AllowStale read: a server which
+	// has not heard from the leader for longer forwards it to the leader.
+	MaxStale time.Duration
+
+	// RequireConsistent forces the read through the leader, which verifies
+	// it still is the leader, so the read sees all the committed writes.
+	// It cannot be used with AllowStale.
+	RequireConsistent bool
+
 	// WaitIndex is used to enable a blocking query. Waits
 	// until the timeout or the next index is reached
 	WaitIndex uint64
@@ -49,6 +58,9 @@ type QueryOptions struct {
 
 	// Set HTTP parameters on the query.
 	Params map[string]string
+
+	// Filters of the listed resources, e.g. "meta.team==payments"
+	Filters []string
 }
 
 // WriteOptions are used to parameterize a write
@@ -208,7 +220,14 @@ func (r *request) setQueryOptions(q *QueryOptions) {
 		r.params.Set("region", q.Region)
 	}
 	if q.AllowStale {
-		r.params.Set("stale", "")
+		if q.MaxStale != 0 {
+			r.params.Set("stale", durToMsec(q.MaxStale))
+		} else {
+			r.params.Set("stale", "")
+		}
+	}
+	if q.RequireConsistent {
+		r.params.Set("consistent", "")
 	}
 	if q.WaitIndex != 0 {
 		r.params.Set("index", strconv.FormatUint(q.WaitIndex, 10))
@@ -225,6 +244,9 @@ func (r *request) setQueryOptions(q *QueryOptions) {
 	for k, v := range q.Params {
 		r.params.Set(k, v)
 	}
+	for _, f := range q.Filters {
+		r.params.Add("filter", f)
+	}
 }
 
 // durToMsec converts a duration to a millisecond specified string
@@ -518,6 +540,23 @@ func encodeBody(obj interface{}) (io.Reader, error) {
 	return buf, nil
 }
 
+// ResponseError is the error of a request the API did not answer with a 200
+type ResponseError struct {
+	// Code is the HTTP status code of the response
+	Code    int
+	Message string
+	// Retryable tells if the same request may succeed later, e.g. once a
+	// leader is elected
+	Retryable bool
+	// Index is the index of the state the request was served from, or 0
+	Index     uint64
+	RequestID string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("Unexpected response code: %d (%s)", e.Code, e.Message)
+}
+
 // requireOK is used to wrap doRequest and check for a 200
 func requireOK(d time.Duration, resp *http.Response, e error) (time.Duration, *http.Response, error) {
 	if e != nil {
@@ -530,7 +569,24 @@ func requireOK(d time.Duration, resp *http.Response, e error) (time.Duration, *h
 		var buf bytes.Buffer
 		io.Copy(&buf, resp.Body)
 		resp.Body.Close()
-		return d, nil, fmt.Errorf("Unexpected response code: %d (%s)", resp.StatusCode, buf.Bytes())
+		return d, nil, parseResponseError(resp, buf.Bytes())
 	}
 	return d, resp, nil
 }
+
+// parseResponseError returns the error of a response which is not a 200. The
+// servers which do not send the error as JSON give its message as the body.
+func parseResponseError(resp *http.Response, body []byte) *ResponseError {
+	e := &ResponseError{}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") &&
+		json.Unmarshal(body, e) == nil && e.Code != 0 {
+		return e
+	}
+	e = &ResponseError{
+		Code:      resp.StatusCode,
+		Message:   string(body),
+		RequestID: resp.Header.Get("X-Request-Id"),
+	}
+	e.Retryable = e.Code == http.StatusServiceUnavailable || e.Code == http.StatusTooManyRequests
+	return e
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package api
+
+import (
+	"sort"
+)
+
+// Quotas is used to query the quota endpoints.
+type Quotas struct {
+	client *Client
+}
+
+// Quotas returns a new handle on the quotas.
+func (c *Client) Quotas() *Quotas {
+	return &Quotas{client: c}
+}
+
+// List is used to list the quotas and their usage.
+func (q *Quotas) List(opts *QueryOptions) ([]*QuotaUsage, *QueryMeta, error) {
+	var resp []*QuotaUsage
+	qm, err := q.client.query("/v1/quotas", &resp, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Sort(QuotaNamespaceSort(resp))
+	return resp, qm, nil
+}
+
+// Info is used to query the quota of a namespace and its usage.
+func (q *Quotas) Info(namespace string, opts *QueryOptions) (*QuotaUsage, *QueryMeta, error) {
+	var resp QuotaUsage
+	qm, err := q.client.query("/v1/quota/"+namespace, &resp, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resp, qm, nil
+}
+
+// Upsert is used to create or update the quota of a namespace.
+func (q *Quotas) Upsert(quota *QuotaSpec, opts *WriteOptions) (*WriteMeta, error) {
+	return q.client.write("/v1/quotas", quota, nil, opts)
+}
+
+// Delete is used to delete the quota of a namespace.
+func (q *Quotas) Delete(namespace string, opts *WriteOptions) (*WriteMeta, error) {
+	return q.client.delete("/v1/quota/"+namespace, nil, opts)
+}
+
+// ThrottleWindow limits the copy to RowsPerSecond in a time window, or
+// pauses it if RowsPerSecond is 0. Days are e.g. "Mon-Fri" or "Sat", all the
+// days if empty. Start and End are "HH:MM" times in Timezone.
+type ThrottleWindow struct {
+	Days          []string
+	Start         string
+	End           string
+	Timezone      string
+	RowsPerSecond int64
+}
+
+// QuotaSpec limits the jobs of a namespace. A zero limit is no limit.
+type QuotaSpec struct {
+	Namespace        string
+	Description      string
+	MaxJobs          int
+	MaxFullCopies    int
+	MaxRowsPerSecond int64
+	ThrottleWindows  []*ThrottleWindow
+	CreateIndex      uint64
+	ModifyIndex      uint64
+}
+
+// QuotaUsage is the usage of a namespace against its quota.
+type QuotaUsage struct {
+	Quota         *QuotaSpec
+	Jobs          int
+	FullCopies    int
+	RowsPerSecond int64
+}
+
+// QuotaNamespaceSort is used to sort quotas by their namespace.
+type QuotaNamespaceSort []*QuotaUsage
+
+func (q QuotaNamespaceSort) Len() int {
+	return len(q)
+}
+
+func (q QuotaNamespaceSort) Less(a, b int) bool {
+	return q[a].Quota.Namespace < q[b].Quota.Namespace
+}
+
+func (q QuotaNamespaceSort) Swap(a, b int) {
+	q[a], q[b] = q[b], q[a]
+}
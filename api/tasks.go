@@ -19,6 +19,13 @@ type Task struct {
 	Config   map[string]interface{}
 	Leader   bool
 	Status   string
+
+	// DiskQuotaMB limits the size of the directory of the allocation on
+	// the agent. 0 is the quota of the agent.
+	DiskQuotaMB int
+
+	// Group is the task group of the task, in the Groups of the job
+	Group string
 }
 
 // Configure is used to configure a single k/v pair on
@@ -58,6 +65,8 @@ const (
 	TaskSignaling        = "Signaling"
 	TaskRestartSignal    = "Restart Signaled"
 	TaskLeaderDead       = "Leader Task Dead"
+	TaskDiskExceeded     = "Disk Quota Exceeded"
+	TaskStepCompleted    = "Step Completed"
 )
 
 type TableStats struct {
@@ -82,9 +91,20 @@ type Stats struct {
 	ThroughputStat *ThroughputStat
 }
 
+type TrafficStat struct {
+	ExtractedBytes    int64
+	WireBytes         int64
+	AppliedBytes      int64
+	Codec             string
+	UncompressedBytes int64
+	CompressedBytes   int64
+	CodecNanos        int64
+}
+
 type TaskStatistics struct {
-	Stats     *Stats
-	Timestamp int64
+	Stats       *Stats
+	TrafficStat TrafficStat
+	Timestamp   int64
 }
 
 type AllocStatistics struct {
@@ -115,4 +135,5 @@ type TaskEvent struct {
 	FailedSibling    string
 	TaskSignalReason string
 	TaskSignal       string
+	Checksums        []*TableChecksum
 }
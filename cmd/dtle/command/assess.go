@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+type AssessCommand struct {
+	Meta
+	JobGetter
+}
+
+func (c *AssessCommand) Help() string {
+	helpText := `
+Usage: dtle job-assess [options] <path>
+
+  Assess the source of the job specified at <path> before running it.
+  The tables selected by the job are checked for what stops or breaks a
+  migration: no primary key, unsupported types, BLOB values over
+  max_payload, foreign keys and charsets. No data is moved.
+
+  If the supplied path is "-", the jobfile is read from stdin.
+
+  Exit code 0 is returned if there are no blockers, 2 if there are
+  blockers, and 1 on other errors.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Assess Options:
+
+  -scan
+    Read the biggest BLOB/TEXT/JSON values of the tables, instead of judging
+    from the column types. This scans the tables.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *AssessCommand) Synopsis() string {
+	return "Report the migration blockers of a job before running it"
+}
+
+func (c *AssessCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-scan": complete.PredictNothing,
+		})
+}
+
+func (c *AssessCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *AssessCommand) Run(args []string) int {
+	var scan bool
+
+	flags := c.Meta.FlagSet("job-assess", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.BoolVar(&scan, "scan", false, "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	job, err := c.JobGetter.ApiJob(args[0])
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error getting job struct: %s", err))
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+	if r := job.Region; r != nil {
+		client.SetRegion(*r)
+	}
+
+	resp, _, err := client.Jobs().Assess(job, scan, nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error assessing job: %s", err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(resp); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		if resp.Blockers > 0 {
+			return 2
+		}
+		return 0
+	}
+
+	out := []string{"Table|Severity|Check|Column|Message"}
+	for _, tb := range resp.Tables {
+		name := fmt.Sprintf("%s.%s", tb.TableSchema, tb.TableName)
+		if tb.Error != "" {
+			out = append(out, fmt.Sprintf("%s|error|||%s", name, tb.Error))
+		}
+		for _, issue := range tb.Issues {
+			out = append(out, fmt.Sprintf("%s|%s|%s|%s|%s", name, issue.Severity, issue.Check, issue.Column, issue.Message))
+		}
+	}
+	c.Ui.Output(fmt.Sprintf("%d tables, %d blockers, %d warnings", len(resp.Tables), resp.Blockers, resp.Warnings))
+	if len(out) > 1 {
+		c.Ui.Output("")
+		c.Ui.Output(formatList(out))
+	}
+
+	if resp.Blockers > 0 {
+		return 2
+	}
+	return 0
+}
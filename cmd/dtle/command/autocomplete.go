@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/api"
+)
+
+// AutocompleteFlags returns the completion of the flags set by FlagSet.
+func (m *Meta) AutocompleteFlags(fs FlagSetFlags) complete.Flags {
+	flags := complete.Flags{
+		"-json": complete.PredictNothing,
+		"-t":    complete.PredictAnything,
+	}
+	if fs&FlagSetClient != 0 {
+		flags["-address"] = complete.PredictAnything
+		flags["-region"] = complete.PredictAnything
+		flags["-no-color"] = complete.PredictNothing
+	}
+	return flags
+}
+
+// mergeAutocompleteFlags merges the completions of the flags of a command
+// with the common ones.
+func mergeAutocompleteFlags(flags ...complete.Flags) complete.Flags {
+	merged := make(complete.Flags)
+	for _, f := range flags {
+		for k, v := range f {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// The predictors below complete the IDs by querying the API at the address
+// in UDUP_ADDR, as the flags of the command are not parsed when completing.
+// An error completes nothing.
+
+// predictJobs completes the IDs of the jobs.
+func (m *Meta) predictJobs() complete.Predictor {
+	return complete.PredictFunc(func(a complete.Args) []string {
+		client, err := m.Client()
+		if err != nil {
+			return nil
+		}
+		jobs, _, err := client.Jobs().PrefixList(a.Last)
+		if err != nil {
+			return nil
+		}
+		ids := make([]string, len(jobs))
+		for i, j := range jobs {
+			ids[i] = j.ID
+		}
+		return ids
+	})
+}
+
+// predictNodes completes the IDs of the nodes.
+func (m *Meta) predictNodes() complete.Predictor {
+	return complete.PredictFunc(func(a complete.Args) []string {
+		client, err := m.Client()
+		if err != nil {
+			return nil
+		}
+		nodes, _, err := client.Nodes().PrefixList(a.Last)
+		if err != nil {
+			return nil
+		}
+		ids := make([]string, len(nodes))
+		for i, n := range nodes {
+			ids[i] = n.ID
+		}
+		return ids
+	})
+}
+
+// predictNamespaces completes the namespaces having a quota.
+func (m *Meta) predictNamespaces() complete.Predictor {
+	return complete.PredictFunc(func(a complete.Args) []string {
+		client, err := m.Client()
+		if err != nil {
+			return nil
+		}
+		usages, _, err := client.Quotas().List(nil)
+		if err != nil {
+			return nil
+		}
+		var namespaces []string
+		for _, u := range usages {
+			namespaces = append(namespaces, u.Quota.Namespace)
+		}
+		return namespaces
+	})
+}
+
+// predictBulk completes the operation of job-bulk, then the IDs of the jobs.
+func (m *Meta) predictBulk() complete.Predictor {
+	ops := []string{api.JobBulkPause, api.JobBulkResume, api.JobBulkStop, api.JobBulkEvaluate}
+	jobs := m.predictJobs()
+	return complete.PredictFunc(func(a complete.Args) []string {
+		for _, arg := range a.Completed {
+			for _, op := range ops {
+				if arg == op {
+					return jobs.Predict(a)
+				}
+			}
+		}
+		return complete.PredictSet(ops...).Predict(a)
+	})
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/g"
+	ulog "github.com/actiontech/dtle/internal/logger"
+)
+
+type BenchmarkCommand struct {
+	Meta
+}
+
+func (c *BenchmarkCommand) Help() string {
+	helpText := `
+Usage: dtle benchmark [options]
+
+  Apply a synthetic workload of row changes to a MySQL server with the
+  applier of a job, and report the rows applied per second and the latency
+  percentiles of the transactions, for each configuration given by
+  -workers and -tx-boundary.
+
+  The tables of the benchmark are dropped and created again in -schema by
+  each configuration, which applies the same workload. Use a scratch server.
+
+Benchmark Options:
+
+  -host=<host>
+    Host of the MySQL server. Defaults to 127.0.0.1.
+
+  -port=<port>
+    Port of the MySQL server. Defaults to 3306.
+
+  -user=<user>
+    Defaults to root.
+
+  -password=<password>
+
+  -dtle-schema=<schema>
+    The schema keeping the applied GTIDs on the server. Defaults to dtle.
+
+  -schema=<schema>
+    The schema of the tables of the benchmark. Defaults to dtle_benchmark.
+
+  -tables=<n>
+    Defaults to 4.
+
+  -columns=<n>
+    The varchar columns of a table, besides its primary key. Defaults to 4.
+
+  -row-bytes=<n>
+    The bytes of the varchar columns of a row. Defaults to 256.
+
+  -rows=<n>
+    The rows written. Defaults to 100000.
+
+  -rows-per-tx=<n>
+    Defaults to 1.
+
+  -update-ratio=<ratio>
+    The share of the rows written which update a row inserted before, the
+    others are inserted. Defaults to 0.5.
+
+  -seed=<n>
+    Seed of the workload. Defaults to 1.
+
+  -workers=<n>
+    ParallelWorkers of the applier. It can be repeated, for a configuration
+    with each. Defaults to 1.
+
+  -tx-boundary=<preserve|regroup>
+    TxBoundary of the applier. It can be repeated, for a configuration with
+    each. Defaults to preserve.
+
+  -log-level=<level>
+    Defaults to WARN.
+
+Output Options:
+
+  ` + outputOptionsUsage() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *BenchmarkCommand) Synopsis() string {
+	return "Benchmark the applier on a synthetic workload"
+}
+
+func (c *BenchmarkCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetNone),
+		complete.Flags{
+			"-host":         complete.PredictAnything,
+			"-port":         complete.PredictAnything,
+			"-user":         complete.PredictAnything,
+			"-password":     complete.PredictAnything,
+			"-dtle-schema":  complete.PredictAnything,
+			"-schema":       complete.PredictAnything,
+			"-tables":       complete.PredictAnything,
+			"-columns":      complete.PredictAnything,
+			"-row-bytes":    complete.PredictAnything,
+			"-rows":         complete.PredictAnything,
+			"-rows-per-tx":  complete.PredictAnything,
+			"-update-ratio": complete.PredictAnything,
+			"-seed":         complete.PredictAnything,
+			"-workers":      complete.PredictAnything,
+			"-tx-boundary":  complete.PredictSet(config.TxBoundaryPreserve, config.TxBoundaryRegroup),
+			"-log-level":    complete.PredictSet("DEBUG", "INFO", "WARN", "ERROR"),
+		})
+}
+
+func (c *BenchmarkCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *BenchmarkCommand) Run(args []string) int {
+	var logLevel string
+	var workers, boundaries repeatedFlag
+	conn := umconf.ConnectionConfig{}
+	opts := &mysql.BenchmarkOptions{}
+
+	flags := c.Meta.FlagSet("benchmark", FlagSetNone)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&conn.Host, "host", "127.0.0.1", "")
+	flags.IntVar(&conn.Port, "port", 3306, "")
+	flags.StringVar(&conn.User, "user", "root", "")
+	flags.StringVar(&conn.Password, "password", "", "")
+	flags.StringVar(&g.DtleSchemaName, "dtle-schema", "dtle", "")
+	flags.StringVar(&opts.Schema, "schema", "dtle_benchmark", "")
+	flags.IntVar(&opts.Tables, "tables", 4, "")
+	flags.IntVar(&opts.Columns, "columns", 4, "")
+	flags.IntVar(&opts.RowBytes, "row-bytes", 256, "")
+	flags.IntVar(&opts.Rows, "rows", 100000, "")
+	flags.IntVar(&opts.RowsPerTx, "rows-per-tx", 1, "")
+	flags.Float64Var(&opts.UpdateRatio, "update-ratio", 0.5, "")
+	flags.Int64Var(&opts.Seed, "seed", 1, "")
+	flags.Var(&workers, "workers", "")
+	flags.Var(&boundaries, "tx-boundary", "")
+	flags.StringVar(&logLevel, "log-level", "WARN", "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(flags.Args()) != 0 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+	if len(workers) == 0 {
+		workers = repeatedFlag{"1"}
+	}
+	if len(boundaries) == 0 {
+		boundaries = repeatedFlag{config.TxBoundaryPreserve}
+	}
+
+	logger := ulog.New(os.Stderr, ulog.ParseLevel(logLevel))
+	var results []*mysql.BenchmarkResult
+	failed := false
+	for _, w := range workers {
+		n, err := strconv.Atoi(w)
+		if err != nil || n <= 0 {
+			c.Ui.Error(fmt.Sprintf("Invalid -workers %q", w))
+			return 1
+		}
+		for _, boundary := range boundaries {
+			connCopy := conn
+			cfg := &config.MySQLDriverConfig{
+				ConnectionConfig: &connCopy,
+				ParallelWorkers:  n,
+				TxBoundary:       boundary,
+			}
+			result, err := mysql.RunBenchmark(cfg, opts, logger)
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Error running the benchmark: %s", err))
+				return 1
+			}
+			if result.Error != "" {
+				failed = true
+			}
+			results = append(results, result)
+		}
+	}
+
+	if c.formatted() {
+		if err := c.outputData(results); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	} else {
+		out := []string{"Workers|TxBoundary|Txs|Rows|Elapsed|Rows/s|p50 (ms)|p90 (ms)|p99 (ms)|Max (ms)|Error"}
+		for _, r := range results {
+			out = append(out, fmt.Sprintf("%d|%s|%d|%d|%.3fs|%.1f|%.2f|%.2f|%.2f|%.2f|%s",
+				r.Workers, r.TxBoundary, r.Txs, r.Rows, r.ElapsedSeconds, r.RowsPerSec,
+				r.LatencyP50Ms, r.LatencyP90Ms, r.LatencyP99Ms, r.LatencyMaxMs, r.Error))
+		}
+		c.Ui.Output(formatList(out))
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/api"
+)
+
+type BulkCommand struct {
+	Meta
+}
+
+func (c *BulkCommand) Help() string {
+	helpText := `
+Usage: dtle job-bulk [options] <pause|resume|stop|evaluate> [<job> ...]
+
+  Pause, resume, stop or re-evaluate several jobs at once. The jobs are the
+  given job IDs, or the jobs matching the filters if no job IDs are given.
+  The operation is committed at once for all the jobs.
+
+  A job already paused or running is skipped by pause or resume. Stop
+  deregisters the jobs.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Bulk Options:
+
+  -filter <expr>
+    Select the jobs matching the filter, e.g. "meta.team==payments" or
+    "namespace==default". It can be repeated, for the jobs matching all the
+    filters. See "dtle job-status -help".
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *BulkCommand) Synopsis() string {
+	return "Pause, resume, stop or re-evaluate several jobs at once"
+}
+
+func (c *BulkCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-filter": complete.PredictAnything,
+		})
+}
+
+func (c *BulkCommand) AutocompleteArgs() complete.Predictor {
+	return c.predictBulk()
+}
+
+func (c *BulkCommand) Run(args []string) int {
+	var filters repeatedFlag
+
+	flags := c.Meta.FlagSet("job-bulk", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.Var(&filters, "filter", "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) < 1 || (len(args) == 1 && len(filters) == 0) {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	switch args[0] {
+	case api.JobBulkPause, api.JobBulkResume, api.JobBulkStop, api.JobBulkEvaluate:
+	default:
+		c.Ui.Error(fmt.Sprintf("Unknown operation %q", args[0]))
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	resp, _, err := client.Jobs().Bulk(args[0], filters, args[1:], nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error running %s: %s", args[0], err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(resp); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		for _, r := range resp.Results {
+			if !r.Skipped && r.Error != "" {
+				return 2
+			}
+		}
+		return 0
+	}
+
+	failed := false
+	out := []string{"ID|Name|Result|Evaluation"}
+	for _, r := range resp.Results {
+		result := "done"
+		if r.Skipped {
+			result = "skipped"
+		} else if r.Error != "" {
+			failed = true
+			result = r.Error
+		}
+		out = append(out, fmt.Sprintf("%s|%s|%s|%s", r.JobID, r.Name, result, r.EvalID))
+	}
+	c.Ui.Output(formatList(out))
+
+	if failed {
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/api"
+)
+
+type CheckpointCommand struct {
+	Meta
+}
+
+func (c *CheckpointCommand) Help() string {
+	helpText := `
+Usage: dtle job-checkpoint [options] <job>
+
+  Display where the tasks of a job resume: the GTID set executed on the
+  target, or, while the full copy is not done, the binlog coordinates of
+  its snapshot and the last chunk copied of each table.
+
+  With -set-gtid or -set-copy-progress, set it instead. The job must be
+  paused and its allocations stopped. To skip a transaction the target
+  cannot apply, set the GTID set shown with the transaction added, e.g.
+  "uuid:1-100" to "uuid:1-101". The job replicates the transactions after
+  the GTID set, without a full copy.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Checkpoint Options:
+
+  -set-gtid <gtid set>
+    Set the GTID set executed on the target.
+
+  -set-copy-progress <file>
+    Set the progress of the interrupted full copy, from a JSON file in the
+    format of the CopyProgress shown with -json. A table marked Done is
+    not copied again.
+
+  -yes
+    Automatic yes to prompts.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *CheckpointCommand) Synopsis() string {
+	return "Display or set the checkpoint of a job"
+}
+
+func (c *CheckpointCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-set-gtid":          complete.PredictAnything,
+			"-set-copy-progress": complete.PredictFiles("*.json"),
+			"-yes":               complete.PredictNothing,
+		})
+}
+
+func (c *CheckpointCommand) AutocompleteArgs() complete.Predictor {
+	return c.predictJobs()
+}
+
+func (c *CheckpointCommand) Run(args []string) int {
+	var setGtid, setCopyProgress string
+	var autoYes bool
+
+	flags := c.Meta.FlagSet("job-checkpoint", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&setGtid, "set-gtid", "", "")
+	flags.StringVar(&setCopyProgress, "set-copy-progress", "", "")
+	flags.BoolVar(&autoYes, "yes", false, "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	args = flags.Args()
+	if len(args) != 1 || (setGtid != "" && setCopyProgress != "") {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+	jobID := args[0]
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+	checkpoint, _, err := client.Jobs().Checkpoint(jobID, nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error querying the checkpoint of job %q: %s", jobID, err))
+		return 1
+	}
+
+	if setGtid == "" && setCopyProgress == "" {
+		if c.formatted() {
+			if err := c.outputData(checkpoint); err != nil {
+				c.Ui.Error(err.Error())
+				return 1
+			}
+			return 0
+		}
+		c.Ui.Output(formatCheckpoint(checkpoint))
+		return 0
+	}
+
+	req := &api.JobSetCheckpointRequest{Gtid: setGtid}
+	if setCopyProgress != "" {
+		data, err := ioutil.ReadFile(setCopyProgress)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error reading -set-copy-progress: %s", err))
+			return 1
+		}
+		if err := json.Unmarshal(data, &req.CopyProgress); err != nil || req.CopyProgress == nil {
+			c.Ui.Error(fmt.Sprintf("Error parsing -set-copy-progress: %v", err))
+			return 1
+		}
+	}
+
+	if !autoYes {
+		next := &api.JobCheckpointResponse{
+			JobID:        checkpoint.JobID,
+			Status:       checkpoint.Status,
+			Gtid:         req.Gtid,
+			CopyProgress: req.CopyProgress,
+		}
+		c.Ui.Output(fmt.Sprintf("Current checkpoint:\n\n%s\n\nNew checkpoint:\n\n%s\n",
+			formatCheckpoint(checkpoint), formatCheckpoint(next)))
+		question := fmt.Sprintf("Are you sure you want to set the checkpoint of job %q? [y/N]", checkpoint.JobID)
+		answer, err := c.Ui.Ask(question)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to parse answer: %v", err))
+			return 1
+		}
+		if answer != "y" {
+			c.Ui.Output("Cancelling setting the checkpoint. For confirmation, an exact 'y' is required.")
+			return 0
+		}
+	}
+
+	if _, err := client.Jobs().SetCheckpoint(checkpoint.JobID, req, nil); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error setting the checkpoint of job %q: %s", checkpoint.JobID, err))
+		return 1
+	}
+	c.Ui.Output(fmt.Sprintf("Checkpoint of job %q set. Resume the job to apply it.", checkpoint.JobID))
+	return 0
+}
+
+// formatCheckpoint lists the GTID set of a checkpoint, or the progress of its
+// full copy by table.
+func formatCheckpoint(checkpoint *api.JobCheckpointResponse) string {
+	out := []string{
+		fmt.Sprintf("ID|%s", checkpoint.JobID),
+		fmt.Sprintf("Status|%s", checkpoint.Status),
+		fmt.Sprintf("Gtid|%s", checkpoint.Gtid),
+	}
+	p := checkpoint.CopyProgress
+	if p == nil {
+		return formatKV(out)
+	}
+	out = append(out,
+		fmt.Sprintf("Snapshot Gtid|%s", p.Gtid),
+		fmt.Sprintf("Snapshot Binlog|%s:%d", p.LogFile, p.LogPos))
+
+	tables := make([]string, 0, len(p.Tables))
+	for table := range p.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	list := []string{"Table|Unique Key|Chunks|Last Values|Rows|Done"}
+	for _, table := range tables {
+		w := p.Tables[table]
+		list = append(list, fmt.Sprintf("%s|%s|%d|%s|%d|%t",
+			table, w.UniqueKey, w.Iteration, strings.Join(w.LastMaxVals, ","), w.Rows, w.Done))
+	}
+	return fmt.Sprintf("%s\n\nCopied Tables\n%s", formatKV(out), formatList(list))
+}
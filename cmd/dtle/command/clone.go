@@ -0,0 +1,177 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/api"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+type CloneCommand struct {
+	Meta
+}
+
+func (c *CloneCommand) Help() string {
+	helpText := `
+Usage: dtle job-clone [options] <job>
+
+  Register a new job with the config of an existing job, changed by the
+  options. The status of the existing job and its owner are not copied.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Clone Options:
+
+  -id <id>
+    The ID of the new job. Generated if not given.
+
+  -name <name>
+    The name of the new job. Its ID if not given.
+
+  -dest-host <host>, -dest-port <port>, -dest-user <user>, -dest-password <password>
+    Change the ConnectionConfig of the Dest task.
+
+  -config <json>
+    Merge the config into the tasks by type, e.g.
+    '{"Src": {"ReplicateDoDb": [{"TableSchema": "db2"}]}}'. An object is
+    merged key by key, any other value replaces the one of the job.
+
+  -skip-full-copy
+    Start the new job at the GTID set executed on the source now, without
+    copying the existing rows. The rows must already be on the target.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *CloneCommand) Synopsis() string {
+	return "Register a new job from an existing one"
+}
+
+func (c *CloneCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-id":             complete.PredictAnything,
+			"-name":           complete.PredictAnything,
+			"-dest-host":      complete.PredictAnything,
+			"-dest-port":      complete.PredictAnything,
+			"-dest-user":      complete.PredictAnything,
+			"-dest-password":  complete.PredictAnything,
+			"-config":         complete.PredictAnything,
+			"-skip-full-copy": complete.PredictNothing,
+		})
+}
+
+func (c *CloneCommand) AutocompleteArgs() complete.Predictor {
+	return c.predictJobs()
+}
+
+func (c *CloneCommand) Run(args []string) int {
+	req := &api.JobCloneRequest{}
+	var destHost, destUser, destPassword, config string
+	var destPort int
+
+	flags := c.Meta.FlagSet("job-clone", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&req.ID, "id", "", "")
+	flags.StringVar(&req.Name, "name", "", "")
+	flags.StringVar(&destHost, "dest-host", "", "")
+	flags.IntVar(&destPort, "dest-port", 0, "")
+	flags.StringVar(&destUser, "dest-user", "", "")
+	flags.StringVar(&destPassword, "dest-password", "", "")
+	flags.StringVar(&config, "config", "", "")
+	flags.BoolVar(&req.SkipFullCopy, "skip-full-copy", false, "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	args = flags.Args()
+	if len(args) != 1 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &req.Config); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error parsing -config: %s", err))
+			return 1
+		}
+	}
+	conn := make(map[string]interface{})
+	if destHost != "" {
+		conn["Host"] = destHost
+	}
+	if destPort != 0 {
+		conn["Port"] = destPort
+	}
+	if destUser != "" {
+		conn["User"] = destUser
+	}
+	if destPassword != "" {
+		conn["Password"] = destPassword
+	}
+	if len(conn) > 0 {
+		if req.Config == nil {
+			req.Config = make(map[string]map[string]interface{})
+		}
+		if req.Config[models.TaskTypeDest] == nil {
+			req.Config[models.TaskTypeDest] = make(map[string]interface{})
+		}
+		// the options win over the same keys of -config
+		req.Config[models.TaskTypeDest]["ConnectionConfig"] = mergeCloneConfig(
+			req.Config[models.TaskTypeDest]["ConnectionConfig"], conn)
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+	resp, _, err := client.Jobs().Clone(args[0], req, nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error cloning job %q: %s", args[0], err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(resp); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
+
+	out := []string{
+		fmt.Sprintf("ID|%s", resp.ID),
+		fmt.Sprintf("Name|%s", resp.Name),
+	}
+	if resp.Gtid != "" {
+		out = append(out, fmt.Sprintf("Gtid|%s", resp.Gtid))
+	}
+	out = append(out, fmt.Sprintf("Evaluation|%s", resp.EvalID))
+	c.Ui.Output(formatKV(out))
+	return 0
+}
+
+// mergeCloneConfig sets the keys of conn in the ConnectionConfig given by
+// -config, if it is an object.
+func mergeCloneConfig(given interface{}, conn map[string]interface{}) map[string]interface{} {
+	merged, ok := given.(map[string]interface{})
+	if !ok {
+		return conn
+	}
+	for k, v := range conn {
+		merged[k] = v
+	}
+	return merged
+}
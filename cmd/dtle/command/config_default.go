@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/agent"
+)
+
+type ConfigDefaultCommand struct {
+	Meta
+}
+
+func (c *ConfigDefaultCommand) Help() string {
+	helpText := `
+Usage: dtle config-default [<path>]
+
+  Write the configuration file of a server running a manager and an agent,
+  with every option set to its default or commented out, to <path>, or to
+  stdout if no path is given. An existing file is not overwritten.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigDefaultCommand) Synopsis() string {
+	return "Generate a default configuration file of a server"
+}
+
+func (c *ConfigDefaultCommand) AutocompleteFlags() complete.Flags {
+	return nil
+}
+
+func (c *ConfigDefaultCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *ConfigDefaultCommand) Run(args []string) int {
+	if len(args) > 1 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	content, err := agent.DefaultConfigFile()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error generating the configuration: %s", err))
+		return 1
+	}
+	if len(args) == 0 {
+		c.Ui.Output(content)
+		return 0
+	}
+
+	path := args[0]
+	_, err = os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		c.Ui.Error(fmt.Sprintf("Failed to stat '%s': %v", path, err))
+		return 1
+	}
+	if !os.IsNotExist(err) {
+		c.Ui.Error(fmt.Sprintf("Configuration '%s' already exists", path))
+		return 1
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0640); err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to write '%s': %v", path, err))
+		return 1
+	}
+	c.Ui.Output(fmt.Sprintf("Default configuration written to %s", path))
+	return 0
+}
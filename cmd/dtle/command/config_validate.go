@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/agent"
+)
+
+type ConfigValidateCommand struct {
+	Meta
+}
+
+func (c *ConfigValidateCommand) Help() string {
+	helpText := `
+Usage: dtle config-validate [options] <path> [<path>...]
+
+  Check the configuration files of a server, given as with "dtle server
+  -config": files, or directories whose .hcl and .json files are loaded in
+  alphabetical order. The files are merged over the defaults as the server
+  does.
+
+  An unknown key is reported with its line, as are the values which would
+  stop the server from starting. The exit code is 0 if the configuration is
+  valid, 1 otherwise.
+
+Output Options:
+
+  ` + outputOptionsUsage() + `
+    The data is the merged configuration.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigValidateCommand) Synopsis() string {
+	return "Check the configuration files of a server"
+}
+
+func (c *ConfigValidateCommand) AutocompleteFlags() complete.Flags {
+	return c.Meta.AutocompleteFlags(FlagSetNone)
+}
+
+func (c *ConfigValidateCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictOr(complete.PredictFiles("*.hcl"), complete.PredictFiles("*.json"),
+		complete.PredictFiles("*.conf"))
+}
+
+func (c *ConfigValidateCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("config-validate", FlagSetNone)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	config := agent.DefaultConfig()
+	for _, path := range args {
+		current, err := agent.LoadConfig(path)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		if len(current.Files) == 0 {
+			c.Ui.Error(fmt.Sprintf("No configuration file in %s", path))
+			return 1
+		}
+		config = config.Merge(current)
+
+		// The files with other extensions in a directory are not loaded
+		for _, f := range skippedConfigFiles(path, current.Files) {
+			c.Ui.Warn(fmt.Sprintf("Ignored %s: only .hcl and .json files of a directory are loaded", f))
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		c.Ui.Error(fmt.Sprintf("Invalid configuration: %s", err))
+		return 1
+	}
+
+	if c.formatted() {
+		if err := c.outputData(config); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
+	c.Ui.Output(fmt.Sprintf("Configuration is valid: %s", strings.Join(config.Files, ", ")))
+	return 0
+}
+
+// skippedConfigFiles returns the files of the directory at path which were
+// not loaded, or nothing if path is a file.
+func skippedConfigFiles(path string, loaded []string) []string {
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+	isLoaded := make(map[string]bool, len(loaded))
+	for _, f := range loaded {
+		isLoaded[f] = true
+	}
+	var skipped []string
+	for _, fi := range fis {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") || strings.HasSuffix(fi.Name(), "~") {
+			continue
+		}
+		if f := filepath.Join(path, fi.Name()); !isLoaded[f] {
+			skipped = append(skipped, f)
+		}
+	}
+	return skipped
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestConfigValidateCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtle-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The default config is valid
+	path := filepath.Join(dir, "dtle.hcl")
+	ui := new(cli.MockUi)
+	if code := (&ConfigDefaultCommand{Meta: Meta{Ui: ui}}).Run([]string{path}); code != 0 {
+		t.Fatalf("config-default exited %d: %s", code, ui.ErrorWriter.String())
+	}
+	ui = new(cli.MockUi)
+	if code := (&ConfigValidateCommand{Meta: Meta{Ui: ui}}).Run([]string{dir}); code != 0 {
+		t.Fatalf("config-validate exited %d: %s", code, ui.ErrorWriter.String())
+	}
+	if out := ui.OutputWriter.String(); !strings.Contains(out, path) {
+		t.Errorf("output = %q", out)
+	}
+
+	// A file of the directory which is not loaded is reported
+	if err := ioutil.WriteFile(filepath.Join(dir, "extra.conf"), []byte(`log_level = "DEBUG"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ui = new(cli.MockUi)
+	if code := (&ConfigValidateCommand{Meta: Meta{Ui: ui}}).Run([]string{dir}); code != 0 {
+		t.Fatalf("config-validate exited %d: %s", code, ui.ErrorWriter.String())
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "Ignored "+filepath.Join(dir, "extra.conf")) {
+		t.Errorf("the skipped file is not reported: %q", out)
+	}
+
+	// An unknown key
+	bad := filepath.Join(dir, "bad.hcl")
+	if err := ioutil.WriteFile(bad, []byte("manager {\n  enabled = true\n  bootstrap = 1\n}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ui = new(cli.MockUi)
+	if code := (&ConfigValidateCommand{Meta: Meta{Ui: ui}}).Run([]string{bad}); code != 1 {
+		t.Fatalf("config-validate exited %d", code)
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "invalid key: bootstrap (line 3)") {
+		t.Errorf("error = %q", out)
+	}
+
+	// config-default does not overwrite a file
+	ui = new(cli.MockUi)
+	if code := (&ConfigDefaultCommand{Meta: Meta{Ui: ui}}).Run([]string{path}); code != 1 {
+		t.Errorf("config-default overwrote %s", path)
+	}
+}
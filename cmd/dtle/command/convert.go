@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+type ConvertCommand struct {
+	Meta
+	JobGetter
+}
+
+func (c *ConvertCommand) Help() string {
+	helpText := `
+Usage: dtle job-convert [options] <path>
+
+  Report the schema conversion of the job specified at <path>, whose Dest
+  task is not MySQL: the type of each column on the target, and the
+  statement creating each target table. Nothing is created.
+
+  Once reviewed, the statements are copied to TableStatements of the Dest
+  task, and CreateTables is set for the job to create the tables.
+
+  If the supplied path is "-", the jobfile is read from stdin.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Convert Options:
+
+  -statements
+    Only print the statements.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConvertCommand) Synopsis() string {
+	return "Report the target tables of a job with a non-MySQL target"
+}
+
+func (c *ConvertCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-statements": complete.PredictNothing,
+		})
+}
+
+func (c *ConvertCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *ConvertCommand) Run(args []string) int {
+	var statementsOnly bool
+
+	flags := c.Meta.FlagSet("job-convert", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.BoolVar(&statementsOnly, "statements", false, "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	job, err := c.JobGetter.ApiJob(args[0])
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error getting job struct: %s", err))
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+	if r := job.Region; r != nil {
+		client.SetRegion(*r)
+	}
+
+	resp, _, err := client.Jobs().Convert(job, nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error converting job: %s", err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(resp); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		for _, tb := range resp.Tables {
+			if tb.Error != "" {
+				return 2
+			}
+		}
+		return 0
+	}
+
+	failed := false
+	for _, tb := range resp.Tables {
+		if tb.Error != "" {
+			failed = true
+			c.Ui.Error(fmt.Sprintf("%s.%s: %s", tb.TableSchema, tb.TableName, tb.Error))
+		}
+		if statementsOnly {
+			if tb.Statement != "" {
+				c.Ui.Output(tb.Statement + ";")
+			}
+			continue
+		}
+
+		out := []string{"Column|Source Type|Target Type|Note"}
+		for _, col := range tb.Columns {
+			out = append(out, fmt.Sprintf("%s|%s|%s|%s", col.Name, col.SourceType, col.TargetType, col.Note))
+		}
+		c.Ui.Output(c.Colorize().Color(fmt.Sprintf("[bold]%s.%s[reset]", tb.TableSchema, tb.TableName)))
+		c.Ui.Output(formatList(out))
+		if tb.Statement != "" {
+			c.Ui.Output("")
+			c.Ui.Output(tb.Statement + ";")
+		}
+		c.Ui.Output("")
+	}
+
+	if failed {
+		return 2
+	}
+	return 0
+}
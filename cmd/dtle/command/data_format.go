@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+// DataFormatter formats the data of a command for scripts, instead of the
+// tables read by humans.
+type DataFormatter interface {
+	TransformData(interface{}) (string, error)
+}
+
+// DataFormat returns the formatter of -json or -t, which are exclusive.
+func DataFormat(asJSON bool, tmpl string) (DataFormatter, error) {
+	switch {
+	case asJSON && tmpl != "":
+		return nil, fmt.Errorf("-json and -t cannot be used together")
+	case asJSON:
+		return &JSONFormat{}, nil
+	case tmpl != "":
+		t, err := template.New("format").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing the template: %s", err)
+		}
+		return &TemplateFormat{tmpl: t}, nil
+	}
+	return nil, fmt.Errorf("no output format given")
+}
+
+// templateFlag is the template of -t, parsed when set for a bad template to
+// be reported before the command runs.
+type templateFlag string
+
+func (f *templateFlag) String() string {
+	return string(*f)
+}
+
+func (f *templateFlag) Set(v string) error {
+	if _, err := template.New("format").Parse(v); err != nil {
+		return err
+	}
+	*f = templateFlag(v)
+	return nil
+}
+
+// JSONFormat outputs the data as indented JSON.
+type JSONFormat struct{}
+
+func (p *JSONFormat) TransformData(data interface{}) (string, error) {
+	out, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return "", fmt.Errorf("Error formatting the data as JSON: %s", err)
+	}
+	return string(out), nil
+}
+
+// TemplateFormat outputs the data through a Go template, e.g.
+// '{{range .}}{{.ID}} {{.Status}}{{"\n"}}{{end}}'.
+type TemplateFormat struct {
+	tmpl *template.Template
+}
+
+func (p *TemplateFormat) TransformData(data interface{}) (string, error) {
+	var out bytes.Buffer
+	if err := p.tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("Error executing the template: %s", err)
+	}
+	return out.String(), nil
+}
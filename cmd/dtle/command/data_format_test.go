@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestDataFormat(t *testing.T) {
+	data := []map[string]string{{"ID": "job1", "Status": "running"}, {"ID": "job2", "Status": "dead"}}
+
+	f, err := DataFormat(true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := f.TransformData(data)
+	if err != nil || !strings.Contains(out, `"ID": "job1"`) {
+		t.Errorf("JSON = %q %v", out, err)
+	}
+
+	f, err = DataFormat(false, `{{range .}}{{.ID}}={{.Status}} {{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := f.TransformData(data); err != nil || out != "job1=running job2=dead " {
+		t.Errorf("template = %q %v", out, err)
+	}
+
+	if _, err := DataFormat(true, "{{.ID}}"); err == nil {
+		t.Error("-json and -t were accepted together")
+	}
+	var tmpl templateFlag
+	if err := tmpl.Set("{{.ID"); err == nil {
+		t.Error("a bad template was accepted")
+	}
+}
+
+func TestMeta_OutputData(t *testing.T) {
+	ui := new(cli.MockUi)
+	m := &Meta{Ui: ui}
+	flags := m.FlagSet("test", FlagSetClient)
+	if err := flags.Parse([]string{"-t", "{{.Name}}"}); err != nil {
+		t.Fatal(err)
+	}
+	if !m.formatted() {
+		t.Fatal("-t does not format the output")
+	}
+	if err := m.outputData(struct{ Name string }{"node1"}); err != nil {
+		t.Fatal(err)
+	}
+	if out := ui.OutputWriter.String(); out != "node1\n" {
+		t.Errorf("output = %q", out)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/posener/complete"
 	"github.com/ryanuber/columnize"
 
 	"github.com/actiontech/dtle/api"
@@ -46,6 +47,17 @@ func (c *ServerMembersCommand) Synopsis() string {
 	return "Display a list of known managers and their status"
 }
 
+func (c *ServerMembersCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-detailed": complete.PredictNothing,
+		})
+}
+
+func (c *ServerMembersCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
 func (c *ServerMembersCommand) Run(args []string) int {
 	var detailed bool
 
@@ -85,6 +97,13 @@ func (c *ServerMembersCommand) Run(args []string) int {
 
 	// Sort the members
 	sort.Sort(api.AgentMembersNameSort(srvMembers.Members))
+	if c.formatted() {
+		if err := c.outputData(srvMembers.Members); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
 
 	// Determine the leaders per region.
 	leaders, err := regionLeaders(client, srvMembers.Members)
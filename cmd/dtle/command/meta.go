@@ -51,6 +51,11 @@ type Meta struct {
 
 	// The region to send API requests
 	region string
+
+	// The output of the data of the command as JSON, or through a template,
+	// for scripts
+	json bool
+	tmpl templateFlag
 }
 
 // FlagSet returns a FlagSet with the common flags that every
@@ -68,6 +73,8 @@ func (m *Meta) FlagSet(n string, fs FlagSetFlags) *flag.FlagSet {
 		f.BoolVar(&m.noColor, "no-color", false, "")
 
 	}
+	f.BoolVar(&m.json, "json", false, "")
+	f.Var(&m.tmpl, "t", "")
 
 	// Create an io.Writer that writes to our UI properly for errors.
 	// This is kind of a hack, but it does the job. Basically: create
@@ -105,6 +112,27 @@ func (m *Meta) Client() (*api.Client, error) {
 	return api.NewClient(config)
 }
 
+// formatted returns whether -json or -t is set. The command then outputs its
+// data with outputData instead of tables.
+func (m *Meta) formatted() bool {
+	return m.json || m.tmpl != ""
+}
+
+// outputData outputs the data of the command as JSON or through the
+// template.
+func (m *Meta) outputData(data interface{}) error {
+	f, err := DataFormat(m.json, string(m.tmpl))
+	if err != nil {
+		return err
+	}
+	out, err := f.TransformData(data)
+	if err != nil {
+		return err
+	}
+	m.Ui.Output(out)
+	return nil
+}
+
 func (m *Meta) Colorize() *colorstring.Colorize {
 	return &colorstring.Colorize{
 		Colors:  colorstring.DefaultColors,
@@ -128,6 +156,20 @@ func generalOptionsUsage() string {
   
   -no-color
     Disables colored command output.
+
+  ` + outputOptionsUsage()
+	return strings.TrimSpace(helpText)
+}
+
+// outputOptionsUsage returns the help string for the output options.
+func outputOptionsUsage() string {
+	helpText := `
+  -json
+    Output the data of the command as JSON, instead of tables.
+
+  -t <template>
+    Format the data of the command with a Go template, e.g.
+    '{{range .}}{{.ID}}{{"\n"}}{{end}}'.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -10,8 +10,10 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/colorstring"
+	"github.com/posener/complete"
 
 	"github.com/actiontech/dtle/api"
 )
@@ -80,6 +82,20 @@ func (c *NodeStatusCommand) Synopsis() string {
 	return "Display status information about nodes"
 }
 
+func (c *NodeStatusCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-verbose": complete.PredictNothing,
+			"-allocs":  complete.PredictNothing,
+			"-self":    complete.PredictNothing,
+			"-stats":   complete.PredictNothing,
+		})
+}
+
+func (c *NodeStatusCommand) AutocompleteArgs() complete.Predictor {
+	return c.predictNodes()
+}
+
 func (c *NodeStatusCommand) Run(args []string) int {
 
 	flags := c.Meta.FlagSet("node-status", FlagSetClient)
@@ -117,6 +133,13 @@ func (c *NodeStatusCommand) Run(args []string) int {
 			c.Ui.Error(fmt.Sprintf("Error querying node status: %s", err))
 			return 1
 		}
+		if c.formatted() {
+			if err := c.outputData(nodes); err != nil {
+				c.Ui.Error(err.Error())
+				return 1
+			}
+			return 0
+		}
 
 		// Return nothing if no nodes found
 		if len(nodes) == 0 {
@@ -190,6 +213,10 @@ func (c *NodeStatusCommand) Run(args []string) int {
 		return 1
 	}
 	if len(nodes) > 1 {
+		if c.formatted() {
+			c.Ui.Error(fmt.Sprintf("Prefix %q matched multiple nodes", nodeID))
+			return 1
+		}
 		// Format the nodes list that matches the prefix so that the user
 		// can create a more specific request
 		out := make([]string, len(nodes)+1)
@@ -211,6 +238,13 @@ func (c *NodeStatusCommand) Run(args []string) int {
 		c.Ui.Error(fmt.Sprintf("Error querying node info: %s", err))
 		return 1
 	}
+	if c.formatted() {
+		if err := c.outputData(node); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
 
 	return c.formatNode(client, node)
 }
@@ -244,6 +278,14 @@ func (c *NodeStatusCommand) formatNode(client *api.Client, node *api.Node) int {
 		fmt.Sprintf("Status|%s", node.Status),
 		fmt.Sprintf("Drivers|%s", strings.Join(nodeDrivers(node), ",")),
 	}
+	if u := node.Utilization; u != nil {
+		basic = append(basic,
+			fmt.Sprintf("CPU|%.1f%%", u.CPUPercent),
+			fmt.Sprintf("Memory|%.1f%%", u.MemoryPercent),
+			fmt.Sprintf("Disk|%.1f%%", u.DiskPercent),
+			fmt.Sprintf("Network|%.2f MB/s", u.NetworkBytesPerSec/bytesPerMegabyte),
+			fmt.Sprintf("Utilization Updated|%s", formatTime(time.Unix(u.CollectedAt, 0))))
+	}
 
 	c.Ui.Output(c.Colorize().Color(formatKV(basic)))
 
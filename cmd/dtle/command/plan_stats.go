@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+type PlanStatsCommand struct {
+	Meta
+}
+
+func (c *PlanStatsCommand) Help() string {
+	helpText := `
+Usage: dtle plan-stats [options]
+
+  Display the outcome of the plans applied by the leader since it was
+  elected. The nodes of a partially committed plan are rejected, e.g. as
+  the node went down meanwhile, and the evaluation plans again for them.
+  An evaluation listed with many partial plans is stuck.
+
+General Options:
+
+  ` + generalOptionsUsage()
+	return strings.TrimSpace(helpText)
+}
+
+func (c *PlanStatsCommand) Synopsis() string {
+	return "Display the applied plans and why nodes were rejected"
+}
+
+func (c *PlanStatsCommand) AutocompleteFlags() complete.Flags {
+	return c.Meta.AutocompleteFlags(FlagSetClient)
+}
+
+func (c *PlanStatsCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *PlanStatsCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("plan-stats", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(flags.Args()) != 0 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	stats, _, err := client.Operator().PlanStats(nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error querying plan stats: %s", err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(stats); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
+
+	basic := []string{
+		fmt.Sprintf("Submitted|%d", stats.Submitted),
+		fmt.Sprintf("Applied|%d", stats.Applied),
+		fmt.Sprintf("Partial|%d", stats.Partial),
+		fmt.Sprintf("No-op|%d", stats.NoOp),
+		fmt.Sprintf("Failed|%d", stats.Failed),
+	}
+	c.Ui.Output(formatKV(basic))
+
+	if len(stats.RejectedNodes) > 0 {
+		var reasons []string
+		for reason := range stats.RejectedNodes {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		out := []string{"Reason|Rejected Nodes"}
+		for _, reason := range reasons {
+			out = append(out, fmt.Sprintf("%s|%d", reason, stats.RejectedNodes[reason]))
+		}
+		c.Ui.Output(c.Colorize().Color("\n[bold]Rejections[reset]"))
+		c.Ui.Output(formatList(out))
+	}
+
+	if len(stats.Evals) > 0 {
+		out := []string{"Eval ID|Job ID|Partial Plans|Last Reason|Last Rejected"}
+		for _, e := range stats.Evals {
+			out = append(out, fmt.Sprintf("%s|%s|%d|%s|%s",
+				limit(e.EvalID, 8), e.JobID, e.PartialPlans, e.LastReason, formatTime(e.LastTime)))
+		}
+		c.Ui.Output(c.Colorize().Color("\n[bold]Evaluations[reset]"))
+		c.Ui.Output(formatList(out))
+	}
+
+	if len(stats.Rejections) > 0 {
+		out := []string{"Time|Eval ID|Node ID|Reason|Detail"}
+		for _, r := range stats.Rejections {
+			out = append(out, fmt.Sprintf("%s|%s|%s|%s|%s",
+				formatTime(r.Time), limit(r.EvalID, 8), limit(r.NodeID, 8), r.Reason, r.Detail))
+		}
+		c.Ui.Output(c.Colorize().Color("\n[bold]Recent Rejections[reset]"))
+		c.Ui.Output(formatList(out))
+	}
+	return 0
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/api"
+)
+
+type QuotaApplyCommand struct {
+	Meta
+}
+
+func (c *QuotaApplyCommand) Help() string {
+	helpText := `
+Usage: dtle quota-apply [options] <namespace>
+
+  Create or update the quota of a namespace. The jobs set their namespace
+  with the "Namespace" parameter, or are in the "default" namespace.
+
+  A job over MaxJobs or MaxRowsPerSecond is refused when it is registered.
+  A job over MaxFullCopies is not scheduled until another full copy of the
+  namespace ends. A limit of 0 is no limit.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Quota Apply Options:
+
+  -description <text>
+    A description of the quota.
+
+  -max-jobs <n>
+    The number of jobs of the namespace which are not dead.
+
+  -max-full-copies <n>
+    The number of jobs of the namespace doing their full copy at the same
+    time.
+
+  -max-rows-per-second <n>
+    The sum of RowsPerSecond of the jobs of the namespace. Every job of the
+    namespace then has to set RowsPerSecond in its Src task.
+
+  -throttle-window "[<days>] <start>-<end> [<timezone>] [<rows>]"
+    A time window in which the copy of the jobs of the namespace is limited
+    to <rows> per second, or paused without <rows>, e.g.
+    "Mon-Fri 09:00-18:00 Asia/Shanghai 1000". The jobs registered with
+    their own ThrottleWindows keep them. It can be repeated.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *QuotaApplyCommand) Synopsis() string {
+	return "Create or update the quota of a namespace"
+}
+
+func (c *QuotaApplyCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-description":         complete.PredictAnything,
+			"-max-jobs":            complete.PredictAnything,
+			"-max-full-copies":     complete.PredictAnything,
+			"-max-rows-per-second": complete.PredictAnything,
+			"-throttle-window":     complete.PredictAnything,
+		})
+}
+
+func (c *QuotaApplyCommand) AutocompleteArgs() complete.Predictor {
+	return c.predictNamespaces()
+}
+
+func (c *QuotaApplyCommand) Run(args []string) int {
+	quota := &api.QuotaSpec{}
+
+	flags := c.Meta.FlagSet("quota-apply", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&quota.Description, "description", "", "")
+	flags.IntVar(&quota.MaxJobs, "max-jobs", 0, "")
+	flags.IntVar(&quota.MaxFullCopies, "max-full-copies", 0, "")
+	flags.Int64Var(&quota.MaxRowsPerSecond, "max-rows-per-second", 0, "")
+	var windows repeatedFlag
+	flags.Var(&windows, "throttle-window", "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+	quota.Namespace = args[0]
+	for _, spec := range windows {
+		w, err := parseThrottleWindow(spec)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		quota.ThrottleWindows = append(quota.ThrottleWindows, w)
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	if _, err := client.Quotas().Upsert(quota, nil); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error applying quota: %s", err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(quota); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
+	c.Ui.Output(fmt.Sprintf("Applied the quota of namespace %q", quota.Namespace))
+	return 0
+}
+
+// parseThrottleWindow parses "[<days>] <start>-<end> [<timezone>] [<rows>]",
+// e.g. "Mon-Fri 09:00-18:00 Asia/Shanghai 1000".
+func parseThrottleWindow(spec string) (*api.ThrottleWindow, error) {
+	w := &api.ThrottleWindow{}
+	for _, token := range strings.Fields(spec) {
+		switch {
+		case strings.Contains(token, ":"):
+			times := strings.Split(token, "-")
+			if len(times) != 2 {
+				return nil, fmt.Errorf("throttle window %q: bad time range %q", spec, token)
+			}
+			w.Start, w.End = times[0], times[1]
+		case strings.Trim(token, "0123456789") == "":
+			rows, err := strconv.ParseInt(token, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("throttle window %q: %v", spec, err)
+			}
+			w.RowsPerSecond = rows
+		case strings.Contains(token, "/") || token == "UTC" || token == "Local":
+			w.Timezone = token
+		default:
+			w.Days = strings.Split(token, ",")
+		}
+	}
+	if w.Start == "" {
+		return nil, fmt.Errorf("throttle window %q: missing <start>-<end>", spec)
+	}
+	return w, nil
+}
+
+type QuotaListCommand struct {
+	Meta
+}
+
+func (c *QuotaListCommand) Help() string {
+	helpText := `
+Usage: dtle quota-list [options]
+
+  List the quotas, and the usage of each namespace against its quota.
+  Unlimited values are shown as "-".
+
+General Options:
+
+  ` + generalOptionsUsage()
+	return strings.TrimSpace(helpText)
+}
+
+func (c *QuotaListCommand) Synopsis() string {
+	return "List the quotas of the namespaces and their usage"
+}
+
+func (c *QuotaListCommand) AutocompleteFlags() complete.Flags {
+	return c.Meta.AutocompleteFlags(FlagSetClient)
+}
+
+func (c *QuotaListCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *QuotaListCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("quota-list", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(flags.Args()) != 0 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	usages, _, err := client.Quotas().List(nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error listing quotas: %s", err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(usages); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
+	if len(usages) == 0 {
+		c.Ui.Output("No quotas")
+		return 0
+	}
+
+	out := []string{"Namespace|Jobs|Full Copies|Rows/s|Description"}
+	for _, u := range usages {
+		out = append(out, fmt.Sprintf("%s|%s|%s|%s|%s",
+			u.Quota.Namespace,
+			quotaUsed(int64(u.Jobs), int64(u.Quota.MaxJobs)),
+			quotaUsed(int64(u.FullCopies), int64(u.Quota.MaxFullCopies)),
+			quotaUsed(u.RowsPerSecond, u.Quota.MaxRowsPerSecond),
+			u.Quota.Description))
+	}
+	c.Ui.Output(formatList(out))
+	return 0
+}
+
+// quotaUsed formats a usage and its limit, e.g. "2/5"
+func quotaUsed(used, max int64) string {
+	if max == 0 {
+		return fmt.Sprintf("%d/-", used)
+	}
+	return fmt.Sprintf("%d/%d", used, max)
+}
+
+type QuotaDeleteCommand struct {
+	Meta
+}
+
+func (c *QuotaDeleteCommand) Help() string {
+	helpText := `
+Usage: dtle quota-delete [options] <namespace>
+
+  Delete the quota of a namespace. Its jobs are no longer limited, and the
+  jobs waiting for a full copy are scheduled.
+
+General Options:
+
+  ` + generalOptionsUsage()
+	return strings.TrimSpace(helpText)
+}
+
+func (c *QuotaDeleteCommand) Synopsis() string {
+	return "Delete the quota of a namespace"
+}
+
+func (c *QuotaDeleteCommand) AutocompleteFlags() complete.Flags {
+	return c.Meta.AutocompleteFlags(FlagSetClient)
+}
+
+func (c *QuotaDeleteCommand) AutocompleteArgs() complete.Predictor {
+	return c.predictNamespaces()
+}
+
+func (c *QuotaDeleteCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("quota-delete", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	args = flags.Args()
+	if len(args) != 1 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	if _, err := client.Quotas().Delete(args[0], nil); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error deleting quota: %s", err))
+		return 1
+	}
+	c.Ui.Output(fmt.Sprintf("Deleted the quota of namespace %q", args[0]))
+	return 0
+}
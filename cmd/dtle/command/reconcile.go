@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/api"
+)
+
+type ReconcileCommand struct {
+	Meta
+	JobGetter
+}
+
+func (c *ReconcileCommand) Help() string {
+	helpText := `
+Usage: dtle job-reconcile [options] -owner <owner> [<path> ...]
+
+  Make the jobs of an owner match the jobs specified at the paths. This is
+  what a controller, e.g. a Kubernetes operator, does to own a set of jobs
+  declaratively.
+
+  The jobs are matched by name. A new job is registered, and a job whose
+  spec changed since it was last reconciled is updated. A running job is
+  only updated with -replace, which stops it and registers the new spec
+  under a new ID.
+
+  If a supplied path is "-", the jobfile is read from stdin.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Reconcile Options:
+
+  -owner <owner>
+    The owner of the jobs. Required.
+
+  -prune
+    Deregister the jobs of the owner which are not in the paths.
+
+  -replace
+    Restart the running jobs whose spec changed.
+
+  -dry-run
+    Only report what would be done.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ReconcileCommand) Synopsis() string {
+	return "Make the jobs of an owner match a set of job files"
+}
+
+func (c *ReconcileCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-owner":   complete.PredictAnything,
+			"-prune":   complete.PredictNothing,
+			"-replace": complete.PredictNothing,
+			"-dry-run": complete.PredictNothing,
+		})
+}
+
+func (c *ReconcileCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *ReconcileCommand) Run(args []string) int {
+	req := &api.JobReconcileRequest{}
+
+	flags := c.Meta.FlagSet("job-reconcile", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&req.Owner, "owner", "", "")
+	flags.BoolVar(&req.Prune, "prune", false, "")
+	flags.BoolVar(&req.Replace, "replace", false, "")
+	flags.BoolVar(&req.DryRun, "dry-run", false, "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if req.Owner == "" {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	for _, path := range args {
+		job, err := c.JobGetter.ApiJob(path)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error getting job struct: %s", err))
+			return 1
+		}
+		req.Jobs = append(req.Jobs, job)
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	resp, _, err := client.Jobs().Reconcile(req, nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reconciling jobs: %s", err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(resp); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		for _, r := range resp.Results {
+			if r.Action == api.JobReconcileFailed {
+				return 2
+			}
+		}
+		return 0
+	}
+
+	failed := false
+	out := []string{"Name|ID|Action|Error"}
+	for _, r := range resp.Results {
+		if r.Action == api.JobReconcileFailed {
+			failed = true
+		}
+		out = append(out, fmt.Sprintf("%s|%s|%s|%s", r.Name, r.ID, r.Action, r.Error))
+	}
+	c.Ui.Output(formatList(out))
+
+	if failed {
+		return 2
+	}
+	return 0
+}
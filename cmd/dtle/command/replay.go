@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/g"
+	ulog "github.com/actiontech/dtle/internal/logger"
+)
+
+type ReplayCommand struct {
+	Meta
+}
+
+func (c *ReplayCommand) Help() string {
+	helpText := `
+Usage: dtle replay [options] <fixture>
+
+  Apply the binlog entries recorded at <fixture> to a MySQL server, the way
+  the applier of a job does. The fixture is recorded by a job with
+  RecordFile set on its Dest task, by the same version of dtle.
+
+  The entries are applied in order by a single worker, so a replay on the
+  same data gives the same result each time, e.g. to reproduce a failure
+  without the source. The GTIDs applied by a previous replay on the server
+  are forgotten first.
+
+  If the supplied path is "-", the fixture is read from stdin.
+
+Replay Options:
+
+  -host=<host>
+    Host of the target MySQL server. Defaults to 127.0.0.1.
+
+  -port=<port>
+    Port of the target MySQL server. Defaults to 3306.
+
+  -user=<user>
+    Defaults to root.
+
+  -password=<password>
+
+  -dtle-schema=<schema>
+    The schema keeping the applied GTIDs on the target. Defaults to dtle.
+
+  -log-level=<level>
+    Defaults to INFO. DEBUG logs each entry.
+
+Output Options:
+
+  ` + outputOptionsUsage() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ReplayCommand) Synopsis() string {
+	return "Apply recorded binlog entries to a MySQL server"
+}
+
+func (c *ReplayCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetNone),
+		complete.Flags{
+			"-host":        complete.PredictAnything,
+			"-port":        complete.PredictAnything,
+			"-user":        complete.PredictAnything,
+			"-password":    complete.PredictAnything,
+			"-dtle-schema": complete.PredictAnything,
+			"-log-level":   complete.PredictSet("DEBUG", "INFO", "WARN", "ERROR"),
+		})
+}
+
+func (c *ReplayCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *ReplayCommand) Run(args []string) int {
+	var logLevel string
+	conn := umconf.ConnectionConfig{}
+
+	flags := c.Meta.FlagSet("replay", FlagSetNone)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&conn.Host, "host", "127.0.0.1", "")
+	flags.IntVar(&conn.Port, "port", 3306, "")
+	flags.StringVar(&conn.User, "user", "root", "")
+	flags.StringVar(&conn.Password, "password", "", "")
+	flags.StringVar(&g.DtleSchemaName, "dtle-schema", "dtle", "")
+	flags.StringVar(&logLevel, "log-level", "INFO", "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error opening fixture: %s", err))
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	cfg := &config.MySQLDriverConfig{ConnectionConfig: &conn}
+	logger := ulog.New(os.Stderr, ulog.ParseLevel(logLevel))
+	result, err := mysql.ReplayFixture(r, cfg, logger)
+	if result != nil && c.formatted() {
+		if err := c.outputData(result); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	} else if result != nil {
+		c.Ui.Output(fmt.Sprintf("Replayed %d messages, %d binlog entries. Last GTID: %v",
+			result.Messages, result.Entries, result.Gtid))
+	}
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error replaying fixture: %s", err))
+		return 1
+	}
+	return 0
+}
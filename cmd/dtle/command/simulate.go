@@ -0,0 +1,188 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/g"
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+type SimulateCommand struct {
+	Meta
+	JobGetter
+}
+
+func (c *SimulateCommand) Help() string {
+	helpText := `
+Usage: dtle simulate [options] <fixture>
+
+  Apply the binlog entries recorded at <fixture> to a scratch MySQL server
+  with the applier of a job, and report the throughput, or the error
+  stopping it. This benchmarks a change of the config of the job, e.g. of
+  ParallelWorkers or TxBoundary, on the recorded workload, with neither the
+  source nor the target of the job.
+
+  The fixture is recorded by a job with RecordFile set on its Dest task, by
+  the same version of dtle. The scratch server needs the tables of the
+  entries, as on the target when the recording started. The GTIDs applied
+  by a previous simulation on it are forgotten first.
+
+  If the supplied path is "-", the fixture is read from stdin.
+
+Simulate Options:
+
+  -job=<path>
+    Jobfile whose Dest task config is simulated, but for its connection and
+    BlobOffload. Defaults to the default config.
+
+  -host=<host>
+    Host of the scratch MySQL server. Defaults to 127.0.0.1.
+
+  -port=<port>
+    Port of the scratch MySQL server. Defaults to 3306.
+
+  -user=<user>
+    Defaults to root.
+
+  -password=<password>
+
+  -dtle-schema=<schema>
+    The schema keeping the applied GTIDs on the scratch server. Defaults to
+    dtle.
+
+  -log-level=<level>
+    Defaults to INFO. DEBUG logs each entry.
+
+Output Options:
+
+  ` + outputOptionsUsage() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *SimulateCommand) Synopsis() string {
+	return "Benchmark the applier of a job on recorded binlog entries"
+}
+
+func (c *SimulateCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetNone),
+		complete.Flags{
+			"-job":         complete.PredictFiles("*"),
+			"-host":        complete.PredictAnything,
+			"-port":        complete.PredictAnything,
+			"-user":        complete.PredictAnything,
+			"-password":    complete.PredictAnything,
+			"-dtle-schema": complete.PredictAnything,
+			"-log-level":   complete.PredictSet("DEBUG", "INFO", "WARN", "ERROR"),
+		})
+}
+
+func (c *SimulateCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *SimulateCommand) Run(args []string) int {
+	var logLevel, jobPath string
+	conn := umconf.ConnectionConfig{}
+
+	flags := c.Meta.FlagSet("simulate", FlagSetNone)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&jobPath, "job", "", "")
+	flags.StringVar(&conn.Host, "host", "127.0.0.1", "")
+	flags.IntVar(&conn.Port, "port", 3306, "")
+	flags.StringVar(&conn.User, "user", "root", "")
+	flags.StringVar(&conn.Password, "password", "", "")
+	flags.StringVar(&g.DtleSchemaName, "dtle-schema", "dtle", "")
+	flags.StringVar(&logLevel, "log-level", "INFO", "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	cfg := &config.MySQLDriverConfig{}
+	if jobPath != "" {
+		job, err := c.JobGetter.ApiJob(jobPath)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error getting job struct: %s", err))
+			return 1
+		}
+		found := false
+		for _, task := range job.Tasks {
+			if task.Type != models.TaskTypeDest {
+				continue
+			}
+			if err := mapstructure.WeakDecode(task.Config, cfg); err != nil {
+				c.Ui.Error(fmt.Sprintf("Error decoding the config of the Dest task: %s", err))
+				return 1
+			}
+			found = true
+		}
+		if !found {
+			c.Ui.Error("Error: the job has no Dest task")
+			return 1
+		}
+	}
+	cfg.ConnectionConfig = &conn
+
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error opening fixture: %s", err))
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	logger := ulog.New(os.Stderr, ulog.ParseLevel(logLevel))
+	result, err := mysql.SimulateFixture(r, cfg, logger)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error simulating: %s", err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(result); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	} else {
+		c.Ui.Output(formatKV([]string{
+			fmt.Sprintf("Workers|%d", result.Workers),
+			fmt.Sprintf("Messages|%d", result.Messages),
+			fmt.Sprintf("Entries|%d", result.Entries),
+			fmt.Sprintf("Events|%d", result.Events),
+			fmt.Sprintf("Elapsed|%.3fs", result.ElapsedSeconds),
+			fmt.Sprintf("Entries/s|%.1f", result.EntriesPerSec),
+			fmt.Sprintf("Events/s|%.1f", result.EventsPerSec),
+			fmt.Sprintf("Last GTID|%s", result.Gtid),
+		}))
+	}
+	if result.Error != "" {
+		c.Ui.Error(fmt.Sprintf("Error applying the fixture: %s", result.Error))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete"
+
+	"github.com/actiontech/dtle/api"
+)
+
+type SkipTxCommand struct {
+	Meta
+}
+
+func (c *SkipTxCommand) Help() string {
+	helpText := `
+Usage: dtle job-skip-tx [options] <job>
+
+  Skip the next transaction of a running job which fails on the target,
+  instead of setting its checkpoint past it. The transaction skipped is
+  recorded on the target, in dtle.skipped_tx, with its tables, its rows and
+  the error, and in the events of the task. A skip is used once: arm another
+  one to skip another transaction.
+
+  With -list, list the transactions skipped instead.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Skip Options:
+
+  -gtid <uuid:number>
+    Skip this transaction only, e.g. as named by the error of the task.
+    Another transaction failing is not skipped.
+
+  -reason <text>
+    Why the transaction is skipped, recorded with it.
+
+  -list
+    List the latest transactions skipped on the target of the job.
+
+  -limit <n>
+    The number of transactions listed, 100 by default.
+
+  -yes
+    Automatic yes to prompts.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *SkipTxCommand) Synopsis() string {
+	return "Skip the next failing transaction of a job"
+}
+
+func (c *SkipTxCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-gtid":   complete.PredictAnything,
+			"-reason": complete.PredictAnything,
+			"-list":   complete.PredictNothing,
+			"-limit":  complete.PredictAnything,
+			"-yes":    complete.PredictNothing,
+		})
+}
+
+func (c *SkipTxCommand) AutocompleteArgs() complete.Predictor {
+	return c.predictJobs()
+}
+
+func (c *SkipTxCommand) Run(args []string) int {
+	var gtid, reason string
+	var list, autoYes bool
+	var limit int
+
+	flags := c.Meta.FlagSet("job-skip-tx", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&gtid, "gtid", "", "")
+	flags.StringVar(&reason, "reason", "", "")
+	flags.BoolVar(&list, "list", false, "")
+	flags.IntVar(&limit, "limit", 0, "")
+	flags.BoolVar(&autoYes, "yes", false, "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	args = flags.Args()
+	if len(args) != 1 || (list && (gtid != "" || reason != "")) {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+	jobID := args[0]
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	if list {
+		skipped, _, err := client.Jobs().SkippedTxs(jobID, limit, nil)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error listing the transactions skipped by job %q: %s", jobID, err))
+			return 1
+		}
+		if c.formatted() {
+			if err := c.outputData(skipped); err != nil {
+				c.Ui.Error(err.Error())
+				return 1
+			}
+			return 0
+		}
+		c.Ui.Output(formatSkippedTxs(skipped.Skipped))
+		return 0
+	}
+
+	if !autoYes {
+		tx := "the next transaction"
+		if gtid != "" {
+			tx = fmt.Sprintf("transaction %s", gtid)
+		}
+		question := fmt.Sprintf("Are you sure you want to skip %s of job %q if it fails? [y/N]", tx, jobID)
+		answer, err := c.Ui.Ask(question)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to parse answer: %v", err))
+			return 1
+		}
+		if answer != "y" {
+			c.Ui.Output("Cancelling the skip. For confirmation, an exact 'y' is required.")
+			return 0
+		}
+	}
+
+	req := &api.JobSkipTxRequest{Gtid: gtid, Reason: reason}
+	resp, _, err := client.Jobs().SkipTx(jobID, req, nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error skipping a transaction of job %q: %s", jobID, err))
+		return 1
+	}
+	c.Ui.Output(fmt.Sprintf("Skip %q armed. List the transaction skipped with -list.", resp.SkipID))
+	return 0
+}
+
+func formatSkippedTxs(skipped []*api.SkippedTxRecord) string {
+	if len(skipped) == 0 {
+		return "No transaction skipped"
+	}
+	out := []string{"Skipped At|Gtid|Binlog|Tables|Rows|Statements|Error|Reason"}
+	for _, s := range skipped {
+		out = append(out, fmt.Sprintf("%s|%s|%s:%d|%s|%d|%d|%s|%s",
+			s.SkippedAt, s.Gtid, s.LogFile, s.LogPos, strings.Join(s.Tables, ","),
+			s.Rows, s.Statements, limit(s.Error, 60), limit(s.Reason, 40)))
+	}
+	return formatList(out)
+}
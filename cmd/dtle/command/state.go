@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+type StateExportCommand struct {
+	Meta
+}
+
+func (c *StateExportCommand) Help() string {
+	helpText := `
+Usage: dtle state-export [options] [<path>]
+
+  Export the jobs, orders, evaluations, allocations, nodes and quotas of the
+  cluster as JSON to <path>, or to stdout if no path is given. The file is
+  imported with "dtle state-import" into a cluster of another version, whose
+  raft data is not compatible.
+
+  The file has the passwords of the jobs, and is written readable only by
+  its owner.
+
+General Options:
+
+  ` + generalOptionsUsage()
+	return strings.TrimSpace(helpText)
+}
+
+func (c *StateExportCommand) Synopsis() string {
+	return "Export the state of the cluster as JSON"
+}
+
+func (c *StateExportCommand) AutocompleteFlags() complete.Flags {
+	return c.Meta.AutocompleteFlags(FlagSetClient)
+}
+
+func (c *StateExportCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *StateExportCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("state-export", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) > 1 || (len(args) == 1 && c.formatted()) {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	state, err := client.Operator().StateExport(nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error exporting state: %s", err))
+		return 1
+	}
+	defer state.Close()
+
+	if c.formatted() {
+		// the state is JSON already, decoded for the template
+		var data interface{}
+		if err := json.NewDecoder(state).Decode(&data); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error reading state: %s", err))
+			return 1
+		}
+		if err := c.outputData(data); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
+
+	var out io.Writer = os.Stdout
+	if len(args) == 1 {
+		f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error opening %s: %s", args[0], err))
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	if _, err := io.Copy(out, state); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error writing state: %s", err))
+		return 1
+	}
+	if len(args) == 1 {
+		c.Ui.Output(fmt.Sprintf("Exported the state to %s", args[0]))
+	}
+	return 0
+}
+
+type StateImportCommand struct {
+	Meta
+}
+
+func (c *StateImportCommand) Help() string {
+	helpText := `
+Usage: dtle state-import [options] <path>
+
+  Import the state exported by "dtle state-export" at <path> into the
+  cluster. If the supplied path is "-", the state is read from stdin.
+
+  The cluster is expected to be new, with the agents of the exporting
+  cluster stopped. The imported nodes are down until their agents join
+  the cluster.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Import Options:
+
+  -force
+    Import even if the cluster has jobs. The jobs of the same IDs are
+    replaced.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *StateImportCommand) Synopsis() string {
+	return "Import the state exported from another cluster"
+}
+
+func (c *StateImportCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-force": complete.PredictNothing,
+		})
+}
+
+func (c *StateImportCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *StateImportCommand) Run(args []string) int {
+	var force bool
+
+	flags := c.Meta.FlagSet("state-import", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.BoolVar(&force, "force", false, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error opening %s: %s", args[0], err))
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	resp, err := client.Operator().StateImport(in, force, nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error importing state: %s", err))
+		return 1
+	}
+	if c.formatted() {
+		if err := c.outputData(resp); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
+	c.Ui.Output(fmt.Sprintf("Imported %d jobs, %d orders, %d evaluations, %d allocations, %d nodes and %d quotas",
+		resp.Jobs, resp.Orders, resp.Evals, resp.Allocs, resp.Nodes, resp.Quotas))
+	return 0
+}
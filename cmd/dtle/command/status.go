@@ -11,6 +11,8 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/posener/complete"
+
 	"github.com/actiontech/dtle/api"
 )
 
@@ -50,6 +52,12 @@ Status Options:
 
   -verbose
     Display full information.
+
+  -filter <expr>
+    Only list the jobs matching the filter, e.g. "meta.team==payments",
+    "status!=dead", or "meta.env" for the jobs with an env label. The
+    filters are on the meta, name, namespace, owner, status and type of the
+    jobs. It can be repeated, for the jobs matching all the filters.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -58,8 +66,24 @@ func (c *StatusCommand) Synopsis() string {
 	return "Display status information about jobs"
 }
 
+func (c *StatusCommand) AutocompleteFlags() complete.Flags {
+	return mergeAutocompleteFlags(c.Meta.AutocompleteFlags(FlagSetClient),
+		complete.Flags{
+			"-short":      complete.PredictNothing,
+			"-evals":      complete.PredictNothing,
+			"-all-allocs": complete.PredictNothing,
+			"-verbose":    complete.PredictNothing,
+			"-filter":     complete.PredictAnything,
+		})
+}
+
+func (c *StatusCommand) AutocompleteArgs() complete.Predictor {
+	return c.predictJobs()
+}
+
 func (c *StatusCommand) Run(args []string) int {
 	var short bool
+	var filters repeatedFlag
 
 	flags := c.Meta.FlagSet("status", FlagSetClient)
 	flags.Usage = func() { c.Ui.Output(c.Help()) }
@@ -67,6 +91,7 @@ func (c *StatusCommand) Run(args []string) int {
 	flags.BoolVar(&c.evals, "evals", false, "")
 	flags.BoolVar(&c.allAllocs, "all-allocs", false, "")
 	flags.BoolVar(&c.verbose, "verbose", false, "")
+	flags.Var(&filters, "filter", "")
 
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -91,11 +116,18 @@ func (c *StatusCommand) Run(args []string) int {
 
 	// Invoke list mode if no job ID.
 	if len(args) == 0 {
-		jobs, _, err := client.Jobs().List(nil)
+		jobs, _, err := client.Jobs().FilterList(filters, nil)
 		if err != nil {
 			c.Ui.Error(fmt.Sprintf("Error querying jobs: %s", err))
 			return 1
 		}
+		if c.formatted() {
+			if err := c.outputData(jobs); err != nil {
+				c.Ui.Error(err.Error())
+				return 1
+			}
+			return 0
+		}
 
 		if len(jobs) == 0 {
 			// No output if we have no jobs
@@ -118,6 +150,10 @@ func (c *StatusCommand) Run(args []string) int {
 		return 1
 	}
 	if len(jobs) > 1 && strings.TrimSpace(jobID) != jobs[0].ID {
+		if c.formatted() {
+			c.Ui.Error(fmt.Sprintf("Prefix %q matched multiple jobs", jobID))
+			return 1
+		}
 		c.Ui.Output(fmt.Sprintf("Prefix matched multiple jobs\n\n%s", createStatusListOutput(jobs)))
 		return 0
 	}
@@ -127,6 +163,13 @@ func (c *StatusCommand) Run(args []string) int {
 		c.Ui.Error(fmt.Sprintf("Error querying job: %s", err))
 		return 1
 	}
+	if c.formatted() {
+		if err := c.outputData(job); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
 
 	// Format the job info
 	basic := []string{
@@ -136,9 +179,51 @@ func (c *StatusCommand) Run(args []string) int {
 		fmt.Sprintf("Datacenters|%s", strings.Join(job.Datacenters, ",")),
 		fmt.Sprintf("Status|%s", *job.Status),
 	}
+	if job.SchedulerAlgorithm != "" {
+		basic = append(basic, fmt.Sprintf("Scheduler Algorithm|%s", job.SchedulerAlgorithm))
+	}
+	if len(job.Meta) > 0 {
+		var meta []string
+		for k, v := range job.Meta {
+			meta = append(meta, fmt.Sprintf("%s=%s", k, v))
+		}
+		sort.Strings(meta)
+		basic = append(basic, fmt.Sprintf("Meta|%s", strings.Join(meta, ",")))
+	}
 
 	c.Ui.Output(formatKV(basic))
 
+	if len(job.GroupStates) > 0 {
+		c.Ui.Output(c.Colorize().Color("\n[bold]Task Groups[reset]"))
+		groups := []string{"Name|Status|Tasks"}
+		for _, g := range job.GroupStates {
+			var tasks []string
+			for _, t := range job.Tasks {
+				if t.Group == g.Name {
+					tasks = append(tasks, t.Type)
+				}
+			}
+			groups = append(groups, fmt.Sprintf("%s|%s|%s", g.Name, g.Status, strings.Join(tasks, ",")))
+		}
+		c.Ui.Output(formatList(groups))
+	}
+
+	if f := job.Failure; f != nil {
+		c.Ui.Output(c.Colorize().Color("\n[bold][red]Failure[reset]"))
+		failure := []string{
+			fmt.Sprintf("Class|%s", f.Class),
+			fmt.Sprintf("Alloc ID|%s", limit(f.AllocID, c.length)),
+			fmt.Sprintf("Task|%s", f.Task),
+			fmt.Sprintf("Failures|%d", f.Failures),
+			fmt.Sprintf("Last Failure|%s", formatTime(f.Time)),
+			fmt.Sprintf("Error|%s", f.Error),
+		}
+		c.Ui.Output(formatKV(failure))
+		if f.Hint != "" {
+			c.Ui.Output(fmt.Sprintf("\nHint: %s", f.Hint))
+		}
+	}
+
 	// Exit early
 	if short {
 		return 0
@@ -313,3 +398,15 @@ func createStatusListOutput(jobs []*api.JobListStub) string {
 	}
 	return formatList(out)
 }
+
+// repeatedFlag collects the values of a flag given several times
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *repeatedFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
@@ -47,9 +47,13 @@ func realMain() int {
 		}
 	}
 
+	// completion of the commands, flags and IDs in bash and zsh is
+	// installed by "dtle -autocomplete-install"
 	c := &cli.CLI{
-		Args:     args,
-		HelpFunc: cli.BasicHelpFunc("Dtle"),
+		Name:         "dtle",
+		Args:         args,
+		HelpFunc:     cli.BasicHelpFunc("Dtle"),
+		Autocomplete: true,
 	}
 
 	meta := command.Meta{}
@@ -70,6 +74,16 @@ func realMain() int {
 				ShutdownCh: make(chan struct{}),
 			}, nil
 		},
+		"config-validate": func() (cli.Command, error) {
+			return &command.ConfigValidateCommand{
+				Meta: meta,
+			}, nil
+		},
+		"config-default": func() (cli.Command, error) {
+			return &command.ConfigDefaultCommand{
+				Meta: meta,
+			}, nil
+		},
 		/*"init": func() (cli.Command, error) {
 			return &command.InitCommand{
 				Meta: meta,
@@ -115,6 +129,86 @@ func realMain() int {
 				Meta: meta,
 			}, nil
 		},
+		"job-assess": func() (cli.Command, error) {
+			return &command.AssessCommand{
+				Meta: meta,
+			}, nil
+		},
+		"job-convert": func() (cli.Command, error) {
+			return &command.ConvertCommand{
+				Meta: meta,
+			}, nil
+		},
+		"job-bulk": func() (cli.Command, error) {
+			return &command.BulkCommand{
+				Meta: meta,
+			}, nil
+		},
+		"job-clone": func() (cli.Command, error) {
+			return &command.CloneCommand{
+				Meta: meta,
+			}, nil
+		},
+		"job-checkpoint": func() (cli.Command, error) {
+			return &command.CheckpointCommand{
+				Meta: meta,
+			}, nil
+		},
+		"job-skip-tx": func() (cli.Command, error) {
+			return &command.SkipTxCommand{
+				Meta: meta,
+			}, nil
+		},
+		"job-reconcile": func() (cli.Command, error) {
+			return &command.ReconcileCommand{
+				Meta: meta,
+			}, nil
+		},
+		"plan-stats": func() (cli.Command, error) {
+			return &command.PlanStatsCommand{
+				Meta: meta,
+			}, nil
+		},
+		"quota-apply": func() (cli.Command, error) {
+			return &command.QuotaApplyCommand{
+				Meta: meta,
+			}, nil
+		},
+		"quota-delete": func() (cli.Command, error) {
+			return &command.QuotaDeleteCommand{
+				Meta: meta,
+			}, nil
+		},
+		"quota-list": func() (cli.Command, error) {
+			return &command.QuotaListCommand{
+				Meta: meta,
+			}, nil
+		},
+		"replay": func() (cli.Command, error) {
+			return &command.ReplayCommand{
+				Meta: meta,
+			}, nil
+		},
+		"simulate": func() (cli.Command, error) {
+			return &command.SimulateCommand{
+				Meta: meta,
+			}, nil
+		},
+		"benchmark": func() (cli.Command, error) {
+			return &command.BenchmarkCommand{
+				Meta: meta,
+			}, nil
+		},
+		"state-export": func() (cli.Command, error) {
+			return &command.StateExportCommand{
+				Meta: meta,
+			}, nil
+		},
+		"state-import": func() (cli.Command, error) {
+			return &command.StateImportCommand{
+				Meta: meta,
+			}, nil
+		},
 		"version": func() (cli.Command, error) {
 			return &command.VersionCommand{
 				Version: Version,
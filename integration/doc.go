@@ -0,0 +1,15 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+// Package integration tests dtle end to end, against MySQL and MariaDB
+// containers. The tests need docker and are only built with the
+// integration tag:
+//
+//	go test -tags integration -v ./integration/
+//
+// A dtle binary is built and run in dev mode, unless DTLE_IT_BINARY names
+// one. DTLE_IT_MATRIX limits the pairs of images, e.g. "mysql:5.7/mysql:5.7".
+package integration
@@ -0,0 +1,132 @@
+//go:build integration
+// +build integration
+
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package integration
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const (
+	rootPassword = "rootroot"
+	// a MySQL container takes long to initialize its data dir
+	containerReadyTimeout = 3 * time.Minute
+)
+
+// container is a MySQL or MariaDB container, run by the docker CLI.
+type container struct {
+	image string
+	id    string
+	host  string
+	port  int
+	db    *gosql.DB
+}
+
+func docker(args ...string) (string, error) {
+	out, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("docker %v: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// serverArgs are the options of mysqld for the job to replicate from and to
+// the server: row based binlog with GTID.
+func serverArgs(image string, serverID int) []string {
+	args := []string{
+		fmt.Sprintf("--server-id=%d", serverID),
+		"--log-bin=mysql-bin",
+		"--binlog-format=ROW",
+		"--character-set-server=utf8mb4",
+	}
+	switch {
+	case strings.HasPrefix(image, "mariadb"):
+		// MariaDB has its own GTID, always on
+		return args
+	case strings.HasPrefix(image, "mysql:5.6"):
+		// GTID needs log-slave-updates on 5.6
+		args = append(args, "--log-slave-updates")
+	case strings.HasPrefix(image, "mysql:8"):
+		args = append(args, "--default-authentication-plugin=mysql_native_password")
+	}
+	return append(args, "--gtid-mode=ON", "--enforce-gtid-consistency")
+}
+
+// startContainer runs a container of the image on a random port, and waits
+// until the server accepts connections.
+func startContainer(image string, serverID int) (*container, error) {
+	args := append([]string{"run", "-d", "-P", "-e", "MYSQL_ROOT_PASSWORD=" + rootPassword, image},
+		serverArgs(image, serverID)...)
+	id, err := docker(args...)
+	if err != nil {
+		return nil, err
+	}
+	c := &container{image: image, id: id, host: "127.0.0.1"}
+
+	// e.g. "0.0.0.0:32768", and the same on IPv6
+	mapped, err := docker("port", id, "3306/tcp")
+	if err != nil {
+		c.remove()
+		return nil, err
+	}
+	_, port, err := net.SplitHostPort(strings.Split(mapped, "\n")[0])
+	if err == nil {
+		_, err = fmt.Sscanf(port, "%d", &c.port)
+	}
+	if err != nil {
+		c.remove()
+		return nil, fmt.Errorf("port of %v: %q: %v", image, mapped, err)
+	}
+
+	c.db, err = gosql.Open("mysql", fmt.Sprintf("root:%s@tcp(%s:%d)/?multiStatements=true",
+		rootPassword, c.host, c.port))
+	if err != nil {
+		c.remove()
+		return nil, err
+	}
+	deadline := time.Now().Add(containerReadyTimeout)
+	for {
+		if err = c.db.Ping(); err == nil {
+			return c, nil
+		}
+		if time.Now().After(deadline) {
+			c.remove()
+			return nil, fmt.Errorf("%v is not ready in %v: %v", image, containerReadyTimeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (c *container) String() string {
+	return fmt.Sprintf("%v(%v:%d)", c.image, c.host, c.port)
+}
+
+// exec runs the statements one by one.
+func (c *container) exec(statements ...string) error {
+	for _, s := range statements {
+		if _, err := c.db.Exec(s); err != nil {
+			return fmt.Errorf("%v: %v: %v", c, s, err)
+		}
+	}
+	return nil
+}
+
+func (c *container) remove() {
+	if c.db != nil {
+		c.db.Close()
+	}
+	docker("rm", "-f", "-v", c.id)
+}
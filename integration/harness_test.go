@@ -0,0 +1,279 @@
+//go:build integration
+// +build integration
+
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package integration
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/api"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const agentReadyTimeout = time.Minute
+
+// client of the dtle agent run in dev mode by TestMain
+var client *api.Client
+
+func TestMain(m *testing.M) {
+	if _, err := docker("version"); err != nil {
+		fmt.Fprintf(os.Stderr, "skipping the integration tests, docker is not available: %v\n", err)
+		os.Exit(0)
+	}
+
+	dir, err := ioutil.TempDir("", "dtle-it")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	agent, err := startAgent(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+
+	agent.Process.Signal(os.Interrupt)
+	agent.Wait()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startAgent builds dtle unless DTLE_IT_BINARY is set, and runs it in dev
+// mode until a node is ready. The log is written to dir.
+func startAgent(dir string) (*exec.Cmd, error) {
+	binary := os.Getenv("DTLE_IT_BINARY")
+	if binary == "" {
+		binary = filepath.Join(dir, "dtle")
+		build := exec.Command("go", "build", "-o", binary, "github.com/actiontech/dtle/cmd/dtle")
+		if out, err := build.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("building dtle: %v: %s", err, out)
+		}
+	}
+
+	logFile, err := os.Create(filepath.Join(dir, "dtle.log"))
+	if err != nil {
+		return nil, err
+	}
+	agent := exec.Command(binary, "server", "-dev")
+	agent.Dir = dir
+	agent.Stdout = logFile
+	agent.Stderr = logFile
+	if err := agent.Start(); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	// the file is kept open by the agent
+	logFile.Close()
+
+	client, err = api.NewClient(api.DefaultConfig())
+	if err != nil {
+		agent.Process.Kill()
+		return nil, err
+	}
+	deadline := time.Now().Add(agentReadyTimeout)
+	for {
+		nodes, _, err := client.Nodes().List(nil)
+		if err == nil && len(nodes) > 0 && nodes[0].Status == models.NodeStatusReady {
+			return agent, nil
+		}
+		if time.Now().After(deadline) {
+			agent.Process.Kill()
+			return nil, fmt.Errorf("dtle is not ready in %v: %v. See %v", agentReadyTimeout, err, logFile.Name())
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// registerJob registers a job replicating a database.
+func registerJob(t *testing.T, src, dest *container, database string) string {
+	connection := func(c *container) map[string]interface{} {
+		return map[string]interface{}{
+			"Host":     c.host,
+			"Port":     c.port,
+			"User":     "root",
+			"Password": rootPassword,
+		}
+	}
+	id := fmt.Sprintf("it-%v-%d", database, time.Now().UnixNano())
+	jobType := models.JobTypeSync
+	job := &api.Job{
+		ID:   &id,
+		Name: &id,
+		Type: &jobType,
+		Tasks: []*api.Task{
+			{
+				Type:   models.TaskTypeSrc,
+				Driver: models.TaskDriverMySQL,
+				Config: map[string]interface{}{
+					"ReplicateDoDb":    []map[string]interface{}{{"TableSchema": database}},
+					"ConnectionConfig": connection(src),
+				},
+			},
+			{
+				Type:   models.TaskTypeDest,
+				Driver: models.TaskDriverMySQL,
+				Config: map[string]interface{}{
+					"ConnectionConfig": connection(dest),
+				},
+			},
+		},
+	}
+	if _, _, err := client.Jobs().Register(job, nil); err != nil {
+		t.Fatalf("registering job %v: %v", id, err)
+	}
+	return id
+}
+
+func deregisterJob(t *testing.T, jobID string) {
+	if _, _, err := client.Jobs().Deregister(jobID, nil); err != nil {
+		t.Errorf("deregistering job %v: %v", jobID, err)
+	}
+}
+
+// checkJobRunning fails the test if a task of the job failed.
+func checkJobRunning(t *testing.T, jobID string) {
+	allocs, _, err := client.Jobs().Allocations(jobID, true, nil)
+	if err != nil {
+		t.Fatalf("allocations of job %v: %v", jobID, err)
+	}
+	for _, alloc := range allocs {
+		if alloc.ClientStatus == models.AllocClientStatusFailed {
+			t.Fatalf("task %v of job %v failed: %v", alloc.Task, jobID, alloc.ClientDescription)
+		}
+	}
+}
+
+// tableRows returns the rows of a table in primary key order, NULL as "<nil>".
+func tableRows(db *gosql.DB, schema, table string) ([][]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM `%s`.`%s` ORDER BY 1", schema, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result [][]string
+	for rows.Next() {
+		values := make([]gosql.RawBytes, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(columns))
+		for i, v := range values {
+			if v == nil {
+				row[i] = "<nil>"
+			} else {
+				row[i] = string(v)
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// tableNames returns the base tables of a schema.
+func tableNames(db *gosql.DB, schema string) ([]string, error) {
+	rows, err := db.Query(`SELECT table_name FROM information_schema.tables
+		WHERE table_schema = ? AND table_type = 'BASE TABLE' ORDER BY table_name`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// diffSchema compares the tables and the rows of a schema on both servers.
+// It returns "" if they are equal.
+func diffSchema(src, dest *container, schema string) (string, error) {
+	srcTables, err := tableNames(src.db, schema)
+	if err != nil {
+		return "", err
+	}
+	destTables, err := tableNames(dest.db, schema)
+	if err != nil {
+		return "", err
+	}
+	if !reflect.DeepEqual(srcTables, destTables) {
+		return fmt.Sprintf("tables %v, want %v", destTables, srcTables), nil
+	}
+	for _, table := range srcTables {
+		srcRows, err := tableRows(src.db, schema, table)
+		if err != nil {
+			return "", err
+		}
+		destRows, err := tableRows(dest.db, schema, table)
+		if err != nil {
+			// e.g. a column is not added yet
+			return fmt.Sprintf("%v: %v", table, err), nil
+		}
+		if !reflect.DeepEqual(srcRows, destRows) {
+			return fmt.Sprintf("%v: %d rows %v, want %d rows %v",
+				table, len(destRows), abbreviate(destRows), len(srcRows), abbreviate(srcRows)), nil
+		}
+	}
+	return "", nil
+}
+
+func abbreviate(rows [][]string) string {
+	const max = 5
+	var s []string
+	for i, row := range rows {
+		if i == max {
+			s = append(s, "...")
+			break
+		}
+		s = append(s, strings.Join(row, ","))
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+// waitForSchema waits until the schema is the same on both servers.
+func waitForSchema(t *testing.T, jobID string, src, dest *container, schema string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		diff, err := diffSchema(src, dest, schema)
+		if err != nil {
+			t.Fatalf("comparing %v: %v", schema, err)
+		}
+		if diff == "" {
+			return
+		}
+		checkJobRunning(t, jobID)
+		if time.Now().After(deadline) {
+			t.Fatalf("%v differs on %v after %v: %v", schema, dest, timeout, diff)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,128 @@
+//go:build integration
+// +build integration
+
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package integration
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// defaultMatrix is the pairs of source and target images. MariaDB is only a
+// target, its GTID is not read by the extractor.
+var defaultMatrix = [][2]string{
+	{"mysql:5.6", "mysql:5.6"},
+	{"mysql:5.7", "mysql:5.7"},
+	{"mysql:8.0", "mysql:8.0"},
+	{"mysql:5.7", "mysql:8.0"},
+	{"mysql:5.7", "mariadb:10.3"},
+}
+
+const syncTimeout = 2 * time.Minute
+
+// matrix is defaultMatrix, or the pairs of DTLE_IT_MATRIX, e.g.
+// "mysql:5.7/mysql:8.0,mysql:8.0/mysql:8.0".
+func matrix(t *testing.T) [][2]string {
+	env := os.Getenv("DTLE_IT_MATRIX")
+	if env == "" {
+		return defaultMatrix
+	}
+	var m [][2]string
+	for _, pair := range strings.Split(env, ",") {
+		images := strings.Split(strings.TrimSpace(pair), "/")
+		if len(images) != 2 {
+			t.Fatalf("bad pair %q of DTLE_IT_MATRIX, want source/target", pair)
+		}
+		m = append(m, [2]string{images[0], images[1]})
+	}
+	return m
+}
+
+// TestReplication runs a job through its full copy, incremental DML and DDL,
+// and compares the rows after each phase.
+func TestReplication(t *testing.T) {
+	for _, pair := range matrix(t) {
+		pair := pair
+		t.Run(pair[0]+"/"+pair[1], func(t *testing.T) {
+			testReplication(t, pair[0], pair[1])
+		})
+	}
+}
+
+func testReplication(t *testing.T, srcImage, destImage string) {
+	const schema = "it"
+
+	src, err := startContainer(srcImage, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.remove()
+	dest, err := startContainer(destImage, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dest.remove()
+
+	// copied by the full copy
+	err = src.exec(
+		"CREATE DATABASE "+schema,
+		`CREATE TABLE it.t1 (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			name VARCHAR(64) CHARACTER SET utf8mb4,
+			amount DECIMAL(10,2),
+			created DATETIME(3),
+			data BLOB
+		)`,
+		`CREATE TABLE it.t2 (a BIGINT UNSIGNED, b CHAR(8), PRIMARY KEY (a, b))`,
+		`INSERT INTO it.t1 (name, amount, created, data) VALUES
+			('alice', 1.50, '2018-01-02 03:04:05.678', x'00ff'),
+			('bob', NULL, NULL, NULL),
+			('数据', -99999999.99, '1970-01-01 00:00:01', '')`,
+		`INSERT INTO it.t2 VALUES (18446744073709551615, 'max'), (0, '')`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := src.exec("INSERT INTO it.t1 (name) SELECT CONCAT(name, '+') FROM it.t1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobID := registerJob(t, src, dest, schema)
+	defer deregisterJob(t, jobID)
+	waitForSchema(t, jobID, src, dest, schema, syncTimeout)
+
+	// incremental DML
+	err = src.exec(
+		"INSERT INTO it.t1 (name, amount) VALUES ('carol', 3.25)",
+		"UPDATE it.t1 SET amount = amount + 1 WHERE id % 3 = 0",
+		"UPDATE it.t2 SET b = 'min' WHERE a = 0",
+		"DELETE FROM it.t1 WHERE id % 7 = 0",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForSchema(t, jobID, src, dest, schema, syncTimeout)
+
+	// DDL, and DML on the changed tables
+	err = src.exec(
+		"ALTER TABLE it.t1 ADD COLUMN note VARCHAR(16) DEFAULT 'n'",
+		"CREATE TABLE it.t3 (id INT PRIMARY KEY, v VARCHAR(32))",
+		"INSERT INTO it.t3 VALUES (1, NULL), (2, 'two')",
+		"UPDATE it.t1 SET note = 'changed' WHERE id < 5",
+		"DROP TABLE it.t2",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForSchema(t, jobID, src, dest, schema, syncTimeout)
+}
@@ -0,0 +1,273 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+// Package chaos injects faults into the running jobs, to test how they
+// recover. It is only enabled in builds with the "chaos" tag, e.g. by
+// `make build-chaos`. Otherwise the hooks do nothing.
+//
+// The faults are injected into the tasks run by the local agent, through
+// the /v1/chaos endpoint of the agent.
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Fault types
+const (
+	// FaultDrop drops the messages received by the applier, unacked.
+	FaultDrop = "drop"
+	// FaultDelay sleeps for Delay before each transaction is applied.
+	FaultDelay = "delay"
+	// FaultKill fails the running tasks at once, as if the driver crashed.
+	// It is not kept as a fault.
+	FaultKill = "kill"
+	// FaultCorrupt replaces the checkpoint (the GTID set) reported by the
+	// applier with Value.
+	FaultCorrupt = "corrupt"
+)
+
+const defaultCorruptValue = "corrupted"
+
+var (
+	ErrDisabled = errors.New("chaos: fault injection is not built in, use a build with the chaos tag")
+	// ErrKilled is the error of a task failed by FaultKill.
+	ErrKilled = errors.New("chaos: killed by fault injection")
+)
+
+// Fault is an injected fault.
+type Fault struct {
+	ID   string
+	Type string
+	// JobID limits the fault to a job. All jobs if empty.
+	JobID string
+	// TaskType limits FaultKill to the Src or the Dest task. Both if empty.
+	TaskType string
+	// Probability of the fault at each occurrence. Always if 0.
+	Probability float64
+	// Delay of FaultDelay, e.g. "500ms".
+	Delay string
+	// Value of FaultCorrupt, "corrupted" if empty.
+	Value string
+	// Count is the number of occurrences before the fault is cleared.
+	// Unlimited if 0.
+	Count int
+	// Hits is the number of occurrences so far.
+	Hits int
+
+	delay time.Duration
+}
+
+func (f *Fault) validate() error {
+	switch f.Type {
+	case FaultDrop, FaultKill:
+	case FaultDelay:
+		d, err := time.ParseDuration(f.Delay)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("chaos: bad Delay %q", f.Delay)
+		}
+		f.delay = d
+	case FaultCorrupt:
+		if f.Value == "" {
+			f.Value = defaultCorruptValue
+		}
+	default:
+		return fmt.Errorf("chaos: unknown fault type %q", f.Type)
+	}
+	if f.Probability < 0 || f.Probability > 1 {
+		return fmt.Errorf("chaos: Probability %v is not in [0, 1]", f.Probability)
+	}
+	if f.Count < 0 {
+		return fmt.Errorf("chaos: negative Count %v", f.Count)
+	}
+	return nil
+}
+
+// task is a running task, which can be killed.
+type task struct {
+	jobID    string
+	taskType string
+	kill     func()
+}
+
+type registry struct {
+	sync.Mutex
+	lastID int
+	faults []*Fault
+	tasks  map[*task]struct{}
+	rand   *rand.Rand
+}
+
+func newRegistry(seed int64) *registry {
+	return &registry{
+		tasks: make(map[*task]struct{}),
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// inject adds a fault, or kills the matching tasks for FaultKill.
+func (r *registry) inject(f *Fault) (killed int, err error) {
+	if err := f.validate(); err != nil {
+		return 0, err
+	}
+	r.Lock()
+	if f.Type == FaultKill {
+		var kills []func()
+		for t := range r.tasks {
+			if (f.JobID == "" || f.JobID == t.jobID) && (f.TaskType == "" || f.TaskType == t.taskType) {
+				kills = append(kills, t.kill)
+				delete(r.tasks, t)
+			}
+		}
+		r.Unlock()
+		// a task may block on its wait channel while failing
+		for _, kill := range kills {
+			go kill()
+		}
+		return len(kills), nil
+	}
+	r.lastID++
+	f.ID = strconv.Itoa(r.lastID)
+	f.Hits = 0
+	r.faults = append(r.faults, f)
+	r.Unlock()
+	return 0, nil
+}
+
+func (r *registry) list() []*Fault {
+	r.Lock()
+	defer r.Unlock()
+	faults := make([]*Fault, 0, len(r.faults))
+	for _, f := range r.faults {
+		c := *f
+		faults = append(faults, &c)
+	}
+	return faults
+}
+
+// clear removes a fault by ID, or all of them if id is empty.
+func (r *registry) clear(id string) bool {
+	r.Lock()
+	defer r.Unlock()
+	if id == "" {
+		r.faults = nil
+		return true
+	}
+	for i, f := range r.faults {
+		if f.ID == id {
+			r.faults = append(r.faults[:i], r.faults[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// hit returns a copy of the first fault of the type on the job which occurs
+// this time, or nil.
+func (r *registry) hit(faultType, jobID string) *Fault {
+	r.Lock()
+	defer r.Unlock()
+	for i, f := range r.faults {
+		if f.Type != faultType || (f.JobID != "" && f.JobID != jobID) {
+			continue
+		}
+		if f.Probability > 0 && r.rand.Float64() >= f.Probability {
+			continue
+		}
+		f.Hits++
+		c := *f
+		if f.Count > 0 && f.Hits >= f.Count {
+			r.faults = append(r.faults[:i], r.faults[i+1:]...)
+		}
+		return &c
+	}
+	return nil
+}
+
+func (r *registry) register(jobID, taskType string, kill func()) func() {
+	t := &task{jobID: jobID, taskType: taskType, kill: kill}
+	r.Lock()
+	r.tasks[t] = struct{}{}
+	r.Unlock()
+	return func() {
+		r.Lock()
+		delete(r.tasks, t)
+		r.Unlock()
+	}
+}
+
+var defaultRegistry = newRegistry(time.Now().UnixNano())
+
+// Inject injects a fault. For FaultKill, it returns the number of tasks
+// killed.
+func Inject(f *Fault) (killed int, err error) {
+	if !Enabled {
+		return 0, ErrDisabled
+	}
+	return defaultRegistry.inject(f)
+}
+
+// Faults returns the injected faults.
+func Faults() []*Fault {
+	if !Enabled {
+		return nil
+	}
+	return defaultRegistry.list()
+}
+
+// Clear clears a fault by ID, or all faults if id is empty. It returns false
+// if there is no such fault.
+func Clear(id string) bool {
+	if !Enabled {
+		return false
+	}
+	return defaultRegistry.clear(id)
+}
+
+// DropMessage tells if a message received for the job is to be dropped.
+func DropMessage(jobID string) bool {
+	if !Enabled {
+		return false
+	}
+	return defaultRegistry.hit(FaultDrop, jobID) != nil
+}
+
+// DelayApply sleeps before a transaction of the job is applied, if delayed.
+func DelayApply(jobID string) {
+	if !Enabled {
+		return
+	}
+	if f := defaultRegistry.hit(FaultDelay, jobID); f != nil {
+		time.Sleep(f.delay)
+	}
+}
+
+// Checkpoint returns the checkpoint of the job to report, which is gtid
+// unless corrupted.
+func Checkpoint(jobID, gtid string) string {
+	if !Enabled {
+		return gtid
+	}
+	if f := defaultRegistry.hit(FaultCorrupt, jobID); f != nil {
+		return f.Value
+	}
+	return gtid
+}
+
+// Register makes a running task killable by FaultKill. kill fails the task
+// through its usual error path. The returned function unregisters it, once
+// the task stopped.
+func Register(jobID, taskType string, kill func()) (unregister func()) {
+	if !Enabled {
+		return func() {}
+	}
+	return defaultRegistry.register(jobID, taskType, kill)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package chaos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := newRegistry(1)
+
+	for _, f := range []*Fault{
+		{Type: "unknown"},
+		{Type: FaultDelay},
+		{Type: FaultDrop, Probability: 2},
+		{Type: FaultDrop, Count: -1},
+	} {
+		if _, err := r.inject(f); err == nil {
+			t.Errorf("inject(%+v) is accepted", f)
+		}
+	}
+
+	if _, err := r.inject(&Fault{Type: FaultDrop, JobID: "job1", Count: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if r.hit(FaultDrop, "job2") != nil {
+		t.Errorf("a fault of job1 hit job2")
+	}
+	if r.hit(FaultDelay, "job1") != nil {
+		t.Errorf("a drop fault hit as a delay")
+	}
+	for i := 1; i <= 2; i++ {
+		if f := r.hit(FaultDrop, "job1"); f == nil || f.Hits != i {
+			t.Fatalf("hit %v = %+v", i, f)
+		}
+	}
+	if r.hit(FaultDrop, "job1") != nil || len(r.list()) != 0 {
+		t.Errorf("the fault is not cleared after Count hits")
+	}
+
+	if _, err := r.inject(&Fault{Type: FaultDelay, Delay: "10ms"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.inject(&Fault{Type: FaultCorrupt}); err != nil {
+		t.Fatal(err)
+	}
+	if f := r.hit(FaultDelay, "any"); f == nil || f.delay != 10*time.Millisecond {
+		t.Errorf("delay = %+v", f)
+	}
+	if f := r.hit(FaultCorrupt, "any"); f == nil || f.Value != defaultCorruptValue {
+		t.Errorf("corrupt = %+v", f)
+	}
+	faults := r.list()
+	if len(faults) != 2 || faults[0].ID != "2" || faults[1].ID != "3" {
+		t.Fatalf("faults = %+v", faults)
+	}
+	if r.clear("9") {
+		t.Errorf("cleared an unknown fault")
+	}
+	if !r.clear("2") || len(r.list()) != 1 {
+		t.Errorf("fault 2 is not cleared")
+	}
+	r.clear("")
+	if len(r.list()) != 0 {
+		t.Errorf("faults are not cleared")
+	}
+
+	if _, err := r.inject(&Fault{Type: FaultDrop, Probability: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	hits := 0
+	for i := 0; i < 1000; i++ {
+		if r.hit(FaultDrop, "job1") != nil {
+			hits++
+		}
+	}
+	if hits < 400 || hits > 600 {
+		t.Errorf("%v hits of 1000 with probability 0.5", hits)
+	}
+}
+
+func TestRegistry_kill(t *testing.T) {
+	r := newRegistry(1)
+	killed := make(chan string, 3)
+	kill := func(name string) func() {
+		return func() { killed <- name }
+	}
+	r.register("job1", "Src", kill("job1 Src"))
+	unregister := r.register("job1", "Dest", kill("job1 Dest"))
+	r.register("job2", "Src", kill("job2 Src"))
+
+	unregister()
+	if n, err := r.inject(&Fault{Type: FaultKill, JobID: "job1"}); err != nil || n != 1 {
+		t.Fatalf("kill job1 = %v, %v", n, err)
+	}
+	if name := <-killed; name != "job1 Src" {
+		t.Errorf("killed %v", name)
+	}
+	if n, _ := r.inject(&Fault{Type: FaultKill, JobID: "job1"}); n != 0 {
+		t.Errorf("killed %v tasks twice", n)
+	}
+	if n, _ := r.inject(&Fault{Type: FaultKill, TaskType: "Src"}); n != 1 {
+		t.Errorf("kill Src tasks = %v", n)
+	}
+	if name := <-killed; name != "job2 Src" {
+		t.Errorf("killed %v", name)
+	}
+	if len(r.list()) != 0 {
+		t.Errorf("a kill fault is kept")
+	}
+}
+
+func TestHooksDisabled(t *testing.T) {
+	if Enabled {
+		t.Skip("built with the chaos tag")
+	}
+	if _, err := Inject(&Fault{Type: FaultDrop}); err != ErrDisabled {
+		t.Errorf("Inject() = %v", err)
+	}
+	if DropMessage("job1") || Checkpoint("job1", "a:1-2") != "a:1-2" {
+		t.Errorf("hooks are not no-ops")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build chaos
+// +build chaos
+
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package chaos
+
+// Enabled tells if fault injection is built in.
+const Enabled = true
@@ -8,18 +8,28 @@ package client
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
 
+	"github.com/actiontech/dtle/internal/client/allocdir"
 	"github.com/actiontech/dtle/internal/config"
 	log "github.com/actiontech/dtle/internal/logger"
 	"github.com/actiontech/dtle/internal/models"
 )
 
+const (
+	// diskQuotaCheckInterval is how often the size of an alloc dir is
+	// checked against its quota
+	diskQuotaCheckInterval = 30 * time.Second
+
+	// bytesPerMB converts the disk quotas to bytes
+	bytesPerMB = 1024 * 1024
+)
+
 // AllocStateUpdater is used to update the status of an allocation
 type AllocStateUpdater func(alloc *models.Allocation)
 
@@ -30,6 +40,7 @@ type AllocStatsReporter interface {
 // Allocator is used to wrap an allocation and provide the execution context.
 type Allocator struct {
 	config  *config.ClientConfig
+	stateDB *stateDB
 	updater AllocStateUpdater
 	logger  *log.Logger
 
@@ -45,6 +56,14 @@ type Allocator struct {
 	restored   map[string]struct{}
 	taskLock   sync.RWMutex
 
+	// restoredTask is the task as saved before the agent restarted, with
+	// the checkpoint to resume from
+	restoredTask *models.Task
+
+	// allocDir is the working directory of the tasks, nil if the agent has
+	// no alloc dir
+	allocDir *allocdir.AllocDir
+
 	taskStatusLock sync.RWMutex
 
 	updateCh    chan *models.Allocation
@@ -65,13 +84,15 @@ type allocatorState struct {
 	Alloc                  *models.Allocation
 	AllocClientStatus      string
 	AllocClientDescription string
+	TaskStates             map[string]*models.TaskState
 }
 
 // NewAllocator is used to create a new allocation context
-func NewAllocator(logger *log.Logger, config *config.ClientConfig, updater AllocStateUpdater,
+func NewAllocator(logger *log.Logger, config *config.ClientConfig, stateDB *stateDB, updater AllocStateUpdater,
 	alloc *models.Allocation, workUpdates chan *models.TaskUpdate) *Allocator {
 	ar := &Allocator{
 		config:      config,
+		stateDB:     stateDB,
 		updater:     updater,
 		logger:      logger,
 		alloc:       alloc,
@@ -100,9 +121,9 @@ func (r *Allocator) stateFilePath() string {
 // is snapshotted. If fullSync is marked as true, we snapshot
 // all the Task Runners associated with the Alloc
 func (r *Allocator) SaveState() error {
-	/*if err := r.saveAllocatorState(); err != nil {
+	if err := r.saveAllocatorState(); err != nil {
 		return err
-	}*/
+	}
 
 	// Save store for each task
 	runners := r.getWorkers()
@@ -116,6 +137,9 @@ func (r *Allocator) SaveState() error {
 }
 
 func (r *Allocator) saveAllocatorState() error {
+	if r.stateDB == nil {
+		return nil
+	}
 	r.persistLock.Lock()
 	defer r.persistLock.Unlock()
 
@@ -132,8 +156,12 @@ func (r *Allocator) saveAllocatorState() error {
 		Alloc:                  alloc,
 		AllocClientStatus:      allocClientStatus,
 		AllocClientDescription: allocClientDescription,
+		TaskStates:             alloc.TaskStates,
+	}
+	if err := r.stateDB.PutAlloc(alloc.ID, &snap); err != nil {
+		return fmt.Errorf("failed to save state for alloc %s: %v", alloc.ID, err)
 	}
-	return persistState(r.stateFilePath(), &snap)
+	return nil
 }
 
 func (r *Allocator) saveWorkerState(tr *Worker) error {
@@ -141,12 +169,43 @@ func (r *Allocator) saveWorkerState(tr *Worker) error {
 		return fmt.Errorf("failed to save state for alloc %s task '%s': %v",
 			r.alloc.ID, tr.task.Type, err)
 	}
+	if r.stateDB == nil {
+		return nil
+	}
+	if err := r.stateDB.PutTask(tr.alloc.ID, tr.task.Type, tr.state()); err != nil {
+		return fmt.Errorf("failed to save state for alloc %s task '%s': %v",
+			tr.alloc.ID, tr.task.Type, err)
+	}
 	return nil
 }
 
 // DestroyState is used to cleanup after ourselves
 func (r *Allocator) DestroyState() error {
-	return os.RemoveAll(filepath.Dir(r.stateFilePath()))
+	if r.stateDB == nil {
+		return nil
+	}
+	r.persistLock.Lock()
+	defer r.persistLock.Unlock()
+	return r.stateDB.DeleteAlloc(r.alloc.ID)
+}
+
+// restore sets the state saved before the agent restarted, for Run to resume
+// the task from its checkpoint.
+func (r *Allocator) restore(saved *savedAlloc) {
+	r.allocClientStatus = saved.alloc.AllocClientStatus
+	r.allocClientDescription = saved.alloc.AllocClientDescription
+	if saved.alloc.TaskStates != nil {
+		r.taskStates = copyTaskStates(saved.alloc.TaskStates)
+	}
+	if ts, ok := saved.tasks[r.alloc.Task]; ok && ts.Task != nil {
+		if ts.Task.ConfigLock == nil {
+			ts.Task.ConfigLock = &sync.RWMutex{}
+		}
+		r.restoredTask = ts.Task
+	} else if t := r.alloc.Job.LookupTask(r.alloc.Task); t != nil {
+		// the task runner was not saved yet
+		r.restoredTask = t.Copy()
+	}
 }
 
 // copyTaskStates returns a copy of the passed task states.
@@ -371,7 +430,7 @@ func (r *Allocator) setTaskState(taskName, state string, event *models.TaskEvent
 
 // appendTaskEvent updates the task status by appending the new event.
 func (r *Allocator) appendTaskEvent(state *models.TaskState, event *models.TaskEvent) {
-	capacity := 10
+	capacity := models.MaxTaskEvents
 	if state.Events == nil {
 		state.Events = make([]*models.TaskEvent, 0, capacity)
 	}
@@ -410,6 +469,24 @@ func (r *Allocator) Run() {
 		return
 	}
 
+	// A restored allocation whose task had finished is not run again.
+	if r.restoredTask != nil && r.Alloc().ClientTerminalStatus() {
+		r.logger.Debugf("agent: Restored alloc %q in terminal status, waiting for destroy", r.alloc.ID)
+		r.handleDestroy()
+		return
+	}
+
+	// Build the working directory of the task
+	if r.config.AllocDir != "" {
+		r.allocDir = allocdir.NewAllocDir(r.config.AllocDir, alloc.ID, r.diskQuota(t))
+		if err := r.allocDir.Build(t.Type); err != nil {
+			r.logger.Errorf("agent: Failed to build alloc dir for alloc '%s': %v", alloc.ID, err)
+			r.setStatus(models.AllocClientStatusFailed, fmt.Sprintf("failed to build alloc dir: %v", err))
+			r.handleDestroy()
+			return
+		}
+	}
+
 	// Start the task runners
 	r.logger.Debugf("agent: Starting task runners for alloc '%s'", r.alloc.ID)
 	r.taskLock.Lock()
@@ -417,13 +494,25 @@ func (r *Allocator) Run() {
 		return
 	}
 
-	tr := NewWorker(r.logger, r.config, r.setTaskState, r.Alloc(), t.Copy(), r.workUpdates)
+	task := t.Copy()
+	if r.restoredTask != nil {
+		r.logger.Printf("agent: Resuming task %q of alloc %q from its saved checkpoint", t.Type, r.alloc.ID)
+		task, r.restoredTask = r.restoredTask, nil
+	}
+	tr := NewWorker(r.logger, r.config, r.setTaskState, r.Alloc(), task, r.workUpdates)
+	if r.allocDir != nil {
+		tr.taskDir = r.allocDir.TaskDir(t.Type)
+	}
 	r.tasks[t.Type] = tr
 	tr.MarkReceived()
 
 	go tr.Run()
 	r.taskLock.Unlock()
 
+	if r.allocDir != nil && r.allocDir.Quota > 0 {
+		go r.watchDiskQuota(tr)
+	}
+
 	// taskDestroyEvent contains an event that caused the destroyment of a task
 	// in the allocation.
 	var taskDestroyEvent *models.TaskEvent
@@ -435,6 +524,7 @@ OUTER:
 		case update := <-r.updateCh:
 			// Store the updated allocation.
 			r.allocLock.Lock()
+			prev := r.alloc
 			r.alloc = update
 			r.allocLock.Unlock()
 
@@ -443,6 +533,7 @@ OUTER:
 				taskDestroyEvent = models.NewTaskEvent(models.TaskKilled)
 				break OUTER
 			}
+			r.warmRestart(prev, update)
 
 		case <-r.destroyCh:
 			taskDestroyEvent = models.NewTaskEvent(models.TaskKilled)
@@ -457,6 +548,70 @@ OUTER:
 	r.logger.Debugf("agent: Terminating runner for alloc '%s'", r.alloc.ID)
 }
 
+// warmRestart applies the config of the tasks changed in place, by a warm
+// restart, the tunables of the job or a skip armed, to the running tasks.
+func (r *Allocator) warmRestart(prev, update *models.Allocation) {
+	if prev.Job == nil || update.Job == nil {
+		return
+	}
+	for _, tr := range r.getWorkers() {
+		cur := prev.Job.LookupTask(tr.task.Type)
+		next := update.Job.LookupTask(tr.task.Type)
+		if cur == nil || next == nil {
+			continue
+		}
+		if cur.WarmRestartChanged(next) {
+			r.logger.Printf("agent: Warm restart of task %q of alloc %q", tr.task.Type, r.alloc.ID)
+			tr.WarmRestart(next)
+		}
+		if cur.TunablesChanged(next) {
+			r.logger.Printf("agent: Tuning task %q of alloc %q", tr.task.Type, r.alloc.ID)
+			tr.Tune(next)
+		}
+		if cur.SkipTxChanged(next) {
+			r.logger.Printf("agent: Arming task %q of alloc %q to skip a failing transaction", tr.task.Type, r.alloc.ID)
+			tr.SkipTx(next)
+		}
+	}
+}
+
+// diskQuota returns the disk quota of the alloc dir in bytes, of the task or
+// else the default of the agent.
+func (r *Allocator) diskQuota(t *models.Task) int64 {
+	if t.DiskQuotaMB > 0 {
+		return int64(t.DiskQuotaMB) * bytesPerMB
+	}
+	return int64(r.config.AllocDiskQuotaMB) * bytesPerMB
+}
+
+// watchDiskQuota fails the task once the alloc dir is over its quota, before
+// the task fills the disk shared with the other allocations of the node.
+func (r *Allocator) watchDiskQuota(tr *Worker) {
+	ticker := time.NewTicker(diskQuotaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-tr.WaitCh():
+			return
+		}
+
+		exceeded, size, err := r.allocDir.Exceeded()
+		if err != nil {
+			r.logger.Warnf("agent: Failed to get the disk usage of alloc '%s': %v", r.alloc.ID, err)
+			continue
+		}
+		if exceeded {
+			msg := fmt.Sprintf("disk quota exceeded: %s uses %d bytes, over the quota of %d bytes",
+				r.allocDir.Dir, size, r.allocDir.Quota)
+			r.logger.Errorf("agent: Alloc '%s' %s", r.alloc.ID, msg)
+			tr.Destroy(models.NewTaskEvent(models.TaskDiskExceeded).
+				SetDiskLimit(r.allocDir.Quota).SetMessage(msg).SetFailsTask())
+			return
+		}
+	}
+}
+
 // destroyWorkers destroys the task runners, waits for them to terminate and
 // then saves store.
 func (r *Allocator) destroyWorkers(destroyEvent *models.TaskEvent) {
@@ -485,6 +640,12 @@ func (r *Allocator) handleDestroy() {
 				r.logger.Errorf("agent: Failed to destroy state for alloc '%s': %v",
 					r.alloc.ID, err)
 			}
+			if r.allocDir != nil {
+				if err := r.allocDir.Destroy(); err != nil {
+					r.logger.Errorf("agent: Failed to destroy alloc dir for alloc '%s': %v",
+						r.alloc.ID, err)
+				}
+			}
 			return
 		case <-r.updateCh:
 			r.logger.Errorf("agent: Dropping update to terminal alloc '%s'", r.alloc.ID)
@@ -555,6 +716,73 @@ func (r *Allocator) LatestAllocStats(taskFilter string) (*models.AllocStatistics
 	return astat, nil
 }
 
+// Events returns the changes captured by the task, Src if taskName is empty.
+func (r *Allocator) Events(taskName string, index uint64, max int, wait time.Duration) (*models.AllocEventsResponse, error) {
+	if taskName == "" {
+		taskName = models.TaskTypeSrc
+	}
+	r.taskLock.RLock()
+	tr, ok := r.tasks[taskName]
+	r.taskLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("allocation %q has no task %q", r.alloc.ID, taskName)
+	}
+	events, lastIndex, err := tr.Events(index, max, wait)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AllocEventsResponse{Events: events, LastIndex: lastIndex}, nil
+}
+
+// Rescan makes the Src task of the allocation pick up the source tables
+// created since it started.
+func (r *Allocator) Rescan() (*models.AllocRescanResponse, error) {
+	r.taskLock.RLock()
+	tr, ok := r.tasks[models.TaskTypeSrc]
+	r.taskLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("allocation %q has no task %q", r.alloc.ID, models.TaskTypeSrc)
+	}
+	tables, err := tr.Rescan()
+	if err != nil {
+		return nil, err
+	}
+	return &models.AllocRescanResponse{AllocID: r.alloc.ID, Tables: tables}, nil
+}
+
+// Health returns the health of the connections of the tasks of the
+// allocation. It is healthy if all of them are, and all its tasks run.
+func (r *Allocator) Health() (*models.AllocHealthResponse, error) {
+	r.taskLock.RLock()
+	tasks := make(map[string]*Worker, len(r.tasks))
+	for name, tr := range r.tasks {
+		tasks[name] = tr
+	}
+	r.taskLock.RUnlock()
+
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := &models.AllocHealthResponse{AllocID: r.alloc.ID, Healthy: true}
+	for _, name := range names {
+		th := &models.TaskHealth{Task: name}
+		conns, err := tasks[name].Health()
+		if err != nil {
+			th.Error = err.Error()
+			resp.Healthy = false
+		}
+		for _, c := range conns {
+			resp.Healthy = resp.Healthy && c.Healthy
+		}
+		th.Connections = conns
+		resp.Tasks = append(resp.Tasks, th)
+	}
+	return resp, nil
+}
+
 // shouldUpdate takes the AllocModifyIndex of an allocation sent from the server and
 // checks if the current running allocation is behind and should be updated.
 func (r *Allocator) shouldUpdate(serverIndex uint64) bool {
@@ -19,6 +19,7 @@ func TestNewAllocator(t *testing.T) {
 	type args struct {
 		logger      *log.Logger
 		config      *config.ClientConfig
+		stateDB     *stateDB
 		updater     AllocStateUpdater
 		alloc       *models.Allocation
 		workUpdates chan *models.TaskUpdate
@@ -32,7 +33,7 @@ func TestNewAllocator(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewAllocator(tt.args.logger, tt.args.config, tt.args.updater, tt.args.alloc, tt.args.workUpdates); !reflect.DeepEqual(got, tt.want) {
+			if got := NewAllocator(tt.args.logger, tt.args.config, tt.args.stateDB, tt.args.updater, tt.args.alloc, tt.args.workUpdates); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewAllocator() = %v, want %v", got, tt.want)
 			}
 		})
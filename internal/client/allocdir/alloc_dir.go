@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+// Package allocdir manages the working directories of the allocations run by
+// an agent: the relay logs, dump chunks and other files written by the tasks.
+package allocdir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// AllocDir is the working directory of an allocation, <root>/<alloc ID>,
+// with a directory per task.
+type AllocDir struct {
+	// Dir is the path of the directory
+	Dir string
+
+	// Quota is the maximum size of the directory in bytes, 0 for no limit
+	Quota int64
+}
+
+// NewAllocDir returns the directory of an allocation under root. It is
+// created by Build.
+func NewAllocDir(root, allocID string, quota int64) *AllocDir {
+	return &AllocDir{
+		Dir:   filepath.Join(root, allocID),
+		Quota: quota,
+	}
+}
+
+// TaskDir returns the working directory of a task of the allocation.
+func (d *AllocDir) TaskDir(task string) string {
+	return filepath.Join(d.Dir, task)
+}
+
+// Build creates the directory of the allocation and of its tasks.
+func (d *AllocDir) Build(tasks ...string) error {
+	dirs := []string{d.Dir}
+	for _, task := range tasks {
+		dirs = append(dirs, d.TaskDir(task))
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to make the alloc dir %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// Size returns the bytes used by the files under the directory.
+func (d *AllocDir) Size() (int64, error) {
+	var size int64
+	err := filepath.Walk(d.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// removed while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Exceeded tells if the directory is over its quota, with its size.
+func (d *AllocDir) Exceeded() (bool, int64, error) {
+	if d.Quota <= 0 {
+		return false, 0, nil
+	}
+	size, err := d.Size()
+	if err != nil {
+		return false, 0, err
+	}
+	return size > d.Quota, size, nil
+}
+
+// Destroy removes the directory and its files.
+func (d *AllocDir) Destroy() error {
+	return os.RemoveAll(d.Dir)
+}
+
+// GC removes the directories under root of the allocations which are not in
+// keep, and returns their IDs.
+func GC(root string, keep map[string]bool) ([]string, error) {
+	fis, err := ioutil.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, fi := range fis {
+		if !fi.IsDir() || keep[fi.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, fi.Name())); err != nil {
+			return removed, err
+		}
+		removed = append(removed, fi.Name())
+	}
+	return removed, nil
+}
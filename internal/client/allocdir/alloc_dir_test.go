@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package allocdir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestAllocDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "allocdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d := NewAllocDir(root, "alloc1", 100)
+	if err := d.Build("Src"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(d.TaskDir("Src")); err != nil || !fi.IsDir() {
+		t.Fatalf("task dir not built: %v", err)
+	}
+
+	write := func(name string, size int) {
+		if err := ioutil.WriteFile(filepath.Join(d.TaskDir("Src"), name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("relay.log", 60)
+	if exceeded, size, err := d.Exceeded(); err != nil || exceeded || size != 60 {
+		t.Errorf("Exceeded() = %v %v %v", exceeded, size, err)
+	}
+	write("dump.chunk", 50)
+	if exceeded, size, err := d.Exceeded(); err != nil || !exceeded || size != 110 {
+		t.Errorf("Exceeded() = %v %v %v", exceeded, size, err)
+	}
+
+	// no quota
+	d.Quota = 0
+	if exceeded, _, err := d.Exceeded(); err != nil || exceeded {
+		t.Errorf("Exceeded() without quota = %v %v", exceeded, err)
+	}
+
+	if err := d.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(d.Dir); !os.IsNotExist(err) {
+		t.Errorf("alloc dir not destroyed: %v", err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	root, err := ioutil.TempDir("", "allocdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, id := range []string{"a1", "a2", "a3"} {
+		if err := NewAllocDir(root, id, 0).Build("Dest"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// not an alloc dir
+	if err := ioutil.WriteFile(filepath.Join(root, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := GC(root, map[string]bool{"a2": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(removed)
+	if !reflect.DeepEqual(removed, []string{"a1", "a3"}) {
+		t.Errorf("removed = %v", removed)
+	}
+	fis, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 2 {
+		t.Errorf("left %d entries, want a2 and file", len(fis))
+	}
+
+	if removed, err := GC(filepath.Join(root, "missing"), nil); err != nil || len(removed) != 0 {
+		t.Errorf("GC of a missing root = %v %v", removed, err)
+	}
+}
@@ -26,9 +26,9 @@ import (
 	"github.com/mitchellh/hashstructure"
 	gnatsd "github.com/nats-io/gnatsd/server"
 	stand "github.com/nats-io/nats-streaming-server/server"
-	"github.com/shirou/gopsutil/host"
 
 	"github.com/actiontech/dtle/internal"
+	"github.com/actiontech/dtle/internal/client/allocdir"
 	"github.com/actiontech/dtle/internal/client/driver"
 	"github.com/actiontech/dtle/internal/config"
 	ulog "github.com/actiontech/dtle/internal/logger"
@@ -58,6 +58,10 @@ const (
 	// stateSnapshotIntv is how often the client snapshots state
 	stateSnapshotIntv = 60 * time.Second
 
+	// allocGCIntv is how often the alloc dirs of terminal allocations are
+	// garbage collected
+	allocGCIntv = 5 * time.Minute
+
 	// initialHeartbeatStagger is used to stagger the interval between
 	// starting and the intial heartbeat. After the intial heartbeat,
 	// we switch to using the TTL specified by the servers.
@@ -118,6 +122,12 @@ type Client struct {
 	allocs    map[string]*Allocator
 	allocLock sync.RWMutex
 
+	// stateDB keeps the state of the allocations across restarts
+	stateDB *stateDB
+
+	// hostStats samples the utilization of the node for the heartbeats
+	hostStats *hostStatsCollector
+
 	// blockedAllocations are allocations which are blocked because their
 	// chained allocations haven't finished running
 	blockedAllocations map[string]*models.Allocation
@@ -134,6 +144,9 @@ type Client struct {
 
 	stand *stand.StanServer
 
+	// logShipper ships the logs of the jobs, if configured
+	logShipper *logShipper
+
 	shutdown     bool
 	shutdownCh   chan struct{}
 	shutdownLock sync.Mutex
@@ -198,11 +211,23 @@ func NewClient(cfg *config.ClientConfig, logger *ulog.Logger) (*Client, error) {
 		return nil, fmt.Errorf("failed to initialize agent: %v", err)
 	}
 
+	stateDB, err := openStateDB(c.config.StateDir)
+	if err != nil {
+		return nil, err
+	}
+	c.stateDB = stateDB
+	c.hostStats = newHostStatsCollector(c.config.AllocDir)
+
 	// Setup the node
 	if err := c.setupNode(); err != nil {
 		return nil, fmt.Errorf("node setup failed: %v", err)
 	}
 
+	if cfg.LogShipping.Enabled() {
+		c.logShipper = newLogShipper(cfg.LogShipping, cfg.Node.Name, logger)
+		logger.AddHook(c.logShipper)
+	}
+
 	if err := c.setupNatsServer(); err != nil {
 		return nil, fmt.Errorf("nats server setup failed: %v", err)
 	}
@@ -218,6 +243,11 @@ func NewClient(cfg *config.ClientConfig, logger *ulog.Logger) (*Client, error) {
 	c.configCopy = c.config.Copy()
 	c.configLock.Unlock()
 
+	// Resume the allocations of the node, without waiting for the servers
+	if err := c.restoreState(); err != nil {
+		logger.Errorf("agent: Failed to restore state: %v", err)
+	}
+
 	// Set the preconfigured list of static servers
 	c.configLock.RLock()
 	if len(c.configCopy.Servers) > 0 {
@@ -233,9 +263,15 @@ func NewClient(cfg *config.ClientConfig, logger *ulog.Logger) (*Client, error) {
 	// Begin periodic snapshotting of state.
 	go c.periodicSnapshot()
 
+	// Begin garbage collecting the alloc dirs
+	go c.periodicAllocGC()
+
 	// Begin syncing allocations to the server
 	go c.allocSync()
 
+	// Begin sending the lag and the throughput of the jobs to the server
+	go c.jobStatsSync()
+
 	// Start the client!
 	go c.run()
 
@@ -268,6 +304,28 @@ func (c *Client) init() error {
 	}
 	c.logger.Printf("agent: Using state directory %v", c.config.StateDir)
 
+	// Ensure the alloc dir exists if we have one
+	if c.config.AllocDir != "" {
+		if err := os.MkdirAll(c.config.AllocDir, 0755); err != nil {
+			return fmt.Errorf("failed creating alloc dir: %s", err)
+		}
+
+	} else {
+		// Otherwise make a temp directory to use.
+		p, err := ioutil.TempDir("", "DtleAlloc")
+		if err != nil {
+			return fmt.Errorf("failed creating temporary directory for the AllocDir: %v", err)
+		}
+
+		p, err = filepath.EvalSymlinks(p)
+		if err != nil {
+			return fmt.Errorf("failed to find temporary directory for the AllocDir: %v", err)
+		}
+
+		c.config.AllocDir = p
+	}
+	c.logger.Printf("agent: Using alloc directory %v", c.config.AllocDir)
+
 	return nil
 }
 
@@ -304,7 +362,14 @@ func (c *Client) Shutdown() error {
 	c.shutdown = true
 	close(c.shutdownCh)
 	c.connPool.Shutdown()
-	return c.saveState()
+	err := c.saveState()
+	if cerr := c.stateDB.Close(); cerr != nil {
+		c.logger.Errorf("agent: Failed to close state db: %v", cerr)
+	}
+	if c.logShipper != nil {
+		c.logShipper.Close()
+	}
+	return err
 }
 
 // RPC is used to forward an RPC call to a server server, or fail if no servers.
@@ -381,6 +446,41 @@ func (c *Client) GetAllocStats(allocID string) (AllocStatsReporter, error) {
 	return ar.StatsReporter(), nil
 }
 
+// GetAllocEvents returns the changes captured by a watch-only task of the allocation.
+func (c *Client) GetAllocEvents(allocID, task string, index uint64, max int, wait time.Duration) (*models.AllocEventsResponse, error) {
+	c.allocLock.RLock()
+	ar, ok := c.allocs[allocID]
+	c.allocLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown allocation ID %q", allocID)
+	}
+	return ar.Events(task, index, max, wait)
+}
+
+// RescanAlloc makes the Src task of the allocation pick up the source tables
+// created since it started.
+func (c *Client) RescanAlloc(allocID string) (*models.AllocRescanResponse, error) {
+	c.allocLock.RLock()
+	ar, ok := c.allocs[allocID]
+	c.allocLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown allocation ID %q", allocID)
+	}
+	return ar.Rescan()
+}
+
+// AllocHealth returns the health of the connections of the tasks of the
+// allocation.
+func (c *Client) AllocHealth(allocID string) (*models.AllocHealthResponse, error) {
+	c.allocLock.RLock()
+	ar, ok := c.allocs[allocID]
+	c.allocLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown allocation ID %q", allocID)
+	}
+	return ar.Health()
+}
+
 // GetClientAlloc returns the allocation from the client
 func (c *Client) GetClientAlloc(allocID string) (*models.Allocation, error) {
 	all := c.allAllocs()
@@ -444,6 +544,39 @@ func (c *Client) saveState() error {
 	return mErr.ErrorOrNil()
 }
 
+// restoreState resumes the allocations saved before the agent restarted.
+// Their tasks start again from the saved checkpoints, and runAllocs
+// reconciles them with the allocations of the servers once pulled.
+func (c *Client) restoreState() error {
+	saved, err := c.stateDB.Allocs()
+	if err != nil {
+		return err
+	}
+
+	var mErr multierror.Error
+	for id, s := range saved {
+		if s.alloc == nil || s.alloc.Alloc == nil || s.alloc.Alloc.Job == nil {
+			c.logger.Warnf("agent: Dropping incomplete state of alloc %s", id)
+			if err := c.stateDB.DeleteAlloc(id); err != nil {
+				mErr.Errors = append(mErr.Errors, err)
+			}
+			continue
+		}
+
+		c.configLock.RLock()
+		ar := NewAllocator(c.logger, c.configCopy, c.stateDB, c.updateAllocStatus, s.alloc.Alloc, c.workUpdates)
+		c.configLock.RUnlock()
+		ar.restore(s)
+
+		c.allocLock.Lock()
+		c.allocs[id] = ar
+		c.allocLock.Unlock()
+		c.logger.Printf("agent: Restored alloc %s of job %s", id, s.alloc.Alloc.JobID)
+		go ar.Run()
+	}
+	return mErr.ErrorOrNil()
+}
+
 // getAllocRunners returns a snapshot of the current set of alloc runners.
 func (c *Client) getAllocRunners() map[string]*Allocator {
 	c.allocLock.RLock()
@@ -458,14 +591,14 @@ func (c *Client) getAllocRunners() map[string]*Allocator {
 // nodeID restores, or generates if necessary, a unique node ID.
 // The node ID is, if available, a persistent unique ID.
 func (c *Client) nodeID() (id string, err error) {
-	var hostID string
-	hostInfo, err := host.Info()
-	if !c.config.NoHostUUID && err == nil && internal.IsUUID(hostInfo.HostID) {
-		hostID = hostInfo.HostID
+	var hostUUID string
+	osHostID, err := hostID()
+	if !c.config.NoHostUUID && err == nil && internal.IsUUID(osHostID) {
+		hostUUID = osHostID
 	} else {
 		// Generate a random hostID if no constant ID is available on
 		// this platform.
-		hostID = models.GenerateUUID()
+		hostUUID = models.GenerateUUID()
 	}
 
 	// Attempt to read existing ID
@@ -479,7 +612,7 @@ func (c *Client) nodeID() (id string, err error) {
 	if len(idBuf) != 0 {
 		id = strings.ToLower(string(idBuf))
 	} else {
-		id = hostID
+		id = hostUUID
 
 		// Persist the ID
 		if err := ioutil.WriteFile(idPath, []byte(id), 0700); err != nil {
@@ -507,6 +640,7 @@ func (c *Client) setupNode() error {
 	if node.Attributes == nil {
 		node.Attributes = make(map[string]string)
 	}
+	models.SetNodeProtocol(node)
 	if node.Datacenter == "" {
 		node.Datacenter = "dc1"
 	}
@@ -640,6 +774,67 @@ func (c *Client) periodicSnapshot() {
 	}
 }
 
+// periodicAllocGC garbage collects the alloc dirs, once the allocations are
+// restored and then every allocGCIntv.
+func (c *Client) periodicAllocGC() {
+	for {
+		c.gcAllocDirs()
+
+		select {
+		case <-time.After(allocGCIntv):
+		case <-c.shutdownCh:
+			return
+		}
+	}
+}
+
+// gcAllocDirs removes the alloc dirs of the allocations which are no longer
+// on the node, or have been terminal for longer than AllocGCRetention. Paused
+// allocations are kept.
+func (c *Client) gcAllocDirs() {
+	c.configLock.RLock()
+	root, retention := c.configCopy.AllocDir, c.configCopy.AllocGCRetention
+	c.configLock.RUnlock()
+	if root == "" {
+		return
+	}
+
+	// Hold the lock for an added allocation not to build its dir meanwhile.
+	c.allocLock.RLock()
+	defer c.allocLock.RUnlock()
+	keep := make(map[string]bool, len(c.allocs))
+	for id, ar := range c.allocs {
+		alloc := ar.Alloc()
+		switch {
+		case alloc.DesiredStatus == models.AllocDesiredStatusPause:
+			// resumed later from where it stopped
+			keep[id] = true
+		case !alloc.TerminalStatus() || time.Since(allocFinishedAt(alloc)) < retention:
+			keep[id] = true
+		}
+	}
+
+	removed, err := allocdir.GC(root, keep)
+	if len(removed) > 0 {
+		c.logger.Printf("agent: Garbage collected the alloc dirs of %v", removed)
+	}
+	if err != nil {
+		c.logger.Errorf("agent: Failed to garbage collect alloc dirs: %v", err)
+	}
+}
+
+// allocFinishedAt returns when the last task of an allocation finished, zero
+// if none did.
+func allocFinishedAt(alloc *models.Allocation) time.Time {
+	var finished time.Time
+	for _, state := range alloc.TaskStates {
+		if state.FinishedAt.After(finished) {
+			finished = state.FinishedAt
+		}
+	}
+	return finished
+}
+
 // run is a long lived goroutine used to run the client
 func (c *Client) run() {
 	time.Sleep(15 * time.Second)
@@ -740,6 +935,7 @@ func (c *Client) updateNodeStatus() error {
 	req := models.NodeUpdateStatusRequest{
 		NodeID:       node.ID,
 		Status:       models.NodeStatusReady,
+		Utilization:  c.hostStats.Collect(),
 		WriteRequest: models.WriteRequest{Region: c.Region()},
 	}
 	var resp models.NodeUpdateResponse
@@ -827,6 +1023,10 @@ func (c *Client) allocSync() {
 	syncTicker := time.NewTicker(allocSyncIntv)
 	aUpdates := make(map[string]*models.Allocation)
 	jUpdates := make(map[string]*models.TaskUpdate)
+
+	// synced are the last updates of the allocations the servers applied,
+	// which the next updates are deltas of
+	synced := make(map[string]*models.Allocation)
 	for {
 		select {
 		case <-c.shutdownCh:
@@ -847,7 +1047,7 @@ func (c *Client) allocSync() {
 
 				sync := make([]*models.Allocation, 0, len(aUpdates))
 				for _, alloc := range aUpdates {
-					sync = append(sync, alloc)
+					sync = append(sync, allocDelta(alloc, synced[alloc.ID]))
 				}
 
 				// Send to server.
@@ -863,6 +1063,13 @@ func (c *Client) allocSync() {
 					syncTicker = time.NewTicker(c.retryIntv(allocSyncRetryIntv))
 					staggered = true
 				} else {
+					for id, alloc := range aUpdates {
+						if alloc.ClientTerminalStatus() {
+							delete(synced, id)
+						} else {
+							synced[id] = alloc
+						}
+					}
 					aUpdates = make(map[string]*models.Allocation)
 					if staggered {
 						syncTicker.Stop()
@@ -902,6 +1109,44 @@ func (c *Client) allocSync() {
 	}
 }
 
+// allocDelta returns the update of an allocation with, for each task, only
+// the events appended since the update synced the servers applied. A change
+// of the client status is sent in full.
+func allocDelta(alloc, synced *models.Allocation) *models.Allocation {
+	if synced == nil || alloc.ClientStatus != synced.ClientStatus {
+		return alloc
+	}
+	delta := *alloc
+	delta.TaskStates = make(map[string]*models.TaskState, len(alloc.TaskStates))
+	for name, ts := range alloc.TaskStates {
+		appended := appendedEvents(synced.TaskStates[name], ts)
+		if appended == nil {
+			delta.TaskStates[name] = ts
+			continue
+		}
+		d := *ts
+		d.Events = appended
+		d.EventsDelta = true
+		delta.TaskStates[name] = &d
+	}
+	return &delta
+}
+
+// appendedEvents returns the events of a task state after the last event of
+// its previous state, nil if they do not follow it.
+func appendedEvents(prev, ts *models.TaskState) []*models.TaskEvent {
+	if prev == nil || len(prev.Events) == 0 {
+		return nil
+	}
+	last := prev.Events[len(prev.Events)-1]
+	for i := len(ts.Events) - 1; i >= 0; i-- {
+		if e := ts.Events[i]; e.Type == last.Type && e.Time.Equal(last.Time) {
+			return append([]*models.TaskEvent{}, ts.Events[i+1:]...)
+		}
+	}
+	return nil
+}
+
 type jobUpdates struct {
 	pulled map[string]string
 }
@@ -1423,7 +1668,7 @@ func (c *Client) addAlloc(alloc *models.Allocation) error {
 	defer c.allocLock.Unlock()
 
 	c.configLock.RLock()
-	ar := NewAllocator(c.logger, c.configCopy, c.updateAllocStatus, alloc, c.workUpdates)
+	ar := NewAllocator(c.logger, c.configCopy, c.stateDB, c.updateAllocStatus, alloc, c.workUpdates)
 	c.configLock.RUnlock()
 	go ar.Run()
 
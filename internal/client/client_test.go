@@ -7,11 +7,14 @@
 package client
 
 import (
+	"io/ioutil"
 	"net"
+	"os"
 	"reflect"
 	"sync"
 	"testing"
 	"time"
+	"github.com/actiontech/dtle/internal/client/allocdir"
 	"github.com/actiontech/dtle/internal/config"
 	ulog "github.com/actiontech/dtle/internal/logger"
 	"github.com/actiontech/dtle/internal/models"
@@ -3314,3 +3317,89 @@ func Test_endpoint_equal(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_gcAllocDirs(t *testing.T) {
+	root, err := ioutil.TempDir("", "dtle-alloc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	job := &models.Job{ID: "job1"}
+	finished := func(at time.Time) map[string]*models.TaskState {
+		return map[string]*models.TaskState{models.TaskTypeSrc: {State: models.TaskStateDead, FinishedAt: at}}
+	}
+	allocs := map[string]*models.Allocation{
+		"running": {ClientStatus: models.AllocClientStatusRunning},
+		"paused":  {DesiredStatus: models.AllocDesiredStatusPause, TaskStates: finished(time.Now().Add(-2 * time.Hour))},
+		"recent":  {ClientStatus: models.AllocClientStatusFailed, TaskStates: finished(time.Now())},
+		"old":     {ClientStatus: models.AllocClientStatusComplete, TaskStates: finished(time.Now().Add(-2 * time.Hour))},
+	}
+	c := &Client{
+		configCopy: &config.ClientConfig{AllocDir: root, AllocGCRetention: time.Hour},
+		logger:     ulog.New(ioutil.Discard, ulog.ErrorLevel),
+		allocs:     make(map[string]*Allocator),
+	}
+	for id, alloc := range allocs {
+		alloc.ID, alloc.Job = id, job
+		c.allocs[id] = NewAllocator(c.logger, c.configCopy, nil, nil, alloc, nil)
+		if err := allocdir.NewAllocDir(root, id, 0).Build(models.TaskTypeSrc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := allocdir.NewAllocDir(root, "gone", 0).Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.gcAllocDirs()
+	fis, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, fi := range fis {
+		left = append(left, fi.Name())
+	}
+	if want := []string{"paused", "recent", "running"}; !reflect.DeepEqual(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
+
+func TestAllocDelta(t *testing.T) {
+	start := time.Now()
+	event := func(i int) *models.TaskEvent {
+		return &models.TaskEvent{Type: models.TaskStarted, Time: start.Add(time.Duration(i) * time.Second)}
+	}
+	alloc := func(status string, events ...int) *models.Allocation {
+		ts := &models.TaskState{State: models.TaskStateRunning}
+		for _, i := range events {
+			ts.Events = append(ts.Events, event(i))
+		}
+		return &models.Allocation{ID: "a1", ClientStatus: status,
+			TaskStates: map[string]*models.TaskState{models.TaskTypeSrc: ts}}
+	}
+
+	if d := allocDelta(alloc(models.AllocClientStatusRunning, 1, 2), nil); d.TaskStates[models.TaskTypeSrc].EventsDelta {
+		t.Fatalf("first update sent as a delta")
+	}
+
+	synced := alloc(models.AllocClientStatusRunning, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	next := alloc(models.AllocClientStatusRunning, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12)
+	d := allocDelta(next, synced)
+	ts := d.TaskStates[models.TaskTypeSrc]
+	if !ts.EventsDelta || len(ts.Events) != 2 {
+		t.Fatalf("delta = %+v", ts)
+	}
+	merged := models.MergeTaskStates(synced.TaskStates, d.TaskStates)
+	if !reflect.DeepEqual(merged, next.TaskStates) {
+		t.Fatalf("merged = %+v", merged[models.TaskTypeSrc])
+	}
+	// a retried delta is not appended twice
+	if again := models.MergeTaskStates(merged, d.TaskStates); !reflect.DeepEqual(again, next.TaskStates) {
+		t.Fatalf("merged again = %+v", again[models.TaskTypeSrc])
+	}
+
+	if d := allocDelta(alloc(models.AllocClientStatusFailed, 1, 2, 3), synced); d.TaskStates[models.TaskTypeSrc].EventsDelta {
+		t.Errorf("status change sent as a delta")
+	}
+}
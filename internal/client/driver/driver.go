@@ -9,6 +9,7 @@ package driver
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	uconf "github.com/actiontech/dtle/internal/config"
 	log "github.com/actiontech/dtle/internal/logger"
@@ -19,8 +20,11 @@ var (
 	// BuiltinDrivers contains the built in registered drivers
 	// which are available for allocation handling
 	BuiltinDrivers = map[string]Factory{
-		models.TaskDriverMySQL: NewMySQLDriver,
-		models.TaskDriverKafka: NewKafkaDriver,
+		models.TaskDriverMySQL:     NewMySQLDriver,
+		models.TaskDriverKafka:     NewKafkaDriver,
+		models.TaskDriverExport:    NewExportDriver,
+		models.TaskDriverRedis:     NewRedisDriver,
+		models.TaskDriverWarehouse: NewWarehouseDriver,
 		//"models.TaskDriverOracle:     NewOracleDriver,
 	}
 
@@ -104,10 +108,80 @@ type DriverHandle interface {
 	Stats() (*models.TaskStatistics, error)
 }
 
+// EventsHandle is implemented by the handles of tasks capturing changes
+// without applying them
+type EventsHandle interface {
+	// Events returns up to max changes after index, waiting up to wait for one
+	Events(index uint64, max int, wait time.Duration) ([]*models.ChangeEvent, uint64, error)
+}
+
+// RescanHandle is implemented by the handles of tasks reading the source
+// schemas, which can pick up the tables created since they started
+type RescanHandle interface {
+	// Rescan starts replicating the source tables of the job which are not
+	// replicated yet, and returns them as "schema.table"
+	Rescan() ([]string, error)
+}
+
+// HealthHandle is implemented by the handles of tasks which report the
+// health of the connections they hold
+type HealthHandle interface {
+	// Health returns the health of each connection of the task
+	Health() []*models.ConnHealth
+}
+
+// TaskEventsHandle is implemented by the handles of tasks which emit events
+// while running, e.g. on their source being degraded
+type TaskEventsHandle interface {
+	// TaskEvents returns the channel of the events of the task
+	TaskEvents() <-chan *models.TaskEvent
+}
+
+// SkipTxHandle is implemented by the handles of tasks which skip a
+// transaction failing on their target when armed to
+type SkipTxHandle interface {
+	// SkipTx arms the task to skip its next failing transaction
+	SkipTx(skip *models.SkipTx)
+}
+
+// WarmRestartHandle is implemented by the handles of tasks which apply the
+// WarmRestartConfig of a warm restart of their job without restarting
+type WarmRestartHandle interface {
+	// WarmRestart applies the WarmRestartConfig of config, the new config of
+	// the task, keeping the connections of the task
+	WarmRestart(config map[string]interface{}) error
+}
+
+// TunableHandle is implemented by the handles of tasks which apply the
+// TunableConfig of their config while running
+type TunableHandle interface {
+	// Tune applies the TunableConfig of config, the new config of the task
+	Tune(config map[string]interface{}) error
+}
+
+// StepHandle is implemented by the handles of the step tasks, which exit
+// once done
+type StepHandle interface {
+	// Result describes the outcome of the step once done
+	Result() string
+	// Checksums are the tables compared by a Checksum step once done, nil
+	// for the other steps
+	Checksums() []*models.TableChecksum
+}
+
 type ExecContext struct {
 	Subject    string
 	Tp         string
 	MaxPayload int
+	// TaskDir is the working directory of the task, empty if the agent has
+	// no alloc dir
+	TaskDir string
+	// Job is the job of the task, whose Src and Dest tasks the step tasks
+	// connect to
+	Job *models.Job
+	// TransitKeys are the keys of the job encrypting its messages, if it
+	// has EncryptTransit
+	TransitKeys [][]byte
 }
 
 // NewExecContext is used to create a new execution context
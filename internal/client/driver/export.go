@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/actiontech/dtle/internal/client/driver/export"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+type ExportDriver struct {
+	DriverContext
+}
+
+func (ed *ExportDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle, error) {
+	var driverConfig export.ExportConfig
+	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+		return nil, err
+	}
+
+	switch task.Type {
+	case models.TaskTypeSrc:
+		return nil, fmt.Errorf("Export can only be used on 'Dest'")
+	case models.TaskTypeDest:
+		runner := export.NewExportRunner(ctx.Subject, &driverConfig, ed.logger)
+		go runner.Run()
+		return runner, nil
+	default:
+		return nil, fmt.Errorf("unknown processor type : %+v", task.Type)
+	}
+}
+
+func (ed *ExportDriver) Validate(task *models.Task) (*models.TaskValidateResponse, error) {
+	reply := &models.TaskValidateResponse{}
+
+	var driverConfig export.ExportConfig
+	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+		return reply, err
+	}
+	if driverConfig.Dir == "" {
+		return reply, fmt.Errorf("Dir is required for an Export task")
+	}
+	return reply, nil
+}
+
+func NewExportDriver(ctx *DriverContext) Driver {
+	return &ExportDriver{DriverContext: *ctx}
+}
@@ -0,0 +1,390 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	gonats "github.com/nats-io/go-nats"
+
+	mysqlDriver "github.com/actiontech/dtle/internal/client/driver/mysql"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	TaskStateComplete int = iota
+	TaskStateRestart
+	TaskStateDead
+)
+
+const (
+	// the header mydumper writes in front of every file
+	fileHeader = "/*!40101 SET NAMES binary*/;\n/*!40014 SET FOREIGN_KEY_CHECKS=0*/;\n\n"
+	// time format of the metadata file
+	metadataTimeFormat = "2006-01-02 15:04:05"
+)
+
+var (
+	useStmtRegexp = regexp.MustCompile("(?i)^USE\\s")
+)
+
+// ExportConfig is the configuration of an 'Export' Dest task.
+// The output is written to Dir. If S3Bucket is set, the finished dump is
+// uploaded to s3://S3Bucket/S3Prefix/ with the default AWS credential chain.
+type ExportConfig struct {
+	Dir      string
+	S3Bucket string
+	S3Prefix string
+	S3Region string
+	NatsAddr string
+	Gtid     string
+}
+
+// ExportRunner receives a full copy and writes it as a mydumper-compatible
+// dump: db-schema-create.sql, db.tb-schema.sql, db.tb.NNNNN.sql and metadata.
+type ExportRunner struct {
+	logger   *log.Entry
+	subject  string
+	cfg      *ExportConfig
+	natsConn *gonats.Conn
+	waitCh   chan *models.WaitResult
+
+	// the messages of the extractor received in chunks
+	msgChunks *mysqlDriver.ChunkAssembler
+
+	startTime time.Time
+	// table ident to the number of data files written
+	chunks     map[string]int
+	rowsCopied int64
+	mu         sync.Mutex
+
+	shutdown   bool
+	shutdownCh chan struct{}
+}
+
+func NewExportRunner(subject string, cfg *ExportConfig, logger *log.Logger) *ExportRunner {
+	entry := log.NewEntry(logger).WithFields(log.Fields{
+		"job": subject,
+	})
+	return &ExportRunner{
+		subject:    subject,
+		cfg:        cfg,
+		logger:     entry,
+		chunks:     make(map[string]int),
+		waitCh:     make(chan *models.WaitResult, 1),
+		shutdownCh: make(chan struct{}),
+		msgChunks:  mysqlDriver.NewChunkAssembler(),
+	}
+}
+
+func (r *ExportRunner) ID() string {
+	id := config.DriverCtx{
+		DriverConfig: &config.MySQLDriverConfig{
+			NatsAddr: r.cfg.NatsAddr,
+		},
+	}
+
+	data, err := json.Marshal(id)
+	if err != nil {
+		r.logger.Errorf("export: Failed to marshal ID to JSON: %s", err)
+	}
+	return string(data)
+}
+
+func (r *ExportRunner) WaitCh() chan *models.WaitResult {
+	return r.waitCh
+}
+
+func (r *ExportRunner) Shutdown() error {
+	if r.shutdown {
+		return nil
+	}
+	if r.natsConn != nil {
+		r.natsConn.Close()
+	}
+	r.shutdown = true
+	close(r.shutdownCh)
+
+	r.logger.Printf("export: Shutting down")
+	return nil
+}
+
+func (r *ExportRunner) Stats() (*models.TaskStatistics, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	taskResUsage := &models.TaskStatistics{
+		Stage:     models.StageSlaveWaitingForWorkersToProcessQueue,
+		Timestamp: time.Now().UTC().UnixNano(),
+	}
+	taskResUsage.CurrentCoordinates = &models.CurrentCoordinates{}
+	taskResUsage.MsgStat = gonats.Statistics{}
+	if r.natsConn != nil {
+		taskResUsage.MsgStat = r.natsConn.Statistics
+	}
+	return taskResUsage, nil
+}
+
+func (r *ExportRunner) Run() {
+	r.startTime = time.Now()
+	if err := os.MkdirAll(r.cfg.Dir, 0755); err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+
+	natsAddr := fmt.Sprintf("nats://%s", r.cfg.NatsAddr)
+	sc, err := gonats.Connect(natsAddr)
+	if err != nil {
+		r.logger.Errorf("export: Can't connect nats server %v. make sure a nats streaming server is running.%v", natsAddr, err)
+		r.onError(TaskStateDead, err)
+		return
+	}
+	r.logger.Debugf("export: Connect nats server %v", natsAddr)
+	r.natsConn = sc
+
+	if err := r.initiateStreaming(); err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+}
+
+func (r *ExportRunner) initiateStreaming() error {
+	_, err := r.natsConn.Subscribe(fmt.Sprintf("%s_full", r.subject), func(m *gonats.Msg) {
+		if complete, err := r.msgChunks.Assemble(r.natsConn, m); !complete {
+			if err != nil {
+				r.onError(TaskStateDead, err)
+			}
+			return
+		}
+		dumpData := &mysqlDriver.DumpEntry{}
+		if err := mysqlDriver.Decode(m.Data, dumpData); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		if err := r.writeDumpEntry(dumpData); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		if err := r.natsConn.Publish(m.Reply, nil); err != nil {
+			r.onError(TaskStateDead, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.natsConn.Subscribe(fmt.Sprintf("%s_full_complete", r.subject), func(m *gonats.Msg) {
+		if complete, err := r.msgChunks.Assemble(r.natsConn, m); !complete {
+			if err != nil {
+				r.onError(TaskStateDead, err)
+			}
+			return
+		}
+		dumpData := &mysqlDriver.DumpStatResult{}
+		if err := mysqlDriver.Decode(m.Data, dumpData); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		if err := r.writeMetadata(dumpData); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		if r.cfg.S3Bucket != "" {
+			if err := r.upload(); err != nil {
+				r.onError(TaskStateDead, err)
+				return
+			}
+		}
+		if err := r.natsConn.Publish(m.Reply, nil); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		r.logger.Printf("export: dump is complete. %d rows written to %v", r.rowsCopied, r.cfg.Dir)
+		r.onError(TaskStateComplete, nil)
+	})
+	return err
+}
+
+// writeDumpEntry writes a DDL entry as schema files and a data entry as a new chunk file.
+func (r *ExportRunner) writeDumpEntry(entry *mysqlDriver.DumpEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry.DbSQL != "" && entry.TableSchema != "" {
+		name := fmt.Sprintf("%s-schema-create.sql", entry.TableSchema)
+		if err := r.writeFile(name, entry.DbSQL+";\n"); err != nil {
+			return err
+		}
+	}
+	if len(entry.TbSQL) > 0 && entry.TableName != "" {
+		var buf bytes.Buffer
+		for _, stmt := range entry.TbSQL {
+			// the USE statement is implied by the file name
+			if useStmtRegexp.MatchString(stmt) {
+				continue
+			}
+			buf.WriteString(stmt)
+			buf.WriteString(";\n")
+		}
+		name := fmt.Sprintf("%s.%s-schema.sql", entry.TableSchema, entry.TableName)
+		if err := r.writeFile(name, buf.String()); err != nil {
+			return err
+		}
+	}
+	if len(entry.ValuesX) == 0 {
+		return nil
+	}
+
+	ident := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	name := fmt.Sprintf("%s.%05d.sql", ident, r.chunks[ident])
+	r.chunks[ident]++
+	if err := r.writeFile(name, buildInsertStatement(entry)); err != nil {
+		return err
+	}
+	r.rowsCopied += int64(len(entry.ValuesX))
+	return nil
+}
+
+// buildInsertStatement formats the rows of a DumpEntry as one extended INSERT.
+func buildInsertStatement(entry *mysqlDriver.DumpEntry) string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("INSERT INTO %s VALUES\n", sql.EscapeName(entry.TableName)))
+	for i := range entry.ValuesX {
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		buf.WriteByte('(')
+		for j, colData := range entry.ValuesX[i] {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			if *colData != nil {
+				buf.WriteByte('\'')
+				buf.WriteString(sql.EscapeValue(string((*colData).([]byte))))
+				buf.WriteByte('\'')
+			} else {
+				buf.WriteString("NULL")
+			}
+		}
+		buf.WriteByte(')')
+	}
+	buf.WriteString(";\n")
+	return buf.String()
+}
+
+// writeMetadata writes the `metadata` file last, as mydumper does, so that
+// its presence marks a complete dump.
+func (r *ExportRunner) writeMetadata(stat *mysqlDriver.DumpStatResult) error {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("Started dump at: %s\n", r.startTime.Format(metadataTimeFormat)))
+	buf.WriteString("SHOW MASTER STATUS:\n")
+	buf.WriteString(fmt.Sprintf("\tLog: %s\n", stat.LogFile))
+	buf.WriteString(fmt.Sprintf("\tPos: %d\n", stat.LogPos))
+	buf.WriteString(fmt.Sprintf("\tGTID:%s\n\n", stat.Gtid))
+	buf.WriteString(fmt.Sprintf("Finished dump at: %s\n", time.Now().Format(metadataTimeFormat)))
+
+	f, err := os.Create(filepath.Join(r.cfg.Dir, "metadata"))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *ExportRunner) writeFile(name string, content string) error {
+	f, err := os.Create(filepath.Join(r.cfg.Dir, name))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(fileHeader)
+	w.WriteString(content)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// upload copies every file of the dump to S3. metadata goes last.
+func (r *ExportRunner) upload() error {
+	cfg := aws.NewConfig()
+	if r.cfg.S3Region != "" {
+		cfg = cfg.WithRegion(r.cfg.S3Region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return err
+	}
+	client := s3.New(sess)
+
+	names, err := filepath.Glob(filepath.Join(r.cfg.Dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	names = append(names, filepath.Join(r.cfg.Dir, "metadata"))
+	for _, name := range names {
+		key := strings.TrimPrefix(fmt.Sprintf("%s/%s", strings.Trim(r.cfg.S3Prefix, "/"), filepath.Base(name)), "/")
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		_, err = client.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(r.cfg.S3Bucket),
+			Key:    aws.String(key),
+			Body:   f,
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("error uploading %v to s3://%v/%v: %v", name, r.cfg.S3Bucket, key, err)
+		}
+		r.logger.Debugf("export: uploaded s3://%v/%v", r.cfg.S3Bucket, key)
+	}
+	return nil
+}
+
+func (r *ExportRunner) onError(state int, err error) {
+	if r.shutdown {
+		return
+	}
+	switch state {
+	case TaskStateComplete:
+		r.logger.Printf("export: Done exporting")
+	case TaskStateRestart:
+		if r.natsConn != nil {
+			if err := r.natsConn.Publish(fmt.Sprintf("%s_restart", r.subject), []byte(r.cfg.Gtid)); err != nil {
+				r.logger.Errorf("export: Trigger restart: %v", err)
+			}
+		}
+	default:
+		if r.natsConn != nil {
+			if err := r.natsConn.Publish(fmt.Sprintf("%s_error", r.subject), []byte(r.cfg.Gtid)); err != nil {
+				r.logger.Errorf("export: Trigger shutdown: %v", err)
+			}
+		}
+	}
+
+	r.waitCh <- models.NewWaitResult(state, err)
+	r.Shutdown()
+}
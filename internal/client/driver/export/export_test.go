@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package export
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mysqlDriver "github.com/actiontech/dtle/internal/client/driver/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestExportRunner_writeDumpEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewExportRunner("job1", &ExportConfig{Dir: dir}, log.New(os.Stderr, log.DebugLevel))
+
+	err = r.writeDumpEntry(&mysqlDriver.DumpEntry{
+		DbSQL:       "CREATE DATABASE IF NOT EXISTS db1",
+		TableSchema: "db1",
+		TableName:   "tb1",
+		TbSQL:       []string{"USE db1", "CREATE TABLE `tb1` (`id` int)"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v1, v2 interface{} = []byte("it's"), nil
+	err = r.writeDumpEntry(&mysqlDriver.DumpEntry{
+		TableSchema: "db1",
+		TableName:   "tb1",
+		ValuesX:     [][]*interface{}{{&v1}, {&v2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.writeMetadata(&mysqlDriver.DumpStatResult{Gtid: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"db1-schema-create.sql": "CREATE DATABASE IF NOT EXISTS db1;\n",
+		"db1.tb1-schema.sql":    "CREATE TABLE `tb1` (`id` int);\n",
+		"db1.tb1.00000.sql":     "INSERT INTO `tb1` VALUES\n('it\\'s'),\n(NULL);\n",
+		"metadata":              "\tGTID:3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5\n",
+	}
+	for name, content := range expected {
+		bs, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if !strings.Contains(string(bs), content) {
+			t.Errorf("%v: expected %q in %q", name, content, string(bs))
+		}
+	}
+}
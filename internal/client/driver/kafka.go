@@ -18,15 +18,20 @@ type KafkaDriver struct {
 }
 
 func (kd *KafkaDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle, error) {
-	var driverConfig kafka3.KafkaConfig
-	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
-		return nil, err
-	}
-
 	switch task.Type {
 	case models.TaskTypeSrc:
-		return nil, fmt.Errorf("afka can only be used on 'Dest'")
+		var sourceConfig kafka3.KafkaSourceConfig
+		if err := mapstructure.WeakDecode(task.Config, &sourceConfig); err != nil {
+			return nil, err
+		}
+		runner := kafka3.NewKafkaSourceRunner(ctx.Subject, ctx.MaxPayload, &sourceConfig, kd.logger)
+		go runner.Run()
+		return runner, nil
 	case models.TaskTypeDest:
+		var driverConfig kafka3.KafkaConfig
+		if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+			return nil, err
+		}
 		runner := kafka3.NewKafkaRunner(ctx.Subject, ctx.Tp, ctx.MaxPayload, &driverConfig, kd.logger)
 		go runner.Run()
 		return runner, nil
@@ -38,6 +43,13 @@ func (kd *KafkaDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle,
 func (kd *KafkaDriver) Validate(task *models.Task) (*models.TaskValidateResponse, error) {
 	reply := &models.TaskValidateResponse{}
 
+	if task.Type == models.TaskTypeSrc {
+		var sourceConfig kafka3.KafkaSourceConfig
+		if err := mapstructure.WeakDecode(task.Config, &sourceConfig); err != nil {
+			return reply, err
+		}
+		return reply, sourceConfig.Validate()
+	}
 	return reply, nil
 }
 
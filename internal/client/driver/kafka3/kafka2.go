@@ -158,6 +158,53 @@ func NewEnvelopeSchema(tableIdent string, colDefs ColDefs) *Schema {
 	}
 }
 
+var (
+	SchemaChangeKeySchema = &Schema{
+		Type: SCHEMA_TYPE_STRUCT,
+		Fields: []*Schema{
+			NewSimpleSchemaField(SCHEMA_TYPE_STRING, false, "databaseName"),
+		},
+		Optional: false,
+		Name:     "io.debezium.connector.mysql.SchemaChangeKey",
+	}
+	SchemaChangeValueSchema = &Schema{
+		Type: SCHEMA_TYPE_STRUCT,
+		Fields: []*Schema{
+			SourceSchema,
+			NewSimpleSchemaField(SCHEMA_TYPE_STRING, false, "databaseName"),
+			NewSimpleSchemaField(SCHEMA_TYPE_STRING, false, "ddl"),
+		},
+		Optional: false,
+		Name:     "io.debezium.connector.mysql.SchemaChangeValue",
+	}
+)
+
+type SchemaChangePayload struct {
+	Source       *SourcePayload `json:"source"`
+	DatabaseName string         `json:"databaseName"`
+	DDL          string         `json:"ddl"`
+}
+
+// NewSchemaChangeOutputs returns the key and the value of the message of a
+// DDL, keyed by its database.
+func NewSchemaChangeOutputs(source *SourcePayload, databaseName string, ddl string) (key *DbzOutput, value *DbzOutput) {
+	keyPayload := NewRow()
+	keyPayload.AddField("databaseName", databaseName)
+	key = &DbzOutput{
+		Schema:  SchemaChangeKeySchema,
+		Payload: keyPayload,
+	}
+	value = &DbzOutput{
+		Schema: SchemaChangeValueSchema,
+		Payload: &SchemaChangePayload{
+			Source:       source,
+			DatabaseName: databaseName,
+			DDL:          ddl,
+		},
+	}
+	return key, value
+}
+
 type DbzOutput struct {
 	Schema *Schema `json:"schema"`
 	// ValuePayload or Row
@@ -2,6 +2,7 @@ package kafka3
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"testing"
 )
 
@@ -21,3 +22,36 @@ func TestTimeValue(t *testing.T) {
 	test("01:02:03",1,2,3,0,false)
 	test("-800:02:03.100000",800,2,3,100000,true)
 }
+
+func TestNewSchemaChangeOutputs(t *testing.T) {
+	k, v := NewSchemaChangeOutputs(&SourcePayload{Name: "dtle"}, "db1", "alter table tb1 add c int")
+	kBs, err := json.Marshal(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKey := `{"schema":{"type":"struct","optional":false,` +
+		`"fields":[{"type":"string","optional":false,"field":"databaseName"}],` +
+		`"name":"io.debezium.connector.mysql.SchemaChangeKey"},"payload":{"databaseName":"db1"}}`
+	if string(kBs) != wantKey {
+		t.Errorf("got key %s, want %s", kBs, wantKey)
+	}
+
+	vBs, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value struct {
+		Schema  *Schema
+		Payload *SchemaChangePayload
+	}
+	if err := json.Unmarshal(vBs, &value); err != nil {
+		t.Fatal(err)
+	}
+	if value.Schema.Name != "io.debezium.connector.mysql.SchemaChangeValue" || len(value.Schema.Fields) != 3 {
+		t.Errorf("value schema: %s", vBs)
+	}
+	if value.Payload.DatabaseName != "db1" || value.Payload.DDL != "alter table tb1 add c int" ||
+		value.Payload.Source.Name != "dtle" {
+		t.Errorf("value payload: %s", vBs)
+	}
+}
@@ -46,6 +46,9 @@ type KafkaRunner struct {
 	natsConn    *gonats.Conn
 	waitCh      chan *models.WaitResult
 
+	// the messages of the extractor received in chunks
+	msgChunks *mysqlDriver.ChunkAssembler
+
 	shutdown   bool
 	shutdownCh chan struct{}
 
@@ -65,6 +68,7 @@ func NewKafkaRunner(subject, tp string, maxPayload int, cfg *KafkaConfig, logger
 		logger:      entry,
 		waitCh:      make(chan *models.WaitResult, 1),
 		shutdownCh:  make(chan struct{}),
+		msgChunks:   mysqlDriver.NewChunkAssembler(),
 		tables:      make(map[string](map[string]*config.Table)),
 	}
 }
@@ -172,6 +176,12 @@ func (kr *KafkaRunner) initiateStreaming() error {
 	var err error
 
 	_, err = kr.natsConn.Subscribe(fmt.Sprintf("%s_full", kr.subject), func(m *gonats.Msg) {
+		if complete, err := kr.msgChunks.Assemble(kr.natsConn, m); !complete {
+			if err != nil {
+				kr.onError(TaskStateDead, err)
+			}
+			return
+		}
 		kr.logger.Debugf("kafka: recv a msg")
 		dumpData := &mysqlDriver.DumpEntry{}
 		if err := Decode(m.Data, dumpData); err != nil {
@@ -213,13 +223,23 @@ func (kr *KafkaRunner) initiateStreaming() error {
 	})
 
 	_, err = kr.natsConn.Subscribe(fmt.Sprintf("%s_incr_hete", kr.subject), func(m *gonats.Msg) {
+		if complete, err := kr.msgChunks.Assemble(kr.natsConn, m); !complete {
+			if err != nil {
+				kr.onError(TaskStateDead, err)
+			}
+			return
+		}
 		var binlogEntries binlog.BinlogEntries
 		if err := Decode(m.Data, &binlogEntries); err != nil {
 			kr.onError(TaskStateDead, err)
+			return
 		}
 
 		for _, binlogEntry := range binlogEntries.Entries {
-			err = kr.kafkaTransformDMLEventQuery(binlogEntry)
+			if err := kr.kafkaTransformDMLEventQuery(binlogEntry); err != nil {
+				kr.onError(TaskStateDead, err)
+				return
+			}
 		}
 
 		if err := kr.natsConn.Publish(m.Reply, nil); err != nil {
@@ -411,15 +431,24 @@ func (kr *KafkaRunner) kafkaTransformSnapshotData(table *config.Table, value *my
 func (kr *KafkaRunner) kafkaTransformDMLEventQuery(dmlEvent *binlog.BinlogEntry) (err error) {
 	for i, _ := range dmlEvent.Events {
 		dataEvent := &dmlEvent.Events[i]
-		// this must be executed before skipping DDL
+		if dataEvent.DML == binlog.NotDML {
+			if dataEvent.Statement {
+				return binlog.StatementNotApplied(dmlEvent, dataEvent, "Kafka")
+			}
+			// a query of no table is not a DDL
+			if dataEvent.DatabaseName != "" {
+				if err := kr.kafkaTransformDDLEvent(dmlEvent, dataEvent); err != nil {
+					return err
+				}
+			}
+			continue
+		}
 		table, err := kr.getOrSetTable(dataEvent.DatabaseName, dataEvent.TableName, dataEvent.Table)
 		if err != nil {
 			return err
 		}
-
-		// skipping DDL
-		if dataEvent.DML == binlog.NotDML {
-			continue
+		if len(dataEvent.JSONDiffs) > 0 {
+			return binlog.PartialUpdateNotApplied(dmlEvent, dataEvent, "Kafka")
 		}
 
 		var op string
@@ -647,6 +676,38 @@ func (kr *KafkaRunner) kafkaTransformDMLEventQuery(dmlEvent *binlog.BinlogEntry)
 	return nil
 }
 
+// kafkaTransformDDLEvent sends a DDL to the topic named Topic, where the
+// consumers follow the changes of the tables of all the databases.
+func (kr *KafkaRunner) kafkaTransformDDLEvent(dmlEvent *binlog.BinlogEntry, dataEvent *binlog.DataEvent) error {
+	source := &SourcePayload{
+		Version:  "0.0.1",
+		Name:     kr.kafkaMgr.Cfg.Topic,
+		ServerID: 1, // TODO
+		TsSec:    time.Now().Unix(),
+		Gtid:     dmlEvent.Coordinates.GetGtidForThisTx(),
+		File:     dmlEvent.Coordinates.LogFile,
+		Pos:      dataEvent.LogPos,
+		Query:    dataEvent.Query,
+		Db:       dataEvent.DatabaseName,
+		Table:    dataEvent.TableName,
+	}
+	k, v := NewSchemaChangeOutputs(source, dataEvent.DatabaseName, dataEvent.Query)
+	kBs, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	vBs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = kr.kafkaMgr.Send(kr.kafkaMgr.Cfg.Topic, kBs, vBs)
+	if err != nil {
+		return err
+	}
+	kr.logger.Debugf("kafka: sent a ddl. db: %v, table: %v", dataEvent.DatabaseName, dataEvent.TableName)
+	return nil
+}
+
 func getSetValue(num int64, set string) string {
 	if num == 0 {
 		return ""
@@ -0,0 +1,402 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package kafka3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	gonats "github.com/nats-io/go-nats"
+	"github.com/satori/go.uuid"
+
+	mysqlDriver "github.com/actiontech/dtle/internal/client/driver/mysql"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	InitialOffsetOldest = "oldest"
+	InitialOffsetNewest = "newest"
+
+	// messages sent to the applier at once
+	sourceBatchSize = 100
+	// a batch is sent when no more message arrives in the interval
+	sourceBatchInterval = 100 * time.Millisecond
+)
+
+// KafkaSourceConfig is the configuration of a 'Kafka' Src task, which consumes
+// the changes captured by Debezium or Canal, and sends them to a MySQL Dest
+// task with ApproveHeterogeneous.
+//
+// The offsets are committed to the consumer group once the applier receives
+// the changes. The changes received but not applied before a crash are
+// consumed again, and the applier skips those already applied. New partitions
+// are consumed after a restart.
+type KafkaSourceConfig struct {
+	Brokers []string
+	Topics  []string
+	// "debezium" (default): messages of the JSON converter, with or without the schema
+	// "canal": flat messages
+	Format string
+	// consumer group of the committed offsets. Defaults to the job name
+	Group string
+	// offset of the partitions having no committed offset: "oldest" or "newest" (default)
+	InitialOffset string
+	// time zone of the values converted from Debezium ZonedTimestamp. Defaults to UTC
+	TimeZone string
+
+	NatsAddr string
+	Gtid     string
+}
+
+// Validate checks the configuration and sets the defaults.
+func (c *KafkaSourceConfig) Validate() error {
+	if len(c.Brokers) == 0 {
+		return fmt.Errorf("Brokers is required for a Kafka source")
+	}
+	if len(c.Topics) == 0 {
+		return fmt.Errorf("Topics is required for a Kafka source")
+	}
+	switch c.Format {
+	case "":
+		c.Format = FormatDebezium
+	case FormatDebezium, FormatCanal:
+	default:
+		return fmt.Errorf("unknown Format %q, must be %q or %q", c.Format, FormatDebezium, FormatCanal)
+	}
+	switch c.InitialOffset {
+	case "":
+		c.InitialOffset = InitialOffsetNewest
+	case InitialOffsetOldest, InitialOffsetNewest:
+	default:
+		return fmt.Errorf("unknown InitialOffset %q, must be %q or %q", c.InitialOffset, InitialOffsetOldest, InitialOffsetNewest)
+	}
+	if c.TimeZone == "" {
+		c.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(c.TimeZone); err != nil {
+		return fmt.Errorf("bad TimeZone: %v", err)
+	}
+	return nil
+}
+
+type KafkaSourceRunner struct {
+	logger     *log.Entry
+	subject    string
+	maxPayload int
+	cfg        *KafkaSourceConfig
+	decoder    *sourceDecoder
+	natsConn   *gonats.Conn
+	waitCh     chan *models.WaitResult
+
+	shutdown     bool
+	shutdownCh   chan struct{}
+	shutdownLock sync.Mutex
+
+	client    sarama.Client
+	offsetMgr sarama.OffsetManager
+	// partition consumers and offset managers, closed on shutdown
+	closers []io.Closer
+
+	nTx int64
+}
+
+func NewKafkaSourceRunner(subject string, maxPayload int, cfg *KafkaSourceConfig, logger *log.Logger) *KafkaSourceRunner {
+	entry := log.NewEntry(logger).WithFields(log.Fields{
+		"job": subject,
+	})
+	return &KafkaSourceRunner{
+		subject:    subject,
+		maxPayload: maxPayload,
+		cfg:        cfg,
+		logger:     entry,
+		waitCh:     make(chan *models.WaitResult, 1),
+		shutdownCh: make(chan struct{}),
+	}
+}
+
+func (r *KafkaSourceRunner) ID() string {
+	id := config.DriverCtx{
+		DriverConfig: &config.MySQLDriverConfig{
+			NatsAddr: r.cfg.NatsAddr,
+		},
+	}
+
+	data, err := json.Marshal(id)
+	if err != nil {
+		r.logger.Errorf("kafka.source: Failed to marshal ID to JSON: %s", err)
+	}
+	return string(data)
+}
+
+func (r *KafkaSourceRunner) WaitCh() chan *models.WaitResult {
+	return r.waitCh
+}
+
+func (r *KafkaSourceRunner) Shutdown() error {
+	r.shutdownLock.Lock()
+	defer r.shutdownLock.Unlock()
+	if r.shutdown {
+		return nil
+	}
+	r.shutdown = true
+	close(r.shutdownCh)
+
+	// closing the offset managers commits the marked offsets
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil {
+			r.logger.Warnf("kafka.source: close: %v", err)
+		}
+	}
+	if r.offsetMgr != nil {
+		r.offsetMgr.Close()
+	}
+	if r.client != nil {
+		r.client.Close()
+	}
+	if r.natsConn != nil {
+		r.natsConn.Close()
+	}
+
+	r.logger.Printf("kafka.source: Shutting down")
+	return nil
+}
+
+func (r *KafkaSourceRunner) Stats() (*models.TaskStatistics, error) {
+	taskResUsage := &models.TaskStatistics{
+		ExecMasterTxCount: atomic.LoadInt64(&r.nTx),
+		Stage:             models.StageSendingBinlogEventToSlave,
+		Timestamp:         time.Now().UTC().UnixNano(),
+	}
+	taskResUsage.MsgStat = gonats.Statistics{}
+	if r.natsConn != nil {
+		taskResUsage.MsgStat = r.natsConn.Statistics
+	}
+	return taskResUsage, nil
+}
+
+func (r *KafkaSourceRunner) Run() {
+	if err := r.cfg.Validate(); err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+	loc, _ := time.LoadLocation(r.cfg.TimeZone)
+	r.decoder = &sourceDecoder{format: r.cfg.Format, loc: loc}
+
+	natsAddr := fmt.Sprintf("nats://%s", r.cfg.NatsAddr)
+	sc, err := gonats.Connect(natsAddr)
+	if err != nil {
+		r.logger.Errorf("kafka.source: Can't connect nats server %v. make sure a nats streaming server is running.%v", natsAddr, err)
+		r.onError(TaskStateDead, err)
+		return
+	}
+	r.logger.Debugf("kafka.source: Connect nats server %v", natsAddr)
+	r.natsConn = sc
+
+	if err := r.subscribeApplier(); err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+	if err := r.initiateConsuming(); err != nil {
+		r.onError(TaskStateRestart, err)
+		return
+	}
+}
+
+func (r *KafkaSourceRunner) subscribeApplier() error {
+	_, err := r.natsConn.Subscribe(fmt.Sprintf("%s_restart", r.subject), func(m *gonats.Msg) {
+		r.onError(TaskStateRestart, fmt.Errorf("restart"))
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.natsConn.Subscribe(fmt.Sprintf("%s_error", r.subject), func(m *gonats.Msg) {
+		r.onError(TaskStateDead, fmt.Errorf("applier"))
+	})
+	return err
+}
+
+func (r *KafkaSourceRunner) initiateConsuming() (err error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Version = sarama.V0_10_0_0
+	saramaConfig.Consumer.Return.Errors = true
+	if r.cfg.InitialOffset == InitialOffsetOldest {
+		saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	} else {
+		saramaConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+	}
+	group := r.cfg.Group
+	if group == "" {
+		group = r.subject
+	}
+
+	client, err := sarama.NewClient(r.cfg.Brokers, saramaConfig)
+	if err != nil {
+		return err
+	}
+	r.shutdownLock.Lock()
+	defer r.shutdownLock.Unlock()
+	if r.shutdown {
+		return client.Close()
+	}
+	r.client = client
+	consumer, err := sarama.NewConsumerFromClient(r.client)
+	if err != nil {
+		return err
+	}
+	if r.offsetMgr, err = sarama.NewOffsetManagerFromClient(group, r.client); err != nil {
+		return err
+	}
+
+	for _, topic := range r.cfg.Topics {
+		partitions, err := r.client.Partitions(topic)
+		if err != nil {
+			return err
+		}
+		for _, partition := range partitions {
+			pom, err := r.offsetMgr.ManagePartition(topic, partition)
+			if err != nil {
+				return err
+			}
+			r.closers = append(r.closers, pom)
+			offset, _ := pom.NextOffset()
+			pc, err := consumer.ConsumePartition(topic, partition, offset)
+			if err != nil {
+				return fmt.Errorf("consume %v-%v from %v: %v", topic, partition, offset, err)
+			}
+			r.closers = append(r.closers, pc)
+			r.logger.Printf("kafka.source: consume %v-%v from %v", topic, partition, offset)
+			go r.consumePartition(pc, pom)
+		}
+	}
+	return nil
+}
+
+// consumePartition sends the changes of a partition in batches, and marks
+// the offsets once the applier receives them.
+func (r *KafkaSourceRunner) consumePartition(pc sarama.PartitionConsumer, pom sarama.PartitionOffsetManager) {
+	var entries []*binlog.BinlogEntry
+	var batchBytes int
+	next := int64(-1)
+	flush := func() error {
+		if len(entries) > 0 {
+			if err := r.publish(entries); err != nil {
+				return err
+			}
+			atomic.AddInt64(&r.nTx, int64(len(entries)))
+		}
+		if next >= 0 {
+			pom.MarkOffset(next, "")
+		}
+		entries, batchBytes, next = nil, 0, -1
+		return nil
+	}
+
+	ticker := time.NewTicker(sourceBatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.shutdownCh:
+			return
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return
+			}
+			entry, err := r.decoder.binlogEntry(msg)
+			if err != nil {
+				r.onError(TaskStateDead, fmt.Errorf("%v-%v offset %v: %v", msg.Topic, msg.Partition, msg.Offset, err))
+				return
+			}
+			entries = append(entries, entry)
+			batchBytes += len(msg.Value)
+			next = msg.Offset + 1
+			if len(entries) >= sourceBatchSize || (r.maxPayload > 0 && batchBytes >= r.maxPayload/2) {
+				if err := flush(); err != nil {
+					r.onError(TaskStateRestart, err)
+					return
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				r.onError(TaskStateRestart, err)
+				return
+			}
+		case err := <-pc.Errors():
+			r.onError(TaskStateRestart, err)
+			return
+		case err := <-pom.Errors():
+			r.logger.Warnf("kafka.source: commit offset: %v", err)
+		}
+	}
+}
+
+// binlogEntry converts a message to a binlog entry. Each partition is a
+// source of GTIDs, with the offset as GNO. A message of no change, e.g. a
+// tombstone, is an entry of no event, applied as an empty transaction for the
+// GTIDs of the partition to stay contiguous on the applier.
+func (d *sourceDecoder) binlogEntry(msg *sarama.ConsumerMessage) (*binlog.BinlogEntry, error) {
+	events, ts, err := d.decode(msg.Value)
+	if err != nil {
+		return nil, err
+	}
+	entry := binlog.NewBinlogEntryAt(base.BinlogCoordinateTx{
+		LogFile:        fmt.Sprintf("%s-%d", msg.Topic, msg.Partition),
+		LogPos:         msg.Offset,
+		SID:            partitionSID(msg.Topic, msg.Partition),
+		GNO:            msg.Offset + 1,
+		EventTimestamp: uint32(ts),
+	})
+	entry.Events = events
+	entry.OriginalSize = len(msg.Value)
+	return entry, nil
+}
+
+func partitionSID(topic string, partition int32) uuid.UUID {
+	return uuid.NewV5(uuid.NamespaceURL, fmt.Sprintf("kafka:%s/%d", topic, partition))
+}
+
+// publish sends the entries to the applier, waiting while its queue is full.
+func (r *KafkaSourceRunner) publish(entries []*binlog.BinlogEntry) error {
+	txMsg, err := mysqlDriver.Encode(&binlog.BinlogEntries{Entries: entries})
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("%s_incr_hete", r.subject)
+	for {
+		_, err = r.natsConn.Request(subject, txMsg, mysqlDriver.DefaultConnectWait)
+		if err != gonats.ErrTimeout {
+			return err
+		}
+		r.logger.Debugf("kafka.source: publish timeout, retry")
+		select {
+		case <-r.shutdownCh:
+			return fmt.Errorf("shutdown")
+		default:
+		}
+	}
+}
+
+func (r *KafkaSourceRunner) onError(state int, err error) {
+	if state == TaskStateComplete {
+		r.logger.Printf("kafka.source: Done")
+	} else {
+		r.logger.Errorf("kafka.source: %v", err)
+	}
+	if r.shutdown {
+		return
+	}
+	r.waitCh <- models.NewWaitResult(state, err)
+	r.Shutdown()
+}
@@ -0,0 +1,445 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package kafka3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	usql "github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+const (
+	FormatDebezium = "debezium"
+	FormatCanal    = "canal"
+
+	RECORD_OP_TRUNCATE = "t"
+)
+
+// sourceDecoder converts the messages of a Kafka source to the events of binlog entries.
+type sourceDecoder struct {
+	format string
+	// location of the DATETIME values converted from Debezium ZonedTimestamp
+	loc *time.Location
+}
+
+// decode returns the events of a message, and the unix time of the change on
+// the source. There are no events for tombstones or messages of no change.
+func (d *sourceDecoder) decode(value []byte) ([]binlog.DataEvent, int64, error) {
+	if len(value) == 0 {
+		return nil, 0, nil
+	}
+	switch d.format {
+	case FormatCanal:
+		return d.decodeCanal(value)
+	default:
+		return d.decodeDebezium(value)
+	}
+}
+
+func unmarshalUseNumber(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+type debeziumPayload struct {
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+	Source struct {
+		Db    string `json:"db"`
+		Table string `json:"table"`
+	} `json:"source"`
+	Op   string `json:"op"`
+	TsMs int64  `json:"ts_ms"`
+}
+
+// decodeDebezium decodes a message of the JSON converter, with or without the
+// schema. Only values of the schema are converted from their logical types.
+func (d *sourceDecoder) decodeDebezium(value []byte) ([]binlog.DataEvent, int64, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return nil, 0, err
+	}
+	var schema *Schema
+	payloadBs := value
+	if p, ok := envelope["payload"]; ok {
+		if _, ok := envelope["schema"]; ok {
+			payloadBs = p
+			if err := json.Unmarshal(envelope["schema"], &schema); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	if string(payloadBs) == "null" {
+		return nil, 0, nil
+	}
+
+	payload := &debeziumPayload{}
+	if err := unmarshalUseNumber(payloadBs, payload); err != nil {
+		return nil, 0, err
+	}
+	db, table := payload.Source.Db, payload.Source.Table
+	ts := payload.TsMs / 1000
+
+	var dml binlog.EventDML
+	switch payload.Op {
+	case RECORD_OP_INSERT, RECORD_OP_READ:
+		dml = binlog.InsertDML
+	case RECORD_OP_UPDATE:
+		dml = binlog.UpdateDML
+	case RECORD_OP_DELETE:
+		dml = binlog.DeleteDML
+	case RECORD_OP_TRUNCATE:
+		query := fmt.Sprintf("truncate table %s.%s", usql.EscapeName(db), usql.EscapeName(table))
+		return []binlog.DataEvent{binlog.NewQueryEventAffectTable(db, query, binlog.NotDML,
+			binlog.SchemaTable{Schema: db, Table: table})}, ts, nil
+	default:
+		// e.g. messages of the schema change topic or heartbeats
+		return nil, 0, nil
+	}
+	if db == "" || table == "" {
+		return nil, 0, fmt.Errorf("debezium: no source.db or source.table")
+	}
+
+	rowSchema := func(field string) *Schema {
+		if schema == nil {
+			return nil
+		}
+		for _, f := range schema.Fields {
+			if f.Field == field {
+				return f
+			}
+		}
+		return nil
+	}
+	names := debeziumColumns(rowSchema("after"), payload.After)
+	if len(names) == 0 {
+		names = debeziumColumns(rowSchema("before"), payload.Before)
+	}
+
+	event := binlog.NewDataEvent(db, table, dml, len(names))
+	event.ColumnNames = names
+	var err error
+	if dml != binlog.InsertDML {
+		if payload.Before == nil {
+			return nil, 0, fmt.Errorf("debezium: no before image of %v on %v.%v", payload.Op, db, table)
+		}
+		if event.WhereColumnValues, err = d.debeziumRow(rowSchema("before"), names, payload.Before); err != nil {
+			return nil, 0, err
+		}
+	}
+	if dml != binlog.DeleteDML {
+		if payload.After == nil {
+			return nil, 0, fmt.Errorf("debezium: no after image of %v on %v.%v", payload.Op, db, table)
+		}
+		if event.NewColumnValues, err = d.debeziumRow(rowSchema("after"), names, payload.After); err != nil {
+			return nil, 0, err
+		}
+	}
+	return []binlog.DataEvent{event}, ts, nil
+}
+
+// debeziumColumns returns the columns in the order of the schema if any.
+func debeziumColumns(schema *Schema, row map[string]interface{}) []string {
+	var names []string
+	if schema != nil {
+		for _, f := range schema.Fields {
+			names = append(names, f.Field)
+		}
+		return names
+	}
+	for name := range row {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (d *sourceDecoder) debeziumRow(schema *Schema, names []string, row map[string]interface{}) (*umconf.ColumnValues, error) {
+	fields := make(map[string]*Schema)
+	if schema != nil {
+		for _, f := range schema.Fields {
+			fields[f.Field] = f
+		}
+	}
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		v, err := d.debeziumValue(fields[name], row[name])
+		if err != nil {
+			return nil, fmt.Errorf("debezium: column %v: %v", name, err)
+		}
+		values[i] = v
+	}
+	return umconf.ToColumnValues(values), nil
+}
+
+// debeziumValue converts a value of a field to what the applier binds.
+// Temporal values are sent as strings in the format of MySQL.
+func (d *sourceDecoder) debeziumValue(field *Schema, v interface{}) (interface{}, error) {
+	if v == nil || field == nil {
+		return jsonValue(v), nil
+	}
+	integer := func() (int64, error) {
+		n, ok := v.(json.Number)
+		if !ok {
+			return 0, fmt.Errorf("%v is not a number", v)
+		}
+		return n.Int64()
+	}
+	base64Bytes := func() ([]byte, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not base64", v)
+		}
+		return base64.StdEncoding.DecodeString(s)
+	}
+
+	switch field.Name {
+	case "io.debezium.time.Date", "org.apache.kafka.connect.data.Date":
+		days, err := integer()
+		if err != nil {
+			return nil, err
+		}
+		return time.Unix(days*24*3600, 0).UTC().Format("2006-01-02"), nil
+	case "io.debezium.time.Timestamp", "org.apache.kafka.connect.data.Timestamp":
+		ms, err := integer()
+		if err != nil {
+			return nil, err
+		}
+		return formatDateTime(time.Unix(0, ms*int64(time.Millisecond)).UTC()), nil
+	case "io.debezium.time.MicroTimestamp":
+		us, err := integer()
+		if err != nil {
+			return nil, err
+		}
+		return formatDateTime(time.Unix(0, us*int64(time.Microsecond)).UTC()), nil
+	case "io.debezium.time.NanoTimestamp":
+		ns, err := integer()
+		if err != nil {
+			return nil, err
+		}
+		return formatDateTime(time.Unix(0, ns).UTC()), nil
+	case "io.debezium.time.ZonedTimestamp":
+		s, _ := v.(string)
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, err
+		}
+		return formatDateTime(t.In(d.loc)), nil
+	case "io.debezium.time.Time", "org.apache.kafka.connect.data.Time":
+		ms, err := integer()
+		if err != nil {
+			return nil, err
+		}
+		return formatTime(time.Duration(ms) * time.Millisecond), nil
+	case "io.debezium.time.MicroTime":
+		us, err := integer()
+		if err != nil {
+			return nil, err
+		}
+		return formatTime(time.Duration(us) * time.Microsecond), nil
+	case "io.debezium.time.NanoTime":
+		ns, err := integer()
+		if err != nil {
+			return nil, err
+		}
+		return formatTime(time.Duration(ns)), nil
+	case "org.apache.kafka.connect.data.Decimal":
+		bs, err := base64Bytes()
+		if err != nil {
+			return nil, err
+		}
+		scale, err := strconv.Atoi(fmt.Sprint(field.Parameters["scale"]))
+		if err != nil {
+			return nil, fmt.Errorf("bad decimal scale %v", field.Parameters["scale"])
+		}
+		return decimalString(bs, scale), nil
+	case "io.debezium.data.Bits":
+		bs, err := base64Bytes()
+		if err != nil {
+			return nil, err
+		}
+		// little-endian in Debezium, big-endian in MySQL
+		for i, j := 0, len(bs)-1; i < j; i, j = i+1, j-1 {
+			bs[i], bs[j] = bs[j], bs[i]
+		}
+		return bs, nil
+	}
+	if field.Type == SCHEMA_TYPE_BYTES {
+		return base64Bytes()
+	}
+	return jsonValue(v), nil
+}
+
+// jsonValue converts a value decoded with UseNumber. Objects and arrays, e.g.
+// JSON columns of Canal, are sent as their JSON text.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		// decimals keep their precision as strings
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		bs, _ := json.Marshal(v)
+		return string(bs)
+	default:
+		return v
+	}
+}
+
+func formatDateTime(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05.999999")
+}
+
+// formatTime formats a MySQL TIME, which might be negative or over 24 hours.
+func formatTime(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	us := int64(d / time.Microsecond)
+	s := fmt.Sprintf("%s%02d:%02d:%02d", sign, us/3600e6, us/60e6%60, us/1e6%60)
+	if us%1e6 != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%06d", us%1e6), "0")
+	}
+	return s
+}
+
+// decimalString formats the unscaled two's-complement big-endian value of a
+// connect Decimal.
+func decimalString(bs []byte, scale int) string {
+	n := new(big.Int).SetBytes(bs)
+	if len(bs) > 0 && bs[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(bs)*8)))
+	}
+	sign := ""
+	if n.Sign() < 0 {
+		sign = "-"
+		n.Neg(n)
+	}
+	digits := n.String()
+	if scale <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+type canalMessage struct {
+	Data      []map[string]interface{} `json:"data"`
+	Old       []map[string]interface{} `json:"old"`
+	Database  string                   `json:"database"`
+	Table     string                   `json:"table"`
+	Type      string                   `json:"type"`
+	IsDdl     bool                     `json:"isDdl"`
+	Sql       string                   `json:"sql"`
+	Es        int64                    `json:"es"`
+	MysqlType map[string]string        `json:"mysqlType"`
+}
+
+// decodeCanal decodes a flat message of Canal, which has the rows of a binlog
+// event. Canal sends the values as strings, and binary strings in ISO-8859-1.
+func (d *sourceDecoder) decodeCanal(value []byte) ([]binlog.DataEvent, int64, error) {
+	msg := &canalMessage{}
+	if err := unmarshalUseNumber(value, msg); err != nil {
+		return nil, 0, err
+	}
+	ts := msg.Es / 1000
+	if msg.IsDdl {
+		if msg.Sql == "" {
+			return nil, 0, nil
+		}
+		return []binlog.DataEvent{binlog.NewQueryEventAffectTable(msg.Database, msg.Sql, binlog.NotDML,
+			binlog.SchemaTable{Schema: msg.Database, Table: msg.Table})}, ts, nil
+	}
+
+	var dml binlog.EventDML
+	switch msg.Type {
+	case "INSERT":
+		dml = binlog.InsertDML
+	case "UPDATE":
+		dml = binlog.UpdateDML
+	case "DELETE":
+		dml = binlog.DeleteDML
+	default:
+		return nil, 0, nil
+	}
+	if msg.Database == "" || msg.Table == "" {
+		return nil, 0, fmt.Errorf("canal: no database or table")
+	}
+	if dml == binlog.UpdateDML && len(msg.Old) != len(msg.Data) {
+		return nil, 0, fmt.Errorf("canal: %d old rows for %d rows", len(msg.Old), len(msg.Data))
+	}
+
+	var events []binlog.DataEvent
+	for i, row := range msg.Data {
+		var names []string
+		for name := range row {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		event := binlog.NewDataEvent(msg.Database, msg.Table, dml, len(names))
+		event.ColumnNames = names
+		values := d.canalRow(msg.MysqlType, names, row)
+		switch dml {
+		case binlog.InsertDML:
+			event.NewColumnValues = values
+		case binlog.DeleteDML:
+			event.WhereColumnValues = values
+		case binlog.UpdateDML:
+			// old has the columns changed only
+			before := make(map[string]interface{}, len(row))
+			for name, v := range row {
+				before[name] = v
+			}
+			for name, v := range msg.Old[i] {
+				before[name] = v
+			}
+			event.WhereColumnValues = d.canalRow(msg.MysqlType, names, before)
+			event.NewColumnValues = values
+		}
+		events = append(events, event)
+	}
+	return events, ts, nil
+}
+
+func (d *sourceDecoder) canalRow(mysqlType map[string]string, names []string, row map[string]interface{}) *umconf.ColumnValues {
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		v := jsonValue(row[name])
+		if s, ok := v.(string); ok && isBinaryType(mysqlType[name]) {
+			bs := make([]byte, 0, len(s))
+			for _, r := range s {
+				bs = append(bs, byte(r))
+			}
+			v = bs
+		}
+		values[i] = v
+	}
+	return umconf.ToColumnValues(values)
+}
+
+func isBinaryType(columnType string) bool {
+	columnType = strings.ToLower(columnType)
+	return strings.Contains(columnType, "blob") || strings.Contains(columnType, "binary")
+}
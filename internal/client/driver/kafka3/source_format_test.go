@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package kafka3
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func values(cv *umconf.ColumnValues) []interface{} {
+	if cv == nil {
+		return nil
+	}
+	var vs []interface{}
+	for _, v := range cv.GetAbstractValues() {
+		vs = append(vs, *v)
+	}
+	return vs
+}
+
+func TestDecodeDebezium(t *testing.T) {
+	d := &sourceDecoder{format: FormatDebezium, loc: time.UTC}
+
+	withSchema := `{"schema":{"type":"struct","fields":[
+		{"type":"struct","field":"before","fields":[
+			{"type":"int64","field":"id"},
+			{"type":"bytes","name":"org.apache.kafka.connect.data.Decimal","parameters":{"scale":"2"},"field":"price"},
+			{"type":"int32","name":"io.debezium.time.Date","field":"d"},
+			{"type":"int64","name":"io.debezium.time.Timestamp","field":"dt"},
+			{"type":"int64","name":"io.debezium.time.MicroTime","field":"tm"},
+			{"type":"bytes","field":"b"}]},
+		{"type":"struct","field":"after","fields":[
+			{"type":"int64","field":"id"},
+			{"type":"bytes","name":"org.apache.kafka.connect.data.Decimal","parameters":{"scale":"2"},"field":"price"},
+			{"type":"int32","name":"io.debezium.time.Date","field":"d"},
+			{"type":"int64","name":"io.debezium.time.Timestamp","field":"dt"},
+			{"type":"int64","name":"io.debezium.time.MicroTime","field":"tm"},
+			{"type":"bytes","field":"b"}]}]},
+		"payload":{"before":{"id":1,"price":"AQ==","d":0,"dt":0,"tm":0,"b":null},
+			"after":{"id":1,"price":"/oI=","d":18000,"dt":1555200000123,"tm":-3723500000,"b":"AAE="},
+			"source":{"db":"db1","table":"t1"},"op":"u","ts_ms":1555200001000}}`
+	events, ts, err := d.decode([]byte(withSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || ts != 1555200001 {
+		t.Fatalf("events = %v, ts = %v", events, ts)
+	}
+	e := events[0]
+	if e.DML != binlog.UpdateDML || e.DatabaseName != "db1" || e.TableName != "t1" {
+		t.Errorf("event = %v", e.String())
+	}
+	if want := []string{"id", "price", "d", "dt", "tm", "b"}; !reflect.DeepEqual(e.ColumnNames, want) {
+		t.Errorf("ColumnNames = %v, want %v", e.ColumnNames, want)
+	}
+	if got, want := values(e.WhereColumnValues), []interface{}{int64(1), "0.01", "1970-01-01", "1970-01-01 00:00:00", "00:00:00", nil}; !reflect.DeepEqual(got, want) {
+		t.Errorf("before = %#v, want %#v", got, want)
+	}
+	if got, want := values(e.NewColumnValues), []interface{}{int64(1), "-3.82", "2019-04-14", "2019-04-14 00:00:00.123", "-01:02:03.5", []byte{0, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after = %#v, want %#v", got, want)
+	}
+
+	// without the schema, the columns are sorted
+	events, _, err = d.decode([]byte(`{"before":{"id":2,"name":"x"},"after":null,"source":{"db":"db1","table":"t1"},"op":"d"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].DML != binlog.DeleteDML || !reflect.DeepEqual(events[0].ColumnNames, []string{"id", "name"}) {
+		t.Fatalf("events = %+v", events)
+	}
+	if got, want := values(events[0].WhereColumnValues), []interface{}{int64(2), "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("before = %#v, want %#v", got, want)
+	}
+
+	events, _, err = d.decode([]byte(`{"source":{"db":"db1","table":"t1"},"op":"t"}`))
+	if err != nil || len(events) != 1 || events[0].DML != binlog.NotDML || events[0].Query != "truncate table `db1`.`t1`" {
+		t.Errorf("truncate: %+v, %v", events, err)
+	}
+
+	for _, msg := range []string{"", `{"schema":{},"payload":null}`, `{"databaseName":"db1","ddl":"create table t1 (id int)"}`} {
+		events, _, err := d.decode([]byte(msg))
+		if err != nil || len(events) != 0 {
+			t.Errorf("decode(%q) = %v, %v", msg, events, err)
+		}
+	}
+	if _, _, err := d.decode([]byte(`{"after":{"id":1},"source":{},"op":"c"}`)); err == nil {
+		t.Errorf("decode() should fail without source.db")
+	}
+}
+
+func TestDecodeCanal(t *testing.T) {
+	d := &sourceDecoder{format: FormatCanal, loc: time.UTC}
+
+	events, ts, err := d.decode([]byte(`{"data":[{"id":"1","name":"b","bin":"ÿ\u0001"},{"id":"2","name":"c","bin":null}],
+		"old":[{"name":"a"},{"name":"d"}],"database":"db1","table":"t1","type":"UPDATE","isDdl":false,"es":1555200001000,
+		"mysqlType":{"id":"int(11)","name":"varchar(10)","bin":"varbinary(10)"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || ts != 1555200001 {
+		t.Fatalf("events = %v, ts = %v", events, ts)
+	}
+	if want := []string{"bin", "id", "name"}; !reflect.DeepEqual(events[0].ColumnNames, want) {
+		t.Errorf("ColumnNames = %v, want %v", events[0].ColumnNames, want)
+	}
+	if got, want := values(events[0].WhereColumnValues), []interface{}{[]byte{0xff, 1}, "1", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("before = %#v, want %#v", got, want)
+	}
+	if got, want := values(events[0].NewColumnValues), []interface{}{[]byte{0xff, 1}, "1", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after = %#v, want %#v", got, want)
+	}
+	if got, want := values(events[1].WhereColumnValues), []interface{}{nil, "2", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("before = %#v, want %#v", got, want)
+	}
+
+	events, _, err = d.decode([]byte(`{"data":null,"database":"db1","table":"t1","type":"ALTER","isDdl":true,"sql":"alter table t1 add c int"}`))
+	if err != nil || len(events) != 1 || events[0].DML != binlog.NotDML || events[0].CurrentSchema != "db1" {
+		t.Errorf("ddl: %+v, %v", events, err)
+	}
+
+	if _, _, err := d.decode([]byte(`{"data":[{"id":"1"}],"old":[],"database":"db1","table":"t1","type":"UPDATE"}`)); err == nil {
+		t.Errorf("decode() should fail without the old rows")
+	}
+}
+
+func TestDecimalString(t *testing.T) {
+	for _, c := range []struct {
+		bs    []byte
+		scale int
+		want  string
+	}{
+		{[]byte{0}, 0, "0"},
+		{[]byte{0x30, 0x39}, 2, "123.45"},
+		{[]byte{0xcf, 0xc7}, 2, "-123.45"},
+		{[]byte{0x05}, 3, "0.005"},
+		{[]byte{0x00, 0x80}, 0, "128"},
+	} {
+		if got := decimalString(c.bs, c.scale); got != c.want {
+			t.Errorf("decimalString(%v, %v) = %v, want %v", c.bs, c.scale, got, c.want)
+		}
+	}
+}
+
+func TestSourceDecoder_binlogEntry(t *testing.T) {
+	d := &sourceDecoder{format: FormatDebezium, loc: time.UTC}
+	msg := &sarama.ConsumerMessage{
+		Topic:     "dbserver1.db1.t1",
+		Partition: 2,
+		Offset:    41,
+		Value:     []byte(`{"after":{"id":1},"source":{"db":"db1","table":"t1"},"op":"c","ts_ms":1000}`),
+	}
+	entry, err := d.binlogEntry(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := entry.Coordinates
+	if c.SID != partitionSID("dbserver1.db1.t1", 2) || c.GNO != 42 || c.SeqenceNumber != 0 || c.EventTimestamp != 1 {
+		t.Errorf("coordinates = %+v", c)
+	}
+	if partitionSID("dbserver1.db1.t1", 2) == partitionSID("dbserver1.db1.t1", 1) {
+		t.Errorf("partitions should have their own SID")
+	}
+
+	// the GNO of a tombstone is executed too
+	msg.Value = nil
+	msg.Offset = 42
+	if entry, err := d.binlogEntry(msg); err != nil || len(entry.Events) != 0 || entry.Coordinates.GNO != 43 {
+		t.Errorf("binlogEntry() of a tombstone = %v, %v", entry, err)
+	}
+}
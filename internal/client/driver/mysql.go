@@ -7,7 +7,9 @@
 package driver
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/mitchellh/mapstructure"
@@ -34,18 +36,40 @@ func NewMySQLDriver(ctx *DriverContext) Driver {
 func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse, error) {
 	var driverConfig config.MySQLDriverConfig
 	reply := &models.TaskValidateResponse{}
+	if models.IsStepTask(task.Type) {
+		// a step connects with the configs of the Src and Dest tasks
+		var stepConfig config.StepConfig
+		if err := mapstructure.WeakDecode(task.Config, &stepConfig); err != nil {
+			return reply, err
+		}
+		return reply, stepConfig.Validate(task.Type)
+	}
 	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
 		return reply, err
 	}
-	uri := driverConfig.ConnectionConfig.GetDBUri()
+	if _, err := models.NewThrottleSchedule(driverConfig.ThrottleWindows); err != nil {
+		return reply, err
+	}
+	if _, err := config.NewTableFilter(driverConfig.ReplicateDoDb, driverConfig.ReplicateIgnoreDb); err != nil {
+		return reply, err
+	}
+	cc := driverConfig.ConnectionConfig
+	if task.Type == models.TaskTypeSrc {
+		// the binlog is checked on the server behind a proxy
+		cc = cc.Direct()
+	}
+	uri := cc.GetDBUri()
 	db, err := usql.CreateDB(uri)
 	if err != nil {
 		return reply, err
 	}
+	// bounds the checks together, not to keep the caller on a hung server
+	ctx, cancel := context.WithTimeout(context.Background(), driverConfig.QueryTimeout())
+	defer cancel()
 
 	query := `select @@global.version`
 	var mysqlVersion string
-	if err := db.QueryRow(query).Scan(&mysqlVersion); err != nil {
+	if err := db.QueryRowContext(ctx, query).Scan(&mysqlVersion); err != nil {
 		reply.Connection.Success = false
 		reply.Connection.Error = err.Error()
 	} else {
@@ -71,7 +95,7 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 
 		query = `SELECT @@GTID_MODE`
 		var gtidMode string
-		if err := db.QueryRow(query).Scan(&gtidMode); err != nil {
+		if err := db.QueryRowContext(ctx, query).Scan(&gtidMode); err != nil {
 			reply.GtidMode.Success = false
 			reply.GtidMode.Error = err.Error()
 		}
@@ -79,7 +103,7 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 			reply.GtidMode.Success = false
 			reply.GtidMode.Error = fmt.Sprintf("Must have GTID enabled: %+v", gtidMode)
 		} else {
-			rows, err := db.Query("show master status")
+			rows, err := db.QueryContext(ctx, "show master status")
 			if err != nil {
 				reply.GtidMode.Success = false
 				reply.GtidMode.Error = err.Error()
@@ -96,7 +120,7 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 
 		query = `SELECT @@SERVER_ID`
 		var serverID string
-		if err := db.QueryRow(query).Scan(&serverID); err != nil {
+		if err := db.QueryRowContext(ctx, query).Scan(&serverID); err != nil {
 			reply.ServerID.Success = false
 			reply.ServerID.Error = err.Error()
 		}
@@ -110,16 +134,16 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 
 		query = `select @@global.log_bin, @@global.binlog_format`
 		var hasBinaryLogs bool
-		if err := db.QueryRow(query).Scan(&hasBinaryLogs, &driverConfig.BinlogFormat); err != nil {
+		if err := db.QueryRowContext(ctx, query).Scan(&hasBinaryLogs, &driverConfig.BinlogFormat); err != nil {
 			reply.Binlog.Success = false
 			reply.Binlog.Error = err.Error()
 		}
 		if !hasBinaryLogs {
 			reply.Binlog.Success = false
-			reply.Binlog.Error = fmt.Sprintf("%s:%d must have binary logs enabled", driverConfig.ConnectionConfig.Host, driverConfig.ConnectionConfig.Port)
+			reply.Binlog.Error = fmt.Sprintf("%s:%d must have binary logs enabled", cc.Host, cc.Port)
 		} else if driverConfig.RequiresBinlogFormatChange() {
 			reply.Binlog.Success = false
-			reply.Binlog.Error = fmt.Sprintf("You must be using ROW binlog format. I can switch it for you, provided --switch-to-rbr and that %s:%d doesn't have replicas", driverConfig.ConnectionConfig.Host, driverConfig.ConnectionConfig.Port)
+			reply.Binlog.Error = fmt.Sprintf("You must be using ROW binlog format. I can switch it for you, provided --switch-to-rbr and that %s:%d doesn't have replicas", cc.Host, cc.Port)
 		} else {
 			reply.Binlog.Success = true
 		}
@@ -131,7 +155,7 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 		foundReplicationSlave := false
 		foundDBAll := false
 
-		err = usql.QueryRowsMap(db, query, func(rowMap usql.RowMap) error {
+		err = usql.QueryRowsMap(ctx, db, query, func(rowMap usql.RowMap) error {
 			for _, grantData := range rowMap {
 				grant := grantData.String
 				if strings.Contains(grant, `GRANT ALL PRIVILEGES ON`) {
@@ -177,7 +201,7 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 		foundSuper := false
 		foundDBAll := false
 
-		err := usql.QueryRowsMap(db, query, func(rowMap usql.RowMap) error {
+		err := usql.QueryRowsMap(ctx, db, query, func(rowMap usql.RowMap) error {
 			for _, grantData := range rowMap {
 				grant := grantData.String
 				if strings.Contains(grant, `GRANT ALL PRIVILEGES ON`) {
@@ -214,7 +238,7 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 		}
 	}
 	if task.Config["ExpandSyntaxSupport"] == true {
-		if _, err := db.Query("use mysql"); err != nil {
+		if _, err := db.QueryContext(ctx, "use mysql"); err != nil {
 			reply.Privileges.Success = false
 			reply.Privileges.Error = err.Error()
 		}
@@ -222,11 +246,55 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 	return reply, nil
 }
 
+// ValidateTargetObjects reports the triggers and CHECK constraints of the
+// target of a Dest task on the tables selected by the Src task of its job.
+func ValidateTargetObjects(src, dest *models.Task) models.TargetObjectsValidate {
+	var srcConfig, destConfig config.MySQLDriverConfig
+	if err := mapstructure.WeakDecode(src.Config, &srcConfig); err != nil {
+		return models.TargetObjectsValidate{Error: err.Error()}
+	}
+	if err := mapstructure.WeakDecode(dest.Config, &destConfig); err != nil {
+		return models.TargetObjectsValidate{Error: err.Error()}
+	}
+	if destConfig.ConnectionConfig == nil {
+		return models.TargetObjectsValidate{Error: "missing ConnectionConfig of the Dest task"}
+	}
+	db, err := usql.CreateDB(destConfig.ConnectionConfig.GetDBUri())
+	if err != nil {
+		return models.TargetObjectsValidate{Error: err.Error()}
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), destConfig.QueryTimeout())
+	defer cancel()
+
+	triggers, checks, err := mysql.FindTargetObjects(ctx, db, srcConfig.ReplicateDoDb, srcConfig.ReplicateIgnoreDb,
+		destConfig.DisableTriggers)
+	if err != nil {
+		return models.TargetObjectsValidate{Error: err.Error()}
+	}
+	return mysql.TargetObjectsValidation(triggers, checks)
+}
+
 func (m *MySQLDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle, error) {
+	if models.IsStepTask(task.Type) {
+		return m.startStep(ctx, task)
+	}
+
 	var driverConfig config.MySQLDriverConfig
 	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
 		return nil, err
 	}
+	if ctx.TaskDir != "" {
+		driverConfig.DataDir = ctx.TaskDir
+		driverConfig.SpillDir = inTaskDir(ctx.TaskDir, driverConfig.SpillDir)
+		driverConfig.RecordFile = inTaskDir(ctx.TaskDir, driverConfig.RecordFile)
+	}
+	if ctx.Job != nil && ctx.Job.EncryptTransit {
+		if len(ctx.TransitKeys) == 0 {
+			return nil, fmt.Errorf("job %v has EncryptTransit, but got no transit keys from the managers", ctx.Subject)
+		}
+		driverConfig.TransitKeys = ctx.TransitKeys
+	}
 
 	switch task.Type {
 	case models.TaskTypeSrc:
@@ -240,13 +308,22 @@ func (m *MySQLDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle,
 			go e.Run()
 			return e, nil
 		}
-	case models.TaskTypeDest:
+	case models.TaskTypeDest, models.TaskTypeDestStandby:
 		{
 			m.logger.Debugf("NewApplier ReplicateDoDb: %v", driverConfig.ReplicateDoDb)
 			a, err := mysql.NewApplier(ctx.Subject, ctx.Tp, &driverConfig, m.logger)
 			if err != nil {
 				return nil, err
 			}
+			if ctx.Job != nil && ctx.Job.HasStandby() {
+				localNatsAddr := ""
+				if m.node != nil {
+					localNatsAddr = m.node.NatsAddr
+				}
+				if err := a.EnableStandby(task.Type == models.TaskTypeDestStandby, localNatsAddr); err != nil {
+					return nil, err
+				}
+			}
 			go a.Run()
 			return a, nil
 		}
@@ -258,3 +335,47 @@ func (m *MySQLDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle,
 
 	return nil, nil
 }
+
+// startStep starts a step task, connecting to the instances of the Src and
+// Dest tasks of the job.
+func (m *MySQLDriver) startStep(ctx *ExecContext, task *models.Task) (DriverHandle, error) {
+	var stepConfig config.StepConfig
+	if err := mapstructure.WeakDecode(task.Config, &stepConfig); err != nil {
+		return nil, err
+	}
+	if ctx.Job == nil {
+		return nil, fmt.Errorf("step %v has no job", task.Type)
+	}
+
+	var src, dst *config.MySQLDriverConfig
+	for _, t := range ctx.Job.Tasks {
+		if t.Driver != models.TaskDriverMySQL || (t.Type != models.TaskTypeSrc && t.Type != models.TaskTypeDest) {
+			continue
+		}
+		var driverConfig config.MySQLDriverConfig
+		if err := mapstructure.WeakDecode(t.Config, &driverConfig); err != nil {
+			return nil, fmt.Errorf("failed to decode the config of task %v: %v", t.Type, err)
+		}
+		if t.Type == models.TaskTypeSrc {
+			src = &driverConfig
+		} else {
+			dst = &driverConfig
+		}
+	}
+
+	s, err := mysql.NewStep(task.Type, &stepConfig, src, dst, m.logger)
+	if err != nil {
+		return nil, err
+	}
+	go s.Run()
+	return s, nil
+}
+
+// inTaskDir resolves a relative path of the job under the task dir, where
+// its size counts towards the disk quota of the allocation.
+func inTaskDir(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
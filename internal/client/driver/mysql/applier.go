@@ -11,11 +11,11 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/actiontech/dtle/internal/chaos"
 	"github.com/actiontech/dtle/internal/g"
 
 	//"math"
 	"bytes"
-	"encoding/gob"
 
 	//"encoding/base64"
 	"math"
@@ -25,7 +25,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/golang/snappy"
 	gonats "github.com/nats-io/go-nats"
 	gomysql "github.com/siddontang/go-mysql/mysql"
 
@@ -33,6 +32,7 @@ import (
 	"context"
 	"encoding/hex"
 	"os"
+	"path/filepath"
 
 	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
 	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
@@ -152,10 +152,16 @@ func (mm *MtsManager) WaitForAllCommitted() bool {
 //  This function must be called sequentially.
 func (mm *MtsManager) WaitForExecution(binlogEntry *binlog.BinlogEntry) bool {
 	mm.lastEnqueue = binlogEntry.Coordinates.SeqenceNumber
+	return mm.WaitForLastCommitted(binlogEntry.Coordinates.LastCommitted)
+}
 
+// WaitForLastCommitted blocks until all tx with seqNum <= lastCommitted have
+// been executed. return false for abortion.
+//  This function must be called sequentially.
+func (mm *MtsManager) WaitForLastCommitted(lastCommitted int64) bool {
 	for {
 		currentLC := atomic.LoadInt64(&mm.lastCommitted)
-		if currentLC >= binlogEntry.Coordinates.LastCommitted {
+		if currentLC >= lastCommitted {
 			return true
 		}
 
@@ -224,8 +230,12 @@ type Applier struct {
 	applyBinlogTxQueue      chan *binlog.BinlogTx
 	applyBinlogGroupTxQueue chan []*binlog.BinlogTx
 	// only TX can be executed should be put into this chan
-	applyBinlogMtsTxQueue chan *binlog.BinlogEntry
+	applyBinlogMtsTxQueue chan []*binlog.BinlogEntry
 	lastAppliedBinlogTx   *binlog.BinlogTx
+	pipeline              pipeline
+	// copyQueue and applyQueue count the messages dropped by the subscriptions
+	copyQueue  *stageQueue
+	applyQueue *stageQueue
 
 	natsConn *gonats.Conn
 	waitCh   chan *models.WaitResult
@@ -234,6 +244,9 @@ type Applier struct {
 	shutdown     bool
 	shutdownCh   chan struct{}
 	shutdownLock sync.Mutex
+	// cancelled on shutdown, stopping the queries running
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	mtsManager     *MtsManager
 	printTps       bool
@@ -241,11 +254,81 @@ type Applier struct {
 	nDumpEntry     int64
 
 	stubFullApplyDelay bool
+
+	// rows sent by the extractor in full copy, by "schema.table"
+	tableRowsCopied map[string]int64
+	// the chunks applied by the full copy, reported as the checkpoint of
+	// the copy
+	copyProgress     *models.CopyProgress
+	copyProgressLock sync.Mutex
+
+	// set to 1 when the incremental apply begins
+	incrStarted int64
+	// binlog entries received but not applied or skipped yet
+	nPendingEntry int64
+	// source time of the last applied binlog entry, in unix seconds
+	lastAppliedEventTime int64
+
+	wireBytes    int64
+	appliedBytes int64
+	codecStats   codecStats
+
+	// nil unless SpillDir is set
+	spillBuffer *spillBuffer
+	// nil unless RecordFile is set
+	fixture *fixtureWriter
+	// nil unless the job has EncryptTransit
+	transit *transitCipher
+	// the messages received in chunks
+	chunks *ChunkAssembler
+	// nil unless BlobOffload is set
+	blobOffload *blobOffloader
+	// called with the binlog entries of a target transaction once done. nil
+	// unless benchmarking
+	applied func(entries []*binlog.BinlogEntry)
+	// nil unless ApproveHeterogeneous is set
+	provenance *provenance
+	// set to 1 while the writes wait for the target to be writable
+	targetReadOnly int32
+	// nil unless the target is in a single-primary group replication
+	group *groupReplication
+	// nil unless MaxLoad or ThrottleReplicas are set
+	throttler *throttler
+	// the stage before the throttling
+	stageBeforeThrottle string
+	// guards skipTx, the skip of a failing transaction armed, nil if none
+	skipTxLock sync.Mutex
+	skipTx     *models.SkipTx
+	taskEvents chan *models.TaskEvent
+	// the split transaction being applied, nil if none
+	txParts *txParts
+
+	txOptions *gosql.TxOptions
+
+	// unregisters the task from fault injection on shutdown
+	unregisterChaos func()
+
+	// nil unless the job has a DestStandby task
+	standby         *standbyState
+	migrationCutoff time.Time
+
+	targetHealth *base.ConnTracker
+	natsHealth   *base.ConnTracker
+
+	// guards the TunableConfig of mysqlContext, which Tune changes, and
+	// activeWorkers
+	tuneLock sync.RWMutex
+	// the MtsWorkers applying transactions, up to ParallelWorkers
+	activeWorkers int
+	// closed when activeWorkers changes, for the idle workers
+	workersTuned chan struct{}
+	logLevel     *taskLogLevel
 }
 
 func NewApplier(subject, tp string, cfg *config.MySQLDriverConfig, logger *log.Logger) (*Applier, error) {
 	cfg = cfg.SetDefault()
-	entry := log.NewEntry(logger).WithFields(log.Fields{
+	logLevel := newTaskLogLevel(logger, cfg.LogLevel)
+	entry := log.NewEntry(logLevel.logger).WithFields(log.Fields{
 		"job": subject,
 	})
 	subjectUUID, err := uuid.FromString(subject)
@@ -253,6 +336,42 @@ func NewApplier(subject, tp string, cfg *config.MySQLDriverConfig, logger *log.L
 		logger.Errorf("job id is not a valid UUID: %v", err.Error())
 		return nil, err
 	}
+	isolation, err := sql.ParseIsolationLevel(cfg.IsolationLevel)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TxBoundary != config.TxBoundaryPreserve && cfg.TxBoundary != config.TxBoundaryRegroup {
+		return nil, fmt.Errorf("invalid TxBoundary %q: must be %q or %q",
+			cfg.TxBoundary, config.TxBoundaryPreserve, config.TxBoundaryRegroup)
+	}
+	if cfg.ParallelDependency != config.ParallelDependencyCommit && cfg.ParallelDependency != config.ParallelDependencyTable {
+		return nil, fmt.Errorf("invalid ParallelDependency %q: must be %q or %q",
+			cfg.ParallelDependency, config.ParallelDependencyCommit, config.ParallelDependencyTable)
+	}
+	if !validQueueFullPolicy(cfg.QueueFullPolicy) {
+		return nil, fmt.Errorf("invalid QueueFullPolicy %q: must be %q or %q",
+			cfg.QueueFullPolicy, config.QueueFullDrop, config.QueueFullBlock)
+	}
+	if cfg.BatchErrorPolicy != config.BatchErrorRollback && cfg.BatchErrorPolicy != config.BatchErrorApplyPrefix {
+		return nil, fmt.Errorf("invalid BatchErrorPolicy %q: must be %q or %q",
+			cfg.BatchErrorPolicy, config.BatchErrorRollback, config.BatchErrorApplyPrefix)
+	}
+	if cfg.FillGtidGaps && (cfg.TiDB || cfg.TxBoundary == config.TxBoundaryRegroup) {
+		return nil, fmt.Errorf("FillGtidGaps needs a MySQL target and TxBoundary %q", config.TxBoundaryPreserve)
+	}
+	for _, policy := range cfg.ConflictPolicies {
+		if err := policy.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	transit, err := newTransitCipher(cfg.TransitKeys)
+	if err != nil {
+		return nil, err
+	}
+	throttler, err := newThrottler(cfg, entry)
+	if err != nil {
+		return nil, err
+	}
 
 	a := &Applier{
 		logger:                  entry,
@@ -265,36 +384,77 @@ func NewApplier(subject, tp string, cfg *config.MySQLDriverConfig, logger *log.L
 		rowCopyComplete:         make(chan bool, 1),
 		copyRowsQueue:           make(chan *DumpEntry, 24),
 		applyDataEntryQueue:     make(chan *binlog.BinlogEntry, cfg.ReplChanBufferSize*2),
-		applyBinlogMtsTxQueue:   make(chan *binlog.BinlogEntry, cfg.ReplChanBufferSize*2),
+		applyBinlogMtsTxQueue:   make(chan []*binlog.BinlogEntry, cfg.ReplChanBufferSize*2),
 		applyBinlogTxQueue:      make(chan *binlog.BinlogTx, cfg.ReplChanBufferSize*2),
 		applyBinlogGroupTxQueue: make(chan []*binlog.BinlogTx, cfg.ReplChanBufferSize*2),
 		waitCh:                  make(chan *models.WaitResult, 1),
 		shutdownCh:              make(chan struct{}),
 		printTps:                os.Getenv(g.ENV_PRINT_TPS) != "",
 		stubFullApplyDelay:      os.Getenv(g.ENV_FULL_APPLY_DELAY) != "",
-	}
+		txOptions:               &gosql.TxOptions{Isolation: isolation},
+		transit:                 transit,
+		chunks:                  NewChunkAssembler(),
+		copyProgress:            cfg.CopyProgress.Copy(),
+		targetHealth:            base.NewConnTracker(models.ConnTarget),
+		natsHealth:              base.NewConnTracker(models.ConnNats),
+		activeWorkers:           cfg.ParallelWorkers,
+		workersTuned:            make(chan struct{}),
+		logLevel:                logLevel,
+		throttler:               throttler,
+		skipTx:                  cfg.SkipTx,
+		taskEvents:              make(chan *models.TaskEvent, taskEventsBufferSize),
+	}
+	if a.throttler != nil {
+		a.throttler.onChange = a.onThrottle
+	}
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	a.initPipeline()
 	a.mtsManager = NewMtsManager(a.shutdownCh)
 	go a.mtsManager.LcUpdater()
 	return a, nil
 }
 
+// initPipeline registers the queues of the applier: the messages received
+// by the subscriptions wait in copyRowsQueue or applyDataEntryQueue, and the
+// transactions ready to be applied in applyBinlogMtsTxQueue.
+func (a *Applier) initPipeline() {
+	a.copyQueue = a.pipeline.queue("copy", config.QueueFullDrop,
+		func() int { return len(a.copyRowsQueue) }, cap(a.copyRowsQueue))
+	applyPolicy := a.mysqlContext.QueueFullPolicy
+	if a.mysqlContext.SpillDir != "" {
+		// fed by the spill buffer, which waits for room
+		applyPolicy = config.QueueFullBlock
+	}
+	a.applyQueue = a.pipeline.queue("apply", applyPolicy,
+		func() int { return len(a.applyDataEntryQueue) }, cap(a.applyDataEntryQueue))
+	a.pipeline.queue("apply_workers", config.QueueFullBlock,
+		func() int { return len(a.applyBinlogMtsTxQueue) }, cap(a.applyBinlogMtsTxQueue))
+}
+
 func (a *Applier) MtsWorker(workerIndex int) {
 	keepLoop := true
 
 	for keepLoop {
+		queue := a.applyBinlogMtsTxQueue
+		active, tuned := a.workerActive(workerIndex)
+		if !active {
+			// idle until ParallelWorkers is tuned up again
+			queue = nil
+		}
 		timer := time.NewTimer(pingInterval)
 		select {
-		case tx := <-a.applyBinlogMtsTxQueue:
-			a.logger.Debugf("mysql.applier: a binlogEntry MTS dequeue, worker: %v. GNO: %v",
-				workerIndex, tx.Coordinates.GNO)
-			if err := a.ApplyBinlogEvent(workerIndex, tx); err != nil {
+		case <-tuned:
+		case txs := <-queue:
+			a.logger.Debugf("mysql.applier: a binlogEntry MTS dequeue, worker: %v. GNO: %v, n: %v",
+				workerIndex, txs[0].Coordinates.GNO, len(txs))
+			if err := a.ApplyBinlogEvents(workerIndex, txs); err != nil {
 				a.onError(TaskStateDead, err) // TODO coordinate with other goroutine
 				keepLoop = false
 			} else {
 				// do nothing
 			}
 			a.logger.Debugf("mysql.applier: worker: %v. after ApplyBinlogEvent. GNO: %v",
-				workerIndex, tx.Coordinates.GNO)
+				workerIndex, txs[len(txs)-1].Coordinates.GNO)
 		case <-a.shutdownCh:
 			keepLoop = false
 		case <-timer.C:
@@ -310,6 +470,14 @@ func (a *Applier) MtsWorker(workerIndex int) {
 
 // Run executes the complete apply logic.
 func (a *Applier) Run() {
+	taskType := models.TaskTypeDest
+	if a.standby != nil {
+		taskType = a.standby.taskType
+	}
+	a.unregisterChaos = chaos.Register(a.subject, taskType, func() {
+		a.onError(TaskStateDead, chaos.ErrKilled)
+	})
+
 	if a.printTps {
 		go func() {
 			for {
@@ -320,13 +488,43 @@ func (a *Applier) Run() {
 		}()
 	}
 
+	if a.mysqlContext.Migration && a.mysqlContext.MigrationCutoff != "" {
+		var err error
+		if a.migrationCutoff, err = time.Parse(time.RFC3339, a.mysqlContext.MigrationCutoff); err != nil {
+			a.onError(TaskStateDead, fmt.Errorf("invalid MigrationCutoff: %v", err))
+			return
+		}
+	}
+
 	a.logger.Printf("mysql.applier: Apply binlog events to %s.%d", a.mysqlContext.ConnectionConfig.Host, a.mysqlContext.ConnectionConfig.Port)
 	a.mysqlContext.StartTime = time.Now()
+	go a.pipeline.run(a.shutdownCh)
 	if err := a.initDBConnections(); err != nil {
 		a.onError(TaskStateDead, err)
 		return
 	}
-	if err := a.initNatSubClient(); err != nil {
+	if a.throttler != nil {
+		if err := a.throttler.open(a.db, a.mysqlContext.ConnectionConfig); err != nil {
+			a.onError(TaskStateDead, err)
+			return
+		}
+		go a.throttler.run(a.shutdownCh)
+	}
+	if a.standby != nil {
+		if err := a.initStandbyNatsConn(); err != nil {
+			a.onError(TaskStateDead, err)
+			return
+		}
+		active, err := a.startStandby()
+		if err != nil {
+			a.onError(TaskStateDead, err)
+			return
+		}
+		if !active {
+			// applying starts on takeover
+			return
+		}
+	} else if err := a.initNatSubClient(); err != nil {
 		a.onError(TaskStateDead, err)
 		return
 	}
@@ -335,15 +533,66 @@ func (a *Applier) Run() {
 		a.onError(TaskStateDead, err)
 		return
 	}
+	a.startApplying()
+}
 
+// startApplying starts the workers applying what initiateStreaming receives.
+func (a *Applier) startApplying() {
 	for i := 0; i < a.mysqlContext.ParallelWorkers; i++ {
 		go a.MtsWorker(i)
 	}
 
 	go a.executeWriteFuncs()
+	if a.provenance != nil {
+		go a.runProvenance()
+	}
+
+	if a.mysqlContext.Migration {
+		go a.watchMigration(a.migrationCutoff)
+	}
+}
+
+// watchMigration completes a migration job, once the incremental apply has
+// begun and the job has had no lag for MigrationIdleSeconds after the cutoff.
+func (a *Applier) watchMigration(cutoff time.Time) {
+	idle := time.Duration(a.mysqlContext.MigrationIdleSeconds) * time.Second
+	a.logger.Printf("mysql.applier: migration job. cutoff: %v, idle: %v", a.mysqlContext.MigrationCutoff, idle)
+
+	var caughtUpSince time.Time
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.shutdownCh:
+			return
+		case now := <-ticker.C:
+			if atomic.LoadInt64(&a.incrStarted) == 0 || now.Before(cutoff) {
+				caughtUpSince = time.Time{}
+				continue
+			}
+			lag, caughtUp := a.migrationCaughtUp()
+			if !caughtUp {
+				caughtUpSince = time.Time{}
+				continue
+			}
+			if caughtUpSince.IsZero() {
+				caughtUpSince = now
+			} else if now.Sub(caughtUpSince) >= idle {
+				var lastEvent time.Time
+				if t := atomic.LoadInt64(&a.lastAppliedEventTime); t != 0 {
+					lastEvent = time.Unix(t, 0)
+				}
+				a.logger.Printf("mysql.applier: migration caught up. source gtid: %v, last applied event: %v",
+					lag.SourceGtid, lastEvent)
+				a.onError(TaskStateComplete, nil)
+				return
+			}
+		}
+	}
 }
 
 func (a *Applier) onApplyTxStructWithSuper(dbApplier *sql.Conn, binlogTx *binlog.BinlogTx) error {
+	chaos.DelayApply(a.subject)
 	dbApplier.DbMutex.Lock()
 	defer func() {
 		_, err := sql.ExecNoPrepare(dbApplier.Db, `commit;set gtid_next='automatic'`)
@@ -409,8 +658,16 @@ func (a *Applier) executeWriteFuncs() {
 				case copyRows := <-a.copyRowsQueue:
 					if nil != copyRows {
 						//time.Sleep(20 * time.Second) // #348 stub
-						if err := a.ApplyEventQueries(a.db, copyRows); err != nil {
+						err := a.retryOnTarget(func() error {
+							return a.ApplyEventQueries(a.db, copyRows)
+						})
+						if err != nil {
 							a.onError(TaskStateDead, err)
+						} else {
+							a.recordCopiedChunk(copyRows)
+							if a.provenance != nil {
+								a.provenance.written(copyRows.TableSchema, copyRows.TableName, true)
+							}
 						}
 					}
 					if atomic.LoadInt64(&a.nDumpEntry) < 0 {
@@ -437,6 +694,18 @@ func (a *Applier) executeWriteFuncs() {
 				a.rowCopyComplete <- true
 				a.logger.Printf("mysql.applier: Rows copy complete.number of rows:%d", a.mysqlContext.TotalRowsReplay)
 				a.mysqlContext.Gtid = a.currentCoordinates.RetrievedGtidSet
+				if a.provenance != nil {
+					if err := a.recordCopyComplete(); err != nil {
+						a.logger.Warnf("mysql.applier: cannot record the completion of the full copy: %v", err)
+					}
+				}
+				if a.mysqlContext.VerifyRowCount {
+					if conn, err := a.rowCountSnapshot(); err != nil {
+						a.logger.Warnf("mysql.applier: verify row count: %v", err)
+					} else {
+						go a.verifyRowCount(conn)
+					}
+				}
 				break
 			}
 			if a.shutdown {
@@ -447,6 +716,7 @@ func (a *Applier) executeWriteFuncs() {
 	}
 
 	var dbApplier *sql.Conn
+	atomic.StoreInt64(&a.incrStarted, 1)
 
 	stopMTSIncrLoop := false
 	for !stopMTSIncrLoop {
@@ -459,7 +729,7 @@ func (a *Applier) executeWriteFuncs() {
 				continue
 			}
 			for idx, binlogTx := range groupTx {
-				dbApplier = a.dbs[idx%a.mysqlContext.ParallelWorkers]
+				dbApplier = a.dbs[idx%a.workers()]
 				go func(tx *binlog.BinlogTx) {
 					a.wg.Add(1)
 					if err := a.onApplyTxStructWithSuper(dbApplier, tx); err != nil {
@@ -494,12 +764,12 @@ func (a *Applier) initNatSubClient() (err error) {
 
 // Decode
 func Decode(data []byte, vPtr interface{}) (err error) {
-	msg, err := snappy.Decode(nil, data)
-	if err != nil {
-		return err
-	}
+	return decodeWith(data, vPtr, nil)
+}
 
-	return gob.NewDecoder(bytes.NewBuffer(msg)).Decode(vPtr)
+// decode decodes a message received from the extractor
+func (a *Applier) decode(data []byte, vPtr interface{}) error {
+	return decodeWith(data, vPtr, &a.codecStats)
 }
 
 func (a *Applier) setTableItemForBinlogEntry(binlogEntry *binlog.BinlogEntry) error {
@@ -513,7 +783,9 @@ func (a *Applier) setTableItemForBinlogEntry(binlogEntry *binlog.BinlogEntry) er
 			tableItem := a.getTableItem(dmlEvent.DatabaseName, dmlEvent.TableName)
 			if tableItem.columns == nil {
 				a.logger.Debugf("mysql.applier: get tableColumns %v.%v", dmlEvent.DatabaseName, dmlEvent.TableName)
-				tableItem.columns, err = base.GetTableColumns(a.db, dmlEvent.DatabaseName, dmlEvent.TableName)
+				ctx, cancel := a.queryContext()
+				tableItem.columns, err = base.GetTableColumns(ctx, a.db, dmlEvent.DatabaseName, dmlEvent.TableName)
+				cancel()
 				if err != nil {
 					a.logger.Errorf("mysql.applier. GetTableColumns error. err: %v", err)
 					return err
@@ -522,12 +794,55 @@ func (a *Applier) setTableItemForBinlogEntry(binlogEntry *binlog.BinlogEntry) er
 			} else {
 				a.logger.Debugf("mysql.applier: reuse tableColumns %v.%v", dmlEvent.DatabaseName, dmlEvent.TableName)
 			}
+			if len(dmlEvent.ColumnNames) > 0 {
+				if err := orderValuesByColumns(dmlEvent, tableItem.columns); err != nil {
+					return err
+				}
+			}
 			dmlEvent.TableItem = tableItem
 		}
 	}
 	return nil
 }
 
+// orderValuesByColumns puts the values of an event named by ColumnNames in the
+// order of the target columns. Values of columns missing in the target are dropped.
+func orderValuesByColumns(dmlEvent *binlog.DataEvent, columns *umconf.ColumnList) error {
+	index := make(map[string]int, len(dmlEvent.ColumnNames))
+	for i, name := range dmlEvent.ColumnNames {
+		index[strings.ToLower(name)] = i
+	}
+	order := func(values *umconf.ColumnValues) (*umconf.ColumnValues, error) {
+		if values == nil {
+			return nil, nil
+		}
+		abstractValues := values.GetAbstractValues()
+		ordered := make([]interface{}, columns.Len())
+		for i, column := range columns.ColumnList() {
+			j, ok := index[strings.ToLower(column.Name)]
+			if !ok || j >= len(abstractValues) {
+				return nil, fmt.Errorf("no value of column %v for %v.%v", column.Name, dmlEvent.DatabaseName, dmlEvent.TableName)
+			}
+			if abstractValues[j] != nil {
+				ordered[i] = *abstractValues[j]
+			}
+		}
+		return umconf.ToColumnValues(ordered), nil
+	}
+
+	var err error
+	if dmlEvent.WhereColumnValues, err = order(dmlEvent.WhereColumnValues); err != nil {
+		return err
+	}
+	if dmlEvent.NewColumnValues, err = order(dmlEvent.NewColumnValues); err != nil {
+		return err
+	}
+	dmlEvent.ColumnCount = columns.Len()
+	// the values are ordered only once
+	dmlEvent.ColumnNames = nil
+	return nil
+}
+
 func (a *Applier) cleanGtidExecuted(sid uuid.UUID, intervalStr string) error {
 	a.logger.Debugf("mysql.applier. incr. cleanup before WaitForExecution")
 	if !a.mtsManager.WaitForAllCommitted() {
@@ -539,7 +854,7 @@ func (a *Applier) cleanGtidExecuted(sid uuid.UUID, intervalStr string) error {
 	// However, consider `binlog_group_commit_sync_delay > 0`,
 	// `begin; delete; insert; commit;` (1 TX) is faster than `insert; delete;` (2 TX)
 	dbApplier := a.dbs[0]
-	tx, err := dbApplier.Db.BeginTx(context.Background(), &gosql.TxOptions{})
+	tx, err := dbApplier.Db.BeginTx(context.Background(), a.txOptions)
 	if err != nil {
 		return err
 	}
@@ -558,7 +873,7 @@ func (a *Applier) cleanGtidExecuted(sid uuid.UUID, intervalStr string) error {
 	}
 
 	a.logger.Debugf("mysql.applier: compactation gtid. new interval: %v", intervalStr)
-	_, err = dbApplier.PsInsertExecutedGtid.Exec(sid.Bytes(), intervalStr)
+	_, err = dbApplier.PsInsertExecutedGtid.Exec(sid.Bytes(), intervalStr, nil)
 	if err != nil {
 		return err
 	}
@@ -569,10 +884,30 @@ func (a *Applier) heterogeneousReplay() {
 	var err error
 	stopSomeLoop := false
 	prevDDL := false
+
+	regroup := a.mysqlContext.TxBoundary == config.TxBoundaryRegroup
+	// nil unless ParallelDependency is "table"
+	var deps *tableDependency
+	if a.mysqlContext.ParallelDependency == config.ParallelDependencyTable {
+		deps = newTableDependency()
+	}
+	var group *txGroup
+	var groupTimeout <-chan time.Time
+	// flushGroup enqueues the pending group, if any. false for a shutdown.
+	flushGroup := func() bool {
+		if group == nil {
+			return true
+		}
+		g := group
+		group, groupTimeout = nil, nil
+		return a.enqueueTxGroup(g)
+	}
+
 	for !stopSomeLoop {
 		select {
 		case binlogEntry := <-a.applyDataEntryQueue:
 			if nil == binlogEntry {
+				atomic.AddInt64(&a.nPendingEntry, -1)
 				continue
 			}
 
@@ -582,13 +917,16 @@ func (a *Applier) heterogeneousReplay() {
 
 			if binlogEntry.Coordinates.OSID == a.mysqlContext.MySQLServerUuid {
 				a.logger.Debugf("mysql.applier: skipping a dtle tx. osid: %v", binlogEntry.Coordinates.OSID)
+				atomic.AddInt64(&a.nPendingEntry, -1)
 				continue
 			}
 
 			// region TestIfExecuted
 			if a.gtidExecuted == nil {
 				// udup crash recovery or never executed
-				a.gtidExecuted, err = base.SelectAllGtidExecuted(a.db, a.subjectUUID)
+				ctx, cancel := a.queryContext()
+				a.gtidExecuted, err = base.SelectAllGtidExecuted(ctx, a.db, a.subjectUUID)
+				cancel()
 				if err != nil {
 					a.onError(TaskStateDead, err)
 					return
@@ -605,8 +943,22 @@ func (a *Applier) heterogeneousReplay() {
 			if base.IntervalSlicesContainOne(gtidSetItem.Intervals, binlogEntry.Coordinates.GNO) {
 				// entry executed
 				a.logger.Debugf("mysql.applier: skip an executed tx: %v:%v", txSid, binlogEntry.Coordinates.GNO)
+				atomic.AddInt64(&a.nPendingEntry, -1)
 				continue
 			}
+			if binlogEntry.Part > 0 {
+				apply, err := a.resumeParts(binlogEntry)
+				if err != nil {
+					a.onError(TaskStateDead, err)
+					return
+				}
+				if !apply {
+					a.logger.Debugf("mysql.applier: skip an applied part %v of tx: %v:%v",
+						binlogEntry.Part, txSid, binlogEntry.Coordinates.GNO)
+					atomic.AddInt64(&a.nPendingEntry, -1)
+					continue
+				}
+			}
 			// endregion
 
 			// this must be after duplication check
@@ -620,6 +972,9 @@ func (a *Applier) heterogeneousReplay() {
 
 			a.logger.Debugf("mysql.applier. gtidSetItem.NRow: %v", gtidSetItem.NRow)
 			if gtidSetItem.NRow >= cleanupGtidExecutedLimit {
+				if !flushGroup() {
+					return // shutdown
+				}
 				err = a.cleanGtidExecuted(binlogEntry.Coordinates.SID, base.StringInterval(gtidSetItem.Intervals))
 				if err != nil {
 					a.onError(TaskStateDead, err)
@@ -628,13 +983,27 @@ func (a *Applier) heterogeneousReplay() {
 				gtidSetItem.NRow = 1
 			}
 
-			thisInterval := gomysql.Interval{Start: binlogEntry.Coordinates.GNO, Stop: binlogEntry.Coordinates.GNO + 1}
-
-			gtidSetItem.NRow += 1
-			// TODO normalize may affect oringinal intervals
-			newInterval := append(gtidSetItem.Intervals, thisInterval).Normalize()
-			// TODO this is assigned before real execution
-			gtidSetItem.Intervals = newInterval
+			if !binlogEntry.MoreParts {
+				// a split tx is executed with its last part
+				thisInterval := gomysql.Interval{Start: binlogEntry.Coordinates.GNO, Stop: binlogEntry.Coordinates.GNO + 1}
+
+				gtidSetItem.NRow += 1
+				// TODO normalize may affect oringinal intervals
+				newInterval := append(gtidSetItem.Intervals, thisInterval).Normalize()
+				// TODO this is assigned before real execution
+				gtidSetItem.Intervals = newInterval
+				if xa := binlogEntry.XAPrepare; xa != nil {
+					// executed with the XA COMMIT or ROLLBACK
+					xaItem, ok := a.gtidExecuted[xa.SID]
+					if !ok {
+						xaItem = &base.GtidExecutedItem{}
+						a.gtidExecuted[xa.SID] = xaItem
+					}
+					xaItem.NRow += 1
+					xaItem.Intervals = append(xaItem.Intervals,
+						gomysql.Interval{Start: xa.GNO, Stop: xa.GNO + 1}).Normalize()
+				}
+			}
 
 			if binlogEntry.Coordinates.SeqenceNumber == 0 {
 				// MySQL 5.6: non mts
@@ -650,7 +1019,7 @@ func (a *Applier) heterogeneousReplay() {
 			} else {
 				if rotated {
 					a.logger.Debugf("mysql.applier: binlog rotated to %v", a.currentCoordinates.File)
-					if !a.mtsManager.WaitForAllCommitted() {
+					if !flushGroup() || !a.mtsManager.WaitForAllCommitted() {
 						return // shutdown
 					}
 					a.mtsManager.lastCommitted = 0
@@ -658,6 +1027,9 @@ func (a *Applier) heterogeneousReplay() {
 					if len(a.mtsManager.m) != 0 {
 						a.logger.Warnf("DTLE_BUG: len(a.mtsManager.m) should be 0")
 					}
+					if deps != nil {
+						deps.reset()
+					}
 				}
 
 				// If there are TXs skipped by udup source-side
@@ -678,37 +1050,78 @@ func (a *Applier) heterogeneousReplay() {
 					return false
 				}()
 
-				// DDL must be executed separatedly
-				if hasDDL || prevDDL {
+				// DDL must be executed separatedly, as the parts of a split tx,
+				// one by one
+				serial := hasDDL || binlogEntry.Part > 0
+				// the parts after the first one applied have nothing to wait for
+				partApplied := binlogEntry.Part > 0 &&
+					a.mtsManager.lastEnqueue == binlogEntry.Coordinates.SeqenceNumber
+				if (serial || prevDDL) && !partApplied {
 					a.logger.Debugf("mysql.applier: gno: %v MTS found DDL(%v,%v). WaitForAllCommitted",
 						binlogEntry.Coordinates.GNO, hasDDL, prevDDL)
-					if !a.mtsManager.WaitForAllCommitted() {
+					if !flushGroup() || !a.mtsManager.WaitForAllCommitted() {
 						return // shutdown
 					}
 				}
 
-				if hasDDL {
+				if serial {
 					prevDDL = true
 				} else {
 					prevDDL = false
 				}
-
-				if !a.mtsManager.WaitForExecution(binlogEntry) {
-					return // shutdown
+				if deps != nil {
+					binlogEntry.Coordinates.LastCommitted = deps.lastCommitted(binlogEntry)
 				}
 
-				a.logger.Debugf("mysql.applier: a binlogEntry MTS enqueue. gno: %v", binlogEntry.Coordinates.GNO)
-				err = a.setTableItemForBinlogEntry(binlogEntry)
-				if err != nil {
-					a.onError(TaskStateDead, err)
-					return
+				if binlogEntry.Part > 0 {
+					// applied before the next part is received
+					a.mtsManager.lastEnqueue = binlogEntry.Coordinates.SeqenceNumber
+					err = a.setTableItemForBinlogEntry(binlogEntry)
+					if err != nil {
+						a.onError(TaskStateDead, err)
+						return
+					}
+					if err := a.ApplyBinlogEvent(0, binlogEntry); err != nil {
+						a.onError(TaskStateDead, err)
+						return
+					}
+				} else if regroup && !hasDDL {
+					err = a.setTableItemForBinlogEntry(binlogEntry)
+					if err != nil {
+						a.onError(TaskStateDead, err)
+						return
+					}
+					a.mtsManager.lastEnqueue = binlogEntry.Coordinates.SeqenceNumber
+					if group == nil {
+						group = &txGroup{}
+						groupTimeout = time.After(a.txGroupTimeout())
+					}
+					group.add(binlogEntry)
+					if len(group.entries) >= a.txGroupMaxTxs() && !flushGroup() {
+						return // shutdown
+					}
+				} else {
+					if !a.mtsManager.WaitForExecution(binlogEntry) {
+						return // shutdown
+					}
+
+					a.logger.Debugf("mysql.applier: a binlogEntry MTS enqueue. gno: %v", binlogEntry.Coordinates.GNO)
+					err = a.setTableItemForBinlogEntry(binlogEntry)
+					if err != nil {
+						a.onError(TaskStateDead, err)
+						return
+					}
+					a.applyBinlogMtsTxQueue <- []*binlog.BinlogEntry{binlogEntry}
 				}
-				a.applyBinlogMtsTxQueue <- binlogEntry
 			}
 			if !a.shutdown {
 				// TODO what is this used for?
 				a.mysqlContext.Gtid = fmt.Sprintf("%s:1-%d", txSid, binlogEntry.Coordinates.GNO)
 			}
+		case <-groupTimeout:
+			if !flushGroup() {
+				return // shutdown
+			}
 		case <-time.After(10 * time.Second):
 			a.logger.Debugf("mysql.applier: no binlogEntry for 10s")
 		case <-a.shutdownCh:
@@ -766,14 +1179,33 @@ OUTER:
 
 // initiateStreaming begins treaming of binary log events and registers listeners for such events
 func (a *Applier) initiateStreaming() error {
+	if err := a.answerCodecNegotiation(); err != nil {
+		return err
+	}
+	if err := a.answerCopyProgress(); err != nil {
+		return err
+	}
 	if a.mysqlContext.Gtid == "" {
 		a.mysqlContext.MarkRowCopyStartTime()
 		a.logger.Debugf("mysql.applier: nats subscribe")
 		_, err := a.natsConn.Subscribe(fmt.Sprintf("%s_full", a.subject), func(m *gonats.Msg) {
+			if chaos.DropMessage(a.subject) {
+				a.logger.Warnf("mysql.applier: chaos: dropped a message of %v", m.Subject)
+				return
+			}
 			a.logger.Debugf("mysql.applier: full. recv a msg. copyRowsQueue: %v", len(a.copyRowsQueue))
+			atomic.AddInt64(&a.wireBytes, int64(len(m.Data)))
+			complete, err := a.openMsg(m)
+			if err != nil {
+				a.onError(TaskStateDead, err)
+				return
+			}
+			if !complete {
+				return
+			}
 
 			dumpData := &DumpEntry{}
-			if err := Decode(m.Data, dumpData); err != nil {
+			if err := a.decode(m.Data, dumpData); err != nil {
 				a.onError(TaskStateDead, err)
 			}
 
@@ -791,6 +1223,7 @@ func (a *Applier) initiateStreaming() error {
 				atomic.AddInt64(&a.mysqlContext.RowsEstimate, dumpData.TotalCount)
 			case <-timer.C:
 				atomic.AddInt64(&a.nDumpEntry, -1)
+				a.copyQueue.drop(1)
 
 				a.logger.Debugf("mysql.applier. full. discarding entries")
 				a.mysqlContext.Stage = models.StageSlaveWaitingForWorkersToProcessQueue
@@ -801,8 +1234,17 @@ func (a *Applier) initiateStreaming() error {
 		}*/
 
 		_, err = a.natsConn.Subscribe(fmt.Sprintf("%s_full_complete", a.subject), func(m *gonats.Msg) {
-			dumpData := &dumpStatResult{}
-			if err := Decode(m.Data, dumpData); err != nil {
+			atomic.AddInt64(&a.wireBytes, int64(len(m.Data)))
+			complete, err := a.openMsg(m)
+			if err != nil {
+				a.onError(TaskStateDead, err)
+				return
+			}
+			if !complete {
+				return
+			}
+			dumpData := &DumpStatResult{}
+			if err := a.decode(m.Data, dumpData); err != nil {
 				a.onError(TaskStateDead, err)
 			}
 			a.currentCoordinates.RetrievedGtidSet = dumpData.Gtid
@@ -820,6 +1262,7 @@ func (a *Applier) initiateStreaming() error {
 			if err := a.natsConn.Publish(m.Reply, nil); err != nil {
 				a.onError(TaskStateDead, err)
 			}
+			a.tableRowsCopied = dumpData.TableRows
 			atomic.AddInt64(&a.mysqlContext.TotalRowsCopied, dumpData.TotalCount)
 			atomic.StoreInt64(&a.rowCopyCompleteFlag, 1)
 		})
@@ -829,16 +1272,51 @@ func (a *Applier) initiateStreaming() error {
 	}
 
 	if a.mysqlContext.ApproveHeterogeneous {
+		if a.mysqlContext.SpillDir != "" {
+			if err := a.initSpillBuffer(); err != nil {
+				return err
+			}
+		}
+		if a.mysqlContext.RecordFile != "" {
+			fixture, err := newFixtureWriter(a.mysqlContext.RecordFile)
+			if err != nil {
+				return err
+			}
+			a.fixture = fixture
+			a.logger.Printf("mysql.applier: recording binlog entries to %v", a.mysqlContext.RecordFile)
+		}
+
 		_, err := a.natsConn.Subscribe(fmt.Sprintf("%s_incr_hete", a.subject), func(m *gonats.Msg) {
+			if chaos.DropMessage(a.subject) {
+				a.logger.Warnf("mysql.applier: chaos: dropped a message of %v", m.Subject)
+				return
+			}
+			atomic.AddInt64(&a.wireBytes, int64(len(m.Data)))
+			complete, err := a.openMsg(m)
+			if err != nil {
+				a.onError(TaskStateDead, err)
+				return
+			}
+			if !complete {
+				return
+			}
 			var binlogEntries binlog.BinlogEntries
-			if err := Decode(m.Data, &binlogEntries); err != nil {
+			if err := a.decode(m.Data, &binlogEntries); err != nil {
 				a.onError(TaskStateDead, err)
 			}
 
 			nEntries := len(binlogEntries.Entries)
 
+			if a.spillBuffer != nil {
+				a.spillIncrEntries(m, &binlogEntries)
+				return
+			}
+
 			handled := false
-			for i := 0; !handled && (i < DefaultConnectWaitSecond/2); i++ {
+			for i := 0; !handled && (a.mysqlContext.QueueFullPolicy == config.QueueFullBlock || i < DefaultConnectWaitSecond/2); i++ {
+				if a.shutdown {
+					return
+				}
 				vacancy := cap(a.applyDataEntryQueue) - len(a.applyDataEntryQueue)
 				a.logger.Debugf("applier. incr. nEntries: %v, vacancy: %v", nEntries, vacancy)
 				if vacancy < nEntries {
@@ -847,12 +1325,14 @@ func (a *Applier) initiateStreaming() error {
 				} else {
 					a.logger.Debugf("applier. incr. applyDataEntryQueue enqueue")
 					for _, binlogEntry := range binlogEntries.Entries {
+						atomic.AddInt64(&a.nPendingEntry, 1)
 						a.applyDataEntryQueue <- binlogEntry
 						a.currentCoordinates.RetrievedGtidSet = binlogEntry.Coordinates.GetGtidForThisTx()
 						atomic.AddInt64(&a.mysqlContext.DeltaEstimate, 1)
 					}
 					a.mysqlContext.Stage = models.StageWaitingForMasterToSendEvent
 
+					a.recordEntries(m.Data)
 					if err := a.natsConn.Publish(m.Reply, nil); err != nil {
 						a.onError(TaskStateDead, err)
 					}
@@ -863,6 +1343,7 @@ func (a *Applier) initiateStreaming() error {
 			}
 			if !handled {
 				// discard these entries
+				a.applyQueue.drop(nEntries)
 				a.logger.Debugf("applier. incr. discarding entries")
 				a.mysqlContext.Stage = models.StageWaitingForMasterToSendEvent
 			}
@@ -874,8 +1355,20 @@ func (a *Applier) initiateStreaming() error {
 		go a.heterogeneousReplay()
 	} else {
 		_, err := a.natsConn.Subscribe(fmt.Sprintf("%s_incr", a.subject), func(m *gonats.Msg) {
+			if chaos.DropMessage(a.subject) {
+				a.logger.Warnf("mysql.applier: chaos: dropped a message of %v", m.Subject)
+				return
+			}
+			complete, err := a.openMsg(m)
+			if err != nil {
+				a.onError(TaskStateDead, err)
+				return
+			}
+			if !complete {
+				return
+			}
 			var binlogTx []*binlog.BinlogTx
-			if err := Decode(m.Data, &binlogTx); err != nil {
+			if err := a.decode(m.Data, &binlogTx); err != nil {
 				a.onError(TaskStateDead, err)
 			}
 			for _, tx := range binlogTx {
@@ -897,8 +1390,93 @@ func (a *Applier) initiateStreaming() error {
 	return nil
 }
 
+// initSpillBuffer puts a spill buffer between the incremental subscription and applyDataEntryQueue.
+func (a *Applier) initSpillBuffer() (err error) {
+	const mb = 1024 * 1024
+	a.spillBuffer, err = newSpillBuffer(filepath.Join(a.mysqlContext.SpillDir, a.subject),
+		int64(a.mysqlContext.SpillMemoryMB)*mb,
+		int64(a.mysqlContext.SpillHighWatermarkMB)*mb,
+		int64(a.mysqlContext.SpillLowWatermarkMB)*mb)
+	if err != nil {
+		return err
+	}
+	a.logger.Printf("mysql.applier: spilling binlog entries to %s", a.spillBuffer.dir)
+	go a.feedSpilledEntries()
+	return nil
+}
+
+// spillIncrEntries buffers a received message, and acks it unless the buffer
+// stays above its high watermark. The extractor resends unacked messages.
+func (a *Applier) spillIncrEntries(m *gonats.Msg, binlogEntries *binlog.BinlogEntries) {
+	ok, err := a.spillBuffer.Push(m.Data, DefaultConnectWait/2)
+	if err != nil {
+		if !a.shutdown {
+			a.onError(TaskStateDead, err)
+		}
+		return
+	}
+	if !ok {
+		a.logger.Debugf("applier. incr. spill buffer is full. discarding entries")
+		return
+	}
+
+	nEntries := len(binlogEntries.Entries)
+	atomic.AddInt64(&a.nPendingEntry, int64(nEntries))
+	if nEntries > 0 {
+		a.currentCoordinates.RetrievedGtidSet = binlogEntries.Entries[nEntries-1].Coordinates.GetGtidForThisTx()
+	}
+	a.mysqlContext.Stage = models.StageWaitingForMasterToSendEvent
+	a.recordEntries(m.Data)
+
+	if err := a.natsConn.Publish(m.Reply, nil); err != nil {
+		a.onError(TaskStateDead, err)
+	}
+	a.logger.Debugf("applier. incr. ack-recv. nEntries: %v, spilled: %v", nEntries, a.spillBuffer.Size())
+}
+
+// feedSpilledEntries moves the buffered binlog entries to applyDataEntryQueue.
+func (a *Applier) feedSpilledEntries() {
+	for {
+		data, err := a.spillBuffer.Pop()
+		if err != nil {
+			if !a.shutdown {
+				a.onError(TaskStateDead, err)
+			}
+			return
+		}
+		var binlogEntries binlog.BinlogEntries
+		if err := Decode(data, &binlogEntries); err != nil {
+			a.onError(TaskStateDead, err)
+			return
+		}
+		for _, binlogEntry := range binlogEntries.Entries {
+			select {
+			case a.applyDataEntryQueue <- binlogEntry:
+				atomic.AddInt64(&a.mysqlContext.DeltaEstimate, 1)
+			case <-a.shutdownCh:
+				return
+			}
+		}
+	}
+}
+
 func (a *Applier) initDBConnections() (err error) {
+	proxy, err := a.checkProxy()
+	if err != nil {
+		return err
+	}
+	a.initGroupReplication(proxy)
 	applierUri := a.mysqlContext.ConnectionConfig.GetDBUri()
+	if a.group != nil && !a.group.routed {
+		applierUri = a.mysqlContext.ConnectionConfig.GetDBUriByNet(a.group.network)
+	}
+	if a.mysqlContext.DisableSqlLogBin {
+		// applied to each connection of the pool
+		applierUri += "&sql_log_bin=0"
+	}
+	if a.mysqlContext.DisableTriggers {
+		applierUri += fmt.Sprintf("&@%s=1", g.DisableTriggersVariable)
+	}
 	if a.db, err = sql.CreateDB(applierUri); err != nil {
 		return err
 	}
@@ -931,22 +1509,37 @@ func (a *Applier) initDBConnections() (err error) {
 		a.logger.Debugf("mysql.applier. after createTableGtidExecutedV2")
 
 		for i := range a.dbs {
-			a.dbs[i].PsDeleteExecutedGtid, err = a.dbs[i].Db.PrepareContext(context.Background(), fmt.Sprintf("delete from %v.%v where job_uuid = unhex('%s') and source_uuid = ?",
-				g.DtleSchemaName, g.GtidExecutedTableV3, hex.EncodeToString(a.subjectUUID.Bytes())))
-			if err != nil {
+			if err := a.prepareConn(a.dbs[i]); err != nil {
 				return err
 			}
-			a.dbs[i].PsInsertExecutedGtid, err = a.dbs[i].Db.PrepareContext(context.Background(), fmt.Sprintf("replace into %v.%v "+
-				"(job_uuid,source_uuid,interval_gtid) "+
-				"values (unhex('%s'), ?, ?)",
-				g.DtleSchemaName, g.GtidExecutedTableV3,
-				hex.EncodeToString(a.subjectUUID.Bytes())))
-			if err != nil {
+		}
+		a.logger.Debugf("mysql.applier. after prepare stmt for gtid_executed table")
+
+		if a.mysqlContext.FillGtidGaps {
+			if err := a.validateFillGtidGaps(); err != nil {
+				return err
+			}
+		}
+
+		if len(a.mysqlContext.ConflictPolicies) > 0 {
+			if err := a.createConflictTables(); err != nil {
 				return err
 			}
+		}
 
+		if err := a.createProvenanceTables(); err != nil {
+			return err
+		}
+		a.provenance = newProvenance()
+
+		if err := a.createDDLHistoryTable(); err != nil {
+			return err
+		}
+	}
+	if a.mysqlContext.BlobOffload != nil {
+		if err := a.initBlobOffload(); err != nil {
+			return err
 		}
-		a.logger.Debugf("mysql.applier. after prepare stmt for gtid_executed table")
 	}
 	/*if err := a.readCurrentBinlogCoordinates(); err != nil {
 		return err
@@ -958,23 +1551,64 @@ func (a *Applier) initDBConnections() (err error) {
 	return nil
 }
 
+// prepareConn prepares the statements of a worker connection
+func (a *Applier) prepareConn(conn *sql.Conn) (err error) {
+	if !a.mysqlContext.ApproveHeterogeneous {
+		return nil
+	}
+	conn.PsDeleteExecutedGtid, err = conn.Db.PrepareContext(context.Background(), fmt.Sprintf("delete from %v.%v where job_uuid = unhex('%s') and source_uuid = ?",
+		g.DtleSchemaName, g.GtidExecutedTableV3, hex.EncodeToString(a.subjectUUID.Bytes())))
+	if err != nil {
+		return err
+	}
+	conn.PsInsertExecutedGtid, err = conn.Db.PrepareContext(context.Background(), fmt.Sprintf("replace into %v.%v "+
+		"(job_uuid,source_uuid,interval_gtid,origin_uuid) "+
+		"values (unhex('%s'), ?, ?, ?)",
+		g.DtleSchemaName, g.GtidExecutedTableV3,
+		hex.EncodeToString(a.subjectUUID.Bytes())))
+	return err
+}
+
 func (a *Applier) validateServerUUID() error {
 	query := `SELECT @@SERVER_UUID`
-	if err := a.db.QueryRow(query).Scan(&a.mysqlContext.MySQLServerUuid); err != nil {
+	db := a.db
+	if cc := a.mysqlContext.ConnectionConfig; cc.BinlogHost != "" {
+		// a proxy may answer from any of its servers
+		direct, err := sql.CreateDB(cc.Direct().GetDBUri())
+		if err != nil {
+			return err
+		}
+		defer direct.Close()
+		db = direct
+	}
+	ctx, cancel := a.queryContext()
+	defer cancel()
+	if err := db.QueryRowContext(ctx, query).Scan(&a.mysqlContext.MySQLServerUuid); err != nil {
 		return err
 	}
 	return nil
 }
 
+// queryContext bounds a query on the metadata or the status of the target
+// by QueryTimeoutSeconds. The caller cancels it once the rows are read.
+func (a *Applier) queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(a.ctx, a.mysqlContext.QueryTimeout())
+}
+
 // validateConnection issues a simple can-connect to MySQL
 func (a *Applier) validateConnection(db *gosql.DB) error {
+	ctx, cancel := a.queryContext()
+	defer cancel()
 	query := `select @@global.version`
-	if err := db.QueryRow(query).Scan(&a.mysqlContext.MySQLVersion); err != nil {
+	if err := db.QueryRowContext(ctx, query).Scan(&a.mysqlContext.MySQLVersion); err != nil {
 		return err
 	}
 	// Match the version string (from SELECT VERSION()).
 	if strings.HasPrefix(a.mysqlContext.MySQLVersion, "5.6") {
+		a.tuneLock.Lock()
 		a.mysqlContext.ParallelWorkers = 1
+		a.activeWorkers = 1
+		a.tuneLock.Unlock()
 	}
 	a.logger.Debugf("mysql.applier: Connection validated on %s:%d", a.mysqlContext.ConnectionConfig.Host, a.mysqlContext.ConnectionConfig.Port)
 	return nil
@@ -992,7 +1626,9 @@ func (a *Applier) validateGrants() error {
 	foundSuper := false
 	foundDBAll := false
 
-	err := sql.QueryRowsMap(a.db, query, func(rowMap sql.RowMap) error {
+	ctx, cancel := a.queryContext()
+	defer cancel()
+	err := sql.QueryRowsMap(ctx, a.db, query, func(rowMap sql.RowMap) error {
 		for _, grantData := range rowMap {
 			grant := grantData.String
 			if strings.Contains(grant, `GRANT ALL PRIVILEGES ON`) {
@@ -1035,8 +1671,10 @@ func (a *Applier) validateGrants() error {
 
 // validateAndReadTimeZone potentially reads server time-zone
 func (a *Applier) validateAndReadTimeZone() error {
+	ctx, cancel := a.queryContext()
+	defer cancel()
 	query := `select @@global.time_zone`
-	if err := a.db.QueryRow(query).Scan(&a.mysqlContext.TimeZone); err != nil {
+	if err := a.db.QueryRowContext(ctx, query).Scan(&a.mysqlContext.TimeZone); err != nil {
 		return err
 	}
 
@@ -1082,13 +1720,31 @@ func (a *Applier) migrateGtidExecutedV2toV3() error {
 
 	return nil
 }
+
+// addGtidExecutedOriginColumn upgrades a table created before origin_uuid was added.
+func (a *Applier) addGtidExecutedOriginColumn() error {
+	ctx, cancel := a.queryContext()
+	defer cancel()
+	ok, err := hasColumn(ctx, a.db, g.DtleSchemaName, g.GtidExecutedTableV3, "origin_uuid")
+	if err != nil || ok {
+		return err
+	}
+	a.logger.Infof("mysql.applier: add column origin_uuid to %v.%v", g.DtleSchemaName, g.GtidExecutedTableV3)
+	_, err = a.db.Exec(fmt.Sprintf("alter table %v.%v add column origin_uuid binary(16) NULL "+
+		"COMMENT 'uuid of the source where a cascaded transaction was first executed.'",
+		g.DtleSchemaName, g.GtidExecutedTableV3))
+	return err
+}
+
 func (a *Applier) createTableGtidExecutedV3() error {
-	if result, err := sql.QueryResultData(a.db, fmt.Sprintf("SHOW TABLES FROM %v LIKE '%v%%'",
+	ctx, cancel := a.queryContext()
+	defer cancel()
+	if result, err := sql.QueryResultData(ctx, a.db, fmt.Sprintf("SHOW TABLES FROM %v LIKE '%v%%'",
 		g.DtleSchemaName, g.GtidExecutedTempTablePrefix)); nil == err && len(result) > 0 {
 		return fmt.Errorf("GtidExecutedTempTable exists. require manual intervention")
 	}
 
-	if result, err := sql.QueryResultData(a.db, fmt.Sprintf("SHOW TABLES FROM %v LIKE '%v%%'",
+	if result, err := sql.QueryResultData(ctx, a.db, fmt.Sprintf("SHOW TABLES FROM %v LIKE '%v%%'",
 		g.DtleSchemaName, g.GtidExecutedTablePrefix)); nil == err && len(result) > 0 {
 		if len(result) > 1 {
 			return fmt.Errorf("multiple GtidExecutedTable exists, while at most one is allowed. require manual intervention")
@@ -1102,8 +1758,9 @@ func (a *Applier) createTableGtidExecutedV3() error {
 				if err != nil {
 					return err
 				}
+				return a.addGtidExecutedOriginColumn()
 			case g.GtidExecutedTableV3:
-				return nil
+				return a.addGtidExecutedOriginColumn()
 			default:
 				return fmt.Errorf("newer GtidExecutedTable exists, which is unrecognized by this verion. require manual intervention")
 			}
@@ -1124,7 +1781,8 @@ func (a *Applier) createTableGtidExecutedV3() error {
 			CREATE TABLE IF NOT EXISTS %v.%v (
 				job_uuid binary(16) NOT NULL COMMENT 'unique identifier of job',
 				source_uuid binary(16) NOT NULL COMMENT 'uuid of the source where the transaction was originally executed.',
-				interval_gtid longtext NOT NULL COMMENT 'number of interval.'
+				interval_gtid longtext NOT NULL COMMENT 'number of interval.',
+				origin_uuid binary(16) NULL COMMENT 'uuid of the source where a cascaded transaction was first executed.'
 			);
 		`, g.DtleSchemaName, g.GtidExecutedTableV3)
 	if _, err := a.db.Exec(query); err != nil {
@@ -1218,44 +1876,183 @@ func (a *Applier) buildDMLEventQuery(dmlEvent binlog.DataEvent, workerIdx int) (
 
 // ApplyEventQueries applies multiple DML queries onto the dest table
 func (a *Applier) ApplyBinlogEvent(workerIdx int, binlogEntry *binlog.BinlogEntry) error {
+	return a.ApplyBinlogEvents(workerIdx, []*binlog.BinlogEntry{binlogEntry})
+}
+
+// ApplyBinlogEvents applies binlog entries in one transaction of the target
+func (a *Applier) ApplyBinlogEvents(workerIdx int, binlogEntries []*binlog.BinlogEntry) error {
+	if a.throttler != nil && !a.throttler.wait(a.shutdownCh) {
+		return fmt.Errorf("applier shut down while throttled")
+	}
+	chaos.DelayApply(a.subject)
 	dbApplier := a.dbs[workerIdx]
 
+	dbApplier.DbMutex.Lock()
+	defer func() {
+		if a.applied != nil {
+			a.applied(binlogEntries)
+		}
+		atomic.AddInt64(&a.nPendingEntry, -int64(len(binlogEntries)))
+		if a.printTps {
+			atomic.AddUint32(&a.txLastNSeconds, uint32(len(binlogEntries)))
+		}
+
+		dbApplier.DbMutex.Unlock()
+	}()
+
+	err := a.retryOnTarget(func() error {
+		if dbApplier.Db == nil {
+			if err := a.reopenConn(dbApplier); err != nil {
+				return err
+			}
+		}
+		var err error
+		if a.mysqlContext.TiDB {
+			err = a.retryTiDB(func() error {
+				return a.applyBinlogEntries(dbApplier, workerIdx, binlogEntries)
+			})
+		} else {
+			err = a.applyBinlogEntries(dbApplier, workerIdx, binlogEntries)
+		}
+		if a.group != nil && isConnectionError(err) {
+			// reopened by the next attempt
+			dbApplier.Db.Close()
+			dbApplier.Db = nil
+		}
+		return err
+	})
+	if err != nil && !isConnectionError(err) && a.armedSkipTx() != nil {
+		return a.skipFailingTx(dbApplier, workerIdx, binlogEntries, err)
+	}
+	if err != nil && a.canBisect(dbApplier, binlogEntries) {
+		err = a.localizeApplyError(dbApplier, workerIdx, binlogEntries, err)
+	}
+	return err
+}
+
+func (a *Applier) applyBinlogEntries(dbApplier *sql.Conn, workerIdx int, binlogEntries []*binlog.BinlogEntry) (err error) {
 	var totalDelta int64
-	var err error
 
-	txSid := binlogEntry.Coordinates.GetSid()
+	if a.mysqlContext.FillGtidGaps {
+		// a single entry, as TxBoundary is "preserve"
+		if err := a.setGtidNext(dbApplier, binlogEntries[0]); err != nil {
+			return err
+		}
+	}
 
-	dbApplier.DbMutex.Lock()
-	tx, err := dbApplier.Db.BeginTx(context.Background(), &gosql.TxOptions{})
+	tx, err := dbApplier.Db.BeginTx(context.Background(), a.txOptions)
 	if err != nil {
 		return err
 	}
 	defer func() {
+		if a.mysqlContext.TiDB {
+			// TiDB: roll back a failed tx and return the errors, for it to be retried
+			if err != nil {
+				tx.Rollback()
+				return
+			}
+			if err = tx.Commit(); err != nil {
+				return
+			}
+		} else if err != nil {
+			// retried by retryOnTarget, or else bisected by ApplyBinlogEvents
+			tx.Rollback()
+			return
+		} else if err = tx.Commit(); err != nil {
+			return
+		} else if a.mysqlContext.FillGtidGaps {
+			if _, err := sql.ExecNoPrepare(dbApplier.Db, "set gtid_next='automatic'"); err != nil {
+				a.onError(TaskStateDead, err)
+				return
+			}
+		}
+		for _, binlogEntry := range binlogEntries {
+			if !binlogEntry.MoreParts {
+				a.mtsManager.Executed(binlogEntry)
+			}
+			atomic.StoreInt64(&a.lastAppliedEventTime, int64(binlogEntry.Coordinates.EventTimestamp))
+			atomic.AddInt64(&a.appliedBytes, int64(binlogEntry.OriginalSize))
+		}
+	}()
+
+	// statements in tx, for TiDBTxnStmtLimit
+	nStmt := 0
+	splitTx := func() error {
+		nStmt++
+		// keep room for the gtid_executed statement
+		if !a.mysqlContext.TiDB || nStmt < a.mysqlContext.TiDBTxnStmtLimit {
+			return nil
+		}
+		a.logger.Debugf("mysql.applier: split tx for TiDB")
 		if err := tx.Commit(); err != nil {
-			a.onError(TaskStateDead, err)
-		} else {
-			a.mtsManager.Executed(binlogEntry)
+			return err
 		}
-		if a.printTps {
-			atomic.AddUint32(&a.txLastNSeconds, 1)
+		nextTx, err := dbApplier.Db.BeginTx(context.Background(), a.txOptions)
+		if err != nil {
+			return err
 		}
+		tx = nextTx
+		nStmt = 1
+		return nil
+	}
 
-		dbApplier.DbMutex.Unlock()
-	}()
+	for _, binlogEntry := range binlogEntries {
+		txSid := binlogEntry.Coordinates.GetSid()
 
-	for i, event := range binlogEntry.Events {
-		a.logger.Debugf("mysql.applier: ApplyBinlogEvent. gno: %v, event: %v",
-			binlogEntry.Coordinates.GNO, i)
-		switch event.DML {
-		case binlog.NotDML:
-			var err error
-			a.logger.Debugf("mysql.applier: ApplyBinlogEvent: not dml: %v", event.Query)
-
-			if event.CurrentSchema != "" {
-				// TODO escape schema name?
-				query := fmt.Sprintf("USE %s", event.CurrentSchema)
-				a.logger.Debugf("mysql.applier: query: %v", query)
-				_, err = tx.Exec(query)
+		for i, event := range binlogEntry.Events {
+			if err := splitTx(); err != nil {
+				return err
+			}
+			a.logger.Debugf("mysql.applier: ApplyBinlogEvent. gno: %v, event: %v",
+				binlogEntry.Coordinates.GNO, i)
+			switch event.DML {
+			case binlog.NotDML:
+				var err error
+				a.logger.Debugf("mysql.applier: ApplyBinlogEvent: not dml: %v", event.Query)
+
+				if event.CurrentSchema != "" {
+					// TODO escape schema name?
+					query := fmt.Sprintf("USE %s", event.CurrentSchema)
+					a.logger.Debugf("mysql.applier: query: %v", query)
+					_, err = tx.Exec(query)
+					if err != nil {
+						if !sql.IgnoreError(err) {
+							a.logger.Errorf("mysql.applier: Exec sql error: %v", err)
+							return err
+						} else {
+							a.logger.Warnf("mysql.applier: Ignore error: %v", err)
+						}
+					}
+				}
+
+				schema := event.DatabaseName
+				if schema == "" {
+					schema = event.CurrentSchema
+				}
+				if event.TableName != "" {
+					a.logger.Debugf("mysql.applier: reset tableItem %v.%v", schema, event.TableName)
+					a.getTableItem(schema, event.TableName).Reset()
+					if err := a.claimTable(schema, event.TableName); err != nil {
+						return err
+					}
+					if a.provenance != nil {
+						a.provenance.written(schema, event.TableName, false)
+					}
+				} else { // TableName == ""
+					if event.DatabaseName != "" {
+						if schemaItem, ok := a.tableItems[event.DatabaseName]; ok {
+							for tableName, v := range schemaItem {
+								a.logger.Debugf("mysql.applier: reset tableItem %v.%v", event.DatabaseName, tableName)
+								v.Reset()
+							}
+						}
+						delete(a.tableItems, event.DatabaseName)
+					}
+				}
+
+				start := time.Now()
+				_, err = tx.Exec(event.Query)
+				took := time.Since(start)
 				if err != nil {
 					if !sql.IgnoreError(err) {
 						a.logger.Errorf("mysql.applier: Exec sql error: %v", err)
@@ -1264,104 +2061,223 @@ func (a *Applier) ApplyBinlogEvent(workerIdx int, binlogEntry *binlog.BinlogEntr
 						a.logger.Warnf("mysql.applier: Ignore error: %v", err)
 					}
 				}
-			}
-
-			if event.TableName != "" {
-				var schema string
-				if event.DatabaseName != "" {
-					schema = event.DatabaseName
-				} else {
-					schema = event.CurrentSchema
-				}
-				a.logger.Debugf("mysql.applier: reset tableItem %v.%v", schema, event.TableName)
-				a.getTableItem(schema, event.TableName).Reset()
-			} else { // TableName == ""
-				if event.DatabaseName != "" {
-					if schemaItem, ok := a.tableItems[event.DatabaseName]; ok {
-						for tableName, v := range schemaItem {
-							a.logger.Debugf("mysql.applier: reset tableItem %v.%v", event.DatabaseName, tableName)
-							v.Reset()
-						}
+				a.logger.Debugf("mysql.applier: Exec [%s]", event.Query)
+				if a.mysqlContext.ApproveHeterogeneous {
+					if errRecord := a.recordDDL(tx, binlogEntry, &event, schema, took, err); errRecord != nil {
+						return errRecord
 					}
-					delete(a.tableItems, event.DatabaseName)
 				}
-			}
-
-			_, err = tx.Exec(event.Query)
-			if err != nil {
-				if !sql.IgnoreError(err) {
-					a.logger.Errorf("mysql.applier: Exec sql error: %v", err)
+			default:
+				a.logger.Debugf("mysql.applier: ApplyBinlogEvent: a dml event")
+				if err := a.claimTable(event.DatabaseName, event.TableName); err != nil {
 					return err
-				} else {
-					a.logger.Warnf("mysql.applier: Ignore error: %v", err)
+				}
+				applied, rowDelta, err := a.execDML(tx, workerIdx, binlogEntry, i, &event)
+				if err != nil {
+					a.logger.Errorf("mysql.applier: gtid: %s:%d, error: %v", txSid, binlogEntry.Coordinates.GNO, err)
+					return err
+				}
+				if !applied {
+					continue
+				}
+				totalDelta += rowDelta
+				if a.provenance != nil {
+					a.provenance.written(event.DatabaseName, event.TableName, false)
 				}
 			}
-			a.logger.Debugf("mysql.applier: Exec [%s]", event.Query)
-		default:
-			a.logger.Debugf("mysql.applier: ApplyBinlogEvent: a dml event")
-			stmt, args, rowDelta, err := a.buildDMLEventQuery(event, workerIdx)
-			if err != nil {
-				a.logger.Errorf("mysql.applier: Build dml query error: %v", err)
-				return err
-			}
-
-			a.logger.Debugf("ApplyBinlogEvent. args: %v", args)
+		}
 
-			var r gosql.Result
-			r, err = stmt.Exec(args...)
-			if err != nil {
-				a.logger.Errorf("mysql.applier: gtid: %s:%d, error: %v", txSid, binlogEntry.Coordinates.GNO, err)
+		if binlogEntry.Part > 0 {
+			if err = a.recordPart(tx, binlogEntry); err != nil {
 				return err
 			}
-			nr, err := r.RowsAffected()
-			if err != nil {
-				a.logger.Debugf("ApplyBinlogEvent executed gno %v event %v rows_affected_err %v schema", binlogEntry.Coordinates.GNO, i, err)
-			} else {
-				a.logger.Debugf("ApplyBinlogEvent executed gno %v event %v rows_affected %v", binlogEntry.Coordinates.GNO, i, nr)
+			if binlogEntry.MoreParts {
+				// executed with its last part
+				continue
 			}
-			totalDelta += rowDelta
 		}
-	}
 
-	a.logger.Debugf("ApplyBinlogEvent. insert gno: %v", binlogEntry.Coordinates.GNO)
-	_, err = dbApplier.PsInsertExecutedGtid.Exec(binlogEntry.Coordinates.SID.Bytes(), binlogEntry.Coordinates.GNO)
-	if err != nil {
-		return err
+		a.logger.Debugf("ApplyBinlogEvent. insert gno: %v", binlogEntry.Coordinates.GNO)
+		if err = insertExecutedGtid(dbApplier, binlogEntry); err != nil {
+			return err
+		}
 	}
 
 	// no error
 	a.mysqlContext.Stage = models.StageWaitingForGtidToBeCommitted
-	atomic.AddInt64(&a.mysqlContext.TotalDeltaCopied, 1)
+	atomic.AddInt64(&a.mysqlContext.TotalDeltaCopied, int64(len(binlogEntries)))
 	return nil
 }
 
-func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *DumpEntry) error {
+// insertExecutedGtid records the transaction of binlogEntry in gtid_executed,
+// in the transaction of the target open on dbApplier, with the XA PREPARE it
+// ends, if any.
+func insertExecutedGtid(dbApplier *sql.Conn, binlogEntry *binlog.BinlogEntry) error {
+	if xa := binlogEntry.XAPrepare; xa != nil {
+		if err := insertExecutedCoordinates(dbApplier, xa); err != nil {
+			return err
+		}
+	}
+	return insertExecutedCoordinates(dbApplier, &binlogEntry.Coordinates)
+}
+
+func insertExecutedCoordinates(dbApplier *sql.Conn, coordinates *base.BinlogCoordinateTx) error {
+	// Keep the first origin of a cascaded (A->B->C) tx, so it is skipped if it loops back.
+	originSID := coordinates.SID
+	if coordinates.OSID != "" {
+		if osid, err := uuid.FromString(coordinates.OSID); err == nil {
+			originSID = osid
+		}
+	}
+	_, err := dbApplier.PsInsertExecutedGtid.Exec(coordinates.SID.Bytes(), coordinates.GNO, originSID.Bytes())
+	return err
+}
+
+// execDML applies the row event i of binlogEntry in tx. It is not applied
+// if the conflict policy of its table skips it.
+func (a *Applier) execDML(tx *gosql.Tx, workerIdx int, binlogEntry *binlog.BinlogEntry, i int,
+	event *binlog.DataEvent) (applied bool, rowDelta int64, err error) {
+	if policy := a.conflictPolicy(event.DatabaseName, event.TableName); policy != nil {
+		apply, err := a.resolveConflict(tx, policy, event,
+			fmt.Sprintf("%s:%d", binlogEntry.Coordinates.GetSid(), binlogEntry.Coordinates.GNO))
+		if err != nil || !apply {
+			return false, 0, err
+		}
+	}
+	if a.blobOffload != nil {
+		if err := a.blobOffload.offloadEvent(event, event.TableItem.(*applierTableItem).columns); err != nil {
+			return false, 0, err
+		}
+	}
+	if len(event.JSONDiffs) > 0 {
+		return true, 0, a.execPartialUpdate(tx, event)
+	}
+	stmt, args, rowDelta, err := a.buildDMLEventQuery(*event, workerIdx)
+	if err != nil {
+		return false, 0, fmt.Errorf("build dml query: %v", err)
+	}
+
+	a.logger.Debugf("ApplyBinlogEvent. args: %v", args)
+
+	r, err := stmt.Exec(args...)
+	if err != nil {
+		return false, 0, err
+	}
+	nr, err := r.RowsAffected()
+	if err != nil {
+		a.logger.Debugf("ApplyBinlogEvent executed gno %v event %v rows_affected_err %v schema", binlogEntry.Coordinates.GNO, i, err)
+	} else {
+		a.logger.Debugf("ApplyBinlogEvent executed gno %v event %v rows_affected %v", binlogEntry.Coordinates.GNO, i, nr)
+	}
+	return true, rowDelta, nil
+}
+
+// execPartialUpdate applies an update of JSON columns logged as their
+// changes. Its query depends on the changes, it is not prepared.
+func (a *Applier) execPartialUpdate(tx *gosql.Tx, event *binlog.DataEvent) error {
+	tableColumns := event.TableItem.(*applierTableItem).columns
+	query, args, err := sql.BuildDMLPartialUpdateQuery(event.DatabaseName, event.TableName, tableColumns,
+		event.NewColumnValues.GetAbstractValues(), event.WhereColumnValues.GetAbstractValues(), event.JSONDiffs)
+	if err != nil {
+		return fmt.Errorf("build dml query: %v", err)
+	}
+	a.logger.Debugf("ApplyBinlogEvent. partial update args: %v", args)
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *DumpEntry) (err error) {
 	if a.stubFullApplyDelay {
 		a.logger.Debugf("mysql.applier: stubFullApplyDelay start sleep")
 		time.Sleep(20 * time.Second)
 		a.logger.Debugf("mysql.applier: stubFullApplyDelay end sleep")
 	}
+	if a.throttler != nil && !a.throttler.wait(a.shutdownCh) {
+		return fmt.Errorf("applier shut down while throttled")
+	}
 
-	queries := []string{}
-	queries = append(queries, entry.SystemVariablesStatement, entry.SqlMode, entry.DbSQL)
-	queries = append(queries, entry.TbSQL...)
-	tx, err := db.Begin()
-	if err != nil {
+	if err := a.claimTable(entry.TableSchema, entry.TableName); err != nil {
 		return err
 	}
-	defer func() {
-		if err := tx.Commit(); err != nil {
-			a.onError(TaskStateDead, err)
+
+	queries := []string{}
+	queries = append(queries, entry.DbSQL)
+	queries = append(queries, entry.TbSQL...)
+
+	var exec func(query string) error
+	if a.mysqlContext.TiDB {
+		// Autocommit, so a chunk does not exceed the transaction size limit.
+		// The rows are replaced, so a retried statement does no harm.
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			return err
 		}
-		atomic.AddInt64(&a.mysqlContext.TotalRowsReplay, entry.RowsCount)
-	}()
+		defer func() {
+			conn.Close()
+			if a.isRetriedOnTarget(err) {
+				// retried by retryOnTarget
+				return
+			}
+			if err == nil {
+				atomic.AddInt64(&a.appliedBytes, entry.dataSize())
+			}
+			atomic.AddInt64(&a.mysqlContext.TotalRowsReplay, entry.RowsCount)
+		}()
+		exec = func(query string) error {
+			return a.retryTiDB(func() error {
+				_, err := conn.ExecContext(context.Background(), query)
+				return err
+			})
+		}
+		if err := exec(tidbBatchDMLQuery); err != nil {
+			return err
+		}
+	} else {
+		tx, err := db.BeginTx(context.Background(), a.txOptions)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if a.isRetriedOnTarget(err) {
+				// retried by retryOnTarget
+				tx.Rollback()
+				return
+			}
+			if err := tx.Commit(); err != nil {
+				a.onError(TaskStateDead, err)
+			} else {
+				atomic.AddInt64(&a.appliedBytes, entry.dataSize())
+			}
+			atomic.AddInt64(&a.mysqlContext.TotalRowsReplay, entry.RowsCount)
+		}()
+		exec = func(query string) error {
+			_, err := tx.Exec(query)
+			return err
+		}
+	}
 	sessionQuery := `SET @@session.foreign_key_checks = 0`
-	if _, err := tx.Exec(sessionQuery); err != nil {
+	if err := exec(sessionQuery); err != nil {
 		return err
 	}
+	for _, query := range []string{entry.SystemVariablesStatement, entry.SqlMode} {
+		if query == "" {
+			continue
+		}
+		a.logger.Debugf("mysql.applier: Exec [%s]", query)
+		var err error
+		if a.mysqlContext.TiDBSkipUnsupportedVariables {
+			err = a.execSetStatement(exec, query)
+		} else {
+			err = exec(query)
+		}
+		if err != nil {
+			a.logger.Errorf("mysql.applier: Exec [%s] error: %v", query, err)
+			return err
+		}
+	}
 	execQuery := func(query string) error {
 		a.logger.Debugf("mysql.applier: Exec [%s]", utils.StrLim(query, 256))
-		_, err := tx.Exec(query)
+		err := exec(query)
 		if err != nil {
 			if !sql.IgnoreError(err) {
 				a.logger.Errorf("mysql.applier: Exec [%s] error: %v", utils.StrLim(query, 10), err)
@@ -1384,6 +2300,15 @@ func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *DumpEntry) error {
 		}
 	}
 
+	if a.blobOffload != nil {
+		ctx, cancel := a.queryContext()
+		err := a.blobOffload.offloadDumpEntry(ctx, a.db, entry)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
 	var buf bytes.Buffer
 	BufSizeLimit := 1 * 1024 * 1024 // 1MB. TODO parameterize it
 	BufSizeLimitDelta := 1024
@@ -1429,6 +2354,56 @@ func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *DumpEntry) error {
 	return nil
 }
 
+// rowCountSnapshot starts a transaction reading the target tables as at the
+// end of the full copy, for verifyRowCount to count their rows while the
+// binlog entries are applied.
+func (a *Applier) rowCountSnapshot() (*gosql.Conn, error) {
+	conn, err := a.db.Conn(a.ctx)
+	if err != nil {
+		return nil, err
+	}
+	// a consistent snapshot is taken at once in repeatable read only. The
+	// level is of the next transaction, not of the session.
+	for _, query := range []string{"set transaction isolation level repeatable read",
+		"start transaction with consistent snapshot"} {
+		if _, err := conn.ExecContext(a.ctx, query); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// verifyRowCount compares row counts of the target tables in the snapshot of
+// conn with the rows sent by the extractor. A mismatch is reported but not fatal.
+func (a *Applier) verifyRowCount(conn *gosql.Conn) {
+	defer func() {
+		conn.ExecContext(context.Background(), "rollback")
+		conn.Close()
+	}()
+	mismatch := 0
+	for ident, expected := range a.tableRowsCopied {
+		names := strings.SplitN(ident, ".", 2)
+		if len(names) != 2 {
+			continue
+		}
+		// a count of the rows scans the table, and is not bounded
+		rows, _, _, err := aggregateTable(a.ctx, conn, names[0], names[1], "", "")
+		if a.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			a.logger.Warnf("mysql.applier: verify row count of %v: %v", ident, err)
+			continue
+		}
+		if rows != expected {
+			mismatch++
+			a.logger.Warnf("mysql.applier: verify row count of %v: mismatch. copied %v, target %v", ident, expected, rows)
+		}
+	}
+	a.logger.Printf("mysql.applier: verified row count of %d tables. mismatch: %d", len(a.tableRowsCopied), mismatch)
+}
+
 func (a *Applier) Stats() (*models.TaskStatistics, error) {
 	totalRowsReplay := a.mysqlContext.GetTotalRowsReplay()
 	rowsEstimate := atomic.LoadInt64(&a.mysqlContext.RowsEstimate)
@@ -1470,6 +2445,7 @@ func (a *Applier) Stats() (*models.TaskStatistics, error) {
 		}
 	}
 
+	now := time.Now().UTC()
 	taskResUsage := models.TaskStatistics{
 		ExecMasterRowCount: totalRowsReplay,
 		ExecMasterTxCount:  totalDeltaCopied,
@@ -1479,26 +2455,61 @@ func (a *Applier) Stats() (*models.TaskStatistics, error) {
 		ETA:                eta,
 		Backlog:            backlog,
 		Stage:              a.mysqlContext.Stage,
+		Queues:             a.pipeline.stats(),
+		LagSeconds:         a.lagSeconds(now),
 		CurrentCoordinates: a.currentCoordinates,
 		BufferStat: models.BufferStat{
 			ApplierTxQueueSize:      len(a.applyBinlogTxQueue),
 			ApplierGroupTxQueueSize: len(a.applyBinlogGroupTxQueue),
 		},
-		Timestamp: time.Now().UTC().UnixNano(),
+		TrafficStat: models.TrafficStat{
+			WireBytes:    atomic.LoadInt64(&a.wireBytes),
+			AppliedBytes: atomic.LoadInt64(&a.appliedBytes),
+		},
+		Timestamp: now.UnixNano(),
 	}
+	a.codecStats.trafficStat(&taskResUsage.TrafficStat)
 	if a.natsConn != nil {
 		taskResUsage.MsgStat = a.natsConn.Statistics
 	}
+	if a.spillBuffer != nil {
+		taskResUsage.BufferStat.ApplierSpillBytes = a.spillBuffer.Size()
+	}
+	if a.throttler != nil {
+		taskResUsage.ThrottleReason = a.throttler.Reason()
+	}
 
 	return &taskResUsage, nil
 }
 
+// lagSeconds returns how far the applier is behind the source: since the
+// source time of the last transaction applied, while others are pending.
+func (a *Applier) lagSeconds(now time.Time) int64 {
+	if atomic.LoadInt64(&a.incrStarted) == 0 || atomic.LoadInt64(&a.nPendingEntry) == 0 {
+		return 0
+	}
+	applied := atomic.LoadInt64(&a.lastAppliedEventTime)
+	if applied == 0 || now.Unix() < applied {
+		return 0
+	}
+	return now.Unix() - applied
+}
+
 func (a *Applier) ID() string {
+	gtid := a.mysqlContext.Gtid
+	var copyProgress *models.CopyProgress
+	if a.standby != nil && !a.standby.isActive() {
+		// only the active applier reports the checkpoint
+		gtid = ""
+	} else if gtid == "" {
+		copyProgress = a.currentCopyProgress()
+	}
 	id := config.DriverCtx{
 		DriverConfig: &config.MySQLDriverConfig{
 			ReplicateDoDb:     a.mysqlContext.ReplicateDoDb,
 			ReplicateIgnoreDb: a.mysqlContext.ReplicateIgnoreDb,
-			Gtid:              a.mysqlContext.Gtid,
+			Gtid:              gtid,
+			CopyProgress:      copyProgress,
 			NatsAddr:          a.mysqlContext.NatsAddr,
 			ParallelWorkers:   a.mysqlContext.ParallelWorkers,
 			ConnectionConfig:  a.mysqlContext.ConnectionConfig,
@@ -1516,10 +2527,18 @@ func (a *Applier) onError(state int, err error) {
 	if a.shutdown {
 		return
 	}
-	switch state {
-	case TaskStateComplete:
+	switch {
+	case a.standby != nil && (!a.standby.isActive() || state == TaskStateDead):
+		// the other applier of the job goes on with the extractor
+		a.logger.Printf("mysql.applier: leaving the job to the other applier")
+	case state == TaskStateComplete:
 		a.logger.Printf("mysql.applier: Done migrating")
-	case TaskStateRestart:
+		if a.natsConn != nil {
+			if err := a.natsConn.Publish(fmt.Sprintf("%s_complete", a.subject), []byte(a.mysqlContext.Gtid)); err != nil {
+				a.logger.Errorf("mysql.applier: Trigger extractor complete: %v", err)
+			}
+		}
+	case state == TaskStateRestart:
 		if a.natsConn != nil {
 			if err := a.natsConn.Publish(fmt.Sprintf("%s_restart", a.subject), []byte(a.mysqlContext.Gtid)); err != nil {
 				a.logger.Errorf("mysql.applier: Trigger restart extractor : %v", err)
@@ -1554,6 +2573,21 @@ func (a *Applier) Shutdown() error {
 
 	a.shutdown = true
 	close(a.shutdownCh)
+	a.cancel()
+	if a.unregisterChaos != nil {
+		a.unregisterChaos()
+	}
+
+	if a.spillBuffer != nil {
+		if err := a.spillBuffer.Close(); err != nil {
+			a.logger.Errorf("mysql.applier: error closing spill buffer: %v", err)
+		}
+	}
+	if a.fixture != nil {
+		if err := a.fixture.close(); err != nil {
+			a.logger.Errorf("mysql.applier: error closing %v: %v", a.mysqlContext.RecordFile, err)
+		}
+	}
 
 	if err := sql.CloseDB(a.db); err != nil {
 		return err
@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestOrderValuesByColumns(t *testing.T) {
+	columns := umconf.NewColumnList([]umconf.Column{{Name: "id"}, {Name: "Name"}, {Name: "age"}})
+	event := binlog.NewDataEvent("db1", "t1", binlog.UpdateDML, 4)
+	event.ColumnNames = []string{"age", "extra", "name", "id"}
+	event.WhereColumnValues = umconf.ToColumnValues([]interface{}{int64(20), "x", nil, int64(1)})
+	event.NewColumnValues = umconf.ToColumnValues([]interface{}{int64(21), "y", "b", int64(1)})
+	if err := orderValuesByColumns(&event, columns); err != nil {
+		t.Fatal(err)
+	}
+	values := func(cv *umconf.ColumnValues) (vs []interface{}) {
+		for _, v := range cv.GetAbstractValues() {
+			vs = append(vs, *v)
+		}
+		return vs
+	}
+	if got, want := values(event.WhereColumnValues), []interface{}{int64(1), nil, int64(20)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("where values = %v, want %v", got, want)
+	}
+	if got, want := values(event.NewColumnValues), []interface{}{int64(1), "b", int64(21)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("new values = %v, want %v", got, want)
+	}
+	if event.ColumnNames != nil || event.ColumnCount != 3 {
+		t.Errorf("ColumnNames = %v, ColumnCount = %v", event.ColumnNames, event.ColumnCount)
+	}
+
+	event = binlog.NewDataEvent("db1", "t1", binlog.InsertDML, 1)
+	event.ColumnNames = []string{"id"}
+	event.NewColumnValues = umconf.ToColumnValues([]interface{}{int64(1)})
+	if err := orderValuesByColumns(&event, columns); err == nil {
+		t.Errorf("orderValuesByColumns() should fail on missing columns")
+	}
+}
@@ -0,0 +1,289 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// AssessOptions tunes an assessment.
+type AssessOptions struct {
+	// max_payload of the agents. A row bigger than it stops the job
+	MaxPayload int
+	// read the biggest BLOB/TEXT/JSON values of each table, instead of
+	// judging from the column types only. It scans the tables.
+	ScanBlobs bool
+}
+
+// assessColumn, assessIndex and assessForeignKey are what an assessment
+// reads from information_schema.
+type assessColumn struct {
+	name       string
+	dataType   string
+	columnType string
+	charset    string
+	nullable   bool
+}
+
+type assessIndex struct {
+	name    string
+	unique  bool
+	columns []string
+}
+
+type assessForeignKey struct {
+	name       string
+	refSchema  string
+	refTable   string
+	updateRule string
+	deleteRule string
+}
+
+type assessTableInfo struct {
+	schema      string
+	table       string
+	columns     []*assessColumn
+	indexes     []*assessIndex
+	foreignKeys []*assessForeignKey
+	nTriggers   int
+	// the biggest sum of the BLOB/TEXT/JSON values of a row, or -1 if not scanned
+	maxBlobBytes int64
+}
+
+// maximum length of the values of the types
+var blobCapacity = map[string]int64{
+	"tinyblob":   1<<8 - 1,
+	"tinytext":   1<<8 - 1,
+	"blob":       1<<16 - 1,
+	"text":       1<<16 - 1,
+	"mediumblob": 1<<24 - 1,
+	"mediumtext": 1<<24 - 1,
+	"longblob":   1<<32 - 1,
+	"longtext":   1<<32 - 1,
+	"json":       1<<32 - 1,
+}
+
+// spatial types are not decoded from the binlog
+var unsupportedTypes = map[string]bool{
+	"geometry":           true,
+	"point":              true,
+	"linestring":         true,
+	"polygon":            true,
+	"multipoint":         true,
+	"multilinestring":    true,
+	"multipolygon":       true,
+	"geometrycollection": true,
+}
+
+// AssessTables reports the migration blockers and warnings of the tables
+// selected by doDb/ignoreDb, reading the source only.
+func AssessTables(ctx context.Context, db *gosql.DB, doDb, ignoreDb []*config.DataSource, opts *AssessOptions) ([]*models.TableAssessment, error) {
+	tables, err := listVerifyTables(ctx, db, doDb, ignoreDb)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]bool, len(tables))
+	for _, tb := range tables {
+		selected[fmt.Sprintf("%s.%s", tb.TableSchema, tb.TableName)] = true
+	}
+
+	var results []*models.TableAssessment
+	for _, tb := range tables {
+		r := &models.TableAssessment{
+			TableSchema: tb.TableSchema,
+			TableName:   tb.TableName,
+		}
+		info, err := readAssessTableInfo(ctx, db, tb.TableSchema, tb.TableName, opts.ScanBlobs)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Issues = assessTable(info, selected, opts)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// assessTable checks a table. selected has the "schema.table" of the job.
+func assessTable(info *assessTableInfo, selected map[string]bool, opts *AssessOptions) []*models.AssessIssue {
+	var issues []*models.AssessIssue
+	add := func(severity, check, column, format string, args ...interface{}) {
+		issues = append(issues, &models.AssessIssue{
+			Severity: severity,
+			Check:    check,
+			Column:   column,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	columns := make(map[string]*assessColumn, len(info.columns))
+	var rowBlobCapacity int64
+	for _, c := range info.columns {
+		columns[c.name] = c
+		if unsupportedTypes[c.dataType] {
+			add(models.AssessSeverityBlocker, models.AssessCheckUnsupportedType, c.name,
+				"type %v is not supported", c.columnType)
+		}
+		if c.charset != "" && !umconf.IsCharsetSupported(c.charset) {
+			add(models.AssessSeverityBlocker, models.AssessCheckCharset, c.name,
+				"values in charset %v are not converted and would be corrupted", c.charset)
+		}
+		rowBlobCapacity += blobCapacity[c.dataType]
+	}
+
+	// the applier needs a key to find the rows, and the copy to chunk the table
+	hasPk, hasUniqueKey := false, false
+	for _, idx := range info.indexes {
+		if idx.name == "PRIMARY" {
+			hasPk = true
+			continue
+		}
+		if !idx.unique {
+			continue
+		}
+		usable := true
+		for _, name := range idx.columns {
+			c, ok := columns[name]
+			if !ok || c.nullable || c.dataType == "float" || c.dataType == "json" {
+				usable = false
+			}
+		}
+		if usable {
+			hasUniqueKey = true
+		}
+	}
+	switch {
+	case hasPk:
+	case hasUniqueKey:
+		add(models.AssessSeverityWarning, models.AssessCheckNoPrimaryKey, "",
+			"no primary key. A not null unique key is used instead")
+	default:
+		add(models.AssessSeverityBlocker, models.AssessCheckNoPrimaryKey, "",
+			"no primary key or not null unique key. Rows cannot be identified on the target, and might be duplicated")
+	}
+
+	if opts.MaxPayload > 0 {
+		if info.maxBlobBytes >= 0 {
+			if info.maxBlobBytes > int64(opts.MaxPayload) {
+				add(models.AssessSeverityBlocker, models.AssessCheckLargeBlob, "",
+					"a row has %d bytes of BLOB/TEXT/JSON, more than max_payload %d", info.maxBlobBytes, opts.MaxPayload)
+			}
+		} else if rowBlobCapacity > int64(opts.MaxPayload) {
+			add(models.AssessSeverityWarning, models.AssessCheckLargeBlob, "",
+				"BLOB/TEXT/JSON values of a row might exceed max_payload %d. Scan the table to know", opts.MaxPayload)
+		}
+	}
+
+	for _, fk := range info.foreignKeys {
+		if !selected[fmt.Sprintf("%s.%s", fk.refSchema, fk.refTable)] {
+			add(models.AssessSeverityWarning, models.AssessCheckForeignKey, "",
+				"foreign key %v references %v.%v, which is not in the job. The target might have orphan rows",
+				fk.name, fk.refSchema, fk.refTable)
+		}
+		if isCascadeRule(fk.updateRule) || isCascadeRule(fk.deleteRule) {
+			add(models.AssessSeverityBlocker, models.AssessCheckForeignKey, "",
+				"foreign key %v has ON UPDATE %v ON DELETE %v. The changes made by the cascade are not in the binlog",
+				fk.name, fk.updateRule, fk.deleteRule)
+		}
+	}
+
+	if info.nTriggers > 0 {
+		add(models.AssessSeverityBlocker, models.AssessCheckTrigger, "",
+			"%d triggers. Tables with triggers are not supported", info.nTriggers)
+	}
+	return issues
+}
+
+func isCascadeRule(rule string) bool {
+	return rule == "CASCADE" || rule == "SET NULL" || rule == "SET DEFAULT"
+}
+
+func readAssessTableInfo(ctx context.Context, db *gosql.DB, schema, table string, scanBlobs bool) (*assessTableInfo, error) {
+	info := &assessTableInfo{
+		schema:       schema,
+		table:        table,
+		maxBlobBytes: -1,
+	}
+
+	query := `select COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, ifnull(CHARACTER_SET_NAME, '') CHARACTER_SET_NAME, IS_NULLABLE
+		from information_schema.COLUMNS where TABLE_SCHEMA = ? and TABLE_NAME = ? order by ORDINAL_POSITION`
+	err := sql.QueryRowsMap(ctx, db, query, func(m sql.RowMap) error {
+		info.columns = append(info.columns, &assessColumn{
+			name:       m.GetString("COLUMN_NAME"),
+			dataType:   strings.ToLower(m.GetString("DATA_TYPE")),
+			columnType: m.GetString("COLUMN_TYPE"),
+			charset:    m.GetString("CHARACTER_SET_NAME"),
+			nullable:   m.GetString("IS_NULLABLE") == "YES",
+		})
+		return nil
+	}, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `select INDEX_NAME, NON_UNIQUE, COLUMN_NAME from information_schema.STATISTICS
+		where TABLE_SCHEMA = ? and TABLE_NAME = ? order by INDEX_NAME, SEQ_IN_INDEX`
+	err = sql.QueryRowsMap(ctx, db, query, func(m sql.RowMap) error {
+		name := m.GetString("INDEX_NAME")
+		n := len(info.indexes)
+		if n == 0 || info.indexes[n-1].name != name {
+			info.indexes = append(info.indexes, &assessIndex{name: name, unique: m.GetInt("NON_UNIQUE") == 0})
+			n++
+		}
+		info.indexes[n-1].columns = append(info.indexes[n-1].columns, m.GetString("COLUMN_NAME"))
+		return nil
+	}, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `select CONSTRAINT_NAME, UNIQUE_CONSTRAINT_SCHEMA, REFERENCED_TABLE_NAME, UPDATE_RULE, DELETE_RULE
+		from information_schema.REFERENTIAL_CONSTRAINTS where CONSTRAINT_SCHEMA = ? and TABLE_NAME = ?`
+	err = sql.QueryRowsMap(ctx, db, query, func(m sql.RowMap) error {
+		info.foreignKeys = append(info.foreignKeys, &assessForeignKey{
+			name:       m.GetString("CONSTRAINT_NAME"),
+			refSchema:  m.GetString("UNIQUE_CONSTRAINT_SCHEMA"),
+			refTable:   m.GetString("REFERENCED_TABLE_NAME"),
+			updateRule: m.GetString("UPDATE_RULE"),
+			deleteRule: m.GetString("DELETE_RULE"),
+		})
+		return nil
+	}, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `select count(*) from information_schema.TRIGGERS where TRIGGER_SCHEMA = ? and EVENT_OBJECT_TABLE = ?`
+	if err := db.QueryRowContext(ctx, query, schema, table).Scan(&info.nTriggers); err != nil {
+		return nil, err
+	}
+
+	if scanBlobs {
+		var lengths []string
+		for _, c := range info.columns {
+			if _, ok := blobCapacity[c.dataType]; ok {
+				lengths = append(lengths, fmt.Sprintf("ifnull(length(%s), 0)", sql.EscapeName(c.name)))
+			}
+		}
+		if len(lengths) > 0 {
+			query = fmt.Sprintf("select ifnull(max(%s), 0) from %s.%s", strings.Join(lengths, " + "),
+				sql.EscapeName(schema), sql.EscapeName(table))
+			if err := db.QueryRowContext(ctx, query).Scan(&info.maxBlobBytes); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return info, nil
+}
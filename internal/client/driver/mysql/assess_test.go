@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestAssessTable(t *testing.T) {
+	checks := func(issues []*models.AssessIssue) []string {
+		var cs []string
+		for _, issue := range issues {
+			cs = append(cs, issue.Severity+" "+issue.Check+" "+issue.Column)
+		}
+		return cs
+	}
+	opts := &AssessOptions{MaxPayload: 1 << 20}
+	selected := map[string]bool{"db1.t1": true, "db1.parent": true}
+
+	info := &assessTableInfo{
+		schema: "db1",
+		table:  "t1",
+		columns: []*assessColumn{
+			{name: "id", dataType: "int"},
+			{name: "name", dataType: "varchar", charset: "utf8mb4"},
+		},
+		indexes:      []*assessIndex{{name: "PRIMARY", unique: true, columns: []string{"id"}}},
+		foreignKeys:  []*assessForeignKey{{name: "fk1", refSchema: "db1", refTable: "parent", updateRule: "RESTRICT", deleteRule: "NO ACTION"}},
+		maxBlobBytes: -1,
+	}
+	if issues := assessTable(info, selected, opts); len(issues) != 0 {
+		t.Errorf("issues = %v", checks(issues))
+	}
+
+	info = &assessTableInfo{
+		schema: "db1",
+		table:  "t1",
+		columns: []*assessColumn{
+			{name: "id", dataType: "int"},
+			{name: "code", dataType: "varchar", charset: "ujis", nullable: true},
+			{name: "g", dataType: "point"},
+			{name: "doc", dataType: "longtext", charset: "utf8"},
+		},
+		indexes:      []*assessIndex{{name: "code", unique: true, columns: []string{"code"}}},
+		foreignKeys:  []*assessForeignKey{{name: "fk1", refSchema: "db2", refTable: "other", updateRule: "CASCADE", deleteRule: "RESTRICT"}},
+		nTriggers:    1,
+		maxBlobBytes: -1,
+	}
+	want := []string{
+		"blocker charset code",
+		"blocker unsupported-type g",
+		"blocker no-primary-key ",
+		"warning large-blob ",
+		"warning foreign-key ",
+		"blocker foreign-key ",
+		"blocker trigger ",
+	}
+	if got := checks(assessTable(info, selected, opts)); !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %v, want %v", got, want)
+	}
+
+	// a not null unique key identifies the rows, and a scan tells the real size
+	info.columns[1].nullable = false
+	info.maxBlobBytes = 100
+	info.foreignKeys = nil
+	info.nTriggers = 0
+	want = []string{
+		"blocker charset code",
+		"blocker unsupported-type g",
+		"warning no-primary-key ",
+	}
+	if got := checks(assessTable(info, selected, opts)); !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %v, want %v", got, want)
+	}
+	info.maxBlobBytes = 2 << 20
+	if got := checks(assessTable(info, selected, opts)); len(got) != 4 || got[3] != "blocker large-blob " {
+		t.Errorf("issues = %v", got)
+	}
+}
@@ -34,6 +34,8 @@ type BinlogCoordinateTx struct {
 	GNO           int64
 	LastCommitted int64
 	SeqenceNumber int64
+	// unix time of the event on the source
+	EventTimestamp uint32
 }
 
 // Do not call this frequently. Cache your result.
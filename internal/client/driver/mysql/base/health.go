@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package base
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// ConnTracker records the uses of a connection of a task, for its health.
+// Its methods do nothing on a nil tracker.
+type ConnTracker struct {
+	name string
+	// unix nanoseconds of the last successful use
+	lastActivity int64
+
+	mu            sync.Mutex
+	lastError     error
+	lastErrorTime time.Time
+}
+
+func NewConnTracker(name string) *ConnTracker {
+	return &ConnTracker{name: name}
+}
+
+func (t *ConnTracker) Success() {
+	if t != nil {
+		atomic.StoreInt64(&t.lastActivity, time.Now().UnixNano())
+	}
+}
+
+func (t *ConnTracker) Failure(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.lastError = err
+	t.lastErrorTime = time.Now()
+	t.mu.Unlock()
+}
+
+// Observe records a use of the connection which returned err, and returns it
+func (t *ConnTracker) Observe(err error) error {
+	if err == nil {
+		t.Success()
+	} else {
+		t.Failure(err)
+	}
+	return err
+}
+
+// Health returns the health of the connection to addr, which is healthy if
+// open and used successfully since its last error.
+func (t *ConnTracker) Health(addr string, open bool) *models.ConnHealth {
+	h := &models.ConnHealth{Name: t.name, Addr: addr, Open: open}
+	if last := atomic.LoadInt64(&t.lastActivity); last != 0 {
+		h.LastActivity = time.Unix(0, last)
+	}
+	t.mu.Lock()
+	if t.lastError != nil {
+		h.LastError = t.lastError.Error()
+		h.LastErrorTime = t.lastErrorTime
+	}
+	t.mu.Unlock()
+	h.Healthy = open && (h.LastErrorTime.IsZero() || h.LastActivity.After(h.LastErrorTime))
+	return h
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package base
+
+import (
+	"fmt"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestConnTracker(t *testing.T) {
+	tracker := NewConnTracker(models.ConnTarget)
+
+	h := tracker.Health("127.0.0.1:3306", true)
+	test.S(t).ExpectEquals(h.Name, models.ConnTarget)
+	test.S(t).ExpectEquals(h.Addr, "127.0.0.1:3306")
+	test.S(t).ExpectTrue(h.Healthy)
+	test.S(t).ExpectTrue(h.LastActivity.IsZero())
+
+	test.S(t).ExpectNil(tracker.Observe(nil))
+	test.S(t).ExpectFalse(tracker.Health("", true).LastActivity.IsZero())
+	test.S(t).ExpectFalse(tracker.Health("", false).Healthy)
+
+	test.S(t).ExpectNotNil(tracker.Observe(fmt.Errorf("bad connection")))
+	h = tracker.Health("", true)
+	test.S(t).ExpectFalse(h.Healthy)
+	test.S(t).ExpectEquals(h.LastError, "bad connection")
+
+	// healthy again once used successfully, keeping the last error
+	tracker.Success()
+	h = tracker.Health("", true)
+	test.S(t).ExpectTrue(h.Healthy)
+	test.S(t).ExpectEquals(h.LastError, "bad connection")
+
+	var none *ConnTracker
+	none.Success()
+	none.Failure(fmt.Errorf("bad connection"))
+}
@@ -8,6 +8,7 @@ package base
 
 import (
 	"bytes"
+	"context"
 	gosql "database/sql"
 	"fmt"
 	sqle "github.com/actiontech/dtle/internal/client/driver/mysql/sqle/inspector"
@@ -60,8 +61,8 @@ func StringContainsAll(s string, substrings ...string) bool {
 	return nonEmptyStringsFound
 }
 
-func GetSelfBinlogCoordinates(db *gosql.DB) (selfBinlogCoordinates *BinlogCoordinatesX, err error) {
-	err = usql.QueryRowsMap(db, `show master status`, func(m usql.RowMap) error {
+func GetSelfBinlogCoordinates(ctx context.Context, db *gosql.DB) (selfBinlogCoordinates *BinlogCoordinatesX, err error) {
+	err = usql.QueryRowsMap(ctx, db, `show master status`, func(m usql.RowMap) error {
 		selfBinlogCoordinates = &BinlogCoordinatesX{
 			LogFile: m.GetString("File"),
 			LogPos:  m.GetInt64("Position"),
@@ -72,6 +73,29 @@ func GetSelfBinlogCoordinates(db *gosql.DB) (selfBinlogCoordinates *BinlogCoordi
 	return selfBinlogCoordinates, err
 }
 
+// GetReplicationLag returns the lag of a replica, the largest of its
+// replication channels. It fails if the replication is not running.
+func GetReplicationLag(ctx context.Context, db usql.QueryAble) (lag time.Duration, err error) {
+	found := false
+	err = usql.QueryRowsMap(ctx, db, `show slave status`, func(m usql.RowMap) error {
+		found = true
+		if !m["Seconds_Behind_Master"].Valid {
+			return fmt.Errorf("replication %v is not running", m.GetStringD("Channel_Name", ""))
+		}
+		if channelLag := time.Duration(m.GetInt64("Seconds_Behind_Master")) * time.Second; channelLag > lag {
+			lag = channelLag
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("not a replica")
+	}
+	return lag, nil
+}
+
 func ParseBinlogCoordinatesFromRows(rows *sql.Rows) (selfBinlogCoordinates *BinlogCoordinatesX, err error) {
 	err = usql.ScanRowsToMaps(rows, func(m usql.RowMap) error {
 		selfBinlogCoordinates = &BinlogCoordinatesX{
@@ -85,7 +109,7 @@ func ParseBinlogCoordinatesFromRows(rows *sql.Rows) (selfBinlogCoordinates *Binl
 }
 
 // GetTableColumns reads column list from given table
-func GetTableColumns(db usql.QueryAble, databaseName, tableName string) (*umconf.ColumnList, error) {
+func GetTableColumns(ctx context.Context, db usql.QueryAble, databaseName, tableName string) (*umconf.ColumnList, error) {
 	query := fmt.Sprintf(`
 		show columns from %s.%s
 		`,
@@ -93,7 +117,7 @@ func GetTableColumns(db usql.QueryAble, databaseName, tableName string) (*umconf
 		usql.EscapeName(tableName),
 	)
 	columns := []umconf.Column{}
-	err := usql.QueryRowsMap(db, query, func(rowMap usql.RowMap) error {
+	err := usql.QueryRowsMap(ctx, db, query, func(rowMap usql.RowMap) error {
 		columns = append(columns, umconf.Column{
 			Name:       rowMap.GetString("Field"),
 			ColumnType: rowMap.GetString("Type"),
@@ -115,10 +139,10 @@ func GetTableColumns(db usql.QueryAble, databaseName, tableName string) (*umconf
 	return umconf.NewColumnList(columns), nil
 }
 
-func ShowCreateTable(db *gosql.DB, databaseName, tableName string, dropTableIfExists bool, addUse bool) (statement []string, err error) {
+func ShowCreateTable(ctx context.Context, db *gosql.DB, databaseName, tableName string, dropTableIfExists bool, addUse bool) (statement []string, err error) {
 	var dummy, createTableStatement string
 	query := fmt.Sprintf(`show create table %s.%s`, usql.EscapeName(databaseName), usql.EscapeName(tableName))
-	err = db.QueryRow(query).Scan(&dummy, &createTableStatement)
+	err = db.QueryRowContext(ctx, query).Scan(&dummy, &createTableStatement)
 	if (addUse) {
 		statement = append(statement, fmt.Sprintf("USE %s", databaseName))
 	}
@@ -129,10 +153,10 @@ func ShowCreateTable(db *gosql.DB, databaseName, tableName string, dropTableIfEx
 	return statement, err
 }
 
-func ShowCreateView(db *gosql.DB, databaseName, tableName string, dropTableIfExists bool) (createTableStatement string, err error) {
+func ShowCreateView(ctx context.Context, db *gosql.DB, databaseName, tableName string, dropTableIfExists bool) (createTableStatement string, err error) {
 	var dummy, character_set_client, collation_connection string
 	query := fmt.Sprintf(`show create table %s.%s`, usql.EscapeName(databaseName), usql.EscapeName(tableName))
-	err = db.QueryRow(query).Scan(&dummy, &createTableStatement, &character_set_client, &collation_connection)
+	err = db.QueryRowContext(ctx, query).Scan(&dummy, &createTableStatement, &character_set_client, &collation_connection)
 	statement := fmt.Sprintf("USE %s", databaseName)
 	if dropTableIfExists {
 		statement = fmt.Sprintf("%s;DROP TABLE IF EXISTS `%s`", statement, tableName)
@@ -167,11 +191,11 @@ func parseInterval(str string) (i gomysql.Interval, err error) {
 }
 
 // return: normalized GtidSet
-func SelectAllGtidExecuted(db usql.QueryAble, jid uuid.UUID) (gtidSet GtidSet, err error) {
+func SelectAllGtidExecuted(ctx context.Context, db usql.QueryAble, jid uuid.UUID) (gtidSet GtidSet, err error) {
 	query := fmt.Sprintf(`SELECT source_uuid,interval_gtid FROM %v.%v where job_uuid=?`,
 		g.DtleSchemaName, g.GtidExecutedTableV3)
 
-	rows, err := db.Query(query, jid.Bytes())
+	rows, err := db.QueryContext(ctx, query, jid.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +253,7 @@ func StringInterval(intervals gomysql.IntervalSlice) string {
 }
 
 // applyColumnTypes
-func ApplyColumnTypes(db usql.QueryAble, databaseName, tableName string, columnsLists ...*umconf.ColumnList) error {
+func ApplyColumnTypes(ctx context.Context, db usql.QueryAble, databaseName, tableName string, columnsLists ...*umconf.ColumnList) error {
 	query := `
 		select
 				*
@@ -239,7 +263,7 @@ func ApplyColumnTypes(db usql.QueryAble, databaseName, tableName string, columns
 				table_schema=?
 				and table_name=?
 		`
-	err := usql.QueryRowsMap(db, query, func(m usql.RowMap) error {
+	err := usql.QueryRowsMap(ctx, db, query, func(m usql.RowMap) error {
 		columnName := m.GetString("COLUMN_NAME")
 		columnType := m.GetString("COLUMN_TYPE")
 		if strings.Contains(columnType, "unsigned") {
@@ -459,7 +483,7 @@ func GtidSetDiff(set1 string, set2 string) (string, error) {
 func GetTableColumnsSqle(sqleContext *sqle.Context, schema string, table string) (*umconf.ColumnList, error) {
 	tableInfo, exists := sqleContext.GetTable(schema, table)
 	if !exists {
-		return nil, fmt.Errorf("table does not exists in sqle context. table: %v", )
+		return nil, fmt.Errorf("table does not exists in sqle context. table: %v.%v", schema, table)
 	}
 
 	cStmt := tableInfo.MergedTable
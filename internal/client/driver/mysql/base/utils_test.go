@@ -7,6 +7,7 @@
 package base
 
 import (
+	"context"
 	gosql "database/sql"
 	"reflect"
 	"testing"
@@ -71,7 +72,7 @@ func TestGetSelfBinlogCoordinates(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotSelfBinlogCoordinates, err := GetSelfBinlogCoordinates(tt.args.db)
+			gotSelfBinlogCoordinates, err := GetSelfBinlogCoordinates(context.Background(), tt.args.db)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetSelfBinlogCoordinates() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -99,7 +100,7 @@ func TestGetTableColumns(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := GetTableColumns(tt.args.db, tt.args.databaseName, tt.args.tableName)
+			got, err := GetTableColumns(context.Background(), tt.args.db, tt.args.databaseName, tt.args.tableName)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetTableColumns() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -128,7 +129,7 @@ func TestApplyColumnTypes(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := ApplyColumnTypes(tt.args.db, tt.args.database, tt.args.tablename, tt.args.columnsLists...)
+			err := ApplyColumnTypes(context.Background(), tt.args.db, tt.args.database, tt.args.tablename, tt.args.columnsLists...)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ApplyColumnTypes() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -157,7 +158,7 @@ func TestShowCreateTable(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotCreateTableStatement, err := ShowCreateTable(tt.args.db, tt.args.databaseName, tt.args.tableName, tt.args.dropTableIfExists)
+			gotCreateTableStatement, err := ShowCreateTable(context.Background(), tt.args.db, tt.args.databaseName, tt.args.tableName, tt.args.dropTableIfExists)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ShowCreateTable() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -0,0 +1,221 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/utils"
+)
+
+// maxDescribedEventLen bounds the description of the failing event of a batch
+const maxDescribedEventLen = 4096
+
+// batchEvent is the event index of the entry entry of a batch
+type batchEvent struct {
+	entry int
+	index int
+}
+
+// canBisect tells if a batch which failed can be applied again in
+// transactions rolled back: it has several events, all of rows, which a DDL
+// would commit.
+func (a *Applier) canBisect(dbApplier *sql.Conn, binlogEntries []*binlog.BinlogEntry) bool {
+	if a.shutdown || dbApplier.Db == nil || a.mysqlContext.FillGtidGaps {
+		return false
+	}
+	n := 0
+	for _, entry := range binlogEntries {
+		for _, event := range entry.Events {
+			if event.DML == binlog.NotDML || event.Statement {
+				return false
+			}
+			n++
+		}
+	}
+	// a TiDB batch of more statements was committed in parts
+	return n > 1 && (!a.mysqlContext.TiDB || n < a.mysqlContext.TiDBTxnStmtLimit)
+}
+
+// localizeApplyError finds the event failing a batch, by bisecting its
+// events in transactions rolled back, and returns cause with the event and
+// its row. With BatchErrorApplyPrefix, the transactions of the batch before
+// the failing one are applied.
+func (a *Applier) localizeApplyError(dbApplier *sql.Conn, workerIdx int, binlogEntries []*binlog.BinlogEntry,
+	cause error) error {
+	var events []batchEvent
+	for i, entry := range binlogEntries {
+		for j := range entry.Events {
+			events = append(events, batchEvent{entry: i, index: j})
+		}
+	}
+	a.logger.Warnf("mysql.applier: a batch of %d transactions, %d events, failed. bisecting it: %v",
+		len(binlogEntries), len(events), cause)
+
+	if a.mysqlContext.TiDB {
+		// TiDB checks the unique keys of an optimistic transaction at
+		// commit, which the trials do not reach
+		restore, err := a.checkConstraintsInPlace(dbApplier)
+		if err != nil {
+			a.logger.Warnf("mysql.applier: cannot bisect the batch: %v", err)
+			return cause
+		}
+		defer restore()
+	}
+
+	var failure error
+	n, err := bisectFailingPrefix(len(events), func(prefix int) (bool, error) {
+		err := a.trialApply(dbApplier, workerIdx, binlogEntries, events[:prefix])
+		if err != nil && isConnectionError(err) {
+			return false, err
+		}
+		if err != nil {
+			// the last trial failing is the shortest
+			failure = err
+		}
+		return err != nil, nil
+	})
+	if err != nil {
+		a.logger.Warnf("mysql.applier: cannot bisect the batch: %v", err)
+		return cause
+	}
+	if n == 0 {
+		return fmt.Errorf("%v. the %d events of the batch applied again without error", cause, len(events))
+	}
+
+	failed := events[n-1]
+	entry := binlogEntries[failed.entry]
+	msg := fmt.Sprintf("event %d of %d of the batch failed: event %d of transaction %s:%d, %s: %v",
+		n, len(events), failed.index, entry.Coordinates.GetSid(), entry.Coordinates.GNO,
+		describeEvent(&entry.Events[failed.index]), failure)
+	a.logger.Errorf("mysql.applier: %s", msg)
+
+	if a.mysqlContext.BatchErrorPolicy == config.BatchErrorApplyPrefix && failed.entry > 0 {
+		if err := a.applyBinlogEntries(dbApplier, workerIdx, binlogEntries[:failed.entry]); err != nil {
+			a.logger.Errorf("mysql.applier: cannot apply the %d transactions before the failing one: %v",
+				failed.entry, err)
+		} else {
+			a.logger.Printf("mysql.applier: applied the %d transactions before the failing one", failed.entry)
+			msg += fmt.Sprintf(". the %d transactions before it were applied", failed.entry)
+		}
+	}
+	return errors.New(msg)
+}
+
+// bisectFailingPrefix returns the length of the shortest prefix of n events
+// which fails, or 0 if all of them do not.
+func bisectFailingPrefix(n int, fails func(prefix int) (bool, error)) (int, error) {
+	failed, err := fails(n)
+	if err != nil || !failed {
+		return 0, err
+	}
+	lo, hi := 1, n
+	for lo < hi {
+		mid := (lo + hi) / 2
+		failed, err := fails(mid)
+		if err != nil {
+			return 0, err
+		}
+		if failed {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// trialApply applies events of a batch in a transaction, which it rolls back.
+func (a *Applier) trialApply(dbApplier *sql.Conn, workerIdx int, binlogEntries []*binlog.BinlogEntry,
+	events []batchEvent) error {
+	tx, err := dbApplier.Db.BeginTx(context.Background(), a.txOptions)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, e := range events {
+		entry := binlogEntries[e.entry]
+		// a copy, as applyBinlogEntries does
+		event := entry.Events[e.index]
+		if _, _, err := a.execDML(tx, workerIdx, entry, e.index, &event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConstraintsInPlace makes TiDB check the unique keys as the rows are
+// written, and returns the func setting the check back.
+func (a *Applier) checkConstraintsInPlace(dbApplier *sql.Conn) (func(), error) {
+	var inPlace bool
+	err := dbApplier.Db.QueryRowContext(context.Background(),
+		"select @@session.tidb_constraint_check_in_place").Scan(&inPlace)
+	if err != nil {
+		return nil, err
+	}
+	if inPlace {
+		return func() {}, nil
+	}
+	if _, err := sql.ExecNoPrepare(dbApplier.Db, "set @@session.tidb_constraint_check_in_place = 1"); err != nil {
+		return nil, err
+	}
+	return func() {
+		_, err := sql.ExecNoPrepare(dbApplier.Db, "set @@session.tidb_constraint_check_in_place = 0")
+		if err != nil {
+			a.logger.Warnf("mysql.applier: cannot set tidb_constraint_check_in_place back: %v", err)
+		}
+	}, nil
+}
+
+// describeEvent tells the table of a row event and its values, named after
+// the columns of the target table: those identifying the row, and its new
+// ones.
+func describeEvent(event *binlog.DataEvent) string {
+	var columns []string
+	if item, ok := event.TableItem.(*applierTableItem); ok && item.columns != nil {
+		columns = item.columns.Names()
+	}
+	desc := fmt.Sprintf("%s on %s.%s", event.DML, event.DatabaseName, event.TableName)
+	if event.WhereColumnValues != nil {
+		desc += " of the row " + describeRow(columns, event.WhereColumnValues.GetAbstractValues())
+	}
+	if event.NewColumnValues != nil {
+		desc += " with " + describeRow(columns, event.NewColumnValues.GetAbstractValues())
+	}
+	return utils.StrLim(desc, maxDescribedEventLen)
+}
+
+func describeRow(columns []string, values []*interface{}) string {
+	described := make([]string, len(values))
+	for i, value := range values {
+		name := fmt.Sprintf("@%d", i+1)
+		if i < len(columns) {
+			name = columns[i]
+		}
+		var v interface{}
+		if value != nil {
+			v = *value
+		}
+		switch v := v.(type) {
+		case nil:
+			described[i] = fmt.Sprintf("%s=NULL", name)
+		case []byte:
+			described[i] = fmt.Sprintf("%s=%q", name, v)
+		case string:
+			described[i] = fmt.Sprintf("%s=%q", name, v)
+		default:
+			described[i] = fmt.Sprintf("%s=%v", name, v)
+		}
+	}
+	return fmt.Sprintf("(%s)", strings.Join(described, ", "))
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestBisectFailingPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		n       int
+		failing int
+	}{
+		{n: 500, failing: 1},
+		{n: 500, failing: 237},
+		{n: 500, failing: 500},
+		{n: 2, failing: 2},
+		{n: 7, failing: 0},
+	} {
+		trials := 0
+		n, err := bisectFailingPrefix(tc.n, func(prefix int) (bool, error) {
+			trials++
+			return tc.failing > 0 && prefix >= tc.failing, nil
+		})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(n, tc.failing)
+		if trials > 10 {
+			t.Errorf("%d trials to find event %d of %d", trials, tc.failing, tc.n)
+		}
+	}
+}
+
+func TestDescribeEvent(t *testing.T) {
+	event := binlog.NewDataEvent("db1", "tb1", binlog.UpdateDML, 3)
+	event.TableItem = &applierTableItem{
+		columns: umconf.NewColumnList([]umconf.Column{{Name: "id"}, {Name: "name"}, {Name: "note"}}),
+	}
+	event.WhereColumnValues = umconf.ToColumnValues([]interface{}{int64(5), []byte("a"), nil})
+	event.NewColumnValues = umconf.ToColumnValues([]interface{}{int64(5), []byte("b"), nil})
+	test.S(t).ExpectEquals(describeEvent(&event),
+		`Update on db1.tb1 of the row (id=5, name="a", note=NULL) with (id=5, name="b", note=NULL)`)
+
+	event = binlog.NewDataEvent("db1", "tb2", binlog.InsertDML, 2)
+	event.NewColumnValues = umconf.ToColumnValues([]interface{}{int64(1), "x"})
+	test.S(t).ExpectEquals(describeEvent(&event), `Insert on db1.tb2 with (@1=1, @2="x")`)
+}
@@ -0,0 +1,249 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+// BenchmarkSubject is the job ID of a benchmark, under which the applied
+// GTIDs are kept on the target. It is the server UUID of the generated
+// transactions too.
+const BenchmarkSubject = "00000000-0000-0000-0000-0000be4c4a4c"
+
+// BenchmarkOptions is the synthetic workload of a benchmark
+type BenchmarkOptions struct {
+	// Schema holds the tables of the benchmark, dropped and created again
+	// by each run
+	Schema string
+	Tables int
+	// Columns is the number of varchar columns of a table, besides its
+	// primary key, holding RowBytes between them
+	Columns  int
+	RowBytes int
+	// Rows is the number of rows written, by transactions of RowsPerTx rows
+	Rows      int
+	RowsPerTx int
+	// UpdateRatio is the share of the rows written which update a row
+	// inserted before, the others are inserted
+	UpdateRatio float64
+	// Seed makes the workload the same each run
+	Seed int64
+}
+
+func (o *BenchmarkOptions) validate() error {
+	switch {
+	case o.Schema == "":
+		return fmt.Errorf("missing schema")
+	case o.Tables <= 0 || o.Columns <= 0 || o.Rows <= 0 || o.RowsPerTx <= 0:
+		return fmt.Errorf("the number of tables, columns, rows and rows per transaction must be positive")
+	case o.RowBytes < o.Columns:
+		return fmt.Errorf("a row of %d bytes cannot fill %d columns", o.RowBytes, o.Columns)
+	case o.UpdateRatio < 0 || o.UpdateRatio > 1:
+		return fmt.Errorf("the update ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// BenchmarkResult is the outcome of a run of RunBenchmark. The latencies are
+// from a transaction being queued to the workers to its commit on the target.
+type BenchmarkResult struct {
+	Workers        int
+	TxBoundary     string
+	Txs            int
+	Rows           int
+	ElapsedSeconds float64
+	RowsPerSec     float64
+	LatencyP50Ms   float64
+	LatencyP90Ms   float64
+	LatencyP99Ms   float64
+	LatencyMaxMs   float64
+	// Error stopped the run
+	Error string
+}
+
+// RunBenchmark applies a synthetic workload to the target of cfg with the
+// applier of a job configured by cfg, and measures its throughput and
+// latencies. The transactions depend on each other only through the rows
+// they write, for the workers to apply them in parallel.
+func RunBenchmark(cfg *config.MySQLDriverConfig, opts *BenchmarkOptions, logger *log.Logger) (*BenchmarkResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	entries := generateBenchmark(opts)
+
+	cfg.BlobOffload = nil
+	a, err := startFixtureApplier(BenchmarkSubject, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Shutdown()
+	if err := createBenchmarkTables(a.db, opts); err != nil {
+		return nil, err
+	}
+
+	result := &BenchmarkResult{
+		Workers:    a.mysqlContext.ParallelWorkers,
+		TxBoundary: a.mysqlContext.TxBoundary,
+		Txs:        len(entries),
+		Rows:       opts.Rows,
+	}
+	queued := make([]time.Time, len(entries))
+	latencies := make([]time.Duration, 0, len(entries))
+	var lastApplied time.Time
+	var mu sync.Mutex
+	a.applied = func(applied []*binlog.BinlogEntry) {
+		now := time.Now()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, entry := range applied {
+			latencies = append(latencies, now.Sub(queued[entry.Coordinates.GNO-1]))
+		}
+		lastApplied = now
+	}
+
+	start := time.Now()
+	for i, entry := range entries {
+		queued[i] = time.Now()
+		if err = a.enqueueEntry(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = a.waitApplied()
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	elapsed := lastApplied.Sub(start).Seconds()
+	result.ElapsedSeconds = elapsed
+	if elapsed > 0 {
+		result.RowsPerSec = float64(result.Rows) / elapsed
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) float64 {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return latencies[int(p*float64(len(latencies)-1))].Seconds() * 1000
+	}
+	result.LatencyP50Ms = percentile(0.5)
+	result.LatencyP90Ms = percentile(0.9)
+	result.LatencyP99Ms = percentile(0.99)
+	result.LatencyMaxMs = percentile(1)
+	return result, nil
+}
+
+func benchmarkTableName(i int) string {
+	return fmt.Sprintf("bench_%d", i)
+}
+
+// benchmarkColumnWidth is the length of the varchar columns of a table
+func benchmarkColumnWidth(opts *BenchmarkOptions) int {
+	return (opts.RowBytes + opts.Columns - 1) / opts.Columns
+}
+
+func createBenchmarkTables(db *gosql.DB, opts *BenchmarkOptions) error {
+	schema := sql.EscapeName(opts.Schema)
+	if _, err := db.Exec(fmt.Sprintf("create database if not exists %s", schema)); err != nil {
+		return err
+	}
+	columns := []string{"id bigint not null primary key"}
+	for i := 0; i < opts.Columns; i++ {
+		columns = append(columns, fmt.Sprintf("c%d varchar(%d) not null", i, benchmarkColumnWidth(opts)))
+	}
+	for i := 0; i < opts.Tables; i++ {
+		table := fmt.Sprintf("%s.%s", schema, sql.EscapeName(benchmarkTableName(i)))
+		if _, err := db.Exec(fmt.Sprintf("drop table if exists %s", table)); err != nil {
+			return err
+		}
+		if _, err := db.Exec(fmt.Sprintf("create table %s (%s)", table, strings.Join(columns, ", "))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateBenchmark makes the transactions of a workload. A transaction
+// updating a row has the last one which wrote it as its last committed, so
+// that its before image matches the row when it is applied.
+func generateBenchmark(opts *BenchmarkOptions) []*binlog.BinlogEntry {
+	type benchmarkRow struct {
+		values []interface{}
+		// the sequence number of the last transaction writing the row
+		seq int64
+	}
+	r := rand.New(rand.NewSource(opts.Seed))
+	width := benchmarkColumnWidth(opts)
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	newValues := func(id int64) []interface{} {
+		values := []interface{}{id}
+		for i := 0; i < opts.Columns; i++ {
+			b := make([]byte, width)
+			for j := range b {
+				b[j] = letters[r.Intn(len(letters))]
+			}
+			values = append(values, string(b))
+		}
+		return values
+	}
+
+	sid := uuid.FromStringOrNil(BenchmarkSubject)
+	tables := make([][]*benchmarkRow, opts.Tables)
+	var entries []*binlog.BinlogEntry
+	for seq := int64(1); len(entries)*opts.RowsPerTx < opts.Rows; seq++ {
+		entry := binlog.NewBinlogEntryAt(base.BinlogCoordinateTx{
+			LogFile:       "benchmark",
+			SID:           sid,
+			GNO:           seq,
+			SeqenceNumber: seq,
+		})
+		for i := 0; i < opts.RowsPerTx && len(entries)*opts.RowsPerTx+i < opts.Rows; i++ {
+			t := r.Intn(opts.Tables)
+			rows := tables[t]
+			var event binlog.DataEvent
+			if len(rows) > 0 && r.Float64() < opts.UpdateRatio {
+				row := rows[r.Intn(len(rows))]
+				values := newValues(row.values[0].(int64))
+				event = binlog.NewDataEvent(opts.Schema, benchmarkTableName(t), binlog.UpdateDML, len(values))
+				event.WhereColumnValues = umconf.ToColumnValues(row.values)
+				event.NewColumnValues = umconf.ToColumnValues(values)
+				if row.seq < seq && row.seq > entry.Coordinates.LastCommitted {
+					entry.Coordinates.LastCommitted = row.seq
+				}
+				row.values, row.seq = values, seq
+			} else {
+				values := newValues(int64(len(rows) + 1))
+				event = binlog.NewDataEvent(opts.Schema, benchmarkTableName(t), binlog.InsertDML, len(values))
+				event.NewColumnValues = umconf.ToColumnValues(values)
+				tables[t] = append(rows, &benchmarkRow{values: values, seq: seq})
+			}
+			entry.Events = append(entry.Events, event)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+)
+
+func TestGenerateBenchmark(t *testing.T) {
+	opts := &BenchmarkOptions{
+		Schema:      "bench",
+		Tables:      2,
+		Columns:     3,
+		RowBytes:    30,
+		Rows:        1001,
+		RowsPerTx:   10,
+		UpdateRatio: 0.5,
+		Seed:        1,
+	}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	entries := generateBenchmark(opts)
+	if len(entries) != 101 {
+		t.Fatalf("%d transactions", len(entries))
+	}
+
+	rows, updates := 0, 0
+	// the sequence number of the last transaction writing a row
+	written := make(map[string]int64)
+	for i, entry := range entries {
+		seq := entry.Coordinates.SeqenceNumber
+		if seq != int64(i+1) || entry.Coordinates.GNO != seq {
+			t.Fatalf("transaction %d has sequence number %d", i, seq)
+		}
+		var lastCommitted int64
+		for _, event := range entry.Events {
+			rows++
+			values := event.NewColumnValues.GetAbstractValues()
+			if len(values) != 4 || len((*values[1]).(string)) != 10 {
+				t.Fatalf("bad row %v", event.NewColumnValues)
+			}
+			key := fmt.Sprintf("%s.%v", event.TableName, *values[0])
+			if event.DML == binlog.UpdateDML {
+				updates++
+				if w := written[key]; w < seq && w > lastCommitted {
+					lastCommitted = w
+				}
+			} else if _, ok := written[key]; ok {
+				t.Fatalf("row %v inserted twice", key)
+			}
+			written[key] = seq
+		}
+		if entry.Coordinates.LastCommitted != lastCommitted {
+			t.Fatalf("transaction %d has last committed %d, want %d", seq, entry.Coordinates.LastCommitted, lastCommitted)
+		}
+	}
+	if rows != 1001 {
+		t.Fatalf("%d rows", rows)
+	}
+	if updates < 400 || updates > 600 {
+		t.Fatalf("%d updates", updates)
+	}
+}
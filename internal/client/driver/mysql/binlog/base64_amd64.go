@@ -0,0 +1,15 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"github.com/issuj/gofaster/base64"
+)
+
+// base64StdEncoding encodes the BINLOG statements of the raw events. gofaster
+// has an implementation in amd64 assembly only.
+var base64StdEncoding = base64.StdEncoding
@@ -0,0 +1,16 @@
+//go:build !amd64
+// +build !amd64
+
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"encoding/base64"
+)
+
+var base64StdEncoding = base64.StdEncoding
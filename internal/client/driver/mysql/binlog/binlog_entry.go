@@ -19,10 +19,26 @@ type BinlogEntries struct {
 // BinlogEntry describes an entry in the binary log
 type BinlogEntry struct {
 	hasBeginQuery bool
-	Coordinates   base.BinlogCoordinateTx
+	// the xid of an XA transaction
+	xid string
+	// the number of events at each savepoint of the transaction
+	savepoints  map[string]int
+	Coordinates base.BinlogCoordinateTx
 
 	Events       []DataEvent
 	OriginalSize int // size of binlog entry
+
+	// A transaction of more rows than TxSplitRows is sent in parts. Part is
+	// the number of the part, from 1, or 0 for a transaction sent whole.
+	// PartOffset is the number of events in the parts before it. MoreParts
+	// is set on all the parts but the last one.
+	Part       int
+	PartOffset int
+	MoreParts  bool
+
+	// XAPrepare is the transaction of the XA PREPARE of the XA transaction
+	// this entry commits. Its GTID is executed with the one of the entry.
+	XAPrepare *base.BinlogCoordinateTx
 }
 
 // NewBinlogEntry creates an empty, ready to go BinlogEntry object
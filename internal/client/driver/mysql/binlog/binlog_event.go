@@ -87,6 +87,14 @@ type DataEvent struct {
 	Table             *config.Table // TODO tmp solution
 	LogPos            int64         // for kafka. The pos of WRITE_ROW_EVENT
 	TableItem         interface{}
+	// names of the values, for events not captured from MySQL. The applier
+	// puts the values in the order of the target columns.
+	ColumnNames []string
+	// Statement is set for a DML the source logged as a statement, in Query
+	Statement bool
+	// the changes of the JSON columns of a partial update, by ordinal. The
+	// new values of these columns are not set.
+	JSONDiffs map[int][]mysql.JSONDiff
 }
 
 func NewDataEvent(databaseName, tableName string, dml EventDML, columnCount int) DataEvent {
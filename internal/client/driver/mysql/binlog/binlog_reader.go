@@ -14,6 +14,7 @@ import (
 
 	//"encoding/hex"
 	"fmt"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
@@ -21,7 +22,6 @@ import (
 
 	//"os"
 
-	"github.com/issuj/gofaster/base64"
 	ast "github.com/pingcap/parser/ast"
 	"github.com/pingcap/parser"
 	_ "github.com/pingcap/tidb/types/parser_driver"
@@ -58,6 +58,10 @@ type BinlogReader struct {
 	mysqlContext *config.MySQLDriverConfig
 	// dynamic config, include all tables (implicitly assigned or dynamically created)
 	tables map[string](map[string]*config.TableContext)
+	// guards tables and rescannedTables, which a rescan of the schemas adds to
+	tablesLock sync.RWMutex
+	// tables added by AddTables, not in the schema context yet
+	rescannedTables []*RescannedTable
 
 	currentTx          *BinlogTx
 	currentBinlogEntry *BinlogEntry
@@ -67,15 +71,43 @@ type BinlogReader struct {
 	currentSqlB64      *bytes.Buffer
 	appendB64SqlBs     []byte
 	ReMap              map[string]*regexp.Regexp
+	filter             *config.TableFilter
+	// prepared XA transactions, by xid, held until their XA COMMIT
+	xaPrepared map[string]*BinlogEntry
 
 	wg           sync.WaitGroup
 	shutdown     bool
 	shutdownCh   chan struct{}
 	shutdownLock sync.Mutex
+	// cancelled on close, stopping the stream and the queries running
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	sqlFilter *SqlFilter
 
 	context *sqle.Context
+	schemas *schemaTracker
+
+	// for ChangeMaster. The GTID sets are where to resume on another master.
+	syncerConfig   replication.BinlogSyncerConfig
+	startGtidSet   string
+	sentGtidSet    gomysql.GTIDSet
+	newMaster      *masterAddr
+	repositionLock sync.Mutex
+
+	// the binlog dumps started by the syncer, and the source of the first one
+	dumps      int
+	sourceUUID string
+	// the next binlog file of the last rotate event read
+	rotatedTo string
+
+	// the filters of a warm restart, applied before the next transaction
+	newFilters *filterChange
+
+	// for the partial updates of JSON
+	jsonParser *jsonEventParser
+
+	health *base.ConnTracker
 }
 
 type SqlFilter struct {
@@ -153,7 +185,10 @@ func NewMySQLReader(cfg *config.MySQLDriverConfig, logger *log.Entry, replicateD
 		tables:                  make(map[string](map[string]*config.TableContext)),
 		sqlFilter:               sqlFilter,
 		context:                 sqleContext,
+		schemas:                 newSchemaTracker(sqleContext),
+		health:                  base.NewConnTracker(models.ConnSourceBinlog),
 	}
+	binlogReader.ctx, binlogReader.cancel = context.WithCancel(context.Background())
 
 	for _, db := range replicateDoDb {
 		tableMap := binlogReader.getDbTableMap(db.TableSchema)
@@ -161,6 +196,7 @@ func NewMySQLReader(cfg *config.MySQLDriverConfig, logger *log.Entry, replicateD
 			if err := binlogReader.addTableToTableMap(tableMap, table); err != nil {
 				return nil, err
 			}
+			binlogReader.schemas.load(db.TableSchema, table.TableName, table.OriginalTableColumns)
 		}
 	}
 
@@ -184,18 +220,31 @@ func NewMySQLReader(cfg *config.MySQLDriverConfig, logger *log.Entry, replicateD
 	}
 	logger.Debug("job.start: debug server id is :", serverId)
 	// support regex
-	binlogReader.genRegexMap()
+	binlogReader.filter, err = config.NewTableFilter(cfg.ReplicateDoDb, cfg.ReplicateIgnoreDb)
+	if err != nil {
+		return nil, err
+	}
+	binlogReader.ReMap = binlogReader.filter.Patterns()
 
+	// a binlog dump cannot go through a proxy
+	direct := cfg.ConnectionConfig.Direct()
 	binlogSyncerConfig := replication.BinlogSyncerConfig{
 		ServerID:       uint32(serverId),
 		Flavor:         "mysql",
-		Host:           cfg.ConnectionConfig.Host,
-		Port:           uint16(cfg.ConnectionConfig.Port),
+		Host:           direct.Host,
+		Port:           uint16(direct.Port),
 		User:           cfg.ConnectionConfig.User,
 		Password:       cfg.ConnectionConfig.Password,
 		RawModeEnabled: false,
 		UseDecimal:     true,
+		VerifyChecksum: cfg.VerifyBinlogChecksum,
+	}
+	if cfg.VerifyBinlogChecksum {
+		if err := binlogReader.checkBinlogChecksum(); err != nil {
+			return nil, err
+		}
 	}
+	binlogReader.syncerConfig = binlogSyncerConfig
 	binlogReader.binlogSyncer = replication.NewBinlogSyncer(binlogSyncerConfig)
 	binlogReader.mysqlContext.Stage = models.StageRegisteringSlaveOnMaster
 
@@ -240,6 +289,7 @@ func (b *BinlogReader) ConnectBinlogStreamer(coordinates base.BinlogCoordinatesX
 
 	// Start sync with sepcified binlog gtid
 	b.logger.Debugf("mysql.reader: GtidSet: %v", coordinates.GtidSet)
+	b.startGtidSet = coordinates.GtidSet
 	gtidSet, err := gomysql.ParseMysqlGTIDSet(coordinates.GtidSet)
 	if err != nil {
 		b.logger.Errorf("mysql.reader: err: %v", err)
@@ -260,6 +310,16 @@ func (b *BinlogReader) GetCurrentBinlogCoordinates() *base.BinlogCoordinateTx {
 	return &returnCoordinates
 }
 
+// Health returns the health of the binlog dump connection, on the current
+// master after a ChangeMaster.
+func (b *BinlogReader) Health() *models.ConnHealth {
+	b.repositionLock.Lock()
+	addr := net.JoinHostPort(b.syncerConfig.Host, strconv.Itoa(int(b.syncerConfig.Port)))
+	open := b.binlogStreamer != nil
+	b.repositionLock.Unlock()
+	return b.health.Health(addr, open && !b.shutdown)
+}
+
 func ToColumnValuesV2(abstractValues []interface{}, table *config.TableContext) *mysql.ColumnValues {
 	result := &mysql.ColumnValues{
 		AbstractValues: make([]*interface{}, len(abstractValues)),
@@ -304,6 +364,16 @@ type parseDDLResult struct {
 
 // StreamEvents
 func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel chan<- *BinlogEntry) error {
+	switch ev.Header.EventType {
+	case replication.FORMAT_DESCRIPTION_EVENT:
+		if err := b.onFormatDescription(ev); err != nil {
+			return err
+		}
+	case replication.TABLE_MAP_EVENT:
+		if err := b.onTableMap(ev); err != nil {
+			return err
+		}
+	}
 	if b.currentCoordinates.SmallerThanOrEquals(&b.LastAppliedRowsEventHint) {
 		b.logger.Debugf("mysql.reader: Skipping handled query at %+v", b.currentCoordinates)
 		return nil
@@ -326,6 +396,7 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 		b.currentCoordinates.GNO = evt.GNO
 		b.currentCoordinates.LastCommitted = evt.LastCommitted
 		b.currentCoordinates.SeqenceNumber = evt.SequenceNumber
+		b.currentCoordinates.EventTimestamp = ev.Header.Timestamp
 		b.currentBinlogEntry = NewBinlogEntryAt(b.currentCoordinates)
 	case replication.QUERY_EVENT:
 		evt := ev.Event.(*replication.QueryEvent)
@@ -333,6 +404,10 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 
 		b.logger.Debugf("mysql.reader: query event: schema: %s, query: %s", evt.Schema, query)
 
+		if handled, err := b.handleTxControl(ev, query, entriesChannel); handled || err != nil {
+			return err
+		}
+
 		if strings.ToUpper(query) == "BEGIN" {
 			b.currentBinlogEntry.hasBeginQuery = true
 		} else {
@@ -341,6 +416,7 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 				if b.mysqlContext.SkipCreateDbTable {
 					if skipCreateDbTable(query) {
 						b.logger.Warnf("mysql.reader: skip create db/table %s", query)
+						b.sendEntry(ev, entriesChannel)
 						return nil
 					}
 				}
@@ -348,6 +424,7 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 				if !b.mysqlContext.ExpandSyntaxSupport {
 					if skipQueryEvent(query) {
 						b.logger.Warnf("mysql.reader: skip query %s", query)
+						b.sendEntry(ev, entriesChannel)
 						return nil
 					}
 				}
@@ -357,8 +434,12 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 					b.logger.Debugf("mysql.reader: Parse query [%v] event failed: %v", query, err)
 					if b.skipQueryDDL(query, currentSchema, "") {
 						b.logger.Debugf("mysql.reader: skip QueryEvent at schema: %s,sql: %s", currentSchema, query)
+						b.sendEntry(ev, entriesChannel)
 						return nil
 					}
+					if b.mysqlContext.Strict {
+						return b.strictError(ev, "cannot handle query %q: %v", utils.StrLim(query, 256), err)
+					}
 				}
 
 				if !ddlInfo.isDDL {
@@ -370,6 +451,7 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 					b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, event)
 					entriesChannel <- b.currentBinlogEntry
 					b.LastAppliedRowsEventHint = b.currentCoordinates
+					b.sent(ev)
 					return nil
 				} else {
 					// it is a ddl
@@ -377,7 +459,7 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 
 				skipEvent := false
 
-				b.context.UpdateContext(ddlInfo.ast, "mysql")
+				b.schemas.applyDDL(currentSchema, ddlInfo.ast)
 
 				if b.sqlFilter.NoDDL {
 					skipEvent = true
@@ -389,39 +471,44 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 
 					if b.skipQueryDDL(sql, realSchema, tableName) {
 						b.logger.Debugf("mysql.reader: Skip QueryEvent currentSchema: %s, sql: %s, realSchema: %v, tableName: %v", currentSchema, sql, realSchema, tableName)
+						b.currentBinlogEntry.Events = b.currentBinlogEntry.Events[:0]
+						b.sendEntry(ev, entriesChannel)
 						return nil
 					}
 
 					updateTableMeta := func() error {
 						var err error
 
-						columns, err := base.GetTableColumnsSqle(b.context, realSchema, tableName)
+						version, err := b.schemas.tableChanged(realSchema, tableName,
+							fmt.Sprintf("%s:%d", b.currentCoordinates.GetSid(), b.currentCoordinates.GNO), sql)
 						if err != nil {
-							b.logger.Warnf("error handle create table in binlog: GetTableColumns: %v", err.Error())
-						}
-						b.logger.Debugf("binlog_reader. new columns. table: %v.%v, columns: %v",
-							realSchema, tableName, columns.String())
-
-						var table *config.Table
-						for i := range b.mysqlContext.ReplicateDoDb {
-							// TODO escape name before comparing?
-							if b.mysqlContext.ReplicateDoDb[i].TableSchema == realSchema {
-								for j := range b.mysqlContext.ReplicateDoDb[i].Tables {
-									if b.mysqlContext.ReplicateDoDb[i].Tables[j].TableName == tableName {
-										table = b.mysqlContext.ReplicateDoDb[i].Tables[j]
-									}
-								}
-							}
+							// the rows keep being decoded with the previous definition
+							b.logger.Warnf("mysql.reader: cannot follow the definition of %v.%v: %v",
+								realSchema, tableName, err)
+							return nil
 						}
-						if table == nil {
+						b.logger.Debugf("binlog_reader. new columns. table: %v.%v, version: %v, columns: %v",
+							realSchema, tableName, version.Version, version.Columns.String())
+
+						// TODO escape name before comparing?
+						table := b.filter.FindTable(realSchema, tableName)
+						if table != nil && table.TableName != tableName {
+							// a new table matching a pattern of the job
+							where := table.Where
+							table = config.NewTable(realSchema, tableName)
+							table.TableType = "BASE TABLE"
+							table.Where = utils.StringElse(where, "true")
+						} else if table == nil {
 							// a new table (it might be in all db copy since it is not ignored).
 							table = config.NewTable(realSchema, tableName)
 							table.TableType = "BASE TABLE"
 							table.Where = "true"
 						}
-						table.OriginalTableColumns = columns
+						table.OriginalTableColumns = version.Columns
+						b.tablesLock.Lock()
 						tableMap := b.getDbTableMap(realSchema)
 						err = b.addTableToTableMap(tableMap, table)
+						b.tablesLock.Unlock()
 						if err != nil {
 							b.logger.Error("failed to make table context: %v", err)
 							return err
@@ -442,6 +529,7 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 							skipEvent = true
 						}
 					case *ast.DropTableStmt:
+						b.schemas.tableDropped(realSchema, tableName)
 						if b.sqlFilter.NoDDLDropTable {
 							skipEvent = true
 						}
@@ -498,12 +586,25 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 				}
 				entriesChannel <- b.currentBinlogEntry
 				b.LastAppliedRowsEventHint = b.currentCoordinates
+				b.sent(ev)
+			} else if err := b.handleStatementEvent(ev, string(evt.Schema), query); err != nil {
+				return err
 			}
 		}
 	case replication.XID_EVENT:
-		entriesChannel <- b.currentBinlogEntry
-		b.LastAppliedRowsEventHint = b.currentCoordinates
+		b.sendEntry(ev, entriesChannel)
+	case xaPrepareLogEvent:
+		b.holdXAPrepared()
 	default:
+		var jsonDiffs []map[int][]mysql.JSONDiff
+		if ev.Header.EventType == partialUpdateRowsEvent {
+			rewritten, diffs, err := b.decodePartialUpdate(ev)
+			if err != nil {
+				return fmt.Errorf("partial update of JSON at %v:%d: %v",
+					b.currentCoordinates.LogFile, ev.Header.LogPos-ev.Header.EventSize, err)
+			}
+			ev, jsonDiffs = rewritten, diffs
+		}
 		if rowsEvent, ok := ev.Event.(*replication.RowsEvent); ok {
 			dml := ToEventDML(ev.Header.EventType)
 			skip, table := b.skipRowEvent(rowsEvent, dml)
@@ -511,6 +612,11 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 				//b.logger.Debugf("mysql.reader: skip rowsEvent %s.%s %v", rowsEvent.Table.Schema, rowsEvent.Table.Table, b.currentCoordinates.GNO)
 				return nil
 			}
+			if rowsEvent.Version > 0 && hasJSONColumn(rowsEvent.Table) {
+				if err := decodeJSONRows(rowsEvent, b.rowsEventData(ev), dml == UpdateDML); err != nil {
+					return err
+				}
+			}
 
 			schemaName := string(rowsEvent.Table.Schema)
 			tableName := string(rowsEvent.Table.Table)
@@ -527,6 +633,12 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 			if dml == NotDML {
 				return fmt.Errorf("Unknown DML type: %s", ev.Header.EventType.String())
 			}
+			if err := b.checkStrictRows(ev, rowsEvent, table); err != nil {
+				return err
+			}
+			if msg := b.schemas.checkColumnCount(schemaName, tableName, int(rowsEvent.ColumnCount)); msg != "" {
+				b.logger.Warnf("mysql.reader: %s", msg)
+			}
 			dmlEvent := NewDataEvent(
 				schemaName,
 				tableName,
@@ -562,6 +674,10 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 					{
 						dmlEvent.WhereColumnValues = ToColumnValuesV2(row, table)
 						dmlEvent.NewColumnValues = ToColumnValuesV2(rowsEvent.Rows[i+1], table)
+						dmlEvent.JSONDiffs = nil
+						if jsonDiffs != nil {
+							dmlEvent.JSONDiffs = jsonDiffs[i/2]
+						}
 					}
 				case DeleteDML:
 					{
@@ -613,8 +729,10 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 					b.logger.Debugf("event has not passed 'where'")
 				}
 			}
+			b.splitTx(entriesChannel)
 			return nil
 		}
+		return b.checkStrictEvent(ev)
 	}
 	return nil
 }
@@ -627,10 +745,25 @@ func (b *BinlogReader) DataStreamEvents(entriesChannel chan<- *BinlogEntry) erro
 			break
 		}
 
-		ev, err := b.binlogStreamer.GetEvent(context.Background())
+		ev, err := b.binlogStreamer.GetEvent(b.ctx)
 		if err != nil {
-			return err
+			b.health.Failure(err)
+			if err := b.checksumError(err); err != nil {
+				return err
+			}
+			if m := b.takeNewMaster(); m != nil && !b.shutdown {
+				if err := b.reposition(m); err != nil {
+					return err
+				}
+				continue
+			}
+			return b.explainStreamError(err)
+		}
+		b.health.Success()
+		if ev.Header.EventType == replication.GTID_EVENT {
+			b.loadFilters()
 		}
+		b.loadRescannedTables()
 		if ev.Header.EventType == replication.HEARTBEAT_EVENT {
 			continue
 		}
@@ -642,6 +775,12 @@ func (b *BinlogReader) DataStreamEvents(entriesChannel chan<- *BinlogEntry) erro
 			b.currentCoordinates.LogPos = int64(ev.Header.LogPos)
 		}()
 
+		if b.isDumpStart(ev) {
+			if err := b.onDumpStart(); err != nil {
+				return err
+			}
+		}
+
 		if ev.Header.EventType == replication.ROTATE_EVENT {
 			if rotateEvent, ok := ev.Event.(*replication.RotateEvent); ok {
 				func() {
@@ -671,8 +810,8 @@ func (b *BinlogReader) BinlogStreamEvents(txChannel chan<- *BinlogTx) error {
 			break
 		}
 
-		ev, err := b.binlogStreamer.GetEvent(context.Background())
-		if err != nil {
+		ev, err := b.binlogStreamer.GetEvent(b.ctx)
+		if b.health.Observe(err) != nil {
 			return err
 		}
 
@@ -765,7 +904,7 @@ func (b *BinlogReader) handleBinlogRowsEvent(ev *replication.BinlogEvent, txChan
 
 	switch ev.Header.EventType {
 	case replication.FORMAT_DESCRIPTION_EVENT:
-		b.currentFde = "BINLOG '\n" + base64.StdEncoding.EncodeToString(ev.RawData) + "\n'"
+		b.currentFde = "BINLOG '\n" + base64StdEncoding.EncodeToString(ev.RawData) + "\n'"
 
 	case replication.GTID_EVENT:
 		if b.currentTx != nil {
@@ -964,12 +1103,12 @@ func (b *BinlogReader) clearB64Sql() {
 }
 
 func (b *BinlogReader) appendB64Sql(event *BinlogEvent) {
-	n := base64.StdEncoding.EncodedLen(len(event.RawBs))
+	n := base64StdEncoding.EncodedLen(len(event.RawBs))
 	// enlarge only
 	if len(b.appendB64SqlBs) < n {
 		b.appendB64SqlBs = make([]byte, n)
 	}
-	base64.StdEncoding.Encode(b.appendB64SqlBs, event.RawBs)
+	base64StdEncoding.Encode(b.appendB64SqlBs, event.RawBs)
 	b.currentSqlB64.Write(b.appendB64SqlBs[0:n])
 
 	b.currentSqlB64.WriteString("\n")
@@ -1084,13 +1223,7 @@ func (b *BinlogReader) skipQueryDDL(sql string, schema string, tableName string)
 	case "sys", "information_schema", "performance_schema", g.DtleSchemaName:
 		return true
 	default:
-		if len(b.mysqlContext.ReplicateDoDb) > 0 {
-			return !b.matchTable(b.mysqlContext.ReplicateDoDb, schema, tableName)
-		}
-		if len(b.mysqlContext.ReplicateIgnoreDb) > 0 {
-			return b.matchTable(b.mysqlContext.ReplicateIgnoreDb, schema, tableName)
-		}
-		return false
+		return !b.filter.MatchTable(schema, tableName)
 	}
 }
 
@@ -1148,6 +1281,10 @@ func skipQueryEvent(sql string) bool {
 }
 
 func (b *BinlogReader) skipEvent(schema string, table string) bool {
+	return b.skipEventWith(b.filter, schema, table)
+}
+
+func (b *BinlogReader) skipEventWith(filter *config.TableFilter, schema string, table string) bool {
 	switch strings.ToLower(schema) {
 	case "mysql":
 		if b.mysqlContext.ExpandSyntaxSupport {
@@ -1158,42 +1295,8 @@ func (b *BinlogReader) skipEvent(schema string, table string) bool {
 	case "sys", "information_schema", "performance_schema", g.DtleSchemaName:
 		return true
 	default:
-		if len(b.mysqlContext.ReplicateDoDb) > 0 {
-			table = strings.ToLower(table)
-			//if table in tartget Table, do this event
-			for _, d := range b.mysqlContext.ReplicateDoDb {
-				if b.matchString(d.TableSchema, schema) || d.TableSchema == "" {
-					if len(d.Tables) == 0 {
-						return false
-					}
-					for _, dt := range d.Tables {
-						if b.matchString(dt.TableName, table) {
-							return false
-						}
-					}
-				}
-			}
-			return true
-		}
-		if len(b.mysqlContext.ReplicateIgnoreDb) > 0 {
-			table = strings.ToLower(table)
-			//if table in tartget Table, do this event
-			for _, d := range b.mysqlContext.ReplicateIgnoreDb {
-				if b.matchString(d.TableSchema, schema) || d.TableSchema == "" {
-					if len(d.Tables) == 0 {
-						return true
-					}
-					for _, dt := range d.Tables {
-						if b.matchString(dt.TableName, table) {
-							return true
-						}
-					}
-				}
-			}
-			return false
-		}
+		return !filter.MatchTable(schema, strings.ToLower(table))
 	}
-	return false
 }
 
 func skipMysqlSchemaEvent(tableLower string) bool {
@@ -1215,7 +1318,12 @@ func (b *BinlogReader) skipRowEvent(rowsEvent *replication.RowsEvent, dml EventD
 			// We make no special treat for case 2. That tx has only one insert, which should be ignored.
 			if dml == InsertDML {
 				if len(rowsEvent.Rows) == 1 {
-					sidValue := *mysql.ToColumnValues(rowsEvent.Rows[0]).AbstractValues[1]
+					values := mysql.ToColumnValues(rowsEvent.Rows[0]).AbstractValues
+					sidValue := *values[1]
+					// origin_uuid is set when the tx was cascaded from another dtle job
+					if len(values) > 3 && *values[3] != nil {
+						sidValue = *values[3]
+					}
 					sidByte, ok := sidValue.(string)
 					if !ok {
 						b.logger.Errorf("cycle-prevention: unrecognized gtid_executed table sid type: %T", sidValue)
@@ -1244,6 +1352,8 @@ func (b *BinlogReader) skipRowEvent(rowsEvent *replication.RowsEvent, dml EventD
 	case "sys", "information_schema", "performance_schema":
 		return true, nil
 	default:
+		b.tablesLock.RLock()
+		defer b.tablesLock.RUnlock()
 		if len(b.tables) > 0 {
 			//if table in tartget Table, do this event
 			for schemaName, tableMap := range b.tables {
@@ -1260,25 +1370,8 @@ func (b *BinlogReader) skipRowEvent(rowsEvent *replication.RowsEvent, dml EventD
 			}
 			return true, nil
 		}
-		if len(b.mysqlContext.ReplicateIgnoreDb) > 0 {
-			table := strings.ToLower(string(rowsEvent.Table.Table))
-			//if table in tartget Table, do this event
-			for _, d := range b.mysqlContext.ReplicateIgnoreDb {
-				if b.matchString(d.TableSchema, string(rowsEvent.Table.Schema)) || d.TableSchema == "" {
-					if len(d.Tables) == 0 {
-						return true, nil
-					}
-					for _, dt := range d.Tables {
-						if b.matchString(dt.TableName, table) {
-							return true, nil
-						}
-					}
-				}
-			}
-			return false, nil
-		}
+		return !b.filter.MatchTable(string(rowsEvent.Table.Schema), tableLower), nil
 	}
-	return false, nil
 }
 
 func (b *BinlogReader) matchString(pattern string, t string) bool {
@@ -1297,68 +1390,10 @@ func (b *BinlogReader) matchDB(patternDBS []*config.DataSource, a string) bool {
 	return false
 }
 
-func (b *BinlogReader) matchTable(patternTBS []*config.DataSource, schemaName string, tableName string) bool {
-	for _, pdb := range patternTBS {
-		if len(pdb.Tables) == 0 && schemaName == pdb.TableSchema {
-			return true
-		}
-		redb, okdb := b.ReMap[pdb.TableSchema]
-		for _, ptb := range pdb.Tables {
-			retb, oktb := b.ReMap[ptb.TableName]
-			if oktb && okdb {
-				if redb.MatchString(schemaName) && retb.MatchString(tableName) {
-					return true
-				}
-			}
-			if oktb {
-				if retb.MatchString(tableName) && schemaName == pdb.TableSchema {
-					return true
-				}
-			}
-			if okdb {
-				if redb.MatchString(schemaName) && tableName == ptb.TableName {
-					return true
-				}
-			}
-
-			//create database or drop database
-			if tableName == "" {
-				if schemaName == pdb.TableSchema {
-					return true
-				}
-			}
-
-			if ptb.TableSchema == schemaName && ptb.TableName == tableName {
-				return true
-			}
-		}
-	}
-
-	return false
-}
-
-func (b *BinlogReader) genRegexMap() {
-	for _, db := range b.mysqlContext.ReplicateDoDb {
-		if db.TableSchema[0] != '~' {
-			continue
-		}
-		if _, ok := b.ReMap[db.TableSchema]; !ok {
-			b.ReMap[db.TableSchema] = regexp.MustCompile(db.TableSchema[1:])
-		}
-
-		for _, tb := range db.Tables {
-			if tb.TableName[0] == '~' {
-				if _, ok := b.ReMap[tb.TableName]; !ok {
-					b.ReMap[tb.TableName] = regexp.MustCompile(tb.TableName[1:])
-				}
-			}
-			if tb.TableSchema[0] == '~' {
-				if _, ok := b.ReMap[tb.TableSchema]; !ok {
-					b.ReMap[tb.TableSchema] = regexp.MustCompile(tb.TableSchema[1:])
-				}
-			}
-		}
-	}
+// queryContext bounds a query on the status of the source by
+// QueryTimeoutSeconds
+func (b *BinlogReader) queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(b.ctx, b.mysqlContext.QueryTimeout())
 }
 
 func (b *BinlogReader) Close() error {
@@ -1370,15 +1405,18 @@ func (b *BinlogReader) Close() error {
 	}
 	b.shutdown = true
 	close(b.shutdownCh)
+	b.cancel()
 
 	b.wg.Wait()
 	if err := sql.CloseDB(b.db); err != nil {
 		return err
 	}
+	b.repositionLock.Lock()
 	// Historically there was a:
 	b.binlogSyncer.Close()
 	// here. A new go-mysql version closes the binlog syncer connection independently.
 	// I will go against the sacred rules of comments and just leave this here.
 	// This is the year 2017. Let's see what year these comments get deleted.
+	b.repositionLock.Unlock()
 	return nil
 }
@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// checkBinlogChecksum tells when the source writes no checksum for
+// VerifyBinlogChecksum to verify.
+func (b *BinlogReader) checkBinlogChecksum() error {
+	ctx, cancel := b.queryContext()
+	defer cancel()
+	var checksum string
+	if err := b.db.QueryRowContext(ctx, "select @@global.binlog_checksum").Scan(&checksum); err != nil {
+		return err
+	}
+	if !strings.EqualFold(checksum, "CRC32") {
+		b.logger.Warnf("mysql.reader: binlog_checksum of the source is %v. binlog events are not verified", checksum)
+	}
+	return nil
+}
+
+// checksumError returns the error of a binlog event failing its checksum,
+// with its coordinates, or nil if err is not one. The event starts where the
+// last one read ends.
+func (b *BinlogReader) checksumError(err error) error {
+	if errors.Cause(err) != replication.ErrChecksumMismatch {
+		return nil
+	}
+	b.currentCoordinatesMutex.Lock()
+	defer b.currentCoordinatesMutex.Unlock()
+	return fmt.Errorf("binlog event at %v:%v of the source is corrupted (checksum mismatch). transaction being read: %v",
+		b.currentCoordinates.LogFile, b.currentCoordinates.LogPos, b.currentCoordinates.GetGtidForThisTx())
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	juju "github.com/juju/errors"
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+)
+
+func TestBinlogReader_checksumError(t *testing.T) {
+	b := &BinlogReader{
+		currentCoordinates:      base.BinlogCoordinateTx{LogFile: "mysql-bin.000003", LogPos: 1234, GNO: 7},
+		currentCoordinatesMutex: &sync.Mutex{},
+	}
+	if err := b.checksumError(errors.New("connection reset")); err != nil {
+		t.Errorf("checksumError() of another error = %v", err)
+	}
+	err := b.checksumError(juju.Trace(replication.ErrChecksumMismatch))
+	if err == nil || !strings.Contains(err.Error(), "mysql-bin.000003:1234") {
+		t.Errorf("checksumError() = %v, want the coordinates of the event", err)
+	}
+}
@@ -0,0 +1,445 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+)
+
+// the types of a value in the binary JSON of MySQL
+const (
+	jsonbSmallObject byte = 0x00
+	jsonbLargeObject byte = 0x01
+	jsonbSmallArray  byte = 0x02
+	jsonbLargeArray  byte = 0x03
+	jsonbLiteral     byte = 0x04
+	jsonbInt16       byte = 0x05
+	jsonbUint16      byte = 0x06
+	jsonbInt32       byte = 0x07
+	jsonbUint32      byte = 0x08
+	jsonbInt64       byte = 0x09
+	jsonbUint64      byte = 0x0a
+	jsonbDouble      byte = 0x0b
+	jsonbString      byte = 0x0c
+	jsonbOpaque      byte = 0x0f
+
+	jsonbNullLiteral  byte = 0x00
+	jsonbTrueLiteral  byte = 0x01
+	jsonbFalseLiteral byte = 0x02
+)
+
+// decodeJSONBinary returns the JSON text of a value of a JSON column as
+// logged, which MySQL parses back to the same value. go-mysql marshals the
+// values it decodes with encoding/json, which quotes a decimal and drops
+// the fraction of a double: the target would get a string, or an integer.
+//
+// An empty value is the JSON null: MySQL logs one for a NULL set into a
+// NOT NULL column without strict mode.
+func decodeJSONBinary(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "null", nil
+	}
+	var buf bytes.Buffer
+	if err := writeJSONValue(&buf, data[0], data[1:]); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func errJSONShort(tp byte) error {
+	return fmt.Errorf("json: value of type %d is truncated", tp)
+}
+
+// writeJSONValue writes the text of the value of type tp in data
+func writeJSONValue(buf *bytes.Buffer, tp byte, data []byte) error {
+	switch tp {
+	case jsonbSmallObject, jsonbLargeObject, jsonbSmallArray, jsonbLargeArray:
+		return writeJSONContainer(buf, tp, data)
+	case jsonbLiteral:
+		if len(data) < 1 {
+			return errJSONShort(tp)
+		}
+		switch data[0] {
+		case jsonbNullLiteral:
+			buf.WriteString("null")
+		case jsonbTrueLiteral:
+			buf.WriteString("true")
+		case jsonbFalseLiteral:
+			buf.WriteString("false")
+		default:
+			return fmt.Errorf("json: unknown literal %d", data[0])
+		}
+	case jsonbInt16, jsonbUint16:
+		if len(data) < 2 {
+			return errJSONShort(tp)
+		}
+		v := binary.LittleEndian.Uint16(data)
+		if tp == jsonbInt16 {
+			buf.WriteString(strconv.FormatInt(int64(int16(v)), 10))
+		} else {
+			buf.WriteString(strconv.FormatUint(uint64(v), 10))
+		}
+	case jsonbInt32, jsonbUint32:
+		if len(data) < 4 {
+			return errJSONShort(tp)
+		}
+		v := binary.LittleEndian.Uint32(data)
+		if tp == jsonbInt32 {
+			buf.WriteString(strconv.FormatInt(int64(int32(v)), 10))
+		} else {
+			buf.WriteString(strconv.FormatUint(uint64(v), 10))
+		}
+	case jsonbInt64, jsonbUint64:
+		if len(data) < 8 {
+			return errJSONShort(tp)
+		}
+		v := binary.LittleEndian.Uint64(data)
+		if tp == jsonbInt64 {
+			buf.WriteString(strconv.FormatInt(int64(v), 10))
+		} else {
+			buf.WriteString(strconv.FormatUint(v, 10))
+		}
+	case jsonbDouble:
+		if len(data) < 8 {
+			return errJSONShort(tp)
+		}
+		buf.WriteString(formatJSONDouble(math.Float64frombits(binary.LittleEndian.Uint64(data))))
+	case jsonbString:
+		s, err := jsonVariableData(tp, data)
+		if err != nil {
+			return err
+		}
+		writeJSONString(buf, string(s))
+	case jsonbOpaque:
+		return writeJSONOpaque(buf, data)
+	default:
+		return fmt.Errorf("json: unknown value type %d", tp)
+	}
+	return nil
+}
+
+// writeJSONContainer writes an object or an array. Its entries are at
+// offsets from its start, of 2 bytes for a small one and 4 for a large one.
+func writeJSONContainer(buf *bytes.Buffer, tp byte, data []byte) error {
+	isSmall := tp == jsonbSmallObject || tp == jsonbSmallArray
+	isObject := tp == jsonbSmallObject || tp == jsonbLargeObject
+	offsetSize := 4
+	if isSmall {
+		offsetSize = 2
+	}
+	readOffset := func(pos int) int {
+		if isSmall {
+			return int(binary.LittleEndian.Uint16(data[pos:]))
+		}
+		return int(binary.LittleEndian.Uint32(data[pos:]))
+	}
+	if len(data) < 2*offsetSize {
+		return errJSONShort(tp)
+	}
+	count := readOffset(0)
+	size := readOffset(offsetSize)
+	if size > len(data) {
+		return errJSONShort(tp)
+	}
+	data = data[:size]
+
+	keyEntrySize := offsetSize + 2
+	valueEntrySize := 1 + offsetSize
+	headerSize := 2 * offsetSize
+	if isObject {
+		headerSize += count * keyEntrySize
+	}
+	headerSize += count * valueEntrySize
+	if headerSize > size {
+		return errJSONShort(tp)
+	}
+
+	if isObject {
+		buf.WriteByte('{')
+	} else {
+		buf.WriteByte('[')
+	}
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if isObject {
+			entry := 2*offsetSize + i*keyEntrySize
+			keyOffset := readOffset(entry)
+			keyLength := int(binary.LittleEndian.Uint16(data[entry+offsetSize:]))
+			if keyOffset+keyLength > size {
+				return errJSONShort(tp)
+			}
+			writeJSONString(buf, string(data[keyOffset:keyOffset+keyLength]))
+			buf.WriteString(": ")
+		}
+
+		entry := 2*offsetSize + i*valueEntrySize
+		if isObject {
+			entry += count * keyEntrySize
+		}
+		valueType := data[entry]
+		if jsonInlined(valueType, isSmall) {
+			if err := writeJSONValue(buf, valueType, data[entry+1:entry+1+offsetSize]); err != nil {
+				return err
+			}
+			continue
+		}
+		valueOffset := readOffset(entry + 1)
+		if valueOffset >= size {
+			return errJSONShort(tp)
+		}
+		if err := writeJSONValue(buf, valueType, data[valueOffset:]); err != nil {
+			return err
+		}
+	}
+	if isObject {
+		buf.WriteByte('}')
+	} else {
+		buf.WriteByte(']')
+	}
+	return nil
+}
+
+// jsonInlined tells if a value of type tp in a container is stored in its
+// entry, instead of at an offset
+func jsonInlined(tp byte, isSmall bool) bool {
+	switch tp {
+	case jsonbLiteral, jsonbInt16, jsonbUint16:
+		return true
+	case jsonbInt32, jsonbUint32:
+		return !isSmall
+	}
+	return false
+}
+
+// jsonVariableData returns the data prefixed by its length, of 7 bits a
+// byte, the first byte the lowest
+func jsonVariableData(tp byte, data []byte) ([]byte, error) {
+	length := 0
+	for i := 0; i < 5; i++ {
+		if i >= len(data) {
+			return nil, errJSONShort(tp)
+		}
+		length |= int(data[i]&0x7f) << uint(7*i)
+		if data[i]&0x80 == 0 {
+			if i+1+length > len(data) {
+				return nil, errJSONShort(tp)
+			}
+			return data[i+1 : i+1+length], nil
+		}
+	}
+	return nil, fmt.Errorf("json: invalid length of a value of type %d", tp)
+}
+
+// writeJSONOpaque writes a value of a MySQL type which JSON has not: a
+// decimal as a number, a temporal as a string, as MySQL prints them, and
+// another one as MySQL prints it, e.g. "base64:type15:YWJj".
+func writeJSONOpaque(buf *bytes.Buffer, data []byte) error {
+	if len(data) < 1 {
+		return errJSONShort(jsonbOpaque)
+	}
+	fieldType := data[0]
+	value, err := jsonVariableData(jsonbOpaque, data[1:])
+	if err != nil {
+		return err
+	}
+	switch fieldType {
+	case gomysql.MYSQL_TYPE_NEWDECIMAL:
+		if len(value) < 2 {
+			return errJSONShort(jsonbOpaque)
+		}
+		s, _, err := decodeDecimalBinary(value[2:], int(value[0]), int(value[1]))
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+		return nil
+	case gomysql.MYSQL_TYPE_DATE, gomysql.MYSQL_TYPE_DATETIME, gomysql.MYSQL_TYPE_TIMESTAMP,
+		gomysql.MYSQL_TYPE_TIME:
+		if len(value) < 8 {
+			return errJSONShort(jsonbOpaque)
+		}
+		packed := int64(binary.LittleEndian.Uint64(value))
+		writeJSONString(buf, formatPackedTemporal(fieldType, packed))
+		return nil
+	}
+	writeJSONString(buf, fmt.Sprintf("base64:type%d:%s", fieldType, base64.StdEncoding.EncodeToString(value)))
+	return nil
+}
+
+// formatJSONDouble keeps a double integral in value a double, e.g. 1.0,
+// which MySQL would parse as an integer if formatted 1
+func formatJSONDouble(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
+
+// formatPackedTemporal formats a temporal value packed as MySQL stores it
+// in memory, with the microseconds
+func formatPackedTemporal(fieldType byte, packed int64) string {
+	sign := ""
+	if packed < 0 {
+		sign = "-"
+		packed = -packed
+	}
+	intPart := packed >> 24
+	frac := packed % (1 << 24)
+	if fieldType == gomysql.MYSQL_TYPE_TIME {
+		hour := (intPart >> 12) % (1 << 10)
+		minute := (intPart >> 6) % (1 << 6)
+		second := intPart % (1 << 6)
+		return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, hour, minute, second, frac)
+	}
+	ymd := intPart >> 17
+	ym := ymd >> 5
+	hms := intPart % (1 << 17)
+	date := fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd%(1<<5))
+	if fieldType == gomysql.MYSQL_TYPE_DATE {
+		return date
+	}
+	return fmt.Sprintf("%s %02d:%02d:%02d.%06d", date, hms>>12, (hms>>6)%(1<<6), hms%(1<<6), frac)
+}
+
+// writeJSONString writes s quoted, escaped as JSON does
+func writeJSONString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf.WriteString("\ufffd")
+			} else {
+				buf.WriteString(s[i : i+size])
+			}
+			i += size
+			continue
+		}
+		switch c {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		default:
+			if c < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xf])
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+		i++
+	}
+	buf.WriteByte('"')
+}
+
+const digitsPerInteger = 9
+
+var compressedBytes = []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// decimalBinarySize is the size of a DECIMAL(precision, scale) as stored
+func decimalBinarySize(precision, scale int) int {
+	integral := precision - scale
+	return integral/digitsPerInteger*4 + compressedBytes[integral%digitsPerInteger] +
+		scale/digitsPerInteger*4 + compressedBytes[scale%digitsPerInteger]
+}
+
+// decodeDecimalBinary returns the text of a DECIMAL(precision, scale) as
+// stored, and its size
+func decodeDecimalBinary(data []byte, precision, scale int) (string, int, error) {
+	if precision < scale || precision-scale > 65 {
+		return "", 0, fmt.Errorf("invalid decimal(%d, %d)", precision, scale)
+	}
+	size := decimalBinarySize(precision, scale)
+	if len(data) < size {
+		return "", 0, fmt.Errorf("decimal(%d, %d) is truncated", precision, scale)
+	}
+	buf := make([]byte, size)
+	copy(buf, data[:size])
+	// the sign is the first bit, set for a positive value. A negative value
+	// is stored inverted.
+	negative := buf[0]&0x80 == 0
+	buf[0] ^= 0x80
+	if negative {
+		for i := range buf {
+			buf[i] ^= 0xff
+		}
+	}
+
+	readGroup := func(pos, n int) uint32 {
+		var v uint32
+		for i := 0; i < n; i++ {
+			v = v<<8 | uint32(buf[pos+i])
+		}
+		return v
+	}
+
+	var res bytes.Buffer
+	if negative {
+		res.WriteByte('-')
+	}
+	integral := precision - scale
+	pos := 0
+	intDigits := ""
+	if n := compressedBytes[integral%digitsPerInteger]; n > 0 {
+		intDigits += strconv.FormatUint(uint64(readGroup(pos, n)), 10)
+		pos += n
+	}
+	for i := 0; i < integral/digitsPerInteger; i++ {
+		intDigits += fmt.Sprintf("%09d", readGroup(pos, 4))
+		pos += 4
+	}
+	intDigits = trimLeadingZeros(intDigits)
+	res.WriteString(intDigits)
+	if scale > 0 {
+		res.WriteByte('.')
+		for i := 0; i < scale/digitsPerInteger; i++ {
+			res.WriteString(fmt.Sprintf("%09d", readGroup(pos, 4)))
+			pos += 4
+		}
+		if digits := scale % digitsPerInteger; digits > 0 {
+			res.WriteString(fmt.Sprintf("%0*d", digits, readGroup(pos, compressedBytes[digits])))
+			pos += compressedBytes[digits]
+		}
+	}
+	return res.String(), size, nil
+}
+
+func trimLeadingZeros(digits string) string {
+	for len(digits) > 1 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	if digits == "" {
+		return "0"
+	}
+	return digits
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+)
+
+func le16(v int) []byte {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, uint16(v))
+	return b
+}
+
+func jsonDouble(v float64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var all []byte
+	for _, p := range parts {
+		all = append(all, p...)
+	}
+	return all
+}
+
+func TestDecodeJSONBinary(t *testing.T) {
+	// [1.5, "x"]
+	array := concat(le16(2), le16(20),
+		[]byte{jsonbDouble}, le16(10), []byte{jsonbString}, le16(18),
+		jsonDouble(1.5), []byte{1, 'x'})
+	// {"a": -1, "b": [1.5, "x"]}
+	object := concat(le16(2), le16(20+len(array)),
+		le16(18), le16(1), le16(19), le16(1),
+		[]byte{jsonbInt16}, le16(0xffff), []byte{jsonbSmallArray}, le16(20),
+		[]byte("ab"), array)
+	// 12.50 and -12.50, as DECIMAL(4, 2)
+	decimal := []byte{jsonbOpaque, gomysql.MYSQL_TYPE_NEWDECIMAL, 4, 4, 2, 0x8c, 0x32}
+	negative := []byte{jsonbOpaque, gomysql.MYSQL_TYPE_NEWDECIMAL, 4, 4, 2, 0x73, 0xcd}
+
+	for _, c := range []struct {
+		data []byte
+		want string
+	}{
+		{nil, "null"},
+		{[]byte{jsonbLiteral, jsonbTrueLiteral}, "true"},
+		{concat([]byte{jsonbDouble}, jsonDouble(1)), "1.0"},
+		{concat([]byte{jsonbDouble}, jsonDouble(0.25)), "0.25"},
+		{[]byte{jsonbString, 5, 'a', '"', '\\', '\n', 0x01}, `"a\"\\\n\u0001"`},
+		{concat([]byte{jsonbSmallObject}, object), `{"a": -1, "b": [1.5, "x"]}`},
+		{decimal, "12.50"},
+		{negative, "-12.50"},
+		{[]byte{jsonbOpaque, gomysql.MYSQL_TYPE_BLOB, 3, 'a', 'b', 'c'}, `"base64:type252:YWJj"`},
+	} {
+		got, err := decodeJSONBinary(c.data)
+		if err != nil {
+			t.Errorf("%v: %v", c.data, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%v: got %s, want %s", c.data, got, c.want)
+		}
+	}
+
+	if _, err := decodeJSONBinary(concat([]byte{jsonbSmallObject}, object[:20])); err == nil {
+		t.Errorf("a truncated object is decoded")
+	}
+}
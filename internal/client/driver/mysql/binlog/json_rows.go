@@ -0,0 +1,469 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// partialUpdateRowsEvent is an update of MySQL 8.0 logging the changes of
+// its JSON columns instead of their new values, with
+// binlog_row_value_options=PARTIAL_JSON. The binlog parser does not know it
+// and gives a generic event.
+const partialUpdateRowsEvent replication.EventType = 0x27
+
+// partialJSONUpdates is the flag of the value options of a row of a partial
+// update, telling its JSON columns updated partially are flagged.
+const partialJSONUpdates = 1
+
+const rowsEventTableIDSize = 6
+
+// rowsEventBody is a rows event as logged, without its header and checksum
+type rowsEventBody struct {
+	// the table id, the flags, the extra data, the column count and the
+	// bitmaps, as logged
+	header []byte
+	// the columns of the before image, and of the after image of an update
+	columns1 []byte
+	columns2 []byte
+	rows     []byte
+}
+
+func parseRowsEventBody(data []byte, version int, update bool) (*rowsEventBody, error) {
+	pos := rowsEventTableIDSize + 2
+	if len(data) < pos {
+		return nil, fmt.Errorf("rows event is truncated")
+	}
+	if version == 2 {
+		if len(data) < pos+2 {
+			return nil, fmt.Errorf("rows event is truncated")
+		}
+		// the length of the extra data includes its own 2 bytes
+		pos += int(binary.LittleEndian.Uint16(data[pos:]))
+	}
+	columnCount, n, err := readPackedInt(data, pos)
+	if err != nil {
+		return nil, err
+	}
+	pos += n
+	bitmapSize := int(columnCount+7) / 8
+	body := &rowsEventBody{}
+	nBitmaps := 1
+	if update {
+		nBitmaps = 2
+	}
+	if len(data) < pos+nBitmaps*bitmapSize {
+		return nil, fmt.Errorf("rows event is truncated")
+	}
+	body.columns1 = data[pos : pos+bitmapSize]
+	pos += bitmapSize
+	if update {
+		body.columns2 = data[pos : pos+bitmapSize]
+		pos += bitmapSize
+	}
+	body.header = data[:pos]
+	body.rows = data[pos:]
+	return body, nil
+}
+
+// readPackedInt reads the length-encoded integer at pos of data, and
+// returns its size
+func readPackedInt(data []byte, pos int) (uint64, int, error) {
+	if pos >= len(data) {
+		return 0, 0, fmt.Errorf("rows event is truncated")
+	}
+	size := 1
+	switch data[pos] {
+	case 0xfc:
+		size = 3
+	case 0xfd:
+		size = 4
+	case 0xfe:
+		size = 9
+	}
+	if pos+size > len(data) {
+		return 0, 0, fmt.Errorf("rows event is truncated")
+	}
+	v, _, n := gomysql.LengthEncodedInt(data[pos:])
+	return v, n, nil
+}
+
+func bitSet(bitmap []byte, i int) bool {
+	return bitmap[i/8]&(1<<uint(i%8)) != 0
+}
+
+// rowImage is a row image of a rows event, with its values as logged
+type rowImage struct {
+	// the ordinals of the columns of the image
+	columns []int
+	// the values of columns, nil for NULL
+	values [][]byte
+	size   int
+}
+
+// readRowImage reads the image at the start of data of the columns set in
+// present
+func readRowImage(data []byte, table *replication.TableMapEvent, present []byte) (*rowImage, error) {
+	image := &rowImage{}
+	for i := 0; i < int(table.ColumnCount); i++ {
+		if bitSet(present, i) {
+			image.columns = append(image.columns, i)
+		}
+	}
+	image.values = make([][]byte, len(image.columns))
+	pos := (len(image.columns) + 7) / 8
+	if len(data) < pos {
+		return nil, fmt.Errorf("row of table %s.%s is truncated", table.Schema, table.Table)
+	}
+	nulls := data[:pos]
+	for i, column := range image.columns {
+		if bitSet(nulls, i) {
+			continue
+		}
+		n, err := columnValueSize(table.ColumnType[column], table.ColumnMeta[column], data[pos:])
+		if err != nil {
+			return nil, fmt.Errorf("column %d of table %s.%s: %v", column+1, table.Schema, table.Table, err)
+		}
+		image.values[i] = data[pos : pos+n]
+		pos += n
+	}
+	image.size = pos
+	return image, nil
+}
+
+// encode writes the image as logged
+func (r *rowImage) encode(buf *bytes.Buffer) {
+	nulls := make([]byte, (len(r.columns)+7)/8)
+	for i, v := range r.values {
+		if v == nil {
+			nulls[i/8] |= 1 << uint(i%8)
+		}
+	}
+	buf.Write(nulls)
+	for _, v := range r.values {
+		buf.Write(v)
+	}
+}
+
+// columnValueSize returns the size of the value at the start of data of a
+// column of type tp
+func columnValueSize(tp byte, meta uint16, data []byte) (n int, err error) {
+	if tp == gomysql.MYSQL_TYPE_STRING && meta >= 256 {
+		// the real type of a CHAR, an ENUM or a SET is in the meta
+		b0, b1 := byte(meta>>8), byte(meta&0xff)
+		if b0&0x30 != 0x30 {
+			meta = uint16(b1) | uint16((b0&0x30)^0x30)<<4
+			tp = b0 | 0x30
+		} else {
+			meta = uint16(b1)
+			tp = b0
+		}
+	}
+	lengthPrefixed := func(prefix int) (int, error) {
+		if len(data) < prefix {
+			return 0, fmt.Errorf("value is truncated")
+		}
+		return prefix + int(gomysql.FixedLengthInt(data[:prefix])), nil
+	}
+
+	switch tp {
+	case gomysql.MYSQL_TYPE_NULL:
+		n = 0
+	case gomysql.MYSQL_TYPE_TINY, gomysql.MYSQL_TYPE_YEAR:
+		n = 1
+	case gomysql.MYSQL_TYPE_SHORT:
+		n = 2
+	case gomysql.MYSQL_TYPE_INT24, gomysql.MYSQL_TYPE_DATE, gomysql.MYSQL_TYPE_TIME:
+		n = 3
+	case gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_FLOAT, gomysql.MYSQL_TYPE_TIMESTAMP:
+		n = 4
+	case gomysql.MYSQL_TYPE_LONGLONG, gomysql.MYSQL_TYPE_DOUBLE, gomysql.MYSQL_TYPE_DATETIME:
+		n = 8
+	case gomysql.MYSQL_TYPE_NEWDECIMAL:
+		n = decimalBinarySize(int(meta>>8), int(meta&0xff))
+	case gomysql.MYSQL_TYPE_BIT:
+		n = (int(meta>>8)*8 + int(meta&0xff) + 7) / 8
+	case gomysql.MYSQL_TYPE_TIMESTAMP2:
+		n = 4 + int(meta+1)/2
+	case gomysql.MYSQL_TYPE_DATETIME2:
+		n = 5 + int(meta+1)/2
+	case gomysql.MYSQL_TYPE_TIME2:
+		n = 3 + int(meta+1)/2
+	case gomysql.MYSQL_TYPE_ENUM, gomysql.MYSQL_TYPE_SET:
+		n = int(meta & 0xff)
+	case gomysql.MYSQL_TYPE_VARCHAR, gomysql.MYSQL_TYPE_VAR_STRING, gomysql.MYSQL_TYPE_STRING:
+		if meta < 256 {
+			n, err = lengthPrefixed(1)
+		} else {
+			n, err = lengthPrefixed(2)
+		}
+	case gomysql.MYSQL_TYPE_BLOB, gomysql.MYSQL_TYPE_GEOMETRY, gomysql.MYSQL_TYPE_JSON:
+		n, err = lengthPrefixed(int(meta))
+	default:
+		return 0, fmt.Errorf("unsupported type %d", tp)
+	}
+	if err == nil && n > len(data) {
+		err = fmt.Errorf("value is truncated")
+	}
+	return n, err
+}
+
+func hasJSONColumn(table *replication.TableMapEvent) bool {
+	for _, tp := range table.ColumnType {
+		if tp == gomysql.MYSQL_TYPE_JSON {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeJSONRows sets the values of the JSON columns of rowsEvent to their
+// JSON text, decoded from the rows as logged in body.
+func decodeJSONRows(rowsEvent *replication.RowsEvent, body []byte, update bool) error {
+	table := rowsEvent.Table
+	b, err := parseRowsEventBody(body, rowsEvent.Version, update)
+	if err != nil {
+		return err
+	}
+	data := b.rows
+	for r := range rowsEvent.Rows {
+		present := b.columns1
+		if update && r%2 == 1 {
+			present = b.columns2
+		}
+		image, err := readRowImage(data, table, present)
+		if err != nil {
+			return err
+		}
+		data = data[image.size:]
+		for i, column := range image.columns {
+			v := image.values[i]
+			if v == nil || table.ColumnType[column] != gomysql.MYSQL_TYPE_JSON ||
+				rowsEvent.Rows[r][column] == nil {
+				continue
+			}
+			text, err := decodeJSONBinary(v[table.ColumnMeta[column]:])
+			if err != nil {
+				return fmt.Errorf("column %d of table %s.%s: %v", column+1, table.Schema, table.Table, err)
+			}
+			rowsEvent.Rows[r][column] = text
+		}
+	}
+	return nil
+}
+
+// rewritePartialUpdate rewrites the body of a partial update as the one of an
+// UPDATE_ROWS_EVENTv2, whose JSON columns updated partially are NULL in the
+// after images. It returns their changes too, a map of the column ordinals
+// for each row, nil if none is.
+func rewritePartialUpdate(data []byte, table *replication.TableMapEvent) ([]byte, []map[int][]mysql.JSONDiff, error) {
+	b, err := parseRowsEventBody(data, 2, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	nJSON := 0
+	for i := 0; i < int(table.ColumnCount); i++ {
+		if bitSet(b.columns2, i) && table.ColumnType[i] == gomysql.MYSQL_TYPE_JSON {
+			nJSON++
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(b.header)
+	var diffs []map[int][]mysql.JSONDiff
+	rows := b.rows
+	for len(rows) > 0 {
+		before, err := readRowImage(rows, table, b.columns1)
+		if err != nil {
+			return nil, nil, err
+		}
+		buf.Write(rows[:before.size])
+		rows = rows[before.size:]
+
+		options, n, err := readPackedInt(rows, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = rows[n:]
+		var partial []byte
+		if options&partialJSONUpdates != 0 {
+			size := (nJSON + 7) / 8
+			if len(rows) < size {
+				return nil, nil, fmt.Errorf("partial update of table %s.%s is truncated", table.Schema, table.Table)
+			}
+			partial = rows[:size]
+			rows = rows[size:]
+		}
+
+		after, err := readRowImage(rows, table, b.columns2)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = rows[after.size:]
+		var rowDiffs map[int][]mysql.JSONDiff
+		iJSON := 0
+		for i, column := range after.columns {
+			if table.ColumnType[column] != gomysql.MYSQL_TYPE_JSON {
+				continue
+			}
+			isPartial := partial != nil && bitSet(partial, iJSON)
+			iJSON++
+			if !isPartial || after.values[i] == nil {
+				continue
+			}
+			columnDiffs, err := decodeJSONDiffs(after.values[i][table.ColumnMeta[column]:])
+			if err != nil {
+				return nil, nil, fmt.Errorf("column %d of table %s.%s: %v", column+1, table.Schema, table.Table, err)
+			}
+			if rowDiffs == nil {
+				rowDiffs = make(map[int][]mysql.JSONDiff)
+			}
+			rowDiffs[column] = columnDiffs
+			after.values[i] = nil
+		}
+		after.encode(&buf)
+		diffs = append(diffs, rowDiffs)
+	}
+	return buf.Bytes(), diffs, nil
+}
+
+// decodeJSONDiffs decodes the changes logged for a JSON column updated
+// partially. Each is its operation, its path, and its value unless it
+// removes one.
+func decodeJSONDiffs(data []byte) (diffs []mysql.JSONDiff, err error) {
+	pos := 0
+	for pos < len(data) {
+		diff := mysql.JSONDiff{Op: mysql.JSONDiffOp(data[pos])}
+		if diff.Op > mysql.JSONDiffRemove {
+			return nil, fmt.Errorf("json: unknown operation %d of a partial update", data[pos])
+		}
+		pos++
+		length, n, err := readPackedInt(data, pos)
+		if err != nil || pos+n+int(length) > len(data) {
+			return nil, fmt.Errorf("json: partial update is truncated")
+		}
+		pos += n
+		diff.Path = string(data[pos : pos+int(length)])
+		pos += int(length)
+		if diff.Op != mysql.JSONDiffRemove {
+			length, n, err := readPackedInt(data, pos)
+			if err != nil || pos+n+int(length) > len(data) {
+				return nil, fmt.Errorf("json: partial update is truncated")
+			}
+			pos += n
+			if diff.Value, err = decodeJSONBinary(data[pos : pos+int(length)]); err != nil {
+				return nil, err
+			}
+			pos += int(length)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// PartialUpdateNotApplied is the error of a target other than MySQL given a
+// partial update of JSON, which has not the new values to apply
+func PartialUpdateNotApplied(entry *BinlogEntry, event *DataEvent, target string) error {
+	return fmt.Errorf("%v has a partial update of JSON of %v.%v, which a %v target cannot apply. "+
+		"set binlog_row_value_options='' on the source", entry.Coordinates.GetGtidForThisTx(),
+		event.DatabaseName, event.TableName, target)
+}
+
+// jsonEventParser parses the partial updates, rewritten as updates, with the
+// format and the table maps of the binlog. The ones of the tables without a
+// JSON column are not needed.
+type jsonEventParser struct {
+	parser   *replication.BinlogParser
+	checksum bool
+	tables   map[uint64]*replication.TableMapEvent
+}
+
+// onFormatDescription starts a parser for the binlog of the format event ev
+func (b *BinlogReader) onFormatDescription(ev *replication.BinlogEvent) error {
+	fde := ev.Event.(*replication.FormatDescriptionEvent)
+	p := &jsonEventParser{
+		parser:   replication.NewBinlogParser(),
+		checksum: fde.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32,
+		tables:   make(map[uint64]*replication.TableMapEvent),
+	}
+	p.parser.SetParseTime(b.syncerConfig.ParseTime)
+	p.parser.SetTimestampStringLocation(b.syncerConfig.TimestampStringLocation)
+	p.parser.SetUseDecimal(b.syncerConfig.UseDecimal)
+	p.parser.SetVerifyChecksum(false)
+	if _, err := p.parser.Parse(ev.RawData); err != nil {
+		return err
+	}
+	b.jsonParser = p
+	return nil
+}
+
+func (b *BinlogReader) onTableMap(ev *replication.BinlogEvent) error {
+	if b.jsonParser == nil || !hasJSONColumn(ev.Event.(*replication.TableMapEvent)) {
+		return nil
+	}
+	parsed, err := b.jsonParser.parser.Parse(ev.RawData)
+	if err != nil {
+		return err
+	}
+	table := parsed.Event.(*replication.TableMapEvent)
+	b.jsonParser.tables[table.TableID] = table
+	return nil
+}
+
+// decodePartialUpdate returns a partial update as an UPDATE_ROWS_EVENTv2,
+// with the changes of its JSON columns updated partially.
+func (b *BinlogReader) decodePartialUpdate(ev *replication.BinlogEvent) (*replication.BinlogEvent,
+	[]map[int][]mysql.JSONDiff, error) {
+	generic, ok := ev.Event.(*replication.GenericEvent)
+	if !ok || b.jsonParser == nil || len(generic.Data) < rowsEventTableIDSize {
+		return nil, nil, fmt.Errorf("unexpected partial update of JSON")
+	}
+	tableID := gomysql.FixedLengthInt(generic.Data[:rowsEventTableIDSize])
+	table, ok := b.jsonParser.tables[tableID]
+	if !ok {
+		return nil, nil, fmt.Errorf("table %d of a partial update of JSON is unknown", tableID)
+	}
+	body, diffs, err := rewritePartialUpdate(generic.Data, table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw := make([]byte, replication.EventHeaderSize, replication.EventHeaderSize+len(body)+replication.BinlogChecksumLength)
+	copy(raw, ev.RawData[:replication.EventHeaderSize])
+	raw[4] = byte(replication.UPDATE_ROWS_EVENTv2)
+	raw = append(raw, body...)
+	if b.jsonParser.checksum {
+		// the parser strips it, unverified
+		raw = append(raw, make([]byte, replication.BinlogChecksumLength)...)
+	}
+	binary.LittleEndian.PutUint32(raw[9:], uint32(len(raw)))
+	rewritten, err := b.jsonParser.parser.Parse(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	// as logged, for the positions
+	header := *ev.Header
+	header.EventType = replication.UPDATE_ROWS_EVENTv2
+	rewritten.Header = &header
+	return rewritten, diffs, nil
+}
+
+// rowsEventData returns the body of a rows event as logged
+func (b *BinlogReader) rowsEventData(ev *replication.BinlogEvent) []byte {
+	data := ev.RawData[replication.EventHeaderSize:]
+	if b.jsonParser != nil && b.jsonParser.checksum {
+		data = data[:len(data)-replication.BinlogChecksumLength]
+	}
+	return data
+}
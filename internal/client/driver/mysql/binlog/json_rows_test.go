@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// a table (id int, doc json), and a partial update of it: of 2 rows, the
+// first with the changes of doc, the second with its whole value
+var (
+	jsonTable = &replication.TableMapEvent{
+		TableID:     1,
+		Schema:      []byte("db1"),
+		Table:       []byte("tb1"),
+		ColumnCount: 2,
+		ColumnType:  []byte{gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_JSON},
+		ColumnMeta:  []uint16{0, 4},
+	}
+	jsonID      = []byte{1, 0, 0, 0}
+	jsonDoc5    = []byte{3, 0, 0, 0, jsonbInt16, 5, 0}
+	jsonDoc1    = concat([]byte{9, 0, 0, 0, jsonbDouble}, jsonDouble(1))
+	jsonChanges = concat(
+		[]byte{byte(mysql.JSONDiffReplace), 3}, []byte("$.a"), []byte{3, jsonbInt16, 7, 0},
+		[]byte{byte(mysql.JSONDiffRemove), 3}, []byte("$.b"))
+	partialHeader = []byte{
+		1, 0, 0, 0, 0, 0, // table id
+		1, 0, // flags
+		2, 0, // extra data
+		2,    // columns
+		3, 3, // bitmaps
+	}
+	partialUpdate = concat(partialHeader,
+		[]byte{0}, jsonID, jsonDoc5,
+		[]byte{partialJSONUpdates, 1},
+		[]byte{0}, jsonID, []byte{byte(len(jsonChanges)), 0, 0, 0}, jsonChanges,
+
+		[]byte{0}, jsonID, jsonDoc5,
+		[]byte{0},
+		[]byte{0}, jsonID, jsonDoc1)
+	wantJSONDiffs = []map[int][]mysql.JSONDiff{
+		{1: {
+			{Op: mysql.JSONDiffReplace, Path: "$.a", Value: "7"},
+			{Op: mysql.JSONDiffRemove, Path: "$.b"},
+		}},
+		nil,
+	}
+)
+
+func TestRewritePartialUpdate(t *testing.T) {
+	body, diffs, err := rewritePartialUpdate(partialUpdate, jsonTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// doc is NULL in the first after image
+	want := concat(partialHeader,
+		[]byte{0}, jsonID, jsonDoc5, []byte{2}, jsonID,
+		[]byte{0}, jsonID, jsonDoc5, []byte{0}, jsonID, jsonDoc1)
+	if !bytes.Equal(body, want) {
+		t.Errorf("got body %v\nwant %v", body, want)
+	}
+	if !reflect.DeepEqual(diffs, wantJSONDiffs) {
+		t.Errorf("got diffs %v, want %v", diffs, wantJSONDiffs)
+	}
+
+	// as go-mysql decodes the rewritten event
+	rowsEvent := &replication.RowsEvent{
+		Version: 2,
+		Table:   jsonTable,
+		Rows: [][]interface{}{
+			{int32(1), []byte("5")}, {int32(1), nil},
+			{int32(1), []byte("5")}, {int32(1), []byte("1")},
+		},
+	}
+	if err := decodeJSONRows(rowsEvent, body, true); err != nil {
+		t.Fatal(err)
+	}
+	wantRows := [][]interface{}{
+		{int32(1), "5"}, {int32(1), nil},
+		{int32(1), "5"}, {int32(1), "1.0"},
+	}
+	if !reflect.DeepEqual(rowsEvent.Rows, wantRows) {
+		t.Errorf("got rows %v, want %v", rowsEvent.Rows, wantRows)
+	}
+
+	if _, _, err := rewritePartialUpdate(partialUpdate[:len(partialUpdate)-1], jsonTable); err == nil {
+		t.Errorf("a truncated event is rewritten")
+	}
+}
+
+// rawEvent returns an event as logged, without checksum
+func rawEvent(tp replication.EventType, body []byte) []byte {
+	header := make([]byte, replication.EventHeaderSize)
+	header[4] = byte(tp)
+	binary.LittleEndian.PutUint32(header[9:], uint32(replication.EventHeaderSize+len(body)))
+	binary.LittleEndian.PutUint32(header[13:], 1000)
+	return concat(header, body)
+}
+
+func TestBinlogReader_decodePartialUpdate(t *testing.T) {
+	serverVersion := make([]byte, 50)
+	copy(serverVersion, "8.0.20")
+	headerLengths := bytes.Repeat([]byte{10}, 40)
+	fde := concat(le16(4), serverVersion, []byte{0, 0, 0, 0, replication.EventHeaderSize}, headerLengths,
+		[]byte{replication.BINLOG_CHECKSUM_ALG_OFF, 0, 0, 0, 0})
+	tableMap := concat([]byte{1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{3}, []byte("db1"), []byte{0}, []byte{3}, []byte("tb1"), []byte{0},
+		[]byte{2, gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_JSON}, []byte{1, 4}, []byte{2})
+
+	parser := replication.NewBinlogParser()
+	b := &BinlogReader{}
+	for _, raw := range [][]byte{
+		rawEvent(replication.FORMAT_DESCRIPTION_EVENT, fde),
+		rawEvent(replication.TABLE_MAP_EVENT, tableMap),
+	} {
+		ev, err := parser.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Header.EventType == replication.FORMAT_DESCRIPTION_EVENT {
+			err = b.onFormatDescription(ev)
+		} else {
+			err = b.onTableMap(ev)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ev, err := parser.Parse(rawEvent(partialUpdateRowsEvent, partialUpdate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewritten, diffs, err := b.decodePartialUpdate(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewritten.Header.EventType != replication.UPDATE_ROWS_EVENTv2 || rewritten.Header.LogPos != 1000 ||
+		rewritten.Header.EventSize != ev.Header.EventSize {
+		t.Errorf("header: %+v", rewritten.Header)
+	}
+	rowsEvent := rewritten.Event.(*replication.RowsEvent)
+	if err := decodeJSONRows(rowsEvent, b.rowsEventData(rewritten), true); err != nil {
+		t.Fatal(err)
+	}
+	wantRows := [][]interface{}{
+		{int32(1), "5"}, {int32(1), nil},
+		{int32(1), "5"}, {int32(1), "1.0"},
+	}
+	if !reflect.DeepEqual(rowsEvent.Rows, wantRows) {
+		t.Errorf("got rows %v, want %v", rowsEvent.Rows, wantRows)
+	}
+	if !reflect.DeepEqual(diffs, wantJSONDiffs) {
+		t.Errorf("got diffs %v, want %v", diffs, wantJSONDiffs)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"github.com/actiontech/dtle/internal/config"
+)
+
+// filterChange is the filters of a job changed by a warm restart
+type filterChange struct {
+	filter    *config.TableFilter
+	sqlFilter *SqlFilter
+	// the source tables matched by filter
+	tables []*RescannedTable
+}
+
+// MatchTableWith returns if filter, a table filter of the job, replicates the
+// table.
+func (b *BinlogReader) MatchTableWith(filter *config.TableFilter, schema, table string) bool {
+	return !b.skipEventWith(filter, schema, table)
+}
+
+// Refilter replaces the filters of the reader by filter and sqlFilter, for a
+// warm restart of the job. tables are the source tables matched by filter:
+// the ones not replicated yet are added as by AddTables, and the others stop
+// being replicated. The filters change before the next transaction read, so
+// that a transaction is filtered as a whole.
+func (b *BinlogReader) Refilter(filter *config.TableFilter, sqlFilter []string, tables []*RescannedTable) error {
+	sf, err := parseSqlFilter(sqlFilter)
+	if err != nil {
+		return err
+	}
+	b.tablesLock.Lock()
+	b.newFilters = &filterChange{filter: filter, sqlFilter: sf, tables: tables}
+	b.tablesLock.Unlock()
+	return nil
+}
+
+// loadFilters applies the filters given to Refilter. The tables replicated
+// before keep their context, updated by the DDLs read since, unless their
+// Where changed.
+func (b *BinlogReader) loadFilters() {
+	b.tablesLock.Lock()
+	defer b.tablesLock.Unlock()
+	c := b.newFilters
+	if c == nil {
+		return
+	}
+	b.newFilters = nil
+
+	prev := b.tables
+	b.tables = make(map[string](map[string]*config.TableContext))
+	added := 0
+	for _, t := range c.tables {
+		schema, name := t.Table.TableSchema, t.Table.TableName
+		tableMap := b.getDbTableMap(schema)
+		prevCtx, replicated := prev[schema][name]
+		if replicated && sameWhere(prevCtx.Table.Where, t.Table.Where) {
+			tableMap[name] = prevCtx
+			continue
+		}
+		if err := b.addTableToTableMap(tableMap, t.Table); err != nil {
+			b.logger.Warnf("mysql.reader: warm restart: not replicating %v.%v: %v", schema, name, err)
+			continue
+		}
+		if !replicated {
+			b.rescannedTables = append(b.rescannedTables, t)
+			added++
+		}
+	}
+	b.filter = c.filter
+	b.ReMap = c.filter.Patterns()
+	b.sqlFilter = c.sqlFilter
+	b.logger.Printf("mysql.reader: warm restart: replicating %d tables, %d of them new", len(c.tables), added)
+}
+
+// sameWhere tells if two Where of a table are the same, an empty one being
+// "true"
+func sameWhere(a, b string) bool {
+	if a == "" {
+		a = "true"
+	}
+	if b == "" {
+		b = "true"
+	}
+	return a == b
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"fmt"
+
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+)
+
+// masterAddr is a master the stream is asked to move to
+type masterAddr struct {
+	host string
+	port int
+}
+
+// ChangeMaster moves the binlog stream to another master of the source, e.g.
+// after a failover or a planned takeover. The stream reconnects once the
+// current syncer is closed, asking the new master for the transactions after
+// the last one sent.
+func (b *BinlogReader) ChangeMaster(host string, port int) {
+	b.repositionLock.Lock()
+	defer b.repositionLock.Unlock()
+	b.newMaster = &masterAddr{host: host, port: port}
+	// GetEvent of the stream fails once the syncer is closed
+	b.binlogSyncer.Close()
+}
+
+// sent records the GTID set including the transaction just sent.
+// Only the events ending a transaction carry the set.
+func (b *BinlogReader) sent(ev *replication.BinlogEvent) {
+	switch evt := ev.Event.(type) {
+	case *replication.XIDEvent:
+		if evt.GSet != nil {
+			b.sentGtidSet = evt.GSet
+		}
+	case *replication.QueryEvent:
+		if evt.GSet != nil {
+			b.sentGtidSet = evt.GSet
+		}
+	}
+}
+
+// takeNewMaster returns the master asked by ChangeMaster, if any.
+func (b *BinlogReader) takeNewMaster() *masterAddr {
+	b.repositionLock.Lock()
+	defer b.repositionLock.Unlock()
+	m := b.newMaster
+	b.newMaster = nil
+	return m
+}
+
+// reposition connects the stream to a new master. The transaction being
+// read is dropped: it is read again from the new master.
+func (b *BinlogReader) reposition(m *masterAddr) error {
+	gtidSet, err := b.readGtidSet()
+	if err != nil {
+		return err
+	}
+	b.logger.Printf("mysql.reader: moving to master %s:%d at %v", m.host, m.port, gtidSet)
+
+	b.repositionLock.Lock()
+	defer b.repositionLock.Unlock()
+	b.mysqlContext.ConnectionConfig.SetDirect(m.host, m.port)
+	b.syncerConfig.Host = m.host
+	b.syncerConfig.Port = uint16(m.port)
+	b.binlogSyncer = replication.NewBinlogSyncer(b.syncerConfig)
+
+	// the binlog files of the new master are not comparable with the old ones
+	b.currentCoordinatesMutex.Lock()
+	b.currentCoordinates = base.BinlogCoordinateTx{}
+	b.currentCoordinatesMutex.Unlock()
+	b.LastAppliedRowsEventHint = base.BinlogCoordinateTx{}
+	b.currentBinlogEntry = nil
+	// the new master is another server
+	b.dumps = 0
+
+	if b.binlogStreamer, err = b.binlogSyncer.StartSyncGTID(gtidSet); err != nil {
+		return fmt.Errorf("mysql.reader: reading binlog from new master %s:%d: %v", m.host, m.port, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"github.com/pingcap/parser/model"
+
+	sqle "github.com/actiontech/dtle/internal/client/driver/mysql/sqle/inspector"
+	"github.com/actiontech/dtle/internal/config"
+)
+
+// RescannedTable is a source table found by a rescan of the schemas
+type RescannedTable struct {
+	Table *config.Table
+	// CreateTable is the "SHOW CREATE TABLE" of the table
+	CreateTable string
+}
+
+// MatchTable returns if the job replicates the table, by the schemas and
+// the table names or patterns of ReplicateDoDb and ReplicateIgnoreDb.
+func (b *BinlogReader) MatchTable(schema, table string) bool {
+	b.tablesLock.RLock()
+	filter := b.filter
+	b.tablesLock.RUnlock()
+	return !b.skipEventWith(filter, schema, table)
+}
+
+// HasTable returns if the events of the table are already replicated
+func (b *BinlogReader) HasTable(schema, table string) bool {
+	b.tablesLock.RLock()
+	defer b.tablesLock.RUnlock()
+	_, ok := b.tables[schema][table]
+	return ok
+}
+
+// AddTables starts replicating the rows events of the tables, and returns
+// the ones which were not replicated yet. The tables are added to the schema
+// context by the streaming goroutine, before it handles the next event.
+func (b *BinlogReader) AddTables(tables []*RescannedTable) ([]*config.Table, error) {
+	b.tablesLock.Lock()
+	defer b.tablesLock.Unlock()
+
+	var added []*config.Table
+	for _, t := range tables {
+		tableMap := b.getDbTableMap(t.Table.TableSchema)
+		if _, ok := tableMap[t.Table.TableName]; ok {
+			continue
+		}
+		if err := b.addTableToTableMap(tableMap, t.Table); err != nil {
+			return added, err
+		}
+		b.rescannedTables = append(b.rescannedTables, t)
+		b.schemas.load(t.Table.TableSchema, t.Table.TableName, t.Table.OriginalTableColumns)
+		added = append(added, t.Table)
+	}
+	return added, nil
+}
+
+// loadRescannedTables adds the tables given to AddTables to the schema
+// context, so that the later DDLs on them are understood.
+func (b *BinlogReader) loadRescannedTables() {
+	b.tablesLock.Lock()
+	tables := b.rescannedTables
+	b.rescannedTables = nil
+	b.tablesLock.Unlock()
+
+	for _, t := range tables {
+		schema := t.Table.TableSchema
+		stmt, err := sqle.ParseCreateTableStmt("mysql", t.CreateTable)
+		if err != nil {
+			b.logger.Warnf("mysql.reader: rescan: cannot parse the definition of %v.%v: %v",
+				schema, t.Table.TableName, err)
+			continue
+		}
+		// SHOW CREATE TABLE does not qualify the table
+		stmt.Table.Schema = model.NewCIStr(schema)
+		b.context.AddSchema(schema)
+		b.context.LoadTables(schema, nil)
+		b.context.UpdateContext(stmt, "mysql")
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"io/ioutil"
+	"testing"
+
+	sqle "github.com/actiontech/dtle/internal/client/driver/mysql/sqle/inspector"
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestBinlogReader_AddTables(t *testing.T) {
+	doDb := []*config.DataSource{
+		{TableSchema: "db1", Tables: []*config.Table{{TableSchema: "db1", TableName: "~^t"}}},
+	}
+	filter, err := config.NewTableFilter(doDb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &BinlogReader{
+		logger:       log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)),
+		mysqlContext: &config.MySQLDriverConfig{ReplicateDoDb: doDb},
+		ReMap:        filter.Patterns(),
+		filter:       filter,
+		tables:       make(map[string](map[string]*config.TableContext)),
+		context:      sqle.NewContext(nil),
+	}
+	b.schemas = newSchemaTracker(b.context)
+	if err := b.addTableToTableMap(b.getDbTableMap("db1"), config.NewTable("db1", "t1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !b.MatchTable("db1", "t2") || b.MatchTable("db1", "a1") || b.MatchTable("db2", "t2") {
+		t.Errorf("MatchTable does not follow the patterns of the job")
+	}
+	if !b.HasTable("db1", "t1") || b.HasTable("db1", "t2") {
+		t.Errorf("HasTable does not follow the replicated tables")
+	}
+
+	t2 := config.NewTable("db1", "t2")
+	added, err := b.AddTables([]*RescannedTable{
+		{Table: config.NewTable("db1", "t1"), CreateTable: "CREATE TABLE `t1` (`id` int PRIMARY KEY)"},
+		{Table: t2, CreateTable: "CREATE TABLE `t2` (`id` int PRIMARY KEY)"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0] != t2 {
+		t.Fatalf("AddTables() = %v, want only t2", added)
+	}
+	if !b.HasTable("db1", "t2") {
+		t.Errorf("t2 is not replicated")
+	}
+
+	// the streaming goroutine adds the table to the schema context
+	if b.context.HasTable("db1", "t2") {
+		t.Errorf("t2 is in the schema context before the next event")
+	}
+	b.loadRescannedTables()
+	if !b.context.HasTable("db1", "t2") {
+		t.Errorf("t2 is not in the schema context")
+	}
+	if len(b.rescannedTables) != 0 {
+		t.Errorf("rescanned tables left: %v", b.rescannedTables)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pingcap/parser/ast"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	sqle "github.com/actiontech/dtle/internal/client/driver/mysql/sqle/inspector"
+	"github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/utils"
+)
+
+// maxTableVersions is how many definitions of a table the schema tracker
+// keeps
+const maxTableVersions = 8
+
+// TableVersion is a definition of a source table, which the rows events of
+// the table have from a DDL on, until the next DDL on the table.
+type TableVersion struct {
+	Version int
+	Columns *mysql.ColumnList
+	// Gtid and Query are the DDL which made the definition. They are empty
+	// for the definition of the table when the job started.
+	Gtid  string
+	Query string
+
+	// set once a row not matching the definition is reported
+	mismatchReported bool
+}
+
+// schemaTracker follows the definitions of the source tables through the
+// DDLs of the binlog, in the schema context of the reader, and numbers them
+// per table.
+type schemaTracker struct {
+	context *sqle.Context
+
+	lock     sync.Mutex
+	versions map[string][]*TableVersion
+}
+
+func newSchemaTracker(context *sqle.Context) *schemaTracker {
+	return &schemaTracker{
+		context:  context,
+		versions: make(map[string][]*TableVersion),
+	}
+}
+
+func trackedTableKey(schema, table string) string {
+	return fmt.Sprintf("%s.%s", schema, table)
+}
+
+// load records the definition of a table when the job started, or when a
+// rescan found it. It is ignored if the table already has one.
+func (t *schemaTracker) load(schema, table string, columns *mysql.ColumnList) {
+	if columns == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := trackedTableKey(schema, table)
+	if len(t.versions[key]) == 0 {
+		t.versions[key] = []*TableVersion{{Version: 1, Columns: columns}}
+	}
+}
+
+// applyDDL changes the schema context by a DDL, executed on the source with
+// currentSchema as its default schema.
+func (t *schemaTracker) applyDDL(currentSchema string, stmt ast.StmtNode) {
+	t.context.UseSchema(currentSchema)
+	if create, ok := stmt.(*ast.CreateTableStmt); ok {
+		// the context only adds tables to the schemas it loaded, which
+		// a schema created in the binlog is not
+		schema := utils.StringElse(create.Table.Schema.String(), currentSchema)
+		if !t.context.HasLoadTables(schema) {
+			t.context.AddSchema(schema)
+			t.context.LoadTables(schema, nil)
+		}
+	}
+	t.context.UpdateContext(stmt, "mysql")
+}
+
+// tableChanged makes a new version of a table after a DDL on it, with the
+// columns of the table in the schema context.
+func (t *schemaTracker) tableChanged(schema, table, gtid, query string) (*TableVersion, error) {
+	columns, err := base.GetTableColumnsSqle(t.context, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := trackedTableKey(schema, table)
+	versions := t.versions[key]
+	v := &TableVersion{Version: 1, Columns: columns, Gtid: gtid, Query: query}
+	if len(versions) > 0 {
+		v.Version = versions[len(versions)-1].Version + 1
+	}
+	versions = append(versions, v)
+	if len(versions) > maxTableVersions {
+		versions = versions[len(versions)-maxTableVersions:]
+	}
+	t.versions[key] = versions
+	return v, nil
+}
+
+// tableDropped forgets the versions of a dropped table. A table created
+// again with its name starts from version 1.
+func (t *schemaTracker) tableDropped(schema, table string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.versions, trackedTableKey(schema, table))
+}
+
+// checkColumnCount tells why the rows of a table do not have the columns of
+// its last version, the first time such a row is found for the version. It
+// returns "" if they do, or if it was told already.
+func (t *schemaTracker) checkColumnCount(schema, table string, count int) string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	versions := t.versions[trackedTableKey(schema, table)]
+	if len(versions) == 0 {
+		return ""
+	}
+	last := versions[len(versions)-1]
+	if last.Columns.Len() == count || last.mismatchReported {
+		return ""
+	}
+	last.mismatchReported = true
+
+	msg := fmt.Sprintf("a row of %s.%s has %d columns, version %d of the table has %d",
+		schema, table, count, last.Version, last.Columns.Len())
+	if last.Query != "" {
+		msg += fmt.Sprintf(" since %q (gtid %s)", utils.StrLim(last.Query, 256), last.Gtid)
+	}
+	for i := len(versions) - 2; i >= 0; i-- {
+		if versions[i].Columns.Len() == count {
+			msg += fmt.Sprintf(". the row matches version %d: the DDLs since then might not be understood",
+				versions[i].Version)
+			break
+		}
+	}
+	return msg
+}
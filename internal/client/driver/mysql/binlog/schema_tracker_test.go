@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"strings"
+	"testing"
+
+	sqle "github.com/actiontech/dtle/internal/client/driver/mysql/sqle/inspector"
+	"github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestSchemaTracker(t *testing.T) {
+	context := sqle.NewContext(nil)
+	context.LoadSchemas(nil)
+	context.AddSchema("db1")
+	context.LoadTables("db1", nil)
+	context.AddSchema("db0")
+	context.LoadTables("db0", nil)
+	// the extractor leaves the context on the last schema it loaded
+	context.UseSchema("db0")
+
+	tracker := newSchemaTracker(context)
+	applyDDL := func(currentSchema, query string) {
+		ddl, err := resolveDDLSQL(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracker.applyDDL(currentSchema, ddl.ast)
+	}
+	applyDDL("db1", "create table t1 (id int primary key, a int)")
+	tracker.load("db1", "t1", mysql.NewColumnList([]mysql.Column{{Name: "id"}, {Name: "a"}}))
+
+	// an unqualified table is in the default schema of the DDL
+	applyDDL("db1", "alter table t1 add column b int")
+	v, err := tracker.tableChanged("db1", "t1", "uuid:5", "alter table t1 add column b int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 2 || strings.Join(v.Columns.Names(), ",") != "id,a,b" {
+		t.Fatalf("version %d with columns %v, want 2 with id,a,b", v.Version, v.Columns.Names())
+	}
+
+	if msg := tracker.checkColumnCount("db1", "t1", 3); msg != "" {
+		t.Errorf("a row of the last version is reported: %v", msg)
+	}
+	msg := tracker.checkColumnCount("db1", "t1", 2)
+	if !strings.Contains(msg, "version 2") || !strings.Contains(msg, "matches version 1") {
+		t.Errorf("mismatch is told as %q", msg)
+	}
+	if msg := tracker.checkColumnCount("db1", "t1", 2); msg != "" {
+		t.Errorf("mismatch is told again: %v", msg)
+	}
+
+	// a table of a schema created in the binlog
+	applyDDL("db0", "create database db2")
+	applyDDL("db0", "create table db2.t2 (id int primary key)")
+	if v, err := tracker.tableChanged("db2", "t2", "uuid:7", ""); err != nil || v.Version != 1 {
+		t.Fatalf("version of db2.t2: %v, %v", v, err)
+	}
+
+	applyDDL("db1", "drop table t1")
+	tracker.tableDropped("db1", "t1")
+	if msg := tracker.checkColumnCount("db1", "t1", 1); msg != "" {
+		t.Errorf("a dropped table is tracked: %v", msg)
+	}
+
+	for i := 0; i < maxTableVersions+2; i++ {
+		if _, err := tracker.tableChanged("db2", "t2", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions := tracker.versions[trackedTableKey("db2", "t2")]
+	if len(versions) != maxTableVersions || versions[len(versions)-1].Version != maxTableVersions+3 {
+		t.Errorf("%d versions kept, the last is %d", len(versions), versions[len(versions)-1].Version)
+	}
+}
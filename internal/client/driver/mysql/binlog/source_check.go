@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"fmt"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+)
+
+// sourceState is what tells if the source still has the history read by
+// the stream.
+type sourceState struct {
+	serverUUID   string
+	gtidExecuted string
+	gtidPurged   string
+}
+
+// isDumpStart tells if ev is the artificial rotate event a source sends at
+// the start of a binlog dump. The source sends one as well after the rotate
+// event ending each binlog file, to the same next file.
+func (b *BinlogReader) isDumpStart(ev *replication.BinlogEvent) bool {
+	rotate, ok := ev.Event.(*replication.RotateEvent)
+	if !ok {
+		return false
+	}
+	if ev.Header.Flags&replication.LOG_EVENT_ARTIFICIAL_F == 0 {
+		b.rotatedTo = string(rotate.NextLogName)
+		return false
+	}
+	rotatedTo := b.rotatedTo
+	b.rotatedTo = ""
+	return string(rotate.NextLogName) != rotatedTo
+}
+
+// onDumpStart checks the source when a binlog dump starts. The syncer
+// reconnects by itself after a network failure, possibly to a server which
+// is not the one read before, or was restored from a backup. The stream
+// stops then, rather than reading another history.
+func (b *BinlogReader) onDumpStart() error {
+	state, err := b.querySource()
+	if err != nil {
+		return err
+	}
+	b.dumps++
+	if b.dumps == 1 {
+		b.sourceUUID = state.serverUUID
+		return nil
+	}
+	b.logger.Printf("mysql.reader: binlog dump reconnected to %v. checking the source", state.serverUUID)
+	read, err := b.readGtidSet()
+	if err != nil {
+		return err
+	}
+	return checkSourceHistory(b.sourceUUID, read, state)
+}
+
+// explainStreamError returns why the stream failed when the source lost the
+// history read by the stream, e.g. when the source refuses to resume the
+// dump, or err otherwise.
+func (b *BinlogReader) explainStreamError(err error) error {
+	if b.dumps == 0 || b.shutdown {
+		return err
+	}
+	state, qerr := b.querySource()
+	if qerr != nil {
+		return err
+	}
+	read, rerr := b.readGtidSet()
+	if rerr != nil {
+		return err
+	}
+	if herr := checkSourceHistory(b.sourceUUID, read, state); herr != nil {
+		return herr
+	}
+	return err
+}
+
+func (b *BinlogReader) querySource() (state sourceState, err error) {
+	db, err := sql.CreateDB(b.mysqlContext.ConnectionConfig.Direct().GetDBUri())
+	if err != nil {
+		return state, err
+	}
+	defer db.Close()
+	ctx, cancel := b.queryContext()
+	defer cancel()
+	err = db.QueryRowContext(ctx, "select @@global.server_uuid, @@global.gtid_executed, @@global.gtid_purged").
+		Scan(&state.serverUUID, &state.gtidExecuted, &state.gtidPurged)
+	return state, err
+}
+
+// readGtidSet returns the transactions the stream read: the ones sent, or
+// the ones before its start.
+func (b *BinlogReader) readGtidSet() (gomysql.GTIDSet, error) {
+	if b.sentGtidSet != nil {
+		return b.sentGtidSet, nil
+	}
+	return gomysql.ParseMysqlGTIDSet(b.startGtidSet)
+}
+
+// checkSourceHistory returns an error if the source is not the server with
+// serverUUID, does not have all the transactions read, or purged some which
+// are not read yet.
+func checkSourceHistory(serverUUID string, read gomysql.GTIDSet, state sourceState) error {
+	if state.serverUUID != serverUUID {
+		return fmt.Errorf("server_uuid of the source changed from %v to %v. "+
+			"the binlog stream reconnected to another server", serverUUID, state.serverUUID)
+	}
+	executed, err := gomysql.ParseMysqlGTIDSet(state.gtidExecuted)
+	if err != nil {
+		return err
+	}
+	if !executed.Contain(read) {
+		return fmt.Errorf("the source misses transactions read by the job, e.g. it was restored from a backup. "+
+			"read: %v, gtid_executed of the source: %v", read, state.gtidExecuted)
+	}
+	purged, err := gomysql.ParseMysqlGTIDSet(state.gtidPurged)
+	if err != nil {
+		return err
+	}
+	if !read.Contain(purged) {
+		return fmt.Errorf("the source purged binlogs of transactions not read by the job yet. "+
+			"read: %v, gtid_purged of the source: %v", read, state.gtidPurged)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"testing"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+const sourceUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func TestCheckSourceHistory(t *testing.T) {
+	read, err := gomysql.ParseMysqlGTIDSet(sourceUUID + ":1-100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		state sourceState
+		ok    bool
+	}{
+		{"same history", sourceState{sourceUUID, sourceUUID + ":1-120", sourceUUID + ":1-50"}, true},
+		{"another server", sourceState{"4e11fa47-71ca-11e1-9e33-c80aa9429562", sourceUUID + ":1-120", ""}, false},
+		{"restored from a backup", sourceState{sourceUUID, sourceUUID + ":1-80", ""}, false},
+		{"purged unread transactions", sourceState{sourceUUID, sourceUUID + ":1-120", sourceUUID + ":1-110"}, false},
+	}
+	for _, tt := range tests {
+		err := checkSourceHistory(sourceUUID, read, tt.state)
+		if (err == nil) != tt.ok {
+			t.Errorf("%v: checkSourceHistory() = %v", tt.name, err)
+		}
+	}
+}
+
+func TestBinlogReader_isDumpStart(t *testing.T) {
+	rotate := func(next string, flags uint16) *replication.BinlogEvent {
+		return &replication.BinlogEvent{
+			Header: &replication.EventHeader{EventType: replication.ROTATE_EVENT, Flags: flags},
+			Event:  &replication.RotateEvent{NextLogName: []byte(next)},
+		}
+	}
+	b := &BinlogReader{}
+	if !b.isDumpStart(rotate("mysql-bin.000001", replication.LOG_EVENT_ARTIFICIAL_F)) {
+		t.Errorf("the first dump is not found")
+	}
+	if b.isDumpStart(rotate("mysql-bin.000002", 0)) ||
+		b.isDumpStart(rotate("mysql-bin.000002", replication.LOG_EVENT_ARTIFICIAL_F)) {
+		t.Errorf("a binlog file switch is taken as a dump start")
+	}
+	if !b.isDumpStart(rotate("mysql-bin.000002", replication.LOG_EVENT_ARTIFICIAL_F)) {
+		t.Errorf("a reconnection is not found")
+	}
+}
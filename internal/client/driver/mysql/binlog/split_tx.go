@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+// splitTx sends the events of the current transaction read so far as a part
+// of it, once they reach TxSplitRows, for a huge transaction not to be held
+// whole by the extractor and the applier. The last part is sent as the
+// transaction ends. An XA transaction, held until its XA COMMIT, is not split.
+func (b *BinlogReader) splitTx(entriesChannel chan<- *BinlogEntry) {
+	entry := b.currentBinlogEntry
+	if b.mysqlContext.TxSplitRows <= 0 || len(entry.Events) < b.mysqlContext.TxSplitRows || entry.xid != "" {
+		return
+	}
+	if entry.Part == 0 {
+		entry.Part = 1
+		b.logger.Printf("mysql.reader: splitting transaction %v of more than %d rows",
+			entry.Coordinates.GetGtidForThisTx(), b.mysqlContext.TxSplitRows)
+	}
+	entry.MoreParts = true
+	entriesChannel <- entry
+	b.currentBinlogEntry = nextPart(entry)
+}
+
+// nextPart returns the entry of the part following entry, of the same
+// transaction.
+//
+// The events of a part sent are not rolled back to a savepoint anymore: a
+// savepoint set before it drops the events of the next parts only. The
+// changes a transaction rolled back on the source logs are the ones of
+// non-transactional tables, which stay anyway.
+func nextPart(entry *BinlogEntry) *BinlogEntry {
+	next := NewBinlogEntryAt(entry.Coordinates)
+	next.hasBeginQuery = entry.hasBeginQuery
+	next.Part = entry.Part + 1
+	next.PartOffset = entry.PartOffset + len(entry.Events)
+	if len(entry.savepoints) > 0 {
+		next.savepoints = make(map[string]int, len(entry.savepoints))
+		for name := range entry.savepoints {
+			next.savepoints[name] = 0
+		}
+	}
+	return next
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestBinlogReader_splitTx(t *testing.T) {
+	b := &BinlogReader{
+		logger:       log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)),
+		mysqlContext: &config.MySQLDriverConfig{TxSplitRows: 2},
+	}
+	ch := make(chan *BinlogEntry, 2)
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: 5})
+	b.currentBinlogEntry.savepoints = map[string]int{"sp1": 1}
+	row := NewQueryEvent("db1", "", InsertDML)
+
+	b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, row)
+	b.splitTx(ch)
+	if len(ch) != 0 {
+		t.Fatalf("a part of 1 row was sent")
+	}
+	b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, row, row)
+	b.splitTx(ch)
+	b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, row, row)
+	b.splitTx(ch)
+	if len(ch) != 2 {
+		t.Fatalf("%d parts sent, want 2", len(ch))
+	}
+	for i, want := range []struct {
+		part, offset, events int
+	}{{1, 0, 3}, {2, 3, 2}} {
+		part := <-ch
+		if part.Part != want.part || part.PartOffset != want.offset || len(part.Events) != want.events ||
+			!part.MoreParts || part.Coordinates.GNO != 5 {
+			t.Errorf("part %d: %+v", i, part)
+		}
+	}
+
+	last := b.currentBinlogEntry
+	if last.Part != 3 || last.PartOffset != 5 || len(last.Events) != 0 || last.MoreParts {
+		t.Errorf("last part: %+v", last)
+	}
+	if sp, ok := last.savepoints["sp1"]; !ok || sp != 0 {
+		t.Errorf("savepoints of the last part: %v", last.savepoints)
+	}
+}
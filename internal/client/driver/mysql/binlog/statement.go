@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"fmt"
+
+	"github.com/pingcap/parser"
+	ast "github.com/pingcap/parser/ast"
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/utils"
+)
+
+// tableCollector collects the tables named in a statement
+type tableCollector struct {
+	tables []*ast.TableName
+}
+
+func (c *tableCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if t, ok := n.(*ast.TableName); ok {
+		c.tables = append(c.tables, t)
+	}
+	return n, false
+}
+
+func (c *tableCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// statementTables returns the tables written by a DML statement. It returns
+// false if the statement is not a DML it knows.
+func statementTables(query string) ([]SchemaTable, bool) {
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return nil, false
+	}
+	c := &tableCollector{}
+	switch stmt := stmt.(type) {
+	case *ast.InsertStmt:
+		stmt.Table.Accept(c)
+	case *ast.UpdateStmt:
+		stmt.TableRefs.Accept(c)
+	case *ast.DeleteStmt:
+		if stmt.IsMultiTable && stmt.Tables != nil {
+			stmt.Tables.Accept(c)
+		} else {
+			stmt.TableRefs.Accept(c)
+		}
+	default:
+		return nil, false
+	}
+	tables := make([]SchemaTable, 0, len(c.tables))
+	for _, t := range c.tables {
+		tables = append(tables, SchemaTable{Schema: t.Schema.O, Table: t.Name.O})
+	}
+	return tables, true
+}
+
+// handleStatementEvent handles a statement in a transaction of the binlog
+// other than its control: a DML the source logged as a statement, with
+// binlog_format STATEMENT or MIXED, instead of its rows. It is dropped if it
+// writes no replicated table. Otherwise it stops the task, unless
+// StatementBinlog is "apply" and it is sent to be executed as is.
+func (b *BinlogReader) handleStatementEvent(ev *replication.BinlogEvent, currentSchema, query string) error {
+	tables, known := statementTables(query)
+	if known {
+		replicated := false
+		for _, t := range tables {
+			if !b.skipEvent(utils.StringElse(t.Schema, currentSchema), t.Table) {
+				replicated = true
+				break
+			}
+		}
+		if !replicated {
+			b.logger.Debugf("mysql.reader: skip statement of tables not replicated: %s", query)
+			return nil
+		}
+	}
+
+	if b.mysqlContext.StatementBinlog != config.StatementBinlogApply {
+		return fmt.Errorf("the source logged a DML as a statement, not as rows, at %v:%d (gtid %v): %q. "+
+			"set binlog_format=ROW for the sessions writing the replicated tables, "+
+			"or StatementBinlog \"apply\" to execute it as is on a MySQL target",
+			b.currentCoordinates.LogFile, ev.Header.LogPos-ev.Header.EventSize,
+			b.currentBinlogEntry.Coordinates.GetGtidForThisTx(), utils.StrLim(query, 256))
+	}
+	b.logger.Debugf("mysql.reader: statement of %v to apply as is: %s",
+		b.currentBinlogEntry.Coordinates.GetGtidForThisTx(), query)
+	event := NewQueryEvent(currentSchema, query, NotDML)
+	event.Statement = true
+	b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, event)
+	return nil
+}
+
+// StatementNotApplied is the error of a target other than MySQL given a DML
+// logged as a statement, which it cannot apply
+func StatementNotApplied(entry *BinlogEntry, event *DataEvent, target string) error {
+	return fmt.Errorf("%v has a DML logged as a statement by the source, which a %v target cannot apply: %q. "+
+		"set binlog_format=ROW on the source", entry.Coordinates.GetGtidForThisTx(), target, utils.StrLim(event.Query, 256))
+}
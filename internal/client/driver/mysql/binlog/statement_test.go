@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestStatementTables(t *testing.T) {
+	tests := []struct {
+		query  string
+		tables []SchemaTable
+		known  bool
+	}{
+		{"insert into t1 select * from db2.t2", []SchemaTable{{"", "t1"}}, true},
+		{"UPDATE db1.t1 a JOIN t2 b ON a.id = b.id SET a.c = b.c", []SchemaTable{{"db1", "t1"}, {"", "t2"}}, true},
+		{"delete t1 from t1 join t2 using (id)", []SchemaTable{{"", "t1"}}, true},
+		{"delete from db1.t1 where id = 1", []SchemaTable{{"db1", "t1"}}, true},
+		{"create table t1 (id int)", nil, false},
+	}
+	for _, tt := range tests {
+		tables, known := statementTables(tt.query)
+		if known != tt.known || (known && !reflect.DeepEqual(tables, tt.tables)) {
+			t.Errorf("statementTables(%q) = %v, %v, want %v, %v", tt.query, tables, known, tt.tables, tt.known)
+		}
+	}
+}
+
+func TestBinlogReader_handleStatementEvent(t *testing.T) {
+	doDb := []*config.DataSource{{TableSchema: "db1"}}
+	filter, err := config.NewTableFilter(doDb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &BinlogReader{
+		logger:       log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)),
+		mysqlContext: &config.MySQLDriverConfig{ReplicateDoDb: doDb, StatementBinlog: config.StatementBinlogError},
+		filter:       filter,
+	}
+	b.currentCoordinates.LogFile = "mysql-bin.000003"
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: 7})
+	ev := &replication.BinlogEvent{Header: &replication.EventHeader{LogPos: 500, EventSize: 100}}
+
+	if err := b.handleStatementEvent(ev, "db2", "insert into t1 values (1)"); err != nil {
+		t.Fatalf("statement of a table not replicated: %v", err)
+	}
+	err = b.handleStatementEvent(ev, "db1", "insert into t1 values (1)")
+	if err == nil || !strings.Contains(err.Error(), "mysql-bin.000003:400") {
+		t.Fatalf("got %v", err)
+	}
+
+	b.mysqlContext.StatementBinlog = config.StatementBinlogApply
+	if err := b.handleStatementEvent(ev, "db2", "update db1.t1 set c = 1"); err != nil {
+		t.Fatal(err)
+	}
+	events := b.currentBinlogEntry.Events
+	if len(events) != 1 || !events[0].Statement || events[0].CurrentSchema != "db2" {
+		t.Fatalf("events = %+v", events)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"fmt"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// ignoredEventTypes are the events the reader does not handle which have
+// nothing to replicate
+var ignoredEventTypes = map[replication.EventType]bool{
+	replication.FORMAT_DESCRIPTION_EVENT: true,
+	replication.PREVIOUS_GTIDS_EVENT:     true,
+	replication.TABLE_MAP_EVENT:          true,
+	replication.ROWS_QUERY_EVENT:         true,
+	replication.ANONYMOUS_GTID_EVENT:     true,
+	replication.STOP_EVENT:               true,
+	replication.IGNORABLE_EVENT:          true,
+	replication.HEARTBEAT_EVENT:          true,
+	replication.ROTATE_EVENT:             true,
+}
+
+// strictError is the error of Strict for an event, with its coordinates
+func (b *BinlogReader) strictError(ev *replication.BinlogEvent, format string, args ...interface{}) error {
+	gtid := "none"
+	if b.currentBinlogEntry != nil {
+		gtid = b.currentBinlogEntry.Coordinates.GetGtidForThisTx()
+	}
+	return fmt.Errorf("strict: %v at %v:%d (gtid %v)", fmt.Sprintf(format, args...),
+		b.currentCoordinates.LogFile, ev.Header.LogPos-ev.Header.EventSize, gtid)
+}
+
+// checkStrictEvent fails an event which is neither handled nor ignored,
+// e.g. an INCIDENT_EVENT, which tells the changes of the source are not all
+// in the binlog, or a LOAD DATA logged as a statement.
+func (b *BinlogReader) checkStrictEvent(ev *replication.BinlogEvent) error {
+	if !b.mysqlContext.Strict || ignoredEventTypes[ev.Header.EventType] {
+		return nil
+	}
+	if ev.Header.EventType == replication.INCIDENT_EVENT {
+		return b.strictError(ev, "incident on the source, its binlog misses changes")
+	}
+	return b.strictError(ev, "unsupported binlog event %v", ev.Header.EventType)
+}
+
+// checkStrictRows fails a rows event of a table whose columns do not match
+// the ones known to the reader, or with a spatial column, whose values are
+// not replicated.
+func (b *BinlogReader) checkStrictRows(ev *replication.BinlogEvent, rowsEvent *replication.RowsEvent, table *config.TableContext) error {
+	if !b.mysqlContext.Strict {
+		return nil
+	}
+	schema, name := string(rowsEvent.Table.Schema), string(rowsEvent.Table.Table)
+	var columns []mysql.Column
+	if table != nil && table.Table.OriginalTableColumns != nil {
+		columns = table.Table.OriginalTableColumns.ColumnList()
+		if len(columns) != int(rowsEvent.ColumnCount) {
+			return b.strictError(ev, "a row of %v.%v has %d columns, the table is known with %d",
+				schema, name, rowsEvent.ColumnCount, len(columns))
+		}
+	}
+	for i, tp := range rowsEvent.Table.ColumnType {
+		if tp != gomysql.MYSQL_TYPE_GEOMETRY {
+			continue
+		}
+		column := fmt.Sprintf("#%d", i+1)
+		if i < len(columns) {
+			column = columns[i].Name
+		}
+		return b.strictError(ev, "column %v of %v.%v is of a spatial type, which is not supported",
+			column, schema, name)
+	}
+	return nil
+}
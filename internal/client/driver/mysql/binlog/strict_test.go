@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"strings"
+	"testing"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestBinlogReader_checkStrict(t *testing.T) {
+	b := &BinlogReader{mysqlContext: &config.MySQLDriverConfig{}}
+	b.currentCoordinates.LogFile = "mysql-bin.000003"
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: 7})
+	event := func(tp replication.EventType) *replication.BinlogEvent {
+		return &replication.BinlogEvent{Header: &replication.EventHeader{EventType: tp, LogPos: 500, EventSize: 100}}
+	}
+	rowsEvent := &replication.RowsEvent{
+		Table: &replication.TableMapEvent{
+			Schema:     []byte("db1"),
+			Table:      []byte("t1"),
+			ColumnType: []byte{gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_GEOMETRY},
+		},
+		ColumnCount: 2,
+	}
+	table := &config.TableContext{Table: &config.Table{
+		OriginalTableColumns: mysql.NewColumnList([]mysql.Column{{Name: "id"}, {Name: "g"}}),
+	}}
+	ev := event(replication.WRITE_ROWS_EVENTv2)
+
+	if err := b.checkStrictEvent(event(replication.INCIDENT_EVENT)); err != nil {
+		t.Fatalf("not strict: %v", err)
+	}
+	if err := b.checkStrictRows(ev, rowsEvent, table); err != nil {
+		t.Fatalf("not strict: %v", err)
+	}
+
+	b.mysqlContext.Strict = true
+	if err := b.checkStrictEvent(event(replication.TABLE_MAP_EVENT)); err != nil {
+		t.Fatal(err)
+	}
+	err := b.checkStrictEvent(event(replication.EXECUTE_LOAD_QUERY_EVENT))
+	if err == nil || !strings.Contains(err.Error(), "mysql-bin.000003:400") {
+		t.Fatalf("got %v", err)
+	}
+	err = b.checkStrictRows(ev, rowsEvent, table)
+	if err == nil || !strings.Contains(err.Error(), "column g of db1.t1") {
+		t.Fatalf("got %v", err)
+	}
+	rowsEvent.Table.ColumnType = []byte{gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_LONG}
+	rowsEvent.ColumnCount = 3
+	err = b.checkStrictRows(ev, rowsEvent, table)
+	if err == nil || !strings.Contains(err.Error(), "has 3 columns") {
+		t.Fatalf("got %v", err)
+	}
+}
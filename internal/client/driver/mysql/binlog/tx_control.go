@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// xaPrepareLogEvent ends the first phase of an XA transaction (MySQL 5.7+).
+// The binlog parser does not know it and gives a generic event.
+const xaPrepareLogEvent replication.EventType = 0x26
+
+// txControl is a statement of the binlog controlling a transaction, rather
+// than changing data.
+type txControl int
+
+const (
+	txControlNone txControl = iota
+	txControlCommit
+	txControlRollback
+	txControlSavepoint
+	txControlRollbackTo
+	txControlReleaseSavepoint
+	txControlXAStart
+	txControlXAEnd
+	txControlXACommit
+	txControlXARollback
+)
+
+var txControlStatements = []struct {
+	control txControl
+	re      *regexp.Regexp
+}{
+	{txControlCommit, regexp.MustCompile(`(?is)^commit(\s+work)?$`)},
+	{txControlRollback, regexp.MustCompile(`(?is)^rollback(\s+work)?$`)},
+	{txControlRollbackTo, regexp.MustCompile(`(?is)^rollback(?:\s+work)?\s+to\s+(?:savepoint\s+)?(.+)$`)},
+	{txControlSavepoint, regexp.MustCompile(`(?is)^savepoint\s+(.+)$`)},
+	{txControlReleaseSavepoint, regexp.MustCompile(`(?is)^release\s+savepoint\s+(.+)$`)},
+	{txControlXAStart, regexp.MustCompile(`(?is)^xa\s+(?:start|begin)\s+(.+?)(?:\s+(?:join|resume))?$`)},
+	{txControlXAEnd, regexp.MustCompile(`(?is)^xa\s+end\s+(.+?)(?:\s+suspend(?:\s+for\s+migrate)?)?$`)},
+	{txControlXACommit, regexp.MustCompile(`(?is)^xa\s+commit\s+(.+?)(?:\s+one\s+phase)?$`)},
+	{txControlXARollback, regexp.MustCompile(`(?is)^xa\s+rollback\s+(.+)$`)},
+}
+
+// parseTxControl returns the kind of a transaction control statement, with
+// its savepoint name (unquoted and in lower case, as savepoint names are
+// case-insensitive) or its XA xid. It returns txControlNone for any other
+// statement.
+func parseTxControl(query string) (txControl, string) {
+	query = strings.TrimSpace(query)
+	for _, s := range txControlStatements {
+		m := s.re.FindStringSubmatch(query)
+		if m == nil {
+			continue
+		}
+		switch s.control {
+		case txControlSavepoint, txControlRollbackTo, txControlReleaseSavepoint:
+			return s.control, strings.ToLower(strings.Trim(m[1], "`"))
+		case txControlCommit, txControlRollback:
+			return s.control, ""
+		default:
+			return s.control, m[1]
+		}
+	}
+	return txControlNone, ""
+}
+
+// handleTxControl handles a transaction control statement of the binlog. It
+// returns false if query is not one, or is not to be handled here.
+//
+// A transaction is flattened into one transaction of the target, applied as
+// it ends on the source:
+//   - the events rolled back to a savepoint are dropped, as is a transaction
+//     ending with ROLLBACK;
+//   - a prepared XA transaction is held until its XA COMMIT, logged as a
+//     transaction of its own, which applies it. An XA ROLLBACK drops it. The
+//     GTID of the XA PREPARE is executed with the one ending it.
+//
+// Changes to non-transactional tables rolled back on the source are lost, as
+// the changes to transactional tables were not logged anyway.
+func (b *BinlogReader) handleTxControl(ev *replication.BinlogEvent, query string,
+	entriesChannel chan<- *BinlogEntry) (bool, error) {
+
+	control, name := parseTxControl(query)
+	entry := b.currentBinlogEntry
+	switch control {
+	case txControlNone:
+		return false, nil
+	case txControlXAStart:
+		entry.hasBeginQuery = true
+		entry.xid = name
+		return true, nil
+	case txControlXAEnd:
+		return true, nil
+	case txControlSavepoint:
+		if entry.savepoints == nil {
+			entry.savepoints = make(map[string]int)
+		}
+		entry.savepoints[name] = len(entry.Events)
+		return true, nil
+	case txControlReleaseSavepoint:
+		delete(entry.savepoints, name)
+		return true, nil
+	case txControlRollbackTo:
+		n, ok := entry.savepoints[name]
+		if !ok {
+			return true, fmt.Errorf("rollback to unknown savepoint %v in %v", name, entry.Coordinates.GetGtidForThisTx())
+		}
+		if len(entry.Events) > n {
+			b.logger.Warnf("mysql.reader: %v rolls back to savepoint %v. dropping %d events of non-transactional tables",
+				entry.Coordinates.GetGtidForThisTx(), name, len(entry.Events)-n)
+			entry.Events = entry.Events[:n]
+		}
+		for sp, i := range entry.savepoints {
+			if i > n {
+				delete(entry.savepoints, sp)
+			}
+		}
+		return true, nil
+	case txControlCommit:
+		if !entry.hasBeginQuery {
+			return false, nil
+		}
+	case txControlRollback:
+		if !entry.hasBeginQuery {
+			return false, nil
+		}
+		b.dropRolledBackEvents()
+	case txControlXACommit:
+		// a one-phase XA COMMIT ends the transaction it is in
+		if !entry.hasBeginQuery {
+			prepared := b.takeXAPrepared(name)
+			if prepared == nil {
+				b.logger.Warnf("mysql.reader: XA transaction %v is committed on the source, "+
+					"but was prepared before the position of the job. its changes are not replicated", name)
+			} else {
+				entry.Events = prepared.Events
+				entry.XAPrepare = &prepared.Coordinates
+			}
+		}
+	case txControlXARollback:
+		if entry.hasBeginQuery {
+			b.dropRolledBackEvents()
+		} else if prepared := b.takeXAPrepared(name); prepared != nil {
+			entry.XAPrepare = &prepared.Coordinates
+		}
+	}
+	b.sendEntry(ev, entriesChannel)
+	return true, nil
+}
+
+// holdXAPrepared holds the current entry, a prepared XA transaction, until
+// the transaction ending it.
+func (b *BinlogReader) holdXAPrepared() {
+	entry := b.currentBinlogEntry
+	if b.xaPrepared == nil {
+		b.xaPrepared = make(map[string]*BinlogEntry)
+	}
+	b.xaPrepared[entry.xid] = entry
+}
+
+// takeXAPrepared returns the prepared XA transaction of xid, if held, and
+// stops holding it.
+func (b *BinlogReader) takeXAPrepared(xid string) *BinlogEntry {
+	entry := b.xaPrepared[xid]
+	delete(b.xaPrepared, xid)
+	return entry
+}
+
+func (b *BinlogReader) dropRolledBackEvents() {
+	entry := b.currentBinlogEntry
+	if len(entry.Events) > 0 {
+		b.logger.Warnf("mysql.reader: %v is rolled back. dropping %d events of non-transactional tables",
+			entry.Coordinates.GetGtidForThisTx(), len(entry.Events))
+		entry.Events = entry.Events[:0]
+	}
+}
+
+// sendEntry sends the current entry, which is ended by ev.
+func (b *BinlogReader) sendEntry(ev *replication.BinlogEvent, entriesChannel chan<- *BinlogEntry) {
+	entriesChannel <- b.currentBinlogEntry
+	b.LastAppliedRowsEventHint = b.currentCoordinates
+	b.sent(ev)
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestParseTxControl(t *testing.T) {
+	tests := []struct {
+		query   string
+		control txControl
+		name    string
+	}{
+		{"COMMIT", txControlCommit, ""},
+		{"rollback work", txControlRollback, ""},
+		{"SAVEPOINT `Sp1`", txControlSavepoint, "sp1"},
+		{"ROLLBACK TO `sp1`", txControlRollbackTo, "sp1"},
+		{"rollback work to savepoint sp1", txControlRollbackTo, "sp1"},
+		{"RELEASE SAVEPOINT `sp1`", txControlReleaseSavepoint, "sp1"},
+		{"XA START X'78',X'',1", txControlXAStart, "X'78',X'',1"},
+		{"XA END X'78',X'',1", txControlXAEnd, "X'78',X'',1"},
+		{"XA COMMIT X'78',X'',1", txControlXACommit, "X'78',X'',1"},
+		{"XA COMMIT X'78',X'',1 ONE PHASE", txControlXACommit, "X'78',X'',1"},
+		{"XA ROLLBACK X'78',X'',1", txControlXARollback, "X'78',X'',1"},
+		{"BEGIN", txControlNone, ""},
+		{"insert into savepoint values (1)", txControlNone, ""},
+	}
+	for _, tt := range tests {
+		control, name := parseTxControl(tt.query)
+		if control != tt.control || name != tt.name {
+			t.Errorf("parseTxControl(%q) = %v, %q, want %v, %q", tt.query, control, name, tt.control, tt.name)
+		}
+	}
+}
+
+func TestBinlogReader_handleTxControl(t *testing.T) {
+	b := &BinlogReader{logger: log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel))}
+	ch := make(chan *BinlogEntry, 1)
+	ev := &replication.BinlogEvent{Event: &replication.QueryEvent{}}
+	handle := func(query string) bool {
+		handled, err := b.handleTxControl(ev, query, ch)
+		if err != nil {
+			t.Fatalf("%v: %v", query, err)
+		}
+		return handled
+	}
+	row := NewQueryEvent("db1", "", InsertDML)
+
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{})
+	b.currentBinlogEntry.hasBeginQuery = true
+	b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, row)
+	handle("SAVEPOINT `a`")
+	b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, row)
+	handle("SAVEPOINT `b`")
+	b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, row)
+	handle("ROLLBACK TO `a`")
+	if n := len(b.currentBinlogEntry.Events); n != 1 {
+		t.Errorf("%d events after rollback to a savepoint, want 1", n)
+	}
+	if _, err := b.handleTxControl(ev, "ROLLBACK TO `b`", ch); err == nil {
+		t.Errorf("rolled back to a savepoint set after the one rolled back to")
+	}
+	if !handle("COMMIT") {
+		t.Fatalf("COMMIT does not end the transaction")
+	}
+	if entry := <-ch; len(entry.Events) != 1 {
+		t.Errorf("%d events committed, want 1", len(entry.Events))
+	}
+
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{})
+	b.currentBinlogEntry.hasBeginQuery = true
+	b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, row)
+	handle("ROLLBACK")
+	if entry := <-ch; len(entry.Events) != 0 {
+		t.Errorf("%d events rolled back, want none", len(entry.Events))
+	}
+
+	// a one-phase XA transaction
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{})
+	handle("XA START X'78',X'',1")
+	if !b.currentBinlogEntry.hasBeginQuery {
+		t.Errorf("XA START does not begin a transaction")
+	}
+	b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, row)
+	handle("XA END X'78',X'',1")
+	if len(ch) != 0 {
+		t.Fatalf("XA END ends the transaction")
+	}
+	handle("XA COMMIT X'78',X'',1 ONE PHASE")
+	if entry := <-ch; len(entry.Events) != 1 {
+		t.Errorf("%d events committed, want 1", len(entry.Events))
+	}
+
+	// a prepared XA transaction is held until its second phase
+	prepare := func(gno int64, xid string) {
+		b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: gno})
+		handle("XA START " + xid)
+		b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, row)
+		handle("XA END " + xid)
+		b.holdXAPrepared()
+		if len(ch) != 0 {
+			t.Fatalf("XA PREPARE sends the transaction")
+		}
+	}
+	prepare(10, "X'78',X'',1")
+	prepare(11, "X'79',X'',1")
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: 12})
+	handle("XA COMMIT X'78',X'',1")
+	if entry := <-ch; len(entry.Events) != 1 || entry.XAPrepare == nil || entry.XAPrepare.GNO != 10 {
+		t.Errorf("XA COMMIT of a prepared transaction has %d events, prepared by %v", len(entry.Events), entry.XAPrepare)
+	}
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: 13})
+	handle("XA ROLLBACK X'79',X'',1")
+	if entry := <-ch; len(entry.Events) != 0 || entry.XAPrepare == nil || entry.XAPrepare.GNO != 11 {
+		t.Errorf("XA ROLLBACK of a prepared transaction has %d events, prepared by %v", len(entry.Events), entry.XAPrepare)
+	}
+	if len(b.xaPrepared) != 0 {
+		t.Errorf("%d XA transactions held after their second phase", len(b.xaPrepared))
+	}
+
+	// an XA transaction prepared before the position of the job
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: 14})
+	handle("XA COMMIT X'7a',X'',1")
+	if entry := <-ch; len(entry.Events) != 0 || entry.XAPrepare != nil {
+		t.Errorf("XA COMMIT of an unknown transaction has %d events, prepared by %v", len(entry.Events), entry.XAPrepare)
+	}
+
+	b.currentBinlogEntry = NewBinlogEntryAt(base.BinlogCoordinateTx{})
+	if handle("COMMIT") {
+		t.Errorf("COMMIT out of a transaction is handled")
+	}
+}
@@ -0,0 +1,249 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	gosql "database/sql"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/g"
+)
+
+// blobStore keeps the offloaded values
+type blobStore interface {
+	exists(key string) (bool, error)
+	put(key string, data []byte) error
+}
+
+type s3BlobStore struct {
+	client *s3.S3
+	bucket string
+}
+
+func newS3BlobStore(cfg *config.BlobOffloadConfig) (*s3BlobStore, error) {
+	awsCfg := aws.NewConfig()
+	if cfg.Region != "" {
+		awsCfg = awsCfg.WithRegion(cfg.Region)
+	}
+	if cfg.Endpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.Endpoint).WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &s3BlobStore{client: s3.New(sess), bucket: cfg.Bucket}, nil
+}
+
+func (s *s3BlobStore) exists(key string) (bool, error) {
+	_, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *s3BlobStore) put(key string, data []byte) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+// blobOffloader replaces the big values applied by the URLs of objects
+// holding them, uploaded if they are new.
+type blobOffloader struct {
+	cfg   *config.BlobOffloadConfig
+	store blobStore
+	// records the objects in the side table. nil unless SideTable is set
+	record func(schema, table, column, url string, size int, sum string) error
+
+	// the columns of the target tables of the full copy, by "schema.table"
+	columnsLock sync.Mutex
+	columns     map[string]*umconf.ColumnList
+}
+
+func newBlobOffloader(cfg *config.BlobOffloadConfig, store blobStore) (*blobOffloader, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("BlobOffload: missing Bucket")
+	}
+	for _, pattern := range cfg.Columns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("BlobOffload: bad pattern %q of Columns: %v", pattern, err)
+		}
+	}
+	return &blobOffloader{cfg: cfg, store: store, columns: make(map[string]*umconf.ColumnList)}, nil
+}
+
+// initBlobOffload prepares the offload of the big values of the applier, and
+// the side table
+func (a *Applier) initBlobOffload() error {
+	cfg := a.mysqlContext.BlobOffload
+	store, err := newS3BlobStore(cfg)
+	if err != nil {
+		return err
+	}
+	if a.blobOffload, err = newBlobOffloader(cfg, store); err != nil {
+		return err
+	}
+	if !cfg.SideTable {
+		return nil
+	}
+	query := fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %v.%v (
+				object_url varchar(1024) NOT NULL,
+				job_uuid binary(16) NOT NULL COMMENT 'job which uploaded the object',
+				table_schema varchar(64) NOT NULL,
+				table_name varchar(64) NOT NULL,
+				column_name varchar(64) NOT NULL,
+				bytes bigint NOT NULL,
+				sha256 char(64) NOT NULL,
+				created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (object_url(255)),
+				KEY table_column (table_schema, table_name, column_name)
+			);
+		`, g.DtleSchemaName, g.BlobOffloadTable)
+	if _, err := a.db.Exec(query); err != nil {
+		return err
+	}
+	insert := fmt.Sprintf("insert ignore into %v.%v (object_url, job_uuid, table_schema, table_name, column_name, bytes, sha256) "+
+		"values (?, ?, ?, ?, ?, ?, ?)", g.DtleSchemaName, g.BlobOffloadTable)
+	a.blobOffload.record = func(schema, table, column, url string, size int, sum string) error {
+		_, err := a.db.Exec(insert, url, a.subjectUUID.Bytes(), schema, table, column, size, sum)
+		return err
+	}
+	return nil
+}
+
+// matches tells whether the values of a column are offloaded
+func (o *blobOffloader) matches(schema, table, column string) bool {
+	if len(o.cfg.Columns) == 0 {
+		return true
+	}
+	name := fmt.Sprintf("%s.%s.%s", schema, table, column)
+	for _, pattern := range o.cfg.Columns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *blobOffloader) url(key string) string {
+	if o.cfg.URLPrefix != "" {
+		return strings.TrimSuffix(o.cfg.URLPrefix, "/") + "/" + key
+	}
+	return fmt.Sprintf("s3://%s/%s", o.cfg.Bucket, key)
+}
+
+// offloadValues replaces the big values of a row by their URLs. The objects
+// are uploaded for the new values of a row, the old ones were when the row
+// was written.
+func (o *blobOffloader) offloadValues(schema, table string, columns []umconf.Column, values []*interface{}, upload bool) error {
+	for i, v := range values {
+		if i >= len(columns) {
+			break
+		}
+		if v == nil {
+			continue
+		}
+		data, ok := (*v).([]byte)
+		if !ok || len(data) < o.cfg.MinBytes || !o.matches(schema, table, columns[i].Name) {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		hexSum := hex.EncodeToString(sum[:])
+		key := path.Join(o.cfg.Prefix, schema, table, columns[i].Name, hexSum)
+		url := o.url(key)
+		if upload {
+			exists, err := o.store.exists(key)
+			if err != nil {
+				return fmt.Errorf("BlobOffload: checking %v: %v", url, err)
+			}
+			if !exists {
+				if err := o.store.put(key, data); err != nil {
+					return fmt.Errorf("BlobOffload: uploading a value of %s.%s.%s to %v: %v",
+						schema, table, columns[i].Name, url, err)
+				}
+			}
+			if o.record != nil {
+				if err := o.record(schema, table, columns[i].Name, url, len(data), hexSum); err != nil {
+					return err
+				}
+			}
+		}
+		*v = []byte(url)
+	}
+	return nil
+}
+
+// offloadEvent replaces the big values of a DML event
+func (o *blobOffloader) offloadEvent(event *binlog.DataEvent, columns *umconf.ColumnList) error {
+	if event.WhereColumnValues != nil {
+		err := o.offloadValues(event.DatabaseName, event.TableName, columns.ColumnList(),
+			event.WhereColumnValues.GetAbstractValues(), false)
+		if err != nil {
+			return err
+		}
+	}
+	if event.NewColumnValues != nil {
+		return o.offloadValues(event.DatabaseName, event.TableName, columns.ColumnList(),
+			event.NewColumnValues.GetAbstractValues(), true)
+	}
+	return nil
+}
+
+// offloadDumpEntry replaces the big values of a chunk of the full copy, in
+// the order of the columns of the target table
+func (o *blobOffloader) offloadDumpEntry(ctx context.Context, db *gosql.DB, entry *DumpEntry) error {
+	if len(entry.ValuesX) == 0 {
+		return nil
+	}
+	name := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	o.columnsLock.Lock()
+	columns, ok := o.columns[name]
+	o.columnsLock.Unlock()
+	if !ok {
+		var err error
+		if columns, err = base.GetTableColumns(ctx, db, entry.TableSchema, entry.TableName); err != nil {
+			return err
+		}
+		o.columnsLock.Lock()
+		o.columns[name] = columns
+		o.columnsLock.Unlock()
+	}
+	for _, row := range entry.ValuesX {
+		if err := o.offloadValues(entry.TableSchema, entry.TableName, columns.ColumnList(), row, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+type memBlobStore map[string][]byte
+
+func (s memBlobStore) exists(key string) (bool, error) {
+	_, ok := s[key]
+	return ok, nil
+}
+
+func (s memBlobStore) put(key string, data []byte) error {
+	s[key] = data
+	return nil
+}
+
+func TestBlobOffloader(t *testing.T) {
+	store := memBlobStore{}
+	o, err := newBlobOffloader(&config.BlobOffloadConfig{
+		Bucket:   "bucket",
+		Prefix:   "dtle",
+		MinBytes: 1024,
+		Columns:  []string{"db.*.photo"},
+	}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := umconf.NewColumnList([]umconf.Column{{Name: "id"}, {Name: "photo"}, {Name: "doc"}})
+	row := func(id int64, photo, doc *interface{}) *umconf.ColumnValues {
+		v := interface{}(id)
+		return &umconf.ColumnValues{AbstractValues: []*interface{}{&v, photo, doc}}
+	}
+
+	photo, doc := blobValue(2048), blobValue(2048)
+	insert := binlog.NewDataEvent("db", "tb", binlog.InsertDML, 3)
+	insert.NewColumnValues = row(1, photo, doc)
+	if err := o.offloadEvent(&insert, columns); err != nil {
+		t.Fatal(err)
+	}
+	url := string((*photo).([]byte))
+	if !strings.HasPrefix(url, "s3://bucket/dtle/db/tb/photo/") || len(store) != 1 {
+		t.Fatalf("photo = %q, %d objects", url, len(store))
+	}
+	if len((*doc).([]byte)) != 2048 {
+		t.Fatalf("column not matching offloaded")
+	}
+
+	// the old values get the same URL, without uploading them again
+	key := strings.TrimPrefix(url, "s3://bucket/")
+	oldPhoto := interface{}(store[key])
+	delete(store, key)
+	newPhoto := blobValue(100)
+	update := binlog.NewDataEvent("db", "tb", binlog.UpdateDML, 3)
+	update.WhereColumnValues = row(1, &oldPhoto, blobValue(10))
+	update.NewColumnValues = row(1, newPhoto, blobValue(10))
+	if err := o.offloadEvent(&update, columns); err != nil {
+		t.Fatal(err)
+	}
+	if string(oldPhoto.([]byte)) != url || len(store) != 0 {
+		t.Fatalf("old photo = %q, %d objects", oldPhoto, len(store))
+	}
+	if len((*newPhoto).([]byte)) != 100 {
+		t.Fatalf("small value offloaded")
+	}
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// checksumRechecks is how many times a chunk differing on the target is
+	// computed again, checksumRecheckInterval apart, before it is counted:
+	// the target may be behind the source
+	checksumRechecks        = 3
+	checksumRecheckInterval = time.Second
+)
+
+// ChecksumTable compares the checksums of a table on source and target, in
+// chunks of chunkSize rows of the source. Errors are reported in the result.
+func ChecksumTable(ctx context.Context, src, dst *gosql.DB, schema, table string, chunkSize int) *models.TableChecksum {
+	r := &models.TableChecksum{
+		TableSchema: schema,
+		TableName:   table,
+	}
+	columns, err := base.GetTableColumns(ctx, src, schema, table)
+	if err != nil {
+		r.Error = fmt.Sprintf("source: %v", err)
+		return r
+	}
+	if r.ChunkKey, err = getChunkKey(ctx, src, schema, table); err != nil {
+		r.Error = fmt.Sprintf("source: %v", err)
+		return r
+	}
+
+	var lower []interface{}
+	for {
+		// a table without a key is a single chunk
+		var upper []interface{}
+		if len(r.ChunkKey) > 0 {
+			if upper, err = chunkUpperBound(ctx, src, schema, table, r.ChunkKey, lower, chunkSize); err != nil {
+				r.Error = fmt.Sprintf("source: %v", err)
+				return r
+			}
+		}
+		query := buildChunkChecksumQuery(schema, table, columns.Names(), r.ChunkKey, lower != nil, upper != nil)
+		args := append(append([]interface{}{}, lower...), upper...)
+		sourceRows, targetRows, match, err := compareChunk(ctx, src, dst, query, args)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+		r.Chunks++
+		r.SourceRows += sourceRows
+		r.TargetRows += targetRows
+		if !match {
+			r.DiffChunks++
+		}
+		if upper == nil {
+			break
+		}
+		lower = upper
+	}
+	r.Match = r.DiffChunks == 0
+	return r
+}
+
+// compareChunk computes the checksum of a chunk on source and target, again
+// while they differ, up to checksumRechecks times.
+func compareChunk(ctx context.Context, src, dst *gosql.DB, query string, args []interface{}) (
+	sourceRows, targetRows int64, match bool, err error) {
+
+	for i := 0; ; i++ {
+		var sourceSum, targetSum uint64
+		if err := src.QueryRowContext(ctx, query, args...).Scan(&sourceRows, &sourceSum); err != nil {
+			return 0, 0, false, fmt.Errorf("source: %v", err)
+		}
+		if err := dst.QueryRowContext(ctx, query, args...).Scan(&targetRows, &targetSum); err != nil {
+			return 0, 0, false, fmt.Errorf("target: %v", err)
+		}
+		if sourceRows == targetRows && sourceSum == targetSum {
+			return sourceRows, targetRows, true, nil
+		}
+		if i == checksumRechecks {
+			return sourceRows, targetRows, false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, 0, false, ctx.Err()
+		case <-time.After(checksumRecheckInterval):
+		}
+	}
+}
+
+// chunkUpperBound returns the key of the last row of the chunk following
+// lower, or nil if the chunk is the last one of the table.
+func chunkUpperBound(ctx context.Context, db *gosql.DB, schema, table string, key []string,
+	lower []interface{}, chunkSize int) ([]interface{}, error) {
+
+	args := append(append([]interface{}{}, lower...), chunkSize-1)
+	values := make([]interface{}, len(key))
+	dest := make([]interface{}, len(key))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err := db.QueryRowContext(ctx, buildChunkBoundaryQuery(schema, table, key, lower != nil), args...).Scan(dest...)
+	if err == gosql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// getChunkKey returns the columns of the primary key of a table, or else of
+// its first unique key without nullable columns. It is nil if the table has
+// none.
+func getChunkKey(ctx context.Context, db *gosql.DB, schema, table string) ([]string, error) {
+	// a column missing from COLUMNS is a functional key part
+	query := `select s.INDEX_NAME, ifnull(s.COLUMN_NAME, ''), ifnull(c.IS_NULLABLE, 'YES')
+		from information_schema.STATISTICS s left join information_schema.COLUMNS c
+		on c.TABLE_SCHEMA = s.TABLE_SCHEMA and c.TABLE_NAME = s.TABLE_NAME and c.COLUMN_NAME = s.COLUMN_NAME
+		where s.TABLE_SCHEMA = ? and s.TABLE_NAME = ? and s.NON_UNIQUE = 0
+		order by s.INDEX_NAME = 'PRIMARY' desc, s.INDEX_NAME, s.SEQ_IN_INDEX`
+	rows, err := db.QueryContext(ctx, query, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []string
+	keys := make(map[string][]string)
+	nullable := make(map[string]bool)
+	for rows.Next() {
+		var index, column, isNullable string
+		if err := rows.Scan(&index, &column, &isNullable); err != nil {
+			return nil, err
+		}
+		if _, ok := keys[index]; !ok {
+			indexes = append(indexes, index)
+		}
+		keys[index] = append(keys[index], column)
+		nullable[index] = nullable[index] || isNullable == "YES"
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		if !nullable[index] {
+			return keys[index], nil
+		}
+	}
+	return nil, nil
+}
+
+// chunkRangeCondition selects the rows of a chunk: after a lower bound and
+// up to an upper bound included, whose values are the args
+func chunkRangeCondition(key []string, lower, upper bool) string {
+	escaped := make([]string, len(key))
+	placeholders := make([]string, len(key))
+	for i, column := range key {
+		escaped[i] = sql.EscapeName(column)
+		placeholders[i] = "?"
+	}
+	row := fmt.Sprintf("(%s)", strings.Join(escaped, ", "))
+	values := fmt.Sprintf("(%s)", strings.Join(placeholders, ", "))
+
+	var conds []string
+	if lower {
+		conds = append(conds, fmt.Sprintf("%s > %s", row, values))
+	}
+	if upper {
+		conds = append(conds, fmt.Sprintf("%s <= %s", row, values))
+	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return " where " + strings.Join(conds, " and ")
+}
+
+// buildChunkBoundaryQuery selects the key of the row at the offset given by
+// the last arg, after the lower bound if any.
+func buildChunkBoundaryQuery(schema, table string, key []string, lower bool) string {
+	escaped := make([]string, len(key))
+	for i, column := range key {
+		escaped[i] = sql.EscapeName(column)
+	}
+	columns := strings.Join(escaped, ", ")
+	return fmt.Sprintf("select %s from %s.%s%s order by %s limit ?, 1", columns,
+		sql.EscapeName(schema), sql.EscapeName(table), chunkRangeCondition(key, lower, false), columns)
+}
+
+// buildChunkChecksumQuery counts the rows of a chunk, and XORs the CRC32 of
+// each row, as pt-table-checksum does. The row ends with the NULL flags of
+// its columns, which CONCAT_WS skips.
+func buildChunkChecksumQuery(schema, table string, columns, key []string, lower, upper bool) string {
+	escaped := make([]string, len(columns))
+	isNull := make([]string, len(columns))
+	for i, column := range columns {
+		escaped[i] = sql.EscapeName(column)
+		isNull[i] = fmt.Sprintf("isnull(%s)", escaped[i])
+	}
+	return fmt.Sprintf("select count(*), coalesce(bit_xor(crc32(concat_ws('#', %s, concat(%s)))), 0) from %s.%s%s",
+		strings.Join(escaped, ", "), strings.Join(isNull, ", "),
+		sql.EscapeName(schema), sql.EscapeName(table), chunkRangeCondition(key, lower, upper))
+}
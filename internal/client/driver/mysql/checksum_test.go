@@ -0,0 +1,31 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestBuildChunkChecksumQuery(t *testing.T) {
+	test.S(t).ExpectEquals(buildChunkChecksumQuery("db1", "tb1", []string{"id", "a"}, nil, false, false),
+		"select count(*), coalesce(bit_xor(crc32(concat_ws('#', `id`, `a`, concat(isnull(`id`), isnull(`a`))))), 0) "+
+			"from `db1`.`tb1`")
+	test.S(t).ExpectEquals(buildChunkChecksumQuery("db1", "tb1", []string{"id", "a"}, []string{"id"}, false, true),
+		"select count(*), coalesce(bit_xor(crc32(concat_ws('#', `id`, `a`, concat(isnull(`id`), isnull(`a`))))), 0) "+
+			"from `db1`.`tb1` where (`id`) <= (?)")
+	test.S(t).ExpectEquals(chunkRangeCondition([]string{"a", "b"}, true, true),
+		" where (`a`, `b`) > (?, ?) and (`a`, `b`) <= (?, ?)")
+}
+
+func TestBuildChunkBoundaryQuery(t *testing.T) {
+	test.S(t).ExpectEquals(buildChunkBoundaryQuery("db1", "tb1", []string{"a", "b"}, false),
+		"select `a`, `b` from `db1`.`tb1` order by `a`, `b` limit ?, 1")
+	test.S(t).ExpectEquals(buildChunkBoundaryQuery("db1", "tb1", []string{"id"}, true),
+		"select `id` from `db1`.`tb1` where (`id`) > (?) order by `id` limit ?, 1")
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	gonats "github.com/nats-io/go-nats"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// chunkFrameID follows codecFrameMagic in a chunk of a message larger than
+// the max payload of NATS, e.g. for a row with a big BLOB. It is out of the
+// ids of the codecs, so that a chunk is never decoded as a message.
+const chunkFrameID = 0x7f
+
+// A chunk is codecFrameMagic, chunkFrameID, the id of its message, its index
+// and the number of chunks of the message, then its part of the message.
+const chunkHeaderLen = 4 + 1 + 8 + 4 + 4
+
+// splitMsg cuts a message into chunks of at most size bytes. A message which
+// fits is sent as is.
+func splitMsg(id uint64, msg []byte, size int) ([][]byte, error) {
+	if len(msg) <= size {
+		return [][]byte{msg}, nil
+	}
+	part := size - chunkHeaderLen
+	if part <= 0 {
+		return nil, fmt.Errorf("the max payload %d cannot hold a chunk", size)
+	}
+	count := (len(msg) + part - 1) / part
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * part
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk := make([]byte, chunkHeaderLen, chunkHeaderLen+end-i*part)
+		copy(chunk, codecFrameMagic)
+		chunk[4] = chunkFrameID
+		binary.BigEndian.PutUint64(chunk[5:], id)
+		binary.BigEndian.PutUint32(chunk[13:], uint32(i))
+		binary.BigEndian.PutUint32(chunk[17:], uint32(count))
+		chunks = append(chunks, append(chunk, msg[i*part:end]...))
+	}
+	return chunks, nil
+}
+
+// chunkedMsgExpiry is how long the chunks of an incomplete message are kept
+// without receiving any other, e.g. after the extractor stopped
+const chunkedMsgExpiry = 10 * DefaultConnectWait
+
+// chunkedMsg is a message being received in chunks
+type chunkedMsg struct {
+	parts    [][]byte
+	received int
+	updated  time.Time
+}
+
+type chunkedMsgKey struct {
+	subject string
+	id      uint64
+}
+
+// ChunkAssembler reassembles the messages received in chunks. The extractor
+// sends the chunks of a message one after the other, and all of them again
+// if the message is not acked, so that a message dropped once complete is
+// assembled again.
+type ChunkAssembler struct {
+	mu   sync.Mutex
+	msgs map[chunkedMsgKey]*chunkedMsg
+}
+
+func NewChunkAssembler() *ChunkAssembler {
+	return &ChunkAssembler{msgs: make(map[chunkedMsgKey]*chunkedMsg)}
+}
+
+// add returns the message of data, reassembled if data completes it. It
+// returns false for a chunk of a message not complete yet.
+func (c *ChunkAssembler) add(subject string, data []byte) ([]byte, bool, error) {
+	if !isChunk(data) {
+		return data, true, nil
+	}
+	key := chunkedMsgKey{subject: subject, id: binary.BigEndian.Uint64(data[5:])}
+	index := int(binary.BigEndian.Uint32(data[13:]))
+	count := int(binary.BigEndian.Uint32(data[17:]))
+	if index >= count {
+		return nil, false, fmt.Errorf("bad chunk %d/%d of a message of %v", index, count, subject)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, msg := range c.msgs {
+		if now.Sub(msg.updated) > chunkedMsgExpiry {
+			delete(c.msgs, k)
+		}
+	}
+	msg := c.msgs[key]
+	if msg == nil {
+		msg = &chunkedMsg{parts: make([][]byte, count)}
+		c.msgs[key] = msg
+	} else if count != len(msg.parts) {
+		return nil, false, fmt.Errorf("chunk %d of message %d of %v counts %d chunks, not %d",
+			index, key.id, subject, count, len(msg.parts))
+	}
+	msg.updated = now
+	if msg.parts[index] == nil {
+		msg.received++
+	}
+	msg.parts[index] = append([]byte(nil), data[chunkHeaderLen:]...)
+	if msg.received < count {
+		return nil, false, nil
+	}
+	delete(c.msgs, key)
+	return bytes.Join(msg.parts, nil), true, nil
+}
+
+// Assemble replaces a chunk of m with its message once all its chunks are
+// received, for the drivers other than the applier receiving the messages of
+// an extractor. A chunk of a message not complete yet is acked, and false is
+// returned for it not to be handled.
+func (c *ChunkAssembler) Assemble(natsConn *gonats.Conn, m *gonats.Msg) (bool, error) {
+	data, complete, err := c.add(m.Subject, m.Data)
+	if err != nil || complete {
+		m.Data = data
+		return complete, err
+	}
+	return false, natsConn.Publish(m.Reply, nil)
+}
+
+func isChunk(data []byte) bool {
+	return len(data) >= chunkHeaderLen && bytes.HasPrefix(data, codecFrameMagic) && data[4] == chunkFrameID
+}
+
+// assembleMsg replaces a chunk of a message with the message once all its
+// chunks are received. An incomplete message is not handled, its chunks are
+// acked unless the applier is a standby, which only listens.
+func (a *Applier) assembleMsg(m *gonats.Msg) (bool, error) {
+	data, complete, err := a.chunks.add(m.Subject, m.Data)
+	if err != nil || complete {
+		m.Data = data
+		return complete, err
+	}
+	if a.standby == nil || a.standby.isActive() {
+		if err := a.natsConn.Publish(m.Reply, nil); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// checkRowSize fails a row larger than max bytes, counting its values
+func checkRowSize(schema, table string, values []*interface{}, max int64) error {
+	var size int64
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		switch v := (*v).(type) {
+		case []byte:
+			size += int64(len(v))
+		case string:
+			size += int64(len(v))
+		}
+	}
+	if size > max {
+		return fmt.Errorf("a row of %s.%s is %d bytes, larger than MaxRowSizeMB (%d MB)",
+			schema, table, size, max>>20)
+	}
+	return nil
+}
+
+// checkEntriesRowSize checks the rows of the events of binlog entries
+func checkEntriesRowSize(entries []*binlog.BinlogEntry, max int64) error {
+	for _, entry := range entries {
+		for _, event := range entry.Events {
+			for _, values := range []*umconf.ColumnValues{event.WhereColumnValues, event.NewColumnValues} {
+				if values == nil {
+					continue
+				}
+				if err := checkRowSize(event.DatabaseName, event.TableName, values.GetAbstractValues(), max); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkDumpRowSize checks the rows of a chunk of the full copy
+func checkDumpRowSize(entry *DumpEntry, max int64) error {
+	for _, row := range entry.ValuesX {
+		if err := checkRowSize(entry.TableSchema, entry.TableName, row, max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Extractor) maxRowSize() int64 {
+	return int64(e.mysqlContext.MaxRowSizeMB) << 20
+}
@@ -0,0 +1,28 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+)
+
+func TestDynamicChunkSize(t *testing.T) {
+	tests := []struct {
+		targetBytes, avgRowLength, want int64
+	}{
+		{0, 100, 2000},
+		{1 << 20, 0, 2000},
+		{1 << 20, 100, 10485},
+		{1 << 20, 1 << 20, minDynamicChunkSize},
+		{1 << 30, 10, maxDynamicChunkSize},
+	}
+	for _, tt := range tests {
+		if got := dynamicChunkSize(tt.targetBytes, tt.avgRowLength, 2000); got != tt.want {
+			t.Errorf("dynamicChunkSize(%v, %v) = %v, want %v", tt.targetBytes, tt.avgRowLength, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	gnatsd "github.com/nats-io/gnatsd/server"
+	gonats "github.com/nats-io/go-nats"
+)
+
+func TestChunkAssembler(t *testing.T) {
+	msg, err := Encode(&DumpEntry{TableName: "t", ValuesX: [][]*interface{}{{blobValue(100000)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := []byte("small")
+	chunks, err := splitMsg(1, small, 1024)
+	if err != nil || len(chunks) != 1 || !bytes.Equal(chunks[0], small) {
+		t.Fatalf("a message which fits is chunked: %v, %v", chunks, err)
+	}
+
+	chunks, err = splitMsg(1, msg, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if len(chunk) > 1024 {
+			t.Fatalf("chunk of %d bytes", len(chunk))
+		}
+	}
+
+	c := NewChunkAssembler()
+	// a chunk sent again and a message of another subject in between
+	for i, chunk := range chunks {
+		data, complete, err := c.add("job_full", chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			if _, complete, _ := c.add("job_full", chunk); complete {
+				t.Fatalf("message complete with a chunk sent again")
+			}
+			if data, complete, _ := c.add("job_incr_hete", small); !complete || !bytes.Equal(data, small) {
+				t.Fatalf("message not chunked not passed through")
+			}
+		}
+		if complete != (i == len(chunks)-1) {
+			t.Fatalf("chunk %d: complete = %v", i, complete)
+		}
+		if complete {
+			var entry DumpEntry
+			if err := Decode(data, &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.TableName != "t" || len((*entry.ValuesX[0][0]).([]byte)) != 100000 {
+				t.Fatalf("message not reassembled")
+			}
+		}
+	}
+
+	// the message is assembled again when all its chunks are sent again
+	for i, chunk := range chunks {
+		if _, complete, err := c.add("job_full", chunk); err != nil || complete != (i == len(chunks)-1) {
+			t.Fatalf("chunk %d sent again: complete = %v, %v", i, complete, err)
+		}
+	}
+	if len(c.msgs) != 0 {
+		t.Fatalf("%d messages left", len(c.msgs))
+	}
+}
+
+func TestCheckRowSize(t *testing.T) {
+	var null interface{}
+	id := interface{}(int64(1))
+	row := []*interface{}{&id, &null, blobValue(2048)}
+	if err := checkRowSize("db", "tb", row, 4096); err != nil {
+		t.Fatal(err)
+	}
+	err := checkDumpRowSize(&DumpEntry{TableSchema: "db", TableName: "tb", ValuesX: [][]*interface{}{row}}, 1024)
+	if err == nil || !strings.Contains(err.Error(), "db.tb") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func blobValue(n int) *interface{} {
+	b := make([]byte, n)
+	rand.Read(b)
+	v := interface{}(b)
+	return &v
+}
+
+func TestChunkAssembler_Assemble(t *testing.T) {
+	ns := gnatsd.New(&gnatsd.Options{Host: "127.0.0.1", Port: gnatsd.RANDOM_PORT, NoLog: true, NoSigs: true})
+	go ns.Start()
+	defer ns.Shutdown()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server not started")
+	}
+	nc, err := gonats.Connect(fmt.Sprintf("nats://%s", ns.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	// a sink handles the message once its chunks are acked
+	c := NewChunkAssembler()
+	received := make(chan []byte, 1)
+	_, err = nc.Subscribe("job_full", func(m *gonats.Msg) {
+		if complete, err := c.Assemble(nc, m); !complete {
+			if err != nil {
+				t.Error(err)
+			}
+			return
+		}
+		received <- m.Data
+		nc.Publish(m.Reply, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := bytes.Repeat([]byte("x"), 5000)
+	chunks, err := splitMsg(1, msg, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, chunk := range chunks {
+		if _, err := nc.Request("job_full", chunk, 5*time.Second); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+	}
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, msg) {
+			t.Fatalf("message not reassembled: %d bytes", len(data))
+		}
+	default:
+		t.Fatalf("message not handled")
+	}
+}
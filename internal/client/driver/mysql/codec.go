@@ -0,0 +1,270 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	gonats "github.com/nats-io/go-nats"
+	"github.com/pierrec/lz4"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// codecProtocolVersion is the version of the framing of the messages told by
+// an applier in the negotiation. An applier of an older version does not
+// answer it, and gets messages compressed with snappy without a frame.
+const codecProtocolVersion = 1
+
+const (
+	// how long the extractor waits for the applier to answer the negotiation
+	// before falling back to snappy
+	codecNegotiationTimeout = 2 * DefaultConnectWait
+	codecNegotiationRetry   = DefaultConnectWait / 5
+)
+
+// codecFrameMagic heads a message compressed by a negotiated codec, followed
+// by the id of the codec. No snappy block starts with it, as its length
+// would not fit in 32 bits, so that the messages of older extractors are
+// still told apart.
+var codecFrameMagic = []byte{0xff, 0xff, 0xff, 0xff}
+
+// transportCodec compresses the messages between the extractor and the
+// applier. A codec is added by implementing it and registering it in
+// transportCodecs.
+type transportCodec interface {
+	compress(src []byte) ([]byte, error)
+	decompress(src []byte) ([]byte, error)
+}
+
+type registeredCodec struct {
+	// id is the byte after codecFrameMagic. It must stay in 0x10-0x7f, not
+	// to be the end of a snappy length.
+	id    byte
+	name  string
+	codec transportCodec
+}
+
+var transportCodecs = []registeredCodec{
+	{0x10, config.TransportCodecNone, noneCodec{}},
+	{0x11, config.TransportCodecSnappy, snappyCodec{}},
+	{0x12, config.TransportCodecLZ4, lz4Codec{}},
+}
+
+func codecByName(name string) (registeredCodec, bool) {
+	for _, c := range transportCodecs {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return registeredCodec{}, false
+}
+
+func codecByID(id byte) (registeredCodec, bool) {
+	for _, c := range transportCodecs {
+		if c.id == id {
+			return c, true
+		}
+	}
+	return registeredCodec{}, false
+}
+
+// validateTransportCodec checks the TransportCodec of a job
+func validateTransportCodec(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := codecByName(name); ok {
+		return nil
+	}
+	if name == config.TransportCodecZstd {
+		// no zstd implementation is vendored yet
+		return fmt.Errorf("TransportCodec %q is not built in this version, use %q or %q",
+			name, config.TransportCodecLZ4, config.TransportCodecSnappy)
+	}
+	var names []string
+	for _, c := range transportCodecs {
+		names = append(names, c.name)
+	}
+	return fmt.Errorf("unknown TransportCodec %q, must be one of %v", name, names)
+}
+
+type noneCodec struct{}
+
+func (noneCodec) compress(src []byte) ([]byte, error)   { return src, nil }
+func (noneCodec) decompress(src []byte) ([]byte, error) { return src, nil }
+
+type snappyCodec struct{}
+
+func (snappyCodec) compress(src []byte) ([]byte, error)   { return snappy.Encode(nil, src), nil }
+func (snappyCodec) decompress(src []byte) ([]byte, error) { return snappy.Decode(nil, src) }
+
+type lz4Codec struct{}
+
+func (lz4Codec) compress(src []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := lz4.NewWriter(&b)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (lz4Codec) decompress(src []byte) ([]byte, error) {
+	return ioutil.ReadAll(lz4.NewReader(bytes.NewReader(src)))
+}
+
+// codecStats measures the compression of the messages of a task
+type codecStats struct {
+	uncompressedBytes int64
+	compressedBytes   int64
+	nanos             int64
+	// the name of the codec of the last message
+	codec atomic.Value
+}
+
+func (s *codecStats) add(codec string, uncompressed, compressed int, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.codec.Store(codec)
+	atomic.AddInt64(&s.uncompressedBytes, int64(uncompressed))
+	atomic.AddInt64(&s.compressedBytes, int64(compressed))
+	atomic.AddInt64(&s.nanos, int64(time.Since(start)))
+}
+
+func (s *codecStats) trafficStat(stat *models.TrafficStat) {
+	stat.Codec, _ = s.codec.Load().(string)
+	stat.UncompressedBytes = atomic.LoadInt64(&s.uncompressedBytes)
+	stat.CompressedBytes = atomic.LoadInt64(&s.compressedBytes)
+	stat.CodecNanos = atomic.LoadInt64(&s.nanos)
+}
+
+// encodeWith encodes v with gob, and compresses it with codec, or with
+// snappy without a frame if codec is nil.
+func encodeWith(v interface{}, codec *registeredCodec, stats *codecStats) ([]byte, error) {
+	b := new(bytes.Buffer)
+	if err := gob.NewEncoder(b).Encode(v); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if codec == nil {
+		msg := snappy.Encode(nil, b.Bytes())
+		stats.add(config.TransportCodecSnappy, b.Len(), len(msg), start)
+		return msg, nil
+	}
+	compressed, err := codec.codec.compress(b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, 0, len(codecFrameMagic)+1+len(compressed))
+	msg = append(msg, codecFrameMagic...)
+	msg = append(msg, codec.id)
+	msg = append(msg, compressed...)
+	stats.add(codec.name, b.Len(), len(msg), start)
+	return msg, nil
+}
+
+// decodeWith decompresses a message of any codec, and decodes it into vPtr
+func decodeWith(data []byte, vPtr interface{}, stats *codecStats) (err error) {
+	start := time.Now()
+	var msg []byte
+	name := config.TransportCodecSnappy
+	if bytes.HasPrefix(data, codecFrameMagic) && len(data) > len(codecFrameMagic) {
+		id := data[len(codecFrameMagic)]
+		codec, ok := codecByID(id)
+		if !ok {
+			return fmt.Errorf("message compressed by an unknown codec %#x", id)
+		}
+		name = codec.name
+		msg, err = codec.codec.decompress(data[len(codecFrameMagic)+1:])
+	} else {
+		msg, err = snappy.Decode(nil, data)
+	}
+	if err != nil {
+		return err
+	}
+	stats.add(name, len(msg), len(data), start)
+	return gob.NewDecoder(bytes.NewBuffer(msg)).Decode(vPtr)
+}
+
+// codecOffer is the answer of an applier to the negotiation of the codec
+type codecOffer struct {
+	Version int
+	Codecs  []string
+}
+
+// answerCodecNegotiation tells the extractor the codecs the applier decodes
+func (a *Applier) answerCodecNegotiation() error {
+	offer := codecOffer{Version: codecProtocolVersion}
+	for _, c := range transportCodecs {
+		offer.Codecs = append(offer.Codecs, c.name)
+	}
+	data, err := json.Marshal(&offer)
+	if err != nil {
+		return err
+	}
+	_, err = a.natsConn.Subscribe(fmt.Sprintf("%s_codecs", a.subject), func(m *gonats.Msg) {
+		if err := a.natsConn.Publish(m.Reply, data); err != nil {
+			a.logger.Warnf("mysql.applier: cannot answer the codec negotiation: %v", err)
+		}
+	})
+	return err
+}
+
+// negotiateCodec chooses the codec of the messages, the TransportCodec of
+// the job if the applier decodes it. Without TransportCodec, the messages
+// are compressed by snappy without a frame, as by older versions, so that
+// any applier decodes them.
+func (e *Extractor) negotiateCodec() {
+	name := e.mysqlContext.TransportCodec
+	if name == "" {
+		return
+	}
+	codec, _ := codecByName(name)
+
+	subject := fmt.Sprintf("%s_codecs", e.subject)
+	deadline := time.Now().Add(codecNegotiationTimeout)
+	for {
+		msg, err := e.natsConn.Request(subject, nil, codecNegotiationRetry)
+		if err == nil {
+			var offer codecOffer
+			if err := json.Unmarshal(msg.Data, &offer); err != nil {
+				e.logger.Warnf("mysql.extractor: bad answer to the codec negotiation: %v. using snappy", err)
+				return
+			}
+			for _, c := range offer.Codecs {
+				if c == name {
+					e.logger.Printf("mysql.extractor: compressing the messages with %v (applier protocol %d)", name, offer.Version)
+					e.codec = &codec
+					return
+				}
+			}
+			e.logger.Warnf("mysql.extractor: the applier does not decode %v, only %v. using snappy", name, offer.Codecs)
+			return
+		}
+		if err != gonats.ErrTimeout || time.Now().After(deadline) {
+			e.logger.Warnf("mysql.extractor: the applier does not answer the codec negotiation (%v), "+
+				"it may be of an older version. using snappy", err)
+			return
+		}
+		if e.shutdown {
+			return
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestTransportCodecs(t *testing.T) {
+	entry := &DumpEntry{TableSchema: "db1", TableName: "tb1", TotalCount: 2,
+		DbSQL: strings.Repeat("create table tb1 (id int);", 100)}
+
+	for _, c := range transportCodecs {
+		codec := c
+		var stats codecStats
+		msg, err := encodeWith(entry, &codec, &stats)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(bytes.HasPrefix(msg, codecFrameMagic))
+
+		var decoded DumpEntry
+		test.S(t).ExpectNil(decodeWith(msg, &decoded, &stats))
+		test.S(t).ExpectEquals(decoded.TableName, entry.TableName)
+		test.S(t).ExpectEquals(decoded.DbSQL, entry.DbSQL)
+
+		var stat models.TrafficStat
+		stats.trafficStat(&stat)
+		test.S(t).ExpectEquals(stat.Codec, c.name)
+		test.S(t).ExpectEquals(stat.CompressedBytes, int64(2*len(msg)))
+	}
+
+	// the messages of the versions without negotiation
+	msg, err := Encode(entry)
+	test.S(t).ExpectNil(err)
+	var decoded DumpEntry
+	test.S(t).ExpectNil(Decode(msg, &decoded))
+	test.S(t).ExpectEquals(decoded.DbSQL, entry.DbSQL)
+
+	unknown := append(append([]byte{}, codecFrameMagic...), 0x7f)
+	test.S(t).ExpectNotNil(Decode(unknown, &decoded))
+}
+
+func TestValidateTransportCodec(t *testing.T) {
+	test.S(t).ExpectNil(validateTransportCodec(""))
+	test.S(t).ExpectNil(validateTransportCodec(config.TransportCodecLZ4))
+	err := validateTransportCodec(config.TransportCodecZstd)
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(strings.Contains(err.Error(), "not built in"))
+	test.S(t).ExpectNotNil(validateTransportCodec("gzip"))
+}
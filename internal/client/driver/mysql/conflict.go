@@ -0,0 +1,357 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	gosql "database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/g"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	conflictApplied = "applied"
+	conflictSkipped = "skipped"
+)
+
+// conflictPolicy returns the policy of a table, a policy for the table
+// having precedence over one for the whole schema.
+func (a *Applier) conflictPolicy(schema, table string) *config.ConflictPolicy {
+	var result *config.ConflictPolicy
+	for _, p := range a.mysqlContext.ConflictPolicies {
+		if p.TableSchema != schema {
+			continue
+		}
+		if p.TableName == table {
+			return p
+		}
+		if p.TableName == "" {
+			result = p
+		}
+	}
+	return result
+}
+
+func (a *Applier) createConflictTables() error {
+	query := fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %v.%v (
+				id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+				job_uuid binary(16) NOT NULL COMMENT 'unique identifier of job',
+				gtid varchar(64) NOT NULL,
+				table_schema varchar(64) NOT NULL,
+				table_name varchar(64) NOT NULL,
+				pk_value text NOT NULL COMMENT 'primary key values, as a json array',
+				dml varchar(16) NOT NULL,
+				policy varchar(16) NOT NULL,
+				resolution varchar(16) NOT NULL COMMENT 'whether the incoming change is applied or skipped',
+				incoming text,
+				existing text,
+				created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				KEY job_uuid (job_uuid, id)
+			);
+		`, g.DtleSchemaName, g.ConflictLogTable)
+	if _, err := a.db.Exec(query); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %v.%v (
+				table_schema varchar(64) NOT NULL,
+				table_name varchar(64) NOT NULL,
+				pk_hash binary(32) NOT NULL COMMENT 'sha256 of pk_value',
+				pk_value text NOT NULL COMMENT 'primary key values, as a json array',
+				job_uuid binary(16) NOT NULL COMMENT 'job which last wrote the row',
+				priority int NOT NULL,
+				PRIMARY KEY (table_schema, table_name, pk_hash)
+			);
+		`, g.DtleSchemaName, g.RowOwnerTable)
+	_, err := a.db.Exec(query)
+	return err
+}
+
+// resolveConflict checks a dml event against the current target row, and
+// tells if the event should be applied. Conflicts are recorded in conflict_log.
+func (a *Applier) resolveConflict(tx *gosql.Tx, policy *config.ConflictPolicy, event *binlog.DataEvent,
+	gtid string) (bool, error) {
+
+	columns := event.TableItem.(*applierTableItem).columns
+	var oldValues, newValues []*interface{}
+	switch event.DML {
+	case binlog.InsertDML:
+		newValues = event.NewColumnValues.GetAbstractValues()
+	case binlog.UpdateDML:
+		oldValues = event.WhereColumnValues.GetAbstractValues()
+		newValues = event.NewColumnValues.GetAbstractValues()
+	case binlog.DeleteDML:
+		oldValues = event.WhereColumnValues.GetAbstractValues()
+	}
+
+	c := &conflictContext{
+		policy: policy,
+		event:  event,
+		gtid:   gtid,
+	}
+	var keyArgs []interface{}
+	if oldValues != nil {
+		c.pkColumns, keyArgs, c.oldKey = conflictKey(columns, oldValues)
+	}
+	if newValues != nil {
+		var newArgs []interface{}
+		c.pkColumns, newArgs, c.newKey = conflictKey(columns, newValues)
+		if keyArgs == nil {
+			keyArgs = newArgs
+		}
+	}
+	if len(c.pkColumns) == 0 {
+		a.logger.Warnf("mysql.applier: conflict policy on %v.%v without primary key is ignored",
+			event.DatabaseName, event.TableName)
+		return true, nil
+	}
+
+	if policy.Policy == config.ConflictPolicyPriority {
+		return a.resolveByPriority(tx, c)
+	}
+	return a.resolveByColumn(tx, c, columns, keyArgs, oldValues, newValues)
+}
+
+type conflictContext struct {
+	policy    *config.ConflictPolicy
+	event     *binlog.DataEvent
+	gtid      string
+	pkColumns []string
+	// json of the primary key values before and after the change
+	oldKey string
+	newKey string
+}
+
+func (c *conflictContext) key() string {
+	if c.oldKey != "" {
+		return c.oldKey
+	}
+	return c.newKey
+}
+
+// pkHash is the key of a row in row_owner, for primary keys of any length
+func pkHash(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// resolveByPriority keeps the rows written by a source of a higher priority.
+func (a *Applier) resolveByPriority(tx *gosql.Tx, c *conflictContext) (bool, error) {
+	query := fmt.Sprintf("select job_uuid, priority from %v.%v where table_schema = ? and table_name = ? and pk_hash = ? for update",
+		g.DtleSchemaName, g.RowOwnerTable)
+	var owner []byte
+	var priority int
+	err := tx.QueryRow(query, c.event.DatabaseName, c.event.TableName, pkHash(c.key())).Scan(&owner, &priority)
+	if err != nil && err != gosql.ErrNoRows {
+		return false, err
+	}
+	if err == nil && !bytes.Equal(owner, a.subjectUUID.Bytes()) {
+		ownerID, _ := uuid.FromBytes(owner)
+		incoming := fmt.Sprintf("priority %d", c.policy.Priority)
+		existing := fmt.Sprintf("priority %d, job %v", priority, ownerID)
+		if priority > c.policy.Priority {
+			return false, a.logConflict(tx, c, conflictSkipped, incoming, existing)
+		}
+		if err := a.logConflict(tx, c, conflictApplied, incoming, existing); err != nil {
+			return false, err
+		}
+	}
+
+	if c.oldKey != "" && c.oldKey != c.newKey {
+		query = fmt.Sprintf("delete from %v.%v where table_schema = ? and table_name = ? and pk_hash = ?",
+			g.DtleSchemaName, g.RowOwnerTable)
+		if _, err := tx.Exec(query, c.event.DatabaseName, c.event.TableName, pkHash(c.oldKey)); err != nil {
+			return false, err
+		}
+	}
+	if c.newKey != "" {
+		query = fmt.Sprintf("replace into %v.%v (table_schema, table_name, pk_hash, pk_value, job_uuid, priority) "+
+			"values (?, ?, ?, ?, ?, ?)", g.DtleSchemaName, g.RowOwnerTable)
+		if _, err := tx.Exec(query, c.event.DatabaseName, c.event.TableName, pkHash(c.newKey), c.newKey,
+			a.subjectUUID.Bytes(), c.policy.Priority); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// resolveByColumn compares the policy column of the incoming and the existing row.
+// There is a conflict if the target row exists for an insert, or if its value
+// differs from the before image for an update or a delete.
+func (a *Applier) resolveByColumn(tx *gosql.Tx, c *conflictContext, columns *umconf.ColumnList,
+	keyArgs []interface{}, oldValues, newValues []*interface{}) (bool, error) {
+
+	column := c.policy.TimestampColumn
+	if c.policy.Policy == config.ConflictPolicyPrecedence {
+		column = c.policy.PrecedenceColumn
+	}
+	ordinal, ok := columns.Ordinals[column]
+	if !ok {
+		return false, fmt.Errorf("conflict policy column %v not found in %v.%v",
+			column, c.event.DatabaseName, c.event.TableName)
+	}
+
+	var comparisons []string
+	for _, pk := range c.pkColumns {
+		comparisons = append(comparisons, fmt.Sprintf("%s = ?", sql.EscapeName(pk)))
+	}
+	query := fmt.Sprintf("select %s from %s.%s where %s for update", sql.EscapeName(column),
+		sql.EscapeName(c.event.DatabaseName), sql.EscapeName(c.event.TableName), strings.Join(comparisons, " and "))
+	var existing gosql.NullString
+	err := tx.QueryRow(query, keyArgs...).Scan(&existing)
+	if err == gosql.ErrNoRows {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var incoming gosql.NullString
+	if oldValues != nil {
+		before := conflictNullString(*oldValues[ordinal])
+		if before == existing {
+			return true, nil
+		}
+		incoming = before
+	}
+	if newValues != nil {
+		incoming = conflictNullString(*newValues[ordinal])
+	}
+
+	var wins bool
+	if c.policy.Policy == config.ConflictPolicyPrecedence {
+		wins = precedenceRank(c.policy.PrecedenceValues, incoming) <= precedenceRank(c.policy.PrecedenceValues, existing)
+	} else {
+		wins = compareConflictValues(incoming, existing) >= 0
+	}
+
+	resolution := conflictSkipped
+	if wins {
+		resolution = conflictApplied
+	}
+	return wins, a.logConflict(tx, c, resolution, incoming.String, existing.String)
+}
+
+func (a *Applier) logConflict(tx *gosql.Tx, c *conflictContext, resolution, incoming, existing string) error {
+	a.logger.Warnf("mysql.applier: conflict on %v.%v %v, gtid: %v, %v: %v. incoming: %v, existing: %v",
+		c.event.DatabaseName, c.event.TableName, c.key(), c.gtid, c.policy.Policy, resolution, incoming, existing)
+	query := fmt.Sprintf("insert into %v.%v (job_uuid, gtid, table_schema, table_name, pk_value, dml, policy, resolution, incoming, existing) "+
+		"values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", g.DtleSchemaName, g.ConflictLogTable)
+	_, err := tx.Exec(query, a.subjectUUID.Bytes(), c.gtid, c.event.DatabaseName, c.event.TableName, c.key(),
+		string(c.event.DML), c.policy.Policy, resolution, incoming, existing)
+	return err
+}
+
+// conflictKey returns the primary key columns of a row, their values as
+// query args, and the values as a json array.
+func conflictKey(columns *umconf.ColumnList, values []*interface{}) (names []string, args []interface{}, key string) {
+	var keyValues []string
+	for _, column := range columns.ColumnList() {
+		if !column.IsPk() {
+			continue
+		}
+		value := *values[columns.Ordinals[column.Name]]
+		names = append(names, column.Name)
+		args = append(args, value)
+		keyValues = append(keyValues, conflictNullString(value).String)
+	}
+	if len(names) == 0 {
+		return nil, nil, ""
+	}
+	bs, _ := json.Marshal(keyValues)
+	return names, args, string(bs)
+}
+
+func conflictNullString(value interface{}) gosql.NullString {
+	switch v := value.(type) {
+	case nil:
+		return gosql.NullString{}
+	case []byte:
+		return gosql.NullString{String: string(v), Valid: true}
+	default:
+		return gosql.NullString{String: fmt.Sprintf("%v", v), Valid: true}
+	}
+}
+
+// compareConflictValues compares numbers numerically and other values (e.g.
+// datetime) as strings. NULL is the smallest.
+func compareConflictValues(x, y gosql.NullString) int {
+	switch {
+	case !x.Valid && !y.Valid:
+		return 0
+	case !x.Valid:
+		return -1
+	case !y.Valid:
+		return 1
+	}
+	fx, errX := strconv.ParseFloat(x.String, 64)
+	fy, errY := strconv.ParseFloat(y.String, 64)
+	if errX == nil && errY == nil {
+		switch {
+		case fx < fy:
+			return -1
+		case fx > fy:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(x.String, y.String)
+}
+
+// precedenceRank is the index of value in values. Unlisted values and NULL come last.
+func precedenceRank(values []string, value gosql.NullString) int {
+	if value.Valid {
+		for i, v := range values {
+			if v == value.String {
+				return i
+			}
+		}
+	}
+	return len(values)
+}
+
+// ListConflicts reads the latest conflicts recorded on a target by a job.
+func ListConflicts(ctx context.Context, db *gosql.DB, jobID string, limit int) ([]*models.ConflictRecord, error) {
+	jobUUID, err := uuid.FromString(jobID)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("select id, gtid, table_schema, table_name, pk_value, dml, policy, resolution, "+
+		"ifnull(incoming, ''), ifnull(existing, ''), cast(created_at as char) "+
+		"from %v.%v where job_uuid = ? order by id desc limit ?", g.DtleSchemaName, g.ConflictLogTable)
+	rows, err := db.QueryContext(ctx, query, jobUUID.Bytes(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*models.ConflictRecord
+	for rows.Next() {
+		r := &models.ConflictRecord{}
+		if err := rows.Scan(&r.ID, &r.Gtid, &r.TableSchema, &r.TableName, &r.PkValue, &r.DML, &r.Policy,
+			&r.Resolution, &r.Incoming, &r.Existing, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
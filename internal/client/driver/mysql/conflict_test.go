@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	gosql "database/sql"
+	"strings"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	a := &Applier{mysqlContext: &config.MySQLDriverConfig{
+		ConflictPolicies: []*config.ConflictPolicy{
+			{TableSchema: "db1", Policy: config.ConflictPolicyPriority, Priority: 1},
+			{TableSchema: "db1", TableName: "tb1", Policy: config.ConflictPolicyTimestamp, TimestampColumn: "ts"},
+		},
+	}}
+	test.S(t).ExpectEquals(a.conflictPolicy("db1", "tb1").Policy, config.ConflictPolicyTimestamp)
+	test.S(t).ExpectEquals(a.conflictPolicy("db1", "tb2").Policy, config.ConflictPolicyPriority)
+	test.S(t).ExpectTrue(a.conflictPolicy("db2", "tb1") == nil)
+}
+
+func TestConflictKey(t *testing.T) {
+	columns := umconf.NewColumnList([]umconf.Column{
+		{Name: "id", Key: "PRI"},
+		{Name: "name"},
+		{Name: "region", Key: "PRI"},
+	})
+	values := []interface{}{int64(1), "a", []byte("cn")}
+	var abstractValues []*interface{}
+	for i := range values {
+		abstractValues = append(abstractValues, &values[i])
+	}
+
+	names, args, key := conflictKey(columns, abstractValues)
+	test.S(t).ExpectEquals(len(names), 2)
+	test.S(t).ExpectEquals(names[1], "region")
+	test.S(t).ExpectEquals(len(args), 2)
+	test.S(t).ExpectEquals(key, `["1","cn"]`)
+
+	// the keys of row_owner are of a fixed size, whatever the primary key
+	long := strings.Repeat("x", 300)
+	test.S(t).ExpectEquals(len(pkHash(long+"a")), 32)
+	test.S(t).ExpectFalse(bytes.Equal(pkHash(long+"a"), pkHash(long+"b")))
+}
+
+func TestCompareConflictValues(t *testing.T) {
+	v := func(s string) gosql.NullString {
+		return gosql.NullString{String: s, Valid: true}
+	}
+	test.S(t).ExpectEquals(compareConflictValues(v("9"), v("10")), -1)
+	test.S(t).ExpectEquals(compareConflictValues(v("2019-01-02 00:00:00"), v("2019-01-01 23:59:59")), 1)
+	test.S(t).ExpectEquals(compareConflictValues(v("1.50"), v("1.5")), 0)
+	test.S(t).ExpectEquals(compareConflictValues(gosql.NullString{}, v("0")), -1)
+
+	values := []string{"hq", "branch"}
+	test.S(t).ExpectEquals(precedenceRank(values, v("branch")), 1)
+	test.S(t).ExpectEquals(precedenceRank(values, v("other")), 2)
+	test.S(t).ExpectEquals(precedenceRank(values, gosql.NullString{}), 2)
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	gonats "github.com/nats-io/go-nats"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/g"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// copyProgressTimeout is how long the extractor waits for the applier to
+// tell the progress of an interrupted copy
+const copyProgressTimeout = 2 * DefaultConnectWait
+
+// answerCopyProgress tells the extractor the chunks applied by the copy, so
+// that an interrupted copy goes on after them
+func (a *Applier) answerCopyProgress() error {
+	_, err := a.natsConn.Subscribe(fmt.Sprintf("%s_copy_progress", a.subject), func(m *gonats.Msg) {
+		data, err := json.Marshal(a.currentCopyProgress())
+		if err != nil {
+			a.logger.Warnf("mysql.applier: cannot encode the copy progress: %v", err)
+			return
+		}
+		if err := a.natsConn.Publish(m.Reply, data); err != nil {
+			a.logger.Warnf("mysql.applier: cannot answer the copy progress: %v", err)
+		}
+	})
+	return err
+}
+
+// currentCopyProgress returns a copy of the progress of the full copy, nil
+// if no chunk is applied
+func (a *Applier) currentCopyProgress() *models.CopyProgress {
+	a.copyProgressLock.Lock()
+	defer a.copyProgressLock.Unlock()
+	return a.copyProgress.Copy()
+}
+
+// recordCopiedChunk moves the watermark of the table of entry, once applied
+func (a *Applier) recordCopiedChunk(entry *DumpEntry) {
+	a.copyProgressLock.Lock()
+	defer a.copyProgressLock.Unlock()
+
+	if c := entry.Coordinates; c != nil {
+		p := a.copyProgress
+		if p == nil || p.Gtid != c.GtidSet || p.LogFile != c.LogFile || p.LogPos != c.LogPos {
+			// the copy of another snapshot starts from scratch
+			a.copyProgress = &models.CopyProgress{
+				Gtid:    c.GtidSet,
+				LogFile: c.LogFile,
+				LogPos:  c.LogPos,
+				Tables:  make(map[string]*models.ChunkWatermark),
+			}
+		}
+	}
+	if entry.Watermark == nil || a.copyProgress == nil {
+		return
+	}
+
+	table := fmt.Sprintf("%s.%s", entry.TableSchema, entry.TableName)
+	last := a.copyProgress.Tables[table]
+	var w models.ChunkWatermark
+	switch {
+	case entry.Watermark.Done:
+		if last != nil {
+			w = *last
+		}
+		w.Done = true
+	case entry.Watermark.Iteration <= 1 || last == nil:
+		w = *entry.Watermark
+		w.Rows = entry.RowsCount
+	default:
+		w = *entry.Watermark
+		w.Rows = last.Rows + entry.RowsCount
+	}
+	a.copyProgress.Tables[table] = &w
+}
+
+// requestCopyProgress asks the applier for the progress of an interrupted
+// copy. It returns nil to copy from scratch.
+func (e *Extractor) requestCopyProgress() *models.CopyProgress {
+	subject := fmt.Sprintf("%s_copy_progress", e.subject)
+	deadline := time.Now().Add(copyProgressTimeout)
+	for {
+		msg, err := e.natsConn.Request(subject, nil, codecNegotiationRetry)
+		if err == nil {
+			var progress *models.CopyProgress
+			if err := json.Unmarshal(msg.Data, &progress); err != nil {
+				e.logger.Warnf("mysql.extractor: bad answer for the copy progress: %v. copying from scratch", err)
+				return nil
+			}
+			if progress == nil || len(progress.Tables) == 0 {
+				return nil
+			}
+			return progress
+		}
+		if err != gonats.ErrTimeout || time.Now().After(deadline) {
+			e.logger.Warnf("mysql.extractor: the applier does not tell the copy progress (%v), "+
+				"it may be of an older version. copying from scratch", err)
+			return nil
+		}
+		if e.shutdown {
+			return nil
+		}
+	}
+}
+
+// resumedCoordinates are the coordinates of the snapshot of the interrupted
+// copy. The changes since then are replicated again over the resumed
+// tables, which the rows replaced by the copy and by the replication make
+// consistent.
+func (e *Extractor) resumedCoordinates() *base.BinlogCoordinatesX {
+	return &base.BinlogCoordinatesX{
+		LogFile: e.copyProgress.LogFile,
+		LogPos:  e.copyProgress.LogPos,
+		GtidSet: e.copyProgress.Gtid,
+	}
+}
+
+// resumeTable sets tb to be copied after the watermark of the interrupted
+// copy. It returns the watermark, nil if tb is copied from scratch.
+func (e *Extractor) resumeTable(tb *config.Table) *models.ChunkWatermark {
+	if e.copyProgress == nil {
+		return nil
+	}
+	table := fmt.Sprintf("%s.%s", tb.TableSchema, tb.TableName)
+	w := e.copyProgress.Tables[table]
+	if w == nil || w.Done {
+		return w
+	}
+	key := tb.UseUniqueKey
+	if key == nil || os.Getenv(g.ENV_DUMP_OLDWAY) != "" || key.Name != w.UniqueKey ||
+		len(key.LastMaxVals) != len(w.LastMaxVals) || w.Iteration == 0 {
+		e.logger.Warnf("mysql.extractor: cannot resume the copy of %s by unique key %v. copying it from scratch",
+			table, w.UniqueKey)
+		return nil
+	}
+	tb.Iteration = w.Iteration
+	copy(key.LastMaxVals, w.LastMaxVals)
+	e.logger.Printf("mysql.extractor: resuming the copy of %s after %d rows in %d chunks",
+		table, w.Rows, w.Iteration)
+	return w
+}
+
+// tableCopied tells if all the rows of tb are applied by the interrupted copy
+func (e *Extractor) tableCopied(tb *config.Table) bool {
+	if e.copyProgress == nil {
+		return false
+	}
+	w := e.copyProgress.Tables[fmt.Sprintf("%s.%s", tb.TableSchema, tb.TableName)]
+	return w != nil && w.Done
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"io/ioutil"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestApplier_recordCopiedChunk(t *testing.T) {
+	a := &Applier{}
+	coord := &base.BinlogCoordinatesX{LogFile: "bin.000001", LogPos: 4, GtidSet: "uuid:1-10"}
+	chunk := func(iteration, rows int64, lastVal string) *DumpEntry {
+		return &DumpEntry{
+			TableSchema: "db1",
+			TableName:   "t1",
+			RowsCount:   rows,
+			Watermark: &models.ChunkWatermark{
+				UniqueKey:   "PRIMARY",
+				Iteration:   iteration,
+				LastMaxVals: []string{lastVal},
+			},
+		}
+	}
+
+	// no chunk before the definitions of the tables
+	a.recordCopiedChunk(chunk(1, 10, "10"))
+	test.S(t).ExpectTrue(a.currentCopyProgress() == nil)
+
+	a.recordCopiedChunk(&DumpEntry{TableSchema: "db1", TableName: "t1", RowsCount: 1, Coordinates: coord})
+	a.recordCopiedChunk(chunk(1, 10, "10"))
+	a.recordCopiedChunk(chunk(2, 5, "15"))
+	p := a.currentCopyProgress()
+	test.S(t).ExpectEquals(p.Gtid, "uuid:1-10")
+	w := p.Tables["db1.t1"]
+	test.S(t).ExpectEquals(w.Iteration, int64(2))
+	test.S(t).ExpectEquals(w.LastMaxVals[0], "15")
+	test.S(t).ExpectEquals(w.Rows, int64(15))
+	test.S(t).ExpectFalse(w.Done)
+
+	a.recordCopiedChunk(&DumpEntry{TableSchema: "db1", TableName: "t1",
+		Watermark: &models.ChunkWatermark{Done: true}})
+	w = a.currentCopyProgress().Tables["db1.t1"]
+	test.S(t).ExpectTrue(w.Done)
+	test.S(t).ExpectEquals(w.Rows, int64(15))
+	// the copy is not changed by the progress given out
+	p.Tables["db1.t1"].Rows = 0
+	test.S(t).ExpectEquals(a.currentCopyProgress().Tables["db1.t1"].Rows, int64(15))
+
+	// the same snapshot, resumed
+	a.recordCopiedChunk(&DumpEntry{TableSchema: "db1", TableName: "t2", RowsCount: 1, Coordinates: coord})
+	test.S(t).ExpectTrue(a.currentCopyProgress().Tables["db1.t1"].Done)
+
+	// another snapshot
+	a.recordCopiedChunk(&DumpEntry{TableSchema: "db1", TableName: "t1", RowsCount: 1,
+		Coordinates: &base.BinlogCoordinatesX{LogFile: "bin.000002", LogPos: 4, GtidSet: "uuid:1-20"}})
+	p = a.currentCopyProgress()
+	test.S(t).ExpectEquals(p.Gtid, "uuid:1-20")
+	test.S(t).ExpectEquals(len(p.Tables), 0)
+}
+
+func TestExtractor_resumeTable(t *testing.T) {
+	newTable := func(key string) *config.Table {
+		tb := config.NewTable("db1", "t1")
+		tb.UseUniqueKey = &umconf.UniqueKey{
+			Name:        key,
+			Columns:     *umconf.NewColumnList([]umconf.Column{{Name: "a"}, {Name: "b"}}),
+			LastMaxVals: make([]string, 2),
+		}
+		return tb
+	}
+	e := &Extractor{
+		logger: log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)),
+		copyProgress: &models.CopyProgress{
+			Gtid: "uuid:1-10",
+			Tables: map[string]*models.ChunkWatermark{
+				"db1.t1": {UniqueKey: "PRIMARY", Iteration: 3, LastMaxVals: []string{"1", "'x'"}, Rows: 30},
+				"db1.t2": {Done: true, Rows: 7},
+			},
+		},
+	}
+
+	tb := newTable("PRIMARY")
+	w := e.resumeTable(tb)
+	test.S(t).ExpectTrue(w != nil)
+	test.S(t).ExpectEquals(tb.Iteration, int64(3))
+	test.S(t).ExpectEquals(tb.UseUniqueKey.LastMaxVals[1], "'x'")
+	test.S(t).ExpectEquals(uniqueKeyRange(tb.UseUniqueKey), "((`a` > 1)) or ((`a` = 1) and (`b` > 'x'))")
+	test.S(t).ExpectFalse(e.tableCopied(tb))
+
+	// another key: from scratch
+	tb = newTable("uk")
+	test.S(t).ExpectTrue(e.resumeTable(tb) == nil)
+	test.S(t).ExpectEquals(tb.Iteration, int64(0))
+
+	done := config.NewTable("db1", "t2")
+	w = e.resumeTable(done)
+	test.S(t).ExpectTrue(w.Done)
+	test.S(t).ExpectTrue(e.tableCopied(done))
+
+	test.S(t).ExpectTrue(e.resumeTable(config.NewTable("db1", "t3")) == nil)
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestTablesBySizeDesc(t *testing.T) {
+	dataSources := []*config.DataSource{
+		{TableSchema: "db1", Tables: []*config.Table{
+			{TableSchema: "db1", TableName: "small", Counter: 10},
+			{TableSchema: "db1", TableName: "big", Counter: 1000},
+		}},
+		{TableSchema: "db2", Tables: []*config.Table{
+			{TableSchema: "db2", TableName: "medium", Counter: 100},
+			{TableSchema: "db2", TableName: "small", Counter: 10},
+		}},
+	}
+	var names []string
+	for _, tb := range tablesBySizeDesc(dataSources) {
+		names = append(names, tb.TableSchema+"."+tb.TableName)
+	}
+	want := []string{"db1.big", "db2.medium", "db1.small", "db2.small"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("tablesBySizeDesc() = %v, want %v", names, want)
+	}
+
+	// data length goes before rows
+	dataSources[1].Tables[1].DataLength = 1 << 20
+	if got := tablesBySizeDesc(dataSources)[0]; got.TableSchema != "db2" || got.TableName != "small" {
+		t.Errorf("tablesBySizeDesc()[0] = %v.%v, want db2.small", got.TableSchema, got.TableName)
+	}
+}
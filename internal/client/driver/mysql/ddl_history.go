@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/g"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func (a *Applier) createDDLHistoryTable() error {
+	query := fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %v.%v (
+				id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+				job_uuid binary(16) NOT NULL COMMENT 'unique identifier of job',
+				gtid varchar(64) NOT NULL COMMENT 'source transaction of the ddl',
+				log_file varchar(255) NOT NULL,
+				log_pos bigint NOT NULL,
+				event_time timestamp NULL COMMENT 'time of the ddl on the source',
+				current_schema varchar(64) NOT NULL,
+				table_schema varchar(64) NOT NULL,
+				table_name varchar(64) NOT NULL,
+				query longtext NOT NULL,
+				duration_ms bigint NOT NULL COMMENT 'time the target took to execute the ddl',
+				ignored_error text COMMENT 'error of the ddl ignored by the applier',
+				executed_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				KEY job_uuid (job_uuid, id),
+				KEY job_table (job_uuid, table_schema, table_name, id)
+			);
+		`, g.DtleSchemaName, g.DDLHistoryTable)
+	_, err := a.db.Exec(query)
+	return err
+}
+
+// recordDDL adds a DDL executed on the target to ddl_history, in the
+// transaction of its checkpoint.
+func (a *Applier) recordDDL(tx *gosql.Tx, entry *binlog.BinlogEntry, event *binlog.DataEvent,
+	schema string, took time.Duration, ignored error) error {
+	c := entry.Coordinates
+	var eventTime interface{}
+	if c.EventTimestamp != 0 {
+		eventTime = c.EventTimestamp
+	}
+	var ignoredError interface{}
+	if ignored != nil {
+		ignoredError = ignored.Error()
+	}
+	query := fmt.Sprintf("insert into %v.%v (job_uuid, gtid, log_file, log_pos, event_time, current_schema, "+
+		"table_schema, table_name, query, duration_ms, ignored_error) "+
+		"values (?, ?, ?, ?, from_unixtime(?), ?, ?, ?, ?, ?, ?)", g.DtleSchemaName, g.DDLHistoryTable)
+	_, err := tx.Exec(query, a.subjectUUID.Bytes(), fmt.Sprintf("%s:%d", c.GetSid(), c.GNO), c.LogFile, c.LogPos,
+		eventTime, event.CurrentSchema, schema, event.TableName, event.Query,
+		int64(took/time.Millisecond), ignoredError)
+	return err
+}
+
+// ListDDLHistory reads the latest DDLs executed on a target by a job, of
+// the table schema.table if given. An empty table is the whole schema.
+func ListDDLHistory(ctx context.Context, db *gosql.DB, jobID, schema, table string, limit int) ([]*models.DDLRecord, error) {
+	jobUUID, err := uuid.FromString(jobID)
+	if err != nil {
+		return nil, err
+	}
+	where, args := ddlHistoryWhere(jobUUID.Bytes(), schema, table)
+	args = append(args, limit)
+	query := fmt.Sprintf("select id, gtid, log_file, log_pos, ifnull(cast(event_time as char), ''), current_schema, "+
+		"table_schema, table_name, query, duration_ms, ifnull(ignored_error, ''), cast(executed_at as char) "+
+		"from %v.%v where %v order by id desc limit ?", g.DtleSchemaName, g.DDLHistoryTable, where)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*models.DDLRecord
+	for rows.Next() {
+		r := &models.DDLRecord{}
+		if err := rows.Scan(&r.ID, &r.Gtid, &r.LogFile, &r.LogPos, &r.EventTime, &r.CurrentSchema,
+			&r.TableSchema, &r.TableName, &r.Query, &r.DurationMs, &r.IgnoredError, &r.ExecutedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// ddlHistoryWhere is the condition of the DDLs of a job on a schema or a
+// table, with its args
+func ddlHistoryWhere(jobUUID []byte, schema, table string) (string, []interface{}) {
+	where := []string{"job_uuid = ?"}
+	args := []interface{}{jobUUID}
+	if schema != "" {
+		where = append(where, "table_schema = ?")
+		args = append(args, schema)
+	}
+	if table != "" {
+		where = append(where, "table_name = ?")
+		args = append(args, table)
+	}
+	return strings.Join(where, " and "), args
+}
@@ -0,0 +1,30 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestDDLHistoryWhere(t *testing.T) {
+	job := []byte("0123456789abcdef")
+
+	where, args := ddlHistoryWhere(job, "", "")
+	test.S(t).ExpectEquals(where, "job_uuid = ?")
+	test.S(t).ExpectEquals(len(args), 1)
+
+	where, args = ddlHistoryWhere(job, "db1", "")
+	test.S(t).ExpectEquals(where, "job_uuid = ? and table_schema = ?")
+	test.S(t).ExpectEquals(args[1], "db1")
+
+	where, args = ddlHistoryWhere(job, "db1", "tb1")
+	test.S(t).ExpectEquals(where, "job_uuid = ? and table_schema = ? and table_name = ?")
+	test.S(t).ExpectEquals(len(args), 3)
+	test.S(t).ExpectEquals(args[2], "tb1")
+}
@@ -17,10 +17,13 @@ import (
 
 	"time"
 
+	"github.com/actiontech/dtle/internal"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
 	usql "github.com/actiontech/dtle/internal/client/driver/mysql/sql"
 	"github.com/actiontech/dtle/internal/config"
 	umconf "github.com/actiontech/dtle/internal/config/mysql"
 	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
 )
 
 type dumper struct {
@@ -42,6 +45,8 @@ type dumper struct {
 	// 0: don't checksum; 1: checksum once; 2: checksum every time
 	doChecksum int
 	oldWayDump bool
+	// all the rows are dumped
+	done bool
 }
 
 func NewDumper(db usql.QueryAble, table *config.Table, chunkSize int64,
@@ -72,9 +77,13 @@ func NewDumper(db usql.QueryAble, table *config.Table, chunkSize int64,
 	return dumper
 }
 
-type dumpStatResult struct {
+type DumpStatResult struct {
 	Gtid       string
+	LogFile    string
+	LogPos     int64
 	TotalCount int64
+	// rows copied by "schema.table"
+	TableRows map[string]int64
 }
 
 type DumpEntry struct {
@@ -93,6 +102,31 @@ type DumpEntry struct {
 	colBuffer  bytes.Buffer
 	err        error
 	Table      *config.Table
+	// Watermark is the chunk of the table copied once the entry is applied,
+	// for a table dumped by ranges of a unique key
+	Watermark *models.ChunkWatermark
+	// Coordinates are where the replication starts after the copy, sent
+	// with the definitions of the tables
+	Coordinates *base.BinlogCoordinatesX
+}
+
+// dataSize is the size of the statements and the row values of the entry.
+func (e *DumpEntry) dataSize() int64 {
+	n := len(e.SystemVariablesStatement) + len(e.SqlMode) + len(e.DbSQL)
+	for _, sql := range e.TbSQL {
+		n += len(sql)
+	}
+	for _, row := range e.ValuesX {
+		for _, v := range row {
+			if v == nil {
+				continue
+			}
+			if b, ok := (*v).([]byte); ok {
+				n += len(b)
+			}
+		}
+	}
+	return int64(n)
 }
 
 func (e *DumpEntry) incrementCounter() {
@@ -152,24 +186,7 @@ func (d *dumper) buildQueryOnUniqueKey() string {
 	if d.table.Iteration == 0 {
 		rangeStr = "true"
 	} else {
-		rangeItems := make([]string, nCol)
-
-		// The form like: (A > a) or (A = a and B > b) or (A = a and B = b and C > c) or ...
-		for x := 0; x < nCol; x++ {
-			innerItems := make([]string, x+1)
-
-			for y := 0; y < x; y++ {
-				colName := usql.EscapeName(d.table.UseUniqueKey.Columns.Columns[y].Name)
-				innerItems[y] = fmt.Sprintf("(%s = %s)", colName, d.table.UseUniqueKey.LastMaxVals[y])
-			}
-
-			colName := usql.EscapeName(d.table.UseUniqueKey.Columns.Columns[x].Name)
-			innerItems[x] = fmt.Sprintf("(%s > %s)", colName, d.table.UseUniqueKey.LastMaxVals[x])
-
-			rangeItems[x] = fmt.Sprintf("(%s)", strings.Join(innerItems, " and "))
-		}
-
-		rangeStr = strings.Join(rangeItems, " or ")
+		rangeStr = uniqueKeyRange(d.table.UseUniqueKey)
 	}
 
 	return fmt.Sprintf(`SELECT %s FROM %s.%s where (%s) and (%s) order by %s LIMIT %d`,
@@ -185,6 +202,29 @@ func (d *dumper) buildQueryOnUniqueKey() string {
 	)
 }
 
+// uniqueKeyRange is the condition of the rows after the LastMaxVals of key
+func uniqueKeyRange(key *umconf.UniqueKey) string {
+	nCol := len(key.Columns.Columns)
+	rangeItems := make([]string, nCol)
+
+	// The form like: (A > a) or (A = a and B > b) or (A = a and B = b and C > c) or ...
+	for x := 0; x < nCol; x++ {
+		innerItems := make([]string, x+1)
+
+		for y := 0; y < x; y++ {
+			colName := usql.EscapeName(key.Columns.Columns[y].Name)
+			innerItems[y] = fmt.Sprintf("(%s = %s)", colName, key.LastMaxVals[y])
+		}
+
+		colName := usql.EscapeName(key.Columns.Columns[x].Name)
+		innerItems[x] = fmt.Sprintf("(%s > %s)", colName, key.LastMaxVals[x])
+
+		rangeItems[x] = fmt.Sprintf("(%s)", strings.Join(innerItems, " and "))
+	}
+
+	return strings.Join(rangeItems, " or ")
+}
+
 // dumps a specific chunk, reading chunk info from the channel
 func (d *dumper) getChunkData() (nRows int64, err error) {
 	entry := &DumpEntry{
@@ -223,10 +263,11 @@ func (d *dumper) getChunkData() (nRows int64, err error) {
 	}()
 
 	query := ""
-	if d.oldWayDump || d.table.UseUniqueKey == nil {
-		query = d.buildQueryOldWay()
-	} else {
+	byUniqueKey := !d.oldWayDump && d.table.UseUniqueKey != nil
+	if byUniqueKey {
 		query = d.buildQueryOnUniqueKey()
+	} else {
+		query = d.buildQueryOldWay()
 	}
 	d.logger.Debugf("getChunkData. query: %s", query)
 
@@ -306,6 +347,13 @@ func (d *dumper) getChunkData() (nRows int64, err error) {
 			}
 			d.logger.Debugf("GetLastMaxVal: got %v", d.table.UseUniqueKey.LastMaxVals)
 		}
+		if byUniqueKey {
+			entry.Watermark = &models.ChunkWatermark{
+				UniqueKey:   d.table.UseUniqueKey.Name,
+				Iteration:   d.table.Iteration,
+				LastMaxVals: internal.CopySliceString(d.table.UseUniqueKey.LastMaxVals),
+			}
+		}
 	}
 
 	// ValuesX[i]: n-th row
@@ -342,6 +390,7 @@ func (d *dumper) Dump() error {
 			}
 			if nRows == 0 {
 				d.logger.Infof("mysql.dumper: nRows == 0. dump finished. %v %v", nRows, d.chunkSize)
+				d.done = true
 				break
 			}
 		}
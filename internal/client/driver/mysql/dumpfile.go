@@ -0,0 +1,579 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	gg "github.com/hashicorp/go-getter"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+)
+
+const (
+	// mydumperMetadataFile holds the binlog coordinates of a mydumper backup.
+	mydumperMetadataFile = "metadata"
+)
+
+var (
+	dumpGtidPurgedRegexp = regexp.MustCompile(`(?is)^SET\s+@@GLOBAL\.GTID_PURGED\s*=\s*(?:/\*!80000\s*'\+'\s*\*/\s*)?'([^']*)'`)
+	dumpSqlLogBinRegexp  = regexp.MustCompile(`(?i)@@(SESSION\.)?SQL_LOG_BIN`)
+	dumpRestoreVarRegexp = regexp.MustCompile(`(?i)=\s*@[a-z_]`)
+	dumpSessionSetRegexp = regexp.MustCompile(`(?is)^(/\*!\d*\s*)?SET\s`)
+	dumpUseRegexp        = regexp.MustCompile("(?i)^USE\\s+`?([^`;\\s]+)`?")
+	dumpSkipRegexp       = regexp.MustCompile(`(?i)^((UN)?LOCK\s+TABLES|CHANGE\s+MASTER\s|RESET\s+MASTER)`)
+	dumpInsertRegexp     = regexp.MustCompile(`(?is)^(/\*!\d*\s*)?(INSERT|REPLACE)\s`)
+)
+
+// dumpStatementReader splits a mysqldump/mydumper SQL file into statements.
+// Line comments are dropped, block comments (including /*!...*/ version
+// comments) are kept as a part of the statement, and DELIMITER is honored.
+type dumpStatementReader struct {
+	r         *bufio.Reader
+	delimiter string
+}
+
+func newDumpStatementReader(r io.Reader) *dumpStatementReader {
+	return &dumpStatementReader{
+		r:         bufio.NewReaderSize(r, 1024*1024),
+		delimiter: ";",
+	}
+}
+
+func (d *dumpStatementReader) peekIs(s string) bool {
+	p, err := d.r.Peek(len(s))
+	return err == nil && strings.EqualFold(string(p), s)
+}
+
+func (d *dumpStatementReader) skipLine() error {
+	_, err := d.r.ReadString('\n')
+	return err
+}
+
+// Next returns the next statement without its delimiter, or io.EOF.
+func (d *dumpStatementReader) Next() (string, error) {
+	var buf bytes.Buffer
+	var quote byte
+	inComment := false
+	for {
+		c, err := d.r.ReadByte()
+		if err == io.EOF {
+			stmt := strings.TrimSpace(buf.String())
+			if stmt == "" {
+				return "", io.EOF
+			}
+			return stmt, nil
+		} else if err != nil {
+			return "", err
+		}
+
+		switch {
+		case quote != 0:
+			buf.WriteByte(c)
+			if c == '\\' && quote != '`' {
+				if c, err = d.r.ReadByte(); err == nil {
+					buf.WriteByte(c)
+				}
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case inComment:
+			buf.WriteByte(c)
+			if c == '*' && d.peekIs("/") {
+				c, _ = d.r.ReadByte()
+				buf.WriteByte(c)
+				inComment = false
+			}
+			continue
+		}
+
+		if buf.Len() == 0 {
+			if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+				continue
+			}
+			if (c == 'D' || c == 'd') && d.peekIs("ELIMITER ") {
+				line, err := d.r.ReadString('\n')
+				if err != nil && err != io.EOF {
+					return "", err
+				}
+				if fields := strings.Fields(line); len(fields) > 1 {
+					d.delimiter = fields[1]
+				}
+				continue
+			}
+		}
+
+		switch {
+		case c == '#' || (c == '-' && (d.peekIs("- ") || d.peekIs("-\t") || d.peekIs("-\n") || d.peekIs("-\r"))):
+			if err := d.skipLine(); err != nil && err != io.EOF {
+				return "", err
+			}
+			continue
+		case c == '/' && d.peekIs("*"):
+			inComment = true
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		}
+		buf.WriteByte(c)
+
+		if bytes.HasSuffix(buf.Bytes(), []byte(d.delimiter)) {
+			stmt := strings.TrimSpace(string(buf.Bytes()[:buf.Len()-len(d.delimiter)]))
+			if stmt != "" {
+				return stmt, nil
+			}
+			buf.Reset()
+		}
+	}
+}
+
+// parseMydumperMetadata reads the binlog coordinates of a mydumper `metadata` file.
+// A long GTID set is written by mydumper across several lines, each but the
+// last ending with a comma.
+func parseMydumperMetadata(r io.Reader) (*base.BinlogCoordinatesX, error) {
+	coord := &base.BinlogCoordinatesX{}
+	scanner := bufio.NewScanner(r)
+	inMasterStatus := false
+	inGtid := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inGtid {
+			if strings.HasSuffix(coord.GtidSet, ",") {
+				coord.GtidSet += line
+				continue
+			}
+			inGtid = false
+		}
+		switch {
+		case strings.HasPrefix(line, "SHOW MASTER STATUS"):
+			inMasterStatus = true
+		case strings.HasPrefix(line, "SHOW SLAVE STATUS"), line == "":
+			inMasterStatus = false
+		case !inMasterStatus:
+		case strings.HasPrefix(line, "Log:"):
+			coord.LogFile = strings.TrimSpace(strings.TrimPrefix(line, "Log:"))
+		case strings.HasPrefix(line, "Pos:"):
+			fmt.Sscanf(strings.TrimSpace(strings.TrimPrefix(line, "Pos:")), "%d", &coord.LogPos)
+		case strings.HasPrefix(line, "GTID:"):
+			coord.GtidSet = strings.TrimSpace(strings.TrimPrefix(line, "GTID:"))
+			inGtid = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return coord, nil
+}
+
+// parseDumpGtidPurged returns the GTID set of a mysqldump `SET @@GLOBAL.GTID_PURGED` statement.
+func parseDumpGtidPurged(stmt string) (string, bool) {
+	m := dumpGtidPurgedRegexp.FindStringSubmatch(stmt)
+	if m == nil {
+		return "", false
+	}
+	return strings.Join(strings.Fields(m[1]), ""), true
+}
+
+// dumpStatementRows returns the number of rows a statement of a dump inserts:
+// the tuples of values of an INSERT or REPLACE, mysqldump and mydumper
+// writing many rows in each. An INSERT without VALUES, e.g. with SET, is
+// counted as one row, and other statements as none.
+func dumpStatementRows(stmt string) int64 {
+	if !dumpInsertRegexp.MatchString(stmt) {
+		return 0
+	}
+	var rows int64
+	var quote byte
+	depth := 0
+	inValues := false
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			if depth == 0 && inValues {
+				rows++
+			}
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && !inValues && (c == 'V' || c == 'v'):
+			// VALUES or VALUE, as a word
+			word := stmt[i:]
+			if j := strings.IndexFunc(word, func(r rune) bool {
+				return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_')
+			}); j >= 0 {
+				word = word[:j]
+			}
+			prev := byte(' ')
+			if i > 0 {
+				prev = stmt[i-1]
+			}
+			if (strings.EqualFold(word, "VALUES") || strings.EqualFold(word, "VALUE")) &&
+				(prev == ' ' || prev == '\t' || prev == '\n' || prev == '\r' || prev == ')') {
+				inValues = true
+			}
+			i += len(word) - 1
+		}
+	}
+	if !inValues {
+		return 1
+	}
+	return rows
+}
+
+// mydumperFile describes one file of a mydumper backup, derived from its name.
+type mydumperFile struct {
+	path      string
+	schema    string
+	table     string
+	isSchema  bool
+	sortOrder int
+}
+
+// parseMydumperFileName classifies a mydumper output file by its name:
+//
+//	db-schema-create.sql, db.tb-schema.sql, db.tb-schema-view.sql,
+//	db.tb.sql, db.tb.00001.sql, db.tb-schema-triggers.sql, db-schema-post.sql.
+//
+// Files may be gzip compressed.
+func parseMydumperFileName(name string) (*mydumperFile, bool) {
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasSuffix(name, ".sql") {
+		return nil, false
+	}
+	name = strings.TrimSuffix(name, ".sql")
+	f := &mydumperFile{}
+	switch {
+	case strings.HasSuffix(name, "-schema-create"):
+		f.schema, f.isSchema, f.sortOrder = strings.TrimSuffix(name, "-schema-create"), true, 0
+	case strings.HasSuffix(name, "-schema-view"):
+		name, f.isSchema, f.sortOrder = strings.TrimSuffix(name, "-schema-view"), true, 2
+	case strings.HasSuffix(name, "-schema-triggers"):
+		name, f.isSchema, f.sortOrder = strings.TrimSuffix(name, "-schema-triggers"), true, 4
+	case strings.HasSuffix(name, "-schema-post"):
+		f.schema, f.isSchema, f.sortOrder = strings.TrimSuffix(name, "-schema-post"), true, 5
+	case strings.HasSuffix(name, "-schema"):
+		name, f.isSchema, f.sortOrder = strings.TrimSuffix(name, "-schema"), true, 1
+	default:
+		f.sortOrder = 3
+	}
+	if f.schema == "" {
+		parts := strings.SplitN(name, ".", 3)
+		if len(parts) < 2 {
+			return nil, false
+		}
+		f.schema, f.table = parts[0], parts[1]
+	}
+	return f, true
+}
+
+// fetchDumpSource makes the dump source available on the local file system.
+// Local paths are used in place. Anything else (e.g. s3::https://...) is
+// downloaded to a temporary directory under dir (the system one if empty),
+// which is removed by the returned func.
+func fetchDumpSource(src, dir string) (string, func(), error) {
+	noop := func() {}
+	if _, err := os.Stat(src); err == nil {
+		return src, noop, nil
+	}
+
+	dir, err := ioutil.TempDir(dir, "dtle-dump")
+	if err != nil {
+		return "", noop, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	pwd, err := os.Getwd()
+	if err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	client := &gg.Client{
+		Src:  src,
+		Dst:  dir,
+		Pwd:  pwd,
+		Mode: gg.ClientModeAny,
+	}
+	if err := client.Get(); err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("error getting dump source from %q: %v", src, err)
+	}
+
+	// A single downloaded file lands in dir under its own name.
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	if len(fis) == 1 && !fis[0].IsDir() {
+		if _, err := os.Stat(filepath.Join(dir, mydumperMetadataFile)); os.IsNotExist(err) {
+			return filepath.Join(dir, fis[0].Name()), cleanup, nil
+		}
+	}
+	return dir, cleanup, nil
+}
+
+func openDumpFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// importDumpSource replaces the snapshot of the full copy stage with an existing
+// mydumper directory or mysqldump file. The backup must be taken with GTID
+// enabled; its coordinates become the start point of the incremental stage.
+func (e *Extractor) importDumpSource() error {
+	src, cleanup, err := fetchDumpSource(e.mysqlContext.DumpSource, e.mysqlContext.DataDir)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err := e.getSchemaTablesAndMeta(); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		err = e.importMydumperDir(src)
+	} else {
+		err = e.importMysqldumpFile(src)
+	}
+	if err != nil {
+		return err
+	}
+
+	if e.initialBinlogCoordinates == nil || e.initialBinlogCoordinates.GtidSet == "" {
+		return fmt.Errorf("no GTID coordinates found in dump source %v", e.mysqlContext.DumpSource)
+	}
+	if _, err := gomysql.ParseMysqlGTIDSet(e.initialBinlogCoordinates.GtidSet); err != nil {
+		return err
+	}
+	e.logger.Printf("mysql.extractor: imported dump source %v. coordinates: %+v",
+		e.mysqlContext.DumpSource, *e.initialBinlogCoordinates)
+	return nil
+}
+
+func (e *Extractor) importMydumperDir(dir string) error {
+	metadata, err := os.Open(filepath.Join(dir, mydumperMetadataFile))
+	if err != nil {
+		return err
+	}
+	e.initialBinlogCoordinates, err = parseMydumperMetadata(metadata)
+	metadata.Close()
+	if err != nil {
+		return err
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []*mydumperFile
+	for _, fi := range fis {
+		f, ok := parseMydumperFileName(fi.Name())
+		if !ok || fi.IsDir() {
+			continue
+		}
+		if !e.dumpFileWanted(f.schema, f.table) {
+			continue
+		}
+		if f.isSchema && e.mysqlContext.SkipCreateDbTable {
+			continue
+		}
+		f.path = filepath.Join(dir, fi.Name())
+		files = append(files, f)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].sortOrder != files[j].sortOrder {
+			return files[i].sortOrder < files[j].sortOrder
+		}
+		return files[i].path < files[j].path
+	})
+
+	for _, f := range files {
+		e.logger.Printf("mysql.extractor: importing dump file %v", f.path)
+		var prefix []string
+		if f.sortOrder == 1 && e.mysqlContext.DropTableIfExists {
+			prefix = append(prefix, fmt.Sprintf("DROP TABLE IF EXISTS %s.%s",
+				sql.EscapeName(f.schema), sql.EscapeName(f.table)))
+		}
+		currentDb := f.schema
+		if f.sortOrder == 0 {
+			currentDb = ""
+		}
+		if err := e.sendDumpFile(f.path, currentDb, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Extractor) importMysqldumpFile(path string) error {
+	// GTID_PURGED might be anywhere in the file, depending on mysqldump version.
+	// Find it first, so a dump without coordinates fails before copying anything.
+	r, err := openDumpFile(path)
+	if err != nil {
+		return err
+	}
+	reader := newDumpStatementReader(r)
+	for {
+		stmt, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			r.Close()
+			return err
+		}
+		if gtid, ok := parseDumpGtidPurged(stmt); ok {
+			e.initialBinlogCoordinates = &base.BinlogCoordinatesX{GtidSet: gtid}
+			break
+		}
+	}
+	r.Close()
+	if e.initialBinlogCoordinates == nil {
+		return fmt.Errorf("no GTID_PURGED in mysqldump file %v. dump with --set-gtid-purged=ON", path)
+	}
+
+	e.logger.Printf("mysql.extractor: importing dump file %v", path)
+	return e.sendDumpFile(path, "", nil)
+}
+
+// dumpFileWanted applies the replicate-do/ignore rules resolved by inspectTables.
+func (e *Extractor) dumpFileWanted(schema, table string) bool {
+	for _, db := range e.replicateDoDb {
+		if db.TableSchema != schema {
+			continue
+		}
+		if table == "" {
+			return true
+		}
+		for _, tb := range db.Tables {
+			if tb.TableName == table {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendDumpFile publishes the statements of a dump file as DumpEntries.
+// Session-level SET statements are replayed in front of every batch, since
+// batches may be applied on different connections of the target.
+func (e *Extractor) sendDumpFile(path string, currentDb string, prefix []string) error {
+	r, err := openDumpFile(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var sessionStmts, batch []string
+	sessionSeen := make(map[string]bool)
+	batch = append(batch, prefix...)
+	batchSize := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var rows int64
+		for _, stmt := range batch {
+			rows += dumpStatementRows(stmt)
+		}
+		entry := &DumpEntry{
+			TbSQL:      append(append([]string{}, sessionStmts...), batch...),
+			TotalCount: rows,
+			RowsCount:  rows,
+		}
+		if currentDb != "" {
+			entry.DbSQL = fmt.Sprintf("USE %s", sql.EscapeName(currentDb))
+		}
+		atomic.AddInt64(&e.mysqlContext.RowsEstimate, entry.RowsCount)
+		if err := e.encodeDumpEntry(entry); err != nil {
+			return err
+		}
+		atomic.AddInt64(&e.mysqlContext.TotalRowsCopied, entry.RowsCount)
+		batch = nil
+		batchSize = 0
+		return nil
+	}
+
+	reader := newDumpStatementReader(r)
+	for {
+		stmt, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case dumpSkipRegexp.MatchString(stmt), dumpSqlLogBinRegexp.MatchString(stmt):
+			continue
+		case dumpGtidPurgedRegexp.MatchString(stmt):
+			continue
+		case dumpSessionSetRegexp.MatchString(stmt):
+			// Restoring from a user variable only makes sense on the same connection.
+			if !dumpRestoreVarRegexp.MatchString(stmt) && !sessionSeen[stmt] {
+				sessionSeen[stmt] = true
+				sessionStmts = append(sessionStmts, stmt)
+			}
+			continue
+		}
+		if m := dumpUseRegexp.FindStringSubmatch(stmt); m != nil {
+			if err := flush(); err != nil {
+				return err
+			}
+			currentDb = m[1]
+			continue
+		}
+
+		batch = append(batch, stmt)
+		batchSize += len(stmt)
+		if batchSize >= e.mysqlContext.MsgBytesLimit {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestDumpStatementReader(t *testing.T) {
+	dump := "-- MySQL dump 10.13\n" +
+		"/*!40101 SET NAMES utf8 */;\n" +
+		"--\n" +
+		"SET @@GLOBAL.GTID_PURGED='3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n" +
+		"4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2';\n" +
+		"# comment\n" +
+		"INSERT INTO `a` VALUES (1,'x;y'),(2,'it\\'s -- fine');\n" +
+		"DELIMITER ;;\n" +
+		"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET @x=1; END ;;\n" +
+		"DELIMITER ;\n" +
+		"UNLOCK TABLES"
+
+	r := newDumpStatementReader(strings.NewReader(dump))
+	var stmts []string
+	for {
+		stmt, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		test.S(t).ExpectNil(err)
+		stmts = append(stmts, stmt)
+	}
+
+	test.S(t).ExpectEquals(len(stmts), 5)
+	test.S(t).ExpectEquals(stmts[0], "/*!40101 SET NAMES utf8 */")
+	test.S(t).ExpectEquals(stmts[2], "INSERT INTO `a` VALUES (1,'x;y'),(2,'it\\'s -- fine')")
+	test.S(t).ExpectEquals(stmts[3], "CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET @x=1; END")
+	test.S(t).ExpectEquals(stmts[4], "UNLOCK TABLES")
+
+	gtid, ok := parseDumpGtidPurged(stmts[1])
+	test.S(t).ExpectTrue(ok)
+	test.S(t).ExpectEquals(gtid, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2")
+
+	gtid, ok = parseDumpGtidPurged("SET @@GLOBAL.GTID_PURGED=/*!80000 '+'*/ '3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5'")
+	test.S(t).ExpectTrue(ok)
+	test.S(t).ExpectEquals(gtid, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+}
+
+func TestParseMydumperMetadata(t *testing.T) {
+	metadata := "Started dump at: 2019-01-01 00:00:00\n" +
+		"SHOW MASTER STATUS:\n" +
+		"\tLog: mysql-bin.000003\n" +
+		"\tPos: 154\n" +
+		"\tGTID:3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n" +
+		"4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2\n" +
+		"\n" +
+		"SHOW SLAVE STATUS:\n" +
+		"\tLog: relay-bin.000001\n" +
+		"\n" +
+		"Finished dump at: 2019-01-01 00:00:01\n"
+
+	coord, err := parseMydumperMetadata(strings.NewReader(metadata))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(coord.LogFile, "mysql-bin.000003")
+	test.S(t).ExpectEquals(coord.LogPos, int64(154))
+	test.S(t).ExpectEquals(coord.GtidSet, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2")
+}
+
+func TestParseMydumperFileName(t *testing.T) {
+	f, ok := parseMydumperFileName("db1-schema-create.sql")
+	test.S(t).ExpectTrue(ok)
+	test.S(t).ExpectEquals(f.schema, "db1")
+	test.S(t).ExpectEquals(f.table, "")
+
+	f, ok = parseMydumperFileName("db1.tb1-schema.sql.gz")
+	test.S(t).ExpectTrue(ok)
+	test.S(t).ExpectEquals(f.table, "tb1")
+	test.S(t).ExpectEquals(f.sortOrder, 1)
+
+	f, ok = parseMydumperFileName("db1.tb1.00001.sql")
+	test.S(t).ExpectTrue(ok)
+	test.S(t).ExpectEquals(f.schema, "db1")
+	test.S(t).ExpectEquals(f.table, "tb1")
+	test.S(t).ExpectFalse(f.isSchema)
+
+	_, ok = parseMydumperFileName("metadata")
+	test.S(t).ExpectFalse(ok)
+}
+
+func TestDumpEntryDataSize(t *testing.T) {
+	v1 := interface{}([]byte("abc"))
+	v2 := interface{}(nil)
+	entry := &DumpEntry{
+		DbSQL:   "use db1",
+		TbSQL:   []string{"create table a (id int)"},
+		ValuesX: [][]*interface{}{{&v1, &v2, nil}},
+	}
+	test.S(t).ExpectEquals(entry.dataSize(), int64(len("use db1")+len("create table a (id int)")+3))
+}
+
+func TestDumpStatementRows(t *testing.T) {
+	test.S(t).ExpectEquals(dumpStatementRows("INSERT INTO `a` VALUES (1,'x),(y'),(2,'it\\'s (3)'),(3,NULL)"), int64(3))
+	test.S(t).ExpectEquals(dumpStatementRows("/*!40000 INSERT INTO `values` (`id`,`values`) VALUES(1,2),(3,4) */"), int64(2))
+	test.S(t).ExpectEquals(dumpStatementRows("insert into tbvalues value (1)"), int64(1))
+	test.S(t).ExpectEquals(dumpStatementRows("REPLACE INTO a SET id = 1"), int64(1))
+	test.S(t).ExpectEquals(dumpStatementRows("CREATE TABLE a (id int, v int)"), int64(0))
+}
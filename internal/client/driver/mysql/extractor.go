@@ -7,22 +7,23 @@
 package mysql
 
 import (
+	"context"
 	gosql "database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/actiontech/dtle/internal/chaos"
 	"github.com/actiontech/dtle/internal/g"
 
 	//"math"
 	"bytes"
-	"encoding/gob"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/golang/snappy"
 	gonats "github.com/nats-io/go-nats"
 	gomysql "github.com/siddontang/go-mysql/mysql"
 
@@ -43,6 +44,9 @@ const (
 	DefaultConnectWaitSecond      = 10
 	DefaultConnectWait            = DefaultConnectWaitSecond * time.Second
 	ReconnectStreamerSleepSeconds = 5
+	// the task events the agent has not taken yet, beyond which they are
+	// dropped
+	taskEventsBufferSize = 16
 )
 
 // Extractor is the main schema extract flow manager.
@@ -55,11 +59,14 @@ type Extractor struct {
 	db           *gosql.DB
 	singletonDB  *gosql.DB
 	dumpers      []*dumper
+	dumpersLock  sync.Mutex
 	// db.tb exists when creating the job, for full-copy.
 	// vs e.mysqlContext.ReplicateDoDb: all user assigned db.tb
 	replicateDoDb            []*config.DataSource
+	tableFilter              *config.TableFilter
 	binlogChannel            chan *binlog.BinlogTx
 	dataChannel              chan *binlog.BinlogEntry
+	pipeline                 pipeline
 	inspector                *Inspector
 	binlogReader             *binlog.BinlogReader
 	initialBinlogCoordinates *base.BinlogCoordinatesX
@@ -67,30 +74,77 @@ type Extractor struct {
 	rowCopyComplete          chan bool
 	rowCopyCompleteFlag      int64
 	tableCount               int
+	// rows sent in full copy, by "schema.table"
+	tableRowsCopied map[string]int64
+	// the progress of an interrupted copy, told by the applier. nil if the
+	// copy starts from scratch
+	copyProgress *models.CopyProgress
 
 	sendByTimeoutCounter  int
 	sendBySizeFullCounter int
 
+	extractedBytes int64
+	wireBytes      int64
+	// the id of the last message sent in chunks
+	chunkedMsgID uint64
+
+	// nil unless WatchOnly is set
+	watch *watchBuffer
+	// nil unless the job has EncryptTransit
+	transit *transitCipher
+	// nil for snappy without a frame, unless TransportCodec is negotiated
+	codec      *registeredCodec
+	codecStats codecStats
+	// the GTID set sent to the applier, for the lag of a migration job. nil
+	// for other jobs, or until the binlog is read
+	sentGtidLock sync.Mutex
+	sentGtid     *gomysql.MysqlGTIDSet
+
 	natsConn *gonats.Conn
 	waitCh   chan *models.WaitResult
 
 	shutdown     bool
 	shutdownCh   chan struct{}
 	shutdownLock sync.Mutex
+	// cancelled on shutdown, stopping the queries running
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	testStub1Delay int64
+	// unregisters the task from fault injection on shutdown
+	unregisterChaos func()
 
 	context *sqle.Context
+	// limits nothing unless RowsPerSecond or ThrottleWindows are set
+	rowLimiter *rowLimiter
+	// nil unless Orchestrator is set
+	orchestrator *orchestratorClient
+	// guards binlogReader, which followMaster reads
+	binlogReaderLock sync.Mutex
+
+	sourceHealth *base.ConnTracker
+	natsHealth   *base.ConnTracker
+
+	// queries the schemas and the tables of the source
+	metadata *metadataQuerier
+	// the events of the task for the agent, e.g. the source being degraded
+	taskEvents chan *models.TaskEvent
+
+	// guards the TunableConfig of mysqlContext, which Tune changes
+	tuneLock sync.RWMutex
+	logLevel *taskLogLevel
 }
 
 func NewExtractor(subject, tp string, maxPayload int, cfg *config.MySQLDriverConfig, logger *log.Logger) (*Extractor, error) {
 
 	cfg = cfg.SetDefault()
-	entry := log.NewEntry(logger).WithFields(log.Fields{
+	logLevel := newTaskLogLevel(logger, cfg.LogLevel)
+	entry := log.NewEntry(logLevel.logger).WithFields(log.Fields{
 		"job": subject,
 	})
 	e := &Extractor{
 		logger:          entry,
+		logLevel:        logLevel,
 		subject:         subject,
 		tp:              tp,
 		maxPayload:      maxPayload,
@@ -101,9 +155,75 @@ func NewExtractor(subject, tp string, maxPayload int, cfg *config.MySQLDriverCon
 		waitCh:          make(chan *models.WaitResult, 1),
 		shutdownCh:      make(chan struct{}),
 		testStub1Delay:  0,
+		tableRowsCopied: make(map[string]int64),
 		context:                 sqle.NewContext(nil),
+		sourceHealth:    base.NewConnTracker(models.ConnSourceQuery),
+		natsHealth:      base.NewConnTracker(models.ConnNats),
+		chunkedMsgID:    uint64(time.Now().UnixNano()),
+		taskEvents:      make(chan *models.TaskEvent, taskEventsBufferSize),
+	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	e.metadata = newMetadataQuerier(e.ctx, cfg, e.logger)
+	e.metadata.health = e.sourceHealth
+	e.metadata.breaker.onDegraded = func(err error) {
+		e.logger.Warnf("mysql.extractor: source is degraded. waiting %v before querying its metadata again: %v",
+			e.metadata.breaker.openFor, err)
+		e.emitTaskEvent(models.NewTaskEvent(models.TaskSourceDegraded).SetDriverError(err))
+	}
+	e.metadata.breaker.onRecovered = func() {
+		e.logger.Printf("mysql.extractor: source recovered")
+		e.emitTaskEvent(models.NewTaskEvent(models.TaskSourceRecovered))
 	}
 	e.context.LoadSchemas(nil)
+	if err := validateTransportCodec(cfg.TransportCodec); err != nil {
+		return nil, err
+	}
+	if cfg.StatementBinlog != config.StatementBinlogError && cfg.StatementBinlog != config.StatementBinlogApply {
+		return nil, fmt.Errorf("invalid StatementBinlog %q: must be %q or %q",
+			cfg.StatementBinlog, config.StatementBinlogError, config.StatementBinlogApply)
+	}
+	if cfg.TxSplitRows < 0 || (cfg.TxSplitRows > 0 && !cfg.ApproveHeterogeneous) {
+		return nil, fmt.Errorf("invalid TxSplitRows %d: it is positive, and needs ApproveHeterogeneous", cfg.TxSplitRows)
+	}
+	transit, err := newTransitCipher(cfg.TransitKeys)
+	if err != nil {
+		return nil, err
+	}
+	if transit != nil {
+		e.transit = transit
+		// leave room for the encryption within the payload of NATS
+		e.maxPayload -= transit.overhead()
+	}
+	if cfg.WatchOnly {
+		e.watch = newWatchBuffer(cfg.WatchBufferSize)
+	}
+	// the binlog reader waits for room: the backpressure reaches the binlog dump
+	if cfg.ApproveHeterogeneous {
+		e.pipeline.queue("transport", config.QueueFullBlock,
+			func() int { return len(e.dataChannel) }, cap(e.dataChannel))
+	} else {
+		e.pipeline.queue("transport", config.QueueFullBlock,
+			func() int { return len(e.binlogChannel) }, cap(e.binlogChannel))
+	}
+	schedule, err := models.NewThrottleSchedule(cfg.ThrottleWindows)
+	if err != nil {
+		return nil, err
+	}
+	e.rowLimiter = newRowLimiter(cfg.RowsPerSecond, schedule)
+	if e.rowLimiter == nil {
+		// RowsPerSecond may be tuned later
+		e.rowLimiter = &rowLimiter{}
+	}
+	e.rowLimiter.onWindow = func(w *models.ThrottleWindow) {
+		switch {
+		case w == nil:
+			e.logger.Infof("mysql.extractor: out of the throttle windows")
+		case w.RowsPerSecond == 0:
+			e.logger.Infof("mysql.extractor: throttle window %v, the copy is paused", w)
+		default:
+			e.logger.Infof("mysql.extractor: throttle window %v, limited to %d rows per second", w, w.RowsPerSecond)
+		}
+	}
 
 	if delay, err := strconv.ParseInt(os.Getenv(g.ENV_TESTSTUB1_DELAY), 10, 64); err == nil {
 		e.logger.Infof("%v = %v", g.ENV_TESTSTUB1_DELAY, delay)
@@ -150,8 +270,13 @@ func (e *Extractor) retryOperation(operation func() error, notFatalHint ...bool)
 
 // Run executes the complete extract logic.
 func (e *Extractor) Run() {
+	e.unregisterChaos = chaos.Register(e.subject, models.TaskTypeSrc, func() {
+		e.onError(TaskStateDead, chaos.ErrKilled)
+	})
+
 	e.logger.Printf("mysql.extractor: Extract binlog events from %s.%d", e.mysqlContext.ConnectionConfig.Host, e.mysqlContext.ConnectionConfig.Port)
 	e.mysqlContext.StartTime = time.Now()
+	go e.pipeline.run(e.shutdownCh)
 
 	// Validate job arguments
 	{
@@ -160,16 +285,33 @@ func (e *Extractor) Run() {
 				fmt.Errorf("conflicting job argument: SkipCreateDbTable=true and DropTableIfExists=true"))
 			return
 		}
+		if e.mysqlContext.DumpSource != "" &&
+			(e.mysqlContext.Gtid != "" || e.mysqlContext.AutoGtid || e.mysqlContext.GtidStart != "") {
+			e.onError(TaskStateDead,
+				fmt.Errorf("conflicting job argument: DumpSource should not be used with Gtid, GtidStart or AutoGtid"))
+			return
+		}
 	}
 
-	if err := e.initiateInspector(); err != nil {
+	if err := e.useOrchestratorMaster(); err != nil {
 		e.onError(TaskStateDead, err)
 		return
 	}
-	if err := e.initNatsPubClient(); err != nil {
+	if err := e.checkProxy(); err != nil {
+		e.onError(TaskStateDead, err)
+		return
+	}
+	if err := e.initiateInspector(); err != nil {
 		e.onError(TaskStateDead, err)
 		return
 	}
+	if e.watch == nil {
+		if err := e.initNatsPubClient(); err != nil {
+			e.onError(TaskStateDead, err)
+			return
+		}
+		e.negotiateCodec()
+	}
 	if err := e.initDBConnections(); err != nil {
 		e.onError(TaskStateDead, err)
 		return
@@ -178,8 +320,9 @@ func (e *Extractor) Run() {
 	fullCopy := true
 
 	if e.mysqlContext.Gtid == "" {
-		if e.mysqlContext.AutoGtid {
-			coord, err := base.GetSelfBinlogCoordinates(e.db)
+		// a watch-only job has nowhere to copy the existing rows to
+		if e.mysqlContext.AutoGtid || e.watch != nil {
+			coord, err := e.selfBinlogCoordinates()
 			if err != nil {
 				e.onError(TaskStateDead, err)
 				return
@@ -190,7 +333,7 @@ func (e *Extractor) Run() {
 		}
 
 		if e.mysqlContext.GtidStart != "" {
-			coord, err := base.GetSelfBinlogCoordinates(e.db)
+			coord, err := e.selfBinlogCoordinates()
 			if err != nil {
 				e.onError(TaskStateDead, err)
 				return
@@ -209,11 +352,25 @@ func (e *Extractor) Run() {
 
 	if fullCopy {
 		e.mysqlContext.MarkRowCopyStartTime()
-		if err := e.mysqlDump(); err != nil {
-			e.onError(TaskStateDead, err)
-			return
+		if e.mysqlContext.DumpSource != "" {
+			if err := e.importDumpSource(); err != nil {
+				e.onError(TaskStateDead, err)
+				return
+			}
+		} else {
+			e.copyProgress = e.requestCopyProgress()
+			if err := e.mysqlDump(); err != nil {
+				e.onError(TaskStateDead, err)
+				return
+			}
 		}
-		dumpMsg, err := Encode(&dumpStatResult{Gtid: e.initialBinlogCoordinates.GtidSet, TotalCount: e.mysqlContext.RowsEstimate})
+		dumpMsg, err := e.encode(&DumpStatResult{
+			Gtid:       e.initialBinlogCoordinates.GtidSet,
+			LogFile:    e.initialBinlogCoordinates.LogFile,
+			LogPos:     e.initialBinlogCoordinates.LogPos,
+			TotalCount: e.mysqlContext.RowsEstimate,
+			TableRows:  e.tableRowsCopied,
+		})
 		if err != nil {
 			e.onError(TaskStateDead, err)
 		}
@@ -257,6 +414,8 @@ func (e *Extractor) Run() {
 // - schema validation
 func (e *Extractor) initiateInspector() (err error) {
 	e.inspector = NewInspector(e.mysqlContext, e.logger)
+	e.inspector.ctx = e.ctx
+	e.inspector.metadata = e.metadata
 	if err := e.inspector.InitDBConnections(); err != nil {
 		return err
 	}
@@ -265,74 +424,56 @@ func (e *Extractor) initiateInspector() (err error) {
 }
 
 func (e *Extractor) inspectTables() (err error) {
+	e.tableFilter, err = config.NewTableFilter(e.mysqlContext.ReplicateDoDb, e.mysqlContext.ReplicateIgnoreDb)
+	if err != nil {
+		return err
+	}
 	// Creates a MYSQL Dump based on the options supplied through the dumper.
-	if len(e.mysqlContext.ReplicateDoDb) > 0 {
-		for _, doDb := range e.mysqlContext.ReplicateDoDb {
-			if doDb.TableSchema == "" {
-				continue
-			}
-			db := &config.DataSource{
-				TableSchema: doDb.TableSchema,
-			}
-
-			if len(doDb.Tables) == 0 {
-				tbs, err := sql.ShowTables(e.db, doDb.TableSchema, e.mysqlContext.ExpandSyntaxSupport)
-				if err != nil {
-					return err
-				}
-				for _, doTb := range tbs {
-					doTb.TableSchema = doDb.TableSchema
-					if err := e.inspector.ValidateOriginalTable(doDb.TableSchema, doTb.TableName, doTb); err != nil {
-						e.logger.Warnf("mysql.extractor: %v", err)
-						continue
-					}
-					db.Tables = append(db.Tables, doTb)
-				}
-			} else {
-				for _, doTb := range doDb.Tables {
-					doTb.TableSchema = doDb.TableSchema
-					if err := e.inspector.ValidateOriginalTable(doDb.TableSchema, doTb.TableName, doTb); err != nil {
-						e.logger.Warnf("mysql.extractor: %v", err)
-						continue
-					}
-					db.Tables = append(db.Tables, doTb)
-				}
-			}
-
-			e.replicateDoDb = append(e.replicateDoDb, db)
+	var dbs []string
+	err = e.metadata.query("listing the databases", func(ctx context.Context) (err error) {
+		dbs, err = showFilteredDatabases(ctx, e.db, e.tableFilter)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, dbName := range dbs {
+		ds := &config.DataSource{
+			TableSchema: dbName,
 		}
-	} else {
-		dbs, err := sql.ShowDatabases(e.db)
+
+		var tbs []*config.Table
+		err := e.metadata.query("listing the tables", func(ctx context.Context) (err error) {
+			tbs, err = sql.ShowTables(ctx, e.db, dbName, e.mysqlContext.ExpandSyntaxSupport)
+			return err
+		})
 		if err != nil {
 			return err
 		}
-		for _, dbName := range dbs {
-			ds := &config.DataSource{
-				TableSchema: dbName,
-			}
-			if len(e.mysqlContext.ReplicateIgnoreDb) > 0 && e.ignoreDb(dbName) {
+		for _, tb := range tbs {
+			if !e.tableFilter.MatchTable(dbName, tb.TableName) {
 				continue
 			}
-
-			tbs, err := sql.ShowTables(e.db, dbName, e.mysqlContext.ExpandSyntaxSupport)
-			if err != nil {
-				return err
-			}
-
-			for _, tb := range tbs {
-				if len(e.mysqlContext.ReplicateIgnoreDb) > 0 && e.ignoreTb(dbName, tb.TableName) {
-					continue
-				}
-				if err := e.inspector.ValidateOriginalTable(dbName, tb.TableName, tb); err != nil {
-					e.logger.Warnf("mysql.extractor: %v", err)
-					continue
+			tb.TableSchema = dbName
+			tb.Where = e.tableWhere(dbName, tb.TableName)
+			if err := e.inspector.ValidateOriginalTable(dbName, tb.TableName, tb); err != nil {
+				if e.mysqlContext.Strict {
+					return fmt.Errorf("strict: table %v.%v cannot be replicated: %v", dbName, tb.TableName, err)
 				}
-
-				ds.Tables = append(ds.Tables, tb)
+				e.logger.Warnf("mysql.extractor: %v", err)
+				continue
 			}
-			e.replicateDoDb = append(e.replicateDoDb, ds)
+			ds.Tables = append(ds.Tables, tb)
+		}
+		e.replicateDoDb = append(e.replicateDoDb, ds)
+	}
+	e.warnMissingTables()
+	if e.mysqlContext.Strict {
+		if err := e.checkStrictTables(); err != nil {
+			return err
 		}
 	}
+
 	/*if e.mysqlContext.ExpandSyntaxSupport {
 		db_mysql := &config.DataSource{
 			TableSchema: "mysql",
@@ -356,22 +497,35 @@ func (e *Extractor) inspectTables() (err error) {
 
 	return nil
 }
-func (e *Extractor) ignoreDb(dbName string) bool {
-	for _, ignoreDb := range e.mysqlContext.ReplicateIgnoreDb {
-		if ignoreDb.TableSchema == dbName && len(ignoreDb.Tables) == 0 {
-			return true
+
+// warnMissingTables logs the tables named by ReplicateDoDb which are not
+// found on the source, or excluded by ReplicateIgnoreDb.
+func (e *Extractor) warnMissingTables() {
+	for _, doDb := range e.mysqlContext.ReplicateDoDb {
+		if doDb.TableSchema == "" || config.IsTablePattern(doDb.TableSchema) {
+			continue
+		}
+		for _, doTb := range doDb.Tables {
+			if config.IsTablePattern(doTb.TableName) || e.isReplicated(doDb.TableSchema, doTb.TableName) {
+				continue
+			}
+			if e.tableFilter.MatchTable(doDb.TableSchema, doTb.TableName) {
+				e.logger.Warnf("mysql.extractor: table %v.%v is not found or not valid", doDb.TableSchema, doTb.TableName)
+			} else {
+				e.logger.Warnf("mysql.extractor: table %v.%v is excluded by ReplicateIgnoreDb", doDb.TableSchema, doTb.TableName)
+			}
 		}
 	}
-	return false
 }
 
-func (e *Extractor) ignoreTb(dbName, tbName string) bool {
-	for _, ignoreDb := range e.mysqlContext.ReplicateIgnoreDb {
-		if ignoreDb.TableSchema == dbName {
-			for _, ignoreTb := range ignoreDb.Tables {
-				if ignoreTb.TableName == tbName {
-					return true
-				}
+func (e *Extractor) isReplicated(schema, table string) bool {
+	for _, ds := range e.replicateDoDb {
+		if ds.TableSchema != schema {
+			continue
+		}
+		for _, tb := range ds.Tables {
+			if tb.TableName == table {
+				return true
 			}
 		}
 	}
@@ -414,6 +568,9 @@ func (e *Extractor) initiateStreaming() error {
 			e.onError(TaskStateDead, err)
 		}
 	}()
+	if e.watch != nil {
+		return nil
+	}
 
 	go func() {
 		_, err := e.natsConn.Subscribe(fmt.Sprintf("%s_restart", e.subject), func(m *gonats.Msg) {
@@ -431,6 +588,20 @@ func (e *Extractor) initiateStreaming() error {
 		if err != nil {
 			e.onError(TaskStateDead, err)
 		}
+
+		// a migration job is completed by the applier
+		_, err = e.natsConn.Subscribe(fmt.Sprintf("%s_complete", e.subject), func(m *gonats.Msg) {
+			e.mysqlContext.Gtid = string(m.Data)
+			e.onError(TaskStateComplete, nil)
+		})
+		if err != nil {
+			e.onError(TaskStateDead, err)
+		}
+		if e.mysqlContext.Migration {
+			if err := e.answerMigrationLag(); err != nil {
+				e.onError(TaskStateDead, err)
+			}
+		}
 	}()
 	return nil
 }
@@ -442,13 +613,17 @@ func (e *Extractor) initDBConnections() (err error) {
 		return err
 	}
 	//https://github.com/go-sql-driver/mysql#system-variables
-	dumpUri := fmt.Sprintf("%s&tx_isolation='REPEATABLE-READ'", e.mysqlContext.ConnectionConfig.GetSingletonDBUri())
+	// the snapshot has to be on the server of the binlog, not behind a proxy
+	dumpUri := fmt.Sprintf("%s&tx_isolation='REPEATABLE-READ'", e.mysqlContext.ConnectionConfig.Direct().GetSingletonDBUri())
 	if e.singletonDB, err = sql.CreateDB(dumpUri); err != nil {
 		return err
 	}
 	if err := e.validateConnection(); err != nil {
 		return err
 	}
+	if err := e.validateGtidMode(); err != nil {
+		return err
+	}
 	if err := e.validateAndReadTimeZone(); err != nil {
 		return err
 	}
@@ -476,7 +651,11 @@ func (e *Extractor) getSchemaTablesAndMeta() error {
 				continue
 			}
 
-			stmts, err := base.ShowCreateTable(e.db, db.TableSchema, tb.TableName, false, false)
+			var stmts []string
+			err := e.metadata.query("reading the create table", func(ctx context.Context) (err error) {
+				stmts, err = base.ShowCreateTable(ctx, e.db, db.TableSchema, tb.TableName, false, false)
+				return err
+			})
 			if err != nil {
 				e.logger.Errorf("error at ShowCreateTable. err: %v", err)
 				return err
@@ -514,23 +693,66 @@ func (e *Extractor) initBinlogReader(binlogCoordinates *base.BinlogCoordinatesX)
 		e.logger.Debugf("mysql.extractor: err at initBinlogReader: ConnectBinlogStreamer: %v", err.Error())
 		return err
 	}
+	if err := e.startSentGtid(binlogCoordinates.GtidSet); err != nil {
+		return err
+	}
+	e.binlogReaderLock.Lock()
 	e.binlogReader = binlogReader
+	e.binlogReaderLock.Unlock()
 	return nil
 }
 
+// queryContext bounds a query on the metadata or the status of the source by
+// QueryTimeoutSeconds. The caller cancels it once the rows are read.
+func (e *Extractor) queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(e.ctx, e.mysqlContext.QueryTimeout())
+}
+
+// selfBinlogCoordinates reads the master status of the server of the binlog
+func (e *Extractor) selfBinlogCoordinates() (*base.BinlogCoordinatesX, error) {
+	ctx, cancel := e.queryContext()
+	defer cancel()
+	return base.GetSelfBinlogCoordinates(ctx, e.singletonDB)
+}
+
 // validateConnection issues a simple can-connect to MySQL
 func (e *Extractor) validateConnection() error {
+	ctx, cancel := e.queryContext()
+	defer cancel()
 	query := `select @@global.version`
-	if err := e.db.QueryRow(query).Scan(&e.mysqlContext.MySQLVersion); err != nil {
+	if err := e.db.QueryRowContext(ctx, query).Scan(&e.mysqlContext.MySQLVersion); err != nil {
 		return err
 	}
 	e.logger.Printf("mysql.extractor: Connection validated on %s:%d", e.mysqlContext.ConnectionConfig.Host, e.mysqlContext.ConnectionConfig.Port)
 	return nil
 }
 
+// validateGtidMode checks that the server of the binlog has GTIDs, which the
+// binlog is read by and the position of the job is kept as
+func (e *Extractor) validateGtidMode() error {
+	ctx, cancel := e.queryContext()
+	defer cancel()
+	var gtidMode string
+	if err := e.singletonDB.QueryRowContext(ctx, `select @@global.gtid_mode`).Scan(&gtidMode); err != nil {
+		return err
+	}
+	return checkGtidMode(gtidMode)
+}
+
+// checkGtidMode rejects a gtid_mode of the source but ON. ON_PERMISSIVE
+// lets transactions without GTIDs into the binlog too.
+func checkGtidMode(gtidMode string) error {
+	if strings.ToUpper(gtidMode) != "ON" {
+		return fmt.Errorf("gtid_mode of the source is %v. the job replicates by GTID, and needs gtid_mode=ON", gtidMode)
+	}
+	return nil
+}
+
 func (e *Extractor) selectSqlMode() error {
+	ctx, cancel := e.queryContext()
+	defer cancel()
 	query := `select @@global.sql_mode`
-	if err := e.db.QueryRow(query).Scan(&e.mysqlContext.SqlMode); err != nil {
+	if err := e.db.QueryRowContext(ctx, query).Scan(&e.mysqlContext.SqlMode); err != nil {
 		return err
 	}
 	return nil
@@ -547,7 +769,7 @@ func (e *Extractor) readCurrentBinlogCoordinates() error {
 			GtidSet: gtidSet.String(),
 		}
 	} else {
-		binlogCoordinates, err := base.GetSelfBinlogCoordinates(e.db)
+		binlogCoordinates, err := e.selfBinlogCoordinates()
 		if err != nil {
 			return err
 		}
@@ -558,8 +780,10 @@ func (e *Extractor) readCurrentBinlogCoordinates() error {
 }
 
 func (e *Extractor) validateAndReadTimeZone() error {
+	ctx, cancel := e.queryContext()
+	defer cancel()
 	query := `select @@global.time_zone`
-	if err := e.db.QueryRow(query).Scan(&e.mysqlContext.TimeZone); err != nil {
+	if err := e.db.QueryRowContext(ctx, query).Scan(&e.mysqlContext.TimeZone); err != nil {
 		return err
 	}
 
@@ -581,11 +805,17 @@ func (e *Extractor) CountTableRows(table *config.Table) (int64, error) {
 			table.TableSchema, table.TableName)
 	} else {
 		method = "COUNT"
+		where := table.Where
+		if table.Iteration > 0 && table.UseUniqueKey != nil {
+			// the rows left to a resumed copy
+			where = fmt.Sprintf("(%s) and (%s)", where, uniqueKeyRange(table.UseUniqueKey))
+		}
 		query = fmt.Sprintf(`select count(*) as rows from %s.%s where (%s)`,
-			sql.EscapeName(table.TableSchema), sql.EscapeName(table.TableName), table.Where)
+			sql.EscapeName(table.TableSchema), sql.EscapeName(table.TableName), where)
 	}
 	var rowsEstimate int64
-	if err := e.db.QueryRow(query).Scan(&rowsEstimate); err != nil {
+	// a count of the rows scans the table, and is not bounded
+	if err := e.db.QueryRowContext(e.ctx, query).Scan(&rowsEstimate); err != nil {
 		return 0, err
 	}
 	atomic.AddInt64(&e.mysqlContext.RowsEstimate, rowsEstimate)
@@ -595,10 +825,27 @@ func (e *Extractor) CountTableRows(table *config.Table) (int64, error) {
 	return rowsEstimate, nil
 }
 
+// estimateTableSize reads the row estimate and the average row length of a table
+// from information_schema. They are statistics of the storage engine, not exact.
+func (e *Extractor) estimateTableSize(table *config.Table) error {
+	query := `select ifnull(table_rows, 0), ifnull(avg_row_length, 0), ifnull(data_length, 0)
+		from information_schema.tables where table_schema = ? and table_name = ?`
+	return e.metadata.query("estimating the table size", func(ctx context.Context) error {
+		err := e.db.QueryRowContext(ctx, query, table.TableSchema, table.TableName).Scan(
+			&table.RowsEstimate, &table.AvgRowLength, &table.DataLength)
+		if err == gosql.ErrNoRows {
+			return nil
+		}
+		return err
+	})
+}
+
 // Read the MySQL charset-related system variables.
 func (e *Extractor) readMySqlCharsetSystemVariables() error {
+	ctx, cancel := e.queryContext()
+	defer cancel()
 	query := `show variables where Variable_name IN ('character_set_server','collation_server')`
-	rows, err := e.db.Query(query)
+	rows, err := e.db.QueryContext(ctx, query)
 	if err != nil {
 		return err
 	}
@@ -656,14 +903,14 @@ func (e *Extractor) setStatementFor() string {
 	return buffer.String()
 }
 
-// Encode
+// Encode encodes a message with gob and snappy, which any applier decodes
 func Encode(v interface{}) ([]byte, error) {
-	b := new(bytes.Buffer)
-	if err := gob.NewEncoder(b).Encode(v); err != nil {
-		return nil, err
-	}
-	return snappy.Encode(nil, b.Bytes()), nil
-	//return b.Bytes(), nil
+	return encodeWith(v, nil, nil)
+}
+
+// encode encodes a message with the negotiated codec
+func (e *Extractor) encode(v interface{}) ([]byte, error) {
+	return encodeWith(v, e.codec, &e.codecStats)
 }
 
 // StreamEvents will begin streaming events. It will be blocking, so should be
@@ -682,7 +929,18 @@ func (e *Extractor) StreamEvents() error {
 					gno = entries.Entries[0].Coordinates.GNO
 				}
 
-				txMsg, err := Encode(entries)
+				if e.watch != nil {
+					e.watch.add(entries.Entries)
+					atomic.AddInt64(&e.extractedBytes, int64(entriesSize))
+					entries.Entries = nil
+					entriesSize = 0
+					return nil
+				}
+
+				if err := checkEntriesRowSize(entries.Entries, e.maxRowSize()); err != nil {
+					return err
+				}
+				txMsg, err := e.encode(entries)
 				if err != nil {
 					return err
 				}
@@ -691,7 +949,9 @@ func (e *Extractor) StreamEvents() error {
 				if err = e.publish(fmt.Sprintf("%s_incr_hete", e.subject), "", txMsg); err != nil {
 					return err
 				}
+				atomic.AddInt64(&e.extractedBytes, int64(entriesSize))
 				e.logger.Debugf("mysql.extractor: send acked gno: %v, n: %v", gno, len(entries.Entries))
+				e.entriesSent(entries.Entries)
 
 				entries.Entries = nil
 				entriesSize = 0
@@ -701,18 +961,20 @@ func (e *Extractor) StreamEvents() error {
 
 			keepGoing := true
 
-			groupTimeoutDuration := time.Duration(e.mysqlContext.GroupTimeout) * time.Millisecond
+			_, groupTimeoutDuration := e.groupLimits()
 			timer := time.NewTimer(groupTimeoutDuration)
 			defer timer.Stop()
 
 			for keepGoing && !e.shutdown {
 				var err error
+				groupMaxSize, groupTimeoutDuration := e.groupLimits()
 				select {
 				case binlogEntry := <-e.dataChannel:
+					e.rowLimiter.wait(int64(len(binlogEntry.Events)), e.shutdownCh)
 					entries.Entries = append(entries.Entries, binlogEntry)
 					entriesSize += binlogEntry.OriginalSize
 
-					if entriesSize >= e.mysqlContext.GroupMaxSize ||
+					if entriesSize >= groupMaxSize ||
 						int64(len(entries.Entries)) == e.mysqlContext.ReplChanBufferSize {
 						e.logger.Debugf("extractor. incr. send by GroupLimit. entriesSize: %v", entriesSize)
 						err = sendEntries()
@@ -752,7 +1014,7 @@ func (e *Extractor) StreamEvents() error {
 							continue
 						}
 						entryArray = append(entryArray, binlogEntry)
-						txMsg, err := Encode(&entryArray)
+						txMsg, err := e.encode(&entryArray)
 						if err != nil {
 							e.onError(TaskStateDead, err)
 							break L
@@ -773,7 +1035,7 @@ func (e *Extractor) StreamEvents() error {
 				case <-time.After(100 * time.Millisecond):
 					{
 						if len(entryArray) != 0 {
-							txMsg, err := Encode(&entryArray)
+							txMsg, err := e.encode(&entryArray)
 							if err != nil {
 								e.onError(TaskStateDead, err)
 								break L
@@ -823,10 +1085,11 @@ func (e *Extractor) StreamEvents() error {
 						if nil == binlogTx {
 							continue
 						}
+						e.rowLimiter.wait(1, e.shutdownCh)
 						txArray = append(txArray, binlogTx)
 						txBytes += len([]byte(binlogTx.Query))
 						if txBytes > e.mysqlContext.MsgBytesLimit {
-							txMsg, err := Encode(&txArray)
+							txMsg, err := e.encode(&txArray)
 							if err != nil {
 								e.onError(TaskStateDead, err)
 								break L
@@ -847,7 +1110,7 @@ func (e *Extractor) StreamEvents() error {
 				case <-time.After(100 * time.Millisecond):
 					{
 						if len(txArray) != 0 {
-							txMsg, err := Encode(&txArray)
+							txMsg, err := e.encode(&txArray)
 							if err != nil {
 								e.onError(TaskStateDead, err)
 								break L
@@ -887,29 +1150,46 @@ func (e *Extractor) StreamEvents() error {
 	return nil
 }
 
-// retryOperation attempts up to `count` attempts at running given function,
-// exiting as soon as it returns with non-error.
+// publish sends a message to the applier and waits for its ack, sending it
+// again on a timeout. A message larger than the max payload of NATS is sent
+// in chunks, all of them again if the last one is not acked.
 func (e *Extractor) publish(subject, gtid string, txMsg []byte) (err error) {
-	for {
-		e.logger.Debugf("mysql.extractor: publish. gtid: %v, msg_len: %v", gtid, len(txMsg))
-		_, err = e.natsConn.Request(subject, txMsg, DefaultConnectWait)
+	var chunks [][]byte
+	if len(txMsg) > e.maxPayload {
+		if chunks, err = splitMsg(atomic.AddUint64(&e.chunkedMsgID, 1), txMsg, e.maxPayload); err != nil {
+			return err
+		}
+		e.logger.Debugf("mysql.extractor: publish. gtid: %v, msg_len: %v in %d chunks", gtid, len(txMsg), len(chunks))
+	} else {
+		chunks = [][]byte{txMsg}
+	}
+	for i := range chunks {
+		if chunks[i], err = e.transit.seal(subject, chunks[i]); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < len(chunks); {
+		e.logger.Debugf("mysql.extractor: publish. gtid: %v, msg_len: %v", gtid, len(chunks[i]))
+		atomic.AddInt64(&e.wireBytes, int64(len(chunks[i])))
+		_, err = e.natsConn.Request(subject, chunks[i], DefaultConnectWait)
+		e.natsHealth.Observe(err)
 		if err == nil {
-			if gtid != "" {
-				e.mysqlContext.Gtid = gtid
-			}
-			break
+			i++
 		} else if err == gonats.ErrTimeout {
 			e.logger.Debugf("mysql.extractor: publish timeout, got %v", err)
-			continue
+			if i == len(chunks)-1 {
+				// the applier may have dropped the reassembled message
+				i = 0
+			}
 		} else {
 			e.logger.Errorf("mysql.extractor: unexpected error on publish, got %v", err)
-			break
+			return err
 		}
-		// there's an error. Let's try again.
-		e.logger.Debugf(fmt.Sprintf("mysql.extractor: there's an error [%v]. Let's try again", err))
-		time.Sleep(1 * time.Second)
 	}
-	return err
+	if gtid != "" {
+		e.mysqlContext.Gtid = gtid
+	}
+	return nil
 }
 
 func (e *Extractor) testStub1() {
@@ -922,8 +1202,13 @@ func (e *Extractor) testStub1() {
 
 //Perform the snapshot using the same logic as the "mysqldump" utility.
 func (e *Extractor) mysqlDump() error {
-	defer e.singletonDB.Close()
+	if !e.mysqlContext.Migration {
+		// a migration job reads the master status for its lag, until shutdown
+		defer e.singletonDB.Close()
+	}
 	var tx sql.QueryAble
+	// one snapshot per table copied at the same time, tx being the first one
+	var copyTxs []sql.QueryAble
 	var err error
 	step := 0
 	// ------
@@ -999,25 +1284,55 @@ func (e *Extractor) mysqlDump() error {
 			if err != nil {
 				return err
 			}
+			var extraTxs []*gosql.Tx
+			// rollback ends the snapshots of this round, not to keep their
+			// read views on the source. It returns the first error.
+			rollback := func() error {
+				err := realTx.Rollback()
+				for _, extraTx := range extraTxs {
+					if rbErr := extraTx.Rollback(); err == nil {
+						err = rbErr
+					}
+				}
+				return err
+			}
 			query := "START TRANSACTION WITH CONSISTENT SNAPSHOT"
 			_, err = realTx.Exec(query)
 			if err != nil {
 				e.logger.Printf("[ERR] mysql.extractor: exec %+v, error: %v", query, err)
+				rollback()
 				return err
 			}
 
+			// the other snapshots are consistent with realTx if the GTID set
+			// does not change until they are all started
+			for i := 1; i < e.mysqlContext.CopyConcurrency; i++ {
+				extraTx, err := e.beginConsistentSnapshot()
+				if err != nil {
+					rollback()
+					return err
+				}
+				extraTxs = append(extraTxs, extraTx)
+			}
+
 			e.testStub1()
 
 			// 3
 			rows2, err := realTx.Query("show master status")
+			if err != nil {
+				rollback()
+				return err
+			}
 
 			// 4
 			binlogCoordinates1, err := base.ParseBinlogCoordinatesFromRows(rows1)
 			if err != nil {
+				rollback()
 				return err
 			}
 			binlogCoordinates2, err := base.ParseBinlogCoordinatesFromRows(rows2)
 			if err != nil {
+				rollback()
 				return err
 			}
 			e.logger.Debugf("mysql.extractor: binlog coordinates 1: %+v", binlogCoordinates1)
@@ -1034,6 +1349,12 @@ func (e *Extractor) mysqlDump() error {
 				e.initialBinlogCoordinates = binlogCoordinates2
 				e.logger.Printf("mysql.extractor: Step %d: read binlog coordinates of MySQL master: %+v", step, *e.initialBinlogCoordinates)
 
+				copyTxs = append(copyTxs, realTx)
+				for _, extraTx := range extraTxs {
+					copyTxs = append(copyTxs, extraTx)
+					defer extraTx.Commit()
+				}
+
 				defer func() {
 					/*e.logger.Printf("mysql.extractor: Step %d: releasing global read lock to enable MySQL writes", step)
 					query := "UNLOCK TABLES"
@@ -1049,8 +1370,7 @@ func (e *Extractor) mysqlDump() error {
 				}()
 			} else {
 				e.logger.Warningf("Failed got a consistenct TX with GTID in %v rounds. Will retry.", gtidMatchRound)
-				err = realTx.Rollback()
-				if err != nil {
+				if err := rollback(); err != nil {
 					return err
 				}
 				time.Sleep(delayBetweenRetries)
@@ -1068,6 +1388,15 @@ func (e *Extractor) mysqlDump() error {
 			return err
 		}
 		e.logger.Debugf("mysql.extractor: got gtid")
+		for i := 0; i < e.mysqlContext.CopyConcurrency; i++ {
+			copyTxs = append(copyTxs, tx)
+		}
+	}
+	if e.copyProgress != nil {
+		// the rows copied already are of the snapshot of the interrupted copy
+		e.initialBinlogCoordinates = e.resumedCoordinates()
+		e.logger.Printf("mysql.extractor: Step %d: resuming the copy of the snapshot at %+v",
+			step, *e.initialBinlogCoordinates)
 	}
 	step++
 
@@ -1091,10 +1420,23 @@ func (e *Extractor) mysqlDump() error {
 	}
 	for _, db := range e.replicateDoDb {
 		if len(db.Tables) > 0 {
+			tableCount := len(db.Tables)
 			for _, tb := range db.Tables {
 				if tb.TableSchema != db.TableSchema {
 					continue
 				}
+				watermark := e.resumeTable(tb)
+				if watermark != nil {
+					e.tableRowsCopied[fmt.Sprintf("%s.%s", tb.TableSchema, tb.TableName)] = watermark.Rows
+					if watermark.Done {
+						tableCount--
+						continue
+					}
+				}
+				if err := e.estimateTableSize(tb); err != nil {
+					return err
+				}
+				// the rows after the watermark of a resumed table
 				total, err := e.CountTableRows(tb)
 				if err != nil {
 					return err
@@ -1113,8 +1455,11 @@ func (e *Extractor) mysqlDump() error {
 						if err != nil {
 							return err
 						}*/
-					} else if strings.ToLower(tb.TableSchema) != "mysql" {
-						tbSQL, err = base.ShowCreateTable(e.singletonDB, tb.TableSchema, tb.TableName, e.mysqlContext.DropTableIfExists, true)
+					} else if strings.ToLower(tb.TableSchema) != "mysql" && watermark == nil {
+						// a resumed table keeps its rows
+						ctx, cancel := e.queryContext()
+						tbSQL, err = base.ShowCreateTable(ctx, e.singletonDB, tb.TableSchema, tb.TableName, e.mysqlContext.DropTableIfExists, true)
+						cancel()
 						if err != nil {
 							return err
 						}
@@ -1124,9 +1469,12 @@ func (e *Extractor) mysqlDump() error {
 					SystemVariablesStatement: setSystemVariablesStatement,
 					SqlMode:                  setSqlMode,
 					DbSQL:                    dbSQL,
+					TableSchema:              tb.TableSchema,
+					TableName:                tb.TableName,
 					TbSQL:                    tbSQL,
 					TotalCount:               tb.Counter + 1,
 					RowsCount:                1,
+					Coordinates:              e.initialBinlogCoordinates,
 				}
 				atomic.AddInt64(&e.mysqlContext.RowsEstimate, 1)
 				atomic.AddInt64(&e.mysqlContext.TotalRowsCopied, 1)
@@ -1134,7 +1482,7 @@ func (e *Extractor) mysqlDump() error {
 					e.onError(TaskStateRestart, err)
 				}
 			}
-			e.tableCount += len(db.Tables)
+			e.tableCount += tableCount
 		} else {
 			var dbSQL string
 			if !e.mysqlContext.SkipCreateDbTable {
@@ -1146,8 +1494,10 @@ func (e *Extractor) mysqlDump() error {
 				SystemVariablesStatement: setSystemVariablesStatement,
 				SqlMode:                  setSqlMode,
 				DbSQL:                    dbSQL,
+				TableSchema:              db.TableSchema,
 				TotalCount:               1,
 				RowsCount:                1,
+				Coordinates:              e.initialBinlogCoordinates,
 			}
 			atomic.AddInt64(&e.mysqlContext.RowsEstimate, 1)
 			atomic.AddInt64(&e.mysqlContext.TotalRowsCopied, 1)
@@ -1162,47 +1512,10 @@ func (e *Extractor) mysqlDump() error {
 	// STEP 5
 	// ------
 	// Dump all of the tables and generate source records ...
-	e.logger.Printf("mysql.extractor: Step %d: scanning contents of %d tables", step, e.tableCount)
+	e.logger.Printf("mysql.extractor: Step %d: scanning contents of %d tables, %d at a time",
+		step, e.tableCount, len(copyTxs))
 	startScan := utils.CurrentTimeMillis()
-	counter := 0
-	//pool := models.NewPool(10)
-	for _, db := range e.replicateDoDb {
-		for _, t := range db.Tables {
-			//pool.Add(1)
-			//go func(t *config.Table) {
-			counter++
-			// Obtain a record maker for this table, which knows about the schema ...
-			// Choose how we create statements based on the # of rows ...
-			e.logger.Printf("mysql.extractor: Step %d: - scanning table '%s.%s' (%d of %d tables)", step, t.TableSchema, t.TableName, counter, e.tableCount)
-
-			d := NewDumper(tx, t, e.mysqlContext.ChunkSize, e.logger)
-			if err := d.Dump(); err != nil {
-				e.onError(TaskStateDead, err)
-			}
-			e.dumpers = append(e.dumpers, d)
-			// Scan the rows in the table ...
-			for entry := range d.resultsChannel {
-				if entry.err != nil {
-					e.onError(TaskStateDead, entry.err)
-				} else {
-					entry.SystemVariablesStatement = setSystemVariablesStatement
-					entry.SqlMode = setSqlMode
-
-					if e.needToSendTabelDef() {
-						entry.Table = d.table
-					}
-					if err = e.encodeDumpEntry(entry); err != nil {
-						e.onError(TaskStateRestart, err)
-					}
-					atomic.AddInt64(&e.mysqlContext.TotalRowsCopied, entry.RowsCount)
-				}
-			}
-
-			//pool.Done()
-			//}(tb)
-		}
-	}
-	//pool.Wait()
+	e.copyTables(copyTxs, setSystemVariablesStatement, setSqlMode, step)
 	step++
 
 	// We've copied all of the tables, but our buffer holds onto the very last record.
@@ -1214,18 +1527,164 @@ func (e *Extractor) mysqlDump() error {
 
 	return nil
 }
+
+// beginConsistentSnapshot starts a transaction in the same way as the first
+// snapshot of mysqlDump.
+func (e *Extractor) beginConsistentSnapshot() (*gosql.Tx, error) {
+	tx, err := e.singletonDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	query := "START TRANSACTION WITH CONSISTENT SNAPSHOT"
+	if _, err := tx.Exec(query); err != nil {
+		e.logger.Printf("[ERR] mysql.extractor: exec %+v, error: %v", query, err)
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// copyTables copies the tables with one worker per snapshot. Tables are taken
+// biggest first, so a big table does not start last and lengthen the copy.
+func (e *Extractor) copyTables(txs []sql.QueryAble, setSystemVariablesStatement, setSqlMode string, step int) {
+	tables := tablesBySizeDesc(e.replicateDoDb)
+	tableCh := make(chan *config.Table, len(tables))
+	for _, t := range tables {
+		tableCh <- t
+	}
+	close(tableCh)
+
+	var counter int64
+	var tableRowsCopiedLock sync.Mutex
+	wg := sync.WaitGroup{}
+	for _, tx := range txs {
+		wg.Add(1)
+		go func(tx sql.QueryAble) {
+			defer wg.Done()
+			for t := range tableCh {
+				if e.tableCopied(t) {
+					continue
+				}
+				// Obtain a record maker for this table, which knows about the schema ...
+				// Choose how we create statements based on the # of rows ...
+				e.logger.Printf("mysql.extractor: Step %d: - scanning table '%s.%s' (%d of %d tables)",
+					step, t.TableSchema, t.TableName, atomic.AddInt64(&counter, 1), e.tableCount)
+
+				chunkSize := dynamicChunkSize(e.mysqlContext.ChunkTargetBytes, t.AvgRowLength, e.chunkSize())
+				e.logger.Debugf("mysql.extractor: table '%s.%s': avg row length %d, chunk size %d",
+					t.TableSchema, t.TableName, t.AvgRowLength, chunkSize)
+				d := NewDumper(tx, t, chunkSize, e.logger)
+				if err := d.Dump(); err != nil {
+					e.onError(TaskStateDead, err)
+				}
+				e.dumpersLock.Lock()
+				e.dumpers = append(e.dumpers, d)
+				e.dumpersLock.Unlock()
+				// Scan the rows in the table ...
+				for entry := range d.resultsChannel {
+					if entry.err != nil {
+						e.onError(TaskStateDead, entry.err)
+					} else {
+						entry.SystemVariablesStatement = setSystemVariablesStatement
+						entry.SqlMode = setSqlMode
+
+						if e.needToSendTabelDef() {
+							entry.Table = d.table
+						}
+						if err := e.encodeDumpEntry(entry); err != nil {
+							e.onError(TaskStateRestart, err)
+						}
+						atomic.AddInt64(&e.mysqlContext.TotalRowsCopied, entry.RowsCount)
+						tableRowsCopiedLock.Lock()
+						e.tableRowsCopied[fmt.Sprintf("%s.%s", t.TableSchema, t.TableName)] += entry.RowsCount
+						tableRowsCopiedLock.Unlock()
+					}
+				}
+				if d.done {
+					// so that a resumed copy skips the table
+					entry := &DumpEntry{
+						SystemVariablesStatement: setSystemVariablesStatement,
+						SqlMode:                  setSqlMode,
+						TableSchema:              t.TableSchema,
+						TableName:                t.TableName,
+						Watermark:                &models.ChunkWatermark{Done: true},
+					}
+					if err := e.encodeDumpEntry(entry); err != nil {
+						e.onError(TaskStateRestart, err)
+					}
+				}
+			}
+		}(tx)
+	}
+	wg.Wait()
+}
+
+// tablesBySizeDesc lists the tables to copy, the bigger (by data length, then rows) first.
+func tablesBySizeDesc(dataSources []*config.DataSource) []*config.Table {
+	var tables []*config.Table
+	for _, db := range dataSources {
+		tables = append(tables, db.Tables...)
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		if tables[i].DataLength != tables[j].DataLength {
+			return tables[i].DataLength > tables[j].DataLength
+		}
+		return tables[i].Counter > tables[j].Counter
+	})
+	return tables
+}
+
+const (
+	minDynamicChunkSize = 10
+	maxDynamicChunkSize = 100000
+)
+
+// dynamicChunkSize returns the rows per chunk making chunks of about targetBytes.
+// It returns defaultSize if either is unknown.
+func dynamicChunkSize(targetBytes, avgRowLength, defaultSize int64) int64 {
+	if targetBytes <= 0 || avgRowLength <= 0 {
+		return defaultSize
+	}
+	n := targetBytes / avgRowLength
+	if n < minDynamicChunkSize {
+		return minDynamicChunkSize
+	}
+	if n > maxDynamicChunkSize {
+		return maxDynamicChunkSize
+	}
+	return n
+}
+
 func (e *Extractor) encodeDumpEntry(entry *DumpEntry) error {
-	txMsg, err := Encode(entry)
+	e.rowLimiter.wait(entry.RowsCount, e.shutdownCh)
+	if err := checkDumpRowSize(entry, e.maxRowSize()); err != nil {
+		return err
+	}
+	txMsg, err := e.encode(entry)
 	if err != nil {
 		return err
 	}
 	if err := e.publish(fmt.Sprintf("%s_full", e.subject), "", txMsg); err != nil {
 		return err
 	}
+	atomic.AddInt64(&e.extractedBytes, entry.dataSize())
 	e.mysqlContext.Stage = models.StageSendingData
 	return nil
 }
 
+// TaskEvents returns the events of the task which the agent records
+func (e *Extractor) TaskEvents() <-chan *models.TaskEvent {
+	return e.taskEvents
+}
+
+func (e *Extractor) emitTaskEvent(event *models.TaskEvent) {
+	select {
+	case e.taskEvents <- event:
+	default:
+		e.logger.Warnf("mysql.extractor: dropping task event %q: too many events pending", event.Type)
+	}
+}
+
 func (e *Extractor) Stats() (*models.TaskStatistics, error) {
 	totalRowsCopied := e.mysqlContext.GetTotalRowsCopied()
 	rowsEstimate := atomic.LoadInt64(&e.mysqlContext.RowsEstimate)
@@ -1269,13 +1728,19 @@ func (e *Extractor) Stats() (*models.TaskStatistics, error) {
 		ETA:                eta,
 		Backlog:            fmt.Sprintf("%d/%d", len(e.dataChannel), cap(e.dataChannel)),
 		Stage:              e.mysqlContext.Stage,
+		Queues:             e.pipeline.stats(),
 		BufferStat: models.BufferStat{
 			ExtractorTxQueueSize: len(e.binlogChannel),
 			SendByTimeout:        e.sendByTimeoutCounter,
 			SendBySizeFull:       e.sendBySizeFullCounter,
 		},
+		TrafficStat: models.TrafficStat{
+			ExtractedBytes: atomic.LoadInt64(&e.extractedBytes),
+			WireBytes:      atomic.LoadInt64(&e.wireBytes),
+		},
 		Timestamp: time.Now().UTC().UnixNano(),
 	}
+	e.codecStats.trafficStat(&taskResUsage.TrafficStat)
 	if e.natsConn != nil {
 		taskResUsage.MsgStat = e.natsConn.Statistics
 		e.mysqlContext.TotalTransferredBytes = int(taskResUsage.MsgStat.OutBytes)
@@ -1323,7 +1788,11 @@ func (e *Extractor) ID() string {
 }
 
 func (e *Extractor) onError(state int, err error) {
-	e.logger.Errorf("mysql.extractor. error: %v", err.Error())
+	if state == TaskStateComplete {
+		e.logger.Printf("mysql.extractor: Done migrating")
+	} else {
+		e.logger.Errorf("mysql.extractor. error: %v", err.Error())
+	}
 	if e.shutdown {
 		return
 	}
@@ -1335,6 +1804,92 @@ func (e *Extractor) WaitCh() chan *models.WaitResult {
 	return e.waitCh
 }
 
+// Events returns the changes captured after index by a watch-only extractor.
+func (e *Extractor) Events(index uint64, max int, wait time.Duration) ([]*models.ChangeEvent, uint64, error) {
+	if e.watch == nil {
+		return nil, 0, fmt.Errorf("the task is not watch-only")
+	}
+	events, lastIndex := e.watch.get(index, max, wait)
+	return events, lastIndex, nil
+}
+
+// Rescan lists the source tables, and starts replicating the ones of the job
+// which are not replicated yet: the tables whose CREATE TABLE did not reach
+// the binlog (e.g. created with sql_log_bin=0 or restored from a file) or was
+// before the position the job started from. Their existing rows are not
+// copied.
+func (e *Extractor) Rescan() ([]string, error) {
+	e.binlogReaderLock.Lock()
+	reader := e.binlogReader
+	e.binlogReaderLock.Unlock()
+	if reader == nil {
+		return nil, fmt.Errorf("the task is not reading the binlog yet")
+	}
+
+	var dbs []string
+	err := e.metadata.query("listing the databases", func(ctx context.Context) (err error) {
+		dbs, err = sql.ShowDatabases(ctx, e.db)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var found []*binlog.RescannedTable
+	for _, dbName := range dbs {
+		if strings.ToLower(dbName) == "mysql" {
+			continue
+		}
+		var tbs []*config.Table
+		err := e.metadata.query("listing the tables", func(ctx context.Context) (err error) {
+			tbs, err = sql.ShowTables(ctx, e.db, dbName, true)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, tb := range tbs {
+			if strings.ToLower(tb.TableType) == "view" ||
+				!reader.MatchTable(dbName, tb.TableName) || reader.HasTable(dbName, tb.TableName) {
+				continue
+			}
+			tb.TableSchema = dbName
+			tb.Where = e.tableWhere(dbName, tb.TableName)
+			if err := e.inspector.ValidateOriginalTable(dbName, tb.TableName, tb); err != nil {
+				e.logger.Warnf("mysql.extractor: rescan: %v", err)
+				continue
+			}
+			var stmts []string
+			err := e.metadata.query("reading the create table", func(ctx context.Context) (err error) {
+				stmts, err = base.ShowCreateTable(ctx, e.db, dbName, tb.TableName, false, false)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, &binlog.RescannedTable{Table: tb, CreateTable: stmts[0]})
+		}
+	}
+
+	added, err := reader.AddTables(found)
+	names := make([]string, 0, len(added))
+	for _, tb := range added {
+		names = append(names, fmt.Sprintf("%s.%s", tb.TableSchema, tb.TableName))
+	}
+	if len(names) > 0 {
+		e.logger.Printf("mysql.extractor: rescan: replicating the new tables %v", names)
+	}
+	return names, err
+}
+
+// tableWhere returns the Where of the table in ReplicateDoDb, if the job
+// names it or matches it with a pattern.
+func (e *Extractor) tableWhere(schema, table string) string {
+	if tb := e.tableFilter.FindTable(schema, table); tb != nil {
+		return tb.Where
+	}
+	return ""
+}
+
 // Shutdown is used to tear down the extractor
 func (e *Extractor) Shutdown() error {
 	e.shutdownLock.Lock()
@@ -1345,14 +1900,23 @@ func (e *Extractor) Shutdown() error {
 	}
 	e.shutdown = true
 	close(e.shutdownCh)
+	e.cancel()
+	if e.unregisterChaos != nil {
+		e.unregisterChaos()
+	}
 
 	if e.natsConn != nil {
 		e.natsConn.Close()
 	}
+	if e.watch != nil {
+		e.watch.close()
+	}
 
+	e.dumpersLock.Lock()
 	for _, d := range e.dumpers {
 		d.Close()
 	}
+	e.dumpersLock.Unlock()
 
 	if err := sql.CloseDB(e.singletonDB); err != nil {
 		return err
@@ -0,0 +1,249 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/g"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+// A fixture is the binlog entries received by an applier, recorded with
+// RecordFile to be replayed by `dtle replay`. It is fixtureMagic, then the
+// messages as received from the extractor, each prefixed with its length
+// (uint32, big endian). The messages are only readable by the same version.
+const fixtureMagic = "DTLEFIX1"
+
+// the biggest message accepted when reading a fixture
+const maxFixtureMessage = 1 << 30
+
+// ReplaySubject is the job ID of a replay, under which the applied GTIDs are
+// kept on the target.
+const ReplaySubject = "00000000-0000-0000-0000-0000000e7e7e"
+
+// fixtureWriter appends messages to a fixture.
+type fixtureWriter struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// newFixtureWriter opens a fixture for appending. Recording to an existing
+// fixture across restarts of the task keeps one history.
+func newFixtureWriter(path string) (*fixtureWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fw := &fixtureWriter{f: f, w: bufio.NewWriter(f)}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		if _, err := fw.w.WriteString(fixtureMagic); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return fw, nil
+}
+
+// write appends a message. It is flushed, for a crash to keep it.
+func (fw *fixtureWriter) write(msg []byte) error {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(msg)))
+	if _, err := fw.w.Write(n[:]); err != nil {
+		return err
+	}
+	if _, err := fw.w.Write(msg); err != nil {
+		return err
+	}
+	return fw.w.Flush()
+}
+
+func (fw *fixtureWriter) close() error {
+	err := fw.w.Flush()
+	if cerr := fw.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// FixtureReader reads the messages of a fixture in order.
+type FixtureReader struct {
+	r *bufio.Reader
+}
+
+func NewFixtureReader(r io.Reader) (*FixtureReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(fixtureMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != fixtureMagic {
+		return nil, fmt.Errorf("not a fixture of this version")
+	}
+	return &FixtureReader{r: br}, nil
+}
+
+// Next returns the binlog entries of the next message, or io.EOF.
+func (fr *FixtureReader) Next() (*binlog.BinlogEntries, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(fr.r, n[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated fixture")
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size > maxFixtureMessage {
+		return nil, fmt.Errorf("bad fixture message size %v", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(fr.r, msg); err != nil {
+		return nil, fmt.Errorf("truncated fixture")
+	}
+	entries := &binlog.BinlogEntries{}
+	if err := Decode(msg, entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// recordEntries appends a received message to RecordFile. Recording stops on
+// an error, and the replication goes on.
+func (a *Applier) recordEntries(msg []byte) {
+	if a.fixture == nil {
+		return
+	}
+	if err := a.fixture.write(msg); err != nil {
+		a.logger.Errorf("mysql.applier: recording to %v stopped: %v", a.mysqlContext.RecordFile, err)
+		a.fixture.close()
+		a.fixture = nil
+	}
+}
+
+// ReplayResult is the outcome of ReplayFixture.
+type ReplayResult struct {
+	Messages int
+	Entries  int
+	// Events is the number of the rows and queries of the entries
+	Events int
+	// Gtid is of the last applied entry
+	Gtid string
+}
+
+// ReplayFixture applies the binlog entries of a fixture to the target of
+// cfg, the way the applier of a job does, with a single worker for the
+// order to be the same each time. The GTIDs applied by a previous replay are
+// forgotten first.
+func ReplayFixture(r io.Reader, cfg *config.MySQLDriverConfig, logger *log.Logger) (*ReplayResult, error) {
+	fr, err := NewFixtureReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ParallelWorkers = 1
+	a, err := startFixtureApplier(ReplaySubject, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Shutdown()
+
+	result := &ReplayResult{}
+	err = a.feedFixture(fr, result)
+	return result, err
+}
+
+// startFixtureApplier starts an applier of the target of cfg for the entries
+// of a fixture, with the workers of cfg. The GTIDs applied before under
+// subject are forgotten.
+func startFixtureApplier(subject string, cfg *config.MySQLDriverConfig, logger *log.Logger) (*Applier, error) {
+	cfg.ApproveHeterogeneous = true
+	a, err := NewApplier(subject, "", cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.initDBConnections(); err != nil {
+		a.Shutdown()
+		return nil, err
+	}
+	if _, err := a.db.Exec(fmt.Sprintf("delete from %v.%v where job_uuid = unhex('%x')",
+		g.DtleSchemaName, g.GtidExecutedTableV3, a.subjectUUID.Bytes())); err != nil {
+		a.Shutdown()
+		return nil, err
+	}
+	for i := 0; i < a.mysqlContext.ParallelWorkers; i++ {
+		go a.MtsWorker(i)
+	}
+	go a.heterogeneousReplay()
+	return a, nil
+}
+
+// feedFixture queues the binlog entries of a fixture for the workers, and
+// waits for them to be applied. It returns the error stopping the applier.
+func (a *Applier) feedFixture(fr *FixtureReader, result *ReplayResult) error {
+	for {
+		entries, err := fr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("message %v: %v", result.Messages+1, err)
+		}
+		result.Messages++
+		for _, entry := range entries.Entries {
+			if err := a.enqueueEntry(entry); err != nil {
+				return err
+			}
+			result.Entries++
+			result.Events += len(entry.Events)
+		}
+	}
+	if err := a.waitApplied(); err != nil {
+		return err
+	}
+	result.Gtid = a.mysqlContext.Gtid
+	return nil
+}
+
+// enqueueEntry queues a binlog entry for the workers. It returns the error
+// stopping the applier.
+func (a *Applier) enqueueEntry(entry *binlog.BinlogEntry) error {
+	atomic.AddInt64(&a.nPendingEntry, 1)
+	select {
+	case a.applyDataEntryQueue <- entry:
+		return nil
+	case <-a.shutdownCh:
+		atomic.AddInt64(&a.nPendingEntry, -1)
+		return a.stoppedErr()
+	}
+}
+
+// waitApplied waits for the queued binlog entries to be applied
+func (a *Applier) waitApplied() error {
+	for atomic.LoadInt64(&a.nPendingEntry) > 0 {
+		select {
+		case <-a.shutdownCh:
+			return a.stoppedErr()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// stoppedErr is the error which stopped the applier
+func (a *Applier) stoppedErr() error {
+	res := <-a.waitCh
+	return res.Err
+}
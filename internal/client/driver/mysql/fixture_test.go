@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+)
+
+func TestFixture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "record")
+
+	message := func(gnos ...int64) []byte {
+		entries := &binlog.BinlogEntries{}
+		for _, gno := range gnos {
+			entries.Entries = append(entries.Entries, binlog.NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: gno}))
+		}
+		msg, err := Encode(entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	// a restarted task appends to the same fixture
+	for _, gnos := range [][]int64{{1, 2}, {3}} {
+		fw, err := newFixtureWriter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fw.write(message(gnos...)); err != nil {
+			t.Fatal(err)
+		}
+		if err := fw.close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr, err := NewFixtureReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gnos []int64
+	for {
+		entries, err := fr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries.Entries {
+			gnos = append(gnos, entry.Coordinates.GNO)
+		}
+	}
+	if len(gnos) != 3 || gnos[0] != 1 || gnos[1] != 2 || gnos[2] != 3 {
+		t.Errorf("gnos = %v", gnos)
+	}
+
+	fr, _ = NewFixtureReader(bytes.NewReader(data[:len(data)-1]))
+	fr.Next()
+	if _, err := fr.Next(); err == nil || err == io.EOF {
+		t.Errorf("Next() of a truncated fixture = %v", err)
+	}
+	if _, err := NewFixtureReader(bytes.NewReader([]byte("DTLEFIX0"))); err == nil {
+		t.Errorf("read a fixture of another version")
+	}
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+)
+
+// Errors of a primary of a group replication which rolled back a
+// transaction, e.g. as it is leaving the group.
+const (
+	errGroupRunHook                   = 3100
+	errGroupTransactionRollbackCommit = 3101
+)
+
+const (
+	groupDialTimeout = 5 * time.Second
+	// pause between the attempts to write after a failover of the group
+	groupRetryInterval = time.Second
+)
+
+var errStalePrimary = errors.New("connected to a former primary of the group")
+
+// groupMember is an online member of a group replication
+type groupMember struct {
+	addr    string
+	primary bool
+}
+
+// groupPrimary returns the address of the primary of a group in
+// single-primary mode. It returns false for a group in multi-primary mode, or
+// without a primary while one is elected.
+func groupPrimary(members []groupMember) (string, bool) {
+	primary := ""
+	for _, m := range members {
+		if !m.primary {
+			continue
+		}
+		if primary != "" {
+			return "", false
+		}
+		primary = m.addr
+	}
+	return primary, primary != ""
+}
+
+// queryGroupMembers returns the online members of the group replication of
+// the server of db, or none if it is not in a group.
+func queryGroupMembers(ctx context.Context, db *gosql.DB) ([]groupMember, error) {
+	// MEMBER_ROLE is new in 8.0. 5.7 tells the primary in a status variable,
+	// empty in multi-primary mode.
+	rows, err := db.QueryContext(ctx, `select member_host, member_port, member_role = 'PRIMARY'
+		from performance_schema.replication_group_members where member_state = 'ONLINE'`)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == sql.ErrBadField {
+		rows, err = db.QueryContext(ctx, `select m.member_host, m.member_port,
+			coalesce(s.variable_value, '') in ('', m.member_id)
+			from performance_schema.replication_group_members m
+			left join performance_schema.global_status s on s.variable_name = 'group_replication_primary_member'
+			where m.member_state = 'ONLINE'`)
+	}
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == sql.ErrNoSuchTable {
+		// before 5.7
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []groupMember
+	for rows.Next() {
+		var host string
+		var port gosql.NullInt64
+		var primary bool
+		if err := rows.Scan(&host, &port, &primary); err != nil {
+			return nil, err
+		}
+		if !port.Valid || port.Int64 == 0 {
+			port.Int64 = 3306
+		}
+		members = append(members, groupMember{
+			addr:    net.JoinHostPort(host, strconv.FormatInt(port.Int64, 10)),
+			primary: primary,
+		})
+	}
+	return members, rows.Err()
+}
+
+// isGroupFailoverError tells if err may come from a change of the primary
+// of the group: the connection was lost, or the former primary refused or
+// rolled back the transaction.
+func isGroupFailoverError(err error) bool {
+	if isConnectionError(err) || isReadOnlyError(err) {
+		return true
+	}
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+		return mysqlErr.Number == errGroupRunHook || mysqlErr.Number == errGroupTransactionRollbackCommit
+	}
+	return false
+}
+
+// isConnectionError tells if err leaves a connection unusable
+func isConnectionError(err error) bool {
+	switch err {
+	case driver.ErrBadConn, gosql.ErrConnDone, mysql.ErrInvalidConn, io.EOF, io.ErrUnexpectedEOF, errStalePrimary:
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// groupReplication follows the primary of the group replication of the
+// target, in single-primary mode. The connections of the applier are dialed
+// to the current primary, and the ones to a former primary fail before
+// their next statement, so that they are dialed again.
+//
+// With routed set, the target is a router (MySQL Router, ProxySQL) which
+// follows the primary itself. Its connections are only dialed again when the
+// router closes them.
+type groupReplication struct {
+	sync.Mutex
+	routed bool
+	// the network registered for the connections of the applier
+	network string
+	primary string
+	// the members last seen, asked for the primary once it is gone
+	members []string
+	// incremented when the primary changes
+	generation int64
+}
+
+func newGroupReplication(network, primary string, members []groupMember) *groupReplication {
+	g := &groupReplication{network: network}
+	g.setPrimary(primary, members)
+	return g
+}
+
+// setPrimary records the primary and the members of the group, and returns
+// if the primary changed.
+func (g *groupReplication) setPrimary(primary string, members []groupMember) bool {
+	g.Lock()
+	defer g.Unlock()
+	g.members = g.members[:0]
+	for _, m := range members {
+		g.members = append(g.members, m.addr)
+	}
+	if primary == g.primary {
+		return false
+	}
+	g.primary = primary
+	g.generation++
+	return true
+}
+
+// candidates returns the members to ask for the primary, the current one first
+func (g *groupReplication) candidates() []string {
+	g.Lock()
+	defer g.Unlock()
+	addrs := []string{g.primary}
+	for _, addr := range g.members {
+		if addr != g.primary {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// dial connects to the current primary. The address of the target in the
+// DSN is ignored.
+func (g *groupReplication) dial(string) (net.Conn, error) {
+	g.Lock()
+	primary, generation := g.primary, g.generation
+	g.Unlock()
+	conn, err := net.DialTimeout("tcp", primary, groupDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &groupConn{Conn: conn, group: g, generation: generation}, nil
+}
+
+func (g *groupReplication) isStale(generation int64) bool {
+	g.Lock()
+	defer g.Unlock()
+	return generation != g.generation
+}
+
+// groupConn is a connection to the primary of a group. Once another member
+// is primary, writing to it fails before anything is sent, which the driver
+// reports as a bad connection.
+type groupConn struct {
+	net.Conn
+	group      *groupReplication
+	generation int64
+}
+
+func (c *groupConn) Write(b []byte) (int, error) {
+	if c.group.isStale(c.generation) {
+		c.Conn.Close()
+		return 0, errStalePrimary
+	}
+	return c.Conn.Write(b)
+}
+
+// initGroupReplication finds if the target is in a group replication, and
+// if so, makes the applier write to its primary. proxy is the kind of
+// proxy the target is, if any.
+func (a *Applier) initGroupReplication(proxy string) {
+	cc := a.mysqlContext.ConnectionConfig
+	members, err := a.queryGroupMembersAt(net.JoinHostPort(cc.Host, strconv.Itoa(cc.Port)))
+	if err != nil {
+		a.logger.Warnf("mysql.applier: cannot tell if the target is in a group replication: %v", err)
+		return
+	}
+	if len(members) == 0 {
+		return
+	}
+	if proxy != "" {
+		a.logger.Infof("mysql.applier: %s:%d is %s to a group replication. The applier reconnects when it changes the primary",
+			cc.Host, cc.Port, proxy)
+		a.group = &groupReplication{routed: true}
+		return
+	}
+	primary, ok := groupPrimary(members)
+	if !ok {
+		a.logger.Infof("mysql.applier: %s:%d is in a multi-primary group replication", cc.Host, cc.Port)
+		return
+	}
+	a.group = newGroupReplication("dtle-group-"+a.subject, primary, members)
+	mysql.RegisterDial(a.group.network, a.group.dial)
+	a.logger.Infof("mysql.applier: %s:%d is in a group replication, writing to its primary %s", cc.Host, cc.Port, primary)
+}
+
+// queryGroupMembersAt asks the member at addr for the members of its group
+func (a *Applier) queryGroupMembersAt(addr string) ([]groupMember, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	cc := *a.mysqlContext.ConnectionConfig
+	cc.Host = host
+	if cc.Port, err = strconv.Atoi(port); err != nil {
+		return nil, err
+	}
+	db, err := sql.CreateDB(cc.GetDBUri())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	ctx, cancel := a.queryContext()
+	defer cancel()
+	return queryGroupMembers(ctx, db)
+}
+
+// followGroupPrimary asks the group for its primary, and returns if it has
+// changed. The connections to the former primary are then dialed again.
+func (a *Applier) followGroupPrimary() bool {
+	if a.group == nil || a.group.routed {
+		return false
+	}
+	for _, addr := range a.group.candidates() {
+		members, err := a.queryGroupMembersAt(addr)
+		if err != nil {
+			a.logger.Debugf("mysql.applier: cannot ask %v for the primary: %v", addr, err)
+			continue
+		}
+		// a member which left the group sees no online member
+		primary, ok := groupPrimary(members)
+		if !ok {
+			continue
+		}
+		previous := a.group.candidates()[0]
+		if a.group.setPrimary(primary, members) {
+			a.logger.Printf("mysql.applier: primary of the target moved from %v to %v", previous, primary)
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// reopenConn replaces the connection of a worker which was lost, e.g. to a
+// former primary.
+func (a *Applier) reopenConn(conn *sql.Conn) (err error) {
+	for _, stmt := range []*gosql.Stmt{conn.PsDeleteExecutedGtid, conn.PsInsertExecutedGtid} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	if conn.Db != nil {
+		conn.Db.Close()
+	}
+	if conn.Db, err = sql.OpenConn(a.db); err != nil {
+		return err
+	}
+	return a.prepareConn(conn)
+}
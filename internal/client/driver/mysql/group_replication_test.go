@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"database/sql/driver"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestGroupPrimary(t *testing.T) {
+	primary, ok := groupPrimary([]groupMember{{addr: "db1:3306"}, {addr: "db2:3306", primary: true}})
+	test.S(t).ExpectTrue(ok)
+	test.S(t).ExpectEquals(primary, "db2:3306")
+
+	// multi-primary mode
+	_, ok = groupPrimary([]groupMember{{addr: "db1:3306", primary: true}, {addr: "db2:3306", primary: true}})
+	test.S(t).ExpectFalse(ok)
+	// electing a primary
+	_, ok = groupPrimary([]groupMember{{addr: "db1:3306"}})
+	test.S(t).ExpectFalse(ok)
+	_, ok = groupPrimary(nil)
+	test.S(t).ExpectFalse(ok)
+}
+
+func TestGroupReplication_setPrimary(t *testing.T) {
+	members := []groupMember{{addr: "db1:3306", primary: true}, {addr: "db2:3306"}, {addr: "db3:3306"}}
+	g := newGroupReplication("dtle-group-test", "db1:3306", members)
+	test.S(t).ExpectFalse(g.setPrimary("db1:3306", members))
+	test.S(t).ExpectEquals(g.generation, int64(1))
+
+	members = []groupMember{{addr: "db2:3306"}, {addr: "db3:3306", primary: true}}
+	test.S(t).ExpectTrue(g.setPrimary("db3:3306", members))
+	if got := g.candidates(); !reflect.DeepEqual(got, []string{"db3:3306", "db2:3306"}) {
+		t.Errorf("candidates() = %v", got)
+	}
+}
+
+func TestGroupConn_stale(t *testing.T) {
+	g := newGroupReplication("dtle-group-test", "db1:3306", nil)
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn := &groupConn{Conn: client, group: g, generation: g.generation}
+	_, err := conn.Write([]byte("ping"))
+	test.S(t).ExpectNil(err)
+
+	g.setPrimary("db2:3306", nil)
+	n, err := conn.Write([]byte("ping"))
+	test.S(t).ExpectEquals(n, 0)
+	test.S(t).ExpectEquals(err, errStalePrimary)
+}
+
+func TestIsGroupFailoverError(t *testing.T) {
+	test.S(t).ExpectTrue(isGroupFailoverError(driver.ErrBadConn))
+	test.S(t).ExpectTrue(isGroupFailoverError(mysql.ErrInvalidConn))
+	test.S(t).ExpectTrue(isGroupFailoverError(&net.OpError{Op: "dial", Err: &net.AddrError{Err: "refused"}}))
+	test.S(t).ExpectTrue(isGroupFailoverError(&mysql.MySQLError{Number: errGroupTransactionRollbackCommit}))
+	test.S(t).ExpectTrue(isGroupFailoverError(&mysql.MySQLError{Number: 1290,
+		Message: "The MySQL server is running with the --super-read-only option so it cannot execute this statement"}))
+	test.S(t).ExpectFalse(isGroupFailoverError(&mysql.MySQLError{Number: 1062}))
+}
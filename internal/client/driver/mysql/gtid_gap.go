@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+)
+
+// validateFillGtidGaps checks that the target can commit transactions with
+// the GTIDs of the source, for FillGtidGaps.
+func (a *Applier) validateFillGtidGaps() error {
+	ctx, cancel := a.queryContext()
+	defer cancel()
+	var gtidMode string
+	if err := a.db.QueryRowContext(ctx, "select @@global.gtid_mode").Scan(&gtidMode); err != nil {
+		return err
+	}
+	if gtidMode != "ON" {
+		return fmt.Errorf("FillGtidGaps needs gtid_mode=ON on the target, got %v", gtidMode)
+	}
+	// fails early without the privilege to set gtid_next
+	if _, err := sql.ExecNoPrepare(a.dbs[0].Db, "set gtid_next='automatic'"); err != nil {
+		return fmt.Errorf("FillGtidGaps cannot set gtid_next on the target: %v", err)
+	}
+	return nil
+}
+
+// setGtidNext makes the next transaction of conn be committed with the GTID
+// of entry on the source. An entry without events is committed as an empty
+// transaction, but for the executed GTID of the job.
+//
+// A statement of an entry with query events (DDL) may commit implicitly,
+// leaving the next ones of the transaction without a GTID. The GTID of such
+// an entry is taken by an empty transaction committed before it. The entry
+// itself is committed with a GTID of the target. The empty transaction is
+// skipped by the target when the entry is applied again. So is the one taking
+// the GTID of the XA PREPARE an entry ends.
+func (a *Applier) setGtidNext(conn *sql.Conn, entry *binlog.BinlogEntry) error {
+	query := fmt.Sprintf("set gtid_next='%s'", entry.Coordinates.GetGtidForThisTx())
+	if xa := entry.XAPrepare; xa != nil {
+		query = fmt.Sprintf("set gtid_next='%s'; begin; commit; %s", xa.GetGtidForThisTx(), query)
+	}
+	if hasQueryEvent(entry) {
+		query += "; begin; commit; set gtid_next='automatic'"
+	}
+	_, err := sql.ExecNoPrepare(conn.Db, query)
+	return err
+}
+
+func hasQueryEvent(entry *binlog.BinlogEntry) bool {
+	for i := range entry.Events {
+		if entry.Events[i].DML == binlog.NotDML {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+)
+
+func TestHasQueryEvent(t *testing.T) {
+	entry := binlog.NewBinlogEntryAt(base.BinlogCoordinateTx{})
+	test.S(t).ExpectFalse(hasQueryEvent(entry))
+
+	entry.Events = append(entry.Events, binlog.NewQueryEvent("db1", "", binlog.InsertDML))
+	test.S(t).ExpectFalse(hasQueryEvent(entry))
+
+	entry.Events = append(entry.Events, binlog.NewQueryEvent("db1", "create table t1 (id int)", binlog.NotDML))
+	test.S(t).ExpectTrue(hasQueryEvent(entry))
+}
@@ -0,0 +1,25 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestCheckGtidMode(t *testing.T) {
+	test.S(t).ExpectNil(checkGtidMode("ON"))
+	test.S(t).ExpectNil(checkGtidMode("on"))
+
+	for _, gtidMode := range []string{"OFF", "OFF_PERMISSIVE", "ON_PERMISSIVE"} {
+		err := checkGtidMode(gtidMode)
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectEquals(err.Error(), "gtid_mode of the source is "+gtidMode+
+			". the job replicates by GTID, and needs gtid_mode=ON")
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"net"
+	"strconv"
+	"time"
+
+	gonats "github.com/nats-io/go-nats"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// healthPingTimeout bounds the ping of a connection pool on a health request,
+// so that an unreachable server is reported rather than waited for.
+const healthPingTimeout = 5 * time.Second
+
+func mysqlAddr(c *umconf.ConnectionConfig) string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// pingHealth pings the pool db, which is nil until the task connects.
+func pingHealth(t *base.ConnTracker, addr string, db *gosql.DB) *models.ConnHealth {
+	if db == nil {
+		return t.Health(addr, false)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthPingTimeout)
+	defer cancel()
+	t.Observe(db.PingContext(ctx))
+	return t.Health(addr, true)
+}
+
+func natsConnHealth(t *base.ConnTracker, nc *gonats.Conn) *models.ConnHealth {
+	if nc == nil {
+		return t.Health("", false)
+	}
+	return t.Health(nc.ConnectedUrl(), nc.IsConnected())
+}
+
+// Health returns the health of the binlog dump, the queries on the source and
+// the NATS connection of the extractor.
+func (e *Extractor) Health() []*models.ConnHealth {
+	e.binlogReaderLock.Lock()
+	reader := e.binlogReader
+	e.binlogReaderLock.Unlock()
+
+	binlogHealth := &models.ConnHealth{Name: models.ConnSourceBinlog}
+	if reader != nil {
+		binlogHealth = reader.Health()
+	}
+	return []*models.ConnHealth{
+		binlogHealth,
+		pingHealth(e.sourceHealth, mysqlAddr(e.mysqlContext.ConnectionConfig), e.db),
+		natsConnHealth(e.natsHealth, e.natsConn),
+	}
+}
+
+// Health returns the health of the target pool and the NATS connection of the
+// applier.
+func (a *Applier) Health() []*models.ConnHealth {
+	return []*models.ConnHealth{
+		pingHealth(a.targetHealth, mysqlAddr(a.mysqlContext.ConnectionConfig), a.db),
+		natsConnHealth(a.natsHealth, a.natsConn),
+	}
+}
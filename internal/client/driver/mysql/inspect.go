@@ -7,6 +7,7 @@
 package mysql
 
 import (
+	"context"
 	gosql "database/sql"
 	"fmt"
 	"strings"
@@ -27,17 +28,24 @@ type Inspector struct {
 	logger       *log.Entry
 	db           *gosql.DB
 	mysqlContext *uconf.MySQLDriverConfig
+	// the queries stop when it is cancelled, e.g. by the extractor shutting down
+	ctx context.Context
+	// queries the tables, shared with the extractor
+	metadata *metadataQuerier
 }
 
 func NewInspector(ctx *uconf.MySQLDriverConfig, logger *log.Entry) *Inspector {
 	return &Inspector{
 		logger:       logger,
 		mysqlContext: ctx,
+		ctx:          context.Background(),
+		metadata:     newMetadataQuerier(context.Background(), ctx, logger),
 	}
 }
 
 func (i *Inspector) InitDBConnections() (err error) {
-	inspectorUri := i.mysqlContext.ConnectionConfig.GetDBUri()
+	// the checks are of the server of the binlog, not of a proxy
+	inspectorUri := i.mysqlContext.ConnectionConfig.Direct().GetDBUri()
 	if i.db, err = usql.CreateDB(inspectorUri); err != nil {
 		return err
 	}
@@ -92,7 +100,9 @@ func (i *Inspector) ValidateOriginalTable(databaseName, tableName string, table
 	for _, uk := range uniqueKeys {
 		i.logger.Debugf("A unique key: %s", uk.String())
 
-		ubase.ApplyColumnTypes(i.db, table.TableSchema, table.TableName, &uk.Columns)
+		i.metadata.query("reading the column types", func(ctx context.Context) error {
+			return ubase.ApplyColumnTypes(ctx, i.db, table.TableSchema, table.TableName, &uk.Columns)
+		})
 
 		uniqueKeyIsValid := true
 
@@ -159,7 +169,10 @@ func (i *Inspector) InspectTableColumnsAndUniqueKeys(databaseName, tableName str
 	/*if len(uniqueKeys) == 0 {
 		return columns, uniqueKeys, fmt.Errorf("No PRIMARY nor UNIQUE key found in table! Bailing out")
 	}*/
-	columns, err = ubase.GetTableColumns(i.db, databaseName, tableName)
+	err = i.metadata.query("reading the columns", func(ctx context.Context) (err error) {
+		columns, err = ubase.GetTableColumns(ctx, i.db, databaseName, tableName)
+		return err
+	})
 	if err != nil {
 		return columns, uniqueKeys, err
 	}
@@ -167,10 +180,17 @@ func (i *Inspector) InspectTableColumnsAndUniqueKeys(databaseName, tableName str
 	return columns, uniqueKeys, nil
 }
 
+// queryContext bounds a query of the inspector by QueryTimeoutSeconds
+func (i *Inspector) queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(i.ctx, i.mysqlContext.QueryTimeout())
+}
+
 // validateConnection issues a simple can-connect to MySQL
 func (i *Inspector) validateConnection() error {
+	ctx, cancel := i.queryContext()
+	defer cancel()
 	query := `select @@global.version`
-	if err := i.db.QueryRow(query).Scan(&i.mysqlContext.MySQLVersion); err != nil {
+	if err := i.db.QueryRowContext(ctx, query).Scan(&i.mysqlContext.MySQLVersion); err != nil {
 		return err
 	}
 
@@ -193,7 +213,9 @@ func (i *Inspector) validateGrants() error {
 	foundReplicationSlave := false
 	foundDBAll := false
 
-	err := usql.QueryRowsMap(i.db, query, func(rowMap usql.RowMap) error {
+	ctx, cancel := i.queryContext()
+	defer cancel()
+	err := usql.QueryRowsMap(ctx, i.db, query, func(rowMap usql.RowMap) error {
 		for _, grantData := range rowMap {
 			grant := grantData.String
 			if strings.Contains(grant, `GRANT ALL PRIVILEGES ON`) {
@@ -237,8 +259,10 @@ func (i *Inspector) validateGrants() error {
 
 func (i *Inspector) validateGTIDMode() error {
 	query := `SELECT @@GTID_MODE`
+	ctx, cancel := i.queryContext()
+	defer cancel()
 	var gtidMode string
-	if err := i.db.QueryRow(query).Scan(&gtidMode); err != nil {
+	if err := i.db.QueryRowContext(ctx, query).Scan(&gtidMode); err != nil {
 		return err
 	}
 	if gtidMode != "ON" {
@@ -250,8 +274,10 @@ func (i *Inspector) validateGTIDMode() error {
 // validateBinlogs checks that binary log configuration is good to go
 func (i *Inspector) validateBinlogs() error {
 	query := `select @@global.log_bin, @@global.binlog_format`
+	ctx, cancel := i.queryContext()
+	defer cancel()
 	var hasBinaryLogs bool
-	if err := i.db.QueryRow(query).Scan(&hasBinaryLogs, &i.mysqlContext.BinlogFormat); err != nil {
+	if err := i.db.QueryRowContext(ctx, query).Scan(&hasBinaryLogs, &i.mysqlContext.BinlogFormat); err != nil {
 		return err
 	}
 	if !hasBinaryLogs {
@@ -261,7 +287,7 @@ func (i *Inspector) validateBinlogs() error {
 		return fmt.Errorf("You must be using ROW binlog format. I can switch it for you, provided --switch-to-rbr and that %s:%d doesn't have replicas", i.mysqlContext.ConnectionConfig.Host, i.mysqlContext.ConnectionConfig.Port)
 	}
 	query = `select @@global.binlog_row_image`
-	if err := i.db.QueryRow(query).Scan(&i.mysqlContext.BinlogRowImage); err != nil {
+	if err := i.db.QueryRowContext(ctx, query).Scan(&i.mysqlContext.BinlogRowImage); err != nil {
 		// Only as of 5.6. We wish to support 5.5 as well
 		i.mysqlContext.BinlogRowImage = "FULL"
 	}
@@ -277,14 +303,16 @@ func (i *Inspector) validateTable(databaseName, tableName string) error {
 
 	tableFound := false
 	//tableEngine := ""
-	err := usql.QueryRowsMap(i.db, query, func(rowMap usql.RowMap) error {
-		//tableEngine = rowMap.GetString("Engine")
-		if rowMap.GetString("Comment") == "VIEW" {
-			return fmt.Errorf("%s.%s is a VIEW, not a real table. Bailing out", usql.EscapeName(databaseName), usql.EscapeName(tableName))
-		}
-		tableFound = true
+	err := i.metadata.query("reading the table status", func(ctx context.Context) error {
+		return usql.QueryRowsMap(ctx, i.db, query, func(rowMap usql.RowMap) error {
+			//tableEngine = rowMap.GetString("Engine")
+			if rowMap.GetString("Comment") == "VIEW" {
+				return fmt.Errorf("%s.%s is a VIEW, not a real table. Bailing out", usql.EscapeName(databaseName), usql.EscapeName(tableName))
+			}
+			tableFound = true
 
-		return nil
+			return nil
+		})
 	})
 	if err != nil {
 		return err
@@ -306,14 +334,16 @@ func (i *Inspector) validateTableTriggers(databaseName, tableName string) error
 				AND EVENT_OBJECT_TABLE=?
 	`
 	numTriggers := 0
-	err := usql.QueryRowsMap(i.db, query, func(rowMap usql.RowMap) error {
-		numTriggers = rowMap.GetInt("num_triggers")
-
-		return nil
-	},
-		databaseName,
-		tableName,
-	)
+	err := i.metadata.query("counting the triggers", func(ctx context.Context) error {
+		return usql.QueryRowsMap(ctx, i.db, query, func(rowMap usql.RowMap) error {
+			numTriggers = rowMap.GetInt("num_triggers")
+
+			return nil
+		},
+			databaseName,
+			tableName,
+		)
+	})
 	if err != nil {
 		return err
 	}
@@ -402,18 +432,22 @@ func (i *Inspector) getCandidateUniqueKeys(databaseName, tableName string) (uniq
 	      END,
 	      COUNT_COLUMN_IN_INDEX
 	  `*/
-	err = usql.QueryRowsMap(i.db, query, func(m usql.RowMap) error {
-		columns := umconf.ParseColumnList(m.GetString("COLUMN_NAMES"))
-		uniqueKey := &umconf.UniqueKey{
-			Name:            m.GetString("INDEX_NAME"),
-			Columns:         *columns,
-			HasNullable:     m.GetBool("has_nullable"),
-			IsAutoIncrement: m.GetBool("is_auto_increment"),
-			LastMaxVals:     make([]string, len(columns.Columns)),
-		}
-		uniqueKeys = append(uniqueKeys, uniqueKey)
-		return nil
-	}, databaseName, tableName, databaseName, tableName)
+	err = i.metadata.query("reading the unique keys", func(ctx context.Context) error {
+		// the keys read by a failed attempt
+		uniqueKeys = nil
+		return usql.QueryRowsMap(ctx, i.db, query, func(m usql.RowMap) error {
+			columns := umconf.ParseColumnList(m.GetString("COLUMN_NAMES"))
+			uniqueKey := &umconf.UniqueKey{
+				Name:            m.GetString("INDEX_NAME"),
+				Columns:         *columns,
+				HasNullable:     m.GetBool("has_nullable"),
+				IsAutoIncrement: m.GetBool("is_auto_increment"),
+				LastMaxVals:     make([]string, len(columns.Columns)),
+			}
+			uniqueKeys = append(uniqueKeys, uniqueKey)
+			return nil
+		}, databaseName, tableName, databaseName, tableName)
+	})
 	if err != nil {
 		return uniqueKeys, err
 	}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+const (
+	// the wait before the first retry of a metadata query, doubled on each
+	// retry up to metadataRetryMaxInterval
+	metadataRetryInterval    = time.Second
+	metadataRetryMaxInterval = 30 * time.Second
+
+	// the metadata queries failing in a row which make the source degraded
+	metadataBreakerFailures = 3
+
+	// max_execution_time exceeded, MySQL 5.7.8 or later
+	errQueryExecutionTimeExceeded = 3024
+)
+
+// isTransientError tells if a query failing with err may succeed when issued
+// again: it timed out, lost its connection or was interrupted on the server.
+func isTransientError(err error) bool {
+	if err == context.DeadlineExceeded || isConnectionError(err) {
+		return true
+	}
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+	switch mysqlErr.Number {
+	case sql.ErrLockWaitTimeout, sql.ErrLockDeadlock, sql.ErrQueryInterrupted, sql.ErrConCount,
+		sql.ErrServerShutdown, sql.ErrNetReadInterrupted, sql.ErrNetWriteInterrupted,
+		errQueryExecutionTimeExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// metadataBreaker is the circuit breaker of the metadata queries on a
+// source. metadataBreakerFailures transient failures in a row open it: the
+// source is degraded, and the next query waits for openFor. A query which
+// gets an answer from the source closes it.
+type metadataBreaker struct {
+	openFor time.Duration
+	// called when the breaker opens, with the last failure, and when it
+	// closes again. Either may be nil.
+	onDegraded  func(err error)
+	onRecovered func()
+
+	mu        sync.Mutex
+	failures  int
+	degraded  bool
+	openUntil time.Time
+}
+
+// wait returns once the breaker lets a query through, or with the error of
+// ctx if it is done first.
+func (b *metadataBreaker) wait(ctx context.Context) error {
+	b.mu.Lock()
+	d := time.Until(b.openUntil)
+	b.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// observe records a query which failed with the transient error err, or got
+// an answer if err is nil.
+func (b *metadataBreaker) observe(err error) {
+	b.mu.Lock()
+	var degraded, recovered bool
+	if err == nil {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		recovered = b.degraded
+		b.degraded = false
+	} else {
+		b.failures++
+		if b.failures >= metadataBreakerFailures {
+			b.openUntil = time.Now().Add(b.openFor)
+			degraded = !b.degraded
+			b.degraded = true
+		}
+	}
+	b.mu.Unlock()
+
+	if degraded && b.onDegraded != nil {
+		b.onDegraded(err)
+	}
+	if recovered && b.onRecovered != nil {
+		b.onRecovered()
+	}
+}
+
+// metadataQuerier issues the queries of a task on the metadata of its source:
+// the schemas, the columns and the sizes of the tables. They are retried on
+// a transient failure rather than failing the task.
+type metadataQuerier struct {
+	// the queries stop when it is cancelled, e.g. by the task shutting down
+	ctx          context.Context
+	mysqlContext *config.MySQLDriverConfig
+	logger       *log.Entry
+	breaker      *metadataBreaker
+	// records the transient failures for the health of the source. May be nil.
+	health *base.ConnTracker
+}
+
+func newMetadataQuerier(ctx context.Context, cfg *config.MySQLDriverConfig, logger *log.Entry) *metadataQuerier {
+	return &metadataQuerier{
+		ctx:          ctx,
+		mysqlContext: cfg,
+		logger:       logger,
+		breaker:      &metadataBreaker{openFor: cfg.MetadataBreakerWait()},
+	}
+}
+
+// query calls f with a context bounded by QueryTimeoutSeconds, until it
+// succeeds, fails with an error which is not transient, or has been retried
+// MaxRetries times. Each retry waits for a backoff, and for the breaker if
+// the source is degraded. what names the query in the logs.
+func (m *metadataQuerier) query(what string, f func(ctx context.Context) error) error {
+	backoff := metadataRetryInterval
+	for attempt := 1; ; attempt++ {
+		if err := m.breaker.wait(m.ctx); err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(m.ctx, m.mysqlContext.QueryTimeout())
+		err := f(ctx)
+		cancel()
+		if err != nil && m.ctx.Err() != nil {
+			// shutting down
+			return err
+		}
+
+		transient := err != nil && isTransientError(err)
+		if transient {
+			m.breaker.observe(err)
+			m.health.Failure(err)
+		} else {
+			m.breaker.observe(nil)
+			m.health.Success()
+		}
+		if !transient || attempt > int(m.mysqlContext.MaxRetries) {
+			return err
+		}
+
+		m.logger.Warnf("mysql.extractor: retrying (%v/%v) %v in %v: %v",
+			attempt, m.mysqlContext.MaxRetries, what, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-m.ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > metadataRetryMaxInterval {
+			backoff = metadataRetryMaxInterval
+		}
+	}
+}
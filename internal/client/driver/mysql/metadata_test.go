@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestIsTransientError(t *testing.T) {
+	test.S(t).ExpectTrue(isTransientError(context.DeadlineExceeded))
+	test.S(t).ExpectTrue(isTransientError(driver.ErrBadConn))
+	test.S(t).ExpectTrue(isTransientError(&mysql.MySQLError{Number: 1205}))
+	test.S(t).ExpectTrue(isTransientError(&mysql.MySQLError{Number: 3024}))
+	test.S(t).ExpectFalse(isTransientError(context.Canceled))
+	test.S(t).ExpectFalse(isTransientError(&mysql.MySQLError{Number: 1146}))
+	test.S(t).ExpectFalse(isTransientError(fmt.Errorf("a.b is a VIEW")))
+}
+
+func TestMetadataBreaker(t *testing.T) {
+	var degraded, recovered int
+	b := &metadataBreaker{
+		openFor:     50 * time.Millisecond,
+		onDegraded:  func(err error) { degraded++ },
+		onRecovered: func() { recovered++ },
+	}
+	for i := 1; i < metadataBreakerFailures; i++ {
+		b.observe(context.DeadlineExceeded)
+	}
+	start := time.Now()
+	test.S(t).ExpectNil(b.wait(context.Background()))
+	test.S(t).ExpectTrue(time.Since(start) < 50*time.Millisecond)
+	test.S(t).ExpectEquals(degraded, 0)
+
+	b.observe(context.DeadlineExceeded)
+	test.S(t).ExpectEquals(degraded, 1)
+	// still degraded: no more event
+	b.observe(context.DeadlineExceeded)
+	test.S(t).ExpectEquals(degraded, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	test.S(t).ExpectEquals(b.wait(ctx), context.Canceled)
+	start = time.Now()
+	test.S(t).ExpectNil(b.wait(context.Background()))
+	test.S(t).ExpectTrue(time.Since(start) >= 40*time.Millisecond)
+
+	b.observe(nil)
+	test.S(t).ExpectEquals(recovered, 1)
+	test.S(t).ExpectNil(b.wait(context.Background()))
+}
+
+func TestMetadataQuerier_query(t *testing.T) {
+	cfg := &config.MySQLDriverConfig{MaxRetries: 1}
+	m := newMetadataQuerier(context.Background(), cfg, log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)))
+
+	calls := 0
+	err := m.query("test", func(ctx context.Context) error {
+		calls++
+		if _, ok := ctx.Deadline(); !ok {
+			return fmt.Errorf("no deadline")
+		}
+		if calls == 1 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(calls, 2)
+
+	// not retried
+	calls = 0
+	notFound := &mysql.MySQLError{Number: 1146}
+	err = m.query("test", func(ctx context.Context) error {
+		calls++
+		return notFound
+	})
+	test.S(t).ExpectEquals(err, notFound)
+	test.S(t).ExpectEquals(calls, 1)
+
+	// shutting down
+	ctx, cancel := context.WithCancel(context.Background())
+	m = newMetadataQuerier(ctx, cfg, log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)))
+	calls = 0
+	err = m.query("test", func(ctx context.Context) error {
+		calls++
+		cancel()
+		return ctx.Err()
+	})
+	test.S(t).ExpectEquals(err, context.Canceled)
+	test.S(t).ExpectEquals(calls, 1)
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	gonats "github.com/nats-io/go-nats"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+)
+
+// migrationLagTimeout is how long the applier of a migration job waits for
+// the extractor to tell the lag of the job
+const migrationLagTimeout = DefaultConnectWait / 5
+
+// migrationLag is the answer of the extractor of a migration job about what
+// is left to send to the applier
+type migrationLag struct {
+	// SourceGtid is executed on the source, SentGtid is sent to the applier
+	SourceGtid string
+	SentGtid   string
+	// CaughtUp is set if SentGtid contains SourceGtid
+	CaughtUp bool
+}
+
+// startSentGtid starts the GTID set sent to the applier with the one the
+// binlog is read from, for a migration job to tell its lag.
+func (e *Extractor) startSentGtid(gtidSet string) error {
+	if !e.mysqlContext.Migration {
+		return nil
+	}
+	sent, err := gomysql.ParseMysqlGTIDSet(gtidSet)
+	if err != nil {
+		return err
+	}
+	e.sentGtidLock.Lock()
+	defer e.sentGtidLock.Unlock()
+	e.sentGtid = sent.(*gomysql.MysqlGTIDSet)
+	return nil
+}
+
+// entriesSent adds the entries acked by the applier to the GTID set sent
+func (e *Extractor) entriesSent(entries []*binlog.BinlogEntry) {
+	e.sentGtidLock.Lock()
+	defer e.sentGtidLock.Unlock()
+	if e.sentGtid == nil {
+		return
+	}
+	for _, entry := range entries {
+		e.sentGtid.AddSet(gomysql.NewUUIDSet(entry.Coordinates.SID,
+			gomysql.Interval{Start: entry.Coordinates.GNO, Stop: entry.Coordinates.GNO + 1}))
+		if xa := entry.XAPrepare; xa != nil {
+			e.sentGtid.AddSet(gomysql.NewUUIDSet(xa.SID, gomysql.Interval{Start: xa.GNO, Stop: xa.GNO + 1}))
+		}
+	}
+}
+
+// migrationLag compares the GTID set executed on the source with the one
+// sent to the applier
+func (e *Extractor) migrationLag() (*migrationLag, error) {
+	coordinates, err := e.selfBinlogCoordinates()
+	if err != nil {
+		return nil, err
+	}
+	executed, err := gomysql.ParseMysqlGTIDSet(coordinates.GtidSet)
+	if err != nil {
+		return nil, err
+	}
+	lag := &migrationLag{SourceGtid: coordinates.GtidSet}
+	e.sentGtidLock.Lock()
+	defer e.sentGtidLock.Unlock()
+	if e.sentGtid != nil {
+		lag.SentGtid = e.sentGtid.String()
+		lag.CaughtUp = e.sentGtid.Contain(executed)
+	}
+	return lag, nil
+}
+
+// answerMigrationLag tells the applier of a migration job what is left to
+// send to it. It does not answer if the source cannot be queried.
+func (e *Extractor) answerMigrationLag() error {
+	_, err := e.natsConn.Subscribe(fmt.Sprintf("%s_migration_lag", e.subject), func(m *gonats.Msg) {
+		lag, err := e.migrationLag()
+		if err != nil {
+			e.logger.Warnf("mysql.extractor: cannot tell the lag of the migration: %v", err)
+			return
+		}
+		data, err := json.Marshal(lag)
+		if err != nil {
+			e.logger.Warnf("mysql.extractor: cannot encode the lag of the migration: %v", err)
+			return
+		}
+		if err := e.natsConn.Publish(m.Reply, data); err != nil {
+			e.logger.Warnf("mysql.extractor: cannot answer the lag of the migration: %v", err)
+		}
+	})
+	return err
+}
+
+// requestMigrationLag asks the extractor what is left to send
+func (a *Applier) requestMigrationLag() (*migrationLag, error) {
+	msg, err := a.natsConn.Request(fmt.Sprintf("%s_migration_lag", a.subject), nil, migrationLagTimeout)
+	if err != nil {
+		return nil, err
+	}
+	lag := &migrationLag{}
+	if err := json.Unmarshal(msg.Data, lag); err != nil {
+		return nil, err
+	}
+	return lag, nil
+}
+
+// migrationCaughtUp tells if the job has no lag: the extractor has sent all
+// the transactions executed on the source, and none is pending here. The
+// extractor is asked first, as an entry it sent is pending once acked.
+func (a *Applier) migrationCaughtUp() (*migrationLag, bool) {
+	lag, err := a.requestMigrationLag()
+	if err != nil {
+		a.logger.Debugf("mysql.applier: no lag of the migration from the extractor: %v", err)
+		return nil, false
+	}
+	return lag, lag.CaughtUp && atomic.LoadInt64(&a.nPendingEntry) == 0
+}
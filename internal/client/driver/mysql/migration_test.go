@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gnatsd "github.com/nats-io/gnatsd/server"
+	gonats "github.com/nats-io/go-nats"
+	test "github.com/outbrain/golib/tests"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestApplier_watchMigration(t *testing.T) {
+	ns := gnatsd.New(&gnatsd.Options{Host: "127.0.0.1", Port: gnatsd.RANDOM_PORT, NoLog: true, NoSigs: true})
+	go ns.Start()
+	defer ns.Shutdown()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server not started")
+	}
+	natsAddr := fmt.Sprintf("nats://%s", ns.Addr().String())
+
+	const gtid = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	logger := log.New(ioutil.Discard, log.ErrorLevel)
+	newApplier := func(subject string) *Applier {
+		a, err := NewApplier(subject, "", &config.MySQLDriverConfig{Migration: true, MigrationIdleSeconds: 1,
+			Gtid: gtid, ConnectionConfig: &umconf.ConnectionConfig{}}, logger)
+		test.S(t).ExpectNil(err)
+		a.natsConn, err = gonats.Connect(natsAddr)
+		test.S(t).ExpectNil(err)
+		atomic.StoreInt64(&a.incrStarted, 1)
+		return a
+	}
+
+	nc, err := gonats.Connect(natsAddr)
+	test.S(t).ExpectNil(err)
+	defer nc.Close()
+	subject := models.GenerateUUID()
+	completes, err := nc.SubscribeSync(fmt.Sprintf("%s_complete", subject))
+	test.S(t).ExpectNil(err)
+	// the extractor, which has not sent all the source yet
+	var caughtUp int32
+	_, err = nc.Subscribe(fmt.Sprintf("%s_migration_lag", subject), func(m *gonats.Msg) {
+		data, _ := json.Marshal(&migrationLag{SourceGtid: gtid, CaughtUp: atomic.LoadInt32(&caughtUp) == 1})
+		nc.Publish(m.Reply, data)
+	})
+	test.S(t).ExpectNil(err)
+
+	// a migration does not complete before its cutoff, with entries pending,
+	// or with transactions of the source not sent yet
+	beforeCutoff := newApplier(models.GenerateUUID())
+	defer beforeCutoff.Shutdown()
+	go beforeCutoff.watchMigration(time.Now().Add(time.Hour))
+	pending := newApplier(subject)
+	defer pending.Shutdown()
+	atomic.StoreInt64(&pending.nPendingEntry, 1)
+	go pending.watchMigration(time.Time{})
+
+	time.Sleep(2500 * time.Millisecond)
+	select {
+	case r := <-beforeCutoff.WaitCh():
+		t.Fatalf("the migration completed before its cutoff: %v", r)
+	case r := <-pending.WaitCh():
+		t.Fatalf("the migration completed with an entry pending: %v", r)
+	default:
+	}
+	atomic.StoreInt64(&pending.nPendingEntry, 0)
+	time.Sleep(2500 * time.Millisecond)
+	select {
+	case r := <-pending.WaitCh():
+		t.Fatalf("the migration completed with a lag on the source: %v", r)
+	default:
+	}
+
+	// it completes once caught up for MigrationIdleSeconds, and so does the extractor
+	atomic.StoreInt32(&caughtUp, 1)
+	select {
+	case r := <-pending.WaitCh():
+		test.S(t).ExpectEquals(r.ExitCode, TaskStateComplete)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the migration did not complete")
+	}
+	msg, err := completes.NextMsg(time.Second)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(string(msg.Data), gtid)
+}
+
+func TestExtractor_migrationSentGtid(t *testing.T) {
+	const sid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	e := &Extractor{mysqlContext: &config.MySQLDriverConfig{Migration: true}}
+	test.S(t).ExpectNil(e.startSentGtid(sid + ":1-5"))
+	entry := func(gno int64) *binlog.BinlogEntry {
+		return binlog.NewBinlogEntryAt(base.BinlogCoordinateTx{SID: uuid.FromStringOrNil(sid), GNO: gno})
+	}
+	// the XA PREPARE of an XA COMMIT is sent with it
+	commit := entry(8)
+	commit.XAPrepare = &entry(6).Coordinates
+	e.entriesSent([]*binlog.BinlogEntry{entry(7), commit})
+	test.S(t).ExpectEquals(e.sentGtid.String(), sid+":1-8")
+
+	// other jobs do not keep it
+	e = &Extractor{mysqlContext: &config.MySQLDriverConfig{}}
+	test.S(t).ExpectNil(e.startSentGtid(sid + ":1-5"))
+	e.entriesSent([]*binlog.BinlogEntry{entry(6)})
+	test.S(t).ExpectTrue(e.sentGtid == nil)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+const orchestratorTimeout = 10 * time.Second
+
+// orchestratorClient asks Orchestrator for the master of the source cluster.
+type orchestratorClient struct {
+	cfg    *config.OrchestratorConfig
+	client *http.Client
+}
+
+func newOrchestratorClient(cfg *config.OrchestratorConfig) (*orchestratorClient, error) {
+	if cfg.Url == "" || cfg.Cluster == "" {
+		return nil, fmt.Errorf("orchestrator: Url and Cluster are required")
+	}
+	return &orchestratorClient{
+		cfg:    cfg,
+		client: &http.Client{Timeout: orchestratorTimeout},
+	}, nil
+}
+
+// orchestratorInstance is the part of an instance in the Orchestrator API
+// used here.
+type orchestratorInstance struct {
+	Key struct {
+		Hostname string
+		Port     int
+	}
+}
+
+// master returns the address of the current master of the cluster.
+func (c *orchestratorClient) master() (string, int, error) {
+	u := fmt.Sprintf("%s/api/master/%s", strings.TrimRight(c.cfg.Url, "/"), url.PathEscape(c.cfg.Cluster))
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return "", 0, fmt.Errorf("orchestrator: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("orchestrator: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("orchestrator: %v: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var master orchestratorInstance
+	if err := json.Unmarshal(body, &master); err != nil {
+		return "", 0, fmt.Errorf("orchestrator: bad master of %v: %v", c.cfg.Cluster, err)
+	}
+	if master.Key.Hostname == "" || master.Key.Port == 0 {
+		return "", 0, fmt.Errorf("orchestrator: no master of %v", c.cfg.Cluster)
+	}
+	return master.Key.Hostname, master.Key.Port, nil
+}
+
+// useOrchestratorMaster points ConnectionConfig (BinlogHost behind a proxy)
+// to the master Orchestrator knows, which may have changed since the job was
+// registered.
+func (e *Extractor) useOrchestratorMaster() error {
+	if e.mysqlContext.Orchestrator == nil {
+		return nil
+	}
+	o, err := newOrchestratorClient(e.mysqlContext.Orchestrator)
+	if err != nil {
+		return err
+	}
+	host, port, err := o.master()
+	if err != nil {
+		return err
+	}
+	cc := e.mysqlContext.ConnectionConfig
+	if direct := cc.Direct(); host != direct.Host || port != direct.Port {
+		e.logger.Infof("mysql.extractor: orchestrator reports master %s:%d instead of %s:%d", host, port, direct.Host, direct.Port)
+		cc.SetDirect(host, port)
+	}
+	e.orchestrator = o
+	// an export or a migration without binlog has nothing to move
+	if !e.mysqlContext.SkipIncrementalCopy {
+		go e.followMaster(host, port)
+	}
+	return nil
+}
+
+// followMaster polls Orchestrator for master changes. A change in the full
+// copy restarts the task, as the snapshot is on the old master. Afterwards
+// the binlog reader moves to the new master.
+func (e *Extractor) followMaster(host string, port int) {
+	interval := time.Duration(e.mysqlContext.Orchestrator.PollIntervalSeconds) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+
+		newHost, newPort, err := e.orchestrator.master()
+		if err != nil {
+			e.logger.Warnf("mysql.extractor: %v", err)
+			continue
+		}
+		if newHost == host && newPort == port {
+			continue
+		}
+		e.logger.Infof("mysql.extractor: master changed from %s:%d to %s:%d", host, port, newHost, newPort)
+
+		e.binlogReaderLock.Lock()
+		reader := e.binlogReader
+		e.binlogReaderLock.Unlock()
+		if reader == nil || !e.mysqlContext.ApproveHeterogeneous {
+			e.onError(TaskStateRestart, fmt.Errorf("master changed to %s:%d", newHost, newPort))
+			return
+		}
+		reader.ChangeMaster(newHost, newPort)
+		host, port = newHost, newPort
+	}
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestOrchestratorClient_master(t *testing.T) {
+	master := "db1"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/master/c1":
+			fmt.Fprintf(w, `{"Key":{"Hostname":%q,"Port":3306},"ReadOnly":false}`, master)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"Code":"ERROR","Message":"Unable to determine cluster name"}`)
+		}
+	}))
+	defer ts.Close()
+
+	if _, err := newOrchestratorClient(&config.OrchestratorConfig{Url: ts.URL}); err == nil {
+		t.Errorf("a client without Cluster")
+	}
+
+	c, err := newOrchestratorClient(&config.OrchestratorConfig{Url: ts.URL + "/", Cluster: "c1"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	host, port, err := c.master()
+	if err != nil || host != "db1" || port != 3306 {
+		t.Errorf("master = %v:%v, %v", host, port, err)
+	}
+	master = "db2"
+	if host, _, _ := c.master(); host != "db2" {
+		t.Errorf("master after takeover = %v", host)
+	}
+
+	c.cfg = &config.OrchestratorConfig{Url: ts.URL, Cluster: "unknown"}
+	if _, _, err := c.master(); err == nil {
+		t.Errorf("master of an unknown cluster")
+	}
+}
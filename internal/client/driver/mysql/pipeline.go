@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// pipelineSampleInterval is the interval at which the depths of the queues
+// of a pipeline are sampled
+const pipelineSampleInterval = 100 * time.Millisecond
+
+// pipeline is the chain of the stages of a task, extract → transport →
+// apply, and the bounded queues between them. The depths of the queues are
+// sampled: a queue mostly full waits for its consumer, the bottleneck, and a
+// queue mostly empty for its producer.
+type pipeline struct {
+	mu     sync.Mutex
+	queues []*stageQueue
+}
+
+// stageQueue is a bounded channel between two stages, seen through its
+// length and capacity
+type stageQueue struct {
+	// name is the stage consuming the queue
+	name     string
+	policy   string
+	length   func() int
+	capacity int
+
+	samples      int64
+	fullSamples  int64
+	emptySamples int64
+	dropped      int64
+}
+
+// queue registers a channel of the pipeline. policy is what its producer
+// does when it is full, config.QueueFullBlock or config.QueueFullDrop.
+func (p *pipeline) queue(name, policy string, length func() int, capacity int) *stageQueue {
+	q := &stageQueue{name: name, policy: policy, length: length, capacity: capacity}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queues = append(p.queues, q)
+	return q
+}
+
+// run samples the queues until shutdownCh is closed
+func (p *pipeline) run(shutdownCh chan struct{}) {
+	ticker := time.NewTicker(pipelineSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.sample()
+		case <-shutdownCh:
+			return
+		}
+	}
+}
+
+func (p *pipeline) sample() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, q := range p.queues {
+		q.sample()
+	}
+}
+
+// stats returns the queues in the order of the pipeline
+func (p *pipeline) stats() []models.QueueStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]models.QueueStat, 0, len(p.queues))
+	for _, q := range p.queues {
+		stats = append(stats, q.stat())
+	}
+	return stats
+}
+
+func (q *stageQueue) sample() {
+	n := q.length()
+	atomic.AddInt64(&q.samples, 1)
+	switch {
+	case n >= q.capacity:
+		atomic.AddInt64(&q.fullSamples, 1)
+	case n == 0:
+		atomic.AddInt64(&q.emptySamples, 1)
+	}
+}
+
+// drop counts the entries the producer dropped for the queue being full
+func (q *stageQueue) drop(n int) {
+	atomic.AddInt64(&q.dropped, int64(n))
+}
+
+func (q *stageQueue) stat() models.QueueStat {
+	stat := models.QueueStat{
+		Name:     q.name,
+		Policy:   q.policy,
+		Depth:    q.length(),
+		Capacity: q.capacity,
+		Dropped:  atomic.LoadInt64(&q.dropped),
+	}
+	if samples := atomic.LoadInt64(&q.samples); samples > 0 {
+		stat.FullPct = 100 * float64(atomic.LoadInt64(&q.fullSamples)) / float64(samples)
+		stat.EmptyPct = 100 * float64(atomic.LoadInt64(&q.emptySamples)) / float64(samples)
+	}
+	return stat
+}
+
+// validQueueFullPolicy tells whether a policy of QueueFullPolicy is known
+func validQueueFullPolicy(policy string) bool {
+	return policy == config.QueueFullDrop || policy == config.QueueFullBlock
+}
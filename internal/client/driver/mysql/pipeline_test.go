@@ -0,0 +1,37 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestPipeline_Stats(t *testing.T) {
+	var p pipeline
+	ch := make(chan int, 2)
+	q := p.queue("apply", config.QueueFullDrop, func() int { return len(ch) }, cap(ch))
+
+	p.sample()
+	ch <- 1
+	p.sample()
+	ch <- 2
+	p.sample()
+	p.sample()
+	q.drop(3)
+
+	stats := p.stats()
+	if len(stats) != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	s := stats[0]
+	if s.Name != "apply" || s.Policy != config.QueueFullDrop || s.Depth != 2 || s.Capacity != 2 ||
+		s.FullPct != 50 || s.EmptyPct != 25 || s.Dropped != 3 {
+		t.Errorf("stat = %+v", s)
+	}
+}
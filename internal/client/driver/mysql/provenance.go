@@ -0,0 +1,264 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/actiontech/dtle/internal/g"
+)
+
+const (
+	// how often the tables written by the job are recorded in job_tables
+	provenanceFlushInterval = 10 * time.Second
+	// how often a changed checkpoint is added to checkpoint_history
+	checkpointHistoryInterval = time.Minute
+	// how long checkpoint_history keeps a checkpoint
+	checkpointHistoryRetention = 7 * 24 * time.Hour
+	// how long a job is taken as still writing its tables in job_tables,
+	// after its last heartbeat
+	tableOwnershipTimeout = 5 * time.Minute
+)
+
+type provenanceTable struct {
+	schema string
+	table  string
+}
+
+// provenance collects the tables written by an applier, to be recorded in
+// job_tables in batches rather than in each transaction.
+type provenance struct {
+	sync.Mutex
+	// the tables written since the last flush, true if by the full copy
+	tables map[provenanceTable]bool
+	// the tables checked not to be written by another job
+	claimed map[provenanceTable]bool
+
+	lastCheckpoint     string
+	lastCheckpointTime time.Time
+}
+
+func newProvenance() *provenance {
+	return &provenance{
+		tables:  make(map[provenanceTable]bool),
+		claimed: make(map[provenanceTable]bool),
+	}
+}
+
+func (p *provenance) written(schema, table string, copied bool) {
+	if table == "" {
+		return
+	}
+	t := provenanceTable{schema: schema, table: table}
+	p.Lock()
+	p.tables[t] = p.tables[t] || copied
+	p.Unlock()
+}
+
+func (p *provenance) isClaimed(t provenanceTable) bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.claimed[t]
+}
+
+func (p *provenance) setClaimed(t provenanceTable) {
+	p.Lock()
+	p.claimed[t] = true
+	p.Unlock()
+}
+
+// take returns the tables written since the last call
+func (p *provenance) take() map[provenanceTable]bool {
+	p.Lock()
+	defer p.Unlock()
+	tables := p.tables
+	p.tables = make(map[provenanceTable]bool)
+	return tables
+}
+
+// shouldRecordCheckpoint tells if a checkpoint is to be added to
+// checkpoint_history at now.
+func (p *provenance) shouldRecordCheckpoint(gtid string, now time.Time) bool {
+	return gtid != "" && gtid != p.lastCheckpoint &&
+		now.Sub(p.lastCheckpointTime) >= checkpointHistoryInterval
+}
+
+// createProvenanceTables creates the tables telling DBAs which job writes
+// which table of the target, since when, and where the job is.
+func (a *Applier) createProvenanceTables() error {
+	query := fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %v.%v (
+				table_schema varchar(64) NOT NULL,
+				table_name varchar(64) NOT NULL,
+				job_uuid binary(16) NOT NULL COMMENT 'unique identifier of job',
+				heartbeat_at timestamp NULL COMMENT 'last heartbeat of the running job',
+				first_applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				last_applied_at timestamp NULL COMMENT 'last write of the job, recorded every few seconds',
+				copy_started_at timestamp NULL COMMENT 'first row written by the full copy',
+				copy_completed_at timestamp NULL COMMENT 'completion of the full copy of the job',
+				PRIMARY KEY (table_schema, table_name, job_uuid),
+				KEY job_uuid (job_uuid)
+			);
+		`, g.DtleSchemaName, g.JobTablesTable)
+	if _, err := a.db.Exec(query); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %v.%v (
+				id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+				job_uuid binary(16) NOT NULL COMMENT 'unique identifier of job',
+				gtid_set longtext NOT NULL COMMENT 'gtid set applied by the job',
+				created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				KEY job_uuid (job_uuid, id)
+			);
+		`, g.DtleSchemaName, g.CheckpointHistoryTable)
+	_, err := a.db.Exec(query)
+	return err
+}
+
+// runProvenance records the tables written and the checkpoints until the
+// applier is shut down. A failure is only logged: it does not stop the job.
+func (a *Applier) runProvenance() {
+	ticker := time.NewTicker(provenanceFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.shutdownCh:
+			return
+		case <-ticker.C:
+			if atomic.LoadInt32(&a.targetReadOnly) == 1 {
+				continue
+			}
+			if err := a.flushProvenance(); err != nil {
+				a.logger.Warnf("mysql.applier: cannot record the written tables: %v", err)
+			}
+			if err := a.heartbeatTables(); err != nil {
+				a.logger.Warnf("mysql.applier: cannot record the heartbeat of the written tables: %v", err)
+			}
+			if err := a.recordCheckpoint(time.Now()); err != nil {
+				a.logger.Warnf("mysql.applier: cannot record the checkpoint: %v", err)
+			}
+		}
+	}
+}
+
+func (a *Applier) flushProvenance() error {
+	tables := a.provenance.take()
+	if len(tables) == 0 {
+		return nil
+	}
+	var values []string
+	var args []interface{}
+	for t, copied := range tables {
+		values = append(values, "(?, ?, ?, now(), if(?, now(), null))")
+		args = append(args, t.schema, t.table, a.subjectUUID.Bytes(), copied)
+	}
+	query := fmt.Sprintf("insert into %v.%v "+
+		"(table_schema, table_name, job_uuid, last_applied_at, copy_started_at) values %s "+
+		"on duplicate key update last_applied_at = values(last_applied_at), "+
+		"copy_started_at = coalesce(copy_started_at, values(copy_started_at))",
+		g.DtleSchemaName, g.JobTablesTable, strings.Join(values, ", "))
+	_, err := a.db.Exec(query, args...)
+	return err
+}
+
+func (a *Applier) heartbeatTables() error {
+	query := fmt.Sprintf("update %v.%v set heartbeat_at = now() where job_uuid = ?",
+		g.DtleSchemaName, g.JobTablesTable)
+	_, err := a.db.Exec(query, a.subjectUUID.Bytes())
+	return err
+}
+
+// claimTable records the job in job_tables before its first write to a
+// table, and fails if another running job writes the table, unless the job
+// allows overlapping jobs. Locking the rows of the table serializes the
+// claims of jobs starting together.
+func (a *Applier) claimTable(schema, table string) (err error) {
+	t := provenanceTable{schema: schema, table: table}
+	if a.provenance == nil || table == "" || a.provenance.isClaimed(t) {
+		return nil
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if !a.mysqlContext.AllowsOverlappingJobs() {
+		query := fmt.Sprintf("select job_uuid from %v.%v "+
+			"where table_schema = ? and table_name = ? and job_uuid != ? "+
+			"and coalesce(heartbeat_at, first_applied_at) > now() - interval %d second for update",
+			g.DtleSchemaName, g.JobTablesTable, int64(tableOwnershipTimeout/time.Second))
+		var owner []byte
+		err = tx.QueryRow(query, schema, table, a.subjectUUID.Bytes()).Scan(&owner)
+		switch {
+		case err == gosql.ErrNoRows:
+		case err != nil:
+			return err
+		default:
+			ownerID, _ := uuid.FromBytes(owner)
+			return fmt.Errorf("table %v.%v is written by job %v. set AllowOverlappingJobs to accept it",
+				schema, table, ownerID)
+		}
+	}
+
+	query := fmt.Sprintf("insert into %v.%v (table_schema, table_name, job_uuid, heartbeat_at) "+
+		"values (?, ?, ?, now()) on duplicate key update heartbeat_at = now()",
+		g.DtleSchemaName, g.JobTablesTable)
+	if _, err = tx.Exec(query, schema, table, a.subjectUUID.Bytes()); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	a.provenance.setClaimed(t)
+	return nil
+}
+
+func (a *Applier) recordCheckpoint(now time.Time) error {
+	gtid := a.mysqlContext.Gtid
+	if !a.provenance.shouldRecordCheckpoint(gtid, now) {
+		return nil
+	}
+	query := fmt.Sprintf("insert into %v.%v (job_uuid, gtid_set) values (?, ?)",
+		g.DtleSchemaName, g.CheckpointHistoryTable)
+	if _, err := a.db.Exec(query, a.subjectUUID.Bytes(), gtid); err != nil {
+		return err
+	}
+	a.provenance.lastCheckpoint = gtid
+	a.provenance.lastCheckpointTime = now
+
+	query = fmt.Sprintf("delete from %v.%v where job_uuid = ? and created_at < now() - interval %d second",
+		g.DtleSchemaName, g.CheckpointHistoryTable, int64(checkpointHistoryRetention/time.Second))
+	_, err := a.db.Exec(query, a.subjectUUID.Bytes())
+	return err
+}
+
+// recordCopyComplete marks the tables copied by the job as completed.
+func (a *Applier) recordCopyComplete() error {
+	if err := a.flushProvenance(); err != nil {
+		return err
+	}
+	query := fmt.Sprintf("update %v.%v set copy_completed_at = now() "+
+		"where job_uuid = ? and copy_started_at is not null and copy_completed_at is null",
+		g.DtleSchemaName, g.JobTablesTable)
+	_, err := a.db.Exec(query, a.subjectUUID.Bytes())
+	return err
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestProvenance_written(t *testing.T) {
+	p := newProvenance()
+	p.written("db1", "tb1", true)
+	p.written("db1", "tb1", false)
+	p.written("db1", "tb2", false)
+	p.written("db1", "", false)
+
+	tables := p.take()
+	test.S(t).ExpectEquals(len(tables), 2)
+	// a table is copied if any write was by the full copy
+	test.S(t).ExpectTrue(tables[provenanceTable{schema: "db1", table: "tb1"}])
+	test.S(t).ExpectFalse(tables[provenanceTable{schema: "db1", table: "tb2"}])
+	test.S(t).ExpectEquals(len(p.take()), 0)
+}
+
+func TestProvenance_shouldRecordCheckpoint(t *testing.T) {
+	p := newProvenance()
+	now := time.Now()
+	test.S(t).ExpectFalse(p.shouldRecordCheckpoint("", now))
+	test.S(t).ExpectTrue(p.shouldRecordCheckpoint("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", now))
+
+	p.lastCheckpoint = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	p.lastCheckpointTime = now
+	test.S(t).ExpectFalse(p.shouldRecordCheckpoint("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-6", now.Add(time.Second)))
+	test.S(t).ExpectFalse(p.shouldRecordCheckpoint("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", now.Add(time.Hour)))
+	test.S(t).ExpectTrue(p.shouldRecordCheckpoint("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-6", now.Add(time.Hour)))
+}
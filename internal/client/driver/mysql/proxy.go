@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// proxyName returns "ProxySQL" if db is connected to ProxySQL, which answers
+// this query itself, or "" otherwise.
+func proxyName(ctx context.Context, db *gosql.DB) (string, error) {
+	var comment string
+	if err := db.QueryRowContext(ctx, "select @@version_comment limit 1").Scan(&comment); err != nil {
+		return "", err
+	}
+	if strings.Contains(strings.ToLower(comment), "proxysql") {
+		return "ProxySQL", nil
+	}
+	return "", nil
+}
+
+// detectProxy returns the kind of proxy at Host and Port of cc, or "" if
+// it is a MySQL server. Proxy of cc is trusted for the undetectable ones.
+func detectProxy(ctx context.Context, cc *umconf.ConnectionConfig) (string, error) {
+	db, err := sql.CreateDB(cc.GetDBUri())
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	name, err := proxyName(ctx, db)
+	if err != nil || name != "" {
+		return name, err
+	}
+	if cc.Proxy {
+		return "proxy", nil
+	}
+	return "", nil
+}
+
+// checkProxy refuses a source behind a proxy without BinlogHost, as the
+// binlog cannot be read through the proxy.
+func (e *Extractor) checkProxy() error {
+	cc := e.mysqlContext.ConnectionConfig
+	ctx, cancel := e.queryContext()
+	defer cancel()
+	proxy, err := detectProxy(ctx, cc)
+	if err != nil || proxy == "" {
+		return err
+	}
+	if cc.BinlogHost != "" {
+		direct := cc.Direct()
+		e.logger.Infof("mysql.extractor: %s:%d is %s, using %s:%d for the binlog and the snapshot",
+			cc.Host, cc.Port, proxy, direct.Host, direct.Port)
+		return nil
+	}
+	if e.mysqlContext.SkipIncrementalCopy {
+		e.logger.Warnf("mysql.extractor: %s:%d is %s. The full copy goes through it", cc.Host, cc.Port, proxy)
+		return nil
+	}
+	return fmt.Errorf("%s:%d is %s, which cannot serve the binlog. Set BinlogHost and BinlogPort to the MySQL server behind it",
+		cc.Host, cc.Port, proxy)
+}
+
+// checkProxy turns off what a target behind a proxy cannot keep. A proxy
+// multiplexing the connections to the servers does not keep sql_log_bin
+// of a session.
+func (a *Applier) checkProxy() (proxy string, err error) {
+	cc := a.mysqlContext.ConnectionConfig
+	ctx, cancel := a.queryContext()
+	defer cancel()
+	proxy, err = detectProxy(ctx, cc)
+	if err != nil || proxy == "" {
+		return proxy, err
+	}
+	a.logger.Infof("mysql.applier: %s:%d is %s", cc.Host, cc.Port, proxy)
+	if a.mysqlContext.DisableSqlLogBin {
+		a.logger.Warnf("mysql.applier: DisableSqlLogBin is ignored behind %s. The applied changes are binlogged", proxy)
+		a.mysqlContext.DisableSqlLogBin = false
+	}
+	if cc.BinlogHost == "" {
+		a.logger.Warnf("mysql.applier: the server_uuid of the target is read through %s. Set BinlogHost for cycle prevention to use the right server", proxy)
+	}
+	return proxy, nil
+}
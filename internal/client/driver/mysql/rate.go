@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// the longest sleep of a paused copy before checking the windows again
+const maxThrottlePause = time.Minute
+
+// rowLimiter paces the rows sent by the extractor to RowsPerSecond of the job,
+// which the quota of its namespace may require, and to its throttle windows.
+// A nil limiter does not limit.
+type rowLimiter struct {
+	rowsPerSecond int64
+	schedule      *models.ThrottleSchedule
+	// onWindow is called when a throttle window opens, or with nil when the
+	// copy leaves the windows.
+	onWindow func(w *models.ThrottleWindow)
+
+	mu     sync.Mutex
+	next   time.Time
+	window *models.ThrottleWindow
+}
+
+func newRowLimiter(rowsPerSecond int64, schedule *models.ThrottleSchedule) *rowLimiter {
+	if rowsPerSecond <= 0 && schedule == nil {
+		return nil
+	}
+	return &rowLimiter{rowsPerSecond: rowsPerSecond, schedule: schedule}
+}
+
+// setRate changes the rows per second, from the rows sent next.
+func (l *rowLimiter) setRate(rowsPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rowsPerSecond = rowsPerSecond
+	l.next = time.Time{}
+}
+
+// reserve returns when n rows may be sent, and books them. If a window
+// pauses the copy, ok is false and the time is when to check again.
+func (l *rowLimiter) reserve(n int64, now time.Time) (at time.Time, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rate := l.rowsPerSecond
+	w, remaining := l.schedule.At(now)
+	if w != l.window {
+		l.window = w
+		if l.onWindow != nil {
+			l.onWindow(w)
+		}
+	}
+	if w != nil {
+		if w.RowsPerSecond == 0 {
+			if remaining > maxThrottlePause {
+				remaining = maxThrottlePause
+			}
+			return now.Add(remaining), false
+		}
+		if rate <= 0 || w.RowsPerSecond < rate {
+			rate = w.RowsPerSecond
+		}
+	}
+	if rate <= 0 {
+		return now, true
+	}
+
+	at = l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(time.Duration(n) * (time.Second / time.Duration(rate)))
+	return at, true
+}
+
+// wait blocks until n rows may be sent, or shutdownCh is closed.
+func (l *rowLimiter) wait(n int64, shutdownCh <-chan struct{}) {
+	if l == nil || n <= 0 {
+		return
+	}
+	for {
+		now := time.Now()
+		at, ok := l.reserve(n, now)
+		if d := at.Sub(now); d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-shutdownCh:
+				t.Stop()
+				return
+			}
+		}
+		if ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestRowLimiter(t *testing.T) {
+	if newRowLimiter(0, nil) != nil {
+		t.Fatalf("a limiter without RowsPerSecond")
+	}
+	// a nil limiter does not block
+	var nilLimiter *rowLimiter
+	nilLimiter.wait(1000, nil)
+
+	l := newRowLimiter(100, nil)
+	now := time.Now()
+	if at, _ := l.reserve(50, now); !at.Equal(now) {
+		t.Errorf("first reserve at %v, want now", at.Sub(now))
+	}
+	if at, _ := l.reserve(10, now); at.Sub(now) != 500*time.Millisecond {
+		t.Errorf("second reserve after %v, want 500ms", at.Sub(now))
+	}
+	// an idle limiter does not save up rows
+	later := now.Add(10 * time.Second)
+	if at, _ := l.reserve(10, later); !at.Equal(later) {
+		t.Errorf("reserve after idle at %v, want now", at.Sub(later))
+	}
+
+	shutdownCh := make(chan struct{})
+	close(shutdownCh)
+	start := time.Now()
+	l.wait(1000, shutdownCh)
+	l.wait(1000, shutdownCh)
+	if time.Since(start) > time.Second {
+		t.Errorf("wait did not return on shutdown")
+	}
+}
+
+func TestRowLimiterSetRate(t *testing.T) {
+	l := &rowLimiter{}
+	now := time.Now()
+	if at, _ := l.reserve(1000, now); !at.Equal(now) {
+		t.Errorf("reserve without a rate at %v, want now", at.Sub(now))
+	}
+
+	l.setRate(10)
+	l.reserve(10, now)
+	if at, _ := l.reserve(10, now); at.Sub(now) != time.Second {
+		t.Errorf("reserve after %v, want 1s", at.Sub(now))
+	}
+	// the rows booked at the previous rate do not delay the new one
+	l.setRate(1000)
+	if at, _ := l.reserve(10, now); !at.Equal(now) {
+		t.Errorf("reserve after tuning at %v, want now", at.Sub(now))
+	}
+}
+
+func TestRowLimiterWindows(t *testing.T) {
+	schedule, err := models.NewThrottleSchedule([]*models.ThrottleWindow{
+		{Start: "09:00", End: "12:00", Timezone: "UTC", RowsPerSecond: 10},
+		{Start: "12:00", End: "12:30", Timezone: "UTC"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newRowLimiter(0, schedule)
+	var windows []*models.ThrottleWindow
+	l.onWindow = func(w *models.ThrottleWindow) { windows = append(windows, w) }
+
+	day := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	// full speed out of the windows
+	now := day.Add(8 * time.Hour)
+	for i := 0; i < 2; i++ {
+		if at, ok := l.reserve(1000, now); !ok || !at.Equal(now) {
+			t.Errorf("out of the windows: reserve at %v, %v", at.Sub(now), ok)
+		}
+	}
+	// limited in the first window
+	now = day.Add(9 * time.Hour)
+	l.reserve(10, now)
+	if at, ok := l.reserve(10, now); !ok || at.Sub(now) != time.Second {
+		t.Errorf("in the window: reserve after %v, %v, want 1s", at.Sub(now), ok)
+	}
+	// paused in the second window, checked again every minute at most
+	now = day.Add(12*time.Hour + 29*time.Minute + 30*time.Second)
+	if at, ok := l.reserve(1, now); ok || at.Sub(now) != 30*time.Second {
+		t.Errorf("paused: reserve after %v, %v, want 30s", at.Sub(now), ok)
+	}
+	now = day.Add(13 * time.Hour)
+	l.reserve(1, now)
+	if len(windows) != 3 || windows[0].RowsPerSecond != 10 ||
+		windows[1].RowsPerSecond != 0 || windows[2] != nil {
+		t.Errorf("window changes = %v", windows)
+	}
+
+	// the job limit is kept in a window allowing more
+	l = newRowLimiter(5, schedule)
+	now = day.Add(10 * time.Hour)
+	l.reserve(5, now)
+	if at, _ := l.reserve(5, now); at.Sub(now) != time.Second {
+		t.Errorf("reserve after %v, want 1s", at.Sub(now))
+	}
+}
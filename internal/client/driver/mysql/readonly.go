@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// how often a read-only target is checked for writability
+const readOnlyPollInterval = 5 * time.Second
+
+// isReadOnlyError tells if a write failed because the target is read-only,
+// e.g. it has been demoted by HA tooling.
+func isReadOnlyError(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+	switch mysqlErr.Number {
+	case sql.ErrReadOnlyMode:
+		return true
+	case sql.ErrOptionPreventsStatement:
+		// --read-only or --super-read-only. Other options give the same code.
+		return strings.Contains(mysqlErr.Message, "read-only")
+	default:
+		return false
+	}
+}
+
+// retryOnTarget calls f until it succeeds or fails with an error other
+// than a read-only one. After a read-only error, f is called again once the
+// target is writable. In a group replication, f is also called again after
+// a failover, up to MaxRetries times.
+func (a *Applier) retryOnTarget(f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := a.targetHealth.Observe(f())
+		if err == nil {
+			return nil
+		}
+		if a.group != nil && isGroupFailoverError(err) {
+			if a.followGroupPrimary() {
+				continue
+			}
+			if !isReadOnlyError(err) && attempt <= int(a.mysqlContext.MaxRetries) {
+				a.logger.Warnf("mysql.applier: retrying (%v/%v) on group replication error: %v",
+					attempt, a.mysqlContext.MaxRetries, err)
+				select {
+				case <-time.After(groupRetryInterval):
+					continue
+				case <-a.shutdownCh:
+					return err
+				}
+			}
+		}
+		if !isReadOnlyError(err) || !a.waitWritable(err) {
+			return err
+		}
+	}
+}
+
+// isRetriedOnTarget tells if a write failing with err is retried by
+// retryOnTarget. Its transaction is rolled back rather than committed.
+func (a *Applier) isRetriedOnTarget(err error) bool {
+	return isReadOnlyError(err) || a.group != nil && isGroupFailoverError(err)
+}
+
+// waitWritable pauses the caller in StageTargetReadOnly until the target is
+// writable. It returns false if the applier is shut down meanwhile.
+func (a *Applier) waitWritable(cause error) bool {
+	if atomic.CompareAndSwapInt32(&a.targetReadOnly, 0, 1) {
+		a.logger.Warnf("mysql.applier: target is read-only. pausing until it is writable: %v", cause)
+	}
+	stage := a.mysqlContext.Stage
+	a.mysqlContext.Stage = models.StageTargetReadOnly
+
+	for {
+		select {
+		case <-a.shutdownCh:
+			return false
+		case <-time.After(readOnlyPollInterval):
+		}
+		// a former primary of a group stays read-only
+		if !a.followGroupPrimary() {
+			// super_read_only implies read_only
+			var readOnly bool
+			ctx, cancel := a.queryContext()
+			err := a.db.QueryRowContext(ctx, "select @@global.read_only").Scan(&readOnly)
+			cancel()
+			if err != nil {
+				a.logger.Debugf("mysql.applier: cannot check if the target is read-only: %v", err)
+				continue
+			}
+			if readOnly {
+				continue
+			}
+		}
+		if atomic.CompareAndSwapInt32(&a.targetReadOnly, 1, 0) {
+			a.logger.Printf("mysql.applier: target is writable. resuming")
+		}
+		if stage != models.StageTargetReadOnly && a.mysqlContext.Stage == models.StageTargetReadOnly {
+			a.mysqlContext.Stage = stage
+		}
+		return true
+	}
+}
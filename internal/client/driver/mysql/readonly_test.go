@@ -0,0 +1,29 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+)
+
+func TestIsReadOnlyError(t *testing.T) {
+	test.S(t).ExpectTrue(isReadOnlyError(&mysql.MySQLError{Number: sql.ErrOptionPreventsStatement,
+		Message: "The MySQL server is running with the --read-only option so it cannot execute this statement"}))
+	test.S(t).ExpectTrue(isReadOnlyError(&mysql.MySQLError{Number: sql.ErrOptionPreventsStatement,
+		Message: "The MySQL server is running with the --super-read-only option so it cannot execute this statement"}))
+	test.S(t).ExpectTrue(isReadOnlyError(&mysql.MySQLError{Number: sql.ErrReadOnlyMode}))
+	test.S(t).ExpectFalse(isReadOnlyError(&mysql.MySQLError{Number: sql.ErrOptionPreventsStatement,
+		Message: "The MySQL server is running with the --skip-grant-tables option so it cannot execute this statement"}))
+	test.S(t).ExpectFalse(isReadOnlyError(&mysql.MySQLError{Number: 1062}))
+	test.S(t).ExpectFalse(isReadOnlyError(errors.New("read-only")))
+}
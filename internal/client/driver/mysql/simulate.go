@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+// SimulateSubject is the job ID of a simulation, under which the applied
+// GTIDs are kept on the target.
+const SimulateSubject = "00000000-0000-0000-0000-00000051e7e7"
+
+// SimulateResult is the outcome of SimulateFixture. For a simulation which
+// failed, Entries are the ones applied before the error.
+type SimulateResult struct {
+	ReplayResult
+	Workers        int
+	ElapsedSeconds float64
+	EntriesPerSec  float64
+	EventsPerSec   float64
+	// Error stopped the simulation
+	Error string
+}
+
+// SimulateFixture applies the binlog entries of a fixture to a scratch
+// target the way the applier of a job configured by cfg does, e.g. with its
+// ParallelWorkers and TxBoundary, and measures the throughput. Unlike
+// ReplayFixture, the order the workers apply the entries in might differ
+// each time. The GTIDs applied by a previous simulation are forgotten first.
+// BlobOffload is left out, not to upload to the bucket of the job.
+func SimulateFixture(r io.Reader, cfg *config.MySQLDriverConfig, logger *log.Logger) (*SimulateResult, error) {
+	fr, err := NewFixtureReader(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg.BlobOffload = nil
+	a, err := startFixtureApplier(SimulateSubject, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Shutdown()
+	return a.simulate(fr), nil
+}
+
+// simulate feeds the binlog entries of fr to the started applier, and
+// measures its throughput.
+func (a *Applier) simulate(fr *FixtureReader) *SimulateResult {
+	result := &SimulateResult{Workers: a.mysqlContext.ParallelWorkers}
+	start := time.Now()
+	if err := a.feedFixture(fr, &result.ReplayResult); err != nil {
+		result.Error = err.Error()
+		if pending := int(atomic.LoadInt64(&a.nPendingEntry)); pending > 0 {
+			// the events of the entries left are not told apart
+			result.Entries -= pending
+			result.Events = 0
+		}
+	}
+	elapsed := time.Since(start).Seconds()
+	result.ElapsedSeconds = elapsed
+	if elapsed > 0 {
+		result.EntriesPerSec = float64(result.Entries) / elapsed
+		result.EventsPerSec = float64(result.Events) / elapsed
+	}
+	return result
+}
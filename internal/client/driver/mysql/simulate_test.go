@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestApplier_simulate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simulate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "record")
+
+	// 3 entries of 1, 2 and 3 events, in 2 messages
+	fw, err := newFixtureWriter(path)
+	test.S(t).ExpectNil(err)
+	gno := int64(0)
+	for _, nEntries := range []int{2, 1} {
+		entries := &binlog.BinlogEntries{}
+		for i := 0; i < nEntries; i++ {
+			gno++
+			entry := binlog.NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: gno})
+			for j := int64(0); j < gno; j++ {
+				entry.Events = append(entry.Events, binlog.DataEvent{DatabaseName: "db1", TableName: "tb1"})
+			}
+			entries.Entries = append(entries.Entries, entry)
+		}
+		msg, err := Encode(entries)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNil(fw.write(msg))
+	}
+	test.S(t).ExpectNil(fw.close())
+
+	logger := log.New(ioutil.Discard, log.ErrorLevel)
+	simulate := func(stopErr error) *SimulateResult {
+		a, err := NewApplier(models.GenerateUUID(), "", &config.MySQLDriverConfig{ParallelWorkers: 2,
+			ConnectionConfig: &umconf.ConnectionConfig{}}, logger)
+		test.S(t).ExpectNil(err)
+		defer a.Shutdown()
+		if stopErr != nil {
+			a.onError(TaskStateDead, stopErr)
+		} else {
+			// the entries are of the same server as the target, so they
+			// are let through without a DB
+			go a.heterogeneousReplay()
+		}
+		f, err := os.Open(path)
+		test.S(t).ExpectNil(err)
+		defer f.Close()
+		fr, err := NewFixtureReader(f)
+		test.S(t).ExpectNil(err)
+		return a.simulate(fr)
+	}
+
+	result := simulate(nil)
+	test.S(t).ExpectEquals(result.Error, "")
+	test.S(t).ExpectEquals(result.Messages, 2)
+	test.S(t).ExpectEquals(result.Entries, 3)
+	test.S(t).ExpectEquals(result.Events, 6)
+	test.S(t).ExpectEquals(result.Workers, 2)
+	test.S(t).ExpectTrue(result.ElapsedSeconds > 0)
+	test.S(t).ExpectTrue(result.EntriesPerSec > 0)
+	test.S(t).ExpectTrue(result.EventsPerSec > 0)
+
+	// none of the entries is applied by a stopped applier
+	result = simulate(fmt.Errorf("target is down"))
+	test.S(t).ExpectEquals(result.Error, "target is down")
+	test.S(t).ExpectEquals(result.Entries, 0)
+	test.S(t).ExpectEquals(result.Events, 0)
+	test.S(t).ExpectEquals(result.EntriesPerSec, 0.0)
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/satori/go.uuid"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/g"
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/utils"
+)
+
+func (a *Applier) createSkippedTxTable() error {
+	query := fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %v.%v (
+				id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+				job_uuid binary(16) NOT NULL COMMENT 'unique identifier of job',
+				skip_id varchar(64) NOT NULL COMMENT 'the skip armed, which skips one transaction',
+				gtid varchar(64) NOT NULL COMMENT 'source transaction skipped',
+				log_file varchar(255) NOT NULL,
+				log_pos bigint NOT NULL,
+				event_time timestamp NULL COMMENT 'time of the transaction on the source',
+				tables text NOT NULL COMMENT 'tables of the transaction, comma separated',
+				row_count bigint NOT NULL,
+				statement_count bigint NOT NULL,
+				error text NOT NULL COMMENT 'why the transaction failed on the target',
+				events longtext NOT NULL COMMENT 'the events of the transaction, a line each',
+				reason text,
+				skipped_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE KEY skip (job_uuid, skip_id)
+			);
+		`, g.DtleSchemaName, g.SkippedTxTable)
+	_, err := a.db.Exec(query)
+	return err
+}
+
+// SkipTx arms the applier to skip its next failing transaction
+func (a *Applier) SkipTx(skip *models.SkipTx) {
+	a.skipTxLock.Lock()
+	defer a.skipTxLock.Unlock()
+	a.logger.Printf("mysql.applier: armed skip %v of the next failing transaction %v", skip.ID, skip.Gtid)
+	a.skipTx = skip
+}
+
+func (a *Applier) armedSkipTx() *models.SkipTx {
+	a.skipTxLock.Lock()
+	defer a.skipTxLock.Unlock()
+	return a.skipTx
+}
+
+// disarmSkipTx disarms skip, unless another skip was armed since
+func (a *Applier) disarmSkipTx(skip *models.SkipTx) {
+	a.skipTxLock.Lock()
+	defer a.skipTxLock.Unlock()
+	if a.skipTx != nil && a.skipTx.ID == skip.ID {
+		a.skipTx = nil
+	}
+}
+
+// TaskEvents returns the events of the task which the agent records
+func (a *Applier) TaskEvents() <-chan *models.TaskEvent {
+	return a.taskEvents
+}
+
+func (a *Applier) emitTaskEvent(event *models.TaskEvent) {
+	select {
+	case a.taskEvents <- event:
+	default:
+		a.logger.Warnf("mysql.applier: dropping task event %q: too many events pending", event.Type)
+	}
+}
+
+// skipFailingTx applies the transactions of a failed batch one by one, and
+// skips the first one failing if a skip is armed for it. cause is the error
+// of the batch.
+func (a *Applier) skipFailingTx(dbApplier *sql.Conn, workerIdx int, binlogEntries []*binlog.BinlogEntry,
+	cause error) error {
+	for i, entry := range binlogEntries {
+		err := cause
+		if len(binlogEntries) > 1 {
+			err = a.applyBinlogEntries(dbApplier, workerIdx, binlogEntries[i:i+1])
+		}
+		if err == nil {
+			continue
+		}
+		skip := a.armedSkipTx()
+		if skip == nil || isConnectionError(err) {
+			return err
+		}
+		if entry.Part > 0 {
+			return fmt.Errorf("%v. transaction %v is not skipped, as it is split and applied in parts",
+				err, entry.Coordinates.GetGtidForThisTx())
+		}
+		gtid := fmt.Sprintf("%s:%d", entry.Coordinates.GetSid(), entry.Coordinates.GNO)
+		if skip.Gtid != "" && skip.Gtid != gtid {
+			return fmt.Errorf("%v. transaction %v is not skipped, the skip is armed for %v", err, gtid, skip.Gtid)
+		}
+		if err := a.recordSkippedTx(dbApplier, skip, entry, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSkippedTx records entry in skipped_tx and in gtid_executed, instead
+// of applying it. A skip recorded already, e.g. before the task restarted,
+// skips nothing: cause, the error of entry, is returned.
+func (a *Applier) recordSkippedTx(dbApplier *sql.Conn, skip *models.SkipTx, entry *binlog.BinlogEntry,
+	cause error) (err error) {
+	if err := a.createSkippedTxTable(); err != nil {
+		return fmt.Errorf("%v. cannot skip the transaction: %v", cause, err)
+	}
+	if a.mysqlContext.FillGtidGaps {
+		if err := a.setGtidNext(dbApplier, entry); err != nil {
+			return err
+		}
+		defer func() {
+			if _, errReset := sql.ExecNoPrepare(dbApplier.Db, "set gtid_next='automatic'"); errReset != nil && err == nil {
+				err = errReset
+			}
+		}()
+	}
+
+	c := entry.Coordinates
+	gtid := fmt.Sprintf("%s:%d", c.GetSid(), c.GNO)
+	s := summarizeTx(entry)
+	var eventTime interface{}
+	if c.EventTimestamp != 0 {
+		eventTime = c.EventTimestamp
+	}
+	tx, err := dbApplier.Db.BeginTx(context.Background(), a.txOptions)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("insert into %v.%v (job_uuid, skip_id, gtid, log_file, log_pos, event_time, tables, "+
+		"row_count, statement_count, error, events, reason) "+
+		"values (?, ?, ?, ?, ?, from_unixtime(?), ?, ?, ?, ?, ?, ?)", g.DtleSchemaName, g.SkippedTxTable)
+	_, err = tx.Exec(query, a.subjectUUID.Bytes(), skip.ID, gtid, c.LogFile, c.LogPos, eventTime,
+		strings.Join(s.tables, ","), s.rows, s.statements, cause.Error(), s.events, skip.Reason)
+	if err == nil {
+		err = insertExecutedGtid(dbApplier, entry)
+	}
+	if err != nil {
+		tx.Rollback()
+	} else {
+		err = tx.Commit()
+	}
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == sql.ErrDupEntry {
+		a.disarmSkipTx(skip)
+		a.logger.Warnf("mysql.applier: skip %v was used already, transaction %v is not skipped", skip.ID, gtid)
+		return cause
+	}
+	if err != nil {
+		return fmt.Errorf("%v. cannot skip the transaction: %v", cause, err)
+	}
+	a.disarmSkipTx(skip)
+
+	a.mtsManager.Executed(entry)
+	atomic.StoreInt64(&a.lastAppliedEventTime, int64(c.EventTimestamp))
+	msg := fmt.Sprintf("skipped transaction %v (%v:%d) of %d rows and %d statements on %v",
+		gtid, c.LogFile, c.LogPos, s.rows, s.statements, strings.Join(s.tables, ", "))
+	a.logger.Warnf("mysql.applier: %s, as armed by skip %v: %v", msg, skip.ID, cause)
+	a.emitTaskEvent(models.NewTaskEvent(models.TaskTxSkipped).SetDriverMessage(msg).SetDriverError(cause))
+	return nil
+}
+
+type txSummary struct {
+	// as "schema.table", sorted
+	tables     []string
+	rows       int64
+	statements int64
+	// the events, a line each
+	events string
+}
+
+func summarizeTx(entry *binlog.BinlogEntry) *txSummary {
+	s := &txSummary{}
+	tables := make(map[string]struct{})
+	lines := make([]string, 0, len(entry.Events))
+	for i := range entry.Events {
+		event := &entry.Events[i]
+		schema := event.DatabaseName
+		if event.DML == binlog.NotDML {
+			s.statements++
+			if schema == "" {
+				schema = event.CurrentSchema
+			}
+			lines = append(lines, utils.StrLim(event.Query, maxDescribedEventLen))
+		} else {
+			s.rows++
+			lines = append(lines, describeEvent(event))
+		}
+		if event.TableName != "" {
+			tables[fmt.Sprintf("%s.%s", schema, event.TableName)] = struct{}{}
+		}
+	}
+	for table := range tables {
+		s.tables = append(s.tables, table)
+	}
+	sort.Strings(s.tables)
+	s.events = strings.Join(lines, "\n")
+	return s
+}
+
+// ListSkippedTxs reads the latest transactions skipped on a target by a job
+func ListSkippedTxs(ctx context.Context, db *gosql.DB, jobID string, limit int) ([]*models.SkippedTxRecord, error) {
+	jobUUID, err := uuid.FromString(jobID)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("select id, skip_id, gtid, log_file, log_pos, ifnull(cast(event_time as char), ''), "+
+		"tables, row_count, statement_count, error, events, ifnull(reason, ''), cast(skipped_at as char) "+
+		"from %v.%v where job_uuid = ? order by id desc limit ?", g.DtleSchemaName, g.SkippedTxTable)
+	rows, err := db.QueryContext(ctx, query, jobUUID.Bytes(), limit)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == sql.ErrNoSuchTable {
+		// no transaction was skipped on the target
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*models.SkippedTxRecord
+	for rows.Next() {
+		r := &models.SkippedTxRecord{}
+		var tables string
+		if err := rows.Scan(&r.ID, &r.SkipID, &r.Gtid, &r.LogFile, &r.LogPos, &r.EventTime, &tables,
+			&r.Rows, &r.Statements, &r.Error, &r.Events, &r.Reason, &r.SkippedAt); err != nil {
+			return nil, err
+		}
+		if tables != "" {
+			r.Tables = strings.Split(tables, ",")
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestSummarizeTx(t *testing.T) {
+	entry := &binlog.BinlogEntry{}
+	update := binlog.NewDataEvent("db1", "tb2", binlog.UpdateDML, 1)
+	update.WhereColumnValues = umconf.ToColumnValues([]interface{}{int64(1)})
+	update.NewColumnValues = umconf.ToColumnValues([]interface{}{int64(2)})
+	insert := binlog.NewDataEvent("db1", "tb1", binlog.InsertDML, 1)
+	insert.NewColumnValues = umconf.ToColumnValues([]interface{}{int64(3)})
+	del := binlog.NewDataEvent("db1", "tb1", binlog.DeleteDML, 1)
+	del.WhereColumnValues = umconf.ToColumnValues([]interface{}{int64(4)})
+	entry.Events = []binlog.DataEvent{
+		update,
+		insert,
+		binlog.NewQueryEventAffectTable("db2", "truncate table tb3", binlog.NotDML,
+			binlog.SchemaTable{Table: "tb3"}),
+		del,
+	}
+
+	s := summarizeTx(entry)
+	test.S(t).ExpectEquals(len(s.tables), 3)
+	test.S(t).ExpectEquals(s.tables[0], "db1.tb1")
+	test.S(t).ExpectEquals(s.tables[1], "db1.tb2")
+	test.S(t).ExpectEquals(s.tables[2], "db2.tb3")
+	test.S(t).ExpectEquals(s.rows, int64(3))
+	test.S(t).ExpectEquals(s.statements, int64(1))
+	test.S(t).ExpectEquals(s.events, "Update on db1.tb2 of the row (@1=1) with (@1=2)\n"+
+		"Insert on db1.tb1 with (@1=3)\n"+
+		"truncate table tb3\n"+
+		"Delete on db1.tb1 of the row (@1=4)")
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// a new segment file is started once the current one reaches this size
+const spillSegmentSize = 64 * 1024 * 1024
+
+var errSpillClosed = fmt.Errorf("spill buffer is closed")
+
+// spillBuffer is a bounded FIFO of messages between the transport and the apply.
+// The first memLimit bytes are kept in memory, the rest is spilled to segment
+// files in dir. Once it holds highWatermark bytes, Push blocks until Pop has
+// drained it below lowWatermark.
+type spillBuffer struct {
+	dir           string
+	memLimit      int64
+	highWatermark int64
+	lowWatermark  int64
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	items    []*spillItem
+	memBytes int64
+	// bytes in memory and on disk
+	size   int64
+	full   bool
+	closed bool
+
+	// segments in the order of creation. The last one is being written.
+	segments  []*spillSegment
+	nextSegID int
+}
+
+type spillItem struct {
+	// nil if the item is on disk
+	data []byte
+	seg  *spillSegment
+	off  int64
+	n    int
+}
+
+type spillSegment struct {
+	path string
+	file *os.File
+	// bytes written
+	size int64
+	// items not popped yet
+	nItems int
+}
+
+// newSpillBuffer creates dir. Files left by a previous run are removed,
+// as the applier restarts from its executed GTID set anyway.
+func newSpillBuffer(dir string, memLimit, highWatermark, lowWatermark int64) (*spillBuffer, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	b := &spillBuffer{
+		dir:           dir,
+		memLimit:      memLimit,
+		highWatermark: highWatermark,
+		lowWatermark:  lowWatermark,
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b, nil
+}
+
+// Push appends data. It returns false if the buffer is still above the high
+// watermark after timeout, in which case the message is not taken.
+func (b *spillBuffer) Push(data []byte, timeout time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.full && !b.closed {
+		deadline := time.Now().Add(timeout)
+		timer := time.AfterFunc(timeout, func() {
+			b.mu.Lock()
+			b.cond.Broadcast()
+			b.mu.Unlock()
+		})
+		defer timer.Stop()
+		for b.full && !b.closed {
+			if !time.Now().Before(deadline) {
+				return false, nil
+			}
+			b.cond.Wait()
+		}
+	}
+	if b.closed {
+		return false, errSpillClosed
+	}
+
+	item := &spillItem{n: len(data)}
+	if b.memBytes+int64(item.n) <= b.memLimit {
+		item.data = data
+		b.memBytes += int64(item.n)
+	} else if err := b.writeItem(item, data); err != nil {
+		return false, err
+	}
+	b.items = append(b.items, item)
+	b.size += int64(item.n)
+	if b.size >= b.highWatermark {
+		b.full = true
+	}
+	b.cond.Broadcast()
+	return true, nil
+}
+
+func (b *spillBuffer) writeItem(item *spillItem, data []byte) error {
+	var seg *spillSegment
+	if len(b.segments) > 0 {
+		seg = b.segments[len(b.segments)-1]
+	}
+	if seg == nil || seg.size >= spillSegmentSize {
+		path := filepath.Join(b.dir, fmt.Sprintf("%08d.spill", b.nextSegID))
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		b.nextSegID++
+		seg = &spillSegment{path: path, file: file}
+		b.segments = append(b.segments, seg)
+	}
+	if _, err := seg.file.WriteAt(data, seg.size); err != nil {
+		return err
+	}
+	item.seg = seg
+	item.off = seg.size
+	seg.size += int64(item.n)
+	seg.nItems++
+	return nil
+}
+
+// Pop removes the first message, waiting for one if the buffer is empty.
+func (b *spillBuffer) Pop() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.items) == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if b.closed {
+		return nil, errSpillClosed
+	}
+
+	item := b.items[0]
+	b.items[0] = nil
+	b.items = b.items[1:]
+
+	data := item.data
+	if data != nil {
+		b.memBytes -= int64(item.n)
+	} else {
+		data = make([]byte, item.n)
+		if _, err := item.seg.file.ReadAt(data, item.off); err != nil {
+			return nil, err
+		}
+		if err := b.releaseSegment(item.seg); err != nil {
+			return nil, err
+		}
+	}
+
+	b.size -= int64(item.n)
+	if b.full && b.size <= b.lowWatermark {
+		b.full = false
+		b.cond.Broadcast()
+	}
+	return data, nil
+}
+
+// releaseSegment removes a drained segment. Segments are drained in order,
+// so it is always the first one. The segment being written is reused instead.
+func (b *spillBuffer) releaseSegment(seg *spillSegment) error {
+	seg.nItems--
+	if seg.nItems > 0 {
+		return nil
+	}
+	if seg == b.segments[len(b.segments)-1] {
+		seg.size = 0
+		return nil
+	}
+	b.segments[0] = nil
+	b.segments = b.segments[1:]
+	seg.file.Close()
+	return os.Remove(seg.path)
+}
+
+// Size returns the bytes held in memory and on disk.
+func (b *spillBuffer) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// Close wakes up the waiting Push and Pop, and removes the spilled files.
+func (b *spillBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.cond.Broadcast()
+
+	for _, seg := range b.segments {
+		seg.file.Close()
+	}
+	b.segments = nil
+	b.items = nil
+	return os.RemoveAll(b.dir)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestSpillBuffer(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "spill")
+	test.S(t).ExpectNil(err)
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "job")
+
+	// 2 messages in memory, up to 8 in total
+	b, err := newSpillBuffer(dir, 20, 80, 40)
+	test.S(t).ExpectNil(err)
+
+	msg := func(i int) []byte {
+		return []byte(fmt.Sprintf("message%03d", i))
+	}
+	for i := 0; i < 8; i++ {
+		ok, err := b.Push(msg(i), time.Second)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(ok)
+	}
+	test.S(t).ExpectEquals(b.Size(), int64(80))
+	files, _ := ioutil.ReadDir(dir)
+	test.S(t).ExpectEquals(len(files), 1)
+
+	// above the high watermark
+	ok, err := b.Push(msg(8), 10*time.Millisecond)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(ok)
+
+	for i := 0; i < 3; i++ {
+		data, err := b.Pop()
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(string(data), string(msg(i)))
+	}
+	// still above the low watermark
+	ok, _ = b.Push(msg(8), 10*time.Millisecond)
+	test.S(t).ExpectFalse(ok)
+
+	for i := 3; i < 5; i++ {
+		data, err := b.Pop()
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(string(data), string(msg(i)))
+	}
+	ok, _ = b.Push(msg(8), 10*time.Millisecond)
+	test.S(t).ExpectTrue(ok)
+
+	for i := 5; i < 9; i++ {
+		data, err := b.Pop()
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(string(data), string(msg(i)))
+	}
+	test.S(t).ExpectEquals(b.Size(), int64(0))
+
+	popped := make(chan error)
+	go func() {
+		_, err := b.Pop()
+		popped <- err
+	}()
+	test.S(t).ExpectNil(b.Close())
+	test.S(t).ExpectEquals(<-popped, errSpillClosed)
+	_, err = os.Stat(dir)
+	test.S(t).ExpectTrue(os.IsNotExist(err))
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/g"
+)
+
+// txParts is the transaction split by TxSplitRows being applied, with the
+// number of its events applied.
+type txParts struct {
+	sid     uuid.UUID
+	gno     int64
+	applied int
+}
+
+func (a *Applier) createSplitTxTable() error {
+	query := fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %v.%v (
+				job_uuid binary(16) NOT NULL PRIMARY KEY COMMENT 'unique identifier of job',
+				source_uuid binary(16) NOT NULL COMMENT 'uuid of the source transaction split',
+				gno bigint NOT NULL COMMENT 'gno of the source transaction split',
+				part int NOT NULL COMMENT 'the last part applied',
+				events bigint NOT NULL COMMENT 'the events applied, in the parts up to it',
+				updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+			);
+		`, g.DtleSchemaName, g.SplitTxTable)
+	_, err := a.db.Exec(query)
+	return err
+}
+
+// resumeParts drops the events of a part of a split transaction which the
+// target applied already, e.g. before the task restarted. It returns false
+// if none of the part is left to apply.
+func (a *Applier) resumeParts(entry *binlog.BinlogEntry) (bool, error) {
+	c := &entry.Coordinates
+	if a.mysqlContext.FillGtidGaps {
+		return false, fmt.Errorf("transaction %v is split by TxSplitRows of the Src task, "+
+			"which cannot be applied with FillGtidGaps", c.GetGtidForThisTx())
+	}
+	if a.txParts == nil || a.txParts.sid != c.SID || a.txParts.gno != c.GNO {
+		applied, err := a.readPartsApplied(entry)
+		if err != nil {
+			return false, err
+		}
+		if applied > 0 {
+			a.logger.Printf("mysql.applier: resuming split transaction %v after its %d events applied",
+				c.GetGtidForThisTx(), applied)
+		}
+		a.txParts = &txParts{sid: c.SID, gno: c.GNO, applied: applied}
+	}
+	trimAppliedEvents(entry, a.txParts.applied)
+	a.txParts.applied = entry.PartOffset + len(entry.Events)
+	if !entry.MoreParts {
+		a.txParts = nil
+		// the last part records the transaction executed
+		return true, nil
+	}
+	return len(entry.Events) > 0, nil
+}
+
+// trimAppliedEvents drops the events of entry among the first applied
+// events of its transaction.
+func trimAppliedEvents(entry *binlog.BinlogEntry, applied int) {
+	n := applied - entry.PartOffset
+	if n <= 0 {
+		return
+	}
+	if n > len(entry.Events) {
+		n = len(entry.Events)
+	}
+	entry.Events = entry.Events[n:]
+	entry.PartOffset += n
+}
+
+// readPartsApplied reads the number of the events of the split transaction
+// of entry which the target applied.
+func (a *Applier) readPartsApplied(entry *binlog.BinlogEntry) (int, error) {
+	if err := a.createSplitTxTable(); err != nil {
+		return 0, err
+	}
+	ctx, cancel := a.queryContext()
+	defer cancel()
+	var applied int
+	query := fmt.Sprintf("select events from %v.%v where job_uuid = ? and source_uuid = ? and gno = ?",
+		g.DtleSchemaName, g.SplitTxTable)
+	err := a.db.QueryRowContext(ctx, query, a.subjectUUID.Bytes(), entry.Coordinates.SID.Bytes(),
+		entry.Coordinates.GNO).Scan(&applied)
+	if err == gosql.ErrNoRows {
+		// none applied. The row of another transaction, which did not
+		// complete, is replaced by the first part.
+		return 0, nil
+	}
+	return applied, err
+}
+
+// recordPart records the events of the split transaction of entry applied
+// with it, in tx. The record is deleted with the last part, as the
+// transaction is recorded executed.
+func (a *Applier) recordPart(tx *gosql.Tx, entry *binlog.BinlogEntry) error {
+	var err error
+	if entry.MoreParts {
+		query := fmt.Sprintf("replace into %v.%v (job_uuid, source_uuid, gno, part, events) values (?, ?, ?, ?, ?)",
+			g.DtleSchemaName, g.SplitTxTable)
+		_, err = tx.Exec(query, a.subjectUUID.Bytes(), entry.Coordinates.SID.Bytes(), entry.Coordinates.GNO,
+			entry.Part, entry.PartOffset+len(entry.Events))
+	} else {
+		query := fmt.Sprintf("delete from %v.%v where job_uuid = ?", g.DtleSchemaName, g.SplitTxTable)
+		_, err = tx.Exec(query, a.subjectUUID.Bytes())
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+)
+
+func TestTrimAppliedEvents(t *testing.T) {
+	row := binlog.NewDataEvent("db1", "tb1", binlog.DeleteDML, 1)
+	tests := []struct {
+		offset, events, applied int
+		wantOffset, wantEvents  int
+	}{
+		{0, 3, 0, 0, 3},
+		{3, 3, 3, 3, 3},
+		{3, 3, 4, 4, 2},
+		{3, 3, 6, 6, 0},
+		{3, 3, 9, 6, 0},
+	}
+	for _, tt := range tests {
+		entry := &binlog.BinlogEntry{Part: 2, PartOffset: tt.offset}
+		for i := 0; i < tt.events; i++ {
+			entry.Events = append(entry.Events, row)
+		}
+		trimAppliedEvents(entry, tt.applied)
+		if entry.PartOffset != tt.wantOffset || len(entry.Events) != tt.wantEvents {
+			t.Errorf("trimAppliedEvents(%d events at %d, %d) = %d events at %d, want %d at %d",
+				tt.events, tt.offset, tt.applied, len(entry.Events), entry.PartOffset, tt.wantEvents, tt.wantOffset)
+		}
+	}
+}
@@ -129,64 +129,19 @@ func BuildDMLDeleteQuery(databaseName, tableName string, tableColumns *umconf.Co
 		return result, columnArgs, fmt.Errorf("args count differs from table column count in BuildDMLDeleteQuery %v, %v",
 			len(args), tableColumns.Len())
 	}
-	comparisons := []string{}
-	uniqueKeyComparisons := []string{}
-	uniqueKeyArgs := make([]interface{}, 0)
-	for _, column := range tableColumns.ColumnList() {
-		tableOrdinal := tableColumns.Ordinals[column.Name]
-		if *args[tableOrdinal] == nil {
-			comparison, err := BuildValueComparison(column.Name, "NULL", IsEqualsComparisonSign)
-			if err != nil {
-				return result, columnArgs, err
-			}
-			comparisons = append(comparisons, comparison)
-		} else {
-			if strings.HasPrefix(column.ColumnType, "binary") {
-				arg := column.ConvertArg(*args[tableOrdinal])
-				comparison, err := BuildValueComparison(column.Name, fmt.Sprintf("cast('%v' as %s)", arg, column.ColumnType), EqualsComparisonSign)
-				if err != nil {
-					return result, columnArgs, err
-				}
-				if strings.ToUpper(column.Key) == "PRI" {
-					uniqueKeyComparisons = append(uniqueKeyComparisons, comparison)
-				} else {
-					comparisons = append(comparisons, comparison)
-				}
-			} else {
-				arg := column.ConvertArg(*args[tableOrdinal])
-				comparison, err := BuildValueComparison(column.Name, "?", EqualsComparisonSign)
-				if err != nil {
-					return result, columnArgs, err
-				}
-				if strings.ToUpper(column.Key) == "PRI" {
-					uniqueKeyArgs = append(uniqueKeyArgs, arg)
-					uniqueKeyComparisons = append(uniqueKeyComparisons, comparison)
-				} else {
-					columnArgs = append(columnArgs, arg)
-					comparisons = append(comparisons, comparison)
-				}
-			}
-		}
-	}
-	if len(uniqueKeyComparisons) > 0 {
-		comparisons = uniqueKeyComparisons
-	}
-	if len(uniqueKeyArgs) > 0 {
-		columnArgs = uniqueKeyArgs
-	}
-	databaseName = EscapeName(databaseName)
-	tableName = EscapeName(tableName)
+	comparisons, columnArgs, err := buildWhereComparisons(tableColumns, args)
 	if err != nil {
 		return result, columnArgs, err
 	}
+	databaseName = EscapeName(databaseName)
+	tableName = EscapeName(tableName)
 	result = fmt.Sprintf(`
 			delete
 				from
 					%s.%s
 				where
 					%s
-		`, databaseName, tableName,
-		fmt.Sprintf("(%s)", strings.Join(comparisons, " and ")),
+		`, databaseName, tableName, comparisons,
 	)
 	return result, columnArgs, nil
 }
@@ -256,7 +211,7 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 	for _, column := range tableColumns.ColumnList() {
 		tableOrdinal := tableColumns.Ordinals[column.Name]
 		if *valueArgs[tableOrdinal] == nil || *valueArgs[tableOrdinal] == "NULL" ||
-			fmt.Sprintf("%v", *valueArgs[tableOrdinal]) == "" {
+			(fmt.Sprintf("%v", *valueArgs[tableOrdinal]) == "" && column.Type != umconf.JSONColumnType) {
 			sharedArgs = append(sharedArgs, *valueArgs[tableOrdinal])
 		} else {
 			arg := column.ConvertArg(*valueArgs[tableOrdinal])
@@ -264,23 +219,46 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 		}
 	}
 
+	comparisons, columnArgs, err := buildWhereComparisons(tableColumns, whereArgs)
+	if err != nil {
+		return result, sharedArgs, columnArgs, err
+	}
+	setClause, err := BuildSetPreparedClause(mappedSharedColumns)
+
+	result = fmt.Sprintf(`
+ 			update
+ 					%s.%s
+				set
+					%s
+				where
+ 					%s
+ 				limit 1
+ 		`, databaseName, tableName,
+		setClause, comparisons,
+	)
+	return result, sharedArgs, columnArgs, nil
+}
+
+// buildWhereComparisons returns the condition matching the row of args,
+// on its primary key if the table has one, and the args of the condition.
+func buildWhereComparisons(tableColumns *umconf.ColumnList, args []*interface{}) (result string, columnArgs []interface{}, err error) {
 	comparisons := []string{}
 	uniqueKeyComparisons := []string{}
 	uniqueKeyArgs := make([]interface{}, 0)
 	for _, column := range tableColumns.ColumnList() {
 		tableOrdinal := tableColumns.Ordinals[column.Name]
-		if *whereArgs[tableOrdinal] == nil {
+		if *args[tableOrdinal] == nil {
 			comparison, err := BuildValueComparison(column.Name, "NULL", IsEqualsComparisonSign)
 			if err != nil {
-				return result, sharedArgs, columnArgs, err
+				return result, columnArgs, err
 			}
 			comparisons = append(comparisons, comparison)
 		} else {
 			if strings.HasPrefix(column.ColumnType, "binary") {
-				arg := column.ConvertArg(*whereArgs[tableOrdinal])
+				arg := column.ConvertArg(*args[tableOrdinal])
 				comparison, err := BuildValueComparison(column.Name, fmt.Sprintf("cast('%v' as %s)", arg, column.ColumnType), EqualsComparisonSign)
 				if err != nil {
-					return result, sharedArgs, columnArgs, err
+					return result, columnArgs, err
 				}
 				if strings.ToUpper(column.Key) == "PRI" {
 					uniqueKeyComparisons = append(uniqueKeyComparisons, comparison)
@@ -288,10 +266,15 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 					comparisons = append(comparisons, comparison)
 				}
 			} else {
-				arg := column.ConvertArg(*whereArgs[tableOrdinal])
-				comparison, err := BuildValueComparison(column.Name, "?", EqualsComparisonSign)
+				arg := column.ConvertArg(*args[tableOrdinal])
+				value := "?"
+				if column.Type == umconf.JSONColumnType {
+					// compared as a JSON value rather than as a string
+					value = "cast(? as json)"
+				}
+				comparison, err := BuildValueComparison(column.Name, value, EqualsComparisonSign)
 				if err != nil {
-					return result, sharedArgs, columnArgs, err
+					return result, columnArgs, err
 				}
 				if strings.ToUpper(column.Key) == "PRI" {
 					uniqueKeyArgs = append(uniqueKeyArgs, arg)
@@ -309,7 +292,73 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 	if len(uniqueKeyArgs) > 0 {
 		columnArgs = uniqueKeyArgs
 	}
-	setClause, err := BuildSetPreparedClause(mappedSharedColumns)
+	return fmt.Sprintf("(%s)", strings.Join(comparisons, " and ")), columnArgs, nil
+}
+
+// BuildDMLPartialUpdateQuery builds the update of a row whose JSON columns
+// of jsonDiffs, by ordinal, are updated partially: their changes are applied
+// to their value on the target, e.g. with json_replace, instead of setting
+// it. The changes are applied in order.
+func BuildDMLPartialUpdateQuery(databaseName, tableName string, tableColumns *umconf.ColumnList, valueArgs, whereArgs []*interface{},
+	jsonDiffs map[int][]umconf.JSONDiff) (result string, args []interface{}, err error) {
+	if len(valueArgs) < tableColumns.Len() || len(whereArgs) < tableColumns.Len() {
+		return result, args, fmt.Errorf("args count differs from table column count in BuildDMLPartialUpdateQuery %v, %v, %v",
+			len(valueArgs), len(whereArgs), tableColumns.Len())
+	}
+	if tableColumns.Len() == 0 {
+		return result, args, fmt.Errorf("Got 0 columns in BuildDMLPartialUpdateQuery")
+	}
+
+	setTokens := []string{}
+	for _, column := range tableColumns.ColumnList() {
+		tableOrdinal := tableColumns.Ordinals[column.Name]
+		name := EscapeName(column.Name)
+		if diffs, ok := jsonDiffs[tableOrdinal]; ok {
+			if column.Type != umconf.JSONColumnType {
+				return result, args, fmt.Errorf("partial update of column %v, which is not JSON", column.Name)
+			}
+			expr := name
+			for _, diff := range diffs {
+				switch diff.Op {
+				case umconf.JSONDiffReplace:
+					expr = fmt.Sprintf("json_replace(%s, ?, cast(? as json))", expr)
+					args = append(args, diff.Path, diff.Value)
+				case umconf.JSONDiffInsert:
+					function := "json_insert"
+					if strings.HasSuffix(diff.Path, "]") {
+						// an element inserted into an array, moving the next ones
+						function = "json_array_insert"
+					}
+					expr = fmt.Sprintf("%s(%s, ?, cast(? as json))", function, expr)
+					args = append(args, diff.Path, diff.Value)
+				case umconf.JSONDiffRemove:
+					expr = fmt.Sprintf("json_remove(%s, ?)", expr)
+					args = append(args, diff.Path)
+				default:
+					return result, args, fmt.Errorf("unknown change %d of JSON column %v", diff.Op, column.Name)
+				}
+			}
+			setTokens = append(setTokens, fmt.Sprintf("%s=%s", name, expr))
+			continue
+		}
+
+		if column.TimezoneConversion != nil {
+			setTokens = append(setTokens, fmt.Sprintf("%s=convert_tz(?, '%s', '%s')", name, column.TimezoneConversion.ToTimezone, "+00:00"))
+		} else {
+			setTokens = append(setTokens, fmt.Sprintf("%s=?", name))
+		}
+		if *valueArgs[tableOrdinal] == nil {
+			args = append(args, nil)
+		} else {
+			args = append(args, column.ConvertArg(*valueArgs[tableOrdinal]))
+		}
+	}
+
+	comparisons, whereColumnArgs, err := buildWhereComparisons(tableColumns, whereArgs)
+	if err != nil {
+		return result, args, err
+	}
+	args = append(args, whereColumnArgs...)
 
 	result = fmt.Sprintf(`
  			update
@@ -319,9 +368,8 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 				where
  					%s
  				limit 1
- 		`, databaseName, tableName,
-		setClause,
-		fmt.Sprintf("(%s)", strings.Join(comparisons, " and ")),
+ 		`, EscapeName(databaseName), EscapeName(tableName),
+		strings.Join(setTokens, ", "), comparisons,
 	)
-	return result, sharedArgs, columnArgs, nil
+	return result, args, nil
 }
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package sql
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func jsonTableColumns(key string) *umconf.ColumnList {
+	return umconf.NewColumnList([]umconf.Column{
+		{Name: "id", Type: umconf.IntColumnType, Key: key},
+		{Name: "doc", Type: umconf.JSONColumnType, ColumnType: "json"},
+	})
+}
+
+func jsonArgs(values ...interface{}) []*interface{} {
+	args := make([]*interface{}, len(values))
+	for i := range values {
+		args[i] = &values[i]
+	}
+	return args
+}
+
+func compactQuery(query string) string {
+	return strings.TrimSpace(regexp.MustCompile(`\s+`).ReplaceAllString(query, " "))
+}
+
+func TestBuildDMLQueryJSON(t *testing.T) {
+	// without a primary key, doc is compared as JSON
+	query, args, err := BuildDMLDeleteQuery("db1", "tb1", jsonTableColumns(""), jsonArgs(1, `{"a": 1}`))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(compactQuery(query), "delete from `db1`.`tb1` where ((`id` = ?) and (`doc` = cast(? as json)))")
+	test.S(t).ExpectTrue(reflect.DeepEqual(args, []interface{}{1, `{"a": 1}`}))
+
+	// an empty JSON is the JSON null
+	tableColumns := jsonTableColumns("PRI")
+	_, sharedArgs, _, err := BuildDMLUpdateQuery("db1", "tb1", tableColumns, tableColumns, tableColumns, tableColumns,
+		jsonArgs(1, []byte{}), jsonArgs(1, []byte("[1]")))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(reflect.DeepEqual(sharedArgs, []interface{}{1, "null"}))
+}
+
+func TestBuildDMLPartialUpdateQuery(t *testing.T) {
+	diffs := map[int][]umconf.JSONDiff{1: {
+		{Op: umconf.JSONDiffReplace, Path: "$.a", Value: "2"},
+		{Op: umconf.JSONDiffInsert, Path: "$.b", Value: `"x"`},
+		{Op: umconf.JSONDiffInsert, Path: "$.c[0]", Value: "null"},
+		{Op: umconf.JSONDiffRemove, Path: "$.d"},
+	}}
+	query, args, err := BuildDMLPartialUpdateQuery("db1", "tb1", jsonTableColumns("PRI"),
+		jsonArgs(1, nil), jsonArgs(1, `{"a": 1}`), diffs)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(compactQuery(query), "update `db1`.`tb1` set `id`=?, "+
+		"`doc`=json_remove(json_array_insert(json_insert(json_replace(`doc`, ?, cast(? as json)), "+
+		"?, cast(? as json)), ?, cast(? as json)), ?) where ((`id` = ?)) limit 1")
+	test.S(t).ExpectTrue(reflect.DeepEqual(args,
+		[]interface{}{1, "$.a", "2", "$.b", `"x"`, "$.c[0]", "null", "$.d", 1}))
+
+	// only a JSON column is updated partially
+	_, _, err = BuildDMLPartialUpdateQuery("db1", "tb1", jsonTableColumns("PRI"),
+		jsonArgs(1, nil), jsonArgs(1, `{"a": 1}`), map[int][]umconf.JSONDiff{0: diffs[1]})
+	test.S(t).ExpectNotNil(err)
+}
@@ -171,12 +171,7 @@ func CreateDB(mysql_uri string) (*gosql.DB, error) {
 func CreateConns(db *gosql.DB, count int) ([]*Conn, error) {
 	conns := make([]*Conn, count)
 	for i := 0; i < count; i++ {
-		conn, err := db.Conn(context.Background())
-		if err != nil {
-			return nil, err
-		}
-
-		_, err = conn.ExecContext(context.Background(), "SET @@session.foreign_key_checks = 0")
+		conn, err := OpenConn(db)
 		if err != nil {
 			return nil, err
 		}
@@ -189,6 +184,39 @@ func CreateConns(db *gosql.DB, count int) ([]*Conn, error) {
 	return conns, nil
 }
 
+// OpenConn takes a connection of db for an applier worker
+func OpenConn(db *gosql.DB) (*gosql.Conn, error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(context.Background(), "SET @@session.foreign_key_checks = 0"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ParseIsolationLevel reads a MySQL isolation level, e.g. "READ-COMMITTED" or
+// "read committed". An empty level is the default of the server.
+func ParseIsolationLevel(level string) (gosql.IsolationLevel, error) {
+	normalized := strings.ToUpper(strings.NewReplacer("-", " ", "_", " ").Replace(strings.TrimSpace(level)))
+	switch normalized {
+	case "":
+		return gosql.LevelDefault, nil
+	case "READ UNCOMMITTED":
+		return gosql.LevelReadUncommitted, nil
+	case "READ COMMITTED":
+		return gosql.LevelReadCommitted, nil
+	case "REPEATABLE READ":
+		return gosql.LevelRepeatableRead, nil
+	case "SERIALIZABLE":
+		return gosql.LevelSerializable, nil
+	default:
+		return gosql.LevelDefault, fmt.Errorf("unknown isolation level: %v", level)
+	}
+}
+
 // RowToArray is a convenience function, typically not called directly, which maps a
 // single read database row into a NullString
 func RowToArray(rows *gosql.Rows, columns []string) []CellData {
@@ -240,7 +268,7 @@ func ScanRowsToMaps(rows *gosql.Rows, on_row func(RowMap) error) error {
 
 // QueryRowsMap is a convenience function allowing querying a result set while poviding a callback
 // function activated per read row.
-func QueryRowsMap(db QueryAble, query string, on_row func(RowMap) error, args ...interface{}) error {
+func QueryRowsMap(ctx context.Context, db QueryAble, query string, on_row func(RowMap) error, args ...interface{}) error {
 	var err error
 	defer func() {
 		if derr := recover(); derr != nil {
@@ -248,11 +276,11 @@ func QueryRowsMap(db QueryAble, query string, on_row func(RowMap) error, args ..
 		}
 	}()
 
-	rows, err := db.Query(query, args...)
-	defer rows.Close()
-	if err != nil && err != gosql.ErrNoRows {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
 		return err
 	}
+	defer rows.Close()
 	err = ScanRowsToMaps(rows, on_row)
 	return err
 }
@@ -263,10 +291,13 @@ type QueryAble interface {
 	Prepare(query string) (*gosql.Stmt, error)
 	Query(query string, args ...interface{}) (*gosql.Rows, error)
 	QueryRow(query string, args ...interface{}) *gosql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (gosql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*gosql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *gosql.Row
 }
 
 // queryResultData returns a raw array of rows for a given query, optionally reading and returning column names
-func queryResultData(db *gosql.DB, query string, retrieveColumns bool, args ...interface{}) (ResultData, []string, error) {
+func queryResultData(ctx context.Context, db *gosql.DB, query string, retrieveColumns bool, args ...interface{}) (ResultData, []string, error) {
 	var err error
 	defer func() {
 		if derr := recover(); derr != nil {
@@ -275,11 +306,11 @@ func queryResultData(db *gosql.DB, query string, retrieveColumns bool, args ...i
 	}()
 
 	columns := []string{}
-	rows, err := db.Query(query, args...)
-	defer rows.Close()
-	if err != nil && err != gosql.ErrNoRows {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
 		return EmptyResultData, columns, err
 	}
+	defer rows.Close()
 	if retrieveColumns {
 		// Don't pay if you don't want to
 		columns, _ = rows.Columns()
@@ -293,21 +324,21 @@ func queryResultData(db *gosql.DB, query string, retrieveColumns bool, args ...i
 }
 
 // QueryResultData returns a raw array of rows
-func QueryResultData(db *gosql.DB, query string, args ...interface{}) (ResultData, error) {
-	resultData, _, err := queryResultData(db, query, false, args...)
+func QueryResultData(ctx context.Context, db *gosql.DB, query string, args ...interface{}) (ResultData, error) {
+	resultData, _, err := queryResultData(ctx, db, query, false, args...)
 	return resultData, err
 }
 
 // QueryResultDataNamed returns a raw array of rows, with column names
-func QueryResultDataNamed(db *gosql.DB, query string, args ...interface{}) (ResultData, []string, error) {
-	return queryResultData(db, query, true, args...)
+func QueryResultDataNamed(ctx context.Context, db *gosql.DB, query string, args ...interface{}) (ResultData, []string, error) {
+	return queryResultData(ctx, db, query, true, args...)
 }
 
 // QueryRowsMapBuffered reads data from the database into a buffer, and only then applies the given function per row.
 // This allows the application to take its time with processing the data, albeit consuming as much memory as required by
 // the result set.
-func QueryRowsMapBuffered(db *gosql.DB, query string, on_row func(RowMap) error, args ...interface{}) error {
-	resultData, columns, err := queryResultData(db, query, true, args...)
+func QueryRowsMapBuffered(ctx context.Context, db *gosql.DB, query string, on_row func(RowMap) error, args ...interface{}) error {
+	resultData, columns, err := queryResultData(ctx, db, query, true, args...)
 	if err != nil {
 		// Already logged
 		return err
@@ -352,11 +383,11 @@ func Args(args ...interface{}) []interface{} {
 //INSERT INTO {{ .Name }} VALUES {{ .Values }};
 //UNLOCK TABLES;
 
-func ShowDatabases(db *gosql.DB) ([]string, error) {
+func ShowDatabases(ctx context.Context, db *gosql.DB) ([]string, error) {
 	dbs := make([]string, 0)
 
 	// Get table list
-	rows, err := db.Query("SHOW DATABASES")
+	rows, err := db.QueryContext(ctx, "SHOW DATABASES")
 	if err != nil {
 		return dbs, err
 	}
@@ -378,7 +409,7 @@ func ShowDatabases(db *gosql.DB) ([]string, error) {
 	return dbs, rows.Err()
 }
 
-func ShowTables(db *gosql.DB, dbName string, showType bool) (tables []*config.Table, err error) {
+func ShowTables(ctx context.Context, db *gosql.DB, dbName string, showType bool) (tables []*config.Table, err error) {
 	// Get table list
 	var query string
 	if showType {
@@ -387,7 +418,7 @@ func ShowTables(db *gosql.DB, dbName string, showType bool) (tables []*config.Ta
 	} else {
 		query = fmt.Sprintf("SHOW TABLES IN %s", dbName)
 	}
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return tables, err
 	}
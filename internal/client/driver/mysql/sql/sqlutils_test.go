@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestParseIsolationLevel(t *testing.T) {
+	for level, expected := range map[string]gosql.IsolationLevel{
+		"":                 gosql.LevelDefault,
+		"READ-COMMITTED":   gosql.LevelReadCommitted,
+		"read committed":   gosql.LevelReadCommitted,
+		"REPEATABLE_READ":  gosql.LevelRepeatableRead,
+		"READ-UNCOMMITTED": gosql.LevelReadUncommitted,
+		"Serializable":     gosql.LevelSerializable,
+	} {
+		got, err := ParseIsolationLevel(level)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(got, expected)
+	}
+
+	_, err := ParseIsolationLevel("snapshot")
+	test.S(t).ExpectNotNil(err)
+}
+
+// hangingDriver answers no query, as a hung server, until the query is
+// cancelled
+type hangingDriver struct{}
+type hangingConn struct{}
+
+func (hangingDriver) Open(name string) (driver.Conn, error) { return hangingConn{}, nil }
+
+func (hangingConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (hangingConn) Close() error                              { return nil }
+func (hangingConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func (hangingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func init() {
+	gosql.Register("hanging", hangingDriver{})
+}
+
+func TestQueryRowsMapTimeout(t *testing.T) {
+	db, err := gosql.Open("hanging", "")
+	test.S(t).ExpectNil(err)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = QueryRowsMap(ctx, db, "show slave status", func(RowMap) error { return nil })
+	test.S(t).ExpectEquals(err, context.DeadlineExceeded)
+	test.S(t).ExpectTrue(time.Since(start) < 5*time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = ShowTables(ctx, db, "db1", true)
+	test.S(t).ExpectEquals(err, context.Canceled)
+}
@@ -0,0 +1,430 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gonats "github.com/nats-io/go-nats"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// A job with a DestStandby task has two appliers, on distinct nodes. The
+// active one applies the stream and publishes a heartbeat with its checkpoint
+// every second. The standby one receives the stream too, without acking or
+// applying it, and keeps the latest entries. Once the heartbeats stop for
+// StandbyTakeoverSeconds, it announces the takeover, applies the entries kept
+// (those already applied are skipped with gtid_executed) and goes on as the
+// active applier, without waiting for the job to be rescheduled.
+//
+// The roles are decided at runtime: the Dest task starts as the active
+// applier unless another applier answers as the active one, and the
+// DestStandby task always starts as the standby. An active applier hearing
+// the takeover of another one steps down.
+
+const (
+	standbyHeartbeatInterval = time.Second
+	// how long a starting Dest task waits for an active applier to answer
+	standbyQueryTimeout = time.Second
+)
+
+// applierHeartbeat is published by the active applier on
+// <subject>_applier_hb, and by a standby on <subject>_applier_takeover when
+// it takes over.
+type applierHeartbeat struct {
+	ID   string
+	Gtid string
+}
+
+// standbyState is the role of an applier of a job with a hot standby.
+type standbyState struct {
+	// id tells the appliers of the job apart
+	id string
+	// taskType is the task running the applier, Dest or DestStandby
+	taskType string
+	// localNatsAddr is the NATS server of the node of the applier, which the
+	// extractor publishes to once the node of the other applier is lost
+	localNatsAddr string
+
+	active int32
+	// unix nanoseconds of the last heartbeat of the active applier
+	lastHeartbeat int64
+	// the checkpoint of the last heartbeat
+	gtidLock sync.Mutex
+	gtid     string
+
+	window *standbyWindow
+	subs   []*gonats.Subscription
+}
+
+func (s *standbyState) isActive() bool {
+	return atomic.LoadInt32(&s.active) == 1
+}
+
+func (s *standbyState) setActive(active bool) {
+	var v int32
+	if active {
+		v = 1
+	}
+	atomic.StoreInt32(&s.active, v)
+}
+
+// heard records a heartbeat of the active applier at now, with its
+// checkpoint if it has one.
+func (s *standbyState) heard(now time.Time, gtid string) {
+	atomic.StoreInt64(&s.lastHeartbeat, now.UnixNano())
+	if gtid != "" {
+		s.gtidLock.Lock()
+		s.gtid = gtid
+		s.gtidLock.Unlock()
+	}
+}
+
+// checkpoint returns the checkpoint of the last heartbeat.
+func (s *standbyState) checkpoint() string {
+	s.gtidLock.Lock()
+	defer s.gtidLock.Unlock()
+	return s.gtid
+}
+
+// shouldTakeOver tells whether a standby has gone without a heartbeat for
+// timeout at now. It only takes over in the incremental replication, which
+// it knows the checkpoint of: a full copy cannot be resumed.
+func (s *standbyState) shouldTakeOver(now time.Time, timeout time.Duration) bool {
+	if s.isActive() || s.checkpoint() == "" {
+		return false
+	}
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&s.lastHeartbeat))) >= timeout
+}
+
+// standbyWindow keeps the latest messages of the incremental stream received
+// by a standby applier, holding up to max binlog entries: the most the queue
+// of the active applier holds before it stops acking.
+type standbyWindow struct {
+	mu       sync.Mutex
+	msgs     [][]byte
+	sizes    []int
+	nEntries int
+	max      int
+}
+
+func newStandbyWindow(max int) *standbyWindow {
+	return &standbyWindow{max: max}
+}
+
+// push keeps a message of nEntries entries, dropping the oldest ones beyond
+// max entries. A message bigger than max alone is not kept.
+func (w *standbyWindow) push(data []byte, nEntries int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.msgs = append(w.msgs, data)
+	w.sizes = append(w.sizes, nEntries)
+	w.nEntries += nEntries
+	for len(w.msgs) > 0 && w.nEntries > w.max {
+		w.nEntries -= w.sizes[0]
+		w.msgs = w.msgs[1:]
+		w.sizes = w.sizes[1:]
+	}
+}
+
+// drain returns the messages kept, oldest first, and empties the window.
+func (w *standbyWindow) drain() [][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	msgs := w.msgs
+	w.msgs, w.sizes, w.nEntries = nil, nil, 0
+	return msgs
+}
+
+// EnableStandby makes the applier one of the two appliers of a job with a
+// hot standby, started as the standby if asStandby is set. localNatsAddr is
+// the NATS server of the local agent.
+func (a *Applier) EnableStandby(asStandby bool, localNatsAddr string) error {
+	if a.mysqlContext.SpillDir != "" {
+		return fmt.Errorf("SpillDir is not supported by a job with a %v task", models.TaskTypeDestStandby)
+	}
+	taskType := models.TaskTypeDest
+	if asStandby {
+		taskType = models.TaskTypeDestStandby
+	}
+	a.standby = &standbyState{
+		id:            models.GenerateUUID(),
+		taskType:      taskType,
+		localNatsAddr: localNatsAddr,
+		window:        newStandbyWindow(cap(a.applyDataEntryQueue)),
+	}
+	a.standby.setActive(!asStandby)
+	return nil
+}
+
+// initStandbyNatsConn connects to the NATS server of the job, then to the
+// local one when the former is lost, as the extractor will publish there once
+// the local applier takes over.
+func (a *Applier) initStandbyNatsConn() error {
+	url := fmt.Sprintf("nats://%s", a.mysqlContext.NatsAddr)
+	if a.standby.localNatsAddr != "" && a.standby.localNatsAddr != a.mysqlContext.NatsAddr {
+		url = fmt.Sprintf("%s,nats://%s", url, a.standby.localNatsAddr)
+	}
+	nc, err := gonats.Connect(url, gonats.DontRandomize(), gonats.MaxReconnects(-1))
+	if err != nil {
+		a.logger.Errorf("mysql.applier: Can't connect nats server %v: %v", url, err)
+		return err
+	}
+	a.logger.Debugf("mysql.applier: Connect nats server %v", url)
+	a.natsConn = nc
+	return nil
+}
+
+// startStandby decides the role of the applier, and returns whether it is
+// the active one.
+func (a *Applier) startStandby() (bool, error) {
+	if a.standby.isActive() {
+		msg, err := a.natsConn.Request(fmt.Sprintf("%s_applier_active", a.subject), nil, standbyQueryTimeout)
+		switch err {
+		case nil:
+			a.logger.Printf("mysql.applier: applier %s is active, starting as the standby", msg.Data)
+			a.standby.setActive(false)
+		case gonats.ErrTimeout:
+		default:
+			return false, err
+		}
+	}
+
+	if a.standby.isActive() {
+		a.logger.Printf("mysql.applier: starting as the active applier")
+		return true, a.serveActive()
+	}
+	return false, a.runStandby()
+}
+
+// serveActive answers as the active applier, steps down on the takeover of
+// another one and publishes the heartbeats.
+func (a *Applier) serveActive() error {
+	_, err := a.natsConn.Subscribe(fmt.Sprintf("%s_applier_active", a.subject), func(m *gonats.Msg) {
+		if err := a.natsConn.Publish(m.Reply, []byte(a.standby.id)); err != nil {
+			a.logger.Warnf("mysql.applier: failed to answer as the active applier: %v", err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.natsConn.Subscribe(fmt.Sprintf("%s_applier_takeover", a.subject), func(m *gonats.Msg) {
+		var hb applierHeartbeat
+		if err := json.Unmarshal(m.Data, &hb); err != nil || hb.ID == a.standby.id {
+			return
+		}
+		a.logger.Warnf("mysql.applier: applier %v took over at %v, stepping down", hb.ID, hb.Gtid)
+		a.standby.setActive(false)
+		a.onError(TaskStateRestart, fmt.Errorf("applier %v took over", hb.ID))
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(standbyHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				data, err := json.Marshal(&applierHeartbeat{ID: a.standby.id, Gtid: a.mysqlContext.Gtid})
+				if err != nil {
+					a.logger.Errorf("mysql.applier: failed to marshal the heartbeat: %v", err)
+					continue
+				}
+				if err := a.natsConn.Publish(fmt.Sprintf("%s_applier_hb", a.subject), data); err != nil {
+					a.logger.Warnf("mysql.applier: failed to publish the heartbeat: %v", err)
+				}
+			case <-a.shutdownCh:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// runStandby receives the heartbeats and the incremental stream until the
+// active applier is lost.
+func (a *Applier) runStandby() error {
+	a.mysqlContext.Stage = models.StageStandby
+	a.standby.heard(time.Now(), a.mysqlContext.Gtid)
+
+	sub, err := a.natsConn.Subscribe(fmt.Sprintf("%s_applier_hb", a.subject), func(m *gonats.Msg) {
+		var hb applierHeartbeat
+		if err := json.Unmarshal(m.Data, &hb); err != nil {
+			a.logger.Warnf("mysql.applier: bad heartbeat: %v", err)
+			return
+		}
+		if hb.ID == a.standby.id {
+			return
+		}
+		a.standby.heard(time.Now(), hb.Gtid)
+	})
+	if err != nil {
+		return err
+	}
+	a.standby.subs = append(a.standby.subs, sub)
+
+	incrSubject := fmt.Sprintf("%s_incr", a.subject)
+	if a.mysqlContext.ApproveHeterogeneous {
+		incrSubject = fmt.Sprintf("%s_incr_hete", a.subject)
+	}
+	sub, err = a.natsConn.Subscribe(incrSubject, func(m *gonats.Msg) {
+		complete, err := a.openMsg(m)
+		if err != nil {
+			a.logger.Warnf("mysql.applier: standby: %v", err)
+			return
+		}
+		if !complete {
+			return
+		}
+		nEntries, gtid, err := a.decodeIncr(m.Data)
+		if err != nil {
+			a.logger.Warnf("mysql.applier: standby: bad message of %v: %v", m.Subject, err)
+			return
+		}
+		a.standby.window.push(m.Data, nEntries)
+		if gtid != "" {
+			a.currentCoordinates.RetrievedGtidSet = gtid
+		}
+	})
+	if err != nil {
+		return err
+	}
+	a.standby.subs = append(a.standby.subs, sub)
+
+	// the job is done once the active applier completes it
+	sub, err = a.natsConn.Subscribe(fmt.Sprintf("%s_complete", a.subject), func(m *gonats.Msg) {
+		a.onError(TaskStateComplete, nil)
+	})
+	if err != nil {
+		return err
+	}
+	a.standby.subs = append(a.standby.subs, sub)
+
+	go a.watchActive()
+	return nil
+}
+
+// decodeIncr returns the number of entries of a message of the incremental
+// stream and the GTID of the last one.
+func (a *Applier) decodeIncr(data []byte) (int, string, error) {
+	if a.mysqlContext.ApproveHeterogeneous {
+		var binlogEntries binlog.BinlogEntries
+		if err := Decode(data, &binlogEntries); err != nil {
+			return 0, "", err
+		}
+		n := len(binlogEntries.Entries)
+		if n == 0 {
+			return 0, "", nil
+		}
+		return n, binlogEntries.Entries[n-1].Coordinates.GetGtidForThisTx(), nil
+	}
+	var binlogTx []*binlog.BinlogTx
+	if err := Decode(data, &binlogTx); err != nil {
+		return 0, "", err
+	}
+	return len(binlogTx), "", nil
+}
+
+// watchActive keeps the connections of the standby alive and takes over once
+// the heartbeats of the active applier stop.
+func (a *Applier) watchActive() {
+	timeout := time.Duration(a.mysqlContext.StandbyTakeoverSeconds) * time.Second
+	ticker := time.NewTicker(standbyHeartbeatInterval)
+	defer ticker.Stop()
+	lastPing := time.Now()
+	for {
+		select {
+		case now := <-ticker.C:
+			if now.Sub(lastPing) >= pingInterval {
+				lastPing = now
+				if err := a.db.Ping(); err != nil {
+					a.logger.Warnf("mysql.applier: standby: bad connection: %v", err)
+				}
+				for i, conn := range a.dbs {
+					if err := conn.Db.PingContext(context.Background()); err != nil {
+						a.logger.Warnf("mysql.applier: standby: bad connection of worker %v: %v", i, err)
+					}
+				}
+			}
+			if !a.natsConn.IsConnected() || !a.standby.shouldTakeOver(now, timeout) {
+				continue
+			}
+			if err := a.takeOver(); err != nil {
+				a.onError(TaskStateDead, err)
+			}
+			return
+		case <-a.shutdownCh:
+			return
+		}
+	}
+}
+
+// takeOver makes the standby the active applier, applying from the
+// checkpoint of the last heartbeat.
+func (a *Applier) takeOver() error {
+	for _, sub := range a.standby.subs {
+		if err := sub.Unsubscribe(); err != nil {
+			return err
+		}
+	}
+	a.standby.subs = nil
+	a.mysqlContext.Gtid = a.standby.checkpoint()
+	a.logger.Warnf("mysql.applier: no heartbeat of the active applier for %vs, taking over at %v",
+		a.mysqlContext.StandbyTakeoverSeconds, a.mysqlContext.Gtid)
+
+	a.standby.setActive(true)
+	data, err := json.Marshal(&applierHeartbeat{ID: a.standby.id, Gtid: a.mysqlContext.Gtid})
+	if err != nil {
+		return err
+	}
+	if err := a.natsConn.Publish(fmt.Sprintf("%s_applier_takeover", a.subject), data); err != nil {
+		return err
+	}
+	if err := a.serveActive(); err != nil {
+		return err
+	}
+
+	// The entries already applied by the lost applier are skipped with
+	// gtid_executed. The window fits in the empty queues.
+	a.gtidExecuted = nil
+	for _, data := range a.standby.window.drain() {
+		if a.mysqlContext.ApproveHeterogeneous {
+			var binlogEntries binlog.BinlogEntries
+			if err := Decode(data, &binlogEntries); err != nil {
+				return err
+			}
+			for _, binlogEntry := range binlogEntries.Entries {
+				atomic.AddInt64(&a.nPendingEntry, 1)
+				a.applyDataEntryQueue <- binlogEntry
+			}
+		} else {
+			var binlogTx []*binlog.BinlogTx
+			if err := Decode(data, &binlogTx); err != nil {
+				return err
+			}
+			for _, tx := range binlogTx {
+				a.applyBinlogTxQueue <- tx
+			}
+		}
+	}
+
+	a.mysqlContext.Stage = models.StageWaitingForMasterToSendEvent
+	if err := a.initiateStreaming(); err != nil {
+		return err
+	}
+	a.startApplying()
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	gnatsd "github.com/nats-io/gnatsd/server"
+	gonats "github.com/nats-io/go-nats"
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestStandbyWindow(t *testing.T) {
+	w := newStandbyWindow(5)
+	w.push([]byte("a"), 2)
+	w.push([]byte("b"), 2)
+	w.push([]byte("c"), 2)
+	test.S(t).ExpectEquals(w.nEntries, 4)
+	// a message bigger than the window is not kept
+	w.push([]byte("d"), 6)
+
+	msgs := w.drain()
+	test.S(t).ExpectEquals(len(msgs), 0)
+	w.push([]byte("e"), 1)
+	w.push([]byte("f"), 3)
+	msgs = w.drain()
+	test.S(t).ExpectEquals(len(msgs), 2)
+	test.S(t).ExpectEquals(string(msgs[0]), "e")
+	test.S(t).ExpectEquals(w.nEntries, 0)
+}
+
+func TestStandbyState_shouldTakeOver(t *testing.T) {
+	s := &standbyState{}
+	now := time.Now()
+	// not in the full copy
+	s.heard(now, "")
+	test.S(t).ExpectFalse(s.shouldTakeOver(now.Add(5*time.Second), 5*time.Second))
+
+	s.heard(now, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+	test.S(t).ExpectFalse(s.shouldTakeOver(now.Add(4*time.Second), 5*time.Second))
+	test.S(t).ExpectTrue(s.shouldTakeOver(now.Add(5*time.Second), 5*time.Second))
+	// a heartbeat without a checkpoint keeps the last one
+	s.heard(now.Add(5*time.Second), "")
+	test.S(t).ExpectEquals(s.checkpoint(), "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+	s.setActive(true)
+	test.S(t).ExpectFalse(s.shouldTakeOver(now.Add(10*time.Second), 5*time.Second))
+}
+
+func TestApplier_standbyRoles(t *testing.T) {
+	ns := gnatsd.New(&gnatsd.Options{Host: "127.0.0.1", Port: gnatsd.RANDOM_PORT, NoLog: true, NoSigs: true})
+	go ns.Start()
+	defer ns.Shutdown()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server not started")
+	}
+	natsAddr := ns.Addr().String()
+
+	subject := models.GenerateUUID()
+	logger := log.New(ioutil.Discard, log.ErrorLevel)
+	newApplier := func(asStandby bool) *Applier {
+		a, err := NewApplier(subject, "", &config.MySQLDriverConfig{NatsAddr: natsAddr,
+			ConnectionConfig: &umconf.ConnectionConfig{}}, logger)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNil(a.EnableStandby(asStandby, ""))
+		test.S(t).ExpectNil(a.initStandbyNatsConn())
+		return a
+	}
+
+	nc, err := gonats.Connect(fmt.Sprintf("nats://%s", natsAddr))
+	test.S(t).ExpectNil(err)
+	defer nc.Close()
+	restarts, err := nc.SubscribeSync(fmt.Sprintf("%s_restart", subject))
+	test.S(t).ExpectNil(err)
+
+	// the first Dest task is active, the next one answered by it is not
+	const gtid = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	active := newApplier(false)
+	active.mysqlContext.Gtid = gtid
+	defer active.Shutdown()
+	isActive, err := active.startStandby()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(isActive)
+
+	standby := newApplier(false)
+	defer standby.Shutdown()
+	isActive, err = standby.startStandby()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(isActive)
+	test.S(t).ExpectEquals(standby.mysqlContext.Stage, models.StageStandby)
+
+	// the heartbeats carry the checkpoint to the standby
+	time.Sleep(2 * standbyHeartbeatInterval)
+	test.S(t).ExpectEquals(standby.standby.checkpoint(), gtid)
+	var id config.DriverCtx
+	test.S(t).ExpectNil(json.Unmarshal([]byte(standby.ID()), &id))
+	test.S(t).ExpectEquals(id.DriverConfig.Gtid, "")
+
+	// the active applier steps down when another one takes over, without
+	// restarting the extractor
+	data, err := json.Marshal(&applierHeartbeat{ID: "other", Gtid: gtid})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNil(nc.Publish(fmt.Sprintf("%s_applier_takeover", subject), data))
+	select {
+	case r := <-active.WaitCh():
+		test.S(t).ExpectEquals(r.ExitCode, TaskStateRestart)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the active applier did not step down")
+	}
+	_, err = restarts.NextMsg(100 * time.Millisecond)
+	test.S(t).ExpectEquals(err, gonats.ErrTimeout)
+
+	// the standby completes with the job
+	test.S(t).ExpectNil(nc.Publish(fmt.Sprintf("%s_complete", subject), nil))
+	select {
+	case r := <-standby.WaitCh():
+		test.S(t).ExpectEquals(r.ExitCode, TaskStateComplete)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the standby did not complete")
+	}
+}
@@ -0,0 +1,365 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// cutoverPollInterval is the pause between the verifications of a
+	// cutover waiting for the destination to be in sync
+	cutoverPollInterval = 5 * time.Second
+
+	// stepMaxListedTables bounds the tables named in a step error
+	stepMaxListedTables = 10
+)
+
+// Step runs a step task of a job between the MySQL instances of its Src and
+// Dest tasks, and exits once done.
+type Step struct {
+	taskType string
+	cfg      *config.StepConfig
+	src      *config.MySQLDriverConfig
+	dst      *config.MySQLDriverConfig
+	logger   *log.Logger
+
+	waitCh       chan *models.WaitResult
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+	// cancelled on shutdown, stopping the queries running
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	resultLock sync.Mutex
+	stage      string
+	result     string
+	checksums  []*models.TableChecksum
+}
+
+// NewStep returns the step of type taskType, src and dst being the configs
+// of the Src and Dest tasks of the job. Run starts it.
+func NewStep(taskType string, cfg *config.StepConfig, src, dst *config.MySQLDriverConfig,
+	logger *log.Logger) (*Step, error) {
+	if !models.IsStepTask(taskType) {
+		return nil, fmt.Errorf("%v is not a step task", taskType)
+	}
+	if src == nil || src.ConnectionConfig == nil || dst == nil || dst.ConnectionConfig == nil {
+		return nil, fmt.Errorf("step %v needs the MySQL Src and Dest tasks of the job", taskType)
+	}
+	cfg = cfg.SetDefault()
+	if err := cfg.Validate(taskType); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Step{
+		taskType:   taskType,
+		cfg:        cfg,
+		src:        src,
+		dst:        dst,
+		logger:     logger,
+		waitCh:     make(chan *models.WaitResult, 1),
+		shutdownCh: make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}, nil
+}
+
+// Run runs the step and reports its outcome on WaitCh, once. A failed
+// verification is retried by restarting the task, a failed cutover or schema
+// migration is left to the user. A checksum completes with the tables which
+// differ in its result.
+func (s *Step) Run() {
+	var err error
+	var state int
+	switch s.taskType {
+	case models.TaskTypeVerify:
+		state, err = s.verify()
+	case models.TaskTypeCutover:
+		state, err = s.cutover()
+	case models.TaskTypeSchemaMigration:
+		state, err = s.migrateSchema()
+	case models.TaskTypeChecksum:
+		state, err = s.checksum()
+	}
+
+	select {
+	case <-s.shutdownCh:
+		s.waitCh <- models.NewWaitResult(TaskStateDead, fmt.Errorf("step %v stopped", s.taskType))
+		return
+	default:
+	}
+	if err != nil {
+		s.logger.Errorf("mysql.step: %v failed: %v", s.taskType, err)
+		s.waitCh <- models.NewWaitResult(state, err)
+		return
+	}
+	s.logger.Printf("mysql.step: %v done: %v", s.taskType, s.Result())
+	s.waitCh <- models.NewWaitResult(TaskStateComplete, nil)
+}
+
+func (s *Step) setStage(stage string) {
+	s.resultLock.Lock()
+	s.stage = stage
+	s.resultLock.Unlock()
+}
+
+func (s *Step) setResult(format string, args ...interface{}) {
+	s.resultLock.Lock()
+	s.result = fmt.Sprintf(format, args...)
+	s.resultLock.Unlock()
+}
+
+func (s *Step) openDBs() (src, dst *gosql.DB, err error) {
+	if src, err = sql.CreateDB(s.src.ConnectionConfig.GetDBUri()); err != nil {
+		return nil, nil, fmt.Errorf("source: %v", err)
+	}
+	if dst, err = sql.CreateDB(s.dst.ConnectionConfig.GetDBUri()); err != nil {
+		src.Close()
+		return nil, nil, fmt.Errorf("target: %v", err)
+	}
+	return src, dst, nil
+}
+
+// compare verifies the tables replicated by the job, and returns the tables
+// which differ.
+func (s *Step) compare(src, dst *gosql.DB) (tables int, differ []string, err error) {
+	results, err := VerifyTables(s.ctx, src, dst, s.src.ReplicateDoDb, s.src.ReplicateIgnoreDb,
+		&VerifyOptions{MaxPk: s.cfg.MaxPk, SumColumn: s.cfg.SumColumn})
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, r := range results {
+		if !r.Match {
+			differ = append(differ, fmt.Sprintf("%s.%s", r.TableSchema, r.TableName))
+		}
+	}
+	return len(results), differ, nil
+}
+
+func differError(tables int, differ []string) error {
+	listed := differ
+	if len(listed) > stepMaxListedTables {
+		listed = listed[:stepMaxListedTables]
+	}
+	return fmt.Errorf("%d of %d tables differ: %s", len(differ), tables, strings.Join(listed, ", "))
+}
+
+func (s *Step) verify() (int, error) {
+	s.setStage("verifying")
+	src, dst, err := s.openDBs()
+	if err != nil {
+		return TaskStateRestart, err
+	}
+	defer src.Close()
+	defer dst.Close()
+
+	tables, differ, err := s.compare(src, dst)
+	if err != nil {
+		return TaskStateRestart, err
+	}
+	if len(differ) > 0 {
+		return TaskStateRestart, differError(tables, differ)
+	}
+	s.setResult("%d tables match", tables)
+	return TaskStateComplete, nil
+}
+
+func (s *Step) cutover() (state int, err error) {
+	src, dst, err := s.openDBs()
+	if err != nil {
+		return TaskStateRestart, err
+	}
+	defer src.Close()
+	defer dst.Close()
+
+	if s.cfg.ReadOnlySource {
+		s.setStage("setting the source read_only")
+		var wasReadOnly bool
+		ctx, cancel := context.WithTimeout(s.ctx, s.src.QueryTimeout())
+		defer cancel()
+		if err := src.QueryRowContext(ctx, `select @@global.read_only`).Scan(&wasReadOnly); err != nil {
+			return TaskStateRestart, fmt.Errorf("source: %v", err)
+		}
+		if !wasReadOnly {
+			if _, err := src.Exec(`set global read_only = 1`); err != nil {
+				return TaskStateDead, fmt.Errorf("failed to set the source read_only: %v", err)
+			}
+			defer func() {
+				if err == nil {
+					return
+				}
+				// give the writes back to the source
+				if _, rerr := src.Exec(`set global read_only = 0`); rerr != nil {
+					s.logger.Errorf("mysql.step: failed to unset read_only on the source: %v", rerr)
+				}
+			}()
+		}
+	}
+
+	s.setStage("waiting for the target to be in sync")
+	start := time.Now()
+	timeout := time.After(time.Duration(s.cfg.TimeoutSeconds) * time.Second)
+	for {
+		tables, differ, err := s.compare(src, dst)
+		if err != nil {
+			return TaskStateDead, err
+		}
+		if len(differ) == 0 {
+			s.setResult("target in sync after %v, %d tables match", time.Since(start), tables)
+			break
+		}
+		select {
+		case <-s.shutdownCh:
+			return TaskStateDead, fmt.Errorf("cutover stopped")
+		case <-timeout:
+			return TaskStateDead, fmt.Errorf("target not in sync after %ds: %v",
+				s.cfg.TimeoutSeconds, differError(tables, differ))
+		case <-time.After(cutoverPollInterval):
+		}
+	}
+
+	if s.cfg.WritableDest {
+		s.setStage("unsetting read_only on the target")
+		if _, err := dst.Exec(`set global read_only = 0`); err != nil {
+			return TaskStateDead, fmt.Errorf("failed to unset read_only on the target: %v", err)
+		}
+	}
+	return TaskStateComplete, nil
+}
+
+func (s *Step) migrateSchema() (int, error) {
+	dst, err := sql.CreateDB(s.dst.ConnectionConfig.GetDBUri())
+	if err != nil {
+		return TaskStateRestart, fmt.Errorf("target: %v", err)
+	}
+	defer dst.Close()
+
+	// a single connection, for the statements to share their session
+	conn, err := dst.Conn(context.Background())
+	if err != nil {
+		return TaskStateRestart, fmt.Errorf("target: %v", err)
+	}
+	defer conn.Close()
+
+	for i, stmt := range s.cfg.Statements {
+		select {
+		case <-s.shutdownCh:
+			return TaskStateDead, fmt.Errorf("schema migration stopped after %d statements", i)
+		default:
+		}
+		s.setStage(fmt.Sprintf("running statement %d of %d", i+1, len(s.cfg.Statements)))
+		if _, err := conn.ExecContext(context.Background(), stmt); err != nil {
+			// the statements before were run, which DDL cannot roll back
+			return TaskStateDead, fmt.Errorf("statement %d failed, %d were run: %v", i, i, err)
+		}
+	}
+	s.setResult("%d statements run", len(s.cfg.Statements))
+	return TaskStateComplete, nil
+}
+
+func (s *Step) checksum() (int, error) {
+	s.setStage("listing the tables")
+	src, dst, err := s.openDBs()
+	if err != nil {
+		return TaskStateRestart, err
+	}
+	defer src.Close()
+	defer dst.Close()
+
+	tables, err := listVerifyTables(s.ctx, src, s.src.ReplicateDoDb, s.src.ReplicateIgnoreDb)
+	if err != nil {
+		return TaskStateRestart, fmt.Errorf("source: %v", err)
+	}
+	var checksums []*models.TableChecksum
+	var differ []string
+	for i, tb := range tables {
+		s.setStage(fmt.Sprintf("computing the checksums of %s.%s, table %d of %d",
+			tb.TableSchema, tb.TableName, i+1, len(tables)))
+		r := ChecksumTable(s.ctx, src, dst, tb.TableSchema, tb.TableName, s.cfg.ChunkSize)
+		if s.ctx.Err() != nil {
+			return TaskStateDead, fmt.Errorf("checksum stopped after %d tables", i)
+		}
+		if r.Error != "" {
+			s.logger.Warnf("mysql.step: failed to compute the checksums of %s.%s: %v",
+				tb.TableSchema, tb.TableName, r.Error)
+		}
+		checksums = append(checksums, r)
+		if !r.Match {
+			differ = append(differ, fmt.Sprintf("%s.%s", tb.TableSchema, tb.TableName))
+		}
+	}
+
+	s.resultLock.Lock()
+	s.checksums = checksums
+	s.resultLock.Unlock()
+	if len(differ) > 0 {
+		s.setResult("%v", differError(len(tables), differ))
+	} else {
+		s.setResult("%d tables match", len(tables))
+	}
+	return TaskStateComplete, nil
+}
+
+// Result describes the outcome of the step once done.
+func (s *Step) Result() string {
+	s.resultLock.Lock()
+	defer s.resultLock.Unlock()
+	return s.result
+}
+
+// Checksums are the tables compared by a Checksum step once done.
+func (s *Step) Checksums() []*models.TableChecksum {
+	s.resultLock.Lock()
+	defer s.resultLock.Unlock()
+	return s.checksums
+}
+
+func (s *Step) ID() string {
+	// a step has no checkpoint to restore
+	data, err := json.Marshal(config.DriverCtx{DriverConfig: &config.MySQLDriverConfig{}})
+	if err != nil {
+		s.logger.Errorf("mysql.step: Failed to marshal ID to JSON: %s", err)
+	}
+	return string(data)
+}
+
+func (s *Step) WaitCh() chan *models.WaitResult {
+	return s.waitCh
+}
+
+func (s *Step) Shutdown() error {
+	s.shutdownOnce.Do(func() {
+		close(s.shutdownCh)
+		s.cancel()
+	})
+	return nil
+}
+
+func (s *Step) Stats() (*models.TaskStatistics, error) {
+	s.resultLock.Lock()
+	defer s.resultLock.Unlock()
+	stage := s.stage
+	if s.result != "" {
+		stage = s.result
+	}
+	return &models.TaskStatistics{
+		Stage:     stage,
+		Timestamp: time.Now().UTC().UnixNano(),
+	}, nil
+}
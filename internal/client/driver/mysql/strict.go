@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+)
+
+// checkStrictTables fails the tables of the job with a column of a type not
+// replicated, or a foreign key referencing a table out of the job, whose
+// rows the target would miss.
+func (e *Extractor) checkStrictTables() error {
+	selected := make(map[string]bool)
+	for _, db := range e.replicateDoDb {
+		for _, tb := range db.Tables {
+			selected[fmt.Sprintf("%s.%s", db.TableSchema, tb.TableName)] = true
+		}
+	}
+	for _, db := range e.replicateDoDb {
+		for _, tb := range db.Tables {
+			ctx, cancel := e.queryContext()
+			info, err := readAssessTableInfo(ctx, e.db, db.TableSchema, tb.TableName, false)
+			cancel()
+			if err != nil {
+				return err
+			}
+			if err := checkStrictTable(info, selected); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkStrictTable checks a table. selected has the "schema.table" of the job.
+func checkStrictTable(info *assessTableInfo, selected map[string]bool) error {
+	for _, c := range info.columns {
+		if unsupportedTypes[c.dataType] {
+			return fmt.Errorf("strict: column %v of %v.%v is of type %v, which is not supported",
+				c.name, info.schema, info.table, c.columnType)
+		}
+	}
+	for _, fk := range info.foreignKeys {
+		if !selected[fmt.Sprintf("%s.%s", fk.refSchema, fk.refTable)] {
+			return fmt.Errorf("strict: foreign key %v of %v.%v references %v.%v, which is filtered out of the job. "+
+				"add it to ReplicateDoDb, or unset Strict to replicate the table without it",
+				fk.name, info.schema, info.table, fk.refSchema, fk.refTable)
+		}
+	}
+	return nil
+}
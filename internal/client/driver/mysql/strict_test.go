@@ -0,0 +1,33 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckStrictTable(t *testing.T) {
+	info := &assessTableInfo{
+		schema:      "db1",
+		table:       "t1",
+		columns:     []*assessColumn{{name: "id", dataType: "int"}},
+		foreignKeys: []*assessForeignKey{{name: "fk1", refSchema: "db1", refTable: "parent"}},
+	}
+	if err := checkStrictTable(info, map[string]bool{"db1.t1": true, "db1.parent": true}); err != nil {
+		t.Fatal(err)
+	}
+	err := checkStrictTable(info, map[string]bool{"db1.t1": true})
+	if err == nil || !strings.Contains(err.Error(), "references db1.parent") {
+		t.Fatalf("got %v", err)
+	}
+	info.columns = append(info.columns, &assessColumn{name: "g", dataType: "point", columnType: "point"})
+	err = checkStrictTable(info, map[string]bool{"db1.t1": true, "db1.parent": true})
+	if err == nil || !strings.Contains(err.Error(), "column g of db1.t1") {
+		t.Fatalf("got %v", err)
+	}
+}
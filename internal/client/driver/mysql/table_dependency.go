@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+)
+
+// tableDependency tracks the last transaction writing each table, with
+// ParallelDependency "table". Like the sequence numbers, it starts over with
+// each binlog file.
+type tableDependency struct {
+	// the sequence number of the last transaction writing a table, by
+	// "schema.table"
+	lastWriter map[string]int64
+	// the sequence number of the last transaction which every later one
+	// waits for, e.g. a DDL
+	barrier int64
+}
+
+func newTableDependency() *tableDependency {
+	return &tableDependency{lastWriter: make(map[string]int64)}
+}
+
+// lastCommitted returns the sequence number of the last transaction entry
+// depends on: the last one before it writing one of its tables. A
+// transaction with a DDL, or with no row, depends on all the ones before it,
+// and all the ones after it depend on it. entry becomes the last writer of
+// its tables.
+func (d *tableDependency) lastCommitted(entry *binlog.BinlogEntry) int64 {
+	seq := entry.Coordinates.SeqenceNumber
+	lastCommitted := d.barrier
+	barrier := len(entry.Events) == 0
+	for i := range entry.Events {
+		event := &entry.Events[i]
+		if event.DML == binlog.NotDML {
+			barrier = true
+			continue
+		}
+		table := fmt.Sprintf("%s.%s", event.DatabaseName, event.TableName)
+		if writer := d.lastWriter[table]; writer > lastCommitted && writer < seq {
+			lastCommitted = writer
+		}
+		d.lastWriter[table] = seq
+	}
+	if barrier {
+		d.barrier = seq
+		return seq - 1
+	}
+	return lastCommitted
+}
+
+// reset forgets the transactions of the previous binlog file
+func (d *tableDependency) reset() {
+	d.lastWriter = make(map[string]int64)
+	d.barrier = 0
+}
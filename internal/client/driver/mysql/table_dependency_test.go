@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+)
+
+func TestTableDependency_lastCommitted(t *testing.T) {
+	entry := func(seq int64, tables ...string) *binlog.BinlogEntry {
+		e := &binlog.BinlogEntry{Coordinates: base.BinlogCoordinateTx{
+			LastCommitted: seq - 1, SeqenceNumber: seq}}
+		for _, table := range tables {
+			if table == "" {
+				e.Events = append(e.Events, binlog.NewQueryEvent("db1", "alter table a add c int", binlog.NotDML))
+			} else {
+				e.Events = append(e.Events, binlog.NewDataEvent("db1", table, binlog.InsertDML, 1))
+			}
+		}
+		return e
+	}
+
+	d := newTableDependency()
+	test.S(t).ExpectEquals(d.lastCommitted(entry(1, "a")), int64(0))
+	test.S(t).ExpectEquals(d.lastCommitted(entry(2, "b")), int64(0))
+	// waits for the last writer of a
+	test.S(t).ExpectEquals(d.lastCommitted(entry(3, "a")), int64(1))
+	test.S(t).ExpectEquals(d.lastCommitted(entry(4, "b", "a")), int64(3))
+	test.S(t).ExpectEquals(d.lastCommitted(entry(5, "c")), int64(0))
+
+	// a DDL waits for all, and all wait for it
+	test.S(t).ExpectEquals(d.lastCommitted(entry(6, "")), int64(5))
+	test.S(t).ExpectEquals(d.lastCommitted(entry(7, "d")), int64(6))
+	test.S(t).ExpectEquals(d.lastCommitted(entry(8, "a")), int64(6))
+	test.S(t).ExpectEquals(d.lastCommitted(entry(9, "d")), int64(7))
+
+	d.reset()
+	test.S(t).ExpectEquals(d.lastCommitted(entry(1, "d")), int64(0))
+}
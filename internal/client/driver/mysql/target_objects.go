@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/g"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// FindTargetObjects lists the triggers and the enforced CHECK constraints of
+// the target tables selected by doDb and ignoreDb. With disableTriggers, the
+// triggers testing @dtle_disable_triggers are marked Disabled.
+func FindTargetObjects(ctx context.Context, db *gosql.DB, doDb, ignoreDb []*config.DataSource,
+	disableTriggers bool) (triggers, checks []*models.TargetObject, err error) {
+	filter, err := config.NewTableFilter(doDb, ignoreDb)
+	if err != nil {
+		return nil, nil, err
+	}
+	systemSchemas := fmt.Sprintf("'mysql', 'sys', 'information_schema', 'performance_schema', '%s'", g.DtleSchemaName)
+
+	query := fmt.Sprintf(`select EVENT_OBJECT_SCHEMA, EVENT_OBJECT_TABLE, TRIGGER_NAME, ACTION_TIMING,
+		EVENT_MANIPULATION, ACTION_STATEMENT from information_schema.TRIGGERS
+		where EVENT_OBJECT_SCHEMA not in (%s) order by 1, 2, 3`, systemSchemas)
+	err = sql.QueryRowsMap(ctx, db, query, func(m sql.RowMap) error {
+		schema, table := m.GetString("EVENT_OBJECT_SCHEMA"), m.GetString("EVENT_OBJECT_TABLE")
+		if !filter.MatchTable(schema, table) {
+			return nil
+		}
+		triggers = append(triggers, &models.TargetObject{
+			TableSchema: schema,
+			TableName:   table,
+			Name:        m.GetString("TRIGGER_NAME"),
+			Definition:  fmt.Sprintf("%s %s", m.GetString("ACTION_TIMING"), m.GetString("EVENT_MANIPULATION")),
+			Disabled:    disableTriggers && triggerTestsDisabling(m.GetString("ACTION_STATEMENT")),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// CHECK constraints are enforced since 8.0.16, which added the tables
+	query = fmt.Sprintf(`select tc.TABLE_SCHEMA, tc.TABLE_NAME, cc.CONSTRAINT_NAME, cc.CHECK_CLAUSE
+		from information_schema.TABLE_CONSTRAINTS tc join information_schema.CHECK_CONSTRAINTS cc
+		on cc.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA and cc.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+		where tc.CONSTRAINT_TYPE = 'CHECK' and tc.ENFORCED = 'YES' and tc.TABLE_SCHEMA not in (%s)
+		order by 1, 2, 3`, systemSchemas)
+	err = sql.QueryRowsMap(ctx, db, query, func(m sql.RowMap) error {
+		schema, table := m.GetString("TABLE_SCHEMA"), m.GetString("TABLE_NAME")
+		if !filter.MatchTable(schema, table) {
+			return nil
+		}
+		checks = append(checks, &models.TargetObject{
+			TableSchema: schema,
+			TableName:   table,
+			Name:        m.GetString("CONSTRAINT_NAME"),
+			Definition:  m.GetString("CHECK_CLAUSE"),
+		})
+		return nil
+	})
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok &&
+		(mysqlErr.Number == sql.ErrUnknownTable || mysqlErr.Number == sql.ErrBadField) {
+		// an older MySQL, or MariaDB, without the ENFORCED column
+		err = nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return triggers, checks, nil
+}
+
+// triggerTestsDisabling returns if the body of a trigger reads the variable
+// set by DisableTriggers
+func triggerTestsDisabling(statement string) bool {
+	return strings.Contains(strings.ToLower(statement), "@"+g.DisableTriggersVariable)
+}
+
+// TargetObjectsValidation reports the triggers and CHECK constraints acting
+// on the rows applied by a job.
+func TargetObjectsValidation(triggers, checks []*models.TargetObject) models.TargetObjectsValidate {
+	v := models.TargetObjectsValidate{
+		Triggers:         triggers,
+		CheckConstraints: checks,
+	}
+	var firing []string
+	for _, t := range triggers {
+		if !t.Disabled {
+			firing = append(firing, fmt.Sprintf("trigger %s.%s (%s on %s)", t.TableSchema, t.Name, t.Definition, t.TableName))
+		}
+	}
+	for _, c := range checks {
+		firing = append(firing, fmt.Sprintf("CHECK constraint %s on %s.%s", c.Name, c.TableSchema, c.TableName))
+	}
+	if len(firing) == 0 {
+		v.Success = true
+		return v
+	}
+	v.Error = fmt.Sprintf("these act on the applied rows: %s. a trigger may apply again what the source did; "+
+		"set DisableTriggers and test @%s in it, or drop it", strings.Join(firing, ", "), g.DisableTriggersVariable)
+	return v
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestTargetObjectsValidation(t *testing.T) {
+	test.S(t).ExpectTrue(triggerTestsDisabling("BEGIN IF @DTLE_DISABLE_TRIGGERS IS NULL THEN INSERT INTO log VALUES (NEW.id); END IF; END"))
+	test.S(t).ExpectFalse(triggerTestsDisabling("INSERT INTO log VALUES (NEW.id)"))
+
+	test.S(t).ExpectTrue(TargetObjectsValidation(nil, nil).Success)
+
+	disabled := &models.TargetObject{TableSchema: "db1", TableName: "t1", Name: "tr1",
+		Definition: "AFTER INSERT", Disabled: true}
+	v := TargetObjectsValidation([]*models.TargetObject{disabled}, nil)
+	test.S(t).ExpectTrue(v.Success)
+	test.S(t).ExpectEquals(len(v.Triggers), 1)
+
+	firing := &models.TargetObject{TableSchema: "db1", TableName: "t1", Name: "tr2", Definition: "BEFORE UPDATE"}
+	check := &models.TargetObject{TableSchema: "db1", TableName: "t2", Name: "t2_chk_1", Definition: "(`a` > 0)"}
+	v = TargetObjectsValidation([]*models.TargetObject{disabled, firing}, []*models.TargetObject{check})
+	test.S(t).ExpectFalse(v.Success)
+	test.S(t).ExpectFalse(strings.Contains(v.Error, "tr1"))
+	test.S(t).ExpectTrue(strings.Contains(v.Error, "trigger db1.tr2 (BEFORE UPDATE on t1)"))
+	test.S(t).ExpectTrue(strings.Contains(v.Error, "CHECK constraint t2_chk_1 on db1.t2"))
+}
@@ -0,0 +1,240 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// how often the throttler checks the replicas and the status of the
+	// target
+	throttleCheckInterval = time.Second
+
+	// historyListLength is the key of MaxLoad of the InnoDB history list
+	// length, which is not a status variable
+	historyListLength = "HistoryListLength"
+)
+
+// throttler pauses the writes of the applier while the target is loaded:
+// a replica of the target lags over MaxLagMillisecondsThrottleThreshold, or
+// a status of the target reaches its threshold in MaxLoad.
+type throttler struct {
+	logger   *log.Entry
+	maxLag   time.Duration
+	maxLoad  umconf.LoadMap
+	replicas []string
+
+	target     *gosql.DB
+	replicaDBs []*gosql.DB
+	// called when the throttler throttles, with why, or releases, with ""
+	onChange func(reason string)
+
+	lock   sync.Mutex
+	reason string
+	// closed when the throttler releases
+	released chan struct{}
+}
+
+// newThrottler checks the throttling configs. It returns nil if none is set.
+func newThrottler(cfg *config.MySQLDriverConfig, logger *log.Entry) (*throttler, error) {
+	maxLoad, err := umconf.ParseLoadMap(cfg.MaxLoad)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaxLoad: %v", err)
+	}
+	if cfg.MaxLagMillisecondsThrottleThreshold < 0 {
+		return nil, fmt.Errorf("MaxLagMillisecondsThrottleThreshold must not be negative")
+	}
+	if (len(cfg.ThrottleReplicas) > 0) != (cfg.MaxLagMillisecondsThrottleThreshold > 0) {
+		return nil, fmt.Errorf("ThrottleReplicas and MaxLagMillisecondsThrottleThreshold must be set together")
+	}
+	for _, replica := range cfg.ThrottleReplicas {
+		if _, _, err := splitReplicaAddr(replica); err != nil {
+			return nil, fmt.Errorf("invalid ThrottleReplicas: %v", err)
+		}
+	}
+	if len(maxLoad) == 0 && len(cfg.ThrottleReplicas) == 0 {
+		return nil, nil
+	}
+	return &throttler{
+		logger:   logger,
+		maxLag:   time.Duration(cfg.MaxLagMillisecondsThrottleThreshold) * time.Millisecond,
+		maxLoad:  maxLoad,
+		replicas: cfg.ThrottleReplicas,
+	}, nil
+}
+
+func splitReplicaAddr(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 {
+		return "", 0, fmt.Errorf("bad port in %q", addr)
+	}
+	return host, port, nil
+}
+
+// open connects to the replicas of the target, with the user of the target.
+func (t *throttler) open(target *gosql.DB, conn *umconf.ConnectionConfig) error {
+	t.target = target
+	for _, replica := range t.replicas {
+		replicaConn := *conn
+		replicaConn.Host, replicaConn.Port, _ = splitReplicaAddr(replica)
+		db, err := sql.CreateDB(replicaConn.GetDBUri())
+		if err != nil {
+			t.close()
+			return fmt.Errorf("replica %v: %v", replica, err)
+		}
+		t.replicaDBs = append(t.replicaDBs, db)
+	}
+	return nil
+}
+
+func (t *throttler) close() {
+	for _, db := range t.replicaDBs {
+		db.Close()
+	}
+	t.replicaDBs = nil
+}
+
+// run checks the target every throttleCheckInterval, until shutdownCh is
+// closed.
+func (t *throttler) run(shutdownCh chan struct{}) {
+	defer t.close()
+	ticker := time.NewTicker(throttleCheckInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), throttleCheckInterval)
+		t.set(t.check(ctx))
+		cancel()
+		select {
+		case <-shutdownCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check returns why the applier should be throttled, or "". A replica or a
+// status which cannot be read throttles it.
+func (t *throttler) check(ctx context.Context) string {
+	for i, db := range t.replicaDBs {
+		lag, err := base.GetReplicationLag(ctx, db)
+		if err != nil {
+			return fmt.Sprintf("cannot read the lag of replica %s: %v", t.replicas[i], err)
+		}
+		if lag > t.maxLag {
+			return fmt.Sprintf("replica %s lags %v", t.replicas[i], lag)
+		}
+	}
+
+	names := make([]string, 0, len(t.maxLoad))
+	for name := range t.maxLoad {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := readTargetLoad(ctx, t.target, name)
+		if err != nil {
+			return fmt.Sprintf("cannot read %s of the target: %v", name, err)
+		}
+		if value >= t.maxLoad[name] {
+			return fmt.Sprintf("%s=%d of the target reaches %d", name, value, t.maxLoad[name])
+		}
+	}
+	return ""
+}
+
+// readTargetLoad reads a global status variable, or the history list length
+func readTargetLoad(ctx context.Context, db *gosql.DB, name string) (int64, error) {
+	var value int64
+	var err error
+	if name == historyListLength {
+		err = db.QueryRowContext(ctx, `select COUNT from information_schema.INNODB_METRICS
+			where NAME = 'trx_rseg_history_len'`).Scan(&value)
+	} else {
+		var variable string
+		err = db.QueryRowContext(ctx, "show global status like ?", name).Scan(&variable, &value)
+	}
+	if err == gosql.ErrNoRows {
+		return 0, fmt.Errorf("no such status")
+	}
+	return value, err
+}
+
+func (t *throttler) set(reason string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if reason == t.reason {
+		return
+	}
+	switch {
+	case t.reason == "":
+		t.logger.Warnf("mysql.applier: throttled: %v", reason)
+		t.released = make(chan struct{})
+	case reason == "":
+		t.logger.Printf("mysql.applier: throttling released")
+		close(t.released)
+		t.released = nil
+	}
+	t.reason = reason
+	if t.onChange != nil {
+		t.onChange(reason)
+	}
+}
+
+// onThrottle shows the throttling in the stage of the applier
+func (a *Applier) onThrottle(reason string) {
+	if reason == "" {
+		if a.mysqlContext.Stage == models.StageThrottled {
+			a.mysqlContext.Stage = a.stageBeforeThrottle
+		}
+	} else if a.mysqlContext.Stage != models.StageThrottled {
+		a.stageBeforeThrottle = a.mysqlContext.Stage
+		a.mysqlContext.Stage = models.StageThrottled
+	}
+}
+
+// Reason tells why the applier is throttled, "" if it is not.
+func (t *throttler) Reason() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.reason
+}
+
+// wait returns once the applier is not throttled. It returns false if
+// shutdownCh is closed first.
+func (t *throttler) wait(shutdownCh chan struct{}) bool {
+	t.lock.Lock()
+	released := t.released
+	t.lock.Unlock()
+	if released == nil {
+		return true
+	}
+	select {
+	case <-released:
+		return true
+	case <-shutdownCh:
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestNewThrottler(t *testing.T) {
+	logger := log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel))
+
+	th, err := newThrottler(&config.MySQLDriverConfig{}, logger)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(th == nil)
+
+	th, err = newThrottler(&config.MySQLDriverConfig{MaxLoad: "Threads_running=50"}, logger)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(th.maxLoad["Threads_running"], int64(50))
+
+	th, err = newThrottler(&config.MySQLDriverConfig{
+		ThrottleReplicas:                    []string{"10.0.0.2:3306"},
+		MaxLagMillisecondsThrottleThreshold: 1500,
+	}, logger)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(th.maxLag, 1500*time.Millisecond)
+
+	for _, cfg := range []*config.MySQLDriverConfig{
+		{MaxLoad: "Threads_running"},
+		{ThrottleReplicas: []string{"10.0.0.2:3306"}},
+		{MaxLagMillisecondsThrottleThreshold: 1500},
+		{ThrottleReplicas: []string{"10.0.0.2"}, MaxLagMillisecondsThrottleThreshold: 1500},
+	} {
+		_, err := newThrottler(cfg, logger)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestThrottlerWait(t *testing.T) {
+	th := &throttler{logger: log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel))}
+	var reasons []string
+	th.onChange = func(reason string) { reasons = append(reasons, reason) }
+	shutdownCh := make(chan struct{})
+	test.S(t).ExpectTrue(th.wait(shutdownCh))
+
+	th.set("replica lags")
+	th.set("replica lags")
+	test.S(t).ExpectEquals(th.Reason(), "replica lags")
+	waited := make(chan bool)
+	go func() { waited <- th.wait(shutdownCh) }()
+	select {
+	case <-waited:
+		t.Fatalf("wait returned while throttled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	th.set("")
+	test.S(t).ExpectTrue(<-waited)
+	test.S(t).ExpectEquals(len(reasons), 2)
+
+	th.set("replica lags")
+	close(shutdownCh)
+	test.S(t).ExpectFalse(th.wait(shutdownCh))
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+)
+
+// Error codes of TiDB which are safe to retry.
+// See https://docs.pingcap.com/tidb/stable/error-codes
+const (
+	errTiDBWriteConflict      = 8005
+	errTiDBKVRetryable        = 8022
+	errTiDBInfoSchemaChanged  = 8028
+	errTiDBPDServerTimeout    = 9001
+	errTiKVServerTimeout      = 9002
+	errTiKVServerBusy         = 9003
+	errTiDBResolveLockTimeout = 9004
+	errTiDBRegionUnavailable  = 9005
+	errTiKVWriteConflict      = 9007
+	errTiKVStaleCommand       = 9010
+)
+
+const (
+	tidbRetryInterval = 500 * time.Millisecond
+	// rows committed at a time by a statement of the full copy
+	tidbDMLBatchSize = 20000
+)
+
+// tidbBatchDMLQuery lets TiDB commit a large statement in batches, in autocommit mode.
+var tidbBatchDMLQuery = fmt.Sprintf("SET @@session.tidb_batch_insert = 1, @@session.tidb_dml_batch_size = %d",
+	tidbDMLBatchSize)
+
+func isTiDBRetryableError(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+	switch mysqlErr.Number {
+	case errTiDBWriteConflict, errTiDBKVRetryable, errTiDBInfoSchemaChanged,
+		errTiDBPDServerTimeout, errTiKVServerTimeout, errTiKVServerBusy,
+		errTiDBResolveLockTimeout, errTiDBRegionUnavailable, errTiKVWriteConflict,
+		errTiKVStaleCommand, sql.ErrLockDeadlock, sql.ErrLockWaitTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// isUnsupportedVariableError tells if a SET failed on a variable or a value
+// unknown to the target.
+func isUnsupportedVariableError(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+	return mysqlErr.Number == sql.ErrUnknownSystemVariable || mysqlErr.Number == sql.ErrWrongValueForVar
+}
+
+// retryTiDB calls f until it succeeds, fails with an error which is not
+// retryable, or has been retried MaxRetries times.
+func (a *Applier) retryTiDB(f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt > int(a.mysqlContext.MaxRetries) || !isTiDBRetryableError(err) {
+			return err
+		}
+		a.logger.Warnf("mysql.applier: retrying (%v/%v) on TiDB error: %v", attempt, a.mysqlContext.MaxRetries, err)
+		select {
+		case <-time.After(time.Duration(attempt) * tidbRetryInterval):
+		case <-a.shutdownCh:
+			return err
+		}
+	}
+}
+
+// execSetStatement executes a SET statement of the source one variable at a
+// time, skipping the variables TiDB rejects.
+func (a *Applier) execSetStatement(exec func(query string) error, query string) error {
+	for _, assignment := range splitSetStatement(query) {
+		if err := exec(assignment); err != nil {
+			if !isUnsupportedVariableError(err) {
+				return err
+			}
+			a.logger.Warnf("mysql.applier: skip unsupported variable [%s]: %v", assignment, err)
+		}
+	}
+	return nil
+}
+
+// splitSetStatement splits "SET a = 1, b = 'x,y'" into "SET a = 1" and "SET b = 'x,y'".
+func splitSetStatement(query string) []string {
+	trimmed := strings.TrimSpace(query)
+	if len(trimmed) < 4 || !strings.EqualFold(trimmed[:4], "SET ") {
+		return []string{query}
+	}
+
+	var statements []string
+	var quote byte
+	start := 4
+	for i := start; i <= len(trimmed); i++ {
+		if i < len(trimmed) {
+			c := trimmed[i]
+			if quote != 0 {
+				if c == '\\' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == '\'' || c == '"' || c == '`' {
+				quote = c
+				continue
+			}
+			if c != ',' {
+				continue
+			}
+		}
+		if assignment := strings.TrimSpace(trimmed[start:i]); assignment != "" {
+			statements = append(statements, "SET "+assignment)
+		}
+		start = i + 1
+	}
+	return statements
+}
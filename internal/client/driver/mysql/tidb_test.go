@@ -0,0 +1,40 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestSplitSetStatement(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SET a = 1", []string{"SET a = 1"}},
+		{"SET a = 1, b = 'x,y', c = utf8", []string{"SET a = 1", "SET b = 'x,y'", "SET c = utf8"}},
+		{`set @@session.sql_mode = 'A,\'B', d = 2`, []string{`SET @@session.sql_mode = 'A,\'B'`, "SET d = 2"}},
+		{"USE db1", []string{"USE db1"}},
+	}
+	for _, tt := range tests {
+		if got := splitSetStatement(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitSetStatement(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIsTiDBRetryableError(t *testing.T) {
+	test.S(t).ExpectTrue(isTiDBRetryableError(&mysql.MySQLError{Number: errTiDBRegionUnavailable}))
+	test.S(t).ExpectTrue(isTiDBRetryableError(&mysql.MySQLError{Number: errTiKVWriteConflict}))
+	test.S(t).ExpectFalse(isTiDBRetryableError(&mysql.MySQLError{Number: 1062}))
+	test.S(t).ExpectFalse(isTiDBRetryableError(errors.New("9005")))
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	gonats "github.com/nats-io/go-nats"
+)
+
+// transitKeyIDLen is the length of the id of the key heading a sealed
+// message, telling the receiver which key of the job sealed it.
+const transitKeyIDLen = 4
+
+type transitKey struct {
+	id   uint32
+	aead cipher.AEAD
+}
+
+// transitCipher encrypts the change events of a job with EncryptTransit, with
+// AES-GCM. A sealed message is the id of its key, a random nonce and the
+// encrypted message, authenticated along with its subject so that it cannot
+// be replayed on another subject or for another job.
+//
+// A nil transitCipher leaves the messages in clear.
+type transitCipher struct {
+	// the first key seals, all of them open
+	keys []transitKey
+}
+
+// newTransitCipher returns a cipher with the keys of the job, or nil if it
+// has none.
+func newTransitCipher(keys [][]byte) (*transitCipher, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	c := &transitCipher{}
+	for _, k := range keys {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(k)
+		c.keys = append(c.keys, transitKey{id: binary.BigEndian.Uint32(sum[:]), aead: aead})
+	}
+	return c, nil
+}
+
+// overhead is how much longer a sealed message is than the message
+func (c *transitCipher) overhead() int {
+	aead := c.keys[0].aead
+	return transitKeyIDLen + aead.NonceSize() + aead.Overhead()
+}
+
+func (c *transitCipher) seal(subject string, data []byte) ([]byte, error) {
+	if c == nil {
+		return data, nil
+	}
+	key := c.keys[0]
+	nonceSize := key.aead.NonceSize()
+	out := make([]byte, transitKeyIDLen+nonceSize, transitKeyIDLen+nonceSize+len(data)+key.aead.Overhead())
+	binary.BigEndian.PutUint32(out, key.id)
+	nonce := out[transitKeyIDLen:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return key.aead.Seal(out, nonce, data, []byte(subject)), nil
+}
+
+func (c *transitCipher) open(subject string, data []byte) ([]byte, error) {
+	if c == nil {
+		return data, nil
+	}
+	if len(data) < transitKeyIDLen {
+		return nil, fmt.Errorf("encrypted message of %v is too short", subject)
+	}
+	id := binary.BigEndian.Uint32(data)
+	for _, key := range c.keys {
+		if key.id != id {
+			continue
+		}
+		nonceSize := key.aead.NonceSize()
+		if len(data) < transitKeyIDLen+nonceSize {
+			return nil, fmt.Errorf("encrypted message of %v is too short", subject)
+		}
+		nonce := data[transitKeyIDLen : transitKeyIDLen+nonceSize]
+		plain, err := key.aead.Open(nil, nonce, data[transitKeyIDLen+nonceSize:], []byte(subject))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt a message of %v: %v", subject, err)
+		}
+		return plain, nil
+	}
+	return nil, fmt.Errorf("a message of %v is encrypted with an unknown key %08x. "+
+		"is it sent by another job, or was the transit keyring rotated?", subject, id)
+}
+
+// openMsg decrypts a message of the extractor in place, and reassembles a
+// message sent in chunks. It returns false for a chunk of a message not
+// complete yet, which is not to be handled. Receiving it is the activity of
+// the NATS connection of the applier.
+func (a *Applier) openMsg(m *gonats.Msg) (bool, error) {
+	a.natsHealth.Success()
+	data, err := a.transit.open(m.Subject, m.Data)
+	if err != nil {
+		return false, err
+	}
+	m.Data = data
+	return a.assembleMsg(m)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestTransitCipher(t *testing.T) {
+	keyring := [][]byte{bytes.Repeat([]byte{1}, config.TransitKeyLength), bytes.Repeat([]byte{2}, config.TransitKeyLength)}
+	c, err := newTransitCipher(config.DeriveTransitKeys(keyring, "job1"))
+	test.S(t).ExpectNil(err)
+
+	msg := []byte("binlog entries")
+	sealed, err := c.seal("job1_incr_hete", msg)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(bytes.Contains(sealed, msg))
+	test.S(t).ExpectEquals(len(sealed), len(msg)+c.overhead())
+
+	opened, err := c.open("job1_incr_hete", sealed)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(bytes.Equal(opened, msg))
+
+	// replayed on another subject
+	_, err = c.open("job1_full", sealed)
+	test.S(t).ExpectNotNil(err)
+
+	// after a rotation of the keyring, the former key still opens
+	rotated, err := newTransitCipher(config.DeriveTransitKeys([][]byte{keyring[1], keyring[0]}, "job1"))
+	test.S(t).ExpectNil(err)
+	opened, err = rotated.open("job1_incr_hete", sealed)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(bytes.Equal(opened, msg))
+
+	// another job has other keys
+	other, err := newTransitCipher(config.DeriveTransitKeys(keyring, "job2"))
+	test.S(t).ExpectNil(err)
+	_, err = other.open("job1_incr_hete", sealed)
+	test.S(t).ExpectNotNil(err)
+
+	// a job without EncryptTransit
+	var none *transitCipher
+	sealed, err = none.seal("job1_incr_hete", msg)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(bytes.Equal(sealed, msg))
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+// taskLogLevel is the level of the logs of a task. The task logs through a
+// logger of its own, writing where the logger of the agent does.
+type taskLogLevel struct {
+	agent  *log.Logger
+	logger *log.Logger
+}
+
+func newTaskLogLevel(agent *log.Logger, level string) *taskLogLevel {
+	logger := log.New(agent.Out, agent.Level)
+	logger.Formatter = agent.Formatter
+	logger.Hooks = agent.Hooks
+	l := &taskLogLevel{agent: agent, logger: logger}
+	l.set(level)
+	return l
+}
+
+// set changes the level of the logs, to the one of the agent if level is
+// empty.
+func (l *taskLogLevel) set(level string) {
+	if level == "" {
+		l.logger.Level = l.agent.Level
+	} else {
+		l.logger.Level = log.ParseLevel(level)
+	}
+}
+
+// decodeTunables returns the config of a task, with the defaults of the unset
+// keys.
+func decodeTunables(cfg map[string]interface{}) (*config.MySQLDriverConfig, error) {
+	var next config.MySQLDriverConfig
+	if err := mapstructure.WeakDecode(cfg, &next); err != nil {
+		return nil, err
+	}
+	return next.SetDefault(), nil
+}
+
+// Tune applies RowsPerSecond, ChunkSize, GroupMaxSize, GroupTimeout and
+// LogLevel of cfg, the new config of the task. A new ChunkSize is used by the
+// tables not copied yet.
+func (e *Extractor) Tune(cfg map[string]interface{}) error {
+	next, err := decodeTunables(cfg)
+	if err != nil {
+		return err
+	}
+	e.rowLimiter.setRate(next.RowsPerSecond)
+	e.tuneLock.Lock()
+	e.mysqlContext.RowsPerSecond = next.RowsPerSecond
+	e.mysqlContext.ChunkSize = next.ChunkSize
+	e.mysqlContext.GroupMaxSize = next.GroupMaxSize
+	e.mysqlContext.GroupTimeout = next.GroupTimeout
+	e.tuneLock.Unlock()
+	e.logLevel.set(next.LogLevel)
+
+	e.logger.Printf("mysql.extractor: tuned. RowsPerSecond: %v, ChunkSize: %v, GroupMaxSize: %v, GroupTimeout: %vms",
+		next.RowsPerSecond, next.ChunkSize, next.GroupMaxSize, next.GroupTimeout)
+	return nil
+}
+
+func (e *Extractor) chunkSize() int64 {
+	e.tuneLock.RLock()
+	defer e.tuneLock.RUnlock()
+	return e.mysqlContext.ChunkSize
+}
+
+// groupLimits returns when the binlog entries read are sent: once they are
+// GroupMaxSize bytes, or after GroupTimeout.
+func (e *Extractor) groupLimits() (int, time.Duration) {
+	e.tuneLock.RLock()
+	defer e.tuneLock.RUnlock()
+	return e.mysqlContext.GroupMaxSize, time.Duration(e.mysqlContext.GroupTimeout) * time.Millisecond
+}
+
+// Tune applies TxGroupMaxTxs, TxGroupTimeoutMs, ParallelWorkers and LogLevel
+// of cfg, the new config of the task. ParallelWorkers may be lowered, or
+// raised up to the workers started with the task: more are started when the
+// task restarts.
+func (a *Applier) Tune(cfg map[string]interface{}) error {
+	next, err := decodeTunables(cfg)
+	if err != nil {
+		return err
+	}
+	a.tuneLock.Lock()
+	if next.ParallelWorkers > a.mysqlContext.ParallelWorkers {
+		a.logger.Warnf("mysql.applier: ParallelWorkers %d: the task started %d workers, more need a restart",
+			next.ParallelWorkers, a.mysqlContext.ParallelWorkers)
+		next.ParallelWorkers = a.mysqlContext.ParallelWorkers
+	}
+	a.mysqlContext.TxGroupMaxTxs = next.TxGroupMaxTxs
+	a.mysqlContext.TxGroupTimeoutMs = next.TxGroupTimeoutMs
+	if a.activeWorkers != next.ParallelWorkers {
+		a.activeWorkers = next.ParallelWorkers
+		close(a.workersTuned)
+		a.workersTuned = make(chan struct{})
+	}
+	a.tuneLock.Unlock()
+	a.logLevel.set(next.LogLevel)
+
+	a.logger.Printf("mysql.applier: tuned. TxGroupMaxTxs: %v, TxGroupTimeoutMs: %v, ParallelWorkers: %v",
+		next.TxGroupMaxTxs, next.TxGroupTimeoutMs, next.ParallelWorkers)
+	return nil
+}
+
+// workers returns the workers applying transactions.
+func (a *Applier) workers() int {
+	a.tuneLock.RLock()
+	defer a.tuneLock.RUnlock()
+	return a.activeWorkers
+}
+
+// workerActive tells if the MtsWorker of workerIndex applies transactions,
+// and returns a channel closed once the workers are tuned.
+func (a *Applier) workerActive(workerIndex int) (bool, <-chan struct{}) {
+	a.tuneLock.RLock()
+	defer a.tuneLock.RUnlock()
+	return workerIndex < a.activeWorkers, a.workersTuned
+}
+
+func (a *Applier) txGroupMaxTxs() int {
+	a.tuneLock.RLock()
+	defer a.tuneLock.RUnlock()
+	return a.mysqlContext.TxGroupMaxTxs
+}
+
+func (a *Applier) txGroupTimeout() time.Duration {
+	a.tuneLock.RLock()
+	defer a.tuneLock.RUnlock()
+	return time.Duration(a.mysqlContext.TxGroupTimeoutMs) * time.Millisecond
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+)
+
+// txGroup is consecutive binlog entries of the source applied in one target
+// transaction, with TxBoundary "regroup". The entries are applied in order, so
+// an entry may depend on the ones before it in the group.
+type txGroup struct {
+	entries []*binlog.BinlogEntry
+	// the group is applied once the tx up to lastCommitted are committed:
+	// the dependencies of its entries outside of the group
+	lastCommitted int64
+}
+
+func (g *txGroup) add(binlogEntry *binlog.BinlogEntry) {
+	lastCommitted := binlogEntry.Coordinates.LastCommitted
+	if len(g.entries) > 0 {
+		// tx from the first of the group on are in the group, or skipped
+		if first := g.entries[0].Coordinates.SeqenceNumber; lastCommitted >= first {
+			lastCommitted = first - 1
+		}
+	}
+	if lastCommitted > g.lastCommitted {
+		g.lastCommitted = lastCommitted
+	}
+	g.entries = append(g.entries, binlogEntry)
+}
+
+// enqueueTxGroup hands a group to the MTS workers once its dependencies are
+// committed. It returns false on shutdown.
+func (a *Applier) enqueueTxGroup(g *txGroup) bool {
+	if !a.mtsManager.WaitForLastCommitted(g.lastCommitted) {
+		return false
+	}
+	a.logger.Debugf("mysql.applier: a group MTS enqueue. gno: %v, n: %v",
+		g.entries[0].Coordinates.GNO, len(g.entries))
+	a.applyBinlogMtsTxQueue <- g.entries
+	return true
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+)
+
+func TestTxGroup_add(t *testing.T) {
+	entry := func(lastCommitted, seq int64) *binlog.BinlogEntry {
+		return &binlog.BinlogEntry{Coordinates: base.BinlogCoordinateTx{
+			LastCommitted: lastCommitted, SeqenceNumber: seq}}
+	}
+
+	g := &txGroup{}
+	g.add(entry(3, 5))
+	test.S(t).ExpectEquals(g.lastCommitted, int64(3))
+	// depends on 5, in the group
+	g.add(entry(5, 6))
+	test.S(t).ExpectEquals(g.lastCommitted, int64(4))
+	// committed together with 6 on the source
+	g.add(entry(5, 7))
+	test.S(t).ExpectEquals(g.lastCommitted, int64(4))
+	test.S(t).ExpectEquals(len(g.entries), 3)
+
+	g = &txGroup{}
+	g.add(entry(0, 1))
+	g.add(entry(0, 2))
+	test.S(t).ExpectEquals(g.lastCommitted, int64(0))
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// VerifyOptions selects the optional aggregates of a quick verification.
+type VerifyOptions struct {
+	// compare MAX() of the first primary key column
+	MaxPk bool
+	// compare SUM() of this column, on tables having it
+	SumColumn string
+}
+
+// VerifyTables compares the tables selected by doDb/ignoreDb on source and target.
+// It is a fast sanity check, not a replacement of a checksum.
+func VerifyTables(ctx context.Context, src, dst *gosql.DB, doDb, ignoreDb []*config.DataSource,
+	opts *VerifyOptions) ([]*models.TableVerifyResult, error) {
+
+	tables, err := listVerifyTables(ctx, src, doDb, ignoreDb)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*models.TableVerifyResult
+	for _, tb := range tables {
+		results = append(results, VerifyTable(ctx, src, dst, tb.TableSchema, tb.TableName, opts))
+	}
+	return results, nil
+}
+
+// VerifyTable compares one table. Errors are reported in the result.
+func VerifyTable(ctx context.Context, src, dst *gosql.DB, schema, table string, opts *VerifyOptions) *models.TableVerifyResult {
+	r := &models.TableVerifyResult{
+		TableSchema: schema,
+		TableName:   table,
+	}
+	var err error
+	if opts.MaxPk {
+		if r.PkColumn, err = getFirstPkColumn(ctx, src, schema, table); err != nil {
+			r.Error = err.Error()
+			return r
+		}
+	}
+	if opts.SumColumn != "" {
+		ok, err := hasColumn(ctx, src, schema, table, opts.SumColumn)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+		if ok {
+			r.SumColumn = opts.SumColumn
+		}
+	}
+
+	r.SourceRows, r.SourceMaxPk, r.SourceSum, err = aggregateTable(ctx, src, schema, table, r.PkColumn, r.SumColumn)
+	if err != nil {
+		r.Error = fmt.Sprintf("source: %v", err)
+		return r
+	}
+	r.TargetRows, r.TargetMaxPk, r.TargetSum, err = aggregateTable(ctx, dst, schema, table, r.PkColumn, r.SumColumn)
+	if err != nil {
+		r.Error = fmt.Sprintf("target: %v", err)
+		return r
+	}
+	r.Match = r.SourceRows == r.TargetRows && r.SourceMaxPk == r.TargetMaxPk && r.SourceSum == r.TargetSum
+	return r
+}
+
+// ListJobTables lists the tables selected by doDb/ignoreDb, with their columns.
+func ListJobTables(ctx context.Context, db *gosql.DB, doDb, ignoreDb []*config.DataSource) ([]*config.Table, error) {
+	tables, err := listVerifyTables(ctx, db, doDb, ignoreDb)
+	if err != nil {
+		return nil, err
+	}
+	for _, tb := range tables {
+		columns, err := base.GetTableColumns(ctx, db, tb.TableSchema, tb.TableName)
+		if err != nil {
+			return nil, err
+		}
+		if err := base.ApplyColumnTypes(ctx, db, tb.TableSchema, tb.TableName, columns); err != nil {
+			return nil, err
+		}
+		tb.OriginalTableColumns = columns
+	}
+	return tables, nil
+}
+
+func listVerifyTables(ctx context.Context, db *gosql.DB, doDb, ignoreDb []*config.DataSource) (tables []*config.Table, err error) {
+	filter, err := config.NewTableFilter(doDb, ignoreDb)
+	if err != nil {
+		return nil, err
+	}
+	dbs, err := showFilteredDatabases(ctx, db, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, schema := range dbs {
+		tbs, err := sql.ShowTables(ctx, db, sql.EscapeName(schema), true)
+		if err != nil {
+			return nil, err
+		}
+		for _, tb := range tbs {
+			tb.TableSchema = schema
+			if strings.ToLower(tb.TableType) == "view" || !filter.MatchTable(schema, tb.TableName) {
+				continue
+			}
+			tables = append(tables, tb)
+		}
+	}
+	return tables, nil
+}
+
+func getFirstPkColumn(ctx context.Context, db *gosql.DB, schema, table string) (column string, err error) {
+	query := `select COLUMN_NAME from information_schema.KEY_COLUMN_USAGE
+		where TABLE_SCHEMA = ? and TABLE_NAME = ? and CONSTRAINT_NAME = 'PRIMARY'
+		order by ORDINAL_POSITION limit 1`
+	err = db.QueryRowContext(ctx, query, schema, table).Scan(&column)
+	if err == gosql.ErrNoRows {
+		return "", nil
+	}
+	return column, err
+}
+
+func hasColumn(ctx context.Context, db *gosql.DB, schema, table, column string) (bool, error) {
+	query := `select count(*) from information_schema.COLUMNS
+		where TABLE_SCHEMA = ? and TABLE_NAME = ? and COLUMN_NAME = ?`
+	var n int
+	if err := db.QueryRowContext(ctx, query, schema, table, column).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func buildAggregateQuery(schema, table, pkColumn, sumColumn string) string {
+	exprs := []string{"count(*)"}
+	if pkColumn != "" {
+		exprs = append(exprs, fmt.Sprintf("max(%s)", sql.EscapeName(pkColumn)))
+	}
+	if sumColumn != "" {
+		exprs = append(exprs, fmt.Sprintf("sum(%s)", sql.EscapeName(sumColumn)))
+	}
+	return fmt.Sprintf("select %s from %s.%s", strings.Join(exprs, ", "),
+		sql.EscapeName(schema), sql.EscapeName(table))
+}
+
+// rowQuerier is a *gosql.DB, or a *gosql.Conn in a snapshot
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *gosql.Row
+}
+
+func aggregateTable(ctx context.Context, db rowQuerier, schema, table, pkColumn, sumColumn string) (
+	rows int64, maxPk string, sum string, err error) {
+
+	var maxPkValue, sumValue gosql.NullString
+	dest := []interface{}{&rows}
+	if pkColumn != "" {
+		dest = append(dest, &maxPkValue)
+	}
+	if sumColumn != "" {
+		dest = append(dest, &sumValue)
+	}
+	err = db.QueryRowContext(ctx, buildAggregateQuery(schema, table, pkColumn, sumColumn)).Scan(dest...)
+	return rows, maxPkValue.String, sumValue.String, err
+}
+
+// showFilteredDatabases lists the schemas which might have tables selected by
+// the filter. SHOW DATABASES omits the system schemas, which are listed if
+// the filter names them.
+func showFilteredDatabases(ctx context.Context, db *gosql.DB, filter *config.TableFilter) ([]string, error) {
+	dbs, err := sql.ShowDatabases(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool)
+	for _, schema := range dbs {
+		listed[schema] = true
+	}
+	for _, schema := range filter.NamedSchemas() {
+		if !listed[schema] {
+			listed[schema] = true
+			dbs = append(dbs, schema)
+		}
+	}
+
+	var schemas []string
+	for _, schema := range dbs {
+		if filter.MatchTable(schema, "") {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas, nil
+}
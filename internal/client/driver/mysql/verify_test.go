@@ -0,0 +1,20 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestBuildAggregateQuery(t *testing.T) {
+	test.S(t).ExpectEquals(buildAggregateQuery("db1", "tb1", "", ""),
+		"select count(*) from `db1`.`tb1`")
+	test.S(t).ExpectEquals(buildAggregateQuery("db1", "tb1", "id", "amount"),
+		"select count(*), max(`id`), sum(`amount`) from `db1`.`tb1`")
+}
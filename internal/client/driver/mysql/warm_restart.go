@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+)
+
+// WarmRestart applies the ReplicateDoDb, ReplicateIgnoreDb and SqlFilter of
+// cfg, the new config of the task, to the binlog being read, keeping the
+// binlog dump and the connections to the source. The existing rows of the
+// tables added are not copied.
+func (e *Extractor) WarmRestart(cfg map[string]interface{}) error {
+	var next config.MySQLDriverConfig
+	if err := mapstructure.WeakDecode(cfg, &next); err != nil {
+		return err
+	}
+	filter, err := config.NewTableFilter(next.ReplicateDoDb, next.ReplicateIgnoreDb)
+	if err != nil {
+		return err
+	}
+
+	e.binlogReaderLock.Lock()
+	reader := e.binlogReader
+	e.binlogReaderLock.Unlock()
+	if reader == nil {
+		return fmt.Errorf("the task is not reading the binlog yet")
+	}
+
+	var dbs []string
+	err = e.metadata.query("listing the databases", func(ctx context.Context) (err error) {
+		dbs, err = showFilteredDatabases(ctx, e.db, filter)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var tables []*binlog.RescannedTable
+	for _, dbName := range dbs {
+		var tbs []*config.Table
+		err := e.metadata.query("listing the tables", func(ctx context.Context) (err error) {
+			tbs, err = sql.ShowTables(ctx, e.db, dbName, e.mysqlContext.ExpandSyntaxSupport)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, tb := range tbs {
+			if strings.ToLower(tb.TableType) == "view" || !reader.MatchTableWith(filter, dbName, tb.TableName) {
+				continue
+			}
+			tb.TableSchema = dbName
+			if named := filter.FindTable(dbName, tb.TableName); named != nil {
+				tb.Where = named.Where
+			}
+			if err := e.inspector.ValidateOriginalTable(dbName, tb.TableName, tb); err != nil {
+				e.logger.Warnf("mysql.extractor: warm restart: %v", err)
+				continue
+			}
+			t := &binlog.RescannedTable{Table: tb}
+			if !reader.HasTable(dbName, tb.TableName) {
+				var stmts []string
+				err := e.metadata.query("reading the create table", func(ctx context.Context) (err error) {
+					stmts, err = base.ShowCreateTable(ctx, e.db, dbName, tb.TableName, false, false)
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				t.CreateTable = stmts[0]
+			}
+			tables = append(tables, t)
+		}
+	}
+
+	if err := reader.Refilter(filter, next.SqlFilter, tables); err != nil {
+		return err
+	}
+	e.tableFilter = filter
+	e.mysqlContext.ReplicateDoDb = next.ReplicateDoDb
+	e.mysqlContext.ReplicateIgnoreDb = next.ReplicateIgnoreDb
+	e.mysqlContext.SqlFilter = next.SqlFilter
+	e.logger.Printf("mysql.extractor: warm restart: %d source tables match the new filters", len(tables))
+	return nil
+}
+
+// WarmRestart accepts the filters of a warm restart of the job. The events
+// are filtered by the extractor, the applier has nothing to change.
+func (a *Applier) WarmRestart(cfg map[string]interface{}) error {
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// watchBuffer keeps the latest changes captured by a watch-only extractor,
+// for the clients polling them. The oldest events are dropped once it is full.
+type watchBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []*models.ChangeEvent
+	size   int
+	// index of the last event added
+	lastIndex uint64
+	// column names by "schema.table"
+	columns map[string][]string
+	closed  bool
+}
+
+func newWatchBuffer(size int) *watchBuffer {
+	b := &watchBuffer{
+		size:    size,
+		columns: make(map[string][]string),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// add decodes the events of the binlog entries.
+func (b *watchBuffer) add(entries []*binlog.BinlogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, entry := range entries {
+		gtid := entry.Coordinates.GetGtidForThisTx()
+		for i := range entry.Events {
+			event := &entry.Events[i]
+			key := fmt.Sprintf("%s.%s", event.DatabaseName, event.TableName)
+			if event.Table != nil && event.Table.OriginalTableColumns != nil {
+				b.columns[key] = event.Table.OriginalTableColumns.Names()
+			}
+
+			b.lastIndex++
+			ce := &models.ChangeEvent{
+				Index:     b.lastIndex,
+				Gtid:      gtid,
+				Timestamp: entry.Coordinates.EventTimestamp,
+				Schema:    event.DatabaseName,
+				Table:     event.TableName,
+				DML:       string(event.DML),
+			}
+			if event.DML == binlog.NotDML {
+				ce.Schema = event.CurrentSchema
+				ce.Query = event.Query
+			} else {
+				ce.Columns = b.columns[key]
+				if event.WhereColumnValues != nil {
+					ce.Before = watchValues(event.WhereColumnValues.GetAbstractValues())
+				}
+				if event.NewColumnValues != nil {
+					ce.After = watchValues(event.NewColumnValues.GetAbstractValues())
+				}
+			}
+			b.events = append(b.events, ce)
+		}
+	}
+	if n := len(b.events) - b.size; n > 0 {
+		b.events = append([]*models.ChangeEvent(nil), b.events[n:]...)
+	}
+	b.cond.Broadcast()
+}
+
+// watchValues converts the row values for json. Strings are received as []byte.
+func watchValues(values []*interface{}) []interface{} {
+	r := make([]interface{}, len(values))
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		if bs, ok := (*v).([]byte); ok {
+			r[i] = string(bs)
+		} else {
+			r[i] = *v
+		}
+	}
+	return r
+}
+
+// get returns up to max events after index, waiting up to wait for one.
+// The returned index is the one to pass to get the following events.
+func (b *watchBuffer) get(index uint64, max int, wait time.Duration) ([]*models.ChangeEvent, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.lastIndex <= index && wait > 0 && !b.closed {
+		deadline := time.Now().Add(wait)
+		timer := time.AfterFunc(wait, func() {
+			b.mu.Lock()
+			b.cond.Broadcast()
+			b.mu.Unlock()
+		})
+		defer timer.Stop()
+		for b.lastIndex <= index && !b.closed && time.Now().Before(deadline) {
+			b.cond.Wait()
+		}
+	}
+
+	var events []*models.ChangeEvent
+	for _, ce := range b.events {
+		if ce.Index <= index {
+			continue
+		}
+		if len(events) == max {
+			break
+		}
+		events = append(events, ce)
+	}
+	if len(events) == 0 {
+		return nil, b.lastIndex
+	}
+	return events, events[len(events)-1].Index
+}
+
+func (b *watchBuffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestWatchBuffer(t *testing.T) {
+	b := newWatchBuffer(3)
+
+	id := interface{}(int64(1))
+	name := interface{}([]byte("a"))
+	insert := binlog.NewDataEvent("db1", "tb1", binlog.InsertDML, 2)
+	insert.Table = &config.Table{OriginalTableColumns: umconf.NewColumnList([]umconf.Column{{Name: "id"}, {Name: "name"}})}
+	insert.NewColumnValues = &umconf.ColumnValues{AbstractValues: []*interface{}{&id, &name}}
+	ddl := binlog.NewQueryEvent("db1", "alter table tb1 add c int", binlog.NotDML)
+
+	entry := binlog.NewBinlogEntryAt(base.BinlogCoordinateTx{GNO: 5, EventTimestamp: 100})
+	entry.Events = []binlog.DataEvent{insert, ddl}
+	b.add([]*binlog.BinlogEntry{entry})
+
+	events, index := b.get(0, 10, 0)
+	test.S(t).ExpectEquals(len(events), 2)
+	test.S(t).ExpectEquals(index, uint64(2))
+	test.S(t).ExpectEquals(events[0].DML, "Insert")
+	test.S(t).ExpectEquals(events[0].Columns[1], "name")
+	test.S(t).ExpectEquals(events[0].After[1], "a")
+	test.S(t).ExpectEquals(events[0].Timestamp, uint32(100))
+	test.S(t).ExpectEquals(events[1].Query, "alter table tb1 add c int")
+
+	events, index = b.get(2, 10, 10*time.Millisecond)
+	test.S(t).ExpectEquals(len(events), 0)
+	test.S(t).ExpectEquals(index, uint64(2))
+
+	// the oldest events are dropped
+	b.add([]*binlog.BinlogEntry{entry})
+	events, index = b.get(0, 2, 0)
+	test.S(t).ExpectEquals(len(events), 2)
+	test.S(t).ExpectEquals(events[0].Index, uint64(2))
+	test.S(t).ExpectEquals(index, uint64(3))
+
+	done := make(chan int)
+	go func() {
+		events, _ := b.get(4, 10, time.Minute)
+		done <- len(events)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b.add([]*binlog.BinlogEntry{entry})
+	test.S(t).ExpectEquals(<-done, 2)
+}
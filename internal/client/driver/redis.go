@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/actiontech/dtle/internal/client/driver/redis"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+type RedisDriver struct {
+	DriverContext
+}
+
+func (rd *RedisDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle, error) {
+	var driverConfig redis.RedisConfig
+	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+		return nil, err
+	}
+
+	switch task.Type {
+	case models.TaskTypeSrc:
+		return nil, fmt.Errorf("Redis can only be used on 'Dest'")
+	case models.TaskTypeDest:
+		runner := redis.NewRedisRunner(ctx.Subject, &driverConfig, rd.logger)
+		go runner.Run()
+		return runner, nil
+	default:
+		return nil, fmt.Errorf("unknown processor type : %+v", task.Type)
+	}
+}
+
+func (rd *RedisDriver) Validate(task *models.Task) (*models.TaskValidateResponse, error) {
+	reply := &models.TaskValidateResponse{}
+
+	var driverConfig redis.RedisConfig
+	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+		return reply, err
+	}
+	return reply, driverConfig.Validate()
+}
+
+func NewRedisDriver(ctx *DriverContext) Driver {
+	return &RedisDriver{DriverContext: *ctx}
+}
@@ -0,0 +1,497 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package redis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	gonats "github.com/nats-io/go-nats"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+
+	mysqlDriver "github.com/actiontech/dtle/internal/client/driver/mysql"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	TaskStateComplete int = iota
+	TaskStateRestart
+	TaskStateDead
+)
+
+const (
+	// keys per DEL/UNLINK command
+	maxKeysPerCommand = 512
+	// attempts of a command, reconnecting in between
+	maxAttempts  = 3
+	redisTimeout = 10 * time.Second
+)
+
+// RedisConfig is the configuration of a 'Redis' Dest task.
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	// Unlink uses UNLINK (Redis 4.0+) instead of DEL, freeing the memory in the background
+	Unlink bool
+	Tables []*RedisTable
+
+	NatsAddr string
+	Gtid     string
+}
+
+// RedisTable maps the rows of a table to the cache keys to invalidate.
+// A key template refers to columns with braces, e.g. "user:{id}".
+type RedisTable struct {
+	TableSchema  string
+	TableName    string
+	KeyTemplates []string
+
+	templates []keyTemplate
+}
+
+// Validate checks the configuration and parses the key templates.
+func (c *RedisConfig) Validate() error {
+	if c.Addr == "" {
+		return fmt.Errorf("Addr is required for a Redis task")
+	}
+	if len(c.Tables) == 0 {
+		return fmt.Errorf("Tables is required for a Redis task")
+	}
+	for _, t := range c.Tables {
+		if t.TableSchema == "" || t.TableName == "" {
+			return fmt.Errorf("redis: TableSchema and TableName are required")
+		}
+		if len(t.KeyTemplates) == 0 {
+			return fmt.Errorf("redis: no KeyTemplates for %s.%s", t.TableSchema, t.TableName)
+		}
+		t.templates = nil
+		for _, s := range t.KeyTemplates {
+			tpl, err := parseKeyTemplate(s)
+			if err != nil {
+				return err
+			}
+			t.templates = append(t.templates, tpl)
+		}
+	}
+	return nil
+}
+
+// keyTemplate is a key template split into literals and column names.
+// Column names are at the odd indexes.
+type keyTemplate []string
+
+func parseKeyTemplate(s string) (keyTemplate, error) {
+	var tpl keyTemplate
+	rest := s
+	for {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return nil, fmt.Errorf("redis: unbalanced '}' in key template %q", s)
+			}
+			tpl = append(tpl, rest)
+			break
+		}
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			return nil, fmt.Errorf("redis: unbalanced '{' in key template %q", s)
+		}
+		column := rest[i+1 : i+j]
+		if column == "" {
+			return nil, fmt.Errorf("redis: empty column in key template %q", s)
+		}
+		tpl = append(tpl, rest[:i], column)
+		rest = rest[i+j+1:]
+	}
+	if len(tpl) < 3 {
+		return nil, fmt.Errorf("redis: key template %q refers to no column", s)
+	}
+	return tpl, nil
+}
+
+// key builds the key of a row. columns are the names of the row values.
+func (tpl keyTemplate) key(columns []string, values []*interface{}) (string, error) {
+	var buf bytes.Buffer
+	for i, part := range tpl {
+		if i%2 == 0 {
+			buf.WriteString(part)
+			continue
+		}
+		idx := -1
+		for k, name := range columns {
+			if strings.EqualFold(name, part) {
+				idx = k
+				break
+			}
+		}
+		if idx < 0 || idx >= len(values) {
+			return "", fmt.Errorf("redis: unknown column %q in key template", part)
+		}
+		if v := values[idx]; v != nil && *v != nil {
+			if bs, ok := (*v).([]byte); ok {
+				buf.Write(bs)
+			} else {
+				fmt.Fprint(&buf, *v)
+			}
+		}
+	}
+	return buf.String(), nil
+}
+
+// RedisRunner receives the binlog entries and deletes the cache keys of the changed rows.
+type RedisRunner struct {
+	logger   *log.Entry
+	subject  string
+	cfg      *RedisConfig
+	natsConn *gonats.Conn
+	waitCh   chan *models.WaitResult
+	conn     *respConn
+
+	// the messages of the extractor received in chunks
+	msgChunks *mysqlDriver.ChunkAssembler
+
+	// configured tables by "schema.table"
+	tables map[string]*RedisTable
+	// column names by "schema.table", from the table definitions sent by the extractor
+	columns    map[string][]string
+	gtidSet    *gomysql.MysqlGTIDSet
+	nTx        int64
+	nKeys      int64
+	shutdown   bool
+	shutdownCh chan struct{}
+}
+
+func NewRedisRunner(subject string, cfg *RedisConfig, logger *log.Logger) *RedisRunner {
+	entry := log.NewEntry(logger).WithFields(log.Fields{
+		"job": subject,
+	})
+	r := &RedisRunner{
+		subject:    subject,
+		cfg:        cfg,
+		logger:     entry,
+		tables:     make(map[string]*RedisTable),
+		columns:    make(map[string][]string),
+		waitCh:     make(chan *models.WaitResult, 1),
+		shutdownCh: make(chan struct{}),
+		msgChunks:  mysqlDriver.NewChunkAssembler(),
+	}
+	for _, t := range cfg.Tables {
+		r.tables[fmt.Sprintf("%s.%s", t.TableSchema, t.TableName)] = t
+	}
+	return r
+}
+
+func (r *RedisRunner) ID() string {
+	id := config.DriverCtx{
+		DriverConfig: &config.MySQLDriverConfig{
+			NatsAddr: r.cfg.NatsAddr,
+		},
+	}
+
+	data, err := json.Marshal(id)
+	if err != nil {
+		r.logger.Errorf("redis: Failed to marshal ID to JSON: %s", err)
+	}
+	return string(data)
+}
+
+func (r *RedisRunner) WaitCh() chan *models.WaitResult {
+	return r.waitCh
+}
+
+func (r *RedisRunner) Shutdown() error {
+	if r.shutdown {
+		return nil
+	}
+	if r.natsConn != nil {
+		r.natsConn.Close()
+	}
+	r.shutdown = true
+	close(r.shutdownCh)
+	if r.conn != nil {
+		r.conn.Close()
+	}
+
+	r.logger.Printf("redis: Shutting down")
+	return nil
+}
+
+func (r *RedisRunner) Stats() (*models.TaskStatistics, error) {
+	taskResUsage := &models.TaskStatistics{
+		ExecMasterTxCount: atomic.LoadInt64(&r.nTx),
+		Stage:             models.StageWaitingForMasterToSendEvent,
+		Timestamp:         time.Now().UTC().UnixNano(),
+		TableStats: &models.TableStats{
+			DelCount: atomic.LoadInt64(&r.nKeys),
+		},
+	}
+	taskResUsage.CurrentCoordinates = &models.CurrentCoordinates{}
+	if r.gtidSet != nil {
+		taskResUsage.CurrentCoordinates.ExecutedGtidSet = r.gtidSet.String()
+	}
+	taskResUsage.MsgStat = gonats.Statistics{}
+	if r.natsConn != nil {
+		taskResUsage.MsgStat = r.natsConn.Statistics
+	}
+	return taskResUsage, nil
+}
+
+func (r *RedisRunner) Run() {
+	if err := r.cfg.Validate(); err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+	gtidSet, err := gomysql.ParseMysqlGTIDSet(r.cfg.Gtid)
+	if err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+	r.gtidSet = gtidSet.(*gomysql.MysqlGTIDSet)
+
+	if r.conn, err = dialResp(r.cfg.Addr, r.cfg.Password, r.cfg.DB, redisTimeout); err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+
+	natsAddr := fmt.Sprintf("nats://%s", r.cfg.NatsAddr)
+	sc, err := gonats.Connect(natsAddr)
+	if err != nil {
+		r.logger.Errorf("redis: Can't connect nats server %v. make sure a nats streaming server is running.%v", natsAddr, err)
+		r.onError(TaskStateDead, err)
+		return
+	}
+	r.logger.Debugf("redis: Connect nats server %v", natsAddr)
+	r.natsConn = sc
+
+	if err := r.initiateStreaming(); err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+}
+
+func (r *RedisRunner) initiateStreaming() error {
+	// there is no cache of the rows existing before the job. Only the table
+	// definitions of the full copy are kept.
+	_, err := r.natsConn.Subscribe(fmt.Sprintf("%s_full", r.subject), func(m *gonats.Msg) {
+		if complete, err := r.msgChunks.Assemble(r.natsConn, m); !complete {
+			if err != nil {
+				r.onError(TaskStateDead, err)
+			}
+			return
+		}
+		dumpData := &mysqlDriver.DumpEntry{}
+		if err := mysqlDriver.Decode(m.Data, dumpData); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		r.setColumns(dumpData.TableSchema, dumpData.TableName, dumpData.Table)
+		if err := r.natsConn.Publish(m.Reply, nil); err != nil {
+			r.onError(TaskStateDead, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.natsConn.Subscribe(fmt.Sprintf("%s_full_complete", r.subject), func(m *gonats.Msg) {
+		if complete, err := r.msgChunks.Assemble(r.natsConn, m); !complete {
+			if err != nil {
+				r.onError(TaskStateDead, err)
+			}
+			return
+		}
+		dumpData := &mysqlDriver.DumpStatResult{}
+		if err := mysqlDriver.Decode(m.Data, dumpData); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		if err := r.gtidSet.Update(dumpData.Gtid); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		if err := r.natsConn.Publish(m.Reply, nil); err != nil {
+			r.onError(TaskStateDead, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.natsConn.Subscribe(fmt.Sprintf("%s_incr_hete", r.subject), func(m *gonats.Msg) {
+		if complete, err := r.msgChunks.Assemble(r.natsConn, m); !complete {
+			if err != nil {
+				r.onError(TaskStateDead, err)
+			}
+			return
+		}
+		var binlogEntries binlog.BinlogEntries
+		if err := mysqlDriver.Decode(m.Data, &binlogEntries); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		for _, binlogEntry := range binlogEntries.Entries {
+			if err := r.invalidate(binlogEntry); err != nil {
+				r.onError(TaskStateRestart, err)
+				return
+			}
+		}
+		if err := r.natsConn.Publish(m.Reply, nil); err != nil {
+			r.onError(TaskStateDead, err)
+		}
+		r.logger.Debugf("redis: incr. ack-recv. nEntries: %v", len(binlogEntries.Entries))
+	})
+	return err
+}
+
+func (r *RedisRunner) setColumns(schema, table string, t *config.Table) {
+	if t != nil && t.OriginalTableColumns != nil {
+		r.columns[fmt.Sprintf("%s.%s", schema, table)] = t.OriginalTableColumns.Names()
+	}
+}
+
+// invalidate deletes the keys of the rows changed by a transaction.
+func (r *RedisRunner) invalidate(entry *binlog.BinlogEntry) error {
+	keys, err := r.keysOf(entry)
+	if err != nil {
+		return err
+	}
+	if err := r.deleteKeys(keys); err != nil {
+		return err
+	}
+	gtid := entry.Coordinates.GetGtidForThisTx()
+	if err := r.gtidSet.Update(gtid); err != nil {
+		return err
+	}
+	atomic.AddInt64(&r.nTx, 1)
+	atomic.AddInt64(&r.nKeys, int64(len(keys)))
+	return nil
+}
+
+// keysOf lists the keys of the old and new values of the changed rows, without duplicates.
+func (r *RedisRunner) keysOf(entry *binlog.BinlogEntry) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	for i := range entry.Events {
+		event := &entry.Events[i]
+		r.setColumns(event.DatabaseName, event.TableName, event.Table)
+		if event.Statement {
+			return nil, binlog.StatementNotApplied(entry, event, "Redis")
+		}
+		if event.DML == binlog.NotDML {
+			continue
+		}
+		ident := fmt.Sprintf("%s.%s", event.DatabaseName, event.TableName)
+		t, ok := r.tables[ident]
+		if !ok {
+			continue
+		}
+		columns, ok := r.columns[ident]
+		if !ok {
+			// the extractor sends the table definitions again after a restart
+			return nil, fmt.Errorf("redis: unknown columns of %s", ident)
+		}
+		for _, values := range []*umconf.ColumnValues{event.WhereColumnValues, event.NewColumnValues} {
+			if values == nil {
+				continue
+			}
+			for _, tpl := range t.templates {
+				key, err := tpl.key(columns, values.GetAbstractValues())
+				if err != nil {
+					return nil, fmt.Errorf("%v of %s", err, ident)
+				}
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (r *RedisRunner) deleteKeys(keys []string) error {
+	cmd := "DEL"
+	if r.cfg.Unlink {
+		cmd = "UNLINK"
+	}
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > maxKeysPerCommand {
+			n = maxKeysPerCommand
+		}
+		args := append([]string{cmd}, keys[:n]...)
+		if err := r.do(args...); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// do runs a command, reconnecting on a connection error.
+func (r *RedisRunner) do(args ...string) (err error) {
+	for i := 0; i < maxAttempts; i++ {
+		if r.conn == nil {
+			if r.conn, err = dialResp(r.cfg.Addr, r.cfg.Password, r.cfg.DB, redisTimeout); err != nil {
+				r.logger.Warningf("redis: connect %v: %v", r.cfg.Addr, err)
+				time.Sleep(time.Second)
+				continue
+			}
+		}
+		_, err = r.conn.do(args...)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(respError); ok {
+			return err
+		}
+		r.logger.Warningf("redis: %v: %v. reconnecting", args[0], err)
+		r.conn.Close()
+		r.conn = nil
+	}
+	return err
+}
+
+func (r *RedisRunner) onError(state int, err error) {
+	if r.shutdown {
+		return
+	}
+	gtid := r.cfg.Gtid
+	if r.gtidSet != nil {
+		gtid = r.gtidSet.String()
+	}
+	switch state {
+	case TaskStateComplete:
+		r.logger.Printf("redis: Done")
+	case TaskStateRestart:
+		r.logger.Errorf("redis: %v", err)
+		if r.natsConn != nil {
+			if err := r.natsConn.Publish(fmt.Sprintf("%s_restart", r.subject), []byte(gtid)); err != nil {
+				r.logger.Errorf("redis: Trigger restart: %v", err)
+			}
+		}
+	default:
+		r.logger.Errorf("redis: %v", err)
+		if r.natsConn != nil {
+			if err := r.natsConn.Publish(fmt.Sprintf("%s_error", r.subject), []byte(gtid)); err != nil {
+				r.logger.Errorf("redis: Trigger shutdown: %v", err)
+			}
+		}
+	}
+
+	r.waitCh <- models.NewWaitResult(state, err)
+	r.Shutdown()
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package redis
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestParseKeyTemplate(t *testing.T) {
+	tpl, err := parseKeyTemplate("user:{tenant}:{id}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tpl, keyTemplate{"user:", "tenant", ":", "id", ""}) {
+		t.Errorf("parseKeyTemplate() = %q", tpl)
+	}
+	for _, s := range []string{"user", "user:{id", "user:id}", "user:{}"} {
+		if _, err := parseKeyTemplate(s); err == nil {
+			t.Errorf("parseKeyTemplate(%q) should fail", s)
+		}
+	}
+}
+
+// fakeRedis replies +OK to every command and sends the commands to the channel.
+func fakeRedis(t *testing.T, commands chan<- []string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		c := newRespConn(conn, time.Second)
+		for {
+			cmd, err := c.readReply()
+			if err != nil {
+				return
+			}
+			var args []string
+			for _, arg := range cmd.([]interface{}) {
+				args = append(args, arg.(string))
+			}
+			commands <- args
+			conn.Write([]byte("+OK\r\n"))
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestRedisRunner_invalidate(t *testing.T) {
+	commands := make(chan []string, 10)
+	cfg := &RedisConfig{
+		Addr:   fakeRedis(t, commands),
+		Unlink: true,
+		Tables: []*RedisTable{{
+			TableSchema:  "db1",
+			TableName:    "user",
+			KeyTemplates: []string{"user:{id}", "user_name:{name}"},
+		}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRedisRunner("job1", cfg, log.New(os.Stderr, log.DebugLevel))
+	r.gtidSet = mustGtidSet(t, "")
+	defer r.Shutdown()
+
+	value := func(v interface{}) *interface{} {
+		return &v
+	}
+	update := binlog.NewDataEvent("db1", "user", binlog.UpdateDML, 2)
+	update.Table = &config.Table{
+		OriginalTableColumns: umconf.NewColumnList([]umconf.Column{{Name: "id"}, {Name: "name"}}),
+	}
+	update.WhereColumnValues = &umconf.ColumnValues{AbstractValues: []*interface{}{value(int64(1)), value([]byte("a"))}}
+	update.NewColumnValues = &umconf.ColumnValues{AbstractValues: []*interface{}{value(int64(1)), value([]byte("b"))}}
+	other := binlog.NewDataEvent("db1", "order", binlog.DeleteDML, 1)
+
+	entry := binlog.NewBinlogEntryAt(base.BinlogCoordinateTx{SID: [16]byte{1}, GNO: 7})
+	entry.Events = []binlog.DataEvent{update, other}
+	if err := r.invalidate(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-commands
+	want := []string{"UNLINK", "user:1", "user_name:a", "user_name:b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("command = %v, want %v", got, want)
+	}
+	if !strings.HasSuffix(r.gtidSet.String(), ":7") {
+		t.Errorf("gtid set = %v", r.gtidSet.String())
+	}
+
+	// the columns are unknown until the extractor sends the table definition
+	r.columns = make(map[string][]string)
+	update.Table = nil
+	entry.Events = []binlog.DataEvent{update}
+	if err := r.invalidate(entry); err == nil {
+		t.Errorf("invalidate() should fail on unknown columns")
+	}
+}
+
+func TestRespConn_readReply(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		w := bufio.NewWriter(server)
+		w.WriteString("*3\r\n:2\r\n$-1\r\n$5\r\nhello\r\n-ERR wrong\r\n")
+		w.Flush()
+	}()
+	c := newRespConn(client, time.Second)
+
+	reply, err := c.readReply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reply, []interface{}{int64(2), nil, "hello"}) {
+		t.Errorf("reply = %#v", reply)
+	}
+	reply, err = c.readReply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != respError("ERR wrong") {
+		t.Errorf("reply = %#v", reply)
+	}
+}
+
+func mustGtidSet(t *testing.T, s string) *gomysql.MysqlGTIDSet {
+	gtidSet, err := gomysql.ParseMysqlGTIDSet(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gtidSet.(*gomysql.MysqlGTIDSet)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// respConn is a minimal client of the Redis protocol (RESP), enough to
+// authenticate, select a database and delete keys.
+type respConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	timeout time.Duration
+}
+
+// respError is an error reply of the server
+type respError string
+
+func (e respError) Error() string {
+	return string(e)
+}
+
+func dialResp(addr, password string, db int, timeout time.Duration) (*respConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := newRespConn(conn, timeout)
+	if password != "" {
+		if _, err := c.do("AUTH", password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(db)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func newRespConn(conn net.Conn, timeout time.Duration) *respConn {
+	return &respConn{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		timeout: timeout,
+	}
+}
+
+// do sends a command and reads its reply: a string, an int64, nil, a
+// []interface{} or a respError.
+func (c *respConn) do(args ...string) (interface{}, error) {
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(respError); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+func (c *respConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed reply %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+func (c *respConn) readReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return respError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply %q", line)
+	}
+}
+
+func (c *respConn) Close() error {
+	return c.conn.Close()
+}
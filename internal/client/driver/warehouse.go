@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/actiontech/dtle/internal/client/driver/warehouse"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+type WarehouseDriver struct {
+	DriverContext
+}
+
+func (wd *WarehouseDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle, error) {
+	var driverConfig warehouse.WarehouseConfig
+	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+		return nil, err
+	}
+
+	switch task.Type {
+	case models.TaskTypeSrc:
+		return nil, fmt.Errorf("Warehouse can only be used on 'Dest'")
+	case models.TaskTypeDest:
+		runner := warehouse.NewWarehouseRunner(ctx.Subject, &driverConfig, wd.logger)
+		go runner.Run()
+		return runner, nil
+	default:
+		return nil, fmt.Errorf("unknown processor type : %+v", task.Type)
+	}
+}
+
+func (wd *WarehouseDriver) Validate(task *models.Task) (*models.TaskValidateResponse, error) {
+	reply := &models.TaskValidateResponse{}
+
+	var driverConfig warehouse.WarehouseConfig
+	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+		return reply, err
+	}
+	return reply, driverConfig.Validate()
+}
+
+func NewWarehouseDriver(ctx *DriverContext) Driver {
+	return &WarehouseDriver{DriverContext: *ctx}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package warehouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+const (
+	opUpsert = "U"
+	opDelete = "D"
+
+	// extra fields of a staged row
+	opField  = "_dtle_op"
+	seqField = "_dtle_seq"
+)
+
+// tableDef is what a merge needs to know about a source table.
+type tableDef struct {
+	schema  string
+	table   string
+	columns []string
+	// the columns a merge matches rows on: the primary key, or else the unique key used by the extractor
+	keys []string
+}
+
+func newTableDef(t *config.Table) (*tableDef, error) {
+	if t.OriginalTableColumns == nil {
+		return nil, fmt.Errorf("warehouse: unknown columns of %s.%s", t.TableSchema, t.TableName)
+	}
+	def := &tableDef{
+		schema:  t.TableSchema,
+		table:   t.TableName,
+		columns: t.OriginalTableColumns.Names(),
+	}
+	for _, c := range t.OriginalTableColumns.ColumnList() {
+		if c.IsPk() {
+			def.keys = append(def.keys, c.Name)
+		}
+	}
+	if len(def.keys) == 0 && t.UseUniqueKey != nil {
+		def.keys = t.UseUniqueKey.Columns.Names()
+	}
+	if len(def.keys) == 0 {
+		return nil, fmt.Errorf("warehouse: %s.%s has no primary or unique key to merge on", t.TableSchema, t.TableName)
+	}
+	return def, nil
+}
+
+// nonKeys are the columns updated by a merge.
+func (def *tableDef) nonKeys() []string {
+	var columns []string
+	for _, c := range def.columns {
+		isKey := false
+		for _, k := range def.keys {
+			if c == k {
+				isKey = true
+				break
+			}
+		}
+		if !isKey {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+// tableBatch is the changes of a table since the last merge. It is staged as
+// newline delimited JSON, one object per change. A merge keeps the last
+// change (highest _dtle_seq) of each key.
+type tableBatch struct {
+	def *tableDef
+	buf bytes.Buffer
+	n   int
+}
+
+// add appends a change of a row. values are in the order of def.columns.
+func (b *tableBatch) add(op string, seq int64, values []*interface{}) error {
+	if len(values) != len(b.def.columns) {
+		return fmt.Errorf("warehouse: %d values for the %d columns of %s.%s",
+			len(values), len(b.def.columns), b.def.schema, b.def.table)
+	}
+	row := make(map[string]interface{}, len(values)+2)
+	for i, v := range values {
+		row[b.def.columns[i]] = jsonValue(v)
+	}
+	row[opField] = op
+	row[seqField] = seq
+	bs, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	b.buf.Write(bs)
+	b.buf.WriteByte('\n')
+	b.n++
+	return nil
+}
+
+// jsonValue converts a row value. Strings and the full copy values are
+// received as []byte, and are staged as strings.
+func jsonValue(v *interface{}) interface{} {
+	if v == nil || *v == nil {
+		return nil
+	}
+	if bs, ok := (*v).([]byte); ok {
+		return string(bs)
+	}
+	return *v
+}
+
+// keyChanged tells if an update changes the key of a row, in which case the
+// row of the old key has to be deleted.
+func (def *tableDef) keyChanged(before, after []*interface{}) bool {
+	for _, k := range def.keys {
+		for i, c := range def.columns {
+			if c != k || i >= len(before) || i >= len(after) {
+				continue
+			}
+			if fmt.Sprint(jsonValue(before[i])) != fmt.Sprint(jsonValue(after[i])) {
+				return true
+			}
+		}
+	}
+	return false
+}
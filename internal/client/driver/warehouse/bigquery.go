@@ -0,0 +1,188 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package warehouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	gcsUploadURL = "https://storage.googleapis.com/upload/storage/v1"
+	bigQueryURL  = "https://bigquery.googleapis.com/bigquery/v2"
+	// suffix of the table a batch is loaded into before the merge
+	stageTableSuffix = "__dtle_stage"
+)
+
+// bigQuery stages the batches to Cloud Storage, loads them into a staging
+// table next to the target table, and merges the staging table, all with the
+// REST APIs.
+type bigQuery struct {
+	cfg       *WarehouseConfig
+	uploadURL string
+	queryURL  string
+	client    *http.Client
+}
+
+func newBigQuery(cfg *WarehouseConfig) *bigQuery {
+	return &bigQuery{
+		cfg:       cfg,
+		uploadURL: gcsUploadURL,
+		queryURL:  bigQueryURL,
+		client:    &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// stage puts the file to gs://GCSBucket/GCSPrefix/name.
+func (q *bigQuery) stage(name string, data []byte) (string, error) {
+	object := strings.TrimPrefix(fmt.Sprintf("%s/%s", strings.Trim(q.cfg.GCSPrefix, "/"), name), "/")
+	u := fmt.Sprintf("%s/b/%s/o?uploadType=media&name=%s", q.uploadURL, url.PathEscape(q.cfg.GCSBucket), url.QueryEscape(object))
+	if err := q.request("POST", u, "application/x-ndjson", data, nil); err != nil {
+		return "", fmt.Errorf("error uploading gs://%v/%v: %v", q.cfg.GCSBucket, object, err)
+	}
+	return fmt.Sprintf("gs://%s/%s", q.cfg.GCSBucket, object), nil
+}
+
+func (q *bigQuery) merge(def *tableDef, location string) error {
+	return q.query(bigQueryMergeScript(q.cfg.BigQueryProject, def, location))
+}
+
+// bigQueryMergeScript loads the staged file into a staging table with the
+// columns of the target table, and merges it. The schema of the source is
+// the dataset.
+func bigQueryMergeScript(project string, def *tableDef, location string) string {
+	quote := func(name string) string {
+		return "`" + strings.Replace(name, "`", "\\`", -1) + "`"
+	}
+	table := quote(fmt.Sprintf("%s.%s.%s", project, def.schema, def.table))
+	stage := quote(fmt.Sprintf("%s.%s.%s%s", project, def.schema, def.table, stageTableSuffix))
+
+	var keys, on []string
+	for _, k := range def.keys {
+		keys = append(keys, quote(k))
+		on = append(on, fmt.Sprintf("t.%s = s.%s", quote(k), quote(k)))
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CREATE TABLE IF NOT EXISTS %s AS SELECT *, '' AS %s, 0 AS %s FROM %s LIMIT 0;\n",
+		stage, opField, seqField, table)
+	fmt.Fprintf(&buf, "LOAD DATA OVERWRITE %s FROM FILES (format = 'JSON', uris = ['%s']);\n", stage, location)
+	fmt.Fprintf(&buf, "MERGE %s t USING (SELECT * FROM %s WHERE TRUE QUALIFY ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s DESC) = 1) s ON %s",
+		table, stage, strings.Join(keys, ", "), seqField, strings.Join(on, " AND "))
+	fmt.Fprintf(&buf, " WHEN MATCHED AND s.%s = '%s' THEN DELETE", opField, opDelete)
+	if nonKeys := def.nonKeys(); len(nonKeys) > 0 {
+		var sets []string
+		for _, c := range nonKeys {
+			sets = append(sets, fmt.Sprintf("%s = s.%s", quote(c), quote(c)))
+		}
+		fmt.Fprintf(&buf, " WHEN MATCHED THEN UPDATE SET %s", strings.Join(sets, ", "))
+	}
+	var columns, values []string
+	for _, c := range def.columns {
+		columns = append(columns, quote(c))
+		values = append(values, "s."+quote(c))
+	}
+	fmt.Fprintf(&buf, " WHEN NOT MATCHED AND s.%s != '%s' THEN INSERT (%s) VALUES (%s);",
+		opField, opDelete, strings.Join(columns, ", "), strings.Join(values, ", "))
+	return buf.String()
+}
+
+func (q *bigQuery) execute(statement string) error {
+	return q.query(statement)
+}
+
+type bigQueryResponse struct {
+	JobComplete  bool `json:"jobComplete"`
+	JobReference struct {
+		JobID    string `json:"jobId"`
+		Location string `json:"location"`
+	} `json:"jobReference"`
+	Errors []bigQueryError `json:"errors"`
+}
+
+type bigQueryError struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// query runs a script and waits for it to finish.
+func (q *bigQuery) query(script string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":        script,
+		"useLegacySql": false,
+		"timeoutMs":    int64(pollInterval / time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+	resp := &bigQueryResponse{}
+	err = q.request("POST", fmt.Sprintf("%s/projects/%s/queries", q.queryURL, url.PathEscape(q.cfg.BigQueryProject)),
+		"application/json", body, resp)
+	deadline := time.Now().Add(mergeTimeout)
+	for err == nil && !resp.JobComplete {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("bigquery: job %v is not done after %v", resp.JobReference.JobID, mergeTimeout)
+		}
+		u := fmt.Sprintf("%s/projects/%s/queries/%s?location=%s&timeoutMs=%d", q.queryURL,
+			url.PathEscape(q.cfg.BigQueryProject), url.PathEscape(resp.JobReference.JobID),
+			url.QueryEscape(resp.JobReference.Location), int64(pollInterval/time.Millisecond))
+		resp = &bigQueryResponse{}
+		err = q.request("GET", u, "", nil, resp)
+	}
+	if err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("bigquery: %v: %v", resp.Errors[0].Reason, resp.Errors[0].Message)
+	}
+	return nil
+}
+
+// request sends a request with the access token, and decodes the response into v.
+func (q *bigQuery) request(method, u, contentType string, body []byte, v interface{}) error {
+	token, err := q.cfg.token()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error.Message != "" {
+			return fmt.Errorf("%v: %v", resp.Status, e.Error.Message)
+		}
+		return fmt.Errorf("%v", resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package warehouse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	noteBinary = "binary values are staged as strings. Bytes which are not UTF-8 are replaced"
+	noteEnum   = "the values are not restricted on the target"
+)
+
+// mysqlType is a parsed MySQL COLUMN_TYPE, e.g. "decimal(10,2) unsigned".
+type mysqlType struct {
+	full     string
+	base     string
+	args     []int
+	unsigned bool
+}
+
+func parseMySQLType(columnType string) *mysqlType {
+	t := &mysqlType{full: strings.ToLower(strings.TrimSpace(columnType))}
+	t.base = t.full
+	if i := strings.IndexAny(t.base, "( "); i >= 0 {
+		t.base = t.base[:i]
+	}
+	if i := strings.Index(t.full, "("); i >= 0 && t.base != "enum" && t.base != "set" {
+		if j := strings.Index(t.full[i:], ")"); j > 0 {
+			for _, arg := range strings.Split(t.full[i+1:i+j], ",") {
+				n, err := strconv.Atoi(strings.TrimSpace(arg))
+				if err != nil {
+					break
+				}
+				t.args = append(t.args, n)
+			}
+		}
+	}
+	t.unsigned = strings.Contains(t.full, " unsigned")
+	return t
+}
+
+func (t *mysqlType) arg(i, dflt int) int {
+	if i < len(t.args) {
+		return t.args[i]
+	}
+	return dflt
+}
+
+// digits of the integer types, signed and unsigned
+var intDigits = map[string][2]int{
+	"tinyint":   {3, 3},
+	"smallint":  {5, 5},
+	"mediumint": {7, 8},
+	"int":       {10, 10},
+	"integer":   {10, 10},
+	"bigint":    {19, 20},
+}
+
+// targetType returns the type of a MySQL column on the warehouse, and a note
+// if the conversion is not exact. The type is empty if there is no conversion.
+// typeMappings overrides it, by the full column type (e.g. "tinyint(1)") or
+// by the base type (e.g. "json").
+func targetType(warehouseType string, columnType string, typeMappings map[string]string) (string, string) {
+	t := parseMySQLType(columnType)
+	for _, key := range []string{t.full, t.base} {
+		for k, v := range typeMappings {
+			if strings.ToLower(k) == key {
+				return v, "set by TypeMappings"
+			}
+		}
+	}
+	if strings.ToLower(warehouseType) == TypeBigQuery {
+		return bigQueryType(t)
+	}
+	return snowflakeType(t)
+}
+
+func snowflakeType(t *mysqlType) (string, string) {
+	if digits, ok := intDigits[t.base]; ok {
+		if t.unsigned {
+			return fmt.Sprintf("NUMBER(%d,0)", digits[1]), ""
+		}
+		return fmt.Sprintf("NUMBER(%d,0)", digits[0]), ""
+	}
+	switch t.base {
+	case "decimal", "numeric":
+		p, s := t.arg(0, 10), t.arg(1, 0)
+		if p > 38 {
+			return "VARCHAR", fmt.Sprintf("precision %d is over 38 of NUMBER", p)
+		}
+		return fmt.Sprintf("NUMBER(%d,%d)", p, s), ""
+	case "float", "double", "real":
+		return "FLOAT", ""
+	case "bit":
+		return "NUMBER(20,0)", ""
+	case "year":
+		return "NUMBER(4,0)", ""
+	case "char", "varchar":
+		return fmt.Sprintf("VARCHAR(%d)", t.arg(0, 1)), ""
+	case "tinytext", "text", "mediumtext", "longtext":
+		return "VARCHAR", ""
+	case "enum", "set":
+		return "VARCHAR", noteEnum
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "VARCHAR", noteBinary
+	case "date":
+		return "DATE", ""
+	case "datetime", "timestamp":
+		return fmt.Sprintf("TIMESTAMP_NTZ(%d)", t.arg(0, 0)), ""
+	case "time":
+		return fmt.Sprintf("TIME(%d)", t.arg(0, 0)), "values out of 00:00:00 to 23:59:59 cannot be merged"
+	case "json":
+		return "VARIANT", "the values are loaded as JSON strings, use PARSE_JSON() to query them"
+	}
+	return "", fmt.Sprintf("type %v is not supported", t.full)
+}
+
+func bigQueryType(t *mysqlType) (string, string) {
+	if _, ok := intDigits[t.base]; ok {
+		if t.base == "bigint" && t.unsigned {
+			return "NUMERIC", ""
+		}
+		return "INT64", ""
+	}
+	switch t.base {
+	case "decimal", "numeric":
+		p, s := t.arg(0, 10), t.arg(1, 0)
+		if p-s <= 29 && s <= 9 {
+			return fmt.Sprintf("NUMERIC(%d,%d)", p, s), ""
+		}
+		if s <= 38 {
+			return fmt.Sprintf("BIGNUMERIC(%d,%d)", p, s), ""
+		}
+		return "STRING", fmt.Sprintf("scale %d is over 38 of BIGNUMERIC", s)
+	case "float", "double", "real":
+		return "FLOAT64", ""
+	case "bit", "year":
+		return "INT64", ""
+	case "char", "varchar":
+		return fmt.Sprintf("STRING(%d)", t.arg(0, 1)), ""
+	case "tinytext", "text", "mediumtext", "longtext":
+		return "STRING", ""
+	case "enum", "set":
+		return "STRING", noteEnum
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "STRING", noteBinary
+	case "date":
+		return "DATE", ""
+	case "datetime":
+		return "DATETIME", ""
+	case "timestamp":
+		return "TIMESTAMP", ""
+	case "time":
+		return "TIME", "values out of 00:00:00 to 23:59:59 cannot be merged"
+	case "json":
+		return "JSON", ""
+	}
+	return "", fmt.Sprintf("type %v is not supported", t.full)
+}
+
+// ConvertTable proposes the target table of a source table. The statement
+// is what the runner executes with CreateTables, once approved in
+// TableStatements. The schema (Snowflake) or dataset (BigQuery) has to exist.
+func ConvertTable(cfg *WarehouseConfig, table *config.Table) *models.TableConversion {
+	r := &models.TableConversion{
+		TableSchema: table.TableSchema,
+		TableName:   table.TableName,
+	}
+	if table.OriginalTableColumns == nil {
+		r.Error = "unknown columns"
+		return r
+	}
+	bigQuery := strings.ToLower(cfg.Type) == TypeBigQuery
+	quote := func(name string) string {
+		if bigQuery {
+			return "`" + strings.Replace(name, "`", "\\`", -1) + "`"
+		}
+		// the merge does not quote the target identifiers
+		return name
+	}
+
+	var defs, keys, unsupported []string
+	for _, c := range table.OriginalTableColumns.ColumnList() {
+		typ, note := targetType(cfg.Type, c.ColumnType, cfg.TypeMappings)
+		r.Columns = append(r.Columns, &models.ColumnConversion{
+			Name:       c.Name,
+			SourceType: c.ColumnType,
+			TargetType: typ,
+			Note:       note,
+		})
+		if typ == "" {
+			unsupported = append(unsupported, c.Name)
+			continue
+		}
+		def := fmt.Sprintf("%s %s", quote(c.Name), typ)
+		if !c.Nullable {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+		if c.IsPk() {
+			keys = append(keys, quote(c.Name))
+		}
+	}
+	if len(unsupported) > 0 {
+		r.Error = fmt.Sprintf("no target type of columns %v. Set them in TypeMappings", strings.Join(unsupported, ", "))
+		return r
+	}
+
+	if len(keys) > 0 {
+		pk := fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(keys, ", "))
+		if bigQuery {
+			pk += " NOT ENFORCED"
+		}
+		defs = append(defs, pk)
+	}
+	r.Statement = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)",
+		cfg.targetTableName(table.TableSchema, table.TableName), strings.Join(defs, ", "))
+	return r
+}
+
+// targetTableName is the name of the target table of a source table in DDL.
+func (c *WarehouseConfig) targetTableName(schema, table string) string {
+	if strings.ToLower(c.Type) == TypeBigQuery {
+		return "`" + strings.Replace(fmt.Sprintf("%s.%s.%s", c.BigQueryProject, schema, table), "`", "\\`", -1) + "`"
+	}
+	if c.SnowflakeDatabase == "" {
+		return fmt.Sprintf("%s.%s", schema, table)
+	}
+	return fmt.Sprintf("%s.%s.%s", c.SnowflakeDatabase, schema, table)
+}
+
+// createTable creates the target table of a source table with the approved
+// statement, before the first merge into it.
+func (r *WarehouseRunner) createTable(ident string) error {
+	if r.created[ident] {
+		return nil
+	}
+	statement, ok := r.cfg.TableStatements[ident]
+	if !ok {
+		return fmt.Errorf("warehouse: no approved statement in TableStatements to create %v", ident)
+	}
+	if err := r.sink.execute(statement); err != nil {
+		return fmt.Errorf("warehouse: creating %v: %v", ident, err)
+	}
+	r.logger.Printf("warehouse: created %v", ident)
+	r.created[ident] = true
+	return nil
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package warehouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// snowflake stages the batches to S3, and merges them with the SQL API of Snowflake.
+// See https://docs.snowflake.com/en/developer-guide/sql-api/index
+type snowflake struct {
+	cfg     *WarehouseConfig
+	baseURL string
+	client  *http.Client
+	s3      *s3.S3
+}
+
+func newSnowflake(cfg *WarehouseConfig) (*snowflake, error) {
+	awsCfg := aws.NewConfig()
+	if cfg.S3Region != "" {
+		awsCfg = awsCfg.WithRegion(cfg.S3Region)
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &snowflake{
+		cfg:     cfg,
+		baseURL: fmt.Sprintf("https://%s.snowflakecomputing.com", cfg.SnowflakeAccount),
+		client:  &http.Client{Timeout: httpTimeout},
+		s3:      s3.New(sess),
+	}, nil
+}
+
+// stage puts the file to S3Bucket/S3Prefix/name, which is name in SnowflakeStage.
+func (s *snowflake) stage(name string, data []byte) (string, error) {
+	key := strings.TrimPrefix(fmt.Sprintf("%s/%s", strings.Trim(s.cfg.S3Prefix, "/"), name), "/")
+	_, err := s.s3.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.cfg.S3Bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error uploading s3://%v/%v: %v", s.cfg.S3Bucket, key, err)
+	}
+	return fmt.Sprintf("@%s/%s", s.cfg.SnowflakeStage, name), nil
+}
+
+func (s *snowflake) merge(def *tableDef, location string) error {
+	return s.execute(snowflakeMergeStatement(s.cfg.SnowflakeDatabase, def, location))
+}
+
+// snowflakeMergeStatement reads the staged JSON with the file format of the
+// stage. Target identifiers are not quoted, so they are case insensitive.
+func snowflakeMergeStatement(database string, def *tableDef, location string) string {
+	field := func(name string) string {
+		return fmt.Sprintf(`$1:"%s"`, strings.Replace(name, `"`, `""`, -1))
+	}
+	alias := func(name string) string {
+		return fmt.Sprintf(`"%s"`, strings.Replace(name, `"`, `""`, -1))
+	}
+
+	var selects, keyFields, on []string
+	for _, c := range def.columns {
+		selects = append(selects, fmt.Sprintf("%s AS %s", field(c), alias(c)))
+	}
+	selects = append(selects, fmt.Sprintf("%s::STRING AS %s", field(opField), alias(opField)))
+	for _, k := range def.keys {
+		keyFields = append(keyFields, field(k))
+		on = append(on, fmt.Sprintf("t.%s = s.%s", k, alias(k)))
+	}
+
+	var buf bytes.Buffer
+	table := fmt.Sprintf("%s.%s.%s", database, def.schema, def.table)
+	if database == "" {
+		table = fmt.Sprintf("%s.%s", def.schema, def.table)
+	}
+	fmt.Fprintf(&buf, "MERGE INTO %s t USING (SELECT %s FROM %s QUALIFY ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s::NUMBER DESC) = 1) s ON %s",
+		table, strings.Join(selects, ", "), location, strings.Join(keyFields, ", "), field(seqField), strings.Join(on, " AND "))
+	fmt.Fprintf(&buf, " WHEN MATCHED AND s.%s = '%s' THEN DELETE", alias(opField), opDelete)
+	if nonKeys := def.nonKeys(); len(nonKeys) > 0 {
+		var sets []string
+		for _, c := range nonKeys {
+			sets = append(sets, fmt.Sprintf("t.%s = s.%s", c, alias(c)))
+		}
+		fmt.Fprintf(&buf, " WHEN MATCHED THEN UPDATE SET %s", strings.Join(sets, ", "))
+	}
+	var values []string
+	for _, c := range def.columns {
+		values = append(values, "s."+alias(c))
+	}
+	fmt.Fprintf(&buf, " WHEN NOT MATCHED AND s.%s <> '%s' THEN INSERT (%s) VALUES (%s)",
+		alias(opField), opDelete, strings.Join(def.columns, ", "), strings.Join(values, ", "))
+	return buf.String()
+}
+
+type snowflakeRequest struct {
+	Statement string `json:"statement"`
+	Timeout   int    `json:"timeout"`
+	Database  string `json:"database,omitempty"`
+	Warehouse string `json:"warehouse,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+type snowflakeResponse struct {
+	Code               string `json:"code"`
+	Message            string `json:"message"`
+	StatementHandle    string `json:"statementHandle"`
+	StatementStatusURL string `json:"statementStatusUrl"`
+}
+
+// execute submits a statement and waits for it to finish.
+func (s *snowflake) execute(statement string) error {
+	body, err := json.Marshal(&snowflakeRequest{
+		Statement: statement,
+		Timeout:   int(mergeTimeout / time.Second),
+		Database:  s.cfg.SnowflakeDatabase,
+		Warehouse: s.cfg.SnowflakeWarehouse,
+		Role:      s.cfg.SnowflakeRole,
+	})
+	if err != nil {
+		return err
+	}
+	status, resp, err := s.request("POST", s.baseURL+"/api/v2/statements", body)
+	for err == nil && status == http.StatusAccepted {
+		// still running
+		time.Sleep(pollInterval)
+		status, resp, err = s.request("GET", s.baseURL+resp.StatementStatusURL, nil)
+	}
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("snowflake: %v (%v): %v", resp.Code, status, resp.Message)
+	}
+	return nil
+}
+
+func (s *snowflake) request(method, url string, body []byte) (int, *snowflakeResponse, error) {
+	token, err := s.cfg.token()
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Snowflake-Authorization-Token-Type", s.cfg.SnowflakeTokenType)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	httpResp, err := s.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer httpResp.Body.Close()
+	resp := &snowflakeResponse{}
+	if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		return 0, nil, fmt.Errorf("snowflake: %v: decoding response: %v", httpResp.Status, err)
+	}
+	return httpResp.StatusCode, resp, nil
+}
@@ -0,0 +1,579 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package warehouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gonats "github.com/nats-io/go-nats"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+
+	mysqlDriver "github.com/actiontech/dtle/internal/client/driver/mysql"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	TaskStateComplete int = iota
+	TaskStateRestart
+	TaskStateDead
+)
+
+const (
+	TypeSnowflake = "snowflake"
+	TypeBigQuery  = "bigquery"
+
+	defaultBatchIntervalSeconds = 60
+	defaultBatchRows            = 100000
+
+	httpTimeout  = 5 * time.Minute
+	mergeTimeout = 30 * time.Minute
+	pollInterval = 2 * time.Second
+)
+
+// WarehouseConfig is the configuration of a 'Warehouse' Dest task.
+// Every BatchIntervalSeconds, or once BatchRows changes are received, the
+// changes of each table are staged to object storage as a JSON file and
+// merged into the table of the same schema and name in the warehouse.
+// Deleting the staged files is left to a lifecycle rule of the bucket.
+type WarehouseConfig struct {
+	// Type is "snowflake" or "bigquery"
+	Type                 string
+	BatchIntervalSeconds int
+	BatchRows            int
+
+	// Token is an OAuth access token of Snowflake or Google Cloud. TokenFile
+	// is read before each request instead, for the token to be refreshed by
+	// another process.
+	Token     string
+	TokenFile string
+
+	// Snowflake: SnowflakeStage is an external stage with a JSON file format,
+	// on s3://S3Bucket/S3Prefix. The target tables are in SnowflakeDatabase.
+	SnowflakeAccount string
+	// "OAUTH" (default) or "KEYPAIR_JWT"
+	SnowflakeTokenType string
+	SnowflakeWarehouse string
+	SnowflakeDatabase  string
+	SnowflakeRole      string
+	SnowflakeStage     string
+	S3Bucket           string
+	S3Prefix           string
+	S3Region           string
+
+	// BigQuery: the batches are staged to gs://GCSBucket/GCSPrefix. A schema
+	// of the source is a dataset of BigQueryProject.
+	BigQueryProject string
+	GCSBucket       string
+	GCSPrefix       string
+
+	// TypeMappings overrides the target types of the schema conversion
+	// report, by the MySQL column type (e.g. "tinyint(1)") or base type (e.g. "json").
+	TypeMappings map[string]string
+	// CreateTables creates each target table before merging into it, with
+	// its statement in TableStatements, by "schema.table". The statements are
+	// proposed by the conversion report (/v1/convert/job), and are copied
+	// there once reviewed.
+	CreateTables    bool
+	TableStatements map[string]string
+
+	NatsAddr string
+	Gtid     string
+}
+
+// Validate checks the configuration and sets the defaults.
+func (c *WarehouseConfig) Validate() error {
+	if c.Token == "" && c.TokenFile == "" {
+		return fmt.Errorf("Token or TokenFile is required for a Warehouse task")
+	}
+	switch strings.ToLower(c.Type) {
+	case TypeSnowflake:
+		if c.SnowflakeAccount == "" || c.SnowflakeStage == "" || c.S3Bucket == "" {
+			return fmt.Errorf("SnowflakeAccount, SnowflakeStage and S3Bucket are required for Snowflake")
+		}
+		if c.SnowflakeTokenType == "" {
+			c.SnowflakeTokenType = "OAUTH"
+		}
+	case TypeBigQuery:
+		if c.BigQueryProject == "" || c.GCSBucket == "" {
+			return fmt.Errorf("BigQueryProject and GCSBucket are required for BigQuery")
+		}
+	default:
+		return fmt.Errorf("unknown warehouse Type %q. Expected %q or %q", c.Type, TypeSnowflake, TypeBigQuery)
+	}
+	if c.CreateTables && len(c.TableStatements) == 0 {
+		return fmt.Errorf("CreateTables needs the reviewed TableStatements of the conversion report")
+	}
+	if c.BatchIntervalSeconds <= 0 {
+		c.BatchIntervalSeconds = defaultBatchIntervalSeconds
+	}
+	if c.BatchRows <= 0 {
+		c.BatchRows = defaultBatchRows
+	}
+	return nil
+}
+
+func (c *WarehouseConfig) token() (string, error) {
+	if c.TokenFile == "" {
+		return c.Token, nil
+	}
+	bs, err := ioutil.ReadFile(c.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
+// sink is a warehouse: batches are staged to object storage and merged from there.
+type sink interface {
+	// stage uploads a batch file, and returns the location the merge reads it from.
+	stage(name string, data []byte) (string, error)
+	merge(def *tableDef, location string) error
+	execute(statement string) error
+}
+
+// WarehouseRunner receives the full copy and the binlog entries, and merges
+// them into the warehouse in batches.
+type WarehouseRunner struct {
+	logger   *log.Entry
+	subject  string
+	cfg      *WarehouseConfig
+	natsConn *gonats.Conn
+	waitCh   chan *models.WaitResult
+	sink     sink
+
+	// the messages of the extractor received in chunks
+	msgChunks *mysqlDriver.ChunkAssembler
+
+	mu sync.Mutex
+	// table definitions by "schema.table"
+	defs    map[string]*tableDef
+	batches map[string]*tableBatch
+	// target tables created by CreateTables
+	created map[string]bool
+	nRows   int
+	seq     int64
+	// gtidSet is merged. pendingGtids are in the batches.
+	gtidSet      *gomysql.MysqlGTIDSet
+	pendingGtids []string
+	nTx          int64
+
+	shutdown   bool
+	shutdownCh chan struct{}
+}
+
+func NewWarehouseRunner(subject string, cfg *WarehouseConfig, logger *log.Logger) *WarehouseRunner {
+	entry := log.NewEntry(logger).WithFields(log.Fields{
+		"job": subject,
+	})
+	return &WarehouseRunner{
+		subject:    subject,
+		cfg:        cfg,
+		logger:     entry,
+		defs:       make(map[string]*tableDef),
+		batches:    make(map[string]*tableBatch),
+		created:    make(map[string]bool),
+		waitCh:     make(chan *models.WaitResult, 1),
+		shutdownCh: make(chan struct{}),
+		msgChunks:  mysqlDriver.NewChunkAssembler(),
+	}
+}
+
+func (r *WarehouseRunner) ID() string {
+	id := config.DriverCtx{
+		DriverConfig: &config.MySQLDriverConfig{
+			NatsAddr: r.cfg.NatsAddr,
+		},
+	}
+
+	data, err := json.Marshal(id)
+	if err != nil {
+		r.logger.Errorf("warehouse: Failed to marshal ID to JSON: %s", err)
+	}
+	return string(data)
+}
+
+func (r *WarehouseRunner) WaitCh() chan *models.WaitResult {
+	return r.waitCh
+}
+
+func (r *WarehouseRunner) Shutdown() error {
+	if r.shutdown {
+		return nil
+	}
+	if r.natsConn != nil {
+		r.natsConn.Close()
+	}
+	r.shutdown = true
+	close(r.shutdownCh)
+
+	r.logger.Printf("warehouse: Shutting down")
+	return nil
+}
+
+func (r *WarehouseRunner) Stats() (*models.TaskStatistics, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	taskResUsage := &models.TaskStatistics{
+		ExecMasterTxCount: atomic.LoadInt64(&r.nTx),
+		Stage:             models.StageWaitingForMasterToSendEvent,
+		Timestamp:         time.Now().UTC().UnixNano(),
+		BufferStat: models.BufferStat{
+			ApplierTxQueueSize: r.nRows,
+		},
+	}
+	taskResUsage.CurrentCoordinates = &models.CurrentCoordinates{}
+	if r.gtidSet != nil {
+		taskResUsage.CurrentCoordinates.ExecutedGtidSet = r.gtidSet.String()
+	}
+	taskResUsage.MsgStat = gonats.Statistics{}
+	if r.natsConn != nil {
+		taskResUsage.MsgStat = r.natsConn.Statistics
+	}
+	return taskResUsage, nil
+}
+
+func (r *WarehouseRunner) Run() {
+	if err := r.cfg.Validate(); err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+	gtidSet, err := gomysql.ParseMysqlGTIDSet(r.cfg.Gtid)
+	if err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+	r.gtidSet = gtidSet.(*gomysql.MysqlGTIDSet)
+
+	if strings.ToLower(r.cfg.Type) == TypeSnowflake {
+		if r.sink, err = newSnowflake(r.cfg); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+	} else {
+		r.sink = newBigQuery(r.cfg)
+	}
+
+	natsAddr := fmt.Sprintf("nats://%s", r.cfg.NatsAddr)
+	sc, err := gonats.Connect(natsAddr)
+	if err != nil {
+		r.logger.Errorf("warehouse: Can't connect nats server %v. make sure a nats streaming server is running.%v", natsAddr, err)
+		r.onError(TaskStateDead, err)
+		return
+	}
+	r.logger.Debugf("warehouse: Connect nats server %v", natsAddr)
+	r.natsConn = sc
+
+	if err := r.initiateStreaming(); err != nil {
+		r.onError(TaskStateDead, err)
+		return
+	}
+	go r.flushPeriodically()
+}
+
+func (r *WarehouseRunner) initiateStreaming() error {
+	_, err := r.natsConn.Subscribe(fmt.Sprintf("%s_full", r.subject), func(m *gonats.Msg) {
+		if complete, err := r.msgChunks.Assemble(r.natsConn, m); !complete {
+			if err != nil {
+				r.onError(TaskStateDead, err)
+			}
+			return
+		}
+		dumpData := &mysqlDriver.DumpEntry{}
+		if err := mysqlDriver.Decode(m.Data, dumpData); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		if err := r.addDumpEntry(dumpData); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		if err := r.natsConn.Publish(m.Reply, nil); err != nil {
+			r.onError(TaskStateDead, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.natsConn.Subscribe(fmt.Sprintf("%s_full_complete", r.subject), func(m *gonats.Msg) {
+		if complete, err := r.msgChunks.Assemble(r.natsConn, m); !complete {
+			if err != nil {
+				r.onError(TaskStateDead, err)
+			}
+			return
+		}
+		dumpData := &mysqlDriver.DumpStatResult{}
+		if err := mysqlDriver.Decode(m.Data, dumpData); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		r.mu.Lock()
+		r.pendingGtids = append(r.pendingGtids, dumpData.Gtid)
+		err := r.flush()
+		r.mu.Unlock()
+		if err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		if err := r.natsConn.Publish(m.Reply, nil); err != nil {
+			r.onError(TaskStateDead, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.natsConn.Subscribe(fmt.Sprintf("%s_incr_hete", r.subject), func(m *gonats.Msg) {
+		if complete, err := r.msgChunks.Assemble(r.natsConn, m); !complete {
+			if err != nil {
+				r.onError(TaskStateDead, err)
+			}
+			return
+		}
+		var binlogEntries binlog.BinlogEntries
+		if err := mysqlDriver.Decode(m.Data, &binlogEntries); err != nil {
+			r.onError(TaskStateDead, err)
+			return
+		}
+		for _, binlogEntry := range binlogEntries.Entries {
+			if err := r.addBinlogEntry(binlogEntry); err != nil {
+				r.onError(TaskStateRestart, err)
+				return
+			}
+		}
+		if err := r.natsConn.Publish(m.Reply, nil); err != nil {
+			r.onError(TaskStateDead, err)
+		}
+		r.logger.Debugf("warehouse: incr. ack-recv. nEntries: %v", len(binlogEntries.Entries))
+	})
+	return err
+}
+
+func (r *WarehouseRunner) flushPeriodically() {
+	ticker := time.NewTicker(time.Duration(r.cfg.BatchIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.shutdownCh:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			err := r.flush()
+			r.mu.Unlock()
+			if err != nil {
+				r.onError(TaskStateRestart, err)
+				return
+			}
+		}
+	}
+}
+
+// setDef keeps the definition of a table, sent with the first rows or events of it.
+func (r *WarehouseRunner) setDef(t *config.Table) error {
+	if t == nil {
+		return nil
+	}
+	ident := fmt.Sprintf("%s.%s", t.TableSchema, t.TableName)
+	def, err := newTableDef(t)
+	if err != nil {
+		return err
+	}
+	if b, ok := r.batches[ident]; ok && strings.Join(b.def.columns, ",") != strings.Join(def.columns, ",") {
+		// the staged file of a table has the columns of a single definition
+		if err := r.flush(); err != nil {
+			return err
+		}
+	}
+	r.defs[ident] = def
+	return nil
+}
+
+func (r *WarehouseRunner) batch(schema, table string) (*tableBatch, error) {
+	ident := fmt.Sprintf("%s.%s", schema, table)
+	if b, ok := r.batches[ident]; ok {
+		return b, nil
+	}
+	def, ok := r.defs[ident]
+	if !ok {
+		// the extractor sends the table definitions again after a restart
+		return nil, fmt.Errorf("warehouse: unknown columns of %s", ident)
+	}
+	if r.cfg.CreateTables {
+		if err := r.createTable(ident); err != nil {
+			return nil, err
+		}
+	}
+	b := &tableBatch{def: def}
+	r.batches[ident] = b
+	return b, nil
+}
+
+// addDumpEntry adds the rows of the full copy.
+func (r *WarehouseRunner) addDumpEntry(entry *mysqlDriver.DumpEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.setDef(entry.Table); err != nil {
+		return err
+	}
+	if len(entry.ValuesX) == 0 {
+		return nil
+	}
+	b, err := r.batch(entry.TableSchema, entry.TableName)
+	if err != nil {
+		return err
+	}
+	for _, values := range entry.ValuesX {
+		r.seq++
+		if err := b.add(opUpsert, r.seq, values); err != nil {
+			return err
+		}
+	}
+	r.nRows += len(entry.ValuesX)
+	return r.flushIfFull()
+}
+
+// addBinlogEntry adds the row changes of a transaction. DDL is not replicated.
+func (r *WarehouseRunner) addBinlogEntry(entry *binlog.BinlogEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range entry.Events {
+		event := &entry.Events[i]
+		if err := r.setDef(event.Table); err != nil {
+			return err
+		}
+		if event.Statement {
+			return binlog.StatementNotApplied(entry, event, r.cfg.Type)
+		}
+		if len(event.JSONDiffs) > 0 {
+			return binlog.PartialUpdateNotApplied(entry, event, r.cfg.Type)
+		}
+		if event.DML == binlog.NotDML {
+			r.logger.Warnf("warehouse: skip DDL of gtid %v: %v", entry.Coordinates.GetGtidForThisTx(), event.Query)
+			continue
+		}
+		b, err := r.batch(event.DatabaseName, event.TableName)
+		if err != nil {
+			return err
+		}
+		switch event.DML {
+		case binlog.InsertDML:
+			r.seq++
+			err = b.add(opUpsert, r.seq, event.NewColumnValues.GetAbstractValues())
+		case binlog.DeleteDML:
+			r.seq++
+			err = b.add(opDelete, r.seq, event.WhereColumnValues.GetAbstractValues())
+		case binlog.UpdateDML:
+			before := event.WhereColumnValues.GetAbstractValues()
+			after := event.NewColumnValues.GetAbstractValues()
+			if b.def.keyChanged(before, after) {
+				r.seq++
+				if err = b.add(opDelete, r.seq, before); err != nil {
+					return err
+				}
+				r.nRows++
+			}
+			r.seq++
+			err = b.add(opUpsert, r.seq, after)
+		}
+		if err != nil {
+			return err
+		}
+		r.nRows++
+	}
+	r.pendingGtids = append(r.pendingGtids, entry.Coordinates.GetGtidForThisTx())
+	atomic.AddInt64(&r.nTx, 1)
+	return r.flushIfFull()
+}
+
+func (r *WarehouseRunner) flushIfFull() error {
+	if r.nRows < r.cfg.BatchRows {
+		return nil
+	}
+	return r.flush()
+}
+
+// flush stages and merges the batches, then marks their transactions as
+// merged. A failed merge is retried from the merged GTID set by a restart.
+// Merging a change twice is harmless. It is called with r.mu held.
+func (r *WarehouseRunner) flush() error {
+	idents := make([]string, 0, len(r.batches))
+	for ident := range r.batches {
+		idents = append(idents, ident)
+	}
+	sort.Strings(idents)
+
+	now := time.Now().UTC()
+	for _, ident := range idents {
+		b := r.batches[ident]
+		name := fmt.Sprintf("%s/%s-%d-%s.json", r.subject, now.Format("20060102T150405"), now.UnixNano(), ident)
+		location, err := r.sink.stage(name, b.buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := r.sink.merge(b.def, location); err != nil {
+			return fmt.Errorf("warehouse: merging %v into %v: %v", location, ident, err)
+		}
+		r.logger.Debugf("warehouse: merged %v changes of %v", b.n, ident)
+		delete(r.batches, ident)
+	}
+	for _, gtid := range r.pendingGtids {
+		if err := r.gtidSet.Update(gtid); err != nil {
+			return err
+		}
+	}
+	if len(idents) > 0 {
+		r.logger.Printf("warehouse: merged %v changes of %v tables. gtid: %v", r.nRows, len(idents), r.gtidSet.String())
+	}
+	r.pendingGtids = nil
+	r.nRows = 0
+	return nil
+}
+
+func (r *WarehouseRunner) onError(state int, err error) {
+	if r.shutdown {
+		return
+	}
+	gtid := r.cfg.Gtid
+	if r.gtidSet != nil {
+		r.mu.Lock()
+		gtid = r.gtidSet.String()
+		r.mu.Unlock()
+	}
+	switch state {
+	case TaskStateComplete:
+		r.logger.Printf("warehouse: Done")
+	case TaskStateRestart:
+		r.logger.Errorf("warehouse: %v", err)
+		if r.natsConn != nil {
+			if err := r.natsConn.Publish(fmt.Sprintf("%s_restart", r.subject), []byte(gtid)); err != nil {
+				r.logger.Errorf("warehouse: Trigger restart: %v", err)
+			}
+		}
+	default:
+		r.logger.Errorf("warehouse: %v", err)
+		if r.natsConn != nil {
+			if err := r.natsConn.Publish(fmt.Sprintf("%s_error", r.subject), []byte(gtid)); err != nil {
+				r.logger.Errorf("warehouse: Trigger shutdown: %v", err)
+			}
+		}
+	}
+
+	r.waitCh <- models.NewWaitResult(state, err)
+	r.Shutdown()
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package warehouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+var testDef = &tableDef{
+	schema:  "db1",
+	table:   "user",
+	columns: []string{"id", "name"},
+	keys:    []string{"id"},
+}
+
+func TestSnowflakeMergeStatement(t *testing.T) {
+	got := snowflakeMergeStatement("DW", testDef, "@stage/f.json")
+	want := `MERGE INTO DW.db1.user t USING (SELECT $1:"id" AS "id", $1:"name" AS "name", $1:"_dtle_op"::STRING AS "_dtle_op" FROM @stage/f.json ` +
+		`QUALIFY ROW_NUMBER() OVER (PARTITION BY $1:"id" ORDER BY $1:"_dtle_seq"::NUMBER DESC) = 1) s ON t.id = s."id" ` +
+		`WHEN MATCHED AND s."_dtle_op" = 'D' THEN DELETE WHEN MATCHED THEN UPDATE SET t.name = s."name" ` +
+		`WHEN NOT MATCHED AND s."_dtle_op" <> 'D' THEN INSERT (id, name) VALUES (s."id", s."name")`
+	if got != want {
+		t.Errorf("snowflakeMergeStatement() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestBigQueryMergeScript(t *testing.T) {
+	got := bigQueryMergeScript("p1", testDef, "gs://b/f.json")
+	for _, want := range []string{
+		"CREATE TABLE IF NOT EXISTS `p1.db1.user__dtle_stage` AS SELECT *, '' AS _dtle_op, 0 AS _dtle_seq FROM `p1.db1.user` LIMIT 0;\n",
+		"LOAD DATA OVERWRITE `p1.db1.user__dtle_stage` FROM FILES (format = 'JSON', uris = ['gs://b/f.json']);\n",
+		"MERGE `p1.db1.user` t USING (SELECT * FROM `p1.db1.user__dtle_stage` WHERE TRUE QUALIFY ROW_NUMBER() OVER (PARTITION BY `id` ORDER BY _dtle_seq DESC) = 1) s ON t.`id` = s.`id`",
+		" WHEN MATCHED THEN UPDATE SET `name` = s.`name`",
+		" INSERT (`id`, `name`) VALUES (s.`id`, s.`name`);",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("bigQueryMergeScript() =\n%v\nmissing\n%v", got, want)
+		}
+	}
+}
+
+type stagedFile struct {
+	def  *tableDef
+	data string
+}
+
+// fakeSink keeps the merged files.
+type fakeSink struct {
+	merged   []stagedFile
+	staged   map[string]string
+	executed []string
+}
+
+func (s *fakeSink) stage(name string, data []byte) (string, error) {
+	s.staged[name] = string(data)
+	return name, nil
+}
+
+func (s *fakeSink) merge(def *tableDef, location string) error {
+	s.merged = append(s.merged, stagedFile{def, s.staged[location]})
+	return nil
+}
+
+func (s *fakeSink) execute(statement string) error {
+	s.executed = append(s.executed, statement)
+	return nil
+}
+
+func TestWarehouseRunner_flush(t *testing.T) {
+	cfg := &WarehouseConfig{Type: TypeBigQuery, Token: "t", BigQueryProject: "p1", GCSBucket: "b", BatchRows: 100}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewWarehouseRunner("job1", cfg, log.New(os.Stderr, log.DebugLevel))
+	sink := &fakeSink{staged: make(map[string]string)}
+	r.sink = sink
+	gtidSet, _ := gomysql.ParseMysqlGTIDSet("")
+	r.gtidSet = gtidSet.(*gomysql.MysqlGTIDSet)
+
+	value := func(v interface{}) *interface{} {
+		return &v
+	}
+	row := func(id int64, name string) *umconf.ColumnValues {
+		return &umconf.ColumnValues{AbstractValues: []*interface{}{value(id), value([]byte(name))}}
+	}
+	insert := binlog.NewDataEvent("db1", "user", binlog.InsertDML, 2)
+	insert.Table = &config.Table{
+		TableSchema:          "db1",
+		TableName:            "user",
+		OriginalTableColumns: umconf.NewColumnList([]umconf.Column{{Name: "id", Key: "PRI"}, {Name: "name"}}),
+	}
+	insert.NewColumnValues = row(1, "a")
+	// the key changes from 1 to 2
+	update := binlog.NewDataEvent("db1", "user", binlog.UpdateDML, 2)
+	update.WhereColumnValues = row(1, "a")
+	update.NewColumnValues = row(2, "b")
+	del := binlog.NewDataEvent("db1", "user", binlog.DeleteDML, 2)
+	del.WhereColumnValues = row(3, "c")
+
+	entry := binlog.NewBinlogEntryAt(base.BinlogCoordinateTx{SID: [16]byte{1}, GNO: 7})
+	entry.Events = []binlog.DataEvent{insert, update, del}
+	if err := r.addBinlogEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	if r.gtidSet.String() != "" {
+		t.Errorf("gtid set = %v before the merge", r.gtidSet.String())
+	}
+	if err := r.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.merged) != 1 {
+		t.Fatalf("merged %v files", len(sink.merged))
+	}
+	var ops []string
+	for _, line := range strings.Split(strings.TrimSpace(sink.merged[0].data), "\n") {
+		var change map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &change); err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, fmt.Sprintf("%v %v %v %v", change[opField], change["id"], change["name"], change[seqField]))
+	}
+	want := "U 1 a 1,D 1 a 2,U 2 b 3,D 3 c 4"
+	if strings.Join(ops, ",") != want {
+		t.Errorf("changes = %v, want %v", strings.Join(ops, ","), want)
+	}
+	if !strings.HasSuffix(r.gtidSet.String(), ":7") {
+		t.Errorf("gtid set = %v", r.gtidSet.String())
+	}
+
+	// the columns are unknown until the extractor sends the table definition
+	r.defs = make(map[string]*tableDef)
+	entry.Events = []binlog.DataEvent{del}
+	if err := r.addBinlogEntry(entry); err == nil {
+		t.Errorf("addBinlogEntry() should fail on unknown columns")
+	}
+}
+
+func TestSnowflake_execute(t *testing.T) {
+	var statements []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"390303","message":"Invalid OAuth access token"}`))
+			return
+		}
+		switch req.Method {
+		case "POST":
+			var body snowflakeRequest
+			json.NewDecoder(req.Body).Decode(&body)
+			statements = append(statements, body.Statement)
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"statementHandle":"h1","statementStatusUrl":"/api/v2/statements/h1"}`))
+		default:
+			if req.URL.Path != "/api/v2/statements/h1" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{}`))
+				return
+			}
+			w.Write([]byte(`{"statementHandle":"h1"}`))
+		}
+	}))
+	defer ts.Close()
+
+	cfg := &WarehouseConfig{Token: "t", SnowflakeTokenType: "OAUTH"}
+	s := &snowflake{cfg: cfg, baseURL: ts.URL, client: ts.Client()}
+	if err := s.execute("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 1 || statements[0] != "SELECT 1" {
+		t.Errorf("statements = %v", statements)
+	}
+
+	cfg.Token = "expired"
+	if err := s.execute("SELECT 1"); err == nil || !strings.Contains(err.Error(), "Invalid OAuth access token") {
+		t.Errorf("execute() = %v", err)
+	}
+}
+
+func TestConvertTable(t *testing.T) {
+	table := &config.Table{
+		TableSchema: "db1",
+		TableName:   "user",
+		OriginalTableColumns: umconf.NewColumnList([]umconf.Column{
+			{Name: "id", ColumnType: "bigint(20) unsigned", Key: "PRI"},
+			{Name: "price", ColumnType: "decimal(40,2)", Nullable: true},
+			{Name: "flag", ColumnType: "tinyint(1)"},
+			{Name: "name", ColumnType: "varchar(20)", Nullable: true},
+			{Name: "state", ColumnType: "enum('a','b')", Nullable: true},
+			{Name: "at", ColumnType: "datetime(3)", Nullable: true},
+		}),
+	}
+	cfg := &WarehouseConfig{Type: "Snowflake", SnowflakeDatabase: "DW", TypeMappings: map[string]string{"TINYINT(1)": "BOOLEAN"}}
+	r := ConvertTable(cfg, table)
+	want := "CREATE TABLE IF NOT EXISTS DW.db1.user (id NUMBER(20,0) NOT NULL, price VARCHAR, flag BOOLEAN NOT NULL, " +
+		"name VARCHAR(20), state VARCHAR, at TIMESTAMP_NTZ(3), PRIMARY KEY (id))"
+	if r.Error != "" || r.Statement != want {
+		t.Errorf("ConvertTable() =\n%v\nwant\n%v (%v)", r.Statement, want, r.Error)
+	}
+	var notes []string
+	for _, c := range r.Columns {
+		if c.Note != "" {
+			notes = append(notes, c.Name)
+		}
+	}
+	if strings.Join(notes, ",") != "price,flag,state" {
+		t.Errorf("notes of %v", notes)
+	}
+
+	cfg = &WarehouseConfig{Type: TypeBigQuery, BigQueryProject: "p1"}
+	r = ConvertTable(cfg, table)
+	want = "CREATE TABLE IF NOT EXISTS `p1.db1.user` (`id` NUMERIC NOT NULL, `price` BIGNUMERIC(40,2), `flag` INT64 NOT NULL, " +
+		"`name` STRING(20), `state` STRING, `at` DATETIME, PRIMARY KEY (`id`) NOT ENFORCED)"
+	if r.Error != "" || r.Statement != want {
+		t.Errorf("ConvertTable() =\n%v\nwant\n%v (%v)", r.Statement, want, r.Error)
+	}
+
+	table.OriginalTableColumns = umconf.NewColumnList([]umconf.Column{{Name: "g", ColumnType: "point"}})
+	if r = ConvertTable(cfg, table); r.Statement != "" || r.Error == "" {
+		t.Errorf("ConvertTable() of an unsupported type = %+v", r)
+	}
+	cfg.TypeMappings = map[string]string{"point": "GEOGRAPHY"}
+	if r = ConvertTable(cfg, table); !strings.Contains(r.Statement, "`g` GEOGRAPHY NOT NULL") {
+		t.Errorf("ConvertTable() with a mapping = %+v", r)
+	}
+}
+
+func TestWarehouseRunner_createTables(t *testing.T) {
+	cfg := &WarehouseConfig{Type: TypeSnowflake, Token: "t", SnowflakeAccount: "a", SnowflakeStage: "s", S3Bucket: "b",
+		CreateTables: true}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Validate() should fail without TableStatements")
+	}
+	cfg.TableStatements = map[string]string{"db1.user": "CREATE TABLE IF NOT EXISTS db1.user (id NUMBER(10,0))"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewWarehouseRunner("job1", cfg, log.New(os.Stderr, log.DebugLevel))
+	sink := &fakeSink{staged: make(map[string]string)}
+	r.sink = sink
+
+	r.defs["db1.user"] = testDef
+	r.defs["db1.other"] = &tableDef{schema: "db1", table: "other", columns: []string{"id"}, keys: []string{"id"}}
+	for i := 0; i < 2; i++ {
+		if _, err := r.batch("db1", "user"); err != nil {
+			t.Fatal(err)
+		}
+		delete(r.batches, "db1.user")
+	}
+	if len(sink.executed) != 1 || sink.executed[0] != cfg.TableStatements["db1.user"] {
+		t.Errorf("executed %v", sink.executed)
+	}
+	if _, err := r.batch("db1", "other"); err == nil {
+		t.Errorf("batch() should fail without an approved statement")
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+	"github.com/shirou/gopsutil/net"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// hostStatsCollector samples the utilization of the host, reported with the
+// heartbeats for the scheduler to rank the nodes. The CPU and network rates
+// are computed since the previous sample.
+type hostStatsCollector struct {
+	// allocDir is on the file system whose usage is reported
+	allocDir string
+
+	lock     sync.Mutex
+	lastCPU  *cpu.TimesStat
+	lastNet  uint64
+	lastTime time.Time
+}
+
+func newHostStatsCollector(allocDir string) *hostStatsCollector {
+	return &hostStatsCollector{allocDir: allocDir}
+}
+
+// Collect samples the utilization of the host. A metric which fails to be
+// sampled is left at zero.
+func (h *hostStatsCollector) Collect() *models.NodeUtilization {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := time.Now()
+	u := &models.NodeUtilization{CollectedAt: now.Unix()}
+
+	if times, err := cpu.Times(false); err == nil && len(times) > 0 {
+		if h.lastCPU != nil {
+			u.CPUPercent = cpuPercent(*h.lastCPU, times[0])
+		}
+		h.lastCPU = &times[0]
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		u.MemoryPercent = vm.UsedPercent
+	}
+	if h.allocDir != "" {
+		if used, err := diskUsedPercent(h.allocDir); err == nil {
+			u.DiskPercent = used
+		}
+	}
+	if counters, err := net.IOCounters(false); err == nil && len(counters) > 0 {
+		total := counters[0].BytesSent + counters[0].BytesRecv
+		if elapsed := now.Sub(h.lastTime).Seconds(); !h.lastTime.IsZero() && elapsed > 0 && total >= h.lastNet {
+			u.NetworkBytesPerSec = float64(total-h.lastNet) / elapsed
+		}
+		h.lastNet = total
+	}
+	h.lastTime = now
+	return u
+}
+
+// cpuPercent returns the busy percentage of the CPU between two samples.
+func cpuPercent(t1, t2 cpu.TimesStat) float64 {
+	total := t2.Total() - t1.Total()
+	if total <= 0 {
+		return 0
+	}
+	idle := (t2.Idle + t2.Iowait) - (t1.Idle + t1.Iowait)
+	busy := (total - idle) / total * 100
+	if busy < 0 {
+		return 0
+	}
+	return busy
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"os"
+	"testing"
+
+	"github.com/shirou/gopsutil/cpu"
+)
+
+func TestHostStatsCollector(t *testing.T) {
+	h := newHostStatsCollector(os.TempDir())
+	h.Collect()
+	u := h.Collect()
+	if u.CollectedAt == 0 {
+		t.Errorf("utilization = %+v", u)
+	}
+	for name, p := range map[string]float64{"cpu": u.CPUPercent, "memory": u.MemoryPercent, "disk": u.DiskPercent} {
+		if p < 0 || p > 100 {
+			t.Errorf("%s = %v%%", name, p)
+		}
+	}
+	if u.NetworkBytesPerSec < 0 {
+		t.Errorf("network = %v", u.NetworkBytesPerSec)
+	}
+}
+
+func TestCpuPercent(t *testing.T) {
+	t1 := cpu.TimesStat{User: 10, Idle: 90}
+	t2 := cpu.TimesStat{User: 40, Idle: 110, Iowait: 10}
+	if got := cpuPercent(t1, t2); got != 50 {
+		t.Errorf("cpuPercent = %v, want 50", got)
+	}
+	if got := cpuPercent(t2, t2); got != 0 {
+		t.Errorf("cpuPercent without elapsed time = %v", got)
+	}
+}
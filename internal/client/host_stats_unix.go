@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"syscall"
+)
+
+// diskUsedPercent returns the used space of the file system of path, as
+// reported by df.
+func diskUsedPercent(path string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	used := float64(st.Blocks-st.Bfree) * float64(st.Bsize)
+	avail := float64(st.Bavail) * float64(st.Bsize)
+	if used+avail == 0 {
+		return 0, nil
+	}
+	return used / (used + avail) * 100, nil
+}
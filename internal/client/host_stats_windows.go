@@ -0,0 +1,16 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"fmt"
+)
+
+// diskUsedPercent is not supported on Windows.
+func diskUsedPercent(path string) (float64, error) {
+	return 0, fmt.Errorf("disk usage is not supported on windows")
+}
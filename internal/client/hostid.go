@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"github.com/shirou/gopsutil/host"
+)
+
+// hostID returns the ID of the host, as reported by the OS.
+func hostID() (string, error) {
+	hostInfo, err := host.Info()
+	if err != nil {
+		return "", err
+	}
+	return hostInfo.HostID, nil
+}
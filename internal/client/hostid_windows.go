@@ -0,0 +1,24 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// hostID returns the MachineGuid of the host. gopsutil/host needs packages
+// which are not vendored on windows.
+func hostID() (string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`,
+		registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+	id, _, err := k.GetStringValue("MachineGuid")
+	return id, err
+}
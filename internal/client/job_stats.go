@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// jobStatsSync samples the lag and the throughput of the Dest tasks running
+// on the node every JobStatsInterval, and sends the samples to the servers,
+// which keep them for the trends of the jobs.
+func (c *Client) jobStatsSync() {
+	ticker := time.NewTicker(models.JobStatsInterval)
+	defer ticker.Stop()
+	prev := make(map[string]*models.TaskStatistics)
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.shutdownCh:
+			return
+		}
+
+		var updates []*models.JobStatsUpdate
+		updates, prev = c.sampleJobStats(prev)
+		if len(updates) == 0 {
+			continue
+		}
+		args := models.JobStatsUpdateRequest{
+			Updates:      updates,
+			WriteRequest: models.WriteRequest{Region: c.Region()},
+		}
+		var resp models.GenericResponse
+		if err := c.RPC("Node.UpdateJobStats", &args, &resp); err != nil {
+			// the samples are lost, as the next ones would be late
+			c.logger.Warnf("agent: Failed to send the stats of %d jobs: %v", len(updates), err)
+		}
+	}
+}
+
+// sampleJobStats returns the samples of the running Dest tasks since their
+// statistics in prev, by alloc ID, and their current statistics.
+func (c *Client) sampleJobStats(prev map[string]*models.TaskStatistics) (
+	[]*models.JobStatsUpdate, map[string]*models.TaskStatistics) {
+	var updates []*models.JobStatsUpdate
+	cur := make(map[string]*models.TaskStatistics)
+	for id, ar := range c.getAllocRunners() {
+		alloc := ar.Alloc()
+		if alloc.Task != models.TaskTypeDest || alloc.ClientStatus != models.AllocClientStatusRunning {
+			continue
+		}
+		stats, err := ar.LatestAllocStats(models.TaskTypeDest)
+		if err != nil || stats.Tasks[models.TaskTypeDest] == nil {
+			continue
+		}
+		cur[id] = stats.Tasks[models.TaskTypeDest]
+		if p, ok := prev[id]; ok {
+			updates = append(updates, &models.JobStatsUpdate{
+				JobID:  alloc.JobID,
+				Sample: models.NewJobStatsSample(p, cur[id]),
+			})
+		}
+	}
+	return updates, cur
+}
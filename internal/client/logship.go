@@ -0,0 +1,294 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+)
+
+const (
+	shippedLogEvent   = "log"
+	shippedErrorEvent = "error"
+
+	logShippingHTTPTimeout = 10 * time.Second
+	// time for the entries in the buffer to be sent on shutdown
+	logShippingCloseTimeout = 5 * time.Second
+)
+
+// shippedLog is an entry logged within a job, as sent to the destinations.
+type shippedLog struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Event   string            `json:"event"`
+	Node    string            `json:"node"`
+	Job     string            `json:"job"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+
+	level ulog.Level
+}
+
+type logSink interface {
+	name() string
+	ship(logs []*shippedLog) error
+	close()
+}
+
+// logShipper is a hook of the agent logger. The entries of the jobs are
+// buffered and sent in batches by a goroutine, so the tasks are never
+// blocked by a slow destination. Entries are dropped if the buffer is full.
+type logShipper struct {
+	cfg    *config.LogShippingConfig
+	node   string
+	logger *ulog.Logger
+	sinks  []logSink
+
+	entries chan *shippedLog
+	dropped uint64
+	closed  int32
+
+	closeOnce sync.Once
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+}
+
+func newLogShipper(cfg *config.LogShippingConfig, node string, logger *ulog.Logger) *logShipper {
+	cfg = cfg.SetDefault()
+	s := &logShipper{
+		cfg:     cfg,
+		node:    node,
+		logger:  logger,
+		entries: make(chan *shippedLog, cfg.BufferSize),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	if cfg.SyslogAddress != "" {
+		s.sinks = append(s.sinks, newSyslogLogSink(cfg.SyslogAddress, cfg.SyslogTag))
+	}
+	if len(cfg.KafkaBrokers) > 0 {
+		s.sinks = append(s.sinks, &kafkaLogSink{brokers: cfg.KafkaBrokers, topic: cfg.KafkaTopic})
+	}
+	if cfg.HTTPURL != "" {
+		s.sinks = append(s.sinks, &httpLogSink{
+			url:     cfg.HTTPURL,
+			headers: cfg.HTTPHeaders,
+			client:  &http.Client{Timeout: logShippingHTTPTimeout},
+		})
+	}
+	go s.run()
+	return s
+}
+
+func (s *logShipper) Levels() []ulog.Level {
+	max := s.cfg.ShippedLevel()
+	if s.cfg.EventsOnly {
+		max = ulog.ErrorLevel
+	}
+	var levels []ulog.Level
+	for _, level := range ulog.AllLevels {
+		if level <= max {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// Fire is called with the lock of the logger held, and must not log.
+func (s *logShipper) Fire(entry *ulog.Entry) error {
+	job, ok := entry.Data["job"].(string)
+	if !ok || atomic.LoadInt32(&s.closed) == 1 {
+		return nil
+	}
+	l := &shippedLog{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Event:   shippedLogEvent,
+		Node:    s.node,
+		Job:     job,
+		Message: entry.Message,
+		level:   entry.Level,
+	}
+	if entry.Level <= ulog.ErrorLevel {
+		l.Event = shippedErrorEvent
+	}
+	for k, v := range entry.Data {
+		if k == "job" {
+			continue
+		}
+		if l.Fields == nil {
+			l.Fields = make(map[string]string)
+		}
+		l.Fields[k] = fmt.Sprint(v)
+	}
+
+	select {
+	case s.entries <- l:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return nil
+}
+
+func (s *logShipper) run() {
+	defer close(s.doneCh)
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*shippedLog, 0, s.cfg.BatchSize)
+	flush := func() {
+		if dropped := atomic.SwapUint64(&s.dropped, 0); dropped > 0 {
+			s.logger.Warnf("agent: Log shipping dropped %d entries, the destinations are behind", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		for _, sink := range s.sinks {
+			if err := sink.ship(batch); err != nil {
+				s.logger.Warnf("agent: Failed to ship %d log entries to %s: %v", len(batch), sink.name(), err)
+			}
+		}
+		batch = make([]*shippedLog, 0, s.cfg.BatchSize)
+	}
+
+	for {
+		select {
+		case l := <-s.entries:
+			batch = append(batch, l)
+			if len(batch) >= s.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.stopCh:
+			for {
+				select {
+				case l := <-s.entries:
+					batch = append(batch, l)
+					if len(batch) >= s.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					for _, sink := range s.sinks {
+						sink.close()
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close sends the buffered entries and closes the destinations.
+func (s *logShipper) Close() {
+	s.closeOnce.Do(func() {
+		atomic.StoreInt32(&s.closed, 1)
+		close(s.stopCh)
+		select {
+		case <-s.doneCh:
+		case <-time.After(logShippingCloseTimeout):
+			s.logger.Warnf("agent: Timeout sending the log entries on shutdown")
+		}
+	})
+}
+
+// httpLogSink posts the entries to a collector as a JSON array.
+type httpLogSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (h *httpLogSink) name() string {
+	return h.url
+}
+
+func (h *httpLogSink) ship(logs []*shippedLog) error {
+	body, err := json.Marshal(logs)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (h *httpLogSink) close() {}
+
+// kafkaLogSink produces an entry per message, keyed by the job to keep the
+// entries of a job in order. The producer is connected on first use and
+// again after a failure, as the brokers may be down when the agent starts.
+type kafkaLogSink struct {
+	brokers  []string
+	topic    string
+	producer sarama.SyncProducer
+}
+
+func (k *kafkaLogSink) name() string {
+	return fmt.Sprintf("kafka topic %v", k.topic)
+}
+
+func (k *kafkaLogSink) ship(logs []*shippedLog) error {
+	if k.producer == nil {
+		cfg := sarama.NewConfig()
+		cfg.Producer.Return.Successes = true
+		producer, err := sarama.NewSyncProducer(k.brokers, cfg)
+		if err != nil {
+			return err
+		}
+		k.producer = producer
+	}
+	msgs := make([]*sarama.ProducerMessage, 0, len(logs))
+	for _, l := range logs {
+		value, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: k.topic,
+			Key:   sarama.StringEncoder(l.Job),
+			Value: sarama.ByteEncoder(value),
+		})
+	}
+	if err := k.producer.SendMessages(msgs); err != nil {
+		k.close()
+		return err
+	}
+	return nil
+}
+
+func (k *kafkaLogSink) close() {
+	if k.producer != nil {
+		k.producer.Close()
+		k.producer = nil
+	}
+}
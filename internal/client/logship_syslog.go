@@ -0,0 +1,85 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"log/syslog"
+
+	"github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+)
+
+// syslogLogSink writes an entry per syslog message, as JSON, with the
+// severity of its level.
+type syslogLogSink struct {
+	address string
+	tag     string
+	writer  *syslog.Writer
+}
+
+func newSyslogLogSink(address, tag string) logSink {
+	return &syslogLogSink{address: address, tag: tag}
+}
+
+func (s *syslogLogSink) name() string {
+	return "syslog " + s.address
+}
+
+func (s *syslogLogSink) dial() (err error) {
+	if s.address == "local" {
+		s.writer, err = syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, s.tag)
+		return err
+	}
+	network, raddr, err := config.ParseSyslogAddress(s.address)
+	if err != nil {
+		return err
+	}
+	s.writer, err = syslog.Dial(network, raddr, syslog.LOG_DAEMON|syslog.LOG_INFO, s.tag)
+	return err
+}
+
+func (s *syslogLogSink) ship(logs []*shippedLog) error {
+	if s.writer == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+	for _, l := range logs {
+		msg, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		switch l.level {
+		case ulog.PanicLevel, ulog.FatalLevel:
+			err = s.writer.Crit(string(msg))
+		case ulog.ErrorLevel:
+			err = s.writer.Err(string(msg))
+		case ulog.WarnLevel:
+			err = s.writer.Warning(string(msg))
+		case ulog.DebugLevel:
+			err = s.writer.Debug(string(msg))
+		default:
+			err = s.writer.Info(string(msg))
+		}
+		if err != nil {
+			s.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogLogSink) close() {
+	if s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+}
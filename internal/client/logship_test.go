@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestLogShipperHTTP(t *testing.T) {
+	var lock sync.Mutex
+	var shipped []*shippedLog
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var logs []*shippedLog
+		if err := json.NewDecoder(r.Body).Decode(&logs); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		lock.Lock()
+		shipped = append(shipped, logs...)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	for _, eventsOnly := range []bool{false, true} {
+		shipped = nil
+		logger := ulog.New(ioutil.Discard, ulog.DebugLevel)
+		s := newLogShipper(&config.LogShippingConfig{
+			HTTPURL:     ts.URL,
+			HTTPHeaders: map[string]string{"X-Token": "secret"},
+			EventsOnly:  eventsOnly,
+		}, "node1", logger)
+		logger.AddHook(s)
+
+		entry := ulog.NewEntry(logger).WithFields(ulog.Fields{"job": "job1", "task": "Src"})
+		logger.Printf("agent: not within a job")
+		entry.Debugf("under the shipped level")
+		entry.Printf("copying")
+		entry.Errorf("mysql: connection lost")
+		s.Close()
+		// entries after shutdown are not shipped
+		entry.Errorf("after close")
+
+		want := []string{"copying", "mysql: connection lost"}
+		if eventsOnly {
+			want = want[1:]
+		}
+		if len(shipped) != len(want) {
+			t.Fatalf("eventsOnly %v: shipped %d entries, want %d", eventsOnly, len(shipped), len(want))
+		}
+		for i, l := range shipped {
+			if l.Message != want[i] || l.Job != "job1" || l.Node != "node1" || l.Fields["task"] != "Src" {
+				t.Errorf("eventsOnly %v: shipped %+v", eventsOnly, l)
+			}
+		}
+		if last := shipped[len(shipped)-1]; last.Event != shippedErrorEvent || last.Level != "ERR" {
+			t.Errorf("error event = %+v", last)
+		}
+		if !eventsOnly && shipped[0].Event != shippedLogEvent {
+			t.Errorf("log event = %+v", shipped[0])
+		}
+	}
+}
+
+func TestLogShippingConfigValidate(t *testing.T) {
+	cases := []struct {
+		cfg config.LogShippingConfig
+		ok  bool
+	}{
+		{config.LogShippingConfig{}, true},
+		{config.LogShippingConfig{SyslogAddress: "udp://127.0.0.1:514"}, true},
+		{config.LogShippingConfig{SyslogAddress: "local"}, true},
+		{config.LogShippingConfig{SyslogAddress: "unix:///dev/log"}, true},
+		{config.LogShippingConfig{SyslogAddress: "127.0.0.1:514"}, false},
+		{config.LogShippingConfig{KafkaBrokers: []string{"127.0.0.1:9092"}}, false},
+		{config.LogShippingConfig{KafkaBrokers: []string{"127.0.0.1:9092"}, KafkaTopic: "logs"}, true},
+		{config.LogShippingConfig{HTTPURL: "collector:8080"}, false},
+		{config.LogShippingConfig{HTTPURL: "http://collector:8080", Level: "trace"}, false},
+	}
+	for _, c := range cases {
+		if err := c.cfg.Validate(); (err == nil) != c.ok {
+			t.Errorf("%+v: err = %v", c.cfg, err)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import "fmt"
+
+// syslog is not available on Windows.
+type syslogLogSink struct {
+	address string
+}
+
+func newSyslogLogSink(address, tag string) logSink {
+	return &syslogLogSink{address: address}
+}
+
+func (s *syslogLogSink) name() string {
+	return "syslog " + s.address
+}
+
+func (s *syslogLogSink) ship(logs []*shippedLog) error {
+	return fmt.Errorf("syslog is not supported on windows")
+}
+
+func (s *syslogLogSink) close() {}
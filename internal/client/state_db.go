@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// stateDBFile is the name of the database in the state dir
+	stateDBFile = "state.db"
+
+	// stateDBOpenTimeout is how long to wait for the lock of the database,
+	// held by another agent with the same state dir
+	stateDBOpenTimeout = 5 * time.Second
+)
+
+var (
+	// allocationsBucket has a bucket per allocation, with the state of the
+	// alloc runner under allocKey and of each task runner under taskKey.
+	allocationsBucket = []byte("allocations")
+	allocKey          = []byte("alloc")
+	taskKeyPrefix     = "task-"
+)
+
+func taskKey(task string) []byte {
+	return []byte(taskKeyPrefix + task)
+}
+
+// stateDB keeps the state of the alloc and task runners under the state dir,
+// for the agent to resume its allocations once restarted.
+type stateDB struct {
+	db *bolt.DB
+}
+
+// savedAlloc is the state of an allocation read from the database.
+type savedAlloc struct {
+	alloc *allocatorState
+	tasks map[string]*workerState
+}
+
+func openStateDB(dir string) (*stateDB, error) {
+	path := filepath.Join(dir, stateDBFile)
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: stateDBOpenTimeout})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("state db %s is in use by another agent", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open state db %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(allocationsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize state db %s: %v", path, err)
+	}
+	return &stateDB{db: db}, nil
+}
+
+func (s *stateDB) put(allocID string, key []byte, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(allocationsBucket).CreateBucketIfNotExists([]byte(allocID))
+		if err != nil {
+			return err
+		}
+		return b.Put(key, buf)
+	})
+}
+
+// PutAlloc saves the state of an alloc runner.
+func (s *stateDB) PutAlloc(allocID string, state *allocatorState) error {
+	return s.put(allocID, allocKey, state)
+}
+
+// PutTask saves the state of a task runner of an allocation.
+func (s *stateDB) PutTask(allocID, task string, state *workerState) error {
+	return s.put(allocID, taskKey(task), state)
+}
+
+// DeleteAlloc forgets an allocation and its tasks.
+func (s *stateDB) DeleteAlloc(allocID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(allocationsBucket).DeleteBucket([]byte(allocID))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// Allocs returns the saved allocations by ID. An allocation whose alloc
+// runner state was not saved has a nil alloc.
+func (s *stateDB) Allocs() (map[string]*savedAlloc, error) {
+	allocs := make(map[string]*savedAlloc)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(allocationsBucket).ForEach(func(id, v []byte) error {
+			b := tx.Bucket(allocationsBucket).Bucket(id)
+			if b == nil {
+				return nil
+			}
+			saved := &savedAlloc{tasks: make(map[string]*workerState)}
+			err := b.ForEach(func(k, v []byte) error {
+				switch key := string(k); {
+				case key == string(allocKey):
+					saved.alloc = new(allocatorState)
+					return json.Unmarshal(v, saved.alloc)
+				case strings.HasPrefix(key, taskKeyPrefix):
+					state := new(workerState)
+					if err := json.Unmarshal(v, state); err != nil {
+						return err
+					}
+					saved.tasks[strings.TrimPrefix(key, taskKeyPrefix)] = state
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to decode state of alloc %s: %v", id, err)
+			}
+			allocs[string(id)] = saved
+			return nil
+		})
+	})
+	return allocs, err
+}
+
+func (s *stateDB) Close() error {
+	return s.db.Close()
+}
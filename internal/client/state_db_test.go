@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func testStateDB(t *testing.T) (*stateDB, func()) {
+	dir, err := ioutil.TempDir("", "dtle-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openStateDB(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStateDB(t *testing.T) {
+	db, cleanup := testStateDB(t)
+	defer cleanup()
+
+	alloc := &models.Allocation{ID: models.GenerateUUID(), JobID: "job1", Task: models.TaskTypeSrc}
+	if err := db.PutAlloc(alloc.ID, &allocatorState{Alloc: alloc, AllocClientStatus: models.AllocClientStatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	task := &models.Task{Type: models.TaskTypeSrc, Config: map[string]interface{}{"Gtid": "uuid:1-10"}}
+	if err := db.PutTask(alloc.ID, task.Type, &workerState{Task: task}); err != nil {
+		t.Fatal(err)
+	}
+	// a task saved before its allocation
+	if err := db.PutTask("other", task.Type, &workerState{Task: task}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := db.Allocs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 || saved["other"].alloc != nil {
+		t.Fatalf("saved = %v", saved)
+	}
+	s := saved[alloc.ID]
+	if s.alloc.Alloc.JobID != "job1" || s.alloc.AllocClientStatus != models.AllocClientStatusRunning {
+		t.Errorf("alloc = %+v", s.alloc)
+	}
+	if ts := s.tasks[models.TaskTypeSrc]; ts == nil || ts.Task.Config["Gtid"] != "uuid:1-10" {
+		t.Errorf("tasks = %v", s.tasks)
+	}
+
+	for _, id := range []string{alloc.ID, alloc.ID, "other"} {
+		if err := db.DeleteAlloc(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if saved, err = db.Allocs(); err != nil || len(saved) != 0 {
+		t.Errorf("saved after delete = %v %v", saved, err)
+	}
+}
+
+func TestClient_restoreState(t *testing.T) {
+	db, cleanup := testStateDB(t)
+	defer cleanup()
+
+	job := &models.Job{ID: "job1", Tasks: []*models.Task{
+		{Type: models.TaskTypeSrc, Driver: "MySQL", Config: map[string]interface{}{}, ConfigLock: &sync.RWMutex{}},
+	}}
+	stopped := &models.Allocation{ID: models.GenerateUUID(), JobID: job.ID, Job: job, Task: models.TaskTypeSrc,
+		DesiredStatus: models.AllocDesiredStatusStop}
+	checkpoint := &models.Task{Type: models.TaskTypeSrc, Driver: "MySQL", Config: map[string]interface{}{"Gtid": "uuid:1-10"}}
+	states := map[string]*models.TaskState{models.TaskTypeSrc: {State: models.TaskStateDead}}
+	if err := db.PutAlloc(stopped.ID, &allocatorState{Alloc: stopped, TaskStates: states}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutTask(stopped.ID, models.TaskTypeSrc, &workerState{Task: checkpoint}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutTask("incomplete", models.TaskTypeSrc, &workerState{Task: checkpoint}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{
+		configCopy:   &config.ClientConfig{},
+		logger:       ulog.New(ioutil.Discard, ulog.ErrorLevel),
+		allocs:       make(map[string]*Allocator),
+		allocUpdates: make(chan *models.Allocation, 64),
+		stateDB:      db,
+	}
+	if err := c.restoreState(); err != nil {
+		t.Fatal(err)
+	}
+	ar, ok := c.getAllocRunners()[stopped.ID]
+	if !ok || len(c.allocs) != 1 {
+		t.Fatalf("allocs = %v", c.allocs)
+	}
+	if ar.restoredTask == nil || ar.restoredTask.Config["Gtid"] != "uuid:1-10" {
+		t.Errorf("restored task = %+v", ar.restoredTask)
+	}
+	if ar.Alloc().TaskStates[models.TaskTypeSrc].State != models.TaskStateDead {
+		t.Errorf("task states = %v", ar.Alloc().TaskStates)
+	}
+
+	// the stopped allocation is not run, and its state is dropped once destroyed
+	ar.Destroy()
+	select {
+	case <-ar.WaitCh():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the alloc runner did not terminate")
+	}
+	if saved, err := db.Allocs(); err != nil || len(saved) != 0 {
+		t.Errorf("saved = %v %v", saved, err)
+	}
+}
@@ -105,14 +105,14 @@ func (r *RestartTracker) GetState() (string, time.Duration) {
 		return models.TaskRestarting, 0
 	}
 
-	if r.waitRes != nil && !r.waitRes.ShouldRestart() {
-		return models.TaskNotRestarting, 0
-	}
-
 	if r.waitRes != nil && r.waitRes.Successful() {
 		return models.TaskTerminated, 0
 	}
 
+	if r.waitRes != nil && !r.waitRes.ShouldRestart() {
+		return models.TaskNotRestarting, 0
+	}
+
 	r.count++
 
 	// Check if we have entered a new interval.
@@ -19,6 +19,7 @@ import (
 
 	"github.com/armon/go-metrics"
 
+	"github.com/actiontech/dtle/internal/chaos"
 	"github.com/actiontech/dtle/internal/client/driver"
 	"github.com/actiontech/dtle/internal/config"
 	log "github.com/actiontech/dtle/internal/logger"
@@ -56,6 +57,10 @@ type Worker struct {
 
 	task *models.Task
 
+	// taskDir is the working directory of the task, set by the alloc runner
+	// before running it
+	taskDir string
+
 	handle     driver.DriverHandle
 	handleLock sync.Mutex
 
@@ -89,7 +94,7 @@ type Worker struct {
 	persistLock sync.Mutex
 }
 
-// taskRunnerState is used to snapshot the store of the task runner
+// workerState is used to snapshot the store of the task runner
 type workerState struct {
 	Version         string
 	Task            *models.Task
@@ -162,7 +167,8 @@ func (r *Worker) SaveState() error {
 	defer r.persistLock.Unlock()
 
 	r.handleLock.Lock()
-	if r.handle != nil {
+	// a step has no checkpoint to report
+	if r.handle != nil && !models.IsStepTask(r.task.Type) {
 		id := &config.DriverCtx{}
 		handleID := r.handle.ID()
 		if err := json.Unmarshal([]byte(handleID), id); err != nil {
@@ -170,17 +176,18 @@ func (r *Worker) SaveState() error {
 				handleID, err)
 		}
 		if id.DriverConfig.Gtid != "" {
-			if r.task.Type == models.TaskTypeDest {
+			if r.task.Type == models.TaskTypeDest || r.task.Type == models.TaskTypeDestStandby {
 				r.workUpdates <- &models.TaskUpdate{
 					JobID:    r.alloc.JobID,
-					Gtid:     id.DriverConfig.Gtid,
+					Gtid:     chaos.Checkpoint(r.alloc.JobID, id.DriverConfig.Gtid),
 					NatsAddr: id.DriverConfig.NatsAddr,
 				}
 			}
 		} else {
 			r.workUpdates <- &models.TaskUpdate{
-				JobID:    r.alloc.JobID,
-				NatsAddr: id.DriverConfig.NatsAddr,
+				JobID:        r.alloc.JobID,
+				NatsAddr:     id.DriverConfig.NatsAddr,
+				CopyProgress: id.DriverConfig.CopyProgress,
 			}
 		}
 		r.logger.Debugf("Worker.SaveState: lock: %p, %p", r.task, r.task.ConfigLock)
@@ -188,6 +195,12 @@ func (r *Worker) SaveState() error {
 		r.logger.Debugf("Worker.SaveState: after lock: %p", r.task)
 		r.task.Config["Gtid"] = id.DriverConfig.Gtid
 		r.task.Config["NatsAddr"] = id.DriverConfig.NatsAddr
+		if id.DriverConfig.Gtid != "" {
+			delete(r.task.Config, "CopyProgress")
+		} else if id.DriverConfig.CopyProgress != nil {
+			// a restarted applier resumes the copy from there
+			r.task.Config["CopyProgress"] = id.DriverConfig.CopyProgress
+		}
 		r.task.ConfigLock.Unlock()
 		r.logger.Debugf("Worker.SaveState: after unlock: %p", r.task)
 	}
@@ -195,6 +208,25 @@ func (r *Worker) SaveState() error {
 	return nil
 }
 
+// state returns the state of the task runner to be saved, with the task
+// config holding the checkpoint set by SaveState.
+func (r *Worker) state() *workerState {
+	r.persistLock.Lock()
+	defer r.persistLock.Unlock()
+
+	state := &workerState{
+		Version:         r.config.Version,
+		Task:            r.task.Copy(),
+		PayloadRendered: r.payloadRendered,
+	}
+	r.handleLock.Lock()
+	if r.handle != nil {
+		state.HandleID = r.handle.ID()
+	}
+	r.handleLock.Unlock()
+	return state
+}
+
 // DestroyState is used to cleanup after ourselves
 func (r *Worker) DestroyState() error {
 	r.persistLock.Lock()
@@ -267,6 +299,7 @@ func (r *Worker) run() {
 	// Predeclare things so we can jump to the RESTART
 	var stopCollection chan struct{}
 	var handleWaitCh chan *models.WaitResult
+	var taskEventCh <-chan *models.TaskEvent
 
 	// If we already have a handle, populate the stopCollection and handleWaitCh
 	// to fix the invariant that it exists.
@@ -278,6 +311,7 @@ func (r *Worker) run() {
 		stopCollection = make(chan struct{})
 		go r.collectResourceUsageStats(stopCollection)
 		handleWaitCh = r.handle.WaitCh()
+		taskEventCh = taskEventsOf(r.handle)
 	}
 
 	for {
@@ -324,8 +358,12 @@ func (r *Worker) run() {
 					}
 
 					handleWaitCh = r.handle.WaitCh()
+					taskEventCh = taskEventsOf(r.handle)
 				}
 
+			case event := <-taskEventCh:
+				r.setState(models.TaskStateRunning, event)
+
 			case waitRes := <-handleWaitCh:
 				if waitRes == nil {
 					panic("nil wait")
@@ -343,7 +381,7 @@ func (r *Worker) run() {
 				r.logger.Debugf("setState 4")
 				r.setState("", r.waitErrorToEvent(waitRes))
 				if !waitRes.Successful() {
-					r.logger.Errorf("agent: Task %q for alloc %q failed: %v", r.task.Type, r.alloc.ID, waitRes)
+					r.logger.WithField("job", r.alloc.JobID).Errorf("agent: Task %q for alloc %q failed: %v", r.task.Type, r.alloc.ID, waitRes)
 				} else {
 					r.logger.Printf("agent: Task %q for alloc %q completed successfully", r.task.Type, r.alloc.ID)
 				}
@@ -527,6 +565,9 @@ func (r *Worker) startTask() error {
 
 	// Run prestart
 	ctx := driver.NewExecContext(r.alloc.Job.ID, r.alloc.Job.Type, r.config.MaxPayload)
+	ctx.TaskDir = r.taskDir
+	ctx.Job = r.alloc.Job
+	ctx.TransitKeys = r.alloc.TransitKeys
 
 	// Start the job
 	handle, err := drv.Start(ctx, r.task)
@@ -603,6 +644,62 @@ func (r *Worker) LatestTaskStats() *models.TaskStatistics {
 	return r.taskStats
 }
 
+// Events returns the changes captured by the task, if its driver publishes them.
+func (r *Worker) Events(index uint64, max int, wait time.Duration) ([]*models.ChangeEvent, uint64, error) {
+	r.handleLock.Lock()
+	handle := r.handle
+	r.handleLock.Unlock()
+	if handle == nil {
+		return nil, 0, fmt.Errorf("task %q is not running", r.task.Type)
+	}
+	eh, ok := handle.(driver.EventsHandle)
+	if !ok {
+		return nil, 0, fmt.Errorf("task %q does not capture events", r.task.Type)
+	}
+	return eh.Events(index, max, wait)
+}
+
+// taskEventsOf returns the channel of the events the driver of handle emits
+// while running, nil if it emits none.
+func taskEventsOf(handle driver.DriverHandle) <-chan *models.TaskEvent {
+	if th, ok := handle.(driver.TaskEventsHandle); ok {
+		return th.TaskEvents()
+	}
+	return nil
+}
+
+// Rescan makes the task pick up the source tables created since it started,
+// if its driver supports it.
+func (r *Worker) Rescan() ([]string, error) {
+	r.handleLock.Lock()
+	handle := r.handle
+	r.handleLock.Unlock()
+	if handle == nil {
+		return nil, fmt.Errorf("task %q is not running", r.task.Type)
+	}
+	rh, ok := handle.(driver.RescanHandle)
+	if !ok {
+		return nil, fmt.Errorf("task %q cannot rescan the source schemas", r.task.Type)
+	}
+	return rh.Rescan()
+}
+
+// Health returns the health of the connections of the task, or none if its
+// driver does not report them.
+func (r *Worker) Health() ([]*models.ConnHealth, error) {
+	r.handleLock.Lock()
+	handle := r.handle
+	r.handleLock.Unlock()
+	if handle == nil {
+		return nil, fmt.Errorf("task %q is not running", r.task.Type)
+	}
+	hh, ok := handle.(driver.HealthHandle)
+	if !ok {
+		return nil, nil
+	}
+	return hh.Health(), nil
+}
+
 // handleDestroy kills the task handle. In the case that killing fails,
 // handleDestroy will retry with an exponential backoff and will give up at a
 // given limit. It returns whether the task was destroyed and the error
@@ -639,6 +736,85 @@ func (r *Worker) Restart(source, reason string) {
 	}
 }
 
+// WarmRestart applies the WarmRestartConfig of next to the task, in place if
+// its driver supports it, or else by restarting it.
+func (r *Worker) WarmRestart(next *models.Task) {
+	r.task.ConfigLock.Lock()
+	r.task.SetWarmRestartConfig(next)
+	config := make(map[string]interface{}, len(r.task.Config))
+	for k, v := range r.task.Config {
+		config[k] = v
+	}
+	r.task.ConfigLock.Unlock()
+
+	r.handleLock.Lock()
+	handle := r.handle
+	r.handleLock.Unlock()
+
+	reason := "the driver cannot restart warm"
+	if wh, ok := handle.(driver.WarmRestartHandle); ok {
+		err := wh.WarmRestart(config)
+		if err == nil {
+			r.setState(models.TaskStateRunning, models.NewTaskEvent(models.TaskWarmRestarted))
+			return
+		}
+		r.logger.Warnf("agent: Warm restart of task %v for alloc %q failed: %v", r.task.Type, r.alloc.ID, err)
+		reason = err.Error()
+	}
+	if handle != nil {
+		r.Restart("warm restart", reason)
+	}
+}
+
+// Tune applies the TunableConfig of next to the running task. The values are
+// kept in the config of the task, which the task gets when it starts again.
+func (r *Worker) Tune(next *models.Task) {
+	r.task.ConfigLock.Lock()
+	r.task.SetTunables(next.Tunables())
+	config := make(map[string]interface{}, len(r.task.Config))
+	for k, v := range r.task.Config {
+		config[k] = v
+	}
+	r.task.ConfigLock.Unlock()
+
+	r.handleLock.Lock()
+	handle := r.handle
+	r.handleLock.Unlock()
+
+	th, ok := handle.(driver.TunableHandle)
+	if !ok {
+		return
+	}
+	event := models.NewTaskEvent(models.TaskTuned)
+	if err := th.Tune(config); err != nil {
+		r.logger.Warnf("agent: Tuning task %v for alloc %q failed: %v", r.task.Type, r.alloc.ID, err)
+		event.SetDriverError(err)
+	}
+	r.setState(models.TaskStateRunning, event)
+}
+
+// SkipTx arms the running task to skip its next failing transaction. The arm
+// is kept in the config of the task, which the task gets when it starts again.
+func (r *Worker) SkipTx(next *models.Task) {
+	skip, err := next.SkipTx()
+	if err != nil || skip == nil {
+		r.logger.Warnf("agent: Cannot arm task %v for alloc %q to skip a transaction: %v",
+			r.task.Type, r.alloc.ID, err)
+		return
+	}
+	r.task.ConfigLock.Lock()
+	r.task.SetSkipTx(skip)
+	r.task.ConfigLock.Unlock()
+
+	r.handleLock.Lock()
+	handle := r.handle
+	r.handleLock.Unlock()
+
+	if sh, ok := handle.(driver.SkipTxHandle); ok {
+		sh.SkipTx(skip)
+	}
+}
+
 // Kill will kill a task and store the error, no longer restarting the task. If
 // fail is set, the task is marked as having failed.
 func (r *Worker) Kill(source, reason string, fail bool) {
@@ -666,8 +842,17 @@ func (r *Worker) UnblockStart(source string) {
 	close(r.unblockCh)
 }
 
-// Helper function for converting a WaitResult into a TaskTerminated event.
+// Helper function for converting a WaitResult into a TaskTerminated event,
+// or a TaskStepCompleted event for a step which is done.
 func (r *Worker) waitErrorToEvent(res *models.WaitResult) *models.TaskEvent {
+	r.handleLock.Lock()
+	step, ok := r.handle.(driver.StepHandle)
+	r.handleLock.Unlock()
+	if ok && res.Successful() {
+		return models.NewTaskEvent(models.TaskStepCompleted).
+			SetMessage(step.Result()).
+			SetChecksums(step.Checksums())
+	}
 	return models.NewTaskEvent(models.TaskTerminated).
 		SetExitCode(res.ExitCode).
 		SetExitMessage(res.Err)
@@ -701,6 +886,21 @@ func (r *Worker) emitStats(ru *models.TaskStatistics) {
 		metrics.SetGaugeWithLabels([]string{"buffer", "dest_queue_size"}, float32(ru.BufferStat.ApplierTxQueueSize), labels)
 		metrics.SetGaugeWithLabels([]string{"buffer", "send_by_timeout"}, float32(ru.BufferStat.SendByTimeout), labels)
 		metrics.SetGaugeWithLabels([]string{"buffer", "send_by_size_full"}, float32(ru.BufferStat.SendBySizeFull), labels)
+		metrics.SetGaugeWithLabels([]string{"buffer", "dest_spill_bytes"}, float32(ru.BufferStat.ApplierSpillBytes), labels)
+		metrics.SetGaugeWithLabels([]string{"traffic", "extracted_bytes"}, float32(ru.TrafficStat.ExtractedBytes), labels)
+		metrics.SetGaugeWithLabels([]string{"traffic", "wire_bytes"}, float32(ru.TrafficStat.WireBytes), labels)
+		metrics.SetGaugeWithLabels([]string{"traffic", "applied_bytes"}, float32(ru.TrafficStat.AppliedBytes), labels)
+		if ru.TrafficStat.CompressedBytes > 0 {
+			metrics.SetGaugeWithLabels([]string{"traffic", "compression_ratio"},
+				float32(ru.TrafficStat.UncompressedBytes)/float32(ru.TrafficStat.CompressedBytes), labels)
+		}
+		metrics.SetGaugeWithLabels([]string{"traffic", "codec_seconds"}, float32(time.Duration(ru.TrafficStat.CodecNanos).Seconds()), labels)
+		for _, q := range ru.Queues {
+			metrics.SetGaugeWithLabels([]string{"pipeline", q.Name, "depth"}, float32(q.Depth), labels)
+			metrics.SetGaugeWithLabels([]string{"pipeline", q.Name, "full_pct"}, float32(q.FullPct), labels)
+			metrics.SetGaugeWithLabels([]string{"pipeline", q.Name, "empty_pct"}, float32(q.EmptyPct), labels)
+			metrics.SetGaugeWithLabels([]string{"pipeline", q.Name, "dropped"}, float32(q.Dropped), labels)
+		}
 	}
 	if ru.TableStats != nil && r.config.PublishAllocationMetrics {
 		metrics.SetGaugeWithLabels([]string{"table", "insert"}, float32(ru.TableStats.InsertCount), labels)
@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+const defaultAdmissionWebhookTimeout = 10 * time.Second
+
+// AdmissionConfig sets the admission controllers run by the servers on each
+// registered job, before it is committed. They may reject the job, or the
+// webhook may return a changed job.
+type AdmissionConfig struct {
+	// JobNamePattern is a regular expression the ID and name of the jobs
+	// must match, e.g. "^[a-z]+-[a-z0-9-]+$".
+	JobNamePattern string `mapstructure:"job_name_pattern"`
+
+	// ForbidDrop rejects the jobs dropping the tables of the destination,
+	// with DropTableIfExists or a DROP statement in a SchemaMigration.
+	ForbidDrop bool `mapstructure:"forbid_drop"`
+
+	// WebhookURL receives a POST of {"Job": ...} and answers
+	// {"Allowed": bool, "Reason": "...", "Job": ...}, Job being the job to
+	// register in place of the submitted one, if changed.
+	WebhookURL     string            `mapstructure:"webhook_url"`
+	WebhookHeaders map[string]string `mapstructure:"webhook_headers"`
+	WebhookTimeout time.Duration     `mapstructure:"webhook_timeout"`
+
+	// WebhookFailOpen admits the jobs when the webhook cannot be reached
+	// or fails, instead of rejecting them.
+	WebhookFailOpen bool `mapstructure:"webhook_fail_open"`
+}
+
+func (c *AdmissionConfig) SetDefault() *AdmissionConfig {
+	result := *c
+	if result.WebhookTimeout <= 0 {
+		result.WebhookTimeout = defaultAdmissionWebhookTimeout
+	}
+	return &result
+}
+
+func (c *AdmissionConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.JobNamePattern != "" {
+		if _, err := regexp.Compile(c.JobNamePattern); err != nil {
+			return fmt.Errorf("invalid job_name_pattern %q: %v", c.JobNamePattern, err)
+		}
+	}
+	if c.WebhookURL != "" {
+		u, err := url.Parse(c.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid webhook_url %q", c.WebhookURL)
+		}
+	}
+	return nil
+}
+
+func (c *AdmissionConfig) Copy() *AdmissionConfig {
+	if c == nil {
+		return nil
+	}
+	nc := new(AdmissionConfig)
+	*nc = *c
+	if c.WebhookHeaders != nil {
+		nc.WebhookHeaders = make(map[string]string, len(c.WebhookHeaders))
+		for k, v := range c.WebhookHeaders {
+			nc.WebhookHeaders[k] = v
+		}
+	}
+	return nc
+}
+
+// Merge is used to merge two admission configs together
+func (c *AdmissionConfig) Merge(b *AdmissionConfig) *AdmissionConfig {
+	if c == nil {
+		return b.Copy()
+	}
+	result := c.Copy()
+	if b == nil {
+		return result
+	}
+	if b.JobNamePattern != "" {
+		result.JobNamePattern = b.JobNamePattern
+	}
+	if b.ForbidDrop {
+		result.ForbidDrop = true
+	}
+	if b.WebhookURL != "" {
+		result.WebhookURL = b.WebhookURL
+	}
+	for k, v := range b.WebhookHeaders {
+		if result.WebhookHeaders == nil {
+			result.WebhookHeaders = make(map[string]string)
+		}
+		result.WebhookHeaders[k] = v
+	}
+	if b.WebhookTimeout != 0 {
+		result.WebhookTimeout = b.WebhookTimeout
+	}
+	if b.WebhookFailOpen {
+		result.WebhookFailOpen = true
+	}
+	return result
+}
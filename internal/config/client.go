@@ -35,6 +35,70 @@ const (
 	defaultChunkSize  = 2000
 	defaultNumWorkers = 1
 	defaultMsgBytes   = 20 * 1024
+
+	defaultMigrationIdleSeconds = 30
+
+	defaultSpillMemoryMB        = 64
+	defaultWatchBufferSize      = 10000
+	defaultSpillHighWatermarkMB = 1024
+	defaultMaxRowSizeMB         = 64
+	defaultBlobOffloadMinBytes  = 1024 * 1024
+	// stmt-count-limit of TiDB
+	defaultTiDBTxnStmtLimit = 5000
+
+	defaultOrchestratorPollSeconds = 5
+
+	defaultStandbyTakeoverSeconds = 5
+
+	defaultQueryTimeoutSeconds = 60
+
+	defaultMetadataBreakerSeconds = 30
+
+	defaultTxGroupMaxTxs    = 100
+	defaultTxGroupTimeoutMs = 10
+)
+
+const (
+	TxBoundaryPreserve = "preserve"
+	TxBoundaryRegroup  = "regroup"
+)
+
+const (
+	ParallelDependencyCommit = "commit"
+	ParallelDependencyTable  = "table"
+)
+
+// What the extractor does with a DML the source logged as a statement, with
+// binlog_format STATEMENT or MIXED
+const (
+	StatementBinlogError = "error"
+	StatementBinlogApply = "apply"
+)
+
+// What the applier does with the messages it receives while its queue is full
+const (
+	// QueueFullDrop waits for room for a while, then drops the message
+	// unacked for the extractor to resend it
+	QueueFullDrop = "drop"
+	// QueueFullBlock waits for room, the backpressure reaching the extractor
+	QueueFullBlock = "block"
+)
+
+// What the applier does with a batch of transactions which fails
+const (
+	// BatchErrorRollback rolls the batch back
+	BatchErrorRollback = "rollback"
+	// BatchErrorApplyPrefix applies the transactions of the batch before
+	// the one failing
+	BatchErrorApplyPrefix = "apply-prefix"
+)
+
+// The codecs compressing the messages between the Src and Dest tasks
+const (
+	TransportCodecNone   = "none"
+	TransportCodecSnappy = "snappy"
+	TransportCodecLZ4    = "lz4"
+	TransportCodecZstd   = "zstd"
 )
 
 // RPCHandler can be provided to the Client if there is a local server
@@ -52,6 +116,15 @@ type ClientConfig struct {
 	// AllocDir is where we store data for allocations
 	AllocDir string
 
+	// AllocDiskQuotaMB limits the size of the directory of each allocation.
+	// A task exceeding it is killed. 0 is no limit. The DiskQuotaMB of a
+	// task overrides it.
+	AllocDiskQuotaMB int
+
+	// AllocGCRetention is how long the directory of a terminal allocation
+	// is kept, e.g. to investigate a failure
+	AllocGCRetention time.Duration
+
 	// LogOutput is the destination for logs
 	LogOutput io.Writer
 
@@ -102,6 +175,9 @@ type ClientConfig struct {
 	// NoHostUUID disables using the host's UUID and will force generation of a
 	// random UUID.
 	NoHostUUID bool
+
+	// LogShipping ships the logs of the jobs to external systems
+	LogShipping *LogShippingConfig
 }
 
 func (c *ClientConfig) Copy() *ClientConfig {
@@ -110,6 +186,7 @@ func (c *ClientConfig) Copy() *ClientConfig {
 	nc.Node = nc.Node.Copy()
 	nc.Servers = internal.CopySliceString(nc.Servers)
 	nc.ConsulConfig = c.ConsulConfig.Copy()
+	nc.LogShipping = c.LogShipping.Copy()
 	return nc
 }
 
@@ -122,7 +199,13 @@ func (d *DataSource) String() string {
 }
 
 type MySQLDriverConfig struct {
-	DataDir     string
+	// DataDir is the working directory of the task, managed by the agent
+	// under its alloc dir. Relative SpillDir and RecordFile are under it.
+	DataDir string
+	// TransitKeys are the keys of the job encrypting the change events
+	// between the Src and Dest tasks, set by the agent for a job with
+	// EncryptTransit. The first one encrypts.
+	TransitKeys [][]byte
 	MaxFileSize int64
 	//Ref:http://dev.mysql.com/doc/refman/5.7/en/replication-options-slave.html#option_mysqld_replicate-do-table
 	ReplicateDoDb                       []*DataSource
@@ -150,7 +233,9 @@ type MySQLDriverConfig struct {
 
 	Gtid                     string
 	GtidStart                string
-	AutoGtid                 bool // For internal use. Might be changed without notification.
+	AutoGtid                 bool                 // For internal use. Might be changed without notification.
+	CopyProgress             *models.CopyProgress // For internal use. The progress of an interrupted full copy.
+	SkipTx                   *models.SkipTx       // For internal use. The skip of a failing transaction armed.
 	NatsAddr                 string
 	ParallelWorkers          int
 	ConnectionConfig         *umconf.ConnectionConfig
@@ -183,6 +268,243 @@ type MySQLDriverConfig struct {
 
 	SkipPrivilegeCheck  bool
 	SkipIncrementalCopy bool
+
+	// DumpSource is a mydumper directory or a mysqldump file (a local path or
+	// a go-getter URL, e.g. s3::https://...). If set, it is loaded instead of
+	// dumping the source, and the incremental copy starts from its GTID.
+	// A mysqldump file is imported as a whole; ReplicateDoDb only filters mydumper files.
+	DumpSource string
+
+	// VerifyBinlogChecksum makes the extractor verify the CRC32 checksum of
+	// each binlog event, when the source has binlog_checksum=CRC32. A
+	// corrupted event stops the task with its coordinates, rather than being
+	// decoded.
+	VerifyBinlogChecksum bool
+
+	// VerifyRowCount makes the applier compare row counts of the target
+	// tables with the rows sent by the extractor, when the full copy is done.
+	// The tables are counted in a snapshot while the binlog is applied.
+	VerifyRowCount bool
+
+	// Migration is set for jobs of type "migration". Such a job completes by
+	// itself once the full copy is done, MigrationCutoff (RFC3339, optional)
+	// has passed and the applier has had no lag for MigrationIdleSeconds.
+	Migration            bool
+	MigrationCutoff      string
+	MigrationIdleSeconds int
+
+	// IsolationLevel is the transaction isolation level of the applier,
+	// e.g. "READ-COMMITTED". Empty means the default of the target.
+	IsolationLevel string
+	// DisableSqlLogBin sets sql_log_bin=0 on the applier sessions, so the target
+	// does not binlog applied changes. It needs the SUPER privilege.
+	DisableSqlLogBin bool
+	// DisableTriggers sets @dtle_disable_triggers=1 on the applier sessions.
+	// MySQL has no switch for the triggers of a session: the triggers of
+	// the target test the variable, e.g. "IF @dtle_disable_triggers IS NULL
+	// THEN ... END IF", not to fire on the applied rows.
+	DisableTriggers bool
+
+	// TxBoundary is how the applier commits the transactions of the source:
+	//  - "preserve" (default): each one in a target transaction of its own,
+	//    so the target never shows a part of a source transaction, or two of
+	//    them committed together.
+	//  - "regroup": consecutive source transactions are applied in one target
+	//    transaction, of up to TxGroupMaxTxs of them, or of the ones received
+	//    within TxGroupTimeoutMs of the first. A source transaction is never
+	//    split, but several ones become visible at once, and a failure rolls
+	//    back and retries the whole group. DDL is applied by itself. It needs
+	//    the logical clock of a source of MySQL 5.7 or later.
+	// Both keep the order of dependent transactions.
+	TxBoundary       string
+	TxGroupMaxTxs    int
+	TxGroupTimeoutMs int
+
+	// ParallelDependency is what a transaction waits for before the
+	// ParallelWorkers apply it:
+	//  - "commit" (default): the transactions before its last committed on
+	//    the source, i.e. the ones not committed together with it.
+	//  - "table": the transactions before it writing one of its tables, which
+	//    lets the transactions of different tables be applied together even
+	//    if the source committed them one by one. The order of the
+	//    transactions of a table is kept, not the one of tables depending on
+	//    each other, e.g. by foreign keys or triggers on the target.
+	// DDL waits for all the transactions before it either way.
+	ParallelDependency string
+
+	// FillGtidGaps makes the executed GTID set of the target include the
+	// transactions of the source read by the job, without gaps, e.g. for the
+	// target to become a replica of the source later. Each transaction is
+	// committed with its GTID of the source, the ones whose changes are all
+	// filtered out as empty transactions. It needs gtid_mode=ON and the
+	// privilege to set gtid_next on the target, and TxBoundary "preserve".
+	FillGtidGaps bool
+
+	// TransportCodec compresses the messages of the Src task to the Dest
+	// task: "snappy", "lz4" or "none", e.g. for a fast link where the CPU
+	// cost of the compression is not worth it. It is negotiated with the
+	// Dest task when the Src task starts, and is snappy if the Dest task does
+	// not decode it. Empty is snappy as by the versions without negotiation,
+	// which any Dest task decodes. "zstd" is not built in yet.
+	TransportCodec string
+
+	// AllowCycle accepts a job which closes a replication cycle with other jobs,
+	// e.g. for bidirectional replication. Such a cycle is rejected by default.
+	AllowCycle bool
+
+	// AllowOverlappingJobs accepts a job writing target tables which another
+	// job writes too. Such a job is rejected when registered, and its applier
+	// stops on a table another running job writes, unless it sets this or
+	// ConflictPolicies.
+	AllowOverlappingJobs bool
+
+	// ConflictPolicies resolve the conflicts between jobs applying to the same
+	// target (N->1). They are evaluated by the applier, per table.
+	ConflictPolicies []*ConflictPolicy
+
+	// SpillDir enables a buffer between receiving and applying binlog entries,
+	// so the extractor is not stalled by a slow applier. SpillMemoryMB of it is
+	// kept in memory and the rest is written to SpillDir. Once it reaches
+	// SpillHighWatermarkMB, receiving stops until it drains to SpillLowWatermarkMB.
+	SpillDir             string
+	SpillMemoryMB        int
+	SpillHighWatermarkMB int
+	SpillLowWatermarkMB  int
+
+	// QueueFullPolicy is what the applier does with a message it receives
+	// while the queue of the entries to apply is full, without SpillDir:
+	// "drop" (default) waits up to half of the ack timeout of the extractor
+	// then drops it, for the extractor to resend it, and "block" waits for
+	// room.
+	QueueFullPolicy string
+
+	// BatchErrorPolicy is what the applier does when a batch of
+	// transactions, applied in one transaction of the target, fails. The
+	// batch is bisected to find the failing event. "rollback" (default)
+	// applies none of it, and "apply-prefix" applies the transactions
+	// before the failing one.
+	BatchErrorPolicy string
+
+	// MaxRowSizeMB is the size of the largest row the Src task replicates,
+	// counting its values. A row larger than it, e.g. with a huge BLOB,
+	// stops the task with an error naming its table. A message larger than
+	// the max payload of NATS is sent in chunks, reassembled by the Dest
+	// task, which holds it in memory.
+	MaxRowSizeMB int
+
+	// TxSplitRows bounds the memory a huge transaction of the source takes,
+	// e.g. a DELETE of millions of rows: the Src task sends a transaction of
+	// more rows in parts of about TxSplitRows rows, which the Dest task
+	// applies each in a transaction of its own. The target shows a part of
+	// the transaction until its last part is applied. The events applied
+	// are recorded on the target with each part, for a restarted task to
+	// resume after them. 0 (default) sends every transaction whole. It needs
+	// ApproveHeterogeneous, and cannot be used with FillGtidGaps.
+	TxSplitRows int
+
+	// StatementBinlog is what the Src task does with a DML of a replicated
+	// table which the source logged as a statement, e.g. by a session with
+	// binlog_format MIXED: "error" (default) stops the task with the binlog
+	// coordinates of the statement, "apply" sends it for a MySQL target to
+	// execute it as is. Its changes are not rows, and cannot be filtered by
+	// the Where of a table or sent to other targets.
+	StatementBinlog string
+
+	// Strict makes the Src task stop, with the table or the binlog
+	// coordinates at hand, on what it would otherwise skip or replicate
+	// loosely: a binlog event or a query it does not handle, a row not
+	// matching the columns of its table, a column of a type it does not
+	// replicate, a table it cannot replicate, and a foreign key referencing
+	// a table out of the job.
+	Strict bool
+
+	// BlobOffload uploads the big values of the Dest task to S3, and writes
+	// their URL instead, e.g. for an analytics target which does not want
+	// raw binaries.
+	BlobOffload *BlobOffloadConfig
+
+	// RecordFile records the binlog entries received by the applier, for
+	// `dtle replay` to apply them again, e.g. to reproduce a failure. It is
+	// appended to across restarts of the task.
+	RecordFile string
+
+	// CopyConcurrency is the number of tables copied at the same time in the
+	// full copy, each with its own consistent snapshot. Bigger tables go first.
+	CopyConcurrency int
+
+	// ChunkTargetBytes derives the rows per chunk of each table from its
+	// average row length, instead of using ChunkSize for all tables.
+	ChunkTargetBytes int64
+
+	// WatchOnly runs the extractor without an applier. The captured changes
+	// are kept for GET /v1/agent/allocation/<ID>/events, up to the latest
+	// WatchBufferSize ones. The existing rows are not copied.
+	WatchOnly       bool
+	WatchBufferSize int
+
+	// TiDB adapts the applier to a TiDB target. A transaction of more than
+	// TiDBTxnStmtLimit statements is applied as several transactions, which
+	// are not atomic on the target. A transaction failing with an error TiDB
+	// reports as retryable (region unavailable, write conflict, ...) is
+	// retried up to MaxRetries times. The full copy is applied with batch DML.
+	// TiDBSkipUnsupportedVariables skips the session variables of the source
+	// which TiDB rejects, instead of failing the full copy.
+	TiDB                         bool
+	TiDBTxnStmtLimit             int
+	TiDBSkipUnsupportedVariables bool
+
+	// RowsPerSecond limits the rows sent by the extractor, in the full copy
+	// and in the incremental replication. 0 means no limit. It is required
+	// for jobs in a namespace whose quota limits the rows per second.
+	RowsPerSecond int64
+
+	// Orchestrator is asked for the master of the source, which the extractor
+	// connects to instead of ConnectionConfig.Host and Port (BinlogHost and
+	// BinlogPort behind a proxy). When the master changes, planned or not,
+	// the binlog is read from the new master after the last transaction sent,
+	// instead of failing on the old one.
+	Orchestrator *OrchestratorConfig
+
+	// ThrottleWindows limit or pause the copy in time windows, e.g. during
+	// the business hours, under RowsPerSecond if it is set. The windows of the
+	// quota of the namespace are used if the job has none.
+	ThrottleWindows []*models.ThrottleWindow
+
+	// ThrottleReplicas are replicas of the target, as "host:port" reached
+	// with the user of the target. The applier pauses its writes while one
+	// of them lags over MaxLagMillisecondsThrottleThreshold.
+	ThrottleReplicas []string
+	// MaxLoad pauses the writes of the applier while a global status of the
+	// target reaches its threshold, e.g. "Threads_running=50". The key
+	// HistoryListLength is the InnoDB history list length.
+	MaxLoad string
+
+	// StandbyTakeoverSeconds is how long the standby applier of a job with
+	// a DestStandby task waits without a heartbeat of the active applier
+	// before taking over. It is not used by other jobs.
+	StandbyTakeoverSeconds int
+
+	// QueryTimeoutSeconds bounds a query of the tasks on the metadata or the
+	// status of a server, e.g. SHOW MASTER STATUS or the columns of a table,
+	// which would otherwise block the task on a hung server. The copy and the
+	// apply of the rows are not bounded by it.
+	QueryTimeoutSeconds int
+
+	// MetadataBreakerSeconds is how long the extractor stops querying the
+	// metadata of the source once the source is degraded, i.e. its metadata
+	// queries failed 3 times in a row by a timeout or a lost connection. Such
+	// a failed query is retried up to MaxRetries times, with backoff.
+	MetadataBreakerSeconds int
+
+	// LogLevel is the level of the logs of the task, the level of the agent
+	// if empty.
+	LogLevel string
+}
+
+// AllowsOverlappingJobs returns if the job may write the same target tables
+// as other jobs: N->1 jobs resolving their conflicts do.
+func (a *MySQLDriverConfig) AllowsOverlappingJobs() bool {
+	return a.AllowOverlappingJobs || len(a.ConflictPolicies) > 0
 }
 
 func (a *MySQLDriverConfig) SetDefault() *MySQLDriverConfig {
@@ -212,16 +534,102 @@ func (a *MySQLDriverConfig) SetDefault() *MySQLDriverConfig {
 	if result.GroupTimeout == 0 {
 		result.GroupTimeout = 100
 	}
+	if result.MigrationIdleSeconds <= 0 {
+		result.MigrationIdleSeconds = defaultMigrationIdleSeconds
+	}
+	if result.WatchBufferSize <= 0 {
+		result.WatchBufferSize = defaultWatchBufferSize
+	}
+	if result.TiDBTxnStmtLimit <= 0 {
+		result.TiDBTxnStmtLimit = defaultTiDBTxnStmtLimit
+	}
+	if result.CopyConcurrency <= 0 {
+		result.CopyConcurrency = 1
+	}
+	if result.SpillMemoryMB <= 0 {
+		result.SpillMemoryMB = defaultSpillMemoryMB
+	}
+	if result.SpillHighWatermarkMB <= 0 {
+		result.SpillHighWatermarkMB = defaultSpillHighWatermarkMB
+	}
+	if result.SpillLowWatermarkMB <= 0 || result.SpillLowWatermarkMB >= result.SpillHighWatermarkMB {
+		result.SpillLowWatermarkMB = result.SpillHighWatermarkMB * 3 / 4
+	}
+	if result.QueueFullPolicy == "" {
+		result.QueueFullPolicy = QueueFullDrop
+	}
+	if result.BatchErrorPolicy == "" {
+		result.BatchErrorPolicy = BatchErrorRollback
+	}
+	if result.StatementBinlog == "" {
+		result.StatementBinlog = StatementBinlogError
+	}
+	if result.MaxRowSizeMB <= 0 {
+		result.MaxRowSizeMB = defaultMaxRowSizeMB
+	}
 
 	// TODO temporarily (or permanently) disable homogeneous replication, hetero only.
 	result.ApproveHeterogeneous = true
 
+	if result.TxBoundary == "" {
+		result.TxBoundary = TxBoundaryPreserve
+	}
+	if result.ParallelDependency == "" {
+		result.ParallelDependency = ParallelDependencyCommit
+	}
+	if result.TxGroupMaxTxs <= 0 {
+		result.TxGroupMaxTxs = defaultTxGroupMaxTxs
+	}
+	if result.TxGroupTimeoutMs <= 0 {
+		result.TxGroupTimeoutMs = defaultTxGroupTimeoutMs
+	}
+
+	if result.StandbyTakeoverSeconds <= 0 {
+		result.StandbyTakeoverSeconds = defaultStandbyTakeoverSeconds
+	}
+	if result.QueryTimeoutSeconds <= 0 {
+		result.QueryTimeoutSeconds = defaultQueryTimeoutSeconds
+	}
+	if result.MetadataBreakerSeconds <= 0 {
+		result.MetadataBreakerSeconds = defaultMetadataBreakerSeconds
+	}
+
+	if result.BlobOffload != nil && result.BlobOffload.MinBytes <= 0 {
+		blobOffload := *result.BlobOffload
+		blobOffload.MinBytes = defaultBlobOffloadMinBytes
+		result.BlobOffload = &blobOffload
+	}
+
+	if result.Orchestrator != nil && result.Orchestrator.PollIntervalSeconds <= 0 {
+		orchestrator := *result.Orchestrator
+		orchestrator.PollIntervalSeconds = defaultOrchestratorPollSeconds
+		result.Orchestrator = &orchestrator
+	}
+
 	if "" == result.ConnectionConfig.Charset {
 		result.ConnectionConfig.Charset = "utf8mb4"
 	}
 	return &result
 }
 
+// QueryTimeout is the time a metadata or status query may take. It is the
+// default for a config not set by SetDefault.
+func (m *MySQLDriverConfig) QueryTimeout() time.Duration {
+	if m.QueryTimeoutSeconds <= 0 {
+		return defaultQueryTimeoutSeconds * time.Second
+	}
+	return time.Duration(m.QueryTimeoutSeconds) * time.Second
+}
+
+// MetadataBreakerWait is the time the metadata queries wait on a degraded
+// source. It is the default for a config not set by SetDefault.
+func (m *MySQLDriverConfig) MetadataBreakerWait() time.Duration {
+	if m.MetadataBreakerSeconds <= 0 {
+		return defaultMetadataBreakerSeconds * time.Second
+	}
+	return time.Duration(m.MetadataBreakerSeconds) * time.Second
+}
+
 // RequiresBinlogFormatChange is `true` when the original binlog format isn't `ROW`
 func (m *MySQLDriverConfig) RequiresBinlogFormatChange() bool {
 	return m.BinlogFormat != "ROW"
@@ -304,6 +712,82 @@ type DataSource struct {
 	Tables      []*Table
 }
 
+const (
+	ConflictPolicyPriority   = "priority"
+	ConflictPolicyTimestamp  = "timestamp"
+	ConflictPolicyPrecedence = "precedence"
+)
+
+// ConflictPolicy tells the applier which of two sources writing the same
+// primary key wins.
+type ConflictPolicy struct {
+	TableSchema string
+	// empty for all tables of TableSchema
+	TableName string
+	// "priority": the source of the higher Priority keeps the rows it wrote.
+	// "timestamp": the row of the newer TimestampColumn wins.
+	// "precedence": the row whose PrecedenceColumn comes first in PrecedenceValues wins.
+	Policy           string
+	Priority         int
+	TimestampColumn  string
+	PrecedenceColumn string
+	PrecedenceValues []string
+}
+
+func (p *ConflictPolicy) Validate() error {
+	switch p.Policy {
+	case ConflictPolicyPriority:
+	case ConflictPolicyTimestamp:
+		if p.TimestampColumn == "" {
+			return fmt.Errorf("conflict policy for %v.%v: missing TimestampColumn", p.TableSchema, p.TableName)
+		}
+	case ConflictPolicyPrecedence:
+		if p.PrecedenceColumn == "" || len(p.PrecedenceValues) == 0 {
+			return fmt.Errorf("conflict policy for %v.%v: missing PrecedenceColumn or PrecedenceValues",
+				p.TableSchema, p.TableName)
+		}
+	default:
+		return fmt.Errorf("conflict policy for %v.%v: unknown policy %q", p.TableSchema, p.TableName, p.Policy)
+	}
+	if p.TableSchema == "" {
+		return fmt.Errorf("conflict policy: missing TableSchema")
+	}
+	return nil
+}
+
+// BlobOffloadConfig offloads the values of at least MinBytes of the matching
+// columns to s3://Bucket/Prefix/<schema>/<table>/<column>/<sha256>, with the
+// default AWS credential chain. The column gets the URL of the object,
+// s3://Bucket/<key> or URLPrefix/<key>. Objects are named by their content,
+// so that the values in the WHERE of an UPDATE or DELETE are replaced by the
+// same URLs as when they were inserted.
+type BlobOffloadConfig struct {
+	Bucket string
+	Prefix string
+	Region string
+	// Endpoint of an S3-compatible storage, e.g. "http://minio:9000", whose
+	// buckets are addressed by path
+	Endpoint  string
+	URLPrefix string
+	MinBytes  int
+	// Columns are patterns of "schema.table.column", e.g. "db.*.photo". Empty
+	// is all of them.
+	Columns []string
+	// SideTable records each object in dtle.blob_offload, with the table and
+	// the column of the value, its size and its checksum.
+	SideTable bool
+}
+
+// OrchestratorConfig locates the source cluster in Orchestrator.
+type OrchestratorConfig struct {
+	// Url of the Orchestrator HTTP API, e.g. "http://orchestrator:3000"
+	Url string
+	// Cluster is the cluster alias, or an instance of the cluster, as given
+	// to /api/master/<Cluster>
+	Cluster             string
+	PollIntervalSeconds int
+}
+
 type Table struct {
 	TableName   string
 	TableSchema string
@@ -316,6 +800,9 @@ type Table struct {
 	TableType    string
 	TableEngine  string
 	RowsEstimate int64
+	// estimated by information_schema.TABLES
+	AvgRowLength int64
+	DataLength   int64
 
 	Where string // TODO load from job description
 }
@@ -433,5 +920,6 @@ func DefaultClientConfig() *ClientConfig {
 		Region:                  "global",
 		StatsCollectionInterval: 1 * time.Second,
 		LogLevel:                "INFO",
+		AllocGCRetention:        1 * time.Hour,
 	}
 }
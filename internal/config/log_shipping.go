@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/actiontech/dtle/internal"
+	ulog "github.com/actiontech/dtle/internal/logger"
+)
+
+const (
+	defaultLogShippingBatchSize     = 100
+	defaultLogShippingFlushInterval = time.Second
+	defaultLogShippingBufferSize    = 10000
+)
+
+// LogShippingConfig ships the logs of the tasks run by the agent, and an
+// error event for each error of a job, to syslog, Kafka or an HTTP
+// collector. Only the entries logged within a job are shipped.
+type LogShippingConfig struct {
+	// Level is the lowest level shipped. It cannot be lower than the
+	// log_level of the agent. Default "INFO".
+	Level string `mapstructure:"level"`
+
+	// EventsOnly ships the error events only, not the task logs.
+	EventsOnly bool `mapstructure:"events_only"`
+
+	// SyslogAddress is "udp://host:514", "tcp://host:514" or
+	// "unix:///dev/log". "local" is the local syslog daemon.
+	SyslogAddress string `mapstructure:"syslog_address"`
+	SyslogTag     string `mapstructure:"syslog_tag"`
+
+	KafkaBrokers []string `mapstructure:"kafka_brokers"`
+	KafkaTopic   string   `mapstructure:"kafka_topic"`
+
+	// HTTPURL receives a POST of a JSON array of the entries.
+	HTTPURL     string            `mapstructure:"http_url"`
+	HTTPHeaders map[string]string `mapstructure:"http_headers"`
+
+	// BatchSize and FlushInterval bound the entries sent at once and how
+	// long an entry waits to be sent.
+	BatchSize     int           `mapstructure:"batch_size"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+
+	// BufferSize is the number of entries waiting to be sent. Entries are
+	// dropped, not to block the tasks, when the destinations fall behind.
+	BufferSize int `mapstructure:"buffer_size"`
+}
+
+func (c *LogShippingConfig) SetDefault() *LogShippingConfig {
+	result := *c
+	if result.Level == "" {
+		result.Level = "INFO"
+	}
+	if result.SyslogTag == "" {
+		result.SyslogTag = "dtle"
+	}
+	if result.BatchSize <= 0 {
+		result.BatchSize = defaultLogShippingBatchSize
+	}
+	if result.FlushInterval <= 0 {
+		result.FlushInterval = defaultLogShippingFlushInterval
+	}
+	if result.BufferSize <= 0 {
+		result.BufferSize = defaultLogShippingBufferSize
+	}
+	return &result
+}
+
+// Enabled tells if any destination is set.
+func (c *LogShippingConfig) Enabled() bool {
+	return c != nil && (c.SyslogAddress != "" || len(c.KafkaBrokers) > 0 || c.HTTPURL != "")
+}
+
+func (c *LogShippingConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	switch strings.ToUpper(c.Level) {
+	case "", "DEBUG", "INFO", "WARN", "WARNING", "ERROR":
+	default:
+		return fmt.Errorf("invalid level %q", c.Level)
+	}
+	if c.SyslogAddress != "" && c.SyslogAddress != "local" {
+		if _, _, err := ParseSyslogAddress(c.SyslogAddress); err != nil {
+			return err
+		}
+	}
+	if len(c.KafkaBrokers) > 0 && c.KafkaTopic == "" {
+		return fmt.Errorf("kafka_topic must be set with kafka_brokers")
+	}
+	if c.HTTPURL != "" {
+		u, err := url.Parse(c.HTTPURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid http_url %q", c.HTTPURL)
+		}
+	}
+	return nil
+}
+
+// ShippedLevel is the logger level of Level.
+func (c *LogShippingConfig) ShippedLevel() ulog.Level {
+	return ulog.ParseLevel(c.Level)
+}
+
+// ParseSyslogAddress splits "udp://host:514" into the network and address
+// to dial.
+func ParseSyslogAddress(addr string) (string, string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog_address %q: %v", addr, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			break
+		}
+		return u.Scheme, u.Host, nil
+	case "unix", "unixgram":
+		if u.Path == "" {
+			break
+		}
+		return u.Scheme, u.Path, nil
+	}
+	return "", "", fmt.Errorf("invalid syslog_address %q, e.g. udp://host:514", addr)
+}
+
+func (c *LogShippingConfig) Copy() *LogShippingConfig {
+	if c == nil {
+		return nil
+	}
+	nc := new(LogShippingConfig)
+	*nc = *c
+	nc.KafkaBrokers = internal.CopySliceString(c.KafkaBrokers)
+	if c.HTTPHeaders != nil {
+		nc.HTTPHeaders = make(map[string]string, len(c.HTTPHeaders))
+		for k, v := range c.HTTPHeaders {
+			nc.HTTPHeaders[k] = v
+		}
+	}
+	return nc
+}
+
+// Merge is used to merge two log shipping configs together
+func (c *LogShippingConfig) Merge(b *LogShippingConfig) *LogShippingConfig {
+	if c == nil {
+		return b.Copy()
+	}
+	result := c.Copy()
+	if b == nil {
+		return result
+	}
+	if b.Level != "" {
+		result.Level = b.Level
+	}
+	if b.EventsOnly {
+		result.EventsOnly = true
+	}
+	if b.SyslogAddress != "" {
+		result.SyslogAddress = b.SyslogAddress
+	}
+	if b.SyslogTag != "" {
+		result.SyslogTag = b.SyslogTag
+	}
+	if len(b.KafkaBrokers) > 0 {
+		result.KafkaBrokers = internal.CopySliceString(b.KafkaBrokers)
+	}
+	if b.KafkaTopic != "" {
+		result.KafkaTopic = b.KafkaTopic
+	}
+	if b.HTTPURL != "" {
+		result.HTTPURL = b.HTTPURL
+	}
+	for k, v := range b.HTTPHeaders {
+		if result.HTTPHeaders == nil {
+			result.HTTPHeaders = make(map[string]string)
+		}
+		result.HTTPHeaders[k] = v
+	}
+	if b.BatchSize != 0 {
+		result.BatchSize = b.BatchSize
+	}
+	if b.FlushInterval != 0 {
+		result.FlushInterval = b.FlushInterval
+	}
+	if b.BufferSize != 0 {
+		result.BufferSize = b.BufferSize
+	}
+	return result
+}
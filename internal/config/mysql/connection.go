@@ -17,6 +17,42 @@ type ConnectionConfig struct {
 	User     string
 	Password string
 	Charset  string
+
+	// BinlogHost and BinlogPort (default 3306) are the MySQL server behind a
+	// proxy (ProxySQL, HAProxy) at Host and Port. A proxy cannot serve a
+	// binlog dump, and may route the statements of a session to another
+	// server, so the binlog, the consistent snapshot and the server checks
+	// use BinlogHost. The other queries go through the proxy.
+	BinlogHost string
+	BinlogPort int
+	// Proxy tells that Host and Port are a proxy. ProxySQL is detected, but
+	// HAProxy is transparent and has to be told.
+	Proxy bool
+}
+
+// Direct returns the config of the server behind the proxy, or c itself
+// without a BinlogHost.
+func (c *ConnectionConfig) Direct() *ConnectionConfig {
+	if c.BinlogHost == "" {
+		return c
+	}
+	d := *c
+	d.Host, d.Port = c.BinlogHost, c.BinlogPort
+	if d.Port == 0 {
+		d.Port = 3306
+	}
+	d.BinlogHost, d.BinlogPort, d.Proxy = "", 0, false
+	return &d
+}
+
+// SetDirect moves the connections needing the server itself to another
+// server, e.g. to a new master, keeping a proxy for the other queries.
+func (c *ConnectionConfig) SetDirect(host string, port int) {
+	if c.BinlogHost == "" {
+		c.Host, c.Port = host, port
+	} else {
+		c.BinlogHost, c.BinlogPort = host, port
+	}
 }
 
 func (c *ConnectionConfig) GetDBUriByDbName(databaseName string) string {
@@ -24,10 +60,16 @@ func (c *ConnectionConfig) GetDBUriByDbName(databaseName string) string {
 }
 
 func (c *ConnectionConfig) GetDBUri() string {
+	return c.GetDBUriByNet("tcp")
+}
+
+// GetDBUriByNet is GetDBUri connecting with network, e.g. one registered
+// with mysql.RegisterDial.
+func (c *ConnectionConfig) GetDBUriByNet(network string) string {
 	if "" == c.Charset {
 		c.Charset = "utf8mb4"
 	}
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&tls=false&autocommit=true&charset=%v&multiStatements=true&maxAllowedPacket=0", c.User, c.Password, c.Host, c.Port, c.Charset)
+	return fmt.Sprintf("%s:%s@%s(%s:%d)/?timeout=5s&tls=false&autocommit=true&charset=%v&multiStatements=true&maxAllowedPacket=0", c.User, c.Password, network, c.Host, c.Port, c.Charset)
 }
 
 func (c *ConnectionConfig) GetSingletonDBUri() string {
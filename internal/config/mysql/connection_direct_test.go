@@ -0,0 +1,35 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestConnectionConfigDirect(t *testing.T) {
+	c := &ConnectionConfig{Host: "proxysql", Port: 6033, User: "gromit"}
+	test.S(t).ExpectTrue(c.Direct() == c)
+	c.SetDirect("db1", 3307)
+	test.S(t).ExpectEquals(c.Host, "db1")
+	test.S(t).ExpectEquals(c.Port, 3307)
+
+	c = &ConnectionConfig{Host: "proxysql", Port: 6033, User: "gromit", BinlogHost: "db1", Proxy: true}
+	d := c.Direct()
+	test.S(t).ExpectEquals(d.Host, "db1")
+	test.S(t).ExpectEquals(d.Port, 3306)
+	test.S(t).ExpectEquals(d.User, "gromit")
+	test.S(t).ExpectEquals(d.BinlogHost, "")
+	test.S(t).ExpectFalse(d.Proxy)
+
+	// a new master behind the proxy
+	c.SetDirect("db2", 3307)
+	test.S(t).ExpectEquals(c.Host, "proxysql")
+	test.S(t).ExpectEquals(c.Direct().Host, "db2")
+	test.S(t).ExpectEquals(c.Direct().Port, 3307)
+}
@@ -23,3 +23,14 @@ func init() {
 	charsetEncodingMap["gbk"] = simplifiedchinese.GBK
 	charsetEncodingMap["gb2312"] = simplifiedchinese.GB18030
 }
+
+// IsCharsetSupported tells if the values of a charset are converted correctly
+// between source and target.
+func IsCharsetSupported(charset string) bool {
+	switch charset {
+	case "utf8", "utf8mb4", "ascii", "binary":
+		return true
+	}
+	_, ok := charsetEncodingMap[charset]
+	return ok
+}
@@ -76,6 +76,17 @@ func (c *Column) IsPk() bool {
 	return c.Key == "PRI"
 }
 func (c *Column) ConvertArg(arg interface{}) interface{} {
+	if c.Type == JSONColumnType {
+		// JSON is sent as text, for the target to parse it. An empty value
+		// is the JSON null.
+		if fmt.Sprintf("%s", arg) == "" {
+			return "null"
+		}
+		if bs, ok := arg.([]byte); ok {
+			return string(bs)
+		}
+		return arg
+	}
 	if fmt.Sprintf("%s", arg) == "" {
 		return ""
 	}
@@ -318,6 +329,25 @@ func (c *UniqueKey) String() string {
 	return fmt.Sprintf("%s: %s; has nullable: %+v", description, c.Columns.Names(), c.HasNullable)
 }
 
+// JSONDiffOp is how a change of a partial update of JSON changes the value
+type JSONDiffOp byte
+
+const (
+	JSONDiffReplace JSONDiffOp = iota
+	JSONDiffInsert
+	JSONDiffRemove
+)
+
+// JSONDiff is a change of a JSON value, which MySQL 8.0 logs for a partial
+// update instead of the new value, with binlog_row_value_options=PARTIAL_JSON.
+type JSONDiff struct {
+	Op JSONDiffOp
+	// a JSON path, e.g. $.a[1]
+	Path string
+	// the JSON text of the value, none for JSONDiffRemove
+	Value string
+}
+
 type ColumnValues struct {
 	AbstractValues []*interface{}
 	ValuesPointers []*interface{}
@@ -17,6 +17,7 @@ import (
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
 
+	"github.com/actiontech/dtle/internal/models"
 	"github.com/actiontech/dtle/internal/server/scheduler"
 )
 
@@ -37,6 +38,10 @@ type ServerConfig struct {
 	// being present
 	Bootstrap bool
 
+	// DevMode keeps the raft log, the snapshots and the serf snapshot in
+	// memory. Nothing is written to DataDir.
+	DevMode bool
+
 	// BootstrapExpect mode is used to automatically bring up a
 	// collection of Udup servers. This can be used to automatically
 	// bring up a collection of nodes.  All operations on BootstrapExpect
@@ -92,6 +97,23 @@ type ServerConfig struct {
 	// that the workers dequeue for processing.
 	EnabledSchedulers []string
 
+	// SchedulerAlgorithm places the allocations of the jobs which set none,
+	// spread (the default) or binpack.
+	SchedulerAlgorithm string
+
+	// MaxFullCopies is the number of the jobs of all the namespaces doing
+	// their full copy at once. A job starting one more is blocked until
+	// another one ends. 0 is no limit.
+	MaxFullCopies int
+
+	// Admission sets the admission controllers of the registered jobs
+	Admission *AdmissionConfig
+
+	// TransitKeyring has the keys from which the keys encrypting the
+	// messages of the jobs with EncryptTransit are derived, the first one
+	// encrypting. All the servers must have the same keyring.
+	TransitKeyring [][]byte
+
 	// ReconcileInterval controls how often we reconcile the strongly
 	// consistent store with the Serf info. This is used to handle nodes
 	// that are force removed, as well as intermittent unavailability during
@@ -110,6 +132,20 @@ type ServerConfig struct {
 	// complete eventually fails out of the system.
 	EvalDeliveryLimit int
 
+	// EvalDeadline is how long a worker processes an evaluation before it
+	// gives up on it and Nacks it, for an evaluation whose scheduler never
+	// returns not to hold the worker. 0 is no deadline.
+	EvalDeadline time.Duration
+
+	// SlowApplyThreshold is the time to apply a Raft log over which the log
+	// is logged, with a summary of its request. 0 logs none.
+	SlowApplyThreshold time.Duration
+
+	// EvalNamespaceWeights is the share of each namespace in the
+	// evaluations dequeued by the schedulers, for a namespace submitting
+	// many evaluations not to delay the others. The default weight is 1.
+	EvalNamespaceWeights map[string]int
+
 	// MinHeartbeatTTL is the minimum time between heartbeats.
 	// This is used as a floor to prevent excessive updates.
 	MinHeartbeatTTL time.Duration
@@ -157,9 +193,12 @@ func DefaultServerConfig() *ServerConfig {
 		RPCAddr:                DefaultRPCAddr,
 		SerfConfig:             serf.DefaultConfig(),
 		NumSchedulers:          1,
+		SchedulerAlgorithm:     models.SchedulerAlgorithmSpread,
 		ReconcileInterval:      60 * time.Second,
 		EvalNackTimeout:        60 * time.Second,
 		EvalDeliveryLimit:      3,
+		EvalDeadline:           5 * time.Minute,
+		SlowApplyThreshold:     500 * time.Millisecond,
 		MinHeartbeatTTL:        10 * time.Second,
 		MaxHeartbeatsPerSecond: 50.0,
 		HeartbeatGrace:         10 * time.Second,
@@ -169,10 +208,7 @@ func DefaultServerConfig() *ServerConfig {
 	}
 
 	// Enable all known schedulers by default
-	c.EnabledSchedulers = make([]string, 0, len(scheduler.BuiltinSchedulers))
-	for name := range scheduler.BuiltinSchedulers {
-		c.EnabledSchedulers = append(c.EnabledSchedulers, name)
-	}
+	c.EnabledSchedulers = scheduler.Schedulers()
 	// Default the number of schedulers to match the coores
 	c.NumSchedulers = runtime.NumCPU()
 
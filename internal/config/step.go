@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	defaultCutoverTimeoutSeconds = 600
+	defaultChecksumChunkSize     = 1000
+)
+
+// StepConfig is the config of a step task: Verify, Cutover, SchemaMigration
+// or Checksum. A step connects to the MySQL instances set in the Src and
+// Dest tasks of its job.
+type StepConfig struct {
+	// MaxPk and SumColumn also compare the max primary key and the sum of
+	// a column of the tables, in Verify and Cutover
+	MaxPk     bool
+	SumColumn string
+
+	// ReadOnlySource sets the source read_only during the Cutover, and
+	// WritableDest unsets read_only on the destination once in sync
+	ReadOnlySource bool
+	WritableDest   bool
+	// TimeoutSeconds bounds the wait of the Cutover for the destination to
+	// be in sync, 600 by default
+	TimeoutSeconds int
+
+	// Statements are run in order on the destination by SchemaMigration
+	Statements []string
+
+	// ChunkSize is the rows of a chunk compared by the Checksum, 1000 by
+	// default
+	ChunkSize int
+}
+
+func (c *StepConfig) SetDefault() *StepConfig {
+	result := *c
+	if result.TimeoutSeconds <= 0 {
+		result.TimeoutSeconds = defaultCutoverTimeoutSeconds
+	}
+	if result.ChunkSize <= 0 {
+		result.ChunkSize = defaultChecksumChunkSize
+	}
+	return &result
+}
+
+// Validate checks the config of a step task of the type.
+func (c *StepConfig) Validate(taskType string) error {
+	switch taskType {
+	case models.TaskTypeSchemaMigration:
+		if len(c.Statements) == 0 {
+			return fmt.Errorf("SchemaMigration has no Statements")
+		}
+		for i, stmt := range c.Statements {
+			if strings.TrimSpace(stmt) == "" {
+				return fmt.Errorf("statement %d of SchemaMigration is empty", i)
+			}
+		}
+	case models.TaskTypeCutover:
+		if c.TimeoutSeconds < 0 {
+			return fmt.Errorf("TimeoutSeconds of Cutover must not be negative")
+		}
+	}
+	return nil
+}
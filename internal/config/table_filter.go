@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+// TableFilter selects the tables of a job by its ReplicateDoDb (include)
+// and ReplicateIgnoreDb (exclude). It is shared by the full copy, the binlog
+// reader and the verification, so that they select the same tables.
+//
+// A table is selected if it is included and not excluded: an exclusion wins
+// over an inclusion. An empty include list includes all the tables. An entry
+// with an empty TableSchema is for all the schemas, and an entry without
+// Tables for all the tables of its schemas. Names starting with
+// TablePatternPrefix are regular expressions.
+type TableFilter struct {
+	doDb     []*DataSource
+	ignoreDb []*DataSource
+	patterns TablePatterns
+}
+
+// NewTableFilter compiles the patterns of doDb and ignoreDb
+func NewTableFilter(doDb, ignoreDb []*DataSource) (*TableFilter, error) {
+	patterns, err := CompileTablePatterns(doDb, ignoreDb)
+	if err != nil {
+		return nil, err
+	}
+	return &TableFilter{
+		doDb:     doDb,
+		ignoreDb: ignoreDb,
+		patterns: patterns,
+	}, nil
+}
+
+// Patterns returns the compiled patterns of the filter
+func (f *TableFilter) Patterns() TablePatterns {
+	return f.patterns
+}
+
+// MatchTable returns if the table is selected. An empty table name returns
+// if the schema might have selected tables, i.e. it is included and not
+// excluded as a whole.
+func (f *TableFilter) MatchTable(schema, table string) bool {
+	if len(f.doDb) > 0 && !f.matchDataSources(f.doDb, schema, table) {
+		return false
+	}
+	if table == "" {
+		for _, ds := range f.ignoreDb {
+			if len(ds.Tables) == 0 && f.matchSchema(ds, schema) {
+				return false
+			}
+		}
+		return true
+	}
+	return !f.matchDataSources(f.ignoreDb, schema, table)
+}
+
+// FindTable returns the table of the include list for a selected table: the
+// one with the same names, or else the first pattern matching them. It
+// returns nil if the table is not selected or is included by a whole schema.
+func (f *TableFilter) FindTable(schema, table string) *Table {
+	if !f.MatchTable(schema, table) {
+		return nil
+	}
+	return f.patterns.FindTable(f.doDb, schema, table)
+}
+
+// NamedSchemas returns the schemas of the include list which are names, not
+// patterns.
+func (f *TableFilter) NamedSchemas() (schemas []string) {
+	for _, ds := range f.doDb {
+		if ds.TableSchema != "" && !IsTablePattern(ds.TableSchema) {
+			schemas = append(schemas, ds.TableSchema)
+		}
+	}
+	return schemas
+}
+
+func (f *TableFilter) matchSchema(ds *DataSource, schema string) bool {
+	return ds.TableSchema == "" || f.patterns.Match(ds.TableSchema, schema)
+}
+
+func (f *TableFilter) matchDataSources(dss []*DataSource, schema, table string) bool {
+	for _, ds := range dss {
+		if !f.matchSchema(ds, schema) {
+			continue
+		}
+		if len(ds.Tables) == 0 || table == "" {
+			return true
+		}
+		for _, tb := range ds.Tables {
+			if f.patterns.Match(tb.TableName, table) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Overlap returns the tables selected by both filters, as far as the names
+// of their include lists tell: "schema.table", "schema.*" for a schema both
+// include as a whole, or "*" if both include all the tables. Tables only
+// matched by patterns of both filters are not found.
+func (f *TableFilter) Overlap(other *TableFilter) (tables []string) {
+	if len(f.doDb) == 0 && len(other.doDb) == 0 {
+		return []string{"*"}
+	}
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			tables = append(tables, name)
+		}
+	}
+	probe := func(a, b *TableFilter) {
+		for _, ds := range a.doDb {
+			if ds.TableSchema == "" || IsTablePattern(ds.TableSchema) {
+				continue
+			}
+			if len(ds.Tables) == 0 {
+				if a.MatchTable(ds.TableSchema, "") && b.MatchTable(ds.TableSchema, "") &&
+					b.includesSchema(ds.TableSchema) {
+					add(ds.TableSchema + ".*")
+				}
+				continue
+			}
+			for _, tb := range ds.Tables {
+				if IsTablePattern(tb.TableName) {
+					continue
+				}
+				if a.MatchTable(ds.TableSchema, tb.TableName) && b.MatchTable(ds.TableSchema, tb.TableName) {
+					add(ds.TableSchema + "." + tb.TableName)
+				}
+			}
+		}
+	}
+	probe(f, other)
+	probe(other, f)
+	return tables
+}
+
+// includesSchema returns if the include list has all the tables of schema
+func (f *TableFilter) includesSchema(schema string) bool {
+	if len(f.doDb) == 0 {
+		return true
+	}
+	for _, ds := range f.doDb {
+		if len(ds.Tables) == 0 && f.matchSchema(ds, schema) {
+			return true
+		}
+	}
+	return false
+}
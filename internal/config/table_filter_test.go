@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTableFilter_ignoreDb(t *testing.T) {
+	f, err := NewTableFilter(nil, []*DataSource{
+		{TableSchema: "db1"},
+		{TableSchema: "db2", Tables: []*Table{{TableName: "tb1"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		schema, table string
+		want          bool
+	}{
+		{"db1", "", false},
+		{"db1", "tb2", false},
+		{"db2", "", true},
+		{"db2", "tb1", false},
+		{"db2", "tb2", true},
+		{"db3", "tb1", true},
+	}
+	for _, c := range cases {
+		if got := f.MatchTable(c.schema, c.table); got != c.want {
+			t.Errorf("MatchTable(%q, %q) = %v, want %v", c.schema, c.table, got, c.want)
+		}
+	}
+}
+
+func TestTableFilter_excludeWins(t *testing.T) {
+	doDb := []*DataSource{
+		{TableSchema: "~^shard_", Tables: []*Table{{TableName: "~^orders_", Where: "id > 10"}}},
+		{TableSchema: "db1"},
+	}
+	ignoreDb := []*DataSource{
+		{TableSchema: "shard_2"},
+		{TableSchema: "", Tables: []*Table{{TableName: "~_tmp$"}}},
+	}
+	f, err := NewTableFilter(doDb, ignoreDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		schema, table string
+		want          bool
+	}{
+		{"shard_1", "", true},
+		{"shard_1", "orders_1", true},
+		{"shard_1", "users", false},
+		{"shard_1", "orders_1_tmp", false},
+		{"shard_2", "", false},
+		{"shard_2", "orders_1", false},
+		{"db1", "users", true},
+		{"db1", "users_tmp", false},
+		{"db2", "", false},
+		{"db2", "users", false},
+	}
+	for _, c := range cases {
+		if got := f.MatchTable(c.schema, c.table); got != c.want {
+			t.Errorf("MatchTable(%q, %q) = %v, want %v", c.schema, c.table, got, c.want)
+		}
+	}
+
+	if tb := f.FindTable("shard_1", "orders_1"); tb == nil || tb.Where != "id > 10" {
+		t.Errorf("FindTable(shard_1.orders_1) = %v", tb)
+	}
+	if tb := f.FindTable("shard_2", "orders_1"); tb != nil {
+		t.Errorf("FindTable returns an excluded table: %v", tb)
+	}
+	if schemas := f.NamedSchemas(); len(schemas) != 1 || schemas[0] != "db1" {
+		t.Errorf("NamedSchemas() = %v", schemas)
+	}
+}
+
+func TestTableFilter_Overlap(t *testing.T) {
+	newFilter := func(doDb, ignoreDb []*DataSource) *TableFilter {
+		f, err := NewTableFilter(doDb, ignoreDb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	all := newFilter(nil, nil)
+	db1 := newFilter([]*DataSource{{TableSchema: "db1"}}, nil)
+	db1tb1 := newFilter([]*DataSource{{TableSchema: "db1", Tables: []*Table{{TableName: "tb1"}}}}, nil)
+	db1tb2 := newFilter([]*DataSource{{TableSchema: "db1", Tables: []*Table{{TableName: "tb2"}}}}, nil)
+	db1NoTb1 := newFilter([]*DataSource{{TableSchema: "db1"}},
+		[]*DataSource{{TableSchema: "db1", Tables: []*Table{{TableName: "tb1"}}}})
+	db2Pattern := newFilter([]*DataSource{{TableSchema: "~^db2", Tables: []*Table{{TableName: "~^tb"}}}}, nil)
+
+	cases := []struct {
+		name string
+		a, b *TableFilter
+		want string
+	}{
+		{"all", all, all, "*"},
+		{"all and schema", all, db1, "db1.*"},
+		{"schema and schema", db1, db1, "db1.*"},
+		{"schema and table", db1, db1tb1, "db1.tb1"},
+		{"table and schema", db1tb1, db1, "db1.tb1"},
+		{"different tables", db1tb1, db1tb2, ""},
+		{"excluded table", db1NoTb1, db1tb1, ""},
+		{"excluded table and schema", db1NoTb1, db1, "db1.*"},
+		{"patterns", all, db2Pattern, ""},
+	}
+	for _, c := range cases {
+		if got := strings.Join(c.a.Overlap(c.b), ","); got != c.want {
+			t.Errorf("%v: Overlap() = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TablePatternPrefix starts the schema and table names of ReplicateDoDb and
+// ReplicateIgnoreDb which are regular expressions, e.g. "~^orders_[0-9]+$".
+const TablePatternPrefix = "~"
+
+// IsTablePattern returns if a schema or table name is a regular expression
+func IsTablePattern(name string) bool {
+	return strings.HasPrefix(name, TablePatternPrefix)
+}
+
+// TablePatterns are the compiled regular expressions of data sources, by
+// their names with the prefix.
+type TablePatterns map[string]*regexp.Regexp
+
+// CompileTablePatterns compiles the schema and table names of the data
+// sources which are regular expressions.
+func CompileTablePatterns(dss ...[]*DataSource) (TablePatterns, error) {
+	patterns := make(TablePatterns)
+	add := func(name string) error {
+		if !IsTablePattern(name) {
+			return nil
+		}
+		if _, ok := patterns[name]; ok {
+			return nil
+		}
+		re, err := regexp.Compile(strings.TrimPrefix(name, TablePatternPrefix))
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", name, err)
+		}
+		patterns[name] = re
+		return nil
+	}
+	for _, ds := range dss {
+		for _, db := range ds {
+			if err := add(db.TableSchema); err != nil {
+				return nil, err
+			}
+			for _, tb := range db.Tables {
+				if err := add(tb.TableName); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// Match returns if name is matched by nameOrPattern: the same name, or a
+// pattern matching it.
+func (p TablePatterns) Match(nameOrPattern, name string) bool {
+	if re, ok := p[nameOrPattern]; ok {
+		return re.MatchString(name)
+	}
+	return nameOrPattern == name
+}
+
+// FindTable returns the table of dss for schema.table: the one with the same
+// names, or else the first one whose schema and table name match them. It
+// returns nil if no table of dss is for schema.table.
+func (p TablePatterns) FindTable(dss []*DataSource, schema, table string) *Table {
+	var matched *Table
+	for _, ds := range dss {
+		if !p.Match(ds.TableSchema, schema) {
+			continue
+		}
+		for _, tb := range ds.Tables {
+			if !p.Match(tb.TableName, table) {
+				continue
+			}
+			if ds.TableSchema == schema && tb.TableName == table {
+				return tb
+			}
+			if matched == nil {
+				matched = tb
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"testing"
+)
+
+func TestCompileTablePatterns(t *testing.T) {
+	doDb := []*DataSource{
+		{TableSchema: "~^shard_[0-9]+$", Tables: []*Table{
+			{TableName: "~^orders_", Where: "id > 10"},
+			{TableName: "users"},
+		}},
+		{TableSchema: "db1", Tables: []*Table{
+			{TableName: "orders_1", Where: "true"},
+			{TableName: "~^orders_"},
+		}},
+	}
+	p, err := CompileTablePatterns(doDb, []*DataSource{{TableSchema: ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 2 {
+		t.Fatalf("patterns: %v", p)
+	}
+	if !p.Match("~^shard_[0-9]+$", "shard_12") || p.Match("~^shard_[0-9]+$", "shard_x") {
+		t.Errorf("schema pattern does not match")
+	}
+	if !p.Match("users", "users") || p.Match("users", "users2") {
+		t.Errorf("a name matches another one")
+	}
+
+	if tb := p.FindTable(doDb, "shard_1", "orders_2019"); tb == nil || tb.Where != "id > 10" {
+		t.Errorf("FindTable(shard_1.orders_2019) = %v", tb)
+	}
+	if tb := p.FindTable(doDb, "shard_1", "users"); tb == nil || tb.TableName != "users" {
+		t.Errorf("FindTable(shard_1.users) = %v", tb)
+	}
+	// the table with the same name wins over a pattern before it
+	if tb := p.FindTable(doDb, "db1", "orders_1"); tb != doDb[1].Tables[0] {
+		t.Errorf("FindTable(db1.orders_1) = %v", tb)
+	}
+	if tb := p.FindTable(doDb, "db2", "orders_1"); tb != nil {
+		t.Errorf("FindTable(db2.orders_1) = %v", tb)
+	}
+
+	if _, err := CompileTablePatterns([]*DataSource{{TableSchema: "~("}}); err == nil {
+		t.Errorf("an invalid pattern is compiled")
+	}
+}
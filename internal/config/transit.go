@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// TransitKeyLength is the length of the keys of the transit keyring, for
+// AES-256.
+const TransitKeyLength = 32
+
+// ParseTransitKeyring decodes the base64 keys of a transit keyring
+func ParseTransitKeyring(keys []string) ([][]byte, error) {
+	keyring := make([][]byte, 0, len(keys))
+	for i, k := range keys {
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %d is not base64: %v", i+1, err)
+		}
+		if len(key) != TransitKeyLength {
+			return nil, fmt.Errorf("key %d has %d bytes, must have %d", i+1, len(key), TransitKeyLength)
+		}
+		keyring = append(keyring, key)
+	}
+	return keyring, nil
+}
+
+// DeriveTransitKeys returns the keys of a job from the keys of the keyring,
+// in the same order: the first one encrypts, the others only decrypt the
+// messages sent before the keyring was rotated. A job never sees the keys
+// of the keyring, nor those of another job.
+func DeriveTransitKeys(keyring [][]byte, jobID string) [][]byte {
+	var keys [][]byte
+	for _, k := range keyring {
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte("dtle-transit:" + jobID))
+		keys = append(keys, mac.Sum(nil))
+	}
+	return keys
+}
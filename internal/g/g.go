@@ -11,6 +11,18 @@ const (
 	GtidExecutedTablePrefix     string = "gtid_executed_"
 	GtidExecutedTableV2         string = "gtid_executed_v2"
 	GtidExecutedTableV3         string = "gtid_executed_v3"
+	ConflictLogTable            string = "conflict_log"
+	RowOwnerTable               string = "row_owner"
+	JobTablesTable              string = "job_tables"
+	CheckpointHistoryTable      string = "checkpoint_history"
+	BlobOffloadTable            string = "blob_offload"
+	DDLHistoryTable             string = "ddl_history"
+	SkippedTxTable              string = "skipped_tx"
+	SplitTxTable                string = "split_tx"
+
+	// DisableTriggersVariable is the user variable set on the sessions of
+	// an applier with DisableTriggers
+	DisableTriggersVariable string = "dtle_disable_triggers"
 
 	ENV_PRINT_TPS         = "UDUP_PRINT_TPS"
 	ENV_DUMP_CHECKSUM     = "DTLE_DUMP_CHECKSUM"
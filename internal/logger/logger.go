@@ -25,6 +25,10 @@ type Logger struct {
 	// own that implements the `Formatter` interface, see the `README` or included
 	// formatters for examples.
 	Formatter Formatter
+	// Hooks for the logger instance. These allow firing events based on logging
+	// levels and log entries. For example, to send errors to an error tracking
+	// service, log to StatsD or dump the core on fatal errors.
+	Hooks LevelHooks
 	// The logging level the logger should log at. This is typically (and defaults
 	// to) `log.Info`, which allows Info(), Warn(), Error() and Fatal() to be
 	// logged. `log.Debug` is useful in
@@ -62,6 +66,7 @@ func New(w io.Writer, l Level) *Logger {
 	return &Logger{
 		Out:       w,
 		Formatter: new(TextFormatter),
+		Hooks:     make(LevelHooks),
 		Level:     l,
 	}
 }
@@ -429,3 +434,13 @@ type FieldLogger interface {
 	Fatalln(args ...interface{})
 	Panicln(args ...interface{})
 }
+
+// AddHook adds a hook to the logger hooks.
+func (logger *Logger) AddHook(hook Hook) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if logger.Hooks == nil {
+		logger.Hooks = make(LevelHooks)
+	}
+	logger.Hooks.Add(hook)
+}
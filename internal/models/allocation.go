@@ -85,6 +85,11 @@ type Allocation struct {
 	// CreateTime is the time the allocation has finished scheduling and been
 	// verified by the plan applier.
 	CreateTime int64
+
+	// TransitKeys are the keys of the job encrypting its messages, if it
+	// has EncryptTransit. They are only set on the allocations sent to the
+	// agents, and never stored by the servers.
+	TransitKeys [][]byte
 }
 
 func (a *Allocation) Copy() *Allocation {
@@ -267,6 +272,9 @@ type AllocMetric struct {
 	// DimensionExhausted provides the count by dimension or reason
 	DimensionExhausted map[string]int
 
+	// QuotaExhausted is the quota limit which stopped the placement
+	QuotaExhausted string
+
 	// Scores is the scores of the final few nodes remaining
 	// for placement. The top score is typically selected.
 	Scores map[string]float64
@@ -395,3 +403,74 @@ type AllocListResponse struct {
 	Allocations []*AllocListStub
 	QueryMeta
 }
+
+// AllocEventsResponse is used to return the changes captured by a watch-only task
+type AllocEventsResponse struct {
+	Events []*ChangeEvent
+	// LastIndex is the index to pass to get the following events
+	LastIndex uint64
+}
+
+// AllocRescanResponse is used to return the source tables a rescan of the
+// schemas added to the Src task of an allocation
+type AllocRescanResponse struct {
+	AllocID string
+	// Tables are the tables added, as "schema.table"
+	Tables []string
+}
+
+// The connections of a task, in ConnHealth
+const (
+	ConnSourceBinlog = "source_binlog"
+	ConnSourceQuery  = "source_query"
+	ConnTarget       = "target"
+	ConnNats         = "nats"
+)
+
+// ConnHealth is the health of a connection held by a task
+type ConnHealth struct {
+	// Name is one of ConnSourceBinlog, ConnSourceQuery, ConnTarget, ConnNats
+	Name string
+	// Addr is the address of the peer, e.g. host:port
+	Addr string
+	// Healthy is false if the last use of the connection failed, or if it is
+	// not open
+	Healthy bool
+	Open    bool
+	// LastActivity is the last successful use of the connection
+	LastActivity  time.Time
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// TaskHealth is the health of the connections of a task
+type TaskHealth struct {
+	Task        string
+	Connections []*ConnHealth
+	// Error tells why the health of the task is unknown, e.g. it is not
+	// running
+	Error string
+}
+
+// AllocHealthResponse is used to return the health of the tasks of an
+// allocation
+type AllocHealthResponse struct {
+	AllocID string
+	Healthy bool
+	Tasks   []*TaskHealth
+}
+
+// ChangeEvent is a decoded row change or DDL
+type ChangeEvent struct {
+	Index     uint64
+	Gtid      string
+	Timestamp uint32
+	Schema    string
+	Table     string
+	// Insert, Update, Delete or NoDML for a DDL
+	DML     string
+	Query   string `json:",omitempty"`
+	Columns []string
+	Before  []interface{} `json:",omitempty"`
+	After   []interface{} `json:",omitempty"`
+}
@@ -28,6 +28,7 @@ const (
 	EvalTriggerScheduled     = "scheduled"
 	EvalTriggerRollingUpdate = "rolling-update"
 	EvalTriggerMaxPlans      = "max-plan-attempts"
+	EvalTriggerTaskGroup     = "task-group"
 )
 
 // Evaluation is used anytime we need to apply business logic as a result
@@ -52,6 +53,10 @@ type Evaluation struct {
 	// be run in parallel for a given JobID, so we serialize on this.
 	JobID string
 
+	// Namespace is the namespace of the job, by which the broker shares
+	// the schedulers fairly between the teams.
+	Namespace string
+
 	// JobModifyIndex is the modify index of the job at the time
 	// the evaluation was created
 	JobModifyIndex uint64
@@ -91,6 +96,10 @@ type Evaluation struct {
 	// to determine the cause.
 	FailedTGAllocs map[string]*AllocMetric
 
+	// PlacementMetrics are the metrics of the allocations placed by the
+	// evaluation by task, with the scores which ranked the chosen node.
+	PlacementMetrics map[string]*AllocMetric
+
 	// ClassEligibility tracks computed node classes that have been explicitly
 	// marked as eligible or ineligible.
 	ClassEligibility map[string]bool
@@ -99,6 +108,15 @@ type Evaluation struct {
 	// captured by computed node classes.
 	EscapedComputedClass bool
 
+	// QuotaLimitReached is the namespace whose quota blocked the evaluation.
+	// It is unblocked when the usage of the namespace goes down.
+	QuotaLimitReached string
+
+	// FullCopyLimitReached is set when the limit of the full copies of the
+	// cluster blocked the evaluation. It is unblocked when the usage of any
+	// namespace goes down.
+	FullCopyLimitReached bool
+
 	// AnnotatePlan triggers the scheduler to provide additional annotations
 	// during the evaluation. This should not be set during normal operations.
 	AnnotatePlan bool
@@ -157,6 +175,15 @@ func (e *Evaluation) Copy() *Evaluation {
 		ne.FailedTGAllocs = failedTGs
 	}
 
+	// Copy PlacementMetrics
+	if e.PlacementMetrics != nil {
+		placed := make(map[string]*AllocMetric, len(e.PlacementMetrics))
+		for task, metric := range e.PlacementMetrics {
+			placed[task] = metric.Copy()
+		}
+		ne.PlacementMetrics = placed
+	}
+
 	// Copy queued allocations
 	if e.QueuedAllocations != nil {
 		queuedAllocations := make(map[string]int, len(e.QueuedAllocations))
@@ -214,6 +241,7 @@ func (e *Evaluation) NextRollingEval(wait time.Duration) *Evaluation {
 		Type:           e.Type,
 		TriggeredBy:    EvalTriggerRollingUpdate,
 		JobID:          e.JobID,
+		Namespace:      e.Namespace,
 		JobModifyIndex: e.JobModifyIndex,
 		Status:         EvalStatusPending,
 		Wait:           wait,
@@ -230,6 +258,7 @@ func (e *Evaluation) CreateBlockedEval(classEligibility map[string]bool, escaped
 		Type:                 e.Type,
 		TriggeredBy:          e.TriggeredBy,
 		JobID:                e.JobID,
+		Namespace:            e.Namespace,
 		JobModifyIndex:       e.JobModifyIndex,
 		Status:               EvalStatusBlocked,
 		PreviousEval:         e.ID,
@@ -262,6 +291,8 @@ type EvalSpecificRequest struct {
 type EvalAckRequest struct {
 	EvalID string
 	Token  string
+	// Reason is why an evaluation is Nacked, logged by the leader
+	Reason string
 	WriteRequest
 }
 
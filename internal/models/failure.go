@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	FailureClassAuth     = "auth"
+	FailureClassNetwork  = "network"
+	FailureClassSchema   = "schema"
+	FailureClassDiskFull = "disk-full"
+	FailureClassUnknown  = "unknown"
+)
+
+// RepeatedFailures is the number of failures of the tasks of an allocation
+// after which the failure is analyzed. A single failure is usually retried
+// away by the restart policy, unless the task is not restarted anymore.
+const RepeatedFailures = 2
+
+// FailureAnalysis is the classification of the last error of an allocation
+// failing repeatedly, with a hint for the operator to fix it.
+type FailureAnalysis struct {
+	Class string
+	Hint  string
+
+	// Error is the last error, from the task events
+	Error    string
+	AllocID  string
+	Task     string
+	Failures int
+	Time     time.Time
+}
+
+func (f *FailureAnalysis) Copy() *FailureAnalysis {
+	if f == nil {
+		return nil
+	}
+	nf := new(FailureAnalysis)
+	*nf = *f
+	return nf
+}
+
+type failureRule struct {
+	class string
+	// lowercase substrings of the error, e.g. a MySQL error code
+	patterns []string
+	hint     string
+}
+
+// The rules are checked in order. The disk is checked first, as e.g.
+// "Error 1114: The table is full" may come with a network error once the
+// server gives up.
+var failureRules = []failureRule{
+	{
+		class: FailureClassDiskFull,
+		patterns: []string{
+			"no space left on device",
+			"disk quota exceeded",
+			"error 1114", // ER_RECORD_FILE_FULL
+			"error 1021", // ER_DISK_FULL
+			"got error 28",
+			"errno: 28",
+		},
+		hint: "A disk is full. Free space in the data directory of the agent " +
+			"(the binlog and the spilled transactions are kept there) or on the target MySQL, " +
+			"or lower the retention of the job, then restart the job.",
+	},
+	{
+		class: FailureClassAuth,
+		patterns: []string{
+			"error 1045", // ER_ACCESS_DENIED_ERROR
+			"error 1044", // ER_DBACCESS_DENIED_ERROR
+			"error 1142", // ER_TABLEACCESS_DENIED_ERROR
+			"error 1143", // ER_COLUMNACCESS_DENIED_ERROR
+			"error 1227", // ER_SPECIFIC_ACCESS_DENIED_ERROR
+			"error 1370", // ER_PROCACCESS_DENIED_ERROR
+			"access denied",
+			"authentication",
+		},
+		hint: "The user was refused by MySQL. Check the User and Password of the " +
+			"ConnectionConfig, that the user is allowed from the host of the agent, and its " +
+			"privileges: REPLICATION SLAVE and REPLICATION CLIENT on the source, " +
+			"and the privileges on the replicated schemas on the target.",
+	},
+	{
+		class: FailureClassSchema,
+		patterns: []string{
+			"error 1049", // ER_BAD_DB_ERROR
+			"error 1146", // ER_NO_SUCH_TABLE
+			"error 1054", // ER_BAD_FIELD_ERROR
+			"error 1136", // ER_WRONG_VALUE_COUNT_ON_ROW
+			"error 1364", // ER_NO_DEFAULT_FOR_FIELD
+			"error 1366", // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+			"error 1406", // ER_DATA_TOO_LONG
+			"error 1264", // ER_WARN_DATA_OUT_OF_RANGE
+			"error 1050", // ER_TABLE_EXISTS_ERROR
+			"error 1091", // ER_CANT_DROP_FIELD_OR_KEY
+			"unknown column",
+			"doesn't exist",
+			"column count",
+		},
+		hint: "The tables on the target do not match the source. Compare the " +
+			"schemas of the replicated tables, apply the missing DDL on the target, " +
+			"or recreate the job with a full copy.",
+	},
+	{
+		class: FailureClassNetwork,
+		patterns: []string{
+			"connection refused",
+			"connection reset",
+			"no route to host",
+			"network is unreachable",
+			"i/o timeout",
+			"broken pipe",
+			"no such host",
+			"invalid connection",
+			"bad connection",
+			"error 2003", // CR_CONN_HOST_ERROR
+			"error 2013", // CR_SERVER_LOST
+			"nats: ",
+		},
+		hint: "The agent cannot reach a MySQL server or the other agent of the job. " +
+			"Check that the Host and Port of the ConnectionConfig are right and the server is up, " +
+			"and the firewalls between the agents and to MySQL.",
+	},
+}
+
+// ClassifyFailure returns the class of an error of a task, and the hint to
+// fix it. The hint is empty if the class is unknown.
+func ClassifyFailure(err string) (string, string) {
+	lower := strings.ToLower(err)
+	for _, rule := range failureRules {
+		for _, p := range rule.patterns {
+			if strings.Contains(lower, p) {
+				return rule.class, rule.hint
+			}
+		}
+	}
+	return FailureClassUnknown, ""
+}
+
+// FailureError returns the error of an event failing the task, or "" if the
+// event is not a failure.
+func (te *TaskEvent) FailureError() string {
+	switch te.Type {
+	case TaskSetupFailure:
+		return te.SetupError
+	case TaskDriverFailure:
+		return te.DriverError
+	case TaskDiskExceeded:
+		return te.Message
+	case TaskTerminated:
+		if te.ExitCode != 0 {
+			if te.Message == "" {
+				return "exited with a non zero code"
+			}
+			return te.Message
+		}
+	}
+	return ""
+}
+
+// AnalyzeAllocFailures classifies the last failure of the tasks of an
+// allocation, if they failed at least RepeatedFailures times or are not
+// restarted after failing.
+func AnalyzeAllocFailures(alloc *Allocation) *FailureAnalysis {
+	var last *FailureAnalysis
+	failures := 0
+	givenUp := false
+	for task, state := range alloc.TaskStates {
+		for _, e := range state.Events {
+			if e.Type == TaskNotRestarting {
+				givenUp = true
+			}
+			err := e.FailureError()
+			if err == "" {
+				continue
+			}
+			failures++
+			// the task breaks the ties, for the FSM to be deterministic
+			if last == nil || e.Time.After(last.Time) || (e.Time.Equal(last.Time) && task < last.Task) {
+				last = &FailureAnalysis{
+					Error:   err,
+					AllocID: alloc.ID,
+					Task:    task,
+					Time:    e.Time,
+				}
+			}
+		}
+	}
+	if last == nil || (failures < RepeatedFailures && !givenUp) {
+		return nil
+	}
+	last.Failures = failures
+	last.Class, last.Hint = ClassifyFailure(last.Error)
+	return last
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	cases := map[string]string{
+		"Error 1045: Access denied for user 'dtle'@'10.0.0.2' (using password: YES)": FailureClassAuth,
+		"dial tcp 127.0.0.1:3306: connect: connection refused":                       FailureClassNetwork,
+		"Error 1146: Table 'db1.t1' doesn't exist":                                   FailureClassSchema,
+		"Error 1054: Unknown column 'c3' in 'field list'":                            FailureClassSchema,
+		"write /data/binlog/mysql-bin.000012: no space left on device":               FailureClassDiskFull,
+		"Error 1030: Got error 28 from storage engine":                               FailureClassDiskFull,
+		"unexpected EOF in the middle of a transaction":                              FailureClassUnknown,
+	}
+	for err, want := range cases {
+		class, hint := ClassifyFailure(err)
+		if class != want {
+			t.Errorf("%q: class %v, want %v", err, class, want)
+		}
+		if (hint == "") != (want == FailureClassUnknown) {
+			t.Errorf("%q: hint %q", err, hint)
+		}
+	}
+}
+
+func TestAnalyzeAllocFailures(t *testing.T) {
+	now := time.Now()
+	alloc := &Allocation{
+		ID: "alloc1",
+		TaskStates: map[string]*TaskState{
+			"Src": {Events: []*TaskEvent{
+				{Type: TaskReceived, Time: now},
+				{Type: TaskStarted, Time: now.Add(time.Second)},
+				{Type: TaskTerminated, Time: now.Add(2 * time.Second), ExitCode: 1,
+					Message: "dial tcp 10.0.0.3:3306: i/o timeout"},
+				{Type: TaskRestarting, Time: now.Add(3 * time.Second)},
+			}},
+			"Dest": {Events: []*TaskEvent{
+				{Type: TaskStarted, Time: now.Add(time.Second)},
+			}},
+		},
+	}
+	if f := AnalyzeAllocFailures(alloc); f != nil {
+		t.Fatalf("a single failure is analyzed: %+v", f)
+	}
+
+	alloc.TaskStates["Dest"].Events = append(alloc.TaskStates["Dest"].Events,
+		&TaskEvent{Type: TaskDriverFailure, Time: now.Add(4 * time.Second),
+			DriverError: "Error 1142: INSERT command denied to user 'dtle'@'%' for table 't1'"},
+		&TaskEvent{Type: TaskTerminated, Time: now.Add(5 * time.Second), ExitCode: 0})
+	f := AnalyzeAllocFailures(alloc)
+	if f == nil {
+		t.Fatal("no analysis")
+	}
+	if f.Class != FailureClassAuth || f.Task != "Dest" || f.Failures != 2 || f.AllocID != "alloc1" {
+		t.Errorf("analysis = %+v", f)
+	}
+
+	// a task not restarted fails for good
+	alloc.TaskStates = map[string]*TaskState{"Src": {Events: []*TaskEvent{
+		{Type: TaskTerminated, Time: now, ExitCode: 1, Message: "Error 1146: Table 'db1.t1' doesn't exist"},
+		{Type: TaskNotRestarting, Time: now.Add(time.Second), FailsTask: true},
+	}}}
+	if f := AnalyzeAllocFailures(alloc); f == nil || f.Class != FailureClassSchema || f.Failures != 1 {
+		t.Errorf("analysis = %+v", f)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 
@@ -17,7 +18,8 @@ import (
 )
 
 const (
-	JobTypeSync = "synchronous"
+	JobTypeSync      = "synchronous"
+	JobTypeMigration = "migration"
 )
 
 const (
@@ -28,6 +30,25 @@ const (
 	JobStatusComplete = "complete" // Complete means all evaluation's and allocations are terminal
 )
 
+// The algorithms placing the allocations of a job across the nodes. Spread
+// isolates the failures of a node to fewer tasks, binpack fills the nodes
+// already in use before the others.
+const (
+	SchedulerAlgorithmSpread  = "spread"
+	SchedulerAlgorithmBinpack = "binpack"
+)
+
+// ValidSchedulerAlgorithm returns if the scheduler algorithm is known, the
+// empty one being the default of the servers.
+func ValidSchedulerAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case "", SchedulerAlgorithmSpread, SchedulerAlgorithmBinpack:
+		return true
+	default:
+		return false
+	}
+}
+
 func ValidJobStatus(status string) bool {
 	switch status {
 	case JobStatusPending, JobStatusRunning, JobStatusPause, JobStatusDead, JobStatusComplete:
@@ -55,6 +76,20 @@ type Job struct {
 	// per region, but not unique globally.
 	Name string
 
+	// Namespace is the team or tenant of the job, whose quota it counts
+	// against. It is "default" if not given.
+	Namespace string
+
+	// Owner is the external controller declaratively managing the job, e.g.
+	// a Kubernetes operator. SpecHash is the hash of the spec it last applied
+	// through the reconciliation, and is empty if the job was changed otherwise.
+	Owner    string
+	SpecHash string
+
+	// Meta is the labels of the job, e.g. team=payments, by which the jobs
+	// are listed with filters like "meta.team==payments".
+	Meta map[string]string
+
 	Failover bool
 
 	// Type is used to control various behaviors about the job. Most jobs
@@ -66,6 +101,19 @@ type Job struct {
 	// Datacenters contains all the datacenters this job is allowed to span
 	Datacenters []string
 
+	// SchedulerAlgorithm overrides the scheduler algorithm of the servers
+	// for the job, spread or binpack.
+	SchedulerAlgorithm string
+
+	// EncryptTransit encrypts the change events sent by the Src task to the
+	// Dest task with keys of the job, derived from the transit keyring of
+	// the servers.
+	EncryptTransit bool
+
+	// SLA is the service level of the job, whose compliance is computed by
+	// the servers from the samples of the job. nil is no SLA.
+	SLA *SLASpec
+
 	// Constraints can be specified at a job level and apply to
 	// all the tasks.
 	Constraints []*Constraint
@@ -74,12 +122,25 @@ type Job struct {
 	// to run. Each task is an atomic unit of scheduling and placement.
 	Tasks []*Task
 
+	// Groups orders the task groups of the job, e.g. schema, copy, verify.
+	// The tasks of a group are started once all the tasks of the previous
+	// group completed successfully. Without groups all the tasks run at once.
+	Groups []string
+
+	// GroupStates is the progress of the job through its groups, kept by
+	// the servers.
+	GroupStates []*TaskGroupState
+
 	// Job status
 	Status string
 
 	// StatusDescription is meant to provide more human useful information
 	StatusDescription string
 
+	// Failure is the analysis of the last allocation of the job failing
+	// repeatedly. It is cleared when the job is registered again.
+	Failure *FailureAnalysis
+
 	EnforceIndex bool
 
 	// Raft Indexes
@@ -91,6 +152,9 @@ type Job struct {
 // Canonicalize is used to canonicalize fields in the Job. This should be called
 // when registering a Job.
 func (j *Job) Canonicalize() {
+	if j.Namespace == "" {
+		j.Namespace = DefaultNamespace
+	}
 	for _, t := range j.Tasks {
 		t.Canonicalize(j)
 	}
@@ -106,6 +170,11 @@ func (j *Job) Copy() *Job {
 	*nj = *j
 	nj.Datacenters = internal.CopySliceString(nj.Datacenters)
 	nj.Constraints = CopySliceConstraints(nj.Constraints)
+	nj.Meta = internal.CopyMapStringString(nj.Meta)
+	nj.Failure = nj.Failure.Copy()
+	nj.SLA = nj.SLA.Copy()
+	nj.Groups = internal.CopySliceString(nj.Groups)
+	nj.GroupStates = copyTaskGroupStates(nj.GroupStates)
 
 	if j.Tasks != nil {
 		ts := make([]*Task, len(nj.Tasks))
@@ -139,9 +208,23 @@ func (j *Job) Validate() error {
 	if len(j.Datacenters) == 0 {
 		mErr.Errors = append(mErr.Errors, errors.New("Missing job datacenters"))
 	}
+	if !ValidSchedulerAlgorithm(j.SchedulerAlgorithm) {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Invalid scheduler algorithm %q, must be %q or %q",
+			j.SchedulerAlgorithm, SchedulerAlgorithmSpread, SchedulerAlgorithmBinpack))
+	}
 	if len(j.Tasks) == 0 {
 		mErr.Errors = append(mErr.Errors, errors.New("Missing job tasks"))
 	}
+	for k := range j.Meta {
+		if k == "" || strings.ContainsAny(k, "=! ") {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("Job meta key %q is empty or contains '=', '!' or a space", k))
+		}
+	}
+	if j.SLA != nil {
+		if err := j.SLA.Validate(); err != nil {
+			mErr.Errors = append(mErr.Errors, err)
+		}
+	}
 	for idx, constr := range j.Constraints {
 		if err := constr.Validate(); err != nil {
 			outer := fmt.Errorf("Constraint %d validation failed: %s", idx+1, err)
@@ -169,6 +252,13 @@ func (j *Job) Validate() error {
 		}
 	}
 
+	if err := j.validateGroups(); err != nil {
+		mErr.Errors = append(mErr.Errors, err)
+	}
+	if err := j.validateStandby(); err != nil {
+		mErr.Errors = append(mErr.Errors, err)
+	}
+
 	return mErr.ErrorOrNil()
 }
 
@@ -187,6 +277,10 @@ func (j *Job) Stub(job *Job) *JobListStub {
 	return &JobListStub{
 		ID:                j.ID,
 		Name:              j.Name,
+		Namespace:         j.Namespace,
+		Owner:             j.Owner,
+		SpecHash:          j.SpecHash,
+		Meta:              j.Meta,
 		Type:              j.Type,
 		Status:            j.Status,
 		StatusDescription: j.StatusDescription,
@@ -202,6 +296,10 @@ func (j *Job) Stub(job *Job) *JobListStub {
 type JobListStub struct {
 	ID                string
 	Name              string
+	Namespace         string
+	Owner             string
+	SpecHash          string
+	Meta              map[string]string
 	Type              string
 	Status            string
 	StatusDescription string
@@ -213,6 +311,8 @@ type JobListStub struct {
 
 type JobResponse struct {
 	Success bool
+	// EvalID is the evaluation created by the request, if any
+	EvalID string
 	QueryMeta
 }
 
@@ -265,6 +365,32 @@ type JobRegisterRequest struct {
 	EnforceIndex   bool
 	JobModifyIndex uint64
 
+	// WarmRestart changes the filters of a running job, which its tasks
+	// apply without restarting. Only the WarmRestartConfig and the
+	// TunableConfig of the tasks may differ from the registered job.
+	WarmRestart bool
+
+	WriteRequest
+}
+
+// JobTuneRequest is used to change the TunableConfig of the tasks of a
+// running job
+type JobTuneRequest struct {
+	JobID string
+	// Tunables are the values to set, by task type
+	Tunables map[string]map[string]interface{}
+	WriteRequest
+}
+
+// JobSetCheckpointRequest is used to set the checkpoint of a paused job, e.g.
+// to skip a transaction its target cannot apply. Either field is set.
+type JobSetCheckpointRequest struct {
+	JobID string
+	// Gtid is the GTID set executed on the target. The job replicates the
+	// transactions after it, without a full copy.
+	Gtid string
+	// CopyProgress is where the interrupted full copy goes on
+	CopyProgress *CopyProgress
 	WriteRequest
 }
 
@@ -295,6 +421,47 @@ type JobEvaluateRequest struct {
 	WriteRequest
 }
 
+// The operations of JobBulkRequest
+const (
+	JobBulkPause    = "pause"
+	JobBulkResume   = "resume"
+	JobBulkStop     = "stop"
+	JobBulkEvaluate = "evaluate"
+)
+
+// JobBulkRequest is used to pause, resume, stop or re-evaluate the jobs
+// selected by filters or IDs at once.
+type JobBulkRequest struct {
+	Operation string
+	Filters   []*JobFilter
+	JobIDs    []string
+	WriteRequest
+}
+
+// JobBulkApplyRequest is what a bulk operation commits in one raft log.
+type JobBulkApplyRequest struct {
+	Statuses   map[string]string
+	Deregister []string
+	Evals      []*Evaluation
+	WriteRequest
+}
+
+// JobBulkResponse has the result of each selected job
+type JobBulkResponse struct {
+	Results []*JobBulkResult
+	WriteMeta
+}
+
+// JobBulkResult is the result of a bulk operation on a job. A job is
+// skipped if it is already in the wanted status.
+type JobBulkResult struct {
+	JobID   string
+	Name    string
+	EvalID  string
+	Skipped bool
+	Error   string
+}
+
 // JobSpecificRequest is used when we just need to specify a target job
 type JobSpecificRequest struct {
 	JobID     string
@@ -304,6 +471,11 @@ type JobSpecificRequest struct {
 
 // JobListRequest is used to parameterize a list request
 type JobListRequest struct {
+	// Owner only lists the jobs of an owner, if set
+	Owner string
+
+	// Filters only lists the jobs matching all of them
+	Filters []*JobFilter
 	QueryOptions
 }
 
@@ -355,6 +527,34 @@ type TaskValidateResponse struct {
 	ServerID ServerIDValidate
 
 	Binlog BinlogValidate
+
+	// TargetObjects is only checked for the Dest task
+	TargetObjects TargetObjectsValidate
+}
+
+// TargetObjectsValidate reports the triggers and the CHECK constraints of
+// the target tables of a job. They act on the rows the job applies: a
+// trigger may apply again what the source did, and a CHECK constraint may
+// reject a row the source accepted.
+type TargetObjectsValidate struct {
+	Success          bool
+	Triggers         []*TargetObject
+	CheckConstraints []*TargetObject
+	// Error is a string version of any error that may have occured
+	Error string
+}
+
+// TargetObject is a trigger or a CHECK constraint of a target table
+type TargetObject struct {
+	TableSchema string
+	TableName   string
+	Name        string
+	// the timing and event of a trigger, e.g. "BEFORE INSERT", or the
+	// clause of a CHECK constraint
+	Definition string
+	// Disabled is set on a trigger skipping the sessions of an applier with
+	// DisableTriggers
+	Disabled bool
 }
 
 type BinlogValidate struct {
@@ -398,3 +598,222 @@ type MaxAllowedPacket struct {
 	// Error is a string version of any error that may have occured
 	Error string
 }
+
+// JobVerifyResponse is the response of a quick verification, which compares
+// row counts (and optionally MAX(pk) and SUM(column)) of source and target.
+type JobVerifyResponse struct {
+	JobID  string
+	Match  bool
+	Tables []*TableVerifyResult
+}
+
+type TableVerifyResult struct {
+	TableSchema string
+	TableName   string
+	SourceRows  int64
+	TargetRows  int64
+	// PkColumn and SumColumn are empty if not requested or not applicable
+	PkColumn    string
+	SourceMaxPk string
+	TargetMaxPk string
+	SumColumn   string
+	SourceSum   string
+	TargetSum   string
+	Match       bool
+	// Error is a string version of any error that may have occured
+	Error string
+}
+
+// JobChecksumResponse is the report of the last Checksum step of a job
+// which completed.
+type JobChecksumResponse struct {
+	JobID   string
+	AllocID string
+	Time    time.Time
+	Match   bool
+	// DiffTables counts the tables which differ, or failed to be compared
+	DiffTables int
+	Tables     []*TableChecksum
+}
+
+// TableChecksum compares the CRC32 checksums of the chunks of a table on
+// source and target. The chunks are ranges of the primary key, or of a
+// unique key without NULL, and the whole table if it has none.
+type TableChecksum struct {
+	TableSchema string
+	TableName   string
+	// ChunkKey are the columns of the key chunking the table
+	ChunkKey   []string
+	Chunks     int
+	DiffChunks int
+	SourceRows int64
+	TargetRows int64
+	Match      bool
+	// Error is a string version of any error that may have occured
+	Error string
+}
+
+const (
+	// a blocker stops the job, or corrupts data
+	AssessSeverityBlocker = "blocker"
+	AssessSeverityWarning = "warning"
+
+	AssessCheckNoPrimaryKey    = "no-primary-key"
+	AssessCheckUnsupportedType = "unsupported-type"
+	AssessCheckLargeBlob       = "large-blob"
+	AssessCheckForeignKey      = "foreign-key"
+	AssessCheckCharset         = "charset"
+	AssessCheckTrigger         = "trigger"
+)
+
+// JobAssessResponse is the report of an assessment of the source of a job,
+// made before any data moves.
+type JobAssessResponse struct {
+	JobID    string
+	Blockers int
+	Warnings int
+	Tables   []*TableAssessment
+}
+
+type TableAssessment struct {
+	TableSchema string
+	TableName   string
+	Issues      []*AssessIssue
+	// Error is a string version of any error that may have occured
+	Error string
+}
+
+type AssessIssue struct {
+	Severity string
+	Check    string
+	// Column is empty for issues of the table
+	Column  string
+	Message string
+}
+
+// JobConvertResponse is the schema conversion report of a job with a
+// non-MySQL target: the proposed target DDL of each source table.
+type JobConvertResponse struct {
+	JobID string
+	// Target is the type of the target, e.g. "snowflake"
+	Target string
+	Tables []*TableConversion
+}
+
+type TableConversion struct {
+	TableSchema string
+	TableName   string
+	Columns     []*ColumnConversion
+	// Statement creates the table on the target. It is empty if a column cannot be converted.
+	Statement string
+	Error     string
+}
+
+type ColumnConversion struct {
+	Name       string
+	SourceType string
+	TargetType string
+	// Note tells about lossy conversions and overrides
+	Note string
+}
+
+// JobConflictsResponse lists the latest conflicts recorded on the target of a job.
+type JobConflictsResponse struct {
+	JobID     string
+	Conflicts []*ConflictRecord
+}
+
+type ConflictRecord struct {
+	ID          int64
+	Gtid        string
+	TableSchema string
+	TableName   string
+	// PkValue is the primary key values, as a json array
+	PkValue    string
+	DML        string
+	Policy     string
+	Resolution string
+	Incoming   string
+	Existing   string
+	CreatedAt  string
+}
+
+// JobDDLHistoryResponse lists the latest DDLs executed on the target of a job.
+type JobDDLHistoryResponse struct {
+	JobID string
+	DDLs  []*DDLRecord
+}
+
+type DDLRecord struct {
+	ID int64
+	// the source transaction of the DDL and its binlog coordinates
+	Gtid    string
+	LogFile string
+	LogPos  int64
+	// EventTime is the time of the DDL on the source
+	EventTime     string
+	CurrentSchema string
+	TableSchema   string
+	TableName     string
+	Query         string
+	// DurationMs is how long the target took to execute the DDL
+	DurationMs int64
+	// IgnoredError is the error of the DDL ignored by the applier, e.g. a
+	// table which already exists
+	IgnoredError string
+	ExecutedAt   string
+}
+
+// JobSkipTxRequest is used to arm the Dest task of a running job to skip its
+// next failing transaction
+type JobSkipTxRequest struct {
+	JobID string
+	// Gtid is the only transaction to skip, if set, e.g. as named by the
+	// error of the task
+	Gtid   string
+	Reason string
+	WriteRequest
+}
+
+// JobSkipTxResponse is the skip armed
+type JobSkipTxResponse struct {
+	SkipID string
+	Index  uint64
+}
+
+// JobSkippedTxsResponse lists the latest transactions skipped on the target
+// of a job.
+type JobSkippedTxsResponse struct {
+	JobID   string
+	Skipped []*SkippedTxRecord
+}
+
+type SkippedTxRecord struct {
+	ID     int64
+	SkipID string
+	// the source transaction and its binlog coordinates
+	Gtid      string
+	LogFile   string
+	LogPos    int64
+	EventTime string
+	// Tables are the tables of the transaction, as "schema.table"
+	Tables []string
+	// Rows is the number of row events, Statements of the other events
+	Rows       int64
+	Statements int64
+	// Error is why the transaction failed on the target
+	Error string
+	// Events describes the events of the transaction, a line each
+	Events    string
+	Reason    string
+	SkippedAt string
+}
+
+// JobCheckpointResponse is where the tasks of a job resume: the GTID set
+// executed on the target, or, while the full copy is not done, its progress.
+type JobCheckpointResponse struct {
+	JobID        string
+	Status       string
+	Gtid         string
+	CopyProgress *CopyProgress
+}
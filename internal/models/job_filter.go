@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	JobFilterEqual    = "=="
+	JobFilterNotEqual = "!="
+
+	jobFilterMetaPrefix = "meta."
+)
+
+// JobFilter is a condition on the listed jobs, parsed from e.g.
+// "meta.team==payments", "status!=dead" or "meta.env". A meta key without
+// an operator only has to be set.
+type JobFilter struct {
+	// Field is one of name, namespace, owner, status and type, or
+	// "meta.<key>".
+	Field string
+	Op    string
+	Value string
+}
+
+var jobFilterFields = map[string]func(*Job) string{
+	"name":      func(j *Job) string { return j.Name },
+	"namespace": func(j *Job) string { return j.Namespace },
+	"owner":     func(j *Job) string { return j.Owner },
+	"status":    func(j *Job) string { return j.Status },
+	"type":      func(j *Job) string { return j.Type },
+}
+
+func ParseJobFilter(expr string) (*JobFilter, error) {
+	f := &JobFilter{Field: strings.TrimSpace(expr)}
+	for _, op := range []string{JobFilterEqual, JobFilterNotEqual} {
+		if i := strings.Index(expr, op); i >= 0 {
+			f.Field = strings.TrimSpace(expr[:i])
+			f.Op = op
+			f.Value = strings.TrimSpace(expr[i+len(op):])
+			break
+		}
+	}
+	if key, ok := f.MetaKey(); ok {
+		if key == "" {
+			return nil, fmt.Errorf("filter %q: missing meta key", expr)
+		}
+		return f, nil
+	}
+	if _, ok := jobFilterFields[f.Field]; !ok {
+		return nil, fmt.Errorf("filter %q: unknown field %q", expr, f.Field)
+	}
+	if f.Op == "" {
+		return nil, fmt.Errorf("filter %q: missing == or !=", expr)
+	}
+	return f, nil
+}
+
+// MetaKey returns the meta key of the filter, if it is on the meta.
+func (f *JobFilter) MetaKey() (string, bool) {
+	if !strings.HasPrefix(f.Field, jobFilterMetaPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(f.Field, jobFilterMetaPrefix), true
+}
+
+func (f *JobFilter) Matches(job *Job) bool {
+	var value string
+	if key, ok := f.MetaKey(); ok {
+		v, set := job.Meta[key]
+		if f.Op == "" {
+			return set
+		}
+		value = v
+	} else {
+		value = jobFilterFields[f.Field](job)
+	}
+	if f.Op == JobFilterNotEqual {
+		return value != f.Value
+	}
+	return value == f.Value
+}
+
+func (f *JobFilter) String() string {
+	return f.Field + f.Op + f.Value
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"testing"
+)
+
+func TestJobFilter(t *testing.T) {
+	job := &Job{
+		Name:   "j1",
+		Status: JobStatusRunning,
+		Meta:   map[string]string{"team": "payments", "env": "prod"},
+	}
+	cases := []struct {
+		expr  string
+		match bool
+	}{
+		{"meta.team==payments", true},
+		{"meta.team == payments", true},
+		{"meta.team==orders", false},
+		{"meta.team!=orders", true},
+		{"meta.env", true},
+		{"meta.app", false},
+		{"meta.app!=x", true},
+		{"status==running", true},
+		{"status!=running", false},
+		{"name==j2", false},
+	}
+	for _, c := range cases {
+		f, err := ParseJobFilter(c.expr)
+		if err != nil {
+			t.Errorf("%v: %v", c.expr, err)
+			continue
+		}
+		if got := f.Matches(job); got != c.match {
+			t.Errorf("%v: Matches() = %v, want %v", c.expr, got, c.match)
+		}
+	}
+
+	for _, expr := range []string{"meta.", "status", "region==global", ""} {
+		if _, err := ParseJobFilter(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"time"
+)
+
+const (
+	// JobStatsInterval is the period of the samples of the lag and the
+	// throughput of the jobs, which the clients send to the servers.
+	JobStatsInterval = time.Minute
+
+	// MaxJobStatsSamples bounds the samples kept for a job: a day of them.
+	MaxJobStatsSamples = 24 * 60
+)
+
+// JobStatsSample is the lag and the throughput of the Dest task of a job
+// over a JobStatsInterval.
+type JobStatsSample struct {
+	Time time.Time
+	// LagSeconds is how far the target is behind the source: since the
+	// source time of the last transaction applied, while others are
+	// pending. It is 0 once caught up, and during the full copy.
+	LagSeconds     int64
+	TxPerSecond    float64
+	RowsPerSecond  float64
+	BytesPerSecond float64
+}
+
+// NewJobStatsSample returns the sample of a Dest task between two of its
+// statistics. The counters of a task restarted in between start from 0.
+func NewJobStatsSample(prev, cur *TaskStatistics) *JobStatsSample {
+	seconds := time.Duration(cur.Timestamp - prev.Timestamp).Seconds()
+	rate := func(prev, cur int64) float64 {
+		if seconds <= 0 {
+			return 0
+		}
+		if cur < prev {
+			prev = 0
+		}
+		return float64(cur-prev) / seconds
+	}
+	return &JobStatsSample{
+		Time:           time.Unix(0, cur.Timestamp).UTC(),
+		LagSeconds:     cur.LagSeconds,
+		TxPerSecond:    rate(prev.ExecMasterTxCount, cur.ExecMasterTxCount),
+		RowsPerSecond:  rate(prev.ExecMasterRowCount, cur.ExecMasterRowCount),
+		BytesPerSecond: rate(prev.TrafficStat.AppliedBytes, cur.TrafficStat.AppliedBytes),
+	}
+}
+
+// JobStats are the last samples of a job, oldest first.
+type JobStats struct {
+	JobID   string
+	Samples []*JobStatsSample
+	// SLA is the compliance of the job to its SLA, nil if it has none
+	SLA *SLAStatus
+
+	CreateIndex uint64
+	ModifyIndex uint64
+}
+
+// Copy returns a copy of the stats, sharing the samples.
+func (s *JobStats) Copy() *JobStats {
+	if s == nil {
+		return nil
+	}
+	ns := *s
+	ns.Samples = make([]*JobStatsSample, len(s.Samples))
+	copy(ns.Samples, s.Samples)
+	ns.SLA = s.SLA.Copy()
+	return &ns
+}
+
+// Add appends a sample, dropping the oldest ones over MaxJobStatsSamples. A
+// sample not newer than the last one is ignored.
+func (s *JobStats) Add(sample *JobStatsSample) {
+	if n := len(s.Samples); n > 0 && !sample.Time.After(s.Samples[n-1].Time) {
+		return
+	}
+	s.Samples = append(s.Samples, sample)
+	if over := len(s.Samples) - MaxJobStatsSamples; over > 0 {
+		s.Samples = append([]*JobStatsSample(nil), s.Samples[over:]...)
+	}
+}
+
+// Since returns the samples taken after t.
+func (s *JobStats) Since(t time.Time) []*JobStatsSample {
+	for i, sample := range s.Samples {
+		if sample.Time.After(t) {
+			return s.Samples[i:]
+		}
+	}
+	return nil
+}
+
+// JobStatsUpdate is a sample of a job taken by a client
+type JobStatsUpdate struct {
+	JobID  string
+	Sample *JobStatsSample
+}
+
+// JobStatsUpdateRequest is used by the clients to send the samples of the
+// jobs they run
+type JobStatsUpdateRequest struct {
+	Updates []*JobStatsUpdate
+	WriteRequest
+}
+
+// JobStatsRequest is used to get the samples of a job over a period
+type JobStatsRequest struct {
+	JobID string
+	// Period is how far back the samples go, up to MaxJobStatsSamples
+	Period time.Duration
+	QueryOptions
+}
+
+// JobStatsResponse is the samples of a job, oldest first
+type JobStatsResponse struct {
+	JobID   string
+	Samples []*JobStatsSample
+	QueryMeta
+}
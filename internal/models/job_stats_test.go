@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewJobStatsSample(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := &TaskStatistics{ExecMasterTxCount: 100, ExecMasterRowCount: 1000, Timestamp: start.UnixNano(),
+		TrafficStat: TrafficStat{AppliedBytes: 6000}}
+	cur := &TaskStatistics{ExecMasterTxCount: 700, ExecMasterRowCount: 1000, LagSeconds: 5,
+		Timestamp: start.Add(time.Minute).UnixNano(), TrafficStat: TrafficStat{AppliedBytes: 12000}}
+
+	s := NewJobStatsSample(prev, cur)
+	if !s.Time.Equal(start.Add(time.Minute)) || s.LagSeconds != 5 {
+		t.Errorf("sample = %+v", s)
+	}
+	if s.TxPerSecond != 10 || s.RowsPerSecond != 0 || s.BytesPerSecond != 100 {
+		t.Errorf("rates = %v %v %v", s.TxPerSecond, s.RowsPerSecond, s.BytesPerSecond)
+	}
+
+	// the task restarted: its counters start over
+	cur.ExecMasterTxCount = 60
+	if s := NewJobStatsSample(prev, cur); s.TxPerSecond != 1 {
+		t.Errorf("tx per second after a restart = %v", s.TxPerSecond)
+	}
+	if s := NewJobStatsSample(cur, cur); s.TxPerSecond != 0 {
+		t.Errorf("tx per second of the same statistics = %v", s.TxPerSecond)
+	}
+}
+
+func TestJobStats_Add(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats := &JobStats{JobID: "job1"}
+	for i := 0; i < MaxJobStatsSamples+10; i++ {
+		stats.Add(&JobStatsSample{Time: start.Add(time.Duration(i) * JobStatsInterval)})
+	}
+	if len(stats.Samples) != MaxJobStatsSamples || !stats.Samples[0].Time.Equal(start.Add(10*JobStatsInterval)) {
+		t.Fatalf("%d samples from %v", len(stats.Samples), stats.Samples[0].Time)
+	}
+	last := stats.Samples[len(stats.Samples)-1].Time
+
+	stats.Add(&JobStatsSample{Time: last})
+	if len(stats.Samples) != MaxJobStatsSamples {
+		t.Error("a sample not newer than the last one was added")
+	}
+
+	copied := stats.Copy()
+	copied.Add(&JobStatsSample{Time: last.Add(JobStatsInterval)})
+	if !stats.Samples[len(stats.Samples)-1].Time.Equal(last) {
+		t.Error("adding to a copy changed the stats")
+	}
+
+	if n := len(stats.Since(last.Add(-time.Hour))); n != 60 {
+		t.Errorf("%d samples in the last hour", n)
+	}
+	if stats.Since(last) != nil {
+		t.Error("samples after the last one")
+	}
+}
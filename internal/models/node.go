@@ -78,6 +78,9 @@ type NodeServerInfo struct {
 type NodeUpdateStatusRequest struct {
 	NodeID string
 	Status string
+
+	// Utilization is the current load of the node, sent with the heartbeats
+	Utilization *NodeUtilization
 	WriteRequest
 }
 
@@ -196,11 +199,31 @@ type Node struct {
 	// updated
 	StatusUpdatedAt int64
 
+	// Utilization is the load of the node last reported by its heartbeats,
+	// used by the scheduler to rank the nodes
+	Utilization *NodeUtilization
+
 	// Raft Indexes
 	CreateIndex uint64
 	ModifyIndex uint64
 }
 
+// NodeUtilization is the load of a node, as sampled by its agent.
+type NodeUtilization struct {
+	CPUPercent    float64
+	MemoryPercent float64
+
+	// DiskPercent is the used space of the file system of the alloc dir
+	DiskPercent float64
+
+	// NetworkBytesPerSec is the rate of bytes sent and received by the
+	// interfaces of the node since the previous sample
+	NetworkBytesPerSec float64
+
+	// CollectedAt is when the agent sampled it, in unix seconds
+	CollectedAt int64
+}
+
 // Ready returns if the node is ready for running allocations
 func (n *Node) Ready() bool {
 	return n.Status == NodeStatusReady
@@ -213,6 +236,10 @@ func (n *Node) Copy() *Node {
 	nn := new(Node)
 	*nn = *n
 	nn.Attributes = internal.CopyMapStringString(nn.Attributes)
+	if n.Utilization != nil {
+		u := *n.Utilization
+		nn.Utilization = &u
+	}
 	return nn
 }
 
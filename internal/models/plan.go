@@ -6,6 +6,8 @@
 
 package models
 
+import "time"
+
 // Plan is used to submit a commit plan for task allocations. These
 // are submitted to the leader which verifies that resources have
 // not been overcommitted before admiting the plan.
@@ -106,6 +108,10 @@ type PlanResult struct {
 	// AllocIndex is the Raft index in which the evictions and
 	// allocations took place. This is used for the write index.
 	AllocIndex uint64
+
+	// Rejections tells why the nodes of the plan which are not in the
+	// result were not committed.
+	Rejections []*PlanRejection
 }
 
 // IsNoOp checks if this plan result would do nothing
@@ -127,6 +133,62 @@ func (p *PlanResult) FullCommit(plan *Plan) (bool, int, int) {
 	return actual == expected, expected, actual
 }
 
+const (
+	PlanRejectNodeMissing   = "node-missing"
+	PlanRejectNodeNotReady  = "node-not-ready"
+	PlanRejectAllocConflict = "alloc-conflict"
+)
+
+// PlanRejection is a node of a plan which was not committed. The scheduler
+// refreshes its state and plans again for the node.
+type PlanRejection struct {
+	Time   time.Time
+	EvalID string
+	JobID  string
+	NodeID string
+	Reason string
+	Detail string
+}
+
+// PlanEvalStats are the rejections of the plans of an evaluation. An
+// evaluation whose plans keep being partially committed is stuck in a
+// refresh loop.
+type PlanEvalStats struct {
+	EvalID       string
+	JobID        string
+	PartialPlans uint64
+	LastReason   string
+	LastDetail   string
+	LastTime     time.Time
+}
+
+// PlanStats are the outcomes of the plans applied by the leader since it
+// was elected.
+type PlanStats struct {
+	Submitted uint64
+	Applied   uint64
+	Partial   uint64
+	NoOp      uint64
+	Failed    uint64
+
+	// RejectedNodes is the number of rejected nodes of plans by reason.
+	RejectedNodes map[string]uint64
+
+	// Rejections are the most recent rejections, the newest first.
+	Rejections []*PlanRejection
+
+	// Evals are the evaluations with partially committed plans, the most
+	// recently rejected first.
+	Evals []*PlanEvalStats
+}
+
+// PlanStatsResponse is used by the Operator endpoint to return the plan stats
+// of the leader.
+type PlanStatsResponse struct {
+	Stats *PlanStats
+	QueryMeta
+}
+
 // PlanAnnotations holds annotations made by the scheduler to give further debug
 // information to operators.
 type PlanAnnotations struct {
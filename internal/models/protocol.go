@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// An agent speaks the protocol versions from ProtocolVersionMin to
+// ProtocolVersion, i.e. it understands the RPCs and raft messages of them.
+// Agents not telling their versions speak version 1 only. The versions are
+// raised when an upgrade cannot be done one agent at a time.
+const (
+	ProtocolVersionMin = 1
+	ProtocolVersion    = 1
+)
+
+// Features added within a protocol version. A feature writing new raft
+// messages is only used once every server supports it, since an older
+// server fails to apply them.
+const (
+	FeatureStateImport = "state-import"
+	FeatureQuotas      = "quotas"
+)
+
+// Features are the features supported by this agent.
+var Features = []string{FeatureStateImport, FeatureQuotas}
+
+// Node attributes of the protocol of a client agent
+const (
+	NodeAttrProtocolMin = "protocol.min"
+	NodeAttrProtocol    = "protocol.max"
+)
+
+// ProtocolCompatible tells whether an agent speaking the versions from min
+// to max can talk to this agent.
+func ProtocolCompatible(min, max int) bool {
+	return min <= max && min <= ProtocolVersion && max >= ProtocolVersionMin
+}
+
+// ParseProtocol returns the versions told by an agent, e.g. in serf tags.
+// Empty values are version 1.
+func ParseProtocol(min, max string) (int, int, error) {
+	parse := func(s string) (int, error) {
+		if s == "" {
+			return 1, nil
+		}
+		return strconv.Atoi(s)
+	}
+	vmin, err := parse(min)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad protocol version %q", min)
+	}
+	vmax, err := parse(max)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad protocol version %q", max)
+	}
+	return vmin, vmax, nil
+}
+
+// ParseFeatures returns the set of a comma separated feature list.
+func ParseFeatures(s string) map[string]bool {
+	features := make(map[string]bool)
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			features[f] = true
+		}
+	}
+	return features
+}
+
+// SetNodeProtocol tells the protocol of a client agent in its attributes.
+func SetNodeProtocol(node *Node) {
+	node.Attributes[NodeAttrProtocolMin] = strconv.Itoa(ProtocolVersionMin)
+	node.Attributes[NodeAttrProtocol] = strconv.Itoa(ProtocolVersion)
+}
+
+// CheckNodeProtocol returns an error if a client agent cannot talk to this
+// agent.
+func CheckNodeProtocol(node *Node) error {
+	min, max, err := ParseProtocol(node.Attributes[NodeAttrProtocolMin], node.Attributes[NodeAttrProtocol])
+	if err != nil {
+		return err
+	}
+	if !ProtocolCompatible(min, max) {
+		return fmt.Errorf("node %v speaks protocol versions %d to %d, not compatible with %d to %d of the server",
+			node.Name, min, max, ProtocolVersionMin, ProtocolVersion)
+	}
+	return nil
+}
@@ -39,8 +39,44 @@ const (
 	EvalDeleteRequestType
 	AllocUpdateRequestType
 	AllocClientUpdateRequestType
+	StateImportRequestType
+	QuotaUpsertRequestType
+	QuotaDeleteRequestType
+	JobBulkApplyRequestType
+	JobStatsUpdateRequestType
 )
 
+// messageTypeNames are the names of the message types, in the metrics and
+// the logs
+var messageTypeNames = []string{
+	NodeRegisterRequestType:      "node_register",
+	NodeDeregisterRequestType:    "node_deregister",
+	NodeUpdateStatusRequestType:  "node_update_status",
+	JobUpdateStatusRequestType:   "job_update_status",
+	JobRegisterRequestType:       "job_register",
+	JobDeregisterRequestType:     "job_deregister",
+	JobRenewalRequestType:        "job_renewal",
+	JobClientUpdateRequestType:   "job_client_update",
+	OrderRegisterRequestType:     "order_register",
+	OrderDeregisterRequestType:   "order_deregister",
+	EvalUpdateRequestType:        "eval_update",
+	EvalDeleteRequestType:        "eval_delete",
+	AllocUpdateRequestType:       "alloc_update",
+	AllocClientUpdateRequestType: "alloc_client_update",
+	StateImportRequestType:       "state_import",
+	QuotaUpsertRequestType:       "quota_upsert",
+	QuotaDeleteRequestType:       "quota_delete",
+	JobBulkApplyRequestType:      "job_bulk_apply",
+	JobStatsUpdateRequestType:    "job_stats_update",
+}
+
+func (t MessageType) String() string {
+	if int(t) < len(messageTypeNames) {
+		return messageTypeNames[t]
+	}
+	return fmt.Sprintf("unknown_%d", t)
+}
+
 const (
 	// IgnoreUnknownTypeFlag is set along with a MessageType
 	// to indicate that the message type can be safely ignored
@@ -55,6 +91,8 @@ type RPCInfo interface {
 	RequestRegion() string
 	IsRead() bool
 	AllowStaleRead() bool
+	MaxStaleRead() time.Duration
+	ConsistentRead() bool
 }
 
 // QueryOptions is used to specify various flags for read queries
@@ -73,6 +111,14 @@ type QueryOptions struct {
 	// may be arbitrarily stale.
 	AllowStale bool
 
+	// If set with AllowStale, a follower which has not heard from the
+	// leader for longer forwards the request to the leader.
+	MaxStaleDuration time.Duration
+
+	// If set, the leader verifies it still is the leader before
+	// servicing the request, so it sees all the committed writes.
+	RequireConsistent bool
+
 	// If set, used as prefix for resource list searches
 	Prefix string
 }
@@ -90,6 +136,14 @@ func (q QueryOptions) AllowStaleRead() bool {
 	return q.AllowStale
 }
 
+func (q QueryOptions) MaxStaleRead() time.Duration {
+	return q.MaxStaleDuration
+}
+
+func (q QueryOptions) ConsistentRead() bool {
+	return q.RequireConsistent
+}
+
 type WriteRequest struct {
 	// The target region for this write
 	Region string
@@ -109,6 +163,14 @@ func (w WriteRequest) AllowStaleRead() bool {
 	return false
 }
 
+func (w WriteRequest) MaxStaleRead() time.Duration {
+	return 0
+}
+
+func (w WriteRequest) ConsistentRead() bool {
+	return false
+}
+
 // QueryMeta allows a query response to include potentially
 // useful metadata about a query
 type QueryMeta struct {
@@ -269,6 +331,65 @@ type RaftConfigurationResponse struct {
 	Index uint64
 }
 
+// StateExport is the state of a cluster, which can be imported into a cluster
+// of another version, whose raft log or snapshots are not compatible.
+type StateExport struct {
+	// Build is the version of the exporting manager
+	Build string
+	// Index is the raft index of the state
+	Index  uint64
+	Nodes  []*Node
+	Jobs   []*Job
+	Orders []*Order
+	Evals  []*Evaluation
+	Allocs []*Allocation
+	Quotas []*QuotaSpec
+}
+
+// StateExportResponse is used by the Operator endpoint to export the state
+type StateExportResponse struct {
+	State *StateExport
+	QueryMeta
+}
+
+// StateImportRequest is used by the Operator endpoint to import a state.
+// It is refused if the cluster has jobs, unless Force is set, in which case
+// the objects of the same IDs are replaced.
+type StateImportRequest struct {
+	State *StateExport
+	Force bool
+	WriteRequest
+}
+
+// StateImportResponse tells the number of objects imported
+type StateImportResponse struct {
+	Nodes  int
+	Jobs   int
+	Orders int
+	Evals  int
+	Allocs int
+	Quotas int
+	WriteMeta
+}
+
+// RaftStoreStats are the size of the raft store of a server and of the pages
+// freed in it, which the store reuses but never gives back.
+type RaftStoreStats struct {
+	SizeBytes     int64
+	FreePages     int
+	PendingPages  int
+	FreeBytes     int
+	FreelistBytes int
+}
+
+// RaftCompactResponse is the outcome of the compaction of the raft store of
+// a server
+type RaftCompactResponse struct {
+	Before   *RaftStoreStats
+	After    *RaftStoreStats
+	Duration time.Duration
+}
+
 // RaftPeerByAddressRequest is used by the Operator endpoint to apply a Raft
 // operation on a specific Raft peer by address in the form of "IP:port".
 type RaftPeerByAddressRequest struct {
@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// DefaultNamespace is the namespace of the jobs not giving one
+const DefaultNamespace = "default"
+
+// QuotaSpec limits the jobs of a namespace, for a team not to take the
+// whole cluster. A zero limit is no limit.
+type QuotaSpec struct {
+	// Namespace is the namespace limited by the quota
+	Namespace   string
+	Description string
+
+	// MaxJobs is the number of jobs which are not dead
+	MaxJobs int
+	// MaxFullCopies is the number of jobs doing their full copy at the same
+	// time. The others wait to be scheduled.
+	MaxFullCopies int
+	// MaxRowsPerSecond is the sum of RowsPerSecond of the Src tasks. Every
+	// job of the namespace has to set RowsPerSecond.
+	MaxRowsPerSecond int64
+
+	// ThrottleWindows are the throttle windows of the jobs of the namespace
+	// which have none. They are set in the jobs when they are registered.
+	ThrottleWindows []*ThrottleWindow
+
+	// Raft Indexes
+	CreateIndex uint64
+	ModifyIndex uint64
+}
+
+// Validate checks the quota before it is upserted
+func (q *QuotaSpec) Validate() error {
+	if q.Namespace == "" {
+		return fmt.Errorf("missing quota namespace")
+	}
+	if strings.Contains(q.Namespace, " ") {
+		return fmt.Errorf("quota namespace contains a space")
+	}
+	if q.MaxJobs < 0 || q.MaxFullCopies < 0 || q.MaxRowsPerSecond < 0 {
+		return fmt.Errorf("quota limits cannot be negative")
+	}
+	if _, err := NewThrottleSchedule(q.ThrottleWindows); err != nil {
+		return err
+	}
+	return nil
+}
+
+// QuotaUsage is the usage of a namespace against its quota
+type QuotaUsage struct {
+	Quota         *QuotaSpec
+	Jobs          int
+	FullCopies    int
+	RowsPerSecond int64
+}
+
+// QuotaUpsertRequest is used to create or update a quota
+type QuotaUpsertRequest struct {
+	Quota *QuotaSpec
+	WriteRequest
+}
+
+// QuotaDeleteRequest is used to delete the quota of a namespace
+type QuotaDeleteRequest struct {
+	Namespace string
+	WriteRequest
+}
+
+// QuotaSpecificRequest is used to get the quota of a namespace
+type QuotaSpecificRequest struct {
+	Namespace string
+	QueryOptions
+}
+
+// QuotaListRequest is used to list the quotas
+type QuotaListRequest struct {
+	QueryOptions
+}
+
+// SingleQuotaResponse returns a quota and its usage
+type SingleQuotaResponse struct {
+	Usage *QuotaUsage
+	QueryMeta
+}
+
+// QuotaListResponse returns the quotas and their usage
+type QuotaListResponse struct {
+	Usages []*QuotaUsage
+	QueryMeta
+}
+
+// CountsAgainstQuota tells whether a job uses its namespace quota.
+func (j *Job) CountsAgainstQuota() bool {
+	return j.Status != JobStatusDead && j.Status != JobStatusComplete
+}
+
+// FullCopying tells whether a job is doing, or is going to do, its full
+// copy: no task has a GTID to replicate from yet. The GTID is set once the
+// incremental replication starts.
+func (j *Job) FullCopying() bool {
+	if !j.CountsAgainstQuota() {
+		return false
+	}
+	for _, t := range j.Tasks {
+		if gtid, _ := t.Config["Gtid"].(string); gtid != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// RowsPerSecond returns the rows per second limit of the Src task, or 0.
+func (j *Job) RowsPerSecond() int64 {
+	for _, t := range j.Tasks {
+		if t.Type != TaskTypeSrc {
+			continue
+		}
+		var cfg struct{ RowsPerSecond int64 }
+		if err := mapstructure.WeakDecode(t.Config, &cfg); err == nil {
+			return cfg.RowsPerSecond
+		}
+	}
+	return 0
+}
+
+// SetThrottleWindows sets the throttle windows of the Src task of a job,
+// unless it has its own.
+func (j *Job) SetThrottleWindows(windows []*ThrottleWindow) {
+	if len(windows) == 0 {
+		return
+	}
+	for _, t := range j.Tasks {
+		if t.Type != TaskTypeSrc {
+			continue
+		}
+		if t.Config == nil {
+			t.Config = make(map[string]interface{})
+		}
+		switch own := t.Config["ThrottleWindows"].(type) {
+		case []interface{}:
+			if len(own) > 0 {
+				continue
+			}
+		case []*ThrottleWindow:
+			if len(own) > 0 {
+				continue
+			}
+		}
+		t.Config["ThrottleWindows"] = windows
+	}
+}
+
+// Add counts a job of the namespace in the usage.
+func (u *QuotaUsage) Add(job *Job) {
+	if !job.CountsAgainstQuota() {
+		return
+	}
+	u.Jobs++
+	if job.FullCopying() {
+		u.FullCopies++
+	}
+	u.RowsPerSecond += job.RowsPerSecond()
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// SLABreachLag is a breach of the SLA of a job by its lag going over
+	// MaxLagSeconds.
+	SLABreachLag = "lag"
+
+	// SLABreachDowntime is a breach of the SLA of a job by its time out of
+	// the SLA in a month going over MaxDowntimeSeconds.
+	SLABreachDowntime = "downtime"
+
+	// the windows and the breaches kept for a job
+	maxSLADays     = 31
+	maxSLAMonths   = 13
+	maxSLABreaches = 100
+)
+
+// SLASpec is the service level a job declares
+type SLASpec struct {
+	// MaxLagSeconds is how far the target may be behind the source. The time
+	// over it is out of the SLA.
+	MaxLagSeconds int64
+
+	// MaxDowntimeSeconds is the time a job may be out of the SLA in a
+	// calendar month (UTC): over MaxLagSeconds, or with its Dest task not
+	// sending samples, paused or failed. 0 is no downtime allowed.
+	MaxDowntimeSeconds int64
+}
+
+// Copy returns a copy of the spec
+func (s *SLASpec) Copy() *SLASpec {
+	if s == nil {
+		return nil
+	}
+	ns := *s
+	return &ns
+}
+
+// Validate is used to sanity check an SLA
+func (s *SLASpec) Validate() error {
+	if s.MaxLagSeconds <= 0 {
+		return errors.New("SLA MaxLagSeconds must be positive")
+	}
+	if s.MaxDowntimeSeconds < 0 {
+		return errors.New("SLA MaxDowntimeSeconds must not be negative")
+	}
+	return nil
+}
+
+// SLAWindow is the time of a job in and out of its SLA over a day or a month
+// (UTC). The time is measured from the first sample of the job.
+type SLAWindow struct {
+	Start            time.Time
+	MeasuredSeconds  int64
+	DownSeconds      int64
+	LagBreachSeconds int64
+	// MaxLagSeconds is the highest lag sampled
+	MaxLagSeconds int64
+	Breaches      int
+}
+
+// OutSeconds is the time the job was out of the SLA
+func (w *SLAWindow) OutSeconds() int64 {
+	return w.DownSeconds + w.LagBreachSeconds
+}
+
+// Compliance is the percentage of the measured time the job was in the SLA
+func (w *SLAWindow) Compliance() float64 {
+	if w.MeasuredSeconds == 0 {
+		return 100
+	}
+	return 100 * float64(w.MeasuredSeconds-w.OutSeconds()) / float64(w.MeasuredSeconds)
+}
+
+// SLABreach is a job going out of its SLA
+type SLABreach struct {
+	JobID string
+	Kind  string
+	Time  time.Time
+	// Seconds is the lag for a lag breach, and the time out of the SLA in
+	// the month for a downtime breach.
+	Seconds int64
+}
+
+// SLAStatus is the compliance of a job to its SLA by day and by month, oldest
+// first, computed from the samples of the job.
+type SLAStatus struct {
+	Days     []*SLAWindow
+	Months   []*SLAWindow
+	Breaches []*SLABreach
+	// LastSample is the time of the last sample, the downtime being the
+	// samples missing since.
+	LastSample time.Time
+	// InLagBreach is set while the lag is over MaxLagSeconds, so that a lag
+	// breach is recorded once.
+	InLagBreach bool
+}
+
+// Copy returns a copy of the status, sharing the breaches.
+func (s *SLAStatus) Copy() *SLAStatus {
+	if s == nil {
+		return nil
+	}
+	ns := *s
+	ns.Days = copySLAWindows(s.Days)
+	ns.Months = copySLAWindows(s.Months)
+	ns.Breaches = make([]*SLABreach, len(s.Breaches))
+	copy(ns.Breaches, s.Breaches)
+	return &ns
+}
+
+func copySLAWindows(windows []*SLAWindow) []*SLAWindow {
+	nw := make([]*SLAWindow, len(windows))
+	for i, w := range windows {
+		c := *w
+		nw[i] = &c
+	}
+	return nw
+}
+
+// Add accounts the sample of a job with the SLA spec, and returns the
+// breaches it makes. A gap of more than a sample since the last one is
+// downtime.
+func (s *SLAStatus) Add(jobID string, spec *SLASpec, sample *JobStatsSample) []*SLABreach {
+	if !sample.Time.After(s.LastSample) {
+		return nil
+	}
+	interval := int64(JobStatsInterval / time.Second)
+	var down int64
+	if !s.LastSample.IsZero() {
+		if elapsed := int64(sample.Time.Sub(s.LastSample) / time.Second); elapsed > 2*interval {
+			down = elapsed - interval
+		}
+	}
+	s.LastSample = sample.Time
+	lagBreach := sample.LagSeconds > spec.MaxLagSeconds
+
+	t := sample.Time.UTC()
+	day := s.window(&s.Days, time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), maxSLADays)
+	month := s.window(&s.Months, time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), maxSLAMonths)
+	overBudget := month.OutSeconds() > spec.MaxDowntimeSeconds
+	for _, w := range []*SLAWindow{day, month} {
+		w.MeasuredSeconds += interval + down
+		w.DownSeconds += down
+		if lagBreach {
+			w.LagBreachSeconds += interval
+		}
+		if sample.LagSeconds > w.MaxLagSeconds {
+			w.MaxLagSeconds = sample.LagSeconds
+		}
+	}
+
+	var breaches []*SLABreach
+	if lagBreach && !s.InLagBreach {
+		breaches = append(breaches, &SLABreach{JobID: jobID, Kind: SLABreachLag, Time: sample.Time, Seconds: sample.LagSeconds})
+	}
+	s.InLagBreach = lagBreach
+	if !overBudget && month.OutSeconds() > spec.MaxDowntimeSeconds {
+		breaches = append(breaches, &SLABreach{JobID: jobID, Kind: SLABreachDowntime, Time: sample.Time, Seconds: month.OutSeconds()})
+	}
+	for _, b := range breaches {
+		day.Breaches++
+		month.Breaches++
+		s.Breaches = append(s.Breaches, b)
+	}
+	if over := len(s.Breaches) - maxSLABreaches; over > 0 {
+		s.Breaches = append([]*SLABreach(nil), s.Breaches[over:]...)
+	}
+	return breaches
+}
+
+// window returns the window of windows starting at start, adding it if it
+// is new and dropping the oldest ones over max.
+func (s *SLAStatus) window(windows *[]*SLAWindow, start time.Time, max int) *SLAWindow {
+	if n := len(*windows); n > 0 && !(*windows)[n-1].Start.Before(start) {
+		return (*windows)[n-1]
+	}
+	w := &SLAWindow{Start: start}
+	*windows = append(*windows, w)
+	if over := len(*windows) - max; over > 0 {
+		*windows = append([]*SLAWindow(nil), (*windows)[over:]...)
+	}
+	return w
+}
+
+// Report returns the report of the compliance of job to its SLA at now. A
+// Dest task which has not sent a sample for two intervals is reported down.
+func (s *SLAStatus) Report(job *Job, now time.Time) *SLAReport {
+	r := &SLAReport{
+		JobID:     job.ID,
+		Name:      job.Name,
+		Namespace: job.Namespace,
+		SLA:       job.SLA,
+	}
+	if s == nil {
+		return r
+	}
+	for _, w := range s.Days {
+		r.Days = append(r.Days, newSLAWindowReport(w, nil))
+	}
+	for _, w := range s.Months {
+		r.Months = append(r.Months, newSLAWindowReport(w, job.SLA))
+	}
+	r.Breaches = s.Breaches
+	if !s.LastSample.IsZero() && now.Sub(s.LastSample) > 2*JobStatsInterval {
+		since := s.LastSample
+		r.DownSince = &since
+	}
+	return r
+}
+
+// Month returns the report of the month starting at start alone, with its
+// breaches.
+func (r *SLAReport) Month(start time.Time) *SLAReport {
+	m := *r
+	m.Days, m.Months, m.Breaches = nil, nil, nil
+	end := start.AddDate(0, 1, 0)
+	for _, w := range r.Months {
+		if w.Start.Equal(start) {
+			m.Months = append(m.Months, w)
+		}
+	}
+	for _, b := range r.Breaches {
+		if !b.Time.Before(start) && b.Time.Before(end) {
+			m.Breaches = append(m.Breaches, b)
+		}
+	}
+	return &m
+}
+
+// SLAReport is the compliance of a job to its SLA
+type SLAReport struct {
+	JobID     string
+	Name      string
+	Namespace string
+	SLA       *SLASpec
+	Days      []*SLAWindowReport
+	Months    []*SLAWindowReport
+	Breaches  []*SLABreach
+	// DownSince is the time of the last sample of a job not sending them
+	// anymore, nil if it does.
+	DownSince *time.Time
+}
+
+// SLAWindowReport is the compliance of a job over a window
+type SLAWindowReport struct {
+	*SLAWindow
+	OutSeconds int64
+	// Compliance is the percentage of the measured time in the SLA
+	Compliance float64
+	// Met tells if the time out of the SLA is within MaxDowntimeSeconds, for
+	// the months only.
+	Met bool
+}
+
+func newSLAWindowReport(w *SLAWindow, spec *SLASpec) *SLAWindowReport {
+	r := &SLAWindowReport{SLAWindow: w, OutSeconds: w.OutSeconds(), Compliance: w.Compliance()}
+	if spec != nil {
+		r.Met = r.OutSeconds <= spec.MaxDowntimeSeconds
+	}
+	return r
+}
+
+// JobSLARequest is used to get the SLA report of a job
+type JobSLARequest struct {
+	JobID string
+	QueryOptions
+}
+
+// JobSLAResponse is the SLA report of a job
+type JobSLAResponse struct {
+	Report *SLAReport
+	QueryMeta
+}
+
+// SLAReportsRequest is used to get the SLA reports of the jobs with an SLA
+// for a month
+type SLAReportsRequest struct {
+	// Month is the start of the month, in UTC
+	Month time.Time
+	// Namespace selects the jobs of a namespace, all of them if empty
+	Namespace string
+	QueryOptions
+}
+
+// SLAReportsResponse is the SLA reports of the jobs for a month
+type SLAReportsResponse struct {
+	Reports []*SLAReport
+	QueryMeta
+}
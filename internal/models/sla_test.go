@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSLAStatus_Add(t *testing.T) {
+	spec := &SLASpec{MaxLagSeconds: 30, MaxDowntimeSeconds: 300}
+	s := &SLAStatus{}
+	start := time.Date(2026, 9, 30, 23, 50, 0, 0, time.UTC)
+	add := func(minute int, lag int64) []*SLABreach {
+		return s.Add("job1", spec, &JobStatsSample{Time: start.Add(time.Duration(minute) * time.Minute), LagSeconds: lag})
+	}
+
+	add(0, 0)
+	if b := add(1, 45); len(b) != 1 || b[0].Kind != SLABreachLag || b[0].Seconds != 45 {
+		t.Fatalf("breaches = %v", b)
+	}
+	if b := add(2, 50); len(b) != 0 {
+		t.Errorf("a lag breach recorded twice: %v", b)
+	}
+	add(3, 0)
+	// samples missing for 4 minutes, over the budget of 5 with the lag
+	if b := add(8, 0); len(b) != 1 || b[0].Kind != SLABreachDowntime || b[0].Seconds != 360 {
+		t.Fatalf("breaches = %v", b)
+	}
+	if b := add(8, 0); b != nil {
+		t.Errorf("an old sample counted: %v", b)
+	}
+
+	sept := s.Months[0]
+	if sept.MeasuredSeconds != 8*60+60 || sept.DownSeconds != 240 || sept.LagBreachSeconds != 120 || sept.MaxLagSeconds != 50 {
+		t.Errorf("window = %+v", sept)
+	}
+	if c := sept.Compliance(); c < 33 || c > 34 {
+		t.Errorf("compliance = %v", c)
+	}
+
+	// a new month and a new day
+	add(10, 0)
+	if len(s.Months) != 2 || len(s.Days) != 2 || s.Months[1].MeasuredSeconds != 60 || s.Months[1].Breaches != 0 {
+		t.Fatalf("months = %+v, days = %+v", s.Months, s.Days)
+	}
+
+	job := &Job{ID: "job1", SLA: spec}
+	r := s.Report(job, start.Add(20*time.Minute))
+	if len(r.Months) != 2 || r.Months[0].Met || !r.Months[1].Met || r.DownSince == nil || len(r.Breaches) != 2 {
+		t.Errorf("report = %+v", r)
+	}
+	if m := r.Month(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)); len(m.Months) != 1 || len(m.Breaches) != 0 || m.Days != nil {
+		t.Errorf("month report = %+v", m)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// HasStandby returns whether the job has a hot standby of its Dest task.
+func (j *Job) HasStandby() bool {
+	return j.LookupTask(TaskTypeDestStandby) != nil
+}
+
+// validateStandby checks the DestStandby task of a job against its Dest
+// task: both are MySQL appliers, in the same group and on distinct nodes.
+func (j *Job) validateStandby() error {
+	standby := j.LookupTask(TaskTypeDestStandby)
+	if standby == nil {
+		return nil
+	}
+	var mErr multierror.Error
+	dest := j.LookupTask(TaskTypeDest)
+	if dest == nil {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Task %s requires a %s task", TaskTypeDestStandby, TaskTypeDest))
+		return mErr.ErrorOrNil()
+	}
+	if dest.Driver != TaskDriverMySQL || standby.Driver != TaskDriverMySQL {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Task %s requires %s and %s tasks of driver %s",
+			TaskTypeDestStandby, TaskTypeDest, TaskTypeDestStandby, TaskDriverMySQL))
+	}
+	if standby.Group != dest.Group {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Task %s is in group %q while task %s is in group %q",
+			TaskTypeDestStandby, standby.Group, TaskTypeDest, dest.Group))
+	}
+	if standby.NodeID != "" && standby.NodeID == dest.NodeID {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Tasks %s and %s are on the same node %v",
+			TaskTypeDest, TaskTypeDestStandby, dest.NodeID))
+	}
+	if standby.NodeName != "" && standby.NodeName == dest.NodeName {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Tasks %s and %s are on the same node %v",
+			TaskTypeDest, TaskTypeDestStandby, dest.NodeName))
+	}
+	return mErr.ErrorOrNil()
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJob_ValidateStandby(t *testing.T) {
+	job := &Job{
+		Tasks: []*Task{
+			{Type: TaskTypeSrc, Driver: TaskDriverMySQL},
+			{Type: TaskTypeDest, Driver: TaskDriverMySQL, NodeName: "node1"},
+		},
+	}
+	if job.HasStandby() {
+		t.Fatal("job without a standby has one")
+	}
+	if err := job.validateStandby(); err != nil {
+		t.Fatal(err)
+	}
+
+	job.Tasks = append(job.Tasks, &Task{Type: TaskTypeDestStandby, Driver: TaskDriverMySQL, NodeName: "node2"})
+	if !job.HasStandby() {
+		t.Fatal("job with a standby has none")
+	}
+	if err := job.validateStandby(); err != nil {
+		t.Fatal(err)
+	}
+
+	job.Tasks[2].NodeName = "node1"
+	job.Tasks[2].Group = "copy"
+	err := job.validateStandby()
+	if err == nil || !strings.Contains(err.Error(), "same node node1") || !strings.Contains(err.Error(), `group "copy"`) {
+		t.Fatalf("err = %v", err)
+	}
+
+	job.Tasks = []*Task{job.Tasks[0], job.Tasks[2]}
+	if err := job.validateStandby(); err == nil || !strings.Contains(err.Error(), "requires a Dest task") {
+		t.Fatalf("err = %v", err)
+	}
+}
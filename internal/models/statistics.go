@@ -20,6 +20,9 @@ const (
 	StageSendingData                                   = "Sending data"
 	StageSlaveHasReadAllRelayLog                       = "Slave has read all relay log; waiting for more updates"
 	StageSlaveWaitingForWorkersToProcessQueue          = "Waiting for slave workers to process their queues"
+	StageStandby                                       = "Standing by for the active applier"
+	StageTargetReadOnly                                = "Target is read-only; waiting for it to be writable"
+	StageThrottled                                     = "Throttled; waiting for the load of the target to drop"
 	StageWaitingForGtidToBeCommitted                   = "Waiting for GTID to be committed"
 	StageWaitingForMasterToSendEvent                   = "Waiting for master to send event"
 )
@@ -53,6 +56,45 @@ type BufferStat struct {
 	ApplierGroupTxQueueSize int
 	SendByTimeout           int
 	SendBySizeFull          int
+	ApplierSpillBytes       int64
+}
+
+// QueueStat is a bounded queue between two stages of the pipeline of a task,
+// sampled since the task started. A queue mostly full waits for its consumer
+// stage, and one mostly empty for its producer.
+type QueueStat struct {
+	// Name is the stage consuming the queue
+	Name string
+	// Policy is what the producer does when the queue is full, "block" or
+	// "drop"
+	Policy   string
+	Depth    int
+	Capacity int
+	FullPct  float64
+	EmptyPct float64
+	// Dropped is the number of entries dropped for the queue being full,
+	// sent again by the extractor
+	Dropped int64
+}
+
+// TrafficStat is the traffic of a task, for capacity planning and chargeback.
+type TrafficStat struct {
+	// ExtractedBytes is the size of the binlog events and rows read from the source
+	ExtractedBytes int64
+	// WireBytes is the compressed size of the messages sent (extractor) or received (applier)
+	WireBytes int64
+	// AppliedBytes is the size of the binlog events and rows written to the target
+	AppliedBytes int64
+	// Codec is the codec compressing the messages, of the last one received
+	// by an applier
+	Codec string
+	// UncompressedBytes and CompressedBytes are the sizes of the messages
+	// before and after their compression, whose ratio is that of the codec
+	UncompressedBytes int64
+	CompressedBytes   int64
+	// CodecNanos is the time spent compressing (extractor) or decompressing
+	// (applier) the messages
+	CodecNanos int64
 }
 
 type CurrentCoordinates struct {
@@ -80,8 +122,16 @@ type TaskStatistics struct {
 	ThroughputStat     *ThroughputStat
 	MsgStat            gonats.Statistics
 	BufferStat         BufferStat
+	TrafficStat        TrafficStat
 	Stage              string
-	Timestamp          int64
+	// Queues are the queues between the stages of the pipeline, in order
+	Queues []QueueStat
+	// LagSeconds is how far an applier is behind the source, see
+	// JobStatsSample
+	LagSeconds int64
+	// ThrottleReason is why an applier pauses its writes, see MaxLoad
+	ThrottleReason string
+	Timestamp      int64
 }
 
 type AllocStatistics struct {
@@ -10,21 +10,42 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/mitchellh/copystructure"
+	"github.com/mitchellh/mapstructure"
 	"sync"
+
+	"github.com/actiontech/dtle/internal"
 )
 
 const (
 	TaskTypeSrc  = "Src"
 	TaskTypeDest = "Dest"
-
-	TaskDriverMySQL  = "MySQL"
-	TaskDriverKafka  = "Kafka"
-	TaskDriverOracle = "Oracle"
+	// TaskTypeDestStandby is a hot standby of the Dest task, on another
+	// node. It receives the stream without applying it, and takes over
+	// when the applier of the Dest task stops.
+	TaskTypeDestStandby = "DestStandby"
+
+	// The step tasks run once to completion, between the MySQL instances
+	// of the Src and Dest tasks of their job: TaskTypeVerify compares the
+	// tables, TaskTypeCutover waits for the destination to be in sync with
+	// the source, TaskTypeSchemaMigration runs DDL on the destination and
+	// TaskTypeChecksum compares the checksums of the tables, chunk by chunk.
+	TaskTypeVerify          = "Verify"
+	TaskTypeCutover         = "Cutover"
+	TaskTypeSchemaMigration = "SchemaMigration"
+	TaskTypeChecksum        = "Checksum"
+
+	TaskDriverMySQL     = "MySQL"
+	TaskDriverKafka     = "Kafka"
+	TaskDriverOracle    = "Oracle"
+	TaskDriverExport    = "Export"
+	TaskDriverRedis     = "Redis"
+	TaskDriverWarehouse = "Warehouse"
 )
 
 // Task is a single process typically that is executed as part of a task.
@@ -47,6 +68,13 @@ type Task struct {
 	// task exits, other tasks will be gracefully terminated.
 	Leader bool
 
+	// DiskQuotaMB limits the size of the directory of the allocation,
+	// overriding the alloc_disk_quota_mb of the agent. 0 is the default.
+	DiskQuotaMB int
+
+	// Group is the task group of the task, one of the Groups of the job.
+	Group string
+
 	// Constraints can be specified at a task group level and apply to
 	// all the tasks contained.
 	Constraints []*Constraint
@@ -71,7 +99,7 @@ func (t *Task) Copy() *Task {
 
 	nt.ConfigLock.RLock()
 	defer nt.ConfigLock.RUnlock()
-	if i, err := copystructure.Copy(nt.Config); err != nil {
+	if i, err := copystructure.Copy(nt.Config); err == nil {
 		nt.Config = i.(map[string]interface{})
 		nt.ConfigLock = &sync.RWMutex{} // a lock per map, and a new map created.
 	}
@@ -86,6 +114,240 @@ func (t *Task) Canonicalize(job *Job) {
 	}
 }
 
+// IsStepTask tells if the tasks of the type are steps, which complete once
+// done instead of running until stopped.
+func IsStepTask(taskType string) bool {
+	switch taskType {
+	case TaskTypeVerify, TaskTypeCutover, TaskTypeSchemaMigration, TaskTypeChecksum:
+		return true
+	}
+	return false
+}
+
+// ValidTaskType tells if the type of a task is known.
+func ValidTaskType(taskType string) bool {
+	return taskType == TaskTypeSrc || taskType == TaskTypeDest || taskType == TaskTypeDestStandby ||
+		IsStepTask(taskType)
+}
+
+// WarmRestartConfig are the keys of the config of a task which a warm restart
+// of its job changes. They filter the changes of the source, and a running
+// task applies them without reconnecting.
+var WarmRestartConfig = []string{"ReplicateDoDb", "ReplicateIgnoreDb", "SqlFilter"}
+
+// checkpointConfig are the keys of the config of a task updated by the task
+// itself while it runs, or by the APIs resuming it: a new checkpoint disarms
+// the skip of a failing transaction.
+var checkpointConfig = []string{"Gtid", "NatsAddr", "CopyProgress", "SkipTx"}
+
+func isConfigKey(key string, keys []string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckWarmRestart returns an error if the task cannot be changed to next by
+// a warm restart, which changes only the keys of WarmRestartConfig.
+func (t *Task) CheckWarmRestart(next *Task) error {
+	if t.Type != next.Type || t.Driver != next.Driver {
+		return fmt.Errorf("a warm restart cannot change task %v of driver %v to task %v of driver %v",
+			t.Type, t.Driver, next.Type, next.Driver)
+	}
+	keys := make(map[string]struct{})
+	for k := range t.Config {
+		keys[k] = struct{}{}
+	}
+	for k := range next.Config {
+		keys[k] = struct{}{}
+	}
+	for k := range keys {
+		if isConfigKey(k, WarmRestartConfig) || isConfigKey(k, checkpointConfig) ||
+			isConfigKey(k, TunableConfig[t.Type]) {
+			continue
+		}
+		if !reflect.DeepEqual(t.Config[k], next.Config[k]) {
+			return fmt.Errorf("a warm restart cannot change %v of task %v, only %v",
+				k, t.Type, strings.Join(WarmRestartConfig, ", "))
+		}
+	}
+	return nil
+}
+
+// WarmRestartChanged tells if the keys of WarmRestartConfig differ between
+// the configs of the task and next.
+func (t *Task) WarmRestartChanged(next *Task) bool {
+	return !reflect.DeepEqual(warmRestartConfig(t.Config), warmRestartConfig(next.Config))
+}
+
+// SetWarmRestartConfig sets the keys of WarmRestartConfig of the config of
+// the task to the ones of next.
+func (t *Task) SetWarmRestartConfig(next *Task) {
+	t.replaceConfig(WarmRestartConfig, warmRestartConfig(next.Config))
+}
+
+func warmRestartConfig(config map[string]interface{}) map[string]interface{} {
+	warm := make(map[string]interface{})
+	for k, v := range config {
+		if isConfigKey(k, WarmRestartConfig) {
+			warm[k] = v
+		}
+	}
+	return warm
+}
+
+// TunableConfig are the keys of the config of the MySQL tasks, by task type,
+// which a running task applies at once: its rates, batch sizes and
+// parallelism, and the level of its logs. Tuning them needs no rescheduling.
+var TunableConfig = map[string][]string{
+	TaskTypeSrc:  {"RowsPerSecond", "ChunkSize", "GroupMaxSize", "GroupTimeout", "LogLevel"},
+	TaskTypeDest: {"TxGroupMaxTxs", "TxGroupTimeoutMs", "ParallelWorkers", "LogLevel"},
+}
+
+// CheckTunables returns an error if tunables sets keys of the config of the
+// task out of its TunableConfig, or invalid values.
+func (t *Task) CheckTunables(tunables map[string]interface{}) error {
+	if t.Driver != "" && t.Driver != TaskDriverMySQL {
+		return fmt.Errorf("task %v of driver %v has no tunables", t.Type, t.Driver)
+	}
+	keys := TunableConfig[t.Type]
+	if len(keys) == 0 {
+		return fmt.Errorf("task %v has no tunables", t.Type)
+	}
+	for k, v := range tunables {
+		if !isConfigKey(k, keys) {
+			return fmt.Errorf("%v of task %v is not tunable, only %v", k, t.Type, strings.Join(keys, ", "))
+		}
+		if strings.EqualFold(k, "LogLevel") {
+			var level string
+			if err := mapstructure.WeakDecode(v, &level); err != nil {
+				return fmt.Errorf("%v: %v", k, err)
+			}
+			switch strings.ToUpper(level) {
+			case "", "PANIC", "FATAL", "ERROR", "WARN", "WARNING", "INFO", "DEBUG":
+			default:
+				return fmt.Errorf("%v: unknown level %q", k, level)
+			}
+			continue
+		}
+		var n int64
+		if err := mapstructure.WeakDecode(v, &n); err != nil {
+			return fmt.Errorf("%v: %v", k, err)
+		}
+		// no RowsPerSecond is no limit
+		if n < 0 || n == 0 && !strings.EqualFold(k, "RowsPerSecond") {
+			return fmt.Errorf("%v must be positive, not %v", k, v)
+		}
+	}
+	return nil
+}
+
+// Tunables returns the keys of TunableConfig of the config of the task.
+func (t *Task) Tunables() map[string]interface{} {
+	tunables := make(map[string]interface{})
+	for k, v := range t.Config {
+		if isConfigKey(k, TunableConfig[t.Type]) {
+			tunables[k] = v
+		}
+	}
+	return tunables
+}
+
+// TunablesChanged tells if the keys of TunableConfig differ between the
+// configs of the task and next.
+func (t *Task) TunablesChanged(next *Task) bool {
+	return !reflect.DeepEqual(t.Tunables(), next.Tunables())
+}
+
+// SetTunables sets the keys of tunables in the config of the task.
+func (t *Task) SetTunables(tunables map[string]interface{}) {
+	t.replaceConfig(keysOf(tunables), tunables)
+}
+
+// Checkpoint returns the checkpoint in the config of the task: the GTID set
+// executed and the progress of the full copy.
+func (t *Task) Checkpoint() (string, *CopyProgress, error) {
+	var gtid string
+	if err := mapstructure.WeakDecode(t.Config["Gtid"], &gtid); err != nil {
+		return "", nil, fmt.Errorf("Gtid of task %v: %v", t.Type, err)
+	}
+	switch p := t.Config["CopyProgress"].(type) {
+	case nil:
+		return gtid, nil, nil
+	case *CopyProgress:
+		return gtid, p.Copy(), nil
+	default:
+		// as decoded from the raft log
+		var progress CopyProgress
+		if err := mapstructure.WeakDecode(p, &progress); err != nil {
+			return "", nil, fmt.Errorf("CopyProgress of task %v: %v", t.Type, err)
+		}
+		return gtid, &progress, nil
+	}
+}
+
+// SetCheckpoint sets the checkpoint in the config of the task. The copy
+// progress is kept by the Dest tasks only, without a GTID set.
+func (t *Task) SetCheckpoint(gtid string, progress *CopyProgress) {
+	checkpoint := map[string]interface{}{"Gtid": gtid}
+	if gtid == "" && progress != nil && (t.Type == TaskTypeDest || t.Type == TaskTypeDestStandby) {
+		checkpoint["CopyProgress"] = progress.Copy()
+	}
+	// the NatsAddr of the task is kept
+	t.replaceConfig([]string{"Gtid", "CopyProgress", "SkipTx"}, checkpoint)
+}
+
+// SkipTx returns the skip of a failing transaction armed in the config of
+// the task, nil if none is.
+func (t *Task) SkipTx() (*SkipTx, error) {
+	if t.Config["SkipTx"] == nil {
+		return nil, nil
+	}
+	var skip SkipTx
+	if err := mapstructure.WeakDecode(t.Config["SkipTx"], &skip); err != nil {
+		return nil, fmt.Errorf("SkipTx of task %v: %v", t.Type, err)
+	}
+	return &skip, nil
+}
+
+// SkipTxChanged tells if next arms another skip than the task.
+func (t *Task) SkipTxChanged(next *Task) bool {
+	cur, _ := t.SkipTx()
+	armed, _ := next.SkipTx()
+	return armed != nil && (cur == nil || cur.ID != armed.ID)
+}
+
+// SetSkipTx arms skip in the config of the task.
+func (t *Task) SetSkipTx(skip *SkipTx) {
+	t.replaceConfig([]string{"SkipTx"}, map[string]interface{}{"SkipTx": skip})
+}
+
+// replaceConfig replaces the keys of the config of the task, in any case,
+// by the ones of values. The config is a new map: a running task reads the
+// previous one.
+func (t *Task) replaceConfig(keys []string, values map[string]interface{}) {
+	config := make(map[string]interface{}, len(t.Config)+len(values))
+	for k, v := range t.Config {
+		if !isConfigKey(k, keys) {
+			config[k] = v
+		}
+	}
+	for k, v := range values {
+		config[k] = v
+	}
+	t.Config = config
+}
+
+func keysOf(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 func (t *Task) GoString() string {
 	return fmt.Sprintf("*%#v", *t)
 }
@@ -95,6 +357,8 @@ func (t *Task) Validate() error {
 	var mErr multierror.Error
 	if t.Type == "" {
 		mErr.Errors = append(mErr.Errors, errors.New("Missing task type"))
+	} else if !ValidTaskType(t.Type) {
+		mErr.Errors = append(mErr.Errors, fmt.Errorf("Unknown task type %q", t.Type))
 	}
 	if strings.ContainsAny(t.Type, `/\`) {
 		// We enforce this so that when creating the directory on disk it will
@@ -121,6 +385,9 @@ const (
 	TaskStateLost     = "lost"
 )
 
+// MaxTaskEvents is the number of the last events kept in a task state
+const MaxTaskEvents = 10
+
 // TaskState tracks the current store of a task and events that caused store
 // transitions.
 type TaskState struct {
@@ -140,6 +407,10 @@ type TaskState struct {
 
 	// Series of task events that transition the state of the task.
 	Events []*TaskEvent
+
+	// EventsDelta is set by the clients sending in Events only the events
+	// appended since their last update of the allocation
+	EventsDelta bool
 }
 
 func (ts *TaskState) Copy() *TaskState {
@@ -151,6 +422,7 @@ func (ts *TaskState) Copy() *TaskState {
 	copy.Failed = ts.Failed
 	copy.StartedAt = ts.StartedAt
 	copy.FinishedAt = ts.FinishedAt
+	copy.EventsDelta = ts.EventsDelta
 
 	if ts.Events != nil {
 		copy.Events = make([]*TaskEvent, len(ts.Events))
@@ -161,6 +433,40 @@ func (ts *TaskState) Copy() *TaskState {
 	return copy
 }
 
+// MergeTaskStates returns the task states of an allocation updated by a
+// client, appending the events of the states sent as deltas to the stored
+// ones. The events of a delta already stored, of a retried update, are
+// skipped.
+func MergeTaskStates(stored, update map[string]*TaskState) map[string]*TaskState {
+	merged := make(map[string]*TaskState, len(update))
+	for name, ts := range update {
+		if !ts.EventsDelta {
+			merged[name] = ts
+			continue
+		}
+		var events []*TaskEvent
+		var last time.Time
+		if old := stored[name]; old != nil && len(old.Events) > 0 {
+			events = append(events, old.Events...)
+			last = old.Events[len(old.Events)-1].Time
+		}
+		for _, e := range ts.Events {
+			if e.Time.After(last) {
+				events = append(events, e)
+			}
+		}
+		if len(events) > MaxTaskEvents {
+			events = events[len(events)-MaxTaskEvents:]
+		}
+
+		m := *ts
+		m.Events = events
+		m.EventsDelta = false
+		merged[name] = &m
+	}
+	return merged
+}
+
 // Successful returns whether a task finished successfully.
 func (ts *TaskState) Successful() bool {
 	l := len(ts.Events)
@@ -169,6 +475,9 @@ func (ts *TaskState) Successful() bool {
 	}
 
 	e := ts.Events[l-1]
+	if e.Type == TaskStepCompleted {
+		return true
+	}
 	if e.Type != TaskTerminated {
 		return false
 	}
@@ -219,6 +528,36 @@ const (
 
 	// TaskLeaderDead indicates that the leader task within the has finished.
 	TaskLeaderDead = "Leader Task Dead"
+
+	// TaskDiskExceeded indicates that the directory of the allocation is
+	// over its quota, and the task is killed.
+	TaskDiskExceeded = "Disk Quota Exceeded"
+
+	// TaskStepCompleted indicates that a step task is done, with its result
+	// in the message.
+	TaskStepCompleted = "Step Completed"
+
+	// TaskWarmRestarted indicates that the task applied the config of a warm
+	// restart of its job, without restarting.
+	TaskWarmRestarted = "Warm Restarted"
+
+	// TaskTuned indicates that the task applied new values of its
+	// TunableConfig, or failed to with the driver error set.
+	TaskTuned = "Tuned"
+
+	// TaskSourceDegraded indicates that the metadata queries of the task on
+	// its source keep failing, and wait before being retried. The driver
+	// error is the last failure.
+	TaskSourceDegraded = "Source Degraded"
+
+	// TaskSourceRecovered indicates that a metadata query of the task
+	// succeeded on its degraded source.
+	TaskSourceRecovered = "Source Recovered"
+
+	// TaskTxSkipped indicates that the task skipped a transaction failing on
+	// its target, as armed by the skip-tx API. The driver message tells the
+	// transaction, the driver error why it failed.
+	TaskTxSkipped = "Transaction Skipped"
 )
 
 // TaskEvent is an event that effects the state of a task and contains meta-data
@@ -270,6 +609,9 @@ type TaskEvent struct {
 
 	// DriverMessage indicates a driver action being taken.
 	DriverMessage string
+
+	// Checksums are the tables compared by a completed Checksum step.
+	Checksums []*TableChecksum
 }
 
 func (te *TaskEvent) GoString() string {
@@ -282,6 +624,12 @@ func (te *TaskEvent) SetMessage(msg string) *TaskEvent {
 	return te
 }
 
+// SetChecksums sets the tables compared by a Checksum step
+func (te *TaskEvent) SetChecksums(checksums []*TableChecksum) *TaskEvent {
+	te.Checksums = checksums
+	return te
+}
+
 func (te *TaskEvent) Copy() *TaskEvent {
 	if te == nil {
 		return nil
@@ -383,10 +731,62 @@ func (e *TaskEvent) SetDriverMessage(m string) *TaskEvent {
 	return e
 }
 
+// SkipTx arms a Dest task to skip the next transaction failing on its
+// target, as sql_slave_skip_counter=1 does. The transaction is recorded in
+// the skipped_tx table of the target, which an arm is recorded in once.
+type SkipTx struct {
+	ID string
+	// Gtid is the only transaction to skip, if set
+	Gtid string
+	// Reason is recorded with the skipped transaction
+	Reason string
+}
+
 type TaskUpdate struct {
 	JobID    string
 	Gtid     string
 	NatsAddr string
+	// CopyProgress is the progress of the full copy applied by a Dest task
+	CopyProgress *CopyProgress
+}
+
+// CopyProgress is the progress of a full copy, so that an interrupted copy
+// resumes instead of starting again.
+type CopyProgress struct {
+	// The binlog coordinates of the snapshot the copy started with. The
+	// replication starts there, also after a resumed copy.
+	Gtid    string
+	LogFile string
+	LogPos  int64
+	// Tables are the watermarks of the tables by "schema.table"
+	Tables map[string]*ChunkWatermark
+}
+
+// ChunkWatermark is the last chunk of a table applied by the full copy. The
+// chunks are ranges of a unique key, the copy goes on after LastMaxVals.
+type ChunkWatermark struct {
+	UniqueKey   string
+	Iteration   int64
+	LastMaxVals []string
+	// rows applied, for the row count of the table
+	Rows int64
+	// all the rows of the table are applied
+	Done bool
+}
+
+// Copy returns a deep copy of the progress
+func (p *CopyProgress) Copy() *CopyProgress {
+	if p == nil {
+		return nil
+	}
+	np := *p
+	np.Tables = make(map[string]*ChunkWatermark, len(p.Tables))
+	for k, w := range p.Tables {
+		nw := *w
+		nw.LastMaxVals = internal.CopySliceString(w.LastMaxVals)
+		np.Tables[k] = &nw
+	}
+	return &np
 }
 
 const (
@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// The statuses of a task group of a job. The groups run one after the other,
+// a group being complete once all its tasks completed successfully.
+const (
+	TaskGroupStatusPending  = "pending"
+	TaskGroupStatusRunning  = "running"
+	TaskGroupStatusComplete = "complete"
+)
+
+// TaskGroupState is the status of a task group of a job.
+type TaskGroupState struct {
+	Name   string
+	Status string
+
+	// ModifyIndex is the raft index of the last change of the status
+	ModifyIndex uint64
+}
+
+func (s *TaskGroupState) Copy() *TaskGroupState {
+	if s == nil {
+		return nil
+	}
+	ns := new(TaskGroupState)
+	*ns = *s
+	return ns
+}
+
+func copyTaskGroupStates(states []*TaskGroupState) []*TaskGroupState {
+	if states == nil {
+		return nil
+	}
+	ns := make([]*TaskGroupState, len(states))
+	for i, s := range states {
+		ns[i] = s.Copy()
+	}
+	return ns
+}
+
+func (j *Job) validateGroups() error {
+	var mErr multierror.Error
+	if len(j.Groups) == 0 {
+		for _, t := range j.Tasks {
+			if t.Group != "" {
+				mErr.Errors = append(mErr.Errors, fmt.Errorf("Task %s is in group %q while the job has no groups", t.Type, t.Group))
+			}
+		}
+		return mErr.ErrorOrNil()
+	}
+
+	tasks := make(map[string]int)
+	for _, g := range j.Groups {
+		if g == "" {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("Job group name is empty"))
+		} else if _, ok := tasks[g]; ok {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("Job group %q is defined twice", g))
+		}
+		tasks[g] = 0
+	}
+	for _, t := range j.Tasks {
+		if _, ok := tasks[t.Group]; !ok || t.Group == "" {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("Task %s is in unknown group %q", t.Type, t.Group))
+			continue
+		}
+		tasks[t.Group]++
+	}
+	for _, g := range j.Groups {
+		if g != "" && tasks[g] == 0 {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("Job group %q has no tasks", g))
+		}
+	}
+	return mErr.ErrorOrNil()
+}
+
+// InitGroupStates sets the states of the task groups of a job being
+// registered at the index. The progress of the existing job is kept if it has
+// the same groups, otherwise the first group is started.
+func (j *Job) InitGroupStates(index uint64, existing *Job) {
+	if len(j.Groups) == 0 {
+		j.GroupStates = nil
+		return
+	}
+	if existing != nil && len(existing.GroupStates) == len(j.Groups) {
+		same := true
+		for i, s := range existing.GroupStates {
+			same = same && s.Name == j.Groups[i]
+		}
+		if same {
+			j.GroupStates = copyTaskGroupStates(existing.GroupStates)
+			return
+		}
+	}
+
+	j.GroupStates = make([]*TaskGroupState, len(j.Groups))
+	for i, g := range j.Groups {
+		j.GroupStates[i] = &TaskGroupState{
+			Name:        g,
+			Status:      TaskGroupStatusPending,
+			ModifyIndex: index,
+		}
+	}
+	j.GroupStates[0].Status = TaskGroupStatusRunning
+}
+
+// TaskGroupStarted returns whether the tasks of the group are to run: the
+// group is running or complete, or the job has no groups.
+func (j *Job) TaskGroupStarted(group string) bool {
+	if len(j.Groups) == 0 {
+		return true
+	}
+	for _, s := range j.GroupStates {
+		if s.Name == group {
+			return s.Status != TaskGroupStatusPending
+		}
+	}
+	return false
+}
+
+// RunningTaskGroup returns the state of the running task group, or nil.
+func (j *Job) RunningTaskGroup() *TaskGroupState {
+	for _, s := range j.GroupStates {
+		if s.Status == TaskGroupStatusRunning {
+			return s
+		}
+	}
+	return nil
+}
+
+// TaskGroupsPending returns whether some task groups are not complete yet.
+func (j *Job) TaskGroupsPending() bool {
+	for _, s := range j.GroupStates {
+		if s.Status != TaskGroupStatusComplete {
+			return true
+		}
+	}
+	return false
+}
+
+// CompleteTaskGroup marks the running task group complete and starts the
+// next one at the index. It returns the name of the group started, or "" if
+// it was the last. The job must be a copy.
+func (j *Job) CompleteTaskGroup(index uint64) string {
+	for i, s := range j.GroupStates {
+		if s.Status != TaskGroupStatusRunning {
+			continue
+		}
+		s.Status = TaskGroupStatusComplete
+		s.ModifyIndex = index
+		if i+1 < len(j.GroupStates) {
+			next := j.GroupStates[i+1]
+			next.Status = TaskGroupStatusRunning
+			next.ModifyIndex = index
+			return next.Name
+		}
+		return ""
+	}
+	return ""
+}
+
+// AllocDone returns whether the allocation of the job completed its work
+// for good and must not be placed again: a step, or any task of a job with
+// task groups, which completed successfully. The job may be nil.
+func (j *Job) AllocDone(a *Allocation) bool {
+	if !IsStepTask(a.Task) && (j == nil || len(j.Groups) == 0) {
+		return false
+	}
+	return a.RanSuccessfully()
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJob_TaskGroups(t *testing.T) {
+	job := &Job{
+		Groups: []string{"schema", "copy"},
+		Tasks: []*Task{
+			{Type: TaskTypeSchemaMigration, Group: "schema"},
+			{Type: TaskTypeSrc, Group: "copy"},
+			{Type: TaskTypeDest, Group: "copy"},
+		},
+	}
+	if err := job.validateGroups(); err != nil {
+		t.Fatal(err)
+	}
+
+	job.InitGroupStates(5, nil)
+	if !job.TaskGroupStarted("schema") || job.TaskGroupStarted("copy") {
+		t.Fatalf("states after init = %+v %+v", job.GroupStates[0], job.GroupStates[1])
+	}
+	if next := job.CompleteTaskGroup(9); next != "copy" || !job.TaskGroupStarted("copy") {
+		t.Fatalf("next group = %q", next)
+	}
+	if g := job.RunningTaskGroup(); g == nil || g.Name != "copy" || g.ModifyIndex != 9 {
+		t.Fatalf("running group = %+v", g)
+	}
+
+	// the progress is kept when the job is registered again
+	again := job.Copy()
+	again.GroupStates = nil
+	again.InitGroupStates(12, job)
+	if g := again.RunningTaskGroup(); g == nil || g.Name != "copy" {
+		t.Fatalf("running group after register = %+v", g)
+	}
+	again.Groups = []string{"copy", "schema"}
+	again.InitGroupStates(13, job)
+	if g := again.RunningTaskGroup(); g == nil || g.Name != "copy" || g.ModifyIndex != 13 {
+		t.Fatalf("running group after reordering = %+v", g)
+	}
+
+	if next := job.CompleteTaskGroup(10); next != "" || job.TaskGroupsPending() {
+		t.Fatalf("groups after the last = %q %+v", next, job.GroupStates[1])
+	}
+
+	done := &Allocation{Task: TaskTypeSrc, TaskStates: map[string]*TaskState{
+		TaskTypeSrc: {State: TaskStateDead, Events: []*TaskEvent{NewTaskEvent(TaskTerminated)}},
+	}}
+	if !job.AllocDone(done) {
+		t.Error("a completed task of a group is not done")
+	}
+	if (&Job{}).AllocDone(done) {
+		t.Error("a completed task of a job without groups is done")
+	}
+
+	job.Tasks[0].Group = "missing"
+	job.Groups = append(job.Groups, "copy")
+	err := job.validateGroups()
+	for _, want := range []string{`unknown group "missing"`, `"copy" is defined twice`, `"schema" has no tasks`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("validation error %v, want %q", err, want)
+		}
+	}
+	if err := (&Job{Tasks: []*Task{{Type: TaskTypeSrc, Group: "copy"}}}).validateGroups(); err == nil {
+		t.Error("a task in a group of a job without groups is valid")
+	}
+}
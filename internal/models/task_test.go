@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTask_WarmRestart(t *testing.T) {
+	cur := &Task{Type: TaskTypeSrc, Driver: TaskDriverMySQL, Config: map[string]interface{}{
+		"ConnectionConfig": map[string]interface{}{"Host": "a", "Port": 3306},
+		"ReplicateDoDb":    []interface{}{map[string]interface{}{"TableSchema": "db1"}},
+		"Gtid":             "uuid:1-10",
+	}}
+	next := &Task{Type: TaskTypeSrc, Driver: TaskDriverMySQL, Config: map[string]interface{}{
+		"ConnectionConfig": map[string]interface{}{"Host": "a", "Port": 3306},
+		"replicateDoDb":    []interface{}{map[string]interface{}{"TableSchema": "db2"}},
+		"SqlFilter":        []interface{}{"NoDDL"},
+	}}
+	if err := cur.CheckWarmRestart(next); err != nil {
+		t.Fatal(err)
+	}
+	if !cur.WarmRestartChanged(next) {
+		t.Fatal("the filters changed")
+	}
+
+	stored := cur.Config
+	cur.SetWarmRestartConfig(next)
+	if _, ok := stored["SqlFilter"]; ok {
+		t.Error("the previous config was changed")
+	}
+	if cur.Config["Gtid"] != "uuid:1-10" || cur.Config["SqlFilter"] == nil || cur.Config["ReplicateDoDb"] != nil {
+		t.Errorf("config = %v", cur.Config)
+	}
+	if cur.WarmRestartChanged(next) {
+		t.Error("the filters are the same once set")
+	}
+
+	next.Config["ConnectionConfig"] = map[string]interface{}{"Host": "b", "Port": 3306}
+	if err := cur.CheckWarmRestart(next); err == nil || !strings.Contains(err.Error(), "ConnectionConfig") {
+		t.Errorf("err = %v", err)
+	}
+	next.Driver = TaskDriverKafka
+	if err := cur.CheckWarmRestart(next); err == nil {
+		t.Error("a warm restart changed the driver")
+	}
+}
+
+func TestTask_Tunables(t *testing.T) {
+	cur := &Task{Type: TaskTypeDest, Driver: TaskDriverMySQL, Config: map[string]interface{}{
+		"ConnectionConfig": map[string]interface{}{"Host": "a", "Port": 3306},
+		"ParallelWorkers":  8,
+	}}
+	tunables := map[string]interface{}{"parallelWorkers": 4, "LogLevel": "debug"}
+	if err := cur.CheckTunables(tunables); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []map[string]interface{}{
+		{"RowsPerSecond": 100},
+		{"ParallelWorkers": 0},
+		{"TxGroupMaxTxs": "many"},
+		{"LogLevel": "verbose"},
+	} {
+		if err := cur.CheckTunables(bad); err == nil {
+			t.Errorf("%v is a tunable of task %v", bad, cur.Type)
+		}
+	}
+	src := &Task{Type: TaskTypeSrc}
+	if err := src.CheckTunables(map[string]interface{}{"RowsPerSecond": 0}); err != nil {
+		t.Errorf("no RowsPerSecond: %v", err)
+	}
+
+	next := cur.Copy()
+	stored := cur.Config
+	next.SetTunables(tunables)
+	if stored["ParallelWorkers"] != 8 {
+		t.Error("the previous config was changed")
+	}
+	if _, ok := next.Config["ParallelWorkers"]; ok || next.Config["parallelWorkers"] != 4 || next.Config["ConnectionConfig"] == nil {
+		t.Errorf("config = %v", next.Config)
+	}
+	if !cur.TunablesChanged(next) {
+		t.Error("the tunables changed")
+	}
+	if err := cur.CheckWarmRestart(next); err != nil {
+		t.Errorf("a warm restart with other tunables: %v", err)
+	}
+}
+
+func TestTask_Checkpoint(t *testing.T) {
+	cur := &Task{Type: TaskTypeDest, Config: map[string]interface{}{
+		"ConnectionConfig": map[string]interface{}{"Host": "a", "Port": 3306},
+		"NatsAddr":         "127.0.0.1:8193",
+		// as decoded from the raft log
+		"CopyProgress": map[string]interface{}{
+			"Gtid": "uuid:1-10", "LogFile": "bin.000002", "LogPos": 154,
+			"Tables": map[string]interface{}{
+				"db1.tb1": map[string]interface{}{"UniqueKey": "PRIMARY", "Iteration": 3, "LastMaxVals": []interface{}{"300"}},
+			},
+		},
+	}}
+	gtid, progress, err := cur.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gtid != "" || progress == nil || progress.LogPos != 154 || progress.Tables["db1.tb1"].LastMaxVals[0] != "300" {
+		t.Fatalf("gtid = %q, progress = %+v", gtid, progress)
+	}
+
+	progress.Tables["db1.tb1"].Done = true
+	stored := cur.Config
+	cur.SetCheckpoint("", progress)
+	if _, ok := stored["CopyProgress"].(map[string]interface{}); !ok {
+		t.Error("the previous config was changed")
+	}
+	if _, progress, _ = cur.Checkpoint(); progress == nil || !progress.Tables["db1.tb1"].Done {
+		t.Errorf("progress = %+v", progress)
+	}
+
+	cur.SetCheckpoint("uuid:1-20", progress)
+	gtid, progress, err = cur.Checkpoint()
+	if err != nil || gtid != "uuid:1-20" || progress != nil {
+		t.Errorf("gtid = %q, progress = %+v, err = %v", gtid, progress, err)
+	}
+	if cur.Config["NatsAddr"] != "127.0.0.1:8193" || cur.Config["ConnectionConfig"] == nil {
+		t.Errorf("config = %v", cur.Config)
+	}
+
+	src := &Task{Type: TaskTypeSrc, Config: map[string]interface{}{}}
+	src.SetCheckpoint("", progress)
+	if _, ok := src.Config["CopyProgress"]; ok {
+		t.Error("the copy progress is kept by the Dest task")
+	}
+}
+
+func TestTask_SkipTx(t *testing.T) {
+	cur := &Task{Type: TaskTypeDest, Config: map[string]interface{}{"Gtid": "uuid:1-10"}}
+	if skip, err := cur.SkipTx(); skip != nil || err != nil {
+		t.Fatalf("skip = %+v, err = %v", skip, err)
+	}
+
+	next := &Task{Type: TaskTypeDest, Config: cur.Config}
+	next.SetSkipTx(&SkipTx{ID: "s1", Gtid: "uuid:11", Reason: "duplicate key"})
+	if _, ok := cur.Config["SkipTx"]; ok {
+		t.Error("the previous config was changed")
+	}
+	if !cur.SkipTxChanged(next) || next.SkipTxChanged(next) || next.SkipTxChanged(cur) {
+		t.Error("a skip is armed by the next task only")
+	}
+
+	// as decoded from the raft log
+	cur.Config = map[string]interface{}{
+		"SkipTx": map[string]interface{}{"ID": "s1", "Gtid": "uuid:11", "Reason": "duplicate key"},
+	}
+	skip, err := cur.SkipTx()
+	if err != nil || skip == nil || skip.ID != "s1" || skip.Gtid != "uuid:11" {
+		t.Fatalf("skip = %+v, err = %v", skip, err)
+	}
+	if cur.SkipTxChanged(next) {
+		t.Error("the skip armed is the same")
+	}
+
+	next.SetCheckpoint("uuid:1-11", nil)
+	if skip, _ := next.SkipTx(); skip != nil {
+		t.Errorf("a new checkpoint disarms the skip, got %+v", skip)
+	}
+}
+
+func TestJob_CopyConfig(t *testing.T) {
+	job := &Job{ID: "job1", Tasks: []*Task{{Type: TaskTypeDest, Config: map[string]interface{}{
+		"Gtid":         "uuid:1-10",
+		"CopyProgress": &CopyProgress{Tables: map[string]*ChunkWatermark{"db1.tb1": {Rows: 10}}},
+	}}, {Type: TaskTypeSrc}}}
+
+	copied := job.Copy()
+	dest := copied.Tasks[0]
+	dest.SetTunables(map[string]interface{}{"ParallelWorkers": 4})
+	dest.Config["Gtid"] = "uuid:1-20"
+	dest.Config["CopyProgress"].(*CopyProgress).Tables["db1.tb1"].Rows = 20
+	if dest.ConfigLock == job.Tasks[0].ConfigLock {
+		t.Error("the copy shares the config lock")
+	}
+	stored := job.Tasks[0].Config
+	if stored["Gtid"] != "uuid:1-10" || stored["ParallelWorkers"] != nil ||
+		stored["CopyProgress"].(*CopyProgress).Tables["db1.tb1"].Rows != 10 {
+		t.Errorf("the stored config was changed: %v", stored)
+	}
+	if copied.Tasks[1].Config != nil {
+		t.Errorf("config of the Src task = %v", copied.Tasks[1].Config)
+	}
+}
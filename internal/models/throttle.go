@@ -0,0 +1,167 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ThrottleWindow is a time window, e.g. the business hours, in which the
+// copy of a job is limited to RowsPerSecond, or paused if it is 0. Out of
+// its windows a job copies at full speed, or at its own RowsPerSecond.
+type ThrottleWindow struct {
+	// Days are the days the window starts, e.g. ["Mon-Fri"] or ["Sat", "Sun"].
+	// The window is every day if there are none.
+	Days []string
+	// Start and End are times like "09:00". A window whose End is not after
+	// its Start ends the next day.
+	Start string
+	End   string
+	// Timezone is an IANA time zone, e.g. "Asia/Shanghai". The local time
+	// of the agent is used if it is empty.
+	Timezone      string
+	RowsPerSecond int64
+}
+
+func (w *ThrottleWindow) String() string {
+	days := "daily"
+	if len(w.Days) > 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	s := fmt.Sprintf("%s %s-%s", days, w.Start, w.End)
+	if w.Timezone != "" {
+		s += " " + w.Timezone
+	}
+	return s
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) >= 3 {
+		if d, ok := weekdays[s[:3]]; ok {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("bad day %q", s)
+}
+
+// parseClock parses "15:04" to the duration since midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("bad time %q, want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+type throttleWindow struct {
+	*ThrottleWindow
+	loc        *time.Location
+	start, end time.Duration
+	days       [7]bool
+}
+
+// ThrottleSchedule tells the throttle window of a time.
+type ThrottleSchedule struct {
+	windows []*throttleWindow
+}
+
+// NewThrottleSchedule checks and prepares the windows. The schedule is nil
+// if there are no windows.
+func NewThrottleSchedule(windows []*ThrottleWindow) (*ThrottleSchedule, error) {
+	if len(windows) == 0 {
+		return nil, nil
+	}
+	s := &ThrottleSchedule{}
+	for i, w := range windows {
+		tw := &throttleWindow{ThrottleWindow: w, loc: time.Local}
+		var err error
+		if tw.start, err = parseClock(w.Start); err != nil {
+			return nil, fmt.Errorf("throttle window %d: %v", i+1, err)
+		}
+		if tw.end, err = parseClock(w.End); err != nil {
+			return nil, fmt.Errorf("throttle window %d: %v", i+1, err)
+		}
+		if w.Timezone != "" {
+			if tw.loc, err = time.LoadLocation(w.Timezone); err != nil {
+				return nil, fmt.Errorf("throttle window %d: %v", i+1, err)
+			}
+		}
+		if w.RowsPerSecond < 0 {
+			return nil, fmt.Errorf("throttle window %d: negative RowsPerSecond", i+1)
+		}
+		if len(w.Days) == 0 {
+			for d := range tw.days {
+				tw.days[d] = true
+			}
+		}
+		for _, days := range w.Days {
+			from, to := days, days
+			if dash := strings.Index(days, "-"); dash >= 0 {
+				from, to = days[:dash], days[dash+1:]
+			}
+			first, err := parseWeekday(from)
+			if err != nil {
+				return nil, fmt.Errorf("throttle window %d: %v", i+1, err)
+			}
+			last, err := parseWeekday(to)
+			if err != nil {
+				return nil, fmt.Errorf("throttle window %d: %v", i+1, err)
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				tw.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+		s.windows = append(s.windows, tw)
+	}
+	return s, nil
+}
+
+// At returns the first window open at t, and how long it stays open. The
+// window is nil if t is out of the windows.
+func (s *ThrottleSchedule) At(t time.Time) (*ThrottleWindow, time.Duration) {
+	if s == nil {
+		return nil, 0
+	}
+	for _, w := range s.windows {
+		if remaining := w.remaining(t); remaining > 0 {
+			return w.ThrottleWindow, remaining
+		}
+	}
+	return nil, 0
+}
+
+func (w *throttleWindow) remaining(t time.Time) time.Duration {
+	t = t.In(w.loc)
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	day := t.Weekday()
+	if w.start < w.end {
+		if w.days[day] && now >= w.start && now < w.end {
+			return w.end - now
+		}
+		return 0
+	}
+	// the window ends the next day
+	if w.days[day] && now >= w.start {
+		return 24*time.Hour - now + w.end
+	}
+	if w.days[(day+6)%7] && now < w.end {
+		return w.end - now
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottleSchedule(t *testing.T) {
+	s, err := NewThrottleSchedule([]*ThrottleWindow{
+		{Days: []string{"Mon-Fri"}, Start: "09:00", End: "18:00", Timezone: "UTC", RowsPerSecond: 100},
+		{Days: []string{"Sat"}, Start: "22:00", End: "02:00", Timezone: "UTC"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	cases := []struct {
+		time      string
+		rows      int64
+		remaining time.Duration
+	}{
+		// 2018-01-01 is a Monday
+		{"2018-01-01 08:59", -1, 0},
+		{"2018-01-01 09:00", 100, 9 * time.Hour},
+		{"2018-01-05 17:30", 100, 30 * time.Minute},
+		{"2018-01-06 12:00", -1, 0},
+		{"2018-01-06 23:00", 0, 3 * time.Hour},
+		{"2018-01-07 01:00", 0, time.Hour},
+		{"2018-01-07 03:00", -1, 0},
+	}
+	for _, c := range cases {
+		w, remaining := s.At(at(c.time))
+		rows := int64(-1)
+		if w != nil {
+			rows = w.RowsPerSecond
+		}
+		if rows != c.rows || remaining != c.remaining {
+			t.Errorf("%v: window rows %d for %v, want %d for %v", c.time, rows, remaining, c.rows, c.remaining)
+		}
+	}
+
+	// the time zone of the window
+	s, err = NewThrottleSchedule([]*ThrottleWindow{{Start: "09:00", End: "18:00", Timezone: "Asia/Shanghai"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := s.At(at("2018-01-01 02:00")); w == nil {
+		t.Errorf("02:00 UTC is 10:00 in Shanghai")
+	}
+
+	for _, w := range []*ThrottleWindow{
+		{Start: "9", End: "18:00"},
+		{Start: "09:00", End: "18:00", Timezone: "Nowhere/City"},
+		{Days: []string{"Funday"}, Start: "09:00", End: "18:00"},
+		{Start: "09:00", End: "18:00", RowsPerSecond: -1},
+	} {
+		if _, err := NewThrottleSchedule([]*ThrottleWindow{w}); err == nil {
+			t.Errorf("%v: expected an error", w)
+		}
+	}
+}
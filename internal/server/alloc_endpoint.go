@@ -155,7 +155,7 @@ func (a *Alloc) GetAllocs(args *models.AllocsGetRequest,
 
 			// Setup the output
 			if thresholdMet {
-				reply.Allocs = allocs
+				reply.Allocs = a.srv.withTransitKeys(allocs)
 				reply.Index = maxIndex
 			} else {
 				// Use the last index that affected the nodes table
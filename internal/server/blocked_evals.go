@@ -55,6 +55,14 @@ type BlockedEvals struct {
 	// are being blocked.
 	unblockIndexes map[string]uint64
 
+	// unblockQuotaIndexes maps namespaces to the index in which the evals
+	// blocked by their quota were unblocked, for the same check.
+	unblockQuotaIndexes map[string]uint64
+
+	// unblockFullCopiesIndex is the index in which the evals blocked by the
+	// full copies of the cluster were unblocked, for the same check.
+	unblockFullCopiesIndex uint64
+
 	// duplicates is the set of evaluations for jobs that had pre-existing
 	// blocked evaluations. These should be marked as cancelled since only one
 	// blocked eval is neeeded per job.
@@ -95,15 +103,16 @@ type BlockedStats struct {
 // unblocked evals into the passed broker.
 func NewBlockedEvals(evalBroker *EvalBroker) *BlockedEvals {
 	return &BlockedEvals{
-		evalBroker:       evalBroker,
-		captured:         make(map[string]wrappedEval),
-		escaped:          make(map[string]wrappedEval),
-		jobs:             make(map[string]string),
-		unblockIndexes:   make(map[string]uint64),
-		capacityChangeCh: make(chan *capacityUpdate, unblockBuffer),
-		duplicateCh:      make(chan struct{}, 1),
-		stopCh:           make(chan struct{}),
-		stats:            new(BlockedStats),
+		evalBroker:          evalBroker,
+		captured:            make(map[string]wrappedEval),
+		escaped:             make(map[string]wrappedEval),
+		jobs:                make(map[string]string),
+		unblockIndexes:      make(map[string]uint64),
+		unblockQuotaIndexes: make(map[string]uint64),
+		capacityChangeCh:    make(chan *capacityUpdate, unblockBuffer),
+		duplicateCh:         make(chan struct{}, 1),
+		stopCh:              make(chan struct{}),
+		stats:               new(BlockedStats),
 	}
 }
 
@@ -219,6 +228,13 @@ func (b *BlockedEvals) processBlock(eval *models.Evaluation, token string) {
 // complete. This method returns if that is the case and should be called with
 // the lock held.
 func (b *BlockedEvals) missedUnblock(eval *models.Evaluation) bool {
+	if eval.QuotaLimitReached != "" {
+		return eval.SnapshotIndex < b.unblockQuotaIndexes[eval.QuotaLimitReached]
+	}
+	if eval.FullCopyLimitReached {
+		return eval.SnapshotIndex < b.unblockFullCopiesIndex
+	}
+
 	var max uint64 = 0
 	for class, index := range b.unblockIndexes {
 		// Calculate the max unblock index
@@ -409,6 +425,46 @@ func (b *BlockedEvals) UnblockFailed() {
 	}
 }
 
+// UnblockQuota unblocks the evaluations blocked by the quota of a namespace,
+// once its usage went down or its quota changed. The evaluations blocked by
+// the full copies of the cluster, which the namespace may have freed, are
+// unblocked too.
+func (b *BlockedEvals) UnblockQuota(namespace string, index uint64) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	// Do nothing if not enabled
+	if !b.enabled {
+		return
+	}
+
+	b.unblockQuotaIndexes[namespace] = index
+	b.unblockFullCopiesIndex = index
+
+	unblocked := make(map[*models.Evaluation]string, 4)
+	for id, wrapped := range b.captured {
+		if wrapped.eval.QuotaLimitReached == namespace || wrapped.eval.FullCopyLimitReached {
+			unblocked[wrapped.eval] = wrapped.token
+			delete(b.captured, id)
+			delete(b.jobs, wrapped.eval.JobID)
+		}
+	}
+
+	for id, wrapped := range b.escaped {
+		if wrapped.eval.QuotaLimitReached == namespace || wrapped.eval.FullCopyLimitReached {
+			unblocked[wrapped.eval] = wrapped.token
+			delete(b.escaped, id)
+			delete(b.jobs, wrapped.eval.JobID)
+			b.stats.TotalEscaped -= 1
+		}
+	}
+
+	if l := len(unblocked); l > 0 {
+		b.stats.TotalBlocked -= l
+		b.evalBroker.EnqueueAll(unblocked)
+	}
+}
+
 // GetDuplicates returns all the duplicate evaluations and blocks until the
 // passed timeout.
 func (b *BlockedEvals) GetDuplicates(timeout time.Duration) []*models.Evaluation {
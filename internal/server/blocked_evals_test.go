@@ -720,3 +720,53 @@ func TestBlockedEvals_EmitStats(t *testing.T) {
 		})
 	}
 }
+
+func TestBlockedEvals_UnblockQuota(t *testing.T) {
+	broker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker.SetEnabled(true)
+	blocked := NewBlockedEvals(broker)
+	blocked.SetEnabled(true)
+	defer blocked.SetEnabled(false)
+
+	newEval := func() *models.Evaluation {
+		return &models.Evaluation{
+			ID:            models.GenerateUUID(),
+			JobID:         models.GenerateUUID(),
+			Type:          models.JobTypeSync,
+			Status:        models.EvalStatusBlocked,
+			SnapshotIndex: 5,
+		}
+	}
+	team2 := newEval()
+	team2.QuotaLimitReached = "team2"
+	cluster := newEval()
+	cluster.FullCopyLimitReached = true
+	blocked.Block(team2)
+	blocked.Block(cluster)
+	if stats := blocked.Stats(); stats.TotalBlocked != 2 {
+		t.Fatalf("blocked = %d, want 2", stats.TotalBlocked)
+	}
+
+	// a full copy of team1 ending frees a slot of the cluster only
+	blocked.UnblockQuota("team1", 10)
+	if stats := blocked.Stats(); stats.TotalBlocked != 1 {
+		t.Errorf("blocked = %d, want 1", stats.TotalBlocked)
+	}
+	if stats := broker.Stats(); stats.TotalReady != 1 {
+		t.Errorf("ready = %d, want 1", stats.TotalReady)
+	}
+
+	// processed before the unblock, it is enqueued again right away
+	missed := newEval()
+	missed.FullCopyLimitReached = true
+	blocked.Block(missed)
+	if stats := blocked.Stats(); stats.TotalBlocked != 1 {
+		t.Errorf("blocked = %d, want 1", stats.TotalBlocked)
+	}
+	if stats := broker.Stats(); stats.TotalReady != 2 {
+		t.Errorf("ready = %d, want 2", stats.TotalReady)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/armon/go-metrics"
 
 	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/scheduler"
 )
 
 const (
@@ -65,8 +66,12 @@ type EvalBroker struct {
 	// blocked tracks the blocked evaluations by JobID in a priority queue
 	blocked map[string]PendingEvaluations
 
-	// ready tracks the ready jobs by scheduler in a priority queue
-	ready map[string]PendingEvaluations
+	// ready tracks the ready jobs by scheduler, queued fairly by namespace
+	ready map[string]*fairQueue
+
+	// weights are the shares of the namespaces in the dequeued evaluations.
+	// The namespaces not in it have a weight of 1.
+	weights map[string]int
 
 	// unack is a map of evalID to an un-acknowledged evaluation
 	unack map[string]*unackEval
@@ -114,7 +119,8 @@ func NewEvalBroker(timeout time.Duration, deliveryLimit int) (*EvalBroker, error
 		evals:         make(map[string]int),
 		jobEvals:      make(map[string]string),
 		blocked:       make(map[string]PendingEvaluations),
-		ready:         make(map[string]PendingEvaluations),
+		ready:         make(map[string]*fairQueue),
+		weights:       make(map[string]int),
 		unack:         make(map[string]*unackEval),
 		waiting:       make(map[string]chan struct{}),
 		requeue:       make(map[string]*models.Evaluation),
@@ -142,6 +148,27 @@ func (b *EvalBroker) SetEnabled(enabled bool) {
 	}
 }
 
+// SetNamespaceWeights sets the share of each namespace in the evaluations
+// dequeued, when several namespaces have evaluations ready. A namespace with
+// a weight of 3 has three evaluations dequeued for one of a namespace with
+// the default weight of 1.
+func (b *EvalBroker) SetNamespaceWeights(weights map[string]int) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.weights = make(map[string]int, len(weights))
+	for ns, w := range weights {
+		b.weights[ns] = w
+	}
+}
+
+// namespaceWeight must be called with the lock held.
+func (b *EvalBroker) namespaceWeight(namespace string) int {
+	if w := b.weights[namespace]; w > 0 {
+		return w
+	}
+	return 1
+}
+
 // Enqueue is used to enqueue a new evaluation
 func (b *EvalBroker) Enqueue(eval *models.Evaluation) {
 	b.l.Lock()
@@ -202,7 +229,7 @@ func (b *EvalBroker) processEnqueue(eval *models.Evaluation, token string) {
 		return
 	}
 
-	b.enqueueLocked(eval, eval.Type)
+	b.enqueueLocked(eval, evalQueue(eval))
 }
 
 // enqueueWaiting is used to enqueue a waiting evaluation
@@ -211,7 +238,17 @@ func (b *EvalBroker) enqueueWaiting(eval *models.Evaluation) {
 	defer b.l.Unlock()
 	delete(b.timeWait, eval.ID)
 	b.stats.TotalWaiting -= 1
-	b.enqueueLocked(eval, eval.Type)
+	b.enqueueLocked(eval, evalQueue(eval))
+}
+
+// evalQueue returns the queue of an evaluation, the one of its scheduler. The
+// evaluations of a type no scheduler is registered for go to the failedQueue,
+// for the leader to fail them, rather than waiting for a worker forever.
+func evalQueue(eval *models.Evaluation) string {
+	if !scheduler.IsRegistered(eval.Type) {
+		return failedQueue
+	}
+	return eval.Type
 }
 
 // enqueueLocked is used to enqueue with the lock held
@@ -236,15 +273,15 @@ func (b *EvalBroker) enqueueLocked(eval *models.Evaluation, queue string) {
 	// Find the pending by scheduler class
 	pending, ok := b.ready[queue]
 	if !ok {
-		pending = make([]*models.Evaluation, 0, 16)
+		pending = newFairQueue()
+		b.ready[queue] = pending
 		if _, ok := b.waiting[queue]; !ok {
 			b.waiting[queue] = make(chan struct{}, 1)
 		}
 	}
 
-	// Push onto the heap
-	heap.Push(&pending, eval)
-	b.ready[queue] = pending
+	// Queue it in its namespace
+	pending.Push(eval)
 
 	// Update the stats
 	b.stats.TotalReady += 1
@@ -354,11 +391,8 @@ func (b *EvalBroker) scanForSchedulers(schedulers []string) (*models.Evaluation,
 // dequeueForSched is used to dequeue the next work item for a given scheduler.
 // This assumes locks are held and that this scheduler has work
 func (b *EvalBroker) dequeueForSched(sched string) (*models.Evaluation, string, error) {
-	// Get the pending queue
-	pending := b.ready[sched]
-	raw := heap.Pop(&pending)
-	b.ready[sched] = pending
-	eval := raw.(*models.Evaluation)
+	// Get the next evaluation, of the namespace whose turn it is
+	eval := b.ready[sched].Pop(b.namespaceWeight)
 
 	// Generate a UUID for the token
 	token := models.GenerateUUID()
@@ -485,7 +519,7 @@ func (b *EvalBroker) Ack(evalID, token string) error {
 
 	// Update the stats
 	b.stats.TotalUnacked -= 1
-	queue := unack.Eval.Type
+	queue := evalQueue(unack.Eval)
 	if b.evals[evalID] > b.deliveryLimit {
 		queue = failedQueue
 	}
@@ -507,7 +541,7 @@ func (b *EvalBroker) Ack(evalID, token string) error {
 		}
 		eval := raw.(*models.Evaluation)
 		b.stats.TotalBlocked -= 1
-		b.enqueueLocked(eval, eval.Type)
+		b.enqueueLocked(eval, evalQueue(eval))
 	}
 
 	// Re-enqueue the evaluation.
@@ -544,7 +578,7 @@ func (b *EvalBroker) Nack(evalID, token string) error {
 
 	// Update the stats
 	b.stats.TotalUnacked -= 1
-	bySched := b.stats.ByScheduler[unack.Eval.Type]
+	bySched := b.stats.ByScheduler[evalQueue(unack.Eval)]
 	bySched.Unacked -= 1
 
 	// Check if we've hit the delivery limit, and re-enqueue
@@ -552,7 +586,7 @@ func (b *EvalBroker) Nack(evalID, token string) error {
 	if b.evals[evalID] >= b.deliveryLimit {
 		b.enqueueLocked(unack.Eval, failedQueue)
 	} else {
-		b.enqueueLocked(unack.Eval, unack.Eval.Type)
+		b.enqueueLocked(unack.Eval, evalQueue(unack.Eval))
 	}
 	return nil
 }
@@ -621,7 +655,7 @@ func (b *EvalBroker) Flush() {
 	b.evals = make(map[string]int)
 	b.jobEvals = make(map[string]string)
 	b.blocked = make(map[string]PendingEvaluations)
-	b.ready = make(map[string]PendingEvaluations)
+	b.ready = make(map[string]*fairQueue)
 	b.unack = make(map[string]*unackEval)
 	b.timeWait = make(map[string]*time.Timer)
 }
@@ -631,6 +665,7 @@ func (b *EvalBroker) Stats() *BrokerStats {
 	// Allocate a new stats struct
 	stats := new(BrokerStats)
 	stats.ByScheduler = make(map[string]*SchedulerStats)
+	stats.ReadyByNamespace = make(map[string]int)
 
 	b.l.RLock()
 	defer b.l.RUnlock()
@@ -645,6 +680,11 @@ func (b *EvalBroker) Stats() *BrokerStats {
 		*subStatCopy = *subStat
 		stats.ByScheduler[sched] = subStatCopy
 	}
+	for _, pending := range b.ready {
+		for ns, n := range pending.ReadyByNamespace() {
+			stats.ReadyByNamespace[ns] += n
+		}
+	}
 	return stats
 }
 
@@ -662,6 +702,9 @@ func (b *EvalBroker) EmitStats(period time.Duration, stopCh chan struct{}) {
 				metrics.SetGauge([]string{"server", "broker", sched, "ready"}, float32(schedStats.Ready))
 				metrics.SetGauge([]string{"server", "broker", sched, "unacked"}, float32(schedStats.Unacked))
 			}
+			for ns, ready := range stats.ReadyByNamespace {
+				metrics.SetGauge([]string{"server", "broker", "namespace", ns, "ready"}, float32(ready))
+			}
 
 		case <-stopCh:
 			return
@@ -676,6 +719,9 @@ type BrokerStats struct {
 	TotalBlocked int
 	TotalWaiting int
 	ByScheduler  map[string]*SchedulerStats
+
+	// ReadyByNamespace is the number of ready evaluations of each namespace
+	ReadyByNamespace map[string]int
 }
 
 // SchedulerStats returns the stats per scheduler
@@ -50,7 +50,7 @@ func TestEvalBroker_Enabled(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -97,7 +97,7 @@ func TestEvalBroker_SetEnabled(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -145,7 +145,7 @@ func TestEvalBroker_Enqueue(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -193,7 +193,7 @@ func TestEvalBroker_EnqueueAll(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -241,7 +241,7 @@ func TestEvalBroker_processEnqueue(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -290,7 +290,7 @@ func TestEvalBroker_enqueueWaiting(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -338,7 +338,7 @@ func TestEvalBroker_enqueueLocked(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -387,7 +387,7 @@ func TestEvalBroker_Dequeue(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -449,7 +449,7 @@ func TestEvalBroker_scanForSchedulers(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -510,7 +510,7 @@ func TestEvalBroker_dequeueForSched(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -571,7 +571,7 @@ func TestEvalBroker_waitForSchedulers(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -623,7 +623,7 @@ func TestEvalBroker_Outstanding(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -679,7 +679,7 @@ func TestEvalBroker_OutstandingReset(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -731,7 +731,7 @@ func TestEvalBroker_Ack(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -783,7 +783,7 @@ func TestEvalBroker_Nack(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -835,7 +835,7 @@ func TestEvalBroker_PauseNackTimeout(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -887,7 +887,7 @@ func TestEvalBroker_ResumeNackTimeout(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -939,7 +939,7 @@ func TestEvalBroker_Flush(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -983,7 +983,7 @@ func TestEvalBroker_Stats(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -1030,7 +1030,7 @@ func TestEvalBroker_EmitStats(t *testing.T) {
 		evals         map[string]int
 		jobEvals      map[string]string
 		blocked       map[string]PendingEvaluations
-		ready         map[string]PendingEvaluations
+		ready         map[string]*fairQueue
 		unack         map[string]*unackEval
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
@@ -1179,3 +1179,24 @@ func TestPendingEvaluations_Peek(t *testing.T) {
 		})
 	}
 }
+
+func TestEvalBroker_UnknownScheduler(t *testing.T) {
+	b, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetEnabled(true)
+
+	eval := &models.Evaluation{ID: models.GenerateUUID(), JobID: "job1", Type: "unknown"}
+	b.Enqueue(eval)
+	out, token, err := b.Dequeue([]string{failedQueue}, time.Second)
+	if err != nil || out != eval {
+		t.Fatalf("dequeue: %v %v", out, err)
+	}
+	if err := b.Ack(eval.ID, token); err != nil {
+		t.Fatal(err)
+	}
+	if stats := b.Stats(); stats.TotalUnacked != 0 || stats.ByScheduler[failedQueue].Unacked != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -135,6 +135,9 @@ func (e *Eval) Nack(args *models.EvalAckRequest,
 	if err := e.srv.evalBroker.Nack(args.EvalID, args.Token); err != nil {
 		return err
 	}
+	if args.Reason != "" {
+		e.srv.logger.Warnf("manager: eval %s nacked: %s", args.EvalID, args.Reason)
+	}
 	return nil
 }
 
@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"container/heap"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// fairQueue holds the ready evaluations of a scheduler by namespace, for a
+// namespace submitting thousands of evaluations not to delay the others.
+//
+// The namespaces with ready evaluations take turns. On its turn a namespace
+// is given as many tokens as its weight, and spends one per evaluation
+// dequeued; the turn passes to the next namespace once the tokens are spent.
+// So the evaluations are dequeued in proportion to the weights. Within a
+// namespace, the oldest evaluation is dequeued first.
+type fairQueue struct {
+	pending map[string]PendingEvaluations
+	tokens  map[string]int
+
+	// order is the namespaces with ready evaluations, in turn order.
+	// next is the one whose turn it is.
+	order []string
+	next  int
+
+	len int
+}
+
+func newFairQueue() *fairQueue {
+	return &fairQueue{
+		pending: make(map[string]PendingEvaluations),
+		tokens:  make(map[string]int),
+	}
+}
+
+func evalNamespace(eval *models.Evaluation) string {
+	if eval.Namespace == "" {
+		return models.DefaultNamespace
+	}
+	return eval.Namespace
+}
+
+// Len is the number of ready evaluations.
+func (q *fairQueue) Len() int {
+	return q.len
+}
+
+// Push adds an evaluation. A namespace without ready evaluations takes the
+// last turn.
+func (q *fairQueue) Push(eval *models.Evaluation) {
+	ns := evalNamespace(eval)
+	pending, ok := q.pending[ns]
+	if !ok {
+		q.order = append(q.order, ns)
+	}
+	heap.Push(&pending, eval)
+	q.pending[ns] = pending
+	q.len++
+}
+
+// Pop dequeues the next evaluation, or returns nil if there is none. weight
+// returns the weight of a namespace, at least 1.
+func (q *fairQueue) Pop(weight func(namespace string) int) *models.Evaluation {
+	if q.len == 0 {
+		return nil
+	}
+	ns := q.order[q.next]
+	if q.tokens[ns] <= 0 {
+		q.tokens[ns] = weight(ns)
+	}
+
+	pending := q.pending[ns]
+	eval := heap.Pop(&pending).(*models.Evaluation)
+	q.pending[ns] = pending
+	q.tokens[ns]--
+	q.len--
+
+	if len(pending) == 0 {
+		// the namespace leaves, with its tokens
+		delete(q.pending, ns)
+		delete(q.tokens, ns)
+		q.order = append(q.order[:q.next], q.order[q.next+1:]...)
+	} else if q.tokens[ns] == 0 {
+		q.next++
+	}
+	if q.next >= len(q.order) {
+		q.next = 0
+	}
+	return eval
+}
+
+// Peek returns the evaluation Pop would dequeue, or nil.
+func (q *fairQueue) Peek() *models.Evaluation {
+	if q.len == 0 {
+		return nil
+	}
+	return q.pending[q.order[q.next]].Peek()
+}
+
+// ReadyByNamespace returns the number of ready evaluations of each namespace.
+func (q *fairQueue) ReadyByNamespace() map[string]int {
+	ready := make(map[string]int, len(q.pending))
+	for ns, pending := range q.pending {
+		ready[ns] = len(pending)
+	}
+	return ready
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestFairQueue(t *testing.T) {
+	q := newFairQueue()
+	index := uint64(0)
+	push := func(ns string, n int) {
+		for i := 0; i < n; i++ {
+			index++
+			q.Push(&models.Evaluation{ID: fmt.Sprintf("%s-%d", ns, index), Namespace: ns, CreateIndex: index})
+		}
+	}
+	weights := map[string]int{"big": 2}
+	weight := func(ns string) int {
+		if w, ok := weights[ns]; ok {
+			return w
+		}
+		return 1
+	}
+	pop := func(n int) string {
+		var got []string
+		for i := 0; i < n; i++ {
+			eval := q.Pop(weight)
+			if eval == nil {
+				got = append(got, "-")
+				continue
+			}
+			got = append(got, evalNamespace(eval))
+		}
+		return strings.Join(got, " ")
+	}
+
+	// the big namespace floods the queue before the small ones submit
+	push("big", 100)
+	push("small", 2)
+	push("", 1)
+	if got, want := pop(9), "big big small default big big small big big"; got != want {
+		t.Errorf("dequeued %v, want %v", got, want)
+	}
+	if q.Len() != 94 {
+		t.Errorf("len = %v", q.Len())
+	}
+	ready := q.ReadyByNamespace()
+	if len(ready) != 1 || ready["big"] != 94 {
+		t.Errorf("ready = %v", ready)
+	}
+
+	// within a namespace the oldest is first
+	q = newFairQueue()
+	q.Push(&models.Evaluation{ID: "b", Namespace: "ns", CreateIndex: 2})
+	q.Push(&models.Evaluation{ID: "a", Namespace: "ns", CreateIndex: 1})
+	if eval := q.Pop(weight); eval.ID != "a" {
+		t.Errorf("dequeued %v", eval.ID)
+	}
+	q.Pop(weight)
+	if eval := q.Pop(weight); eval != nil || q.Peek() != nil {
+		t.Errorf("dequeued %v from an empty queue", eval)
+	}
+}
+
+func TestEvalBroker_NamespaceFairness(t *testing.T) {
+	b, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetEnabled(true)
+	b.SetNamespaceWeights(map[string]int{"small": 3})
+
+	for i := 0; i < 50; i++ {
+		b.Enqueue(&models.Evaluation{ID: models.GenerateUUID(), JobID: fmt.Sprintf("big-%d", i),
+			Namespace: "big", Type: models.JobTypeSync, CreateIndex: uint64(i + 1)})
+	}
+	for i := 0; i < 3; i++ {
+		b.Enqueue(&models.Evaluation{ID: models.GenerateUUID(), JobID: fmt.Sprintf("small-%d", i),
+			Namespace: "small", Type: models.JobTypeSync, CreateIndex: uint64(100 + i)})
+	}
+	if stats := b.Stats(); stats.ReadyByNamespace["big"] != 50 || stats.ReadyByNamespace["small"] != 3 {
+		t.Fatalf("ready = %v", stats.ReadyByNamespace)
+	}
+
+	// the small namespace is served within the first turns, not after the 50
+	var small []int
+	for i := 0; i < 6; i++ {
+		eval, _, err := b.Dequeue([]string{models.JobTypeSync}, time.Second)
+		if err != nil || eval == nil {
+			t.Fatalf("dequeue: %v %v", eval, err)
+		}
+		if eval.Namespace == "small" {
+			small = append(small, i)
+		}
+	}
+	if fmt.Sprint(small) != "[1 2 3]" {
+		t.Errorf("small namespace dequeued at %v", small)
+	}
+}
@@ -41,6 +41,8 @@ const (
 	EvalSnapshot
 	AllocSnapshot
 	TimeTableSnapshot
+	QuotaSnapshot
+	JobStatsSnapshot
 )
 
 // udupFSM implements a finite store machine that is used
@@ -54,6 +56,10 @@ type udupFSM struct {
 	state        *store.StateStore
 	timetable    *TimeTable
 
+	// slowApplyThreshold is the apply time over which a log is logged, 0
+	// to log none
+	slowApplyThreshold time.Duration
+
 	// stateLock is only used to protect outside callers to State() from
 	// racing with Restore(), which is called by Raft (it puts in a totally
 	// new store store). Everything internal here is synchronized by the
@@ -89,6 +95,8 @@ func NewFSM(evalBroker *EvalBroker,
 		logger:       logger,
 		state:        state,
 		timetable:    NewTimeTable(timeTableGranularity, timeTableLimit),
+
+		slowApplyThreshold: defaultSlowApplyThreshold,
 	}
 	return fsm, nil
 }
@@ -125,6 +133,7 @@ func (n *udupFSM) Apply(log *raft.Log) interface{} {
 		msgType &= ^models.IgnoreUnknownTypeFlag
 		ignoreUnknown = true
 	}
+	defer n.observeApply(msgType, log, time.Now())
 
 	switch msgType {
 	case models.NodeRegisterRequestType:
@@ -155,6 +164,16 @@ func (n *udupFSM) Apply(log *raft.Log) interface{} {
 		return n.applyAllocUpdate(buf[1:], log.Index)
 	case models.AllocClientUpdateRequestType:
 		return n.applyAllocClientUpdate(buf[1:], log.Index)
+	case models.StateImportRequestType:
+		return n.applyStateImport(buf[1:], log.Index)
+	case models.QuotaUpsertRequestType:
+		return n.applyQuotaUpsert(buf[1:], log.Index)
+	case models.QuotaDeleteRequestType:
+		return n.applyQuotaDelete(buf[1:], log.Index)
+	case models.JobStatsUpdateRequestType:
+		return n.applyJobStatsUpdate(buf[1:], log.Index)
+	case models.JobBulkApplyRequestType:
+		return n.applyJobBulk(buf[1:], log.Index)
 	default:
 		if ignoreUnknown {
 			n.logger.Warnf("server.fsm: ignoring unknown message type (%d), upgrade to newer version", msgType)
@@ -165,6 +184,21 @@ func (n *udupFSM) Apply(log *raft.Log) interface{} {
 	}
 }
 
+// standbyNodeID returns the node running the DestStandby task of a job, or
+// "" if it is not running.
+func (n *udupFSM) standbyNodeID(jobID string) (string, error) {
+	allocs, err := n.state.AllocsByJob(nil, jobID, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to find allocs for '%s': %v", jobID, err)
+	}
+	for _, alloc := range allocs {
+		if alloc.Task == models.TaskTypeDestStandby && !alloc.TerminalStatus() {
+			return alloc.NodeID, nil
+		}
+	}
+	return "", nil
+}
+
 func (n *udupFSM) applyUpsertNode(buf []byte, index uint64) interface{} {
 	defer metrics.MeasureSince([]string{"server", "fsm", "register_node"}, time.Now())
 	var req models.NodeRegisterRequest
@@ -207,7 +241,7 @@ func (n *udupFSM) applyStatusUpdate(buf []byte, index uint64) interface{} {
 		panic(fmt.Errorf("failed to decode request: %v", err))
 	}
 
-	if err := n.state.UpdateNodeStatus(index, req.NodeID, req.Status); err != nil {
+	if err := n.state.UpdateNodeStatus(index, req.NodeID, req.Status, req.Utilization); err != nil {
 		n.logger.Errorf("server.fsm: UpdateNodeStatus failed: %v", err)
 		return err
 	}
@@ -265,6 +299,18 @@ func (n *udupFSM) applyStatusUpdate(buf []byte, index uint64) interface{} {
 							}
 							out = append(out, node)
 						}
+						if task.Type == models.TaskTypeDest && job.HasStandby() {
+							// The standby applier takes over on its own node
+							standbyNodeID, err := n.standbyNodeID(job.ID)
+							if err != nil {
+								return err
+							}
+							for i, node := range out {
+								if node.ID == standbyNodeID {
+									out[0], out[i] = out[i], out[0]
+								}
+							}
+						}
 						if len(out) > 0 {
 							task.NodeID = out[0].ID
 							if task.Type == models.TaskTypeDest {
@@ -354,6 +400,7 @@ func (n *udupFSM) applyJobStatusUpdate(buf []byte, index uint64) interface{} {
 		n.logger.Errorf("server.fsm: UpdateJobStatus failed: %v", err)
 		return err
 	}
+	n.unblockQuota(req.JobID, index)
 
 	return nil
 }
@@ -367,6 +414,14 @@ func (n *udupFSM) applyUpsertJob(buf []byte, index uint64) interface{} {
 
 	req.Job.Canonicalize()
 
+	if req.WarmRestart {
+		if err := n.state.WarmRestartJob(index, req.Job); err != nil {
+			n.logger.Errorf("server.fsm: WarmRestartJob failed: %v", err)
+			return err
+		}
+		return nil
+	}
+
 	if err := n.state.UpsertJob(index, req.Job); err != nil {
 		n.logger.Errorf("server.fsm: UpsertJob failed: %v", err)
 		return err
@@ -397,14 +452,78 @@ func (n *udupFSM) applyDeregisterJob(buf []byte, index uint64) interface{} {
 		panic(fmt.Errorf("failed to decode request: %v", err))
 	}
 
+	job, err := n.state.JobByID(nil, req.JobID)
+	if err != nil {
+		n.logger.Errorf("server.fsm: JobByID failed: %v", err)
+		return err
+	}
 	if err := n.state.DeleteJob(index, req.JobID); err != nil {
 		n.logger.Errorf("server.fsm: DeleteJob failed: %v", err)
 		return err
 	}
+	if job != nil {
+		n.blockedEvals.UnblockQuota(job.Namespace, index)
+	}
 
 	return nil
 }
 
+func (n *udupFSM) applyJobBulk(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "job_bulk"}, time.Now())
+	var req models.JobBulkApplyRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	// the namespaces of the deleted jobs, to unblock their quota after
+	namespaces := make(map[string]bool)
+	for _, jobID := range req.Deregister {
+		job, err := n.state.JobByID(nil, jobID)
+		if err != nil {
+			n.logger.Errorf("server.fsm: JobByID failed: %v", err)
+			return err
+		}
+		if job != nil {
+			namespaces[job.Namespace] = true
+		}
+	}
+	for _, eval := range req.Evals {
+		if eval.JobModifyIndex == 0 {
+			eval.JobModifyIndex = index
+		}
+	}
+
+	if err := n.state.UpdateJobsBulk(index, req.Statuses, req.Deregister, req.Evals); err != nil {
+		n.logger.Errorf("server.fsm: UpdateJobsBulk failed: %v", err)
+		return err
+	}
+
+	for jobID := range req.Statuses {
+		n.unblockQuota(jobID, index)
+	}
+	for namespace := range namespaces {
+		n.blockedEvals.UnblockQuota(namespace, index)
+	}
+	for _, eval := range req.Evals {
+		if eval.ShouldEnqueue() {
+			n.evalBroker.Enqueue(eval)
+		} else if eval.ShouldBlock() {
+			n.blockedEvals.Block(eval)
+		}
+	}
+	return nil
+}
+
+// unblockQuota unblocks the evaluations waiting for the quota of the
+// namespace of a job, after its usage went down.
+func (n *udupFSM) unblockQuota(jobID string, index uint64) {
+	job, err := n.state.JobByID(nil, jobID)
+	if err != nil || job == nil {
+		return
+	}
+	n.blockedEvals.UnblockQuota(job.Namespace, index)
+}
+
 func (n *udupFSM) applyUpsertOrder(buf []byte, index uint64) interface{} {
 	defer metrics.MeasureSince([]string{"server", "fsm", "register_order"}, time.Now())
 	var req models.OrderRegisterRequest
@@ -519,10 +638,15 @@ func (n *udupFSM) applyJobClientUpdate(buf []byte, index uint64) interface{} {
 		// Check if the job already exists
 		if existing, _ := n.state.JobByID(ws, ju.JobID); existing != nil {
 			if ju.Gtid != "" {
+				// the full copy of the job is done
+				if existing.FullCopying() {
+					defer n.blockedEvals.UnblockQuota(existing.Namespace, index)
+				}
 				existing.ModifyIndex = index
 				existing.JobModifyIndex = index
 				for _, t := range existing.Tasks {
 					t.Config["Gtid"] = ju.Gtid
+					delete(t.Config, "CopyProgress")
 					//t.Config["NatsAddr"] = ju.NatsAddr
 				}
 				// Update all the client allocations
@@ -536,6 +660,14 @@ func (n *udupFSM) applyJobClientUpdate(buf []byte, index uint64) interface{} {
 				/*for _, t := range existing.Tasks {
 					t.Config["NatsAddr"] = ju.NatsAddr
 				}*/
+				if ju.CopyProgress != nil {
+					// the applier of a rescheduled Dest task resumes the copy
+					for _, t := range existing.Tasks {
+						if t.Type == models.TaskTypeDest || t.Type == models.TaskTypeDestStandby {
+							t.Config["CopyProgress"] = ju.CopyProgress
+						}
+					}
+				}
 				// Update all the client allocations
 				if err := n.state.UpdateJobFromClient(index, existing); err != nil {
 					n.logger.Errorf("server.fsm: UpdateJobFromClient failed: %v", err)
@@ -594,6 +726,109 @@ func (n *udupFSM) applyAllocClientUpdate(buf []byte, index uint64) interface{} {
 	return nil
 }
 
+func (n *udupFSM) applyStateImport(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "state_import"}, time.Now())
+	var req models.StateImportRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+	state := req.State
+
+	for _, node := range state.Nodes {
+		// The nodes are up again when their agents heartbeat the new cluster.
+		node.Status = models.NodeStatusDown
+		if err := n.state.UpsertNode(index, node); err != nil {
+			n.logger.Errorf("server.fsm: UpsertNode failed: %v", err)
+			return err
+		}
+	}
+	for _, job := range state.Jobs {
+		job.Canonicalize()
+		if err := n.state.UpsertJob(index, job); err != nil {
+			n.logger.Errorf("server.fsm: UpsertJob failed: %v", err)
+			return err
+		}
+	}
+	for _, order := range state.Orders {
+		if err := n.state.UpsertOrder(index, order); err != nil {
+			n.logger.Errorf("server.fsm: UpsertOrder failed: %v", err)
+			return err
+		}
+	}
+	if err := n.state.UpsertEvals(index, state.Evals); err != nil {
+		n.logger.Errorf("server.fsm: UpsertEvals failed: %v", err)
+		return err
+	}
+	if err := n.state.UpsertAllocs(index, state.Allocs); err != nil {
+		n.logger.Errorf("server.fsm: UpsertAllocs failed: %v", err)
+		return err
+	}
+	for _, quota := range state.Quotas {
+		if err := n.state.UpsertQuota(index, quota); err != nil {
+			n.logger.Errorf("server.fsm: UpsertQuota failed: %v", err)
+			return err
+		}
+	}
+
+	for _, eval := range state.Evals {
+		if eval.ShouldEnqueue() {
+			n.evalBroker.Enqueue(eval)
+		} else if eval.ShouldBlock() {
+			n.blockedEvals.Block(eval)
+		}
+	}
+	return nil
+}
+
+func (n *udupFSM) applyQuotaUpsert(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "quota_upsert"}, time.Now())
+	var req models.QuotaUpsertRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	if err := n.state.UpsertQuota(index, req.Quota); err != nil {
+		n.logger.Errorf("server.fsm: UpsertQuota failed: %v", err)
+		return err
+	}
+	n.blockedEvals.UnblockQuota(req.Quota.Namespace, index)
+	return nil
+}
+
+func (n *udupFSM) applyQuotaDelete(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "quota_delete"}, time.Now())
+	var req models.QuotaDeleteRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	if err := n.state.DeleteQuota(index, req.Namespace); err != nil {
+		n.logger.Errorf("server.fsm: DeleteQuota failed: %v", err)
+		return err
+	}
+	n.blockedEvals.UnblockQuota(req.Namespace, index)
+	return nil
+}
+
+func (n *udupFSM) applyJobStatsUpdate(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "job_stats_update"}, time.Now())
+	var req models.JobStatsUpdateRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	breaches, err := n.state.UpsertJobStats(index, req.Updates)
+	if err != nil {
+		n.logger.Errorf("server.fsm: UpsertJobStats failed: %v", err)
+		return err
+	}
+	for _, b := range breaches {
+		metrics.IncrCounter([]string{"server", "job", "sla_breach", b.Kind}, 1)
+		n.logger.Warnf("server.fsm: job %v breached its SLA: %v of %vs at %v", b.JobID, b.Kind, b.Seconds, b.Time)
+	}
+	return nil
+}
+
 func (n *udupFSM) Snapshot() (raft.FSMSnapshot, error) {
 	// Create a new snapshot
 	snap, err := n.state.Snapshot()
@@ -611,16 +846,39 @@ func (n *udupFSM) Snapshot() (raft.FSMSnapshot, error) {
 func (n *udupFSM) Restore(old io.ReadCloser) error {
 	defer old.Close()
 
+	// A snapshot installed from the leader was restored as it was received
+	if staged, ok := old.(*stagedSnapshot); ok {
+		n.swapState(staged.restore)
+		return nil
+	}
+
+	restore, err := n.decodeSnapshot(old, nil)
+	if err != nil {
+		return err
+	}
+	n.swapState(restore)
+	return nil
+}
+
+// snapshotRestore is a snapshot decoded into a new store store
+type snapshotRestore struct {
+	state     *store.StateStore
+	timetable []TimeTableEntry
+}
+
+// decodeSnapshot decodes a snapshot into a new store store, calling progress
+// after each object if not nil. It does not touch the live store.
+func (n *udupFSM) decodeSnapshot(old io.Reader, progress func()) (*snapshotRestore, error) {
 	// Create a new store store
 	newState, err := store.NewStateStore(n.logOutput)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Start the store restore
 	restore, err := newState.Restore()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer restore.Abort()
 
@@ -630,10 +888,11 @@ func (n *udupFSM) Restore(old io.ReadCloser) error {
 	// Read in the header
 	var header snapshotHeader
 	if err := dec.Decode(&header); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Populate the new store
+	result := &snapshotRestore{state: newState}
 	msgType := make([]byte, 1)
 	for {
 		// Read the message type
@@ -641,88 +900,117 @@ func (n *udupFSM) Restore(old io.ReadCloser) error {
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return err
+			return nil, err
 		}
 
 		// Decode
 		switch SnapshotType(msgType[0]) {
 		case TimeTableSnapshot:
-			if err := n.timetable.Deserialize(dec); err != nil {
-				return fmt.Errorf("time table deserialize failed: %v", err)
+			if err := dec.Decode(&result.timetable); err != nil {
+				return nil, fmt.Errorf("time table deserialize failed: %v", err)
 			}
 
 		case NodeSnapshot:
 			node := new(models.Node)
 			if err := dec.Decode(node); err != nil {
-				return err
+				return nil, err
 			}
 			if err := restore.NodeRestore(node); err != nil {
-				return err
+				return nil, err
 			}
 
 		case JobSnapshot:
 			job := new(models.Job)
 			if err := dec.Decode(job); err != nil {
-				return err
+				return nil, err
 			}
 
 			job.Canonicalize()
 
 			if err := restore.JobRestore(job); err != nil {
-				return err
+				return nil, err
 			}
 
 		case EvalSnapshot:
 			eval := new(models.Evaluation)
 			if err := dec.Decode(eval); err != nil {
-				return err
+				return nil, err
 			}
 			if err := restore.EvalRestore(eval); err != nil {
-				return err
+				return nil, err
 			}
 
 		case AllocSnapshot:
 			alloc := new(models.Allocation)
 			if err := dec.Decode(alloc); err != nil {
-				return err
+				return nil, err
 			}
 			if err := restore.AllocRestore(alloc); err != nil {
-				return err
+				return nil, err
+			}
+
+		case QuotaSnapshot:
+			quota := new(models.QuotaSpec)
+			if err := dec.Decode(quota); err != nil {
+				return nil, err
+			}
+			if err := restore.QuotaRestore(quota); err != nil {
+				return nil, err
+			}
+
+		case JobStatsSnapshot:
+			stats := new(models.JobStats)
+			if err := dec.Decode(stats); err != nil {
+				return nil, err
+			}
+			if err := restore.JobStatsRestore(stats); err != nil {
+				return nil, err
 			}
 
 		case IndexSnapshot:
 			idx := new(store.IndexEntry)
 			if err := dec.Decode(idx); err != nil {
-				return err
+				return nil, err
 			}
 			if err := restore.IndexRestore(idx); err != nil {
-				return err
+				return nil, err
 			}
 
 		default:
-			return fmt.Errorf("Unrecognized snapshot type: %v", msgType)
+			return nil, fmt.Errorf("Unrecognized snapshot type: %v", msgType)
+		}
+		if progress != nil {
+			progress()
 		}
 	}
 
 	restore.Commit()
+	return result, nil
+}
+
+// swapState replaces the store store with a restored one
+func (n *udupFSM) swapState(restore *snapshotRestore) {
+	n.timetable.witnessAll(restore.timetable)
 
 	// External code might be calling State(), so we need to synchronize
 	// here to make sure we swap in the new store store atomically.
 	n.stateLock.Lock()
 	stateOld := n.state
-	n.state = newState
+	n.state = restore.state
 	n.stateLock.Unlock()
 
 	// Signal that the old store store has been abandoned. This is required
 	// because we don't operate on it any more, we just throw it away, so
 	// blocking queries won't see any changes and need to be woken up.
 	stateOld.Abandon()
-
-	return nil
 }
 
 func (s *udupSnapshot) Persist(sink raft.SnapshotSink) error {
 	defer metrics.MeasureSince([]string{"server", "fsm", "persist"}, time.Now())
+	if streaming, ok := sink.(*streamingSink); ok {
+		streaming.skipRestore()
+	}
+
 	// Register the nodes
 	encoder := codec.NewEncoder(sink, models.MsgpackHandle)
 
@@ -761,6 +1049,14 @@ func (s *udupSnapshot) Persist(sink raft.SnapshotSink) error {
 		sink.Cancel()
 		return err
 	}
+	if err := s.persistQuotas(sink, encoder); err != nil {
+		sink.Cancel()
+		return err
+	}
+	if err := s.persistJobStats(sink, encoder); err != nil {
+		sink.Cancel()
+		return err
+	}
 
 	return nil
 }
@@ -904,6 +1200,38 @@ func (s *udupSnapshot) persistAllocs(sink raft.SnapshotSink,
 	return nil
 }
 
+func (s *udupSnapshot) persistQuotas(sink raft.SnapshotSink,
+	encoder *codec.Encoder) error {
+	quotas, err := s.snap.Quotas(nil)
+	if err != nil {
+		return err
+	}
+
+	for raw := quotas.Next(); raw != nil; raw = quotas.Next() {
+		sink.Write([]byte{byte(QuotaSnapshot)})
+		if err := encoder.Encode(raw.(*models.QuotaSpec)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *udupSnapshot) persistJobStats(sink raft.SnapshotSink,
+	encoder *codec.Encoder) error {
+	stats, err := s.snap.AllJobStats(nil)
+	if err != nil {
+		return err
+	}
+
+	for raw := stats.Next(); raw != nil; raw = stats.Next() {
+		sink.Write([]byte{byte(JobStatsSnapshot)})
+		if err := encoder.Encode(raw.(*models.JobStats)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Release is a no-op, as we just need to GC the pointer
 // to the store store snapshot. There is nothing to explicitly
 // cleanup.
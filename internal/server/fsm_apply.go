@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/raft"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// defaultSlowApplyThreshold is the apply time over which a log is logged
+	defaultSlowApplyThreshold = 500 * time.Millisecond
+
+	// maxSummaryValue bounds the values in the summary of a request
+	maxSummaryValue = 64
+)
+
+// observeApply measures the apply of a log by its message type, and logs it
+// with a summary of its request if it is slower than the threshold.
+func (n *udupFSM) observeApply(msgType models.MessageType, log *raft.Log, start time.Time) {
+	metrics.MeasureSince([]string{"server", "fsm", "apply", msgType.String()}, start)
+	elapsed := time.Since(start)
+	if n.slowApplyThreshold <= 0 || elapsed < n.slowApplyThreshold {
+		return
+	}
+	metrics.IncrCounter([]string{"server", "fsm", "slow_apply", msgType.String()}, 1)
+	n.logger.Warnf("server.fsm: slow apply of %v at index %d: %v, %d bytes: %s",
+		msgType, log.Index, elapsed, len(log.Data), summarizeRequest(log.Data[1:]))
+}
+
+// summarizeRequest returns the fields of an encoded request: the strings and
+// the numbers, the lengths of the lists and the IDs of the objects.
+func summarizeRequest(buf []byte) string {
+	var req map[string]interface{}
+	if err := models.Decode(buf, &req); err != nil {
+		return fmt.Sprintf("undecodable request: %v", err)
+	}
+	var fields []string
+	for k, v := range req {
+		if s := summarizeValue(v); s != "" {
+			fields = append(fields, k+"="+s)
+		}
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, " ")
+}
+
+func summarizeValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		if v == "" {
+			return ""
+		}
+		if len(v) > maxSummaryValue {
+			v = v[:maxSummaryValue] + "..."
+		}
+		return fmt.Sprintf("%q", v)
+	case []byte:
+		return fmt.Sprintf("<%d bytes>", len(v))
+	case []interface{}:
+		return fmt.Sprintf("[%d]", len(v))
+	case map[string]interface{}:
+		if id, ok := v["ID"].(string); ok && id != "" {
+			return fmt.Sprintf("{ID:%q}", id)
+		}
+		return fmt.Sprintf("{%d}", len(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
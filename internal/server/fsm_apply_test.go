@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestSummarizeRequest(t *testing.T) {
+	job := topologyTestJob("job1", "a", "b")
+	buf, err := models.Encode(models.JobRegisterRequestType, &models.JobRegisterRequest{
+		Job:          job,
+		WriteRequest: models.WriteRequest{Region: "global"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := summarizeRequest(buf[1:])
+	if !strings.Contains(summary, `Job={ID:"job1"}`) || !strings.Contains(summary, `Region="global"`) {
+		t.Errorf("summary = %s", summary)
+	}
+
+	buf, err = models.Encode(models.EvalUpdateRequestType, &models.EvalUpdateRequest{
+		Evals: []*models.Evaluation{{ID: "e1"}, {ID: "e2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary := summarizeRequest(buf[1:]); !strings.Contains(summary, "Evals=[2]") || strings.Contains(summary, "EvalToken") {
+		t.Errorf("summary = %s", summary)
+	}
+
+	if models.JobStatsUpdateRequestType.String() != "job_stats_update" || models.MessageType(100).String() != "unknown_100" {
+		t.Errorf("names: %v %v", models.JobStatsUpdateRequestType, models.MessageType(100))
+	}
+}
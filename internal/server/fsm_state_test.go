@@ -0,0 +1,377 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestFSM_StateImport(t *testing.T) {
+	broker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker.SetEnabled(true)
+	fsm, err := NewFSM(broker, NewBlockedEvals(broker), os.Stderr, log.New(os.Stderr, log.ErrorLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := topologyTestJob("job1", "a", "b")
+	job.Type = models.JobTypeSync
+	nodeID, evalID, allocID := models.GenerateUUID(), models.GenerateUUID(), models.GenerateUUID()
+	state := &models.StateExport{
+		Build: "9.0.0",
+		Index: 1000,
+		Nodes: []*models.Node{{ID: nodeID, Name: "node1", Status: models.NodeStatusReady}},
+		Jobs:  []*models.Job{job},
+		Evals: []*models.Evaluation{{ID: evalID, JobID: "job1", Type: models.JobTypeSync, Status: models.EvalStatusPending}},
+		Allocs: []*models.Allocation{
+			{ID: allocID, JobID: "job1", EvalID: evalID, NodeID: nodeID, Task: models.TaskTypeSrc},
+		},
+	}
+	buf, err := models.Encode(models.StateImportRequestType, &models.StateImportRequest{State: state})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := fsm.Apply(&raft.Log{Index: 10, Data: buf}); resp != nil {
+		t.Fatalf("apply: %v", resp)
+	}
+
+	node, err := fsm.State().NodeByID(nil, nodeID)
+	if err != nil || node == nil {
+		t.Fatalf("node: %v %v", node, err)
+	}
+	if node.Status != models.NodeStatusDown {
+		t.Errorf("node status = %v, want down until the agent joins", node.Status)
+	}
+	job, err = fsm.State().JobByID(nil, "job1")
+	if err != nil || job == nil || job.ModifyIndex != 10 {
+		t.Fatalf("job: %v %v", job, err)
+	}
+	alloc, err := fsm.State().AllocByID(nil, allocID)
+	if err != nil || alloc == nil {
+		t.Fatalf("alloc: %v %v", alloc, err)
+	}
+	if stats := broker.Stats(); stats.TotalReady != 1 {
+		t.Errorf("ready evals = %d, want 1", stats.TotalReady)
+	}
+}
+
+func TestFSM_JobBulk(t *testing.T) {
+	broker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker.SetEnabled(true)
+	fsm, err := NewFSM(broker, NewBlockedEvals(broker), os.Stderr, log.New(os.Stderr, log.ErrorLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range []string{"job1", "job2"} {
+		job := topologyTestJob(id, "a", "b")
+		job.Type = models.JobTypeSync
+		if err := fsm.State().UpsertJob(uint64(i+1), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := &models.JobBulkApplyRequest{
+		Statuses:   map[string]string{"job1": models.JobStatusPause, "gone": models.JobStatusPause},
+		Deregister: []string{"job2"},
+		Evals: []*models.Evaluation{
+			{ID: models.GenerateUUID(), JobID: "job1", Type: models.JobTypeSync, Status: models.EvalStatusPending},
+			{ID: models.GenerateUUID(), JobID: "job2", Type: models.JobTypeSync, Status: models.EvalStatusPending},
+		},
+	}
+	buf, err := models.Encode(models.JobBulkApplyRequestType, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := fsm.Apply(&raft.Log{Index: 10, Data: buf}); resp != nil {
+		t.Fatalf("apply: %v", resp)
+	}
+
+	job, err := fsm.State().JobByID(nil, "job1")
+	if err != nil || job == nil {
+		t.Fatalf("job1: %v %v", job, err)
+	}
+	if job.Status != models.JobStatusPause || job.ModifyIndex != 10 {
+		t.Errorf("job1 status = %v at %d, want pause at 10", job.Status, job.ModifyIndex)
+	}
+	if job, err := fsm.State().JobByID(nil, "job2"); err != nil || job != nil {
+		t.Errorf("job2 = %v %v, want deleted", job, err)
+	}
+	eval, err := fsm.State().EvalByID(nil, req.Evals[0].ID)
+	if err != nil || eval == nil || eval.JobModifyIndex != 10 {
+		t.Fatalf("eval: %v %v", eval, err)
+	}
+	if stats := broker.Stats(); stats.TotalReady != 2 {
+		t.Errorf("ready evals = %d, want 2", stats.TotalReady)
+	}
+}
+
+func TestFSM_AllocClientUpdateFailure(t *testing.T) {
+	broker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm, err := NewFSM(broker, NewBlockedEvals(broker), os.Stderr, log.New(os.Stderr, log.ErrorLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := topologyTestJob("job1", "a", "b")
+	job.Type = models.JobTypeSync
+	if err := fsm.State().UpsertJob(1, job); err != nil {
+		t.Fatal(err)
+	}
+	alloc := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), NodeID: models.GenerateUUID(),
+		JobID: "job1", Job: job, Task: models.TaskTypeSrc}
+	if err := fsm.State().UpsertAllocs(2, []*models.Allocation{alloc}); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(index uint64, events ...*models.TaskEvent) *models.Job {
+		a := alloc.Copy()
+		a.ClientStatus = models.AllocClientStatusRunning
+		a.TaskStates = map[string]*models.TaskState{models.TaskTypeSrc: {State: models.TaskStateRunning, Events: events}}
+		buf, err := models.Encode(models.AllocClientUpdateRequestType, &models.AllocUpdateRequest{Alloc: []*models.Allocation{a}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := fsm.Apply(&raft.Log{Index: index, Data: buf}); resp != nil {
+			t.Fatalf("apply: %v", resp)
+		}
+		job, err := fsm.State().JobByID(nil, "job1")
+		if err != nil || job == nil {
+			t.Fatalf("job1: %v %v", job, err)
+		}
+		return job
+	}
+
+	failed := models.NewTaskEvent(models.TaskDriverFailure).
+		SetDriverError(fmt.Errorf("Error 1045: Access denied for user 'dtle'@'10.0.0.2'"))
+	if job := update(10, failed); job.Failure != nil {
+		t.Fatalf("failure after a single failure: %+v", job.Failure)
+	}
+	job = update(11, failed, models.NewTaskEvent(models.TaskRestarting), failed.Copy())
+	if f := job.Failure; f == nil || f.Class != models.FailureClassAuth || f.Failures != 2 || f.AllocID != alloc.ID {
+		t.Fatalf("failure = %+v", f)
+	}
+	if job.ModifyIndex != 11 {
+		t.Errorf("modify index = %v", job.ModifyIndex)
+	}
+
+	// registering the job again, once stopped to be fixed, clears it
+	if err := fsm.State().UpdateJobStatus(12, "job1", models.JobStatusPause); err != nil {
+		t.Fatal(err)
+	}
+	job = topologyTestJob("job1", "a", "b")
+	job.Type = models.JobTypeSync
+	if err := fsm.State().UpsertJob(13, job); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := fsm.State().JobByID(nil, "job1"); job.Failure != nil {
+		t.Errorf("failure after register = %+v", job.Failure)
+	}
+}
+
+func TestFSM_AllocClientUpdateTaskGroups(t *testing.T) {
+	broker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm, err := NewFSM(broker, NewBlockedEvals(broker), os.Stderr, log.New(os.Stderr, log.ErrorLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := topologyTestJob("job1", "a", "b")
+	job.Type = models.JobTypeSync
+	job.Groups = []string{"schema", "copy", "verify"}
+	job.Tasks[0].Group = "copy"
+	job.Tasks[1].Group = "copy"
+	job.Tasks = append(job.Tasks,
+		&models.Task{Type: models.TaskTypeSchemaMigration, Driver: models.TaskDriverMySQL, Group: "schema"},
+		&models.Task{Type: models.TaskTypeVerify, Driver: models.TaskDriverMySQL, Group: "verify"})
+	if err := fsm.State().UpsertJob(1, job); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := func() (string, []string) {
+		job, err := fsm.State().JobByID(nil, "job1")
+		if err != nil || job == nil {
+			t.Fatalf("job1: %v %v", job, err)
+		}
+		var groups []string
+		for _, g := range job.GroupStates {
+			groups = append(groups, g.Status)
+		}
+		return job.Status, groups
+	}
+	if _, groups := statuses(); fmt.Sprint(groups) != "[running pending pending]" {
+		t.Fatalf("groups after register = %v", groups)
+	}
+
+	nodeID := models.GenerateUUID()
+	if err := fsm.State().UpsertNode(1, &models.Node{ID: nodeID, Name: "node1", Status: models.NodeStatusReady}); err != nil {
+		t.Fatal(err)
+	}
+	place := func(index uint64, task string) *models.Allocation {
+		alloc := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), NodeID: nodeID,
+			JobID: "job1", Job: job, Task: task, ClientStatus: models.AllocClientStatusRunning}
+		if err := fsm.State().UpsertAllocs(index, []*models.Allocation{alloc}); err != nil {
+			t.Fatal(err)
+		}
+		return alloc
+	}
+	complete := func(index uint64, alloc *models.Allocation) {
+		a := alloc.Copy()
+		a.ClientStatus = models.AllocClientStatusComplete
+		a.TaskStates = map[string]*models.TaskState{a.Task: {State: models.TaskStateDead,
+			Events: []*models.TaskEvent{models.NewTaskEvent(models.TaskTerminated).SetExitCode(0)}}}
+		buf, err := models.Encode(models.AllocClientUpdateRequestType, &models.AllocUpdateRequest{Alloc: []*models.Allocation{a}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := fsm.Apply(&raft.Log{Index: index, Data: buf}); resp != nil {
+			t.Fatalf("apply: %v", resp)
+		}
+	}
+
+	complete(10, place(2, models.TaskTypeSchemaMigration))
+	if status, groups := statuses(); status != models.JobStatusRunning || fmt.Sprint(groups) != "[complete running pending]" {
+		t.Fatalf("after the schema group: %v %v", status, groups)
+	}
+
+	src, dest := place(11, models.TaskTypeSrc), place(11, models.TaskTypeDest)
+	complete(12, src)
+	if status, groups := statuses(); status != models.JobStatusRunning || fmt.Sprint(groups) != "[complete running pending]" {
+		t.Fatalf("after a task of the copy group: %v %v", status, groups)
+	}
+	complete(13, dest)
+	if status, groups := statuses(); status != models.JobStatusRunning || fmt.Sprint(groups) != "[complete complete running]" {
+		t.Fatalf("after the copy group: %v %v", status, groups)
+	}
+
+	complete(15, place(14, models.TaskTypeVerify))
+	if status, groups := statuses(); status != models.JobStatusComplete || fmt.Sprint(groups) != "[complete complete complete]" {
+		t.Fatalf("after the last group: %v %v", status, groups)
+	}
+}
+
+func TestFSM_WarmRestartJob(t *testing.T) {
+	broker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm, err := NewFSM(broker, NewBlockedEvals(broker), os.Stderr, log.New(os.Stderr, log.ErrorLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := topologyTestJob("job1", "a", "b")
+	job.Type = models.JobTypeSync
+	if err := fsm.State().UpsertJob(1, job); err != nil {
+		t.Fatal(err)
+	}
+	running := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), NodeID: models.GenerateUUID(),
+		JobID: "job1", Job: job, Task: models.TaskTypeSrc, ClientStatus: models.AllocClientStatusRunning}
+	stopped := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), NodeID: models.GenerateUUID(),
+		JobID: "job1", Job: job, Task: models.TaskTypeSrc, DesiredStatus: models.AllocDesiredStatusStop}
+	if err := fsm.State().UpsertAllocs(2, []*models.Allocation{running, stopped}); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := job.Copy()
+	restarted.Tasks[0].Config = map[string]interface{}{
+		"ConnectionConfig": job.Tasks[0].Config["ConnectionConfig"],
+		"ReplicateDoDb":    []interface{}{map[string]interface{}{"TableSchema": "db1"}},
+	}
+	buf, err := models.Encode(models.JobRegisterRequestType, &models.JobRegisterRequest{Job: restarted, WarmRestart: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := fsm.Apply(&raft.Log{Index: 10, Data: buf}); resp != nil {
+		t.Fatalf("apply: %v", resp)
+	}
+
+	out, err := fsm.State().JobByID(nil, "job1")
+	if err != nil || out == nil || out.JobModifyIndex != 10 || out.Status != models.JobStatusRunning {
+		t.Fatalf("job: %+v %v", out, err)
+	}
+	alloc, err := fsm.State().AllocByID(nil, running.ID)
+	if err != nil || alloc == nil {
+		t.Fatalf("alloc: %v %v", alloc, err)
+	}
+	if alloc.AllocModifyIndex != 10 || alloc.Job.Tasks[0].Config["ReplicateDoDb"] == nil {
+		t.Errorf("running alloc not updated: %+v", alloc)
+	}
+	alloc, _ = fsm.State().AllocByID(nil, stopped.ID)
+	if alloc.AllocModifyIndex == 10 {
+		t.Errorf("stopped alloc updated")
+	}
+}
+
+func TestFSM_JobStats(t *testing.T) {
+	broker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm, err := NewFSM(broker, NewBlockedEvals(broker), os.Stderr, log.New(os.Stderr, log.ErrorLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := topologyTestJob("job1", "a", "b")
+	job.Type = models.JobTypeSync
+	job.SLA = &models.SLASpec{MaxLagSeconds: 2, MaxDowntimeSeconds: 600}
+	if err := fsm.State().UpsertJob(1, job); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	apply := func(index uint64, updates ...*models.JobStatsUpdate) {
+		buf, err := models.Encode(models.JobStatsUpdateRequestType, &models.JobStatsUpdateRequest{Updates: updates})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := fsm.Apply(&raft.Log{Index: index, Data: buf}); resp != nil {
+			t.Fatalf("apply: %v", resp)
+		}
+	}
+	apply(2, &models.JobStatsUpdate{JobID: "job1", Sample: &models.JobStatsSample{Time: now, LagSeconds: 3}},
+		&models.JobStatsUpdate{JobID: "gone", Sample: &models.JobStatsSample{Time: now}})
+	apply(3, &models.JobStatsUpdate{JobID: "job1", Sample: &models.JobStatsSample{Time: now.Add(time.Minute), TxPerSecond: 10}})
+
+	stats, err := fsm.State().JobStatsByID(nil, "job1")
+	if err != nil || stats == nil || len(stats.Samples) != 2 || stats.ModifyIndex != 3 {
+		t.Fatalf("stats: %+v %v", stats, err)
+	}
+	if sla := stats.SLA; sla == nil || len(sla.Breaches) != 1 || sla.Months[0].LagBreachSeconds != 60 {
+		t.Errorf("SLA: %+v", sla)
+	}
+	if gone, _ := fsm.State().JobStatsByID(nil, "gone"); gone != nil {
+		t.Errorf("stats of a job not registered: %+v", gone)
+	}
+
+	if err := fsm.State().DeleteJob(4, "job1"); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := fsm.State().JobStatsByID(nil, "job1"); stats != nil {
+		t.Errorf("stats of a deleted job: %+v", stats)
+	}
+}
@@ -18,7 +18,6 @@ import (
 
 	"github.com/docker/leadership"
 	"github.com/hashicorp/raft"
-	raftboltdb "github.com/hashicorp/raft-boltdb"
 	"github.com/hashicorp/serf/serf"
 )
 
@@ -31,7 +30,7 @@ func TestServer_initializeHeartbeatTimers(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -116,7 +115,7 @@ func TestServer_resetHeartbeatTimer(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -211,7 +210,7 @@ func TestServer_resetHeartbeatTimerLocked(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -298,7 +297,7 @@ func TestServer_invalidateHeartbeat(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -384,7 +383,7 @@ func TestServer_clearHeartbeatTimer(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -473,7 +472,7 @@ func TestServer_clearAllHeartbeatTimers(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -558,7 +557,7 @@ func TestServer_heartbeatStats(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
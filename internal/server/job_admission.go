@@ -0,0 +1,215 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// maxAdmissionResponse bounds the body read from an admission webhook
+const maxAdmissionResponse = 10 * 1024 * 1024
+
+// jobAdmitter is an admission controller of the registered jobs. It returns
+// the job to register, the given one or a changed copy, or an error to
+// reject it.
+type jobAdmitter interface {
+	Name() string
+	Admit(job *models.Job) (*models.Job, error)
+}
+
+// newJobAdmitters returns the admission controllers set by the config, the
+// built-in ones first.
+func newJobAdmitters(cfg *config.AdmissionConfig, logger *ulog.Logger) ([]jobAdmitter, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg = cfg.SetDefault()
+
+	var admitters []jobAdmitter
+	if cfg.JobNamePattern != "" {
+		admitters = append(admitters, &jobNameAdmitter{pattern: regexp.MustCompile(cfg.JobNamePattern)})
+	}
+	if cfg.ForbidDrop {
+		admitters = append(admitters, forbidDropAdmitter{})
+	}
+	if cfg.WebhookURL != "" {
+		admitters = append(admitters, &webhookAdmitter{
+			url:      cfg.WebhookURL,
+			headers:  cfg.WebhookHeaders,
+			failOpen: cfg.WebhookFailOpen,
+			client:   &http.Client{Timeout: cfg.WebhookTimeout},
+			logger:   logger,
+		})
+	}
+	return admitters, nil
+}
+
+// admitJob runs the job through the admission controllers in order, each
+// one getting the job returned by the previous one.
+func admitJob(admitters []jobAdmitter, job *models.Job) (*models.Job, error) {
+	for _, a := range admitters {
+		admitted, err := a.Admit(job)
+		if err != nil {
+			return nil, fmt.Errorf("admission controller %q rejected job %v: %v", a.Name(), job.ID, err)
+		}
+		if admitted == nil {
+			continue
+		}
+		if admitted.ID != job.ID {
+			return nil, fmt.Errorf("admission controller %q changed the ID of job %v to %q", a.Name(), job.ID, admitted.ID)
+		}
+		admitted.Canonicalize()
+		job = admitted
+	}
+	return job, nil
+}
+
+// jobNameAdmitter enforces a naming convention of the jobs.
+type jobNameAdmitter struct {
+	pattern *regexp.Regexp
+}
+
+func (a *jobNameAdmitter) Name() string {
+	return "job-name"
+}
+
+func (a *jobNameAdmitter) Admit(job *models.Job) (*models.Job, error) {
+	if !a.pattern.MatchString(job.ID) {
+		return nil, fmt.Errorf("job ID %q does not match %q", job.ID, a.pattern)
+	}
+	if job.Name != "" && !a.pattern.MatchString(job.Name) {
+		return nil, fmt.Errorf("job name %q does not match %q", job.Name, a.pattern)
+	}
+	return job, nil
+}
+
+// forbidDropAdmitter rejects the jobs allowed to drop the tables of their
+// destination, or dropping objects in a schema migration.
+type forbidDropAdmitter struct{}
+
+func (forbidDropAdmitter) Name() string {
+	return "forbid-drop"
+}
+
+func (forbidDropAdmitter) Admit(job *models.Job) (*models.Job, error) {
+	for _, t := range job.Tasks {
+		if t.Driver != "" && t.Driver != models.TaskDriverMySQL {
+			continue
+		}
+		if t.Type == models.TaskTypeSchemaMigration {
+			var step config.StepConfig
+			if err := mapstructure.WeakDecode(t.Config, &step); err != nil {
+				return nil, fmt.Errorf("failed to decode the config of task %v: %v", t.Type, err)
+			}
+			for i, stmt := range step.Statements {
+				if fields := strings.Fields(stmt); len(fields) > 0 && strings.EqualFold(fields[0], "drop") {
+					return nil, fmt.Errorf("statement %d of task %v drops %v", i, t.Type, strings.Join(fields[1:], " "))
+				}
+			}
+			continue
+		}
+		var cfg config.MySQLDriverConfig
+		if err := mapstructure.WeakDecode(t.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to decode the config of task %v: %v", t.Type, err)
+		}
+		if cfg.DropTableIfExists {
+			return nil, fmt.Errorf("task %v sets DropTableIfExists", t.Type)
+		}
+	}
+	return job, nil
+}
+
+// admissionReview is the request and response body of an admission webhook.
+type admissionReview struct {
+	Job *models.Job
+
+	// Allowed and Reason are set by the webhook
+	Allowed bool
+	Reason  string
+}
+
+// webhookAdmitter asks an external HTTP service to admit the jobs. The
+// service may return a changed job, e.g. with masking rules added.
+type webhookAdmitter struct {
+	url      string
+	headers  map[string]string
+	failOpen bool
+	client   *http.Client
+	logger   *ulog.Logger
+}
+
+func (a *webhookAdmitter) Name() string {
+	return "webhook"
+}
+
+func (a *webhookAdmitter) Admit(job *models.Job) (*models.Job, error) {
+	review, err := a.review(job)
+	if err != nil {
+		if a.failOpen {
+			a.logger.Warnf("manager: admission webhook failed, admitting job %v: %v", job.ID, err)
+			return job, nil
+		}
+		return nil, err
+	}
+	if !review.Allowed {
+		if review.Reason == "" {
+			review.Reason = "denied by the webhook"
+		}
+		return nil, fmt.Errorf("%s", review.Reason)
+	}
+	return review.Job, nil
+}
+
+func (a *webhookAdmitter) review(job *models.Job) (*admissionReview, error) {
+	body, err := json.Marshal(&admissionReview{Job: job})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the job: %v", err)
+	}
+	req, err := http.NewRequest("POST", a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range a.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAdmissionResponse))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the webhook response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(buf))
+	}
+
+	var review admissionReview
+	if err := json.Unmarshal(buf, &review); err != nil {
+		return nil, fmt.Errorf("failed to decode the webhook response: %v", err)
+	}
+	return &review, nil
+}
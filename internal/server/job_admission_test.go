@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestAdmitJob_BuiltIn(t *testing.T) {
+	admitters, err := newJobAdmitters(&config.AdmissionConfig{
+		JobNamePattern: "^[a-z]+-[a-z0-9-]+$",
+		ForbidDrop:     true,
+	}, ulog.New(os.Stderr, ulog.ErrorLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := topologyTestJob("orders-a-b", "a", "b")
+	if admitted, err := admitJob(admitters, job); err != nil || admitted != job {
+		t.Errorf("admitJob() = %v %v", admitted, err)
+	}
+
+	if _, err := admitJob(admitters, topologyTestJob("Orders", "a", "b")); err == nil ||
+		!strings.Contains(err.Error(), `"job-name"`) {
+		t.Errorf("a badly named job was admitted: %v", err)
+	}
+
+	migration := &models.Task{
+		Type:   models.TaskTypeSchemaMigration,
+		Driver: models.TaskDriverMySQL,
+		Config: map[string]interface{}{"Statements": []string{"alter table a.t add column c int", "DROP table a.u"}},
+	}
+	job.Tasks = append(job.Tasks, migration)
+	if _, err := admitJob(admitters, job); err == nil || !strings.Contains(err.Error(), "statement 1 of task SchemaMigration drops table a.u") {
+		t.Errorf("a schema migration dropping a table was admitted: %v", err)
+	}
+	job.Tasks = job.Tasks[:2]
+
+	job.Tasks[1].Config["DropTableIfExists"] = "true"
+	if _, err := admitJob(admitters, job); err == nil || !strings.Contains(err.Error(), `"forbid-drop"`) {
+		t.Errorf("a job dropping tables was admitted: %v", err)
+	}
+
+	if _, err := newJobAdmitters(&config.AdmissionConfig{JobNamePattern: "["}, nil); err == nil {
+		t.Error("an invalid pattern was accepted")
+	}
+}
+
+func TestAdmitJob_Webhook(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var review admissionReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch review.Job.ID {
+		case "denied":
+			review.Reason = "table users.email is not masked"
+			review.Job = nil
+		case "renamed":
+			review.Allowed = true
+			review.Job.ID = "other"
+		default:
+			review.Allowed = true
+			review.Job.Meta = map[string]string{"admitted-by": "webhook"}
+		}
+		json.NewEncoder(w).Encode(&review)
+	}))
+	defer ts.Close()
+
+	cfg := &config.AdmissionConfig{
+		WebhookURL:     ts.URL,
+		WebhookHeaders: map[string]string{"X-Token": "secret"},
+	}
+	logger := ulog.New(os.Stderr, ulog.ErrorLevel)
+	admitters, err := newJobAdmitters(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admitted, err := admitJob(admitters, topologyTestJob("job1", "a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admitted.Meta["admitted-by"] != "webhook" || len(admitted.Tasks) != 2 {
+		t.Errorf("the job was not changed by the webhook: %+v", admitted)
+	}
+
+	if _, err := admitJob(admitters, topologyTestJob("denied", "a", "b")); err == nil ||
+		!strings.Contains(err.Error(), "users.email is not masked") {
+		t.Errorf("a denied job was admitted: %v", err)
+	}
+	if _, err := admitJob(admitters, topologyTestJob("renamed", "a", "b")); err == nil {
+		t.Error("the webhook changed the job ID")
+	}
+
+	// the webhook fails
+	cfg.WebhookHeaders = nil
+	cfg.WebhookTimeout = time.Second
+	if admitters, err = newJobAdmitters(cfg, logger); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admitJob(admitters, topologyTestJob("job1", "a", "b")); err == nil {
+		t.Error("the job was admitted while the webhook failed")
+	}
+	cfg.WebhookFailOpen = true
+	if admitters, err = newJobAdmitters(cfg, logger); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admitJob(admitters, topologyTestJob("job1", "a", "b")); err != nil {
+		t.Errorf("the job was rejected while failing open: %v", err)
+	}
+}
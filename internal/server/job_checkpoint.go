@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// SetCheckpoint sets where the tasks of a paused job resume. The job must
+// have no running allocation, whose tasks would report their own checkpoint
+// over it.
+func (j *Job) SetCheckpoint(args *models.JobSetCheckpointRequest, reply *models.JobResponse) error {
+	if done, err := j.srv.forward("Job.SetCheckpoint", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "set_checkpoint"}, time.Now())
+
+	if args.JobID == "" {
+		reply.Success = false
+		return fmt.Errorf("missing job ID for setting the checkpoint")
+	}
+	if (args.Gtid == "") == (args.CopyProgress == nil) {
+		reply.Success = false
+		return fmt.Errorf("either Gtid or CopyProgress is set as the checkpoint of job %v", args.JobID)
+	}
+
+	job, err := j.checkpointedJob(args)
+	if err != nil {
+		reply.Success = false
+		return err
+	}
+
+	// the job is not running, its allocations are left as they are
+	req := &models.JobRegisterRequest{
+		Job:          job,
+		WarmRestart:  true,
+		WriteRequest: args.WriteRequest,
+	}
+	_, index, err := j.srv.raftApply(models.JobRegisterRequestType, req)
+	if err != nil {
+		j.srv.logger.Errorf("server.job: SetCheckpoint failed: %v", err)
+		reply.Success = false
+		return err
+	}
+	if args.Gtid != "" {
+		j.srv.logger.Printf("server.job: set the checkpoint of job %v to Gtid %v", job.ID, args.Gtid)
+	} else {
+		j.srv.logger.Printf("server.job: set the copy progress of job %v, of %d tables",
+			job.ID, len(args.CopyProgress.Tables))
+	}
+
+	reply.Success = true
+	reply.Index = index
+	return nil
+}
+
+// checkpointedJob returns the paused job of args with the checkpoint of args
+// set.
+func (j *Job) checkpointedJob(args *models.JobSetCheckpointRequest) (*models.Job, error) {
+	snap, err := j.srv.fsm.State().Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	ws := memdb.NewWatchSet()
+	existing, err := snap.JobByID(ws, args.JobID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("job %v not found", args.JobID)
+	}
+	if existing.Status != models.JobStatusPause {
+		return nil, fmt.Errorf("job %v is %v, pause it to set its checkpoint", args.JobID, existing.Status)
+	}
+	allocs, err := snap.AllocsByJob(ws, args.JobID, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, alloc := range allocs {
+		if !alloc.TerminalStatus() {
+			return nil, fmt.Errorf("allocation %v of job %v is still %v, retry once it is stopped",
+				alloc.ID, args.JobID, alloc.ClientStatus)
+		}
+	}
+
+	job := existing.Copy()
+	dest := job.LookupTask(models.TaskTypeDest)
+	if dest == nil {
+		return nil, fmt.Errorf("job %v has no task %v", args.JobID, models.TaskTypeDest)
+	}
+	if args.CopyProgress != nil {
+		gtid, _, err := dest.Checkpoint()
+		if err != nil {
+			return nil, err
+		}
+		if gtid != "" {
+			return nil, fmt.Errorf("the full copy of job %v is done, its checkpoint is a GTID set", args.JobID)
+		}
+	}
+	for _, t := range job.Tasks {
+		if t.Type != models.TaskTypeSrc && t.Type != models.TaskTypeDest && t.Type != models.TaskTypeDestStandby {
+			continue
+		}
+		t.SetCheckpoint(args.Gtid, args.CopyProgress)
+	}
+	return job, nil
+}
+
+// SkipTx arms the Dest task of a running job to skip its next transaction
+// failing on the target. As for tuning, the allocations get the job without
+// an evaluation, and a task restarted later gets the arm too.
+func (j *Job) SkipTx(args *models.JobSkipTxRequest, reply *models.JobSkipTxResponse) error {
+	if done, err := j.srv.forward("Job.SkipTx", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "skip_tx"}, time.Now())
+
+	if args.JobID == "" {
+		return fmt.Errorf("missing job ID for skipping a transaction")
+	}
+	snap, err := j.srv.fsm.State().Snapshot()
+	if err != nil {
+		return err
+	}
+	existing, err := snap.JobByID(memdb.NewWatchSet(), args.JobID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return fmt.Errorf("job %v not found", args.JobID)
+	}
+	if existing.Status != models.JobStatusRunning {
+		return fmt.Errorf("job %v is %v, only a running job skips a transaction", args.JobID, existing.Status)
+	}
+
+	job := existing.Copy()
+	dest := job.LookupTask(models.TaskTypeDest)
+	if dest == nil || (dest.Driver != "" && dest.Driver != models.TaskDriverMySQL) {
+		return fmt.Errorf("job %v has no MySQL task %v", args.JobID, models.TaskTypeDest)
+	}
+	skip := &models.SkipTx{
+		ID:     models.GenerateUUID(),
+		Gtid:   args.Gtid,
+		Reason: args.Reason,
+	}
+	dest.SetSkipTx(skip)
+
+	req := &models.JobRegisterRequest{
+		Job:          job,
+		WarmRestart:  true,
+		WriteRequest: args.WriteRequest,
+	}
+	_, index, err := j.srv.raftApply(models.JobRegisterRequestType, req)
+	if err != nil {
+		j.srv.logger.Errorf("server.job: SkipTx failed: %v", err)
+		return err
+	}
+	j.srv.logger.Printf("server.job: armed skip %v of the next failing transaction %v of job %v: %v",
+		skip.ID, skip.Gtid, job.ID, skip.Reason)
+
+	reply.SkipID = skip.ID
+	reply.Index = index
+	return nil
+}
@@ -8,6 +8,7 @@ package server
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/armon/go-metrics"
@@ -49,11 +50,38 @@ func (j *Job) Register(args *models.JobRegisterRequest, reply *models.JobRespons
 	// Initialize the job fields (sets defaults and any necessary init work).
 	args.Job.Canonicalize()
 
+	// Run the admission controllers, which may change the job
+	job, err := admitJob(j.srv.admitters, args.Job)
+	if err != nil {
+		reply.Success = false
+		return err
+	}
+	args.Job = job
+	if args.WarmRestart {
+		return j.warmRestart(args, reply)
+	}
+
 	// Validate the job.
 	/*if err := validateJob(args.Job); err != nil {
 		reply.Success = false
 		return err
 	}*/
+	if err := j.validateTopology(args.Job); err != nil {
+		reply.Success = false
+		return err
+	}
+	if err := j.validateTableOwnership(args.Job); err != nil {
+		reply.Success = false
+		return err
+	}
+	if err := j.validateTransit(args.Job); err != nil {
+		reply.Success = false
+		return err
+	}
+	if err := j.checkQuota(args.Job); err != nil {
+		reply.Success = false
+		return err
+	}
 
 	if args.EnforceIndex {
 		// Lookup the job
@@ -98,6 +126,7 @@ func (j *Job) Register(args *models.JobRegisterRequest, reply *models.JobRespons
 		Type:           args.Job.Type,
 		TriggeredBy:    models.EvalTriggerJobRegister,
 		JobID:          args.Job.ID,
+		Namespace:      args.Job.Namespace,
 		JobModifyIndex: index,
 		Status:         models.EvalStatusPending,
 	}
@@ -118,6 +147,7 @@ func (j *Job) Register(args *models.JobRegisterRequest, reply *models.JobRespons
 
 	// Populate the reply with eval information
 	reply.Success = true
+	reply.EvalID = eval.ID
 	reply.Index = evalIndex
 	return nil
 }
@@ -213,6 +243,7 @@ func (j *Job) UpdateStatus(args *models.JobUpdateStatusRequest, reply *models.Jo
 			Type:           job.Type,
 			TriggeredBy:    triggeredBy,
 			JobID:          args.JobID,
+			Namespace:      job.Namespace,
 			JobModifyIndex: index,
 			Status:         models.EvalStatusPending,
 		}
@@ -233,6 +264,7 @@ func (j *Job) UpdateStatus(args *models.JobUpdateStatusRequest, reply *models.Jo
 
 		// Populate the reply with eval information
 		reply.Success = true
+		reply.EvalID = eval.ID
 		reply.Index = evalIndex
 	}
 
@@ -253,6 +285,12 @@ func (j *Job) Validate(args *models.JobValidateRequest,
 	if err := args.Job.Validate(); err != nil {
 		return err
 	}
+	if err := j.validateTransit(args.Job); err != nil {
+		return err
+	}
+	if err := j.validateTopology(args.Job); err != nil {
+		return err
+	}
 
 	// Validate the driver configurations.
 	for _, task := range args.Job.Tasks {
@@ -272,6 +310,15 @@ func (j *Job) Validate(args *models.JobValidateRequest,
 		rep.Type = task.Type
 		reply.ValidationTasks = append(reply.ValidationTasks, rep)
 	}
+	// the target tables are the ones the Src task selects
+	src, dest := args.Job.LookupTask(models.TaskTypeSrc), args.Job.LookupTask(models.TaskTypeDest)
+	if src != nil && dest != nil && src.Driver == models.TaskDriverMySQL && dest.Driver == models.TaskDriverMySQL {
+		for _, rep := range reply.ValidationTasks {
+			if rep.Type == models.TaskTypeDest && rep.Connection.Success {
+				rep.TargetObjects = driver.ValidateTargetObjects(src, dest)
+			}
+		}
+	}
 	reply.DriverConfigValidated = true
 	return nil
 }
@@ -312,6 +359,7 @@ func (j *Job) Evaluate(args *models.JobEvaluateRequest, reply *models.JobRespons
 		Type:           job.Type,
 		TriggeredBy:    models.EvalTriggerJobRegister,
 		JobID:          job.ID,
+		Namespace:      job.Namespace,
 		JobModifyIndex: job.ModifyIndex,
 		Status:         models.EvalStatusPending,
 	}
@@ -330,10 +378,145 @@ func (j *Job) Evaluate(args *models.JobEvaluateRequest, reply *models.JobRespons
 
 	// Setup the reply
 	reply.Success = true
+	reply.EvalID = eval.ID
 	reply.Index = evalIndex
 	return nil
 }
 
+// Bulk pauses, resumes, stops or re-evaluates the jobs selected by the
+// filters and IDs of the request. The status updates, deregistrations and
+// evaluations of all the jobs are committed in a single raft log.
+func (j *Job) Bulk(args *models.JobBulkRequest, reply *models.JobBulkResponse) error {
+	if done, err := j.srv.forward("Job.Bulk", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "bulk"}, time.Now())
+
+	var triggeredBy string
+	switch args.Operation {
+	case models.JobBulkPause:
+		triggeredBy = models.EvalTriggerJobPause
+	case models.JobBulkResume:
+		triggeredBy = models.EvalTriggerJobResume
+	case models.JobBulkStop:
+		triggeredBy = models.EvalTriggerJobDeregister
+	case models.JobBulkEvaluate:
+		triggeredBy = models.EvalTriggerJobRegister
+	default:
+		return fmt.Errorf("invalid bulk operation %q", args.Operation)
+	}
+	if len(args.Filters) == 0 && len(args.JobIDs) == 0 {
+		return fmt.Errorf("no jobs selected, set filters or job IDs")
+	}
+
+	snap, err := j.srv.fsm.State().Snapshot()
+	if err != nil {
+		return err
+	}
+	jobs, missing, err := selectBulkJobs(snap, args)
+	if err != nil {
+		return err
+	}
+	for _, id := range missing {
+		reply.Results = append(reply.Results, &models.JobBulkResult{JobID: id, Error: "job not found"})
+	}
+
+	apply := &models.JobBulkApplyRequest{
+		Statuses:     make(map[string]string),
+		WriteRequest: models.WriteRequest{Region: args.Region},
+	}
+	for _, job := range jobs {
+		r := &models.JobBulkResult{JobID: job.ID, Name: job.Name}
+		reply.Results = append(reply.Results, r)
+
+		eval := &models.Evaluation{
+			ID:          models.GenerateUUID(),
+			Type:        job.Type,
+			TriggeredBy: triggeredBy,
+			JobID:       job.ID,
+			Namespace:   job.Namespace,
+			Status:      models.EvalStatusPending,
+		}
+		switch args.Operation {
+		case models.JobBulkPause, models.JobBulkResume:
+			status := models.JobStatusPause
+			if args.Operation == models.JobBulkResume {
+				status = models.JobStatusRunning
+			}
+			if job.Status == status {
+				r.Skipped = true
+				continue
+			}
+			apply.Statuses[job.ID] = status
+		case models.JobBulkStop:
+			eval.Type = models.JobTypeSync
+			apply.Deregister = append(apply.Deregister, job.ID)
+		case models.JobBulkEvaluate:
+			eval.JobModifyIndex = job.ModifyIndex
+		}
+		r.EvalID = eval.ID
+		apply.Evals = append(apply.Evals, eval)
+	}
+	if len(apply.Evals) == 0 {
+		return nil
+	}
+
+	resp, index, err := j.srv.raftApply(models.JobBulkApplyRequestType, apply)
+	if err == nil {
+		err, _ = resp.(error)
+	}
+	if err != nil {
+		j.srv.logger.Errorf("server.job: Bulk %v failed: %v", args.Operation, err)
+		return err
+	}
+	reply.Index = index
+	return nil
+}
+
+// selectBulkJobs returns the jobs of a bulk request: the jobs of its IDs
+// matching its filters if it has IDs, else all the jobs matching its
+// filters. The IDs which are not found are returned apart.
+func selectBulkJobs(snap *store.StateSnapshot, args *models.JobBulkRequest) ([]*models.Job, []string, error) {
+	ws := memdb.NewWatchSet()
+	var jobs []*models.Job
+	var missing []string
+	if len(args.JobIDs) > 0 {
+		seen := make(map[string]bool)
+		for _, id := range args.JobIDs {
+			job, err := snap.JobByID(ws, id)
+			if err != nil {
+				return nil, nil, err
+			}
+			if job == nil {
+				missing = append(missing, id)
+			} else if !seen[job.ID] && matchJobFilters(job, args.Filters) {
+				seen[job.ID] = true
+				jobs = append(jobs, job)
+			}
+		}
+		return jobs, missing, nil
+	}
+
+	var iter memdb.ResultIterator
+	var err error
+	if f := indexedJobFilter(args.Filters); f != nil {
+		key, _ := f.MetaKey()
+		iter, err = snap.JobsByMeta(ws, key, f.Value)
+	} else {
+		iter, err = snap.Jobs(ws)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		job := raw.(*models.Job)
+		if matchJobFilters(job, args.Filters) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil, nil
+}
+
 // Deregister is used to remove a job the cluster.
 func (j *Job) Deregister(args *models.JobDeregisterRequest, reply *models.JobResponse) error {
 	if done, err := j.srv.forward("Job.Deregister", args, args, reply); done {
@@ -347,6 +530,12 @@ func (j *Job) Deregister(args *models.JobDeregisterRequest, reply *models.JobRes
 		return fmt.Errorf("missing job ID for evaluation")
 	}
 
+	// The namespace of the evaluation, the job being gone once deregistered
+	namespace := models.DefaultNamespace
+	if job, err := j.srv.fsm.State().JobByID(nil, args.JobID); err == nil && job != nil {
+		namespace = job.Namespace
+	}
+
 	// Commit this update via Raft
 	_, index, err := j.srv.raftApply(models.JobDeregisterRequestType, args)
 	if err != nil {
@@ -364,6 +553,7 @@ func (j *Job) Deregister(args *models.JobDeregisterRequest, reply *models.JobRes
 		Type:           models.JobTypeSync,
 		TriggeredBy:    models.EvalTriggerJobDeregister,
 		JobID:          args.JobID,
+		Namespace:      namespace,
 		JobModifyIndex: index,
 		Status:         models.EvalStatusPending,
 	}
@@ -382,6 +572,7 @@ func (j *Job) Deregister(args *models.JobDeregisterRequest, reply *models.JobRes
 
 	// Populate the reply with eval information
 	reply.Success = true
+	reply.EvalID = eval.ID
 	reply.Index = evalIndex
 	return nil
 }
@@ -441,7 +632,11 @@ func (j *Job) List(args *models.JobListRequest,
 			// Capture all the jobs
 			var err error
 			var iter memdb.ResultIterator
-			if prefix := args.QueryOptions.Prefix; prefix != "" {
+			prefix := args.QueryOptions.Prefix
+			if f := indexedJobFilter(args.Filters); f != nil {
+				key, _ := f.MetaKey()
+				iter, err = state.JobsByMeta(ws, key, f.Value)
+			} else if prefix != "" {
 				iter, err = state.JobsByIDPrefix(ws, prefix)
 			} else {
 				iter, err = state.Jobs(ws)
@@ -457,6 +652,13 @@ func (j *Job) List(args *models.JobListRequest,
 					break
 				}
 				job := raw.(*models.Job)
+				if args.Owner != "" && job.Owner != args.Owner {
+					continue
+				}
+				if !strings.HasPrefix(strings.ToLower(job.ID), strings.ToLower(prefix)) ||
+					!matchJobFilters(job, args.Filters) {
+					continue
+				}
 				jobCopy0, err := copystructure.Copy(job)
 				if err != nil {
 					return err
@@ -492,6 +694,26 @@ func (j *Job) List(args *models.JobListRequest,
 	return j.srv.blockingRPC(&opts)
 }
 
+// indexedJobFilter returns a filter of the list which can be looked up by
+// the meta index of the jobs, if any.
+func indexedJobFilter(filters []*models.JobFilter) *models.JobFilter {
+	for _, f := range filters {
+		if _, ok := f.MetaKey(); ok && f.Op == models.JobFilterEqual {
+			return f
+		}
+	}
+	return nil
+}
+
+func matchJobFilters(job *models.Job, filters []*models.JobFilter) bool {
+	for _, f := range filters {
+		if !f.Matches(job) {
+			return false
+		}
+	}
+	return true
+}
+
 // Allocations is used to list the allocations for a job
 func (j *Job) Allocations(args *models.JobSpecificRequest,
 	reply *models.JobAllocationsResponse) error {
@@ -585,6 +807,13 @@ func (j *Job) Plan(args *models.JobPlanRequest, reply *models.JobPlanResponse) e
 	// Initialize the job fields (sets defaults and any necessary init work).
 	args.Job.Canonicalize()
 
+	// Plan the job as it would be registered
+	job, err := admitJob(j.srv.admitters, args.Job)
+	if err != nil {
+		return err
+	}
+	args.Job = job
+
 	// Validate the job.
 	/*if err := validateJob(args.Job); err != nil {
 		return err
@@ -619,6 +848,7 @@ func (j *Job) Plan(args *models.JobPlanRequest, reply *models.JobPlanResponse) e
 		Type:           args.Job.Type,
 		TriggeredBy:    models.EvalTriggerJobRegister,
 		JobID:          args.Job.ID,
+		Namespace:      args.Job.Namespace,
 		JobModifyIndex: updatedIndex,
 		Status:         models.EvalStatusPending,
 		AnnotatePlan:   true,
@@ -631,7 +861,8 @@ func (j *Job) Plan(args *models.JobPlanRequest, reply *models.JobPlanResponse) e
 	}
 
 	// Create the scheduler and run it
-	sched, err := scheduler.NewScheduler(eval.Type, j.srv.logger, snap, planner)
+	sched, err := scheduler.NewScheduler(eval.Type, j.srv.logger, snap, planner, j.srv.config.SchedulerAlgorithm,
+		j.srv.config.MaxFullCopies)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+// SLA returns the compliance of a job to its SLA, by day and by month, with
+// its last breaches.
+func (j *Job) SLA(args *models.JobSLARequest, reply *models.JobSLAResponse) error {
+	if done, err := j.srv.forward("Job.SLA", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "sla"}, time.Now())
+
+	opts := blockingOptions{
+		queryOpts: &args.QueryOptions,
+		queryMeta: &reply.QueryMeta,
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			job, err := state.JobByID(ws, args.JobID)
+			if err != nil {
+				return err
+			}
+			if job == nil {
+				return fmt.Errorf("job %v not found", args.JobID)
+			}
+			if job.SLA == nil {
+				return fmt.Errorf("job %v has no SLA", args.JobID)
+			}
+			status, err := jobSLAStatus(ws, state, job.ID)
+			if err != nil {
+				return err
+			}
+			reply.Report = status.Report(job, time.Now())
+
+			index, err := state.Index("job_stats")
+			if err != nil {
+				return err
+			}
+			reply.Index = index
+			j.srv.setQueryMeta(&reply.QueryMeta)
+			return nil
+		}}
+	return j.srv.blockingRPC(&opts)
+}
+
+// SLAReports returns the compliance of the jobs with an SLA over a month, of
+// a namespace or of all of them.
+func (j *Job) SLAReports(args *models.SLAReportsRequest, reply *models.SLAReportsResponse) error {
+	if done, err := j.srv.forward("Job.SLAReports", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "sla_reports"}, time.Now())
+
+	month := args.Month.UTC()
+	if month.IsZero() {
+		month = time.Now().UTC()
+	}
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	opts := blockingOptions{
+		queryOpts: &args.QueryOptions,
+		queryMeta: &reply.QueryMeta,
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			iter, err := state.Jobs(ws)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			reply.Reports = nil
+			for raw := iter.Next(); raw != nil; raw = iter.Next() {
+				job := raw.(*models.Job)
+				if job.SLA == nil || args.Namespace != "" && job.Namespace != args.Namespace {
+					continue
+				}
+				status, err := jobSLAStatus(ws, state, job.ID)
+				if err != nil {
+					return err
+				}
+				reply.Reports = append(reply.Reports, status.Report(job, now).Month(month))
+			}
+
+			index, err := state.Index("job_stats")
+			if err != nil {
+				return err
+			}
+			reply.Index = index
+			j.srv.setQueryMeta(&reply.QueryMeta)
+			return nil
+		}}
+	return j.srv.blockingRPC(&opts)
+}
+
+// jobSLAStatus returns the SLA status of a job, nil if it has no samples yet
+func jobSLAStatus(ws memdb.WatchSet, state *store.StateStore, jobID string) (*models.SLAStatus, error) {
+	stats, err := state.JobStatsByID(ws, jobID)
+	if err != nil || stats == nil {
+		return nil, err
+	}
+	return stats.SLA, nil
+}
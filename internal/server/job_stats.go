@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+// defaultJobStatsPeriod is the period of the samples of a job returned if
+// none is asked for
+const defaultJobStatsPeriod = time.Hour
+
+// Stats returns the samples of the lag and the throughput of a job over the
+// period of args.
+func (j *Job) Stats(args *models.JobStatsRequest, reply *models.JobStatsResponse) error {
+	if done, err := j.srv.forward("Job.Stats", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "stats"}, time.Now())
+
+	period := args.Period
+	if period <= 0 {
+		period = defaultJobStatsPeriod
+	}
+	opts := blockingOptions{
+		queryOpts: &args.QueryOptions,
+		queryMeta: &reply.QueryMeta,
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			job, err := state.JobByID(ws, args.JobID)
+			if err != nil {
+				return err
+			}
+			if job == nil {
+				return fmt.Errorf("job %v not found", args.JobID)
+			}
+			stats, err := state.JobStatsByID(ws, args.JobID)
+			if err != nil {
+				return err
+			}
+			reply.JobID = args.JobID
+			reply.Samples = nil
+			if stats != nil {
+				reply.Samples = stats.Since(time.Now().Add(-period))
+			}
+
+			index, err := state.Index("job_stats")
+			if err != nil {
+				return err
+			}
+			reply.Index = index
+			j.srv.setQueryMeta(&reply.QueryMeta)
+			return nil
+		}}
+	return j.srv.blockingRPC(&opts)
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// Tune sets the TunableConfig of the tasks of a running job. As for a warm
+// restart, the allocations get the job without an evaluation, and their
+// tasks apply the values at once.
+func (j *Job) Tune(args *models.JobTuneRequest, reply *models.JobResponse) error {
+	if done, err := j.srv.forward("Job.Tune", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "tune"}, time.Now())
+
+	if args.JobID == "" {
+		reply.Success = false
+		return fmt.Errorf("missing job ID for tuning")
+	}
+	if len(args.Tunables) == 0 {
+		reply.Success = false
+		return fmt.Errorf("missing tunables for job %v", args.JobID)
+	}
+
+	job, err := j.tunedJob(args)
+	if err != nil {
+		reply.Success = false
+		return err
+	}
+	// the rows per second count against the quota of the namespace
+	if err := j.checkQuota(job); err != nil {
+		reply.Success = false
+		return err
+	}
+
+	req := &models.JobRegisterRequest{
+		Job:          job,
+		WarmRestart:  true,
+		WriteRequest: args.WriteRequest,
+	}
+	_, index, err := j.srv.raftApply(models.JobRegisterRequestType, req)
+	if err != nil {
+		j.srv.logger.Errorf("server.job: Tune failed: %v", err)
+		reply.Success = false
+		return err
+	}
+	j.srv.logger.Printf("server.job: tuned job %v", job.ID)
+
+	reply.Success = true
+	reply.Index = index
+	return nil
+}
+
+// tunedJob returns the running job of args with the tunables of args set.
+func (j *Job) tunedJob(args *models.JobTuneRequest) (*models.Job, error) {
+	snap, err := j.srv.fsm.State().Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := snap.JobByID(memdb.NewWatchSet(), args.JobID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("job %v not found", args.JobID)
+	}
+	if existing.Status != models.JobStatusRunning {
+		return nil, fmt.Errorf("job %v is %v, only a running job is tuned", args.JobID, existing.Status)
+	}
+
+	job := existing.Copy()
+	for taskType, tunables := range args.Tunables {
+		t := job.LookupTask(taskType)
+		if t == nil {
+			return nil, fmt.Errorf("job %v has no task %v", args.JobID, taskType)
+		}
+		if err := t.CheckTunables(tunables); err != nil {
+			return nil, err
+		}
+		t.SetTunables(tunables)
+	}
+	return job, nil
+}
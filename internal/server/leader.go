@@ -17,6 +17,7 @@ import (
 	"github.com/hashicorp/serf/serf"
 
 	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/scheduler"
 )
 
 const (
@@ -126,7 +127,8 @@ func (s *Server) establishLeadership(stopCh chan struct{}) error {
 	// Enable the plan queue, since we are now the leader
 	s.planQueue.SetEnabled(true)
 
-	// Start the plan evaluator
+	// Start the plan evaluator, with the stats of the previous term forgotten
+	s.planStats.Reset()
 	go s.planApply()
 
 	// Enable the eval broker, since we are now the leader
@@ -214,8 +216,13 @@ func (s *Server) reapFailedEvaluations(stopCh chan struct{}) {
 			// Update the status to failed
 			newEval := eval.Copy()
 			newEval.Status = models.EvalStatusFailed
-			newEval.StatusDescription = fmt.Sprintf("evaluation reached delivery limit (%d)", s.config.EvalDeliveryLimit)
-			s.logger.Warnf("manager: eval %#v reached delivery limit, marking as failed", newEval)
+			if scheduler.IsRegistered(eval.Type) {
+				newEval.StatusDescription = fmt.Sprintf("evaluation reached delivery limit (%d)", s.config.EvalDeliveryLimit)
+				s.logger.Warnf("manager: eval %#v reached delivery limit, marking as failed", newEval)
+			} else {
+				newEval.StatusDescription = fmt.Sprintf("no scheduler for evaluations of type %q", eval.Type)
+				s.logger.Warnf("manager: eval %#v has no scheduler, marking as failed", newEval)
+			}
 
 			// Update via Raft
 			req := models.EvalUpdateRequest{
@@ -337,6 +344,14 @@ func (s *Server) reconcileMember(member serf.Member) error {
 		return nil
 	}
 
+	// An incompatible server would fail to apply the raft log. It is not
+	// removed if already a peer, leaving it to the operator.
+	if member.Status == serf.StatusAlive && !parts.compatible() {
+		s.logger.Warnf("manager: not adding server %v as raft peer: it speaks protocol versions %d to %d",
+			member.Name, parts.MinVersion, parts.Version)
+		return nil
+	}
+
 	var err error
 	switch member.Status {
 	case serf.StatusAlive:
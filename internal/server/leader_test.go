@@ -18,7 +18,6 @@ import (
 
 	"github.com/docker/leadership"
 	"github.com/hashicorp/raft"
-	raftboltdb "github.com/hashicorp/raft-boltdb"
 	"github.com/hashicorp/serf/serf"
 )
 
@@ -31,7 +30,7 @@ func TestServer_monitorLeadership(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -113,7 +112,7 @@ func TestServer_leaderLoop(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -199,7 +198,7 @@ func TestServer_establishLeadership(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -288,7 +287,7 @@ func TestServer_restoreEvals(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -373,7 +372,7 @@ func TestServer_reapFailedEvaluations(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -459,7 +458,7 @@ func TestServer_reapDupBlockedEvaluations(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -545,7 +544,7 @@ func TestServer_periodicUnblockFailedEvals(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -631,7 +630,7 @@ func TestServer_revokeLeadership(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -716,7 +715,7 @@ func TestServer_reconcile(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -801,7 +800,7 @@ func TestServer_reconcileMember(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -890,7 +889,7 @@ func TestServer_addRaftPeer(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -980,7 +979,7 @@ func TestServer_removeRaftPeer(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
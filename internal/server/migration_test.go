@@ -0,0 +1,40 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestNode_createNodeEvalsMigration(t *testing.T) {
+	srv, shutdown := testLeaderServer(t)
+	defer shutdown()
+	for i, jobType := range []string{models.JobTypeSync, models.JobTypeMigration} {
+		job := topologyTestJob(jobType, "a", "b")
+		job.Type = jobType
+		if err := srv.fsm.State().UpsertJob(uint64(i+1), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a node update re-evaluates the migration jobs as the synchronous ones
+	nodeID := models.GenerateUUID()
+	evalIDs, _, err := (&Node{srv: srv}).createNodeEvals(nodeID, 10)
+	if err != nil || len(evalIDs) != 2 {
+		t.Fatalf("createNodeEvals() = %v, %v", evalIDs, err)
+	}
+	evals, err := srv.fsm.State().EvalsByJob(nil, models.JobTypeMigration)
+	if err != nil || len(evals) != 1 {
+		t.Fatalf("evals of the migration job: %v, %v", evals, err)
+	}
+	if eval := evals[0]; eval.Type != models.JobTypeMigration || eval.TriggeredBy != models.EvalTriggerNodeUpdate ||
+		eval.NodeID != nodeID || eval.NodeModifyIndex != 10 {
+		t.Errorf("eval of the migration job = %+v", eval)
+	}
+}
@@ -26,6 +26,10 @@ const (
 	// maxParallelRequestsPerDerive  is the maximum number of parallel Vault
 	// create token requests that may be outstanding per derive request
 	maxParallelRequestsPerDerive = 16
+
+	// nodeUtilizationIntv is the minimum interval between the utilizations
+	// of a node committed from its heartbeats
+	nodeUtilizationIntv = 30 * time.Second
 )
 
 // Node endpoint is used for client interactions
@@ -68,6 +72,9 @@ func (n *Node) Register(args *models.NodeRegisterRequest, reply *models.NodeUpda
 	if args.Node.Name == "" {
 		return fmt.Errorf("missing node name for client registration")
 	}
+	if err := models.CheckNodeProtocol(args.Node); err != nil {
+		return err
+	}
 
 	// Default the status if none is given
 	if args.Node.Status == "" {
@@ -248,9 +255,10 @@ func (n *Node) UpdateStatus(args *models.NodeUpdateStatusRequest, reply *models.
 	// Update the timestamp of when the node status was updated
 	node.StatusUpdatedAt = time.Now().Unix()
 
-	// Commit this update via Raft
+	// Commit this update via Raft. The utilization alone is committed at
+	// most every nodeUtilizationIntv, not to write to Raft on every heartbeat.
 	var index uint64
-	if node.Status != args.Status {
+	if node.Status != args.Status || utilizationDue(node, args.Utilization) {
 		_, index, err = n.srv.raftApply(models.NodeUpdateStatusRequestType, args)
 		if err != nil {
 			n.srv.logger.Errorf("server.agent: status update failed: %v", err)
@@ -296,6 +304,18 @@ func (n *Node) UpdateStatus(args *models.NodeUpdateStatusRequest, reply *models.
 	return nil
 }
 
+// utilizationDue returns if the utilization reported by a heartbeat should be
+// committed for the node.
+func utilizationDue(node *models.Node, util *models.NodeUtilization) bool {
+	if util == nil {
+		return false
+	}
+	if node.Utilization == nil {
+		return true
+	}
+	return time.Duration(util.CollectedAt-node.Utilization.CollectedAt)*time.Second >= nodeUtilizationIntv
+}
+
 // transitionedToReady is a helper that takes a nodes new and old status and
 // returns whether it has transistioned to ready.
 func transitionedToReady(newStatus, oldStatus string) bool {
@@ -531,6 +551,28 @@ func (n *Node) UpdateJob(args *models.JobUpdateRequest, reply *models.GenericRes
 	return nil
 }
 
+// UpdateJobStats is used by the clients to send the samples of the lag and
+// the throughput of the jobs they run
+func (n *Node) UpdateJobStats(args *models.JobStatsUpdateRequest, reply *models.GenericResponse) error {
+	if done, err := n.srv.forward("Node.UpdateJobStats", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "client", "update_job_stats"}, time.Now())
+
+	if len(args.Updates) == 0 {
+		return fmt.Errorf("must update the stats of at least one job")
+	}
+
+	_, index, err := n.srv.raftApply(models.JobStatsUpdateRequestType, args)
+	if err != nil {
+		n.srv.logger.Errorf("server.job: job stats update failed: %v", err)
+		return err
+	}
+
+	reply.Index = index
+	return nil
+}
+
 // UpdateAlloc is used to update the client status of an allocation
 func (n *Node) UpdateAlloc(args *models.AllocUpdateRequest, reply *models.GenericResponse) error {
 	if done, err := n.srv.forward("Node.UpdateAlloc", args, args, reply); done {
@@ -592,12 +634,77 @@ func (n *Node) batchUpdate(future *batchFuture, updates []*models.Allocation) {
 	if err != nil {
 		n.srv.logger.Errorf("server.agent: alloc update failed: %v", err)
 		mErr.Errors = append(mErr.Errors, err)
+	} else if err := n.createTaskGroupEvals(updates, index); err != nil {
+		// the updates are applied, the groups are started by the next
+		// evaluation of their jobs
+		n.srv.logger.Errorf("server.agent: failed to schedule the next task groups: %v", err)
 	}
 
 	// Respond to the future
 	future.Respond(index, mErr.ErrorOrNil())
 }
 
+// createTaskGroupEvals creates an evaluation for each job whose next task
+// group was started by the allocation updates applied at the index.
+func (n *Node) createTaskGroupEvals(updates []*models.Allocation, index uint64) error {
+	snap, err := n.srv.fsm.State().Snapshot()
+	if err != nil {
+		return err
+	}
+	ws := memdb.NewWatchSet()
+
+	var evals []*models.Evaluation
+	jobIDs := make(map[string]struct{})
+	for _, update := range updates {
+		if update.ClientStatus != models.AllocClientStatusComplete {
+			continue
+		}
+		alloc, err := snap.AllocByID(ws, update.ID)
+		if err != nil {
+			return err
+		}
+		if alloc == nil {
+			continue
+		}
+		if _, ok := jobIDs[alloc.JobID]; ok {
+			continue
+		}
+		jobIDs[alloc.JobID] = struct{}{}
+
+		job, err := snap.JobByID(ws, alloc.JobID)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			continue
+		}
+		group := job.RunningTaskGroup()
+		if group == nil || group.ModifyIndex != index {
+			continue
+		}
+		n.srv.logger.Printf("server.agent: starting task group %q of job %v", group.Name, job.ID)
+		evals = append(evals, &models.Evaluation{
+			ID:             models.GenerateUUID(),
+			Type:           job.Type,
+			TriggeredBy:    models.EvalTriggerTaskGroup,
+			JobID:          job.ID,
+			Namespace:      job.Namespace,
+			JobModifyIndex: job.JobModifyIndex,
+			Status:         models.EvalStatusPending,
+		})
+	}
+	if len(evals) == 0 {
+		return nil
+	}
+
+	update := &models.EvalUpdateRequest{
+		Evals:        evals,
+		WriteRequest: models.WriteRequest{Region: n.srv.config.Region},
+	}
+	_, _, err = n.srv.raftApply(models.EvalUpdateRequestType, update)
+	return err
+}
+
 // List is used to list the available nodes
 func (n *Node) List(args *models.NodeListRequest,
 	reply *models.NodeListResponse) error {
@@ -664,14 +771,15 @@ func (n *Node) createNodeEvals(nodeID string, nodeIndex uint64) ([]string, uint6
 		return nil, 0, fmt.Errorf("failed to find allocs for '%s': %v", nodeID, err)
 	}
 
-	sysJobsIter, err := snap.JobsByScheduler(ws, "synchronous")
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to find synchronous jobs for '%s': %v", nodeID, err)
-	}
-
 	var sysJobs []*models.Job
-	for job := sysJobsIter.Next(); job != nil; job = sysJobsIter.Next() {
-		sysJobs = append(sysJobs, job.(*models.Job))
+	for _, jobType := range []string{models.JobTypeSync, models.JobTypeMigration} {
+		sysJobsIter, err := snap.JobsByScheduler(ws, jobType)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to find %s jobs for '%s': %v", jobType, nodeID, err)
+		}
+		for job := sysJobsIter.Next(); job != nil; job = sysJobsIter.Next() {
+			sysJobs = append(sysJobs, job.(*models.Job))
+		}
 	}
 
 	// Fast-path if nothing to do
@@ -697,6 +805,7 @@ func (n *Node) createNodeEvals(nodeID string, nodeIndex uint64) ([]string, uint6
 			Type:            alloc.Job.Type,
 			TriggeredBy:     models.EvalTriggerNodeUpdate,
 			JobID:           alloc.JobID,
+			Namespace:       alloc.Job.Namespace,
 			NodeID:          nodeID,
 			NodeModifyIndex: nodeIndex,
 			Status:          models.EvalStatusPending,
@@ -719,6 +828,7 @@ func (n *Node) createNodeEvals(nodeID string, nodeIndex uint64) ([]string, uint6
 			Type:            job.Type,
 			TriggeredBy:     models.EvalTriggerNodeUpdate,
 			JobID:           job.ID,
+			Namespace:       job.Namespace,
 			NodeID:          nodeID,
 			NodeModifyIndex: nodeIndex,
 			Status:          models.EvalStatusPending,
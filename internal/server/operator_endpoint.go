@@ -9,7 +9,9 @@ package server
 import (
 	"fmt"
 	"net"
+	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
 
@@ -160,3 +162,148 @@ REMOVE:
 	op.srv.logger.Printf("[WARN] udup.operator: Removed Raft peer with id %q", args.ID)
 	return nil
 }
+
+// RaftCompact copies the raft store of this server into a new file without
+// its free pages. It is not forwarded: each server compacts its own store,
+// whose raft reads and writes wait only for the swap of the files.
+func (op *Operator) RaftCompact(args *models.GenericRequest, reply *models.RaftCompactResponse) error {
+	if op.srv.raftStore == nil {
+		return fmt.Errorf("the raft store of this server is in memory")
+	}
+	start := time.Now()
+	defer metrics.MeasureSince([]string{"server", "raft", "db", "compact"}, start)
+
+	op.srv.logger.Printf("udup.operator: compacting the raft store")
+	before, after, err := op.srv.raftStore.Compact()
+	if err != nil {
+		op.srv.logger.Errorf("udup.operator: %v", err)
+		return err
+	}
+	reply.Before = before
+	reply.After = after
+	reply.Duration = time.Since(start)
+	op.srv.logger.Printf("udup.operator: compacted the raft store from %d to %d bytes in %v",
+		before.SizeBytes, after.SizeBytes, reply.Duration)
+	return nil
+}
+
+// PlanStats returns the outcome of the plans applied by the leader, and why
+// their nodes were rejected.
+func (op *Operator) PlanStats(args *models.GenericRequest, reply *models.PlanStatsResponse) error {
+	if done, err := op.srv.forward("Operator.PlanStats", args, args, reply); done {
+		return err
+	}
+
+	reply.Stats = op.srv.planStats.Stats()
+	op.srv.setQueryMeta(&reply.QueryMeta)
+	return nil
+}
+
+// StateExport is used to dump the jobs, orders, evaluations, allocations,
+// nodes and quotas of the cluster, to be imported into a cluster of another
+// version.
+func (op *Operator) StateExport(args *models.GenericRequest, reply *models.StateExportResponse) error {
+	if done, err := op.srv.forward("Operator.StateExport", args, args, reply); done {
+		return err
+	}
+
+	snap, err := op.srv.fsm.State().Snapshot()
+	if err != nil {
+		return err
+	}
+	index, err := snap.LatestIndex()
+	if err != nil {
+		return err
+	}
+	state := &models.StateExport{
+		Build: op.srv.config.Build,
+		Index: index,
+	}
+
+	iter, err := snap.Nodes(nil)
+	if err != nil {
+		return err
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		state.Nodes = append(state.Nodes, raw.(*models.Node))
+	}
+	if iter, err = snap.Jobs(nil); err != nil {
+		return err
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		state.Jobs = append(state.Jobs, raw.(*models.Job))
+	}
+	if iter, err = snap.Orders(nil); err != nil {
+		return err
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		state.Orders = append(state.Orders, raw.(*models.Order))
+	}
+	if iter, err = snap.Evals(nil); err != nil {
+		return err
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		state.Evals = append(state.Evals, raw.(*models.Evaluation))
+	}
+	if iter, err = snap.Allocs(nil); err != nil {
+		return err
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		state.Allocs = append(state.Allocs, raw.(*models.Allocation))
+	}
+	if iter, err = snap.Quotas(nil); err != nil {
+		return err
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		state.Quotas = append(state.Quotas, raw.(*models.QuotaSpec))
+	}
+
+	reply.State = state
+	reply.Index = index
+	op.srv.setQueryMeta(&reply.QueryMeta)
+	return nil
+}
+
+// StateImport is used to load the state exported from another cluster. The
+// cluster is expected to be new: it is refused if there are jobs, unless
+// forced.
+func (op *Operator) StateImport(args *models.StateImportRequest, reply *models.StateImportResponse) error {
+	if done, err := op.srv.forward("Operator.StateImport", args, args, reply); done {
+		return err
+	}
+	if args.State == nil {
+		return fmt.Errorf("missing state to import")
+	}
+	if !op.srv.serversSupport(models.FeatureStateImport) {
+		return fmt.Errorf("not every server supports %v, upgrade them first", models.FeatureStateImport)
+	}
+
+	if !args.Force {
+		iter, err := op.srv.fsm.State().Jobs(nil)
+		if err != nil {
+			return err
+		}
+		if iter.Next() != nil {
+			return fmt.Errorf("the cluster has jobs, the state is only imported into a new cluster")
+		}
+	}
+
+	resp, index, err := op.srv.raftApply(models.StateImportRequestType, args)
+	if respErr, ok := resp.(error); ok && err == nil {
+		err = respErr
+	}
+	if err != nil {
+		op.srv.logger.Errorf("udup.operator: State import failed: %v", err)
+		return err
+	}
+	op.srv.logger.Infof("udup.operator: Imported the state of %q (index %d)", args.State.Build, args.State.Index)
+
+	reply.Nodes = len(args.State.Nodes)
+	reply.Jobs = len(args.State.Jobs)
+	reply.Orders = len(args.State.Orders)
+	reply.Evals = len(args.State.Evals)
+	reply.Allocs = len(args.State.Allocs)
+	reply.Quotas = len(args.State.Quotas)
+	reply.Index = index
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// validateTableOwnership rejects a job writing target tables which another
+// active job writes, unless it allows so. The tables are compared by the
+// names in ReplicateDoDb and ReplicateIgnoreDb; the applier checks the
+// tables actually written.
+func (j *Job) validateTableOwnership(job *models.Job) error {
+	for _, t := range job.Tasks {
+		if cfg, ok := taskMySQLConfig(t); ok && cfg.AllowsOverlappingJobs() {
+			return nil
+		}
+	}
+
+	jobs, err := j.listJobs()
+	if err != nil {
+		return err
+	}
+	if other, tables := findOverlappingJob(job, jobs); other != nil {
+		return fmt.Errorf("job %v writes the tables %v of its target which job %v writes too. set AllowOverlappingJobs to accept it",
+			job.ID, strings.Join(tables, ", "), other.ID)
+	}
+	return nil
+}
+
+// findOverlappingJob returns the first active job writing tables of the
+// target of job, and these tables. The previous version of job is not
+// taken into account.
+func findOverlappingJob(job *models.Job, jobs []*models.Job) (*models.Job, []string) {
+	_, dst, ok := jobEndpoints(job)
+	if !ok {
+		return nil, nil
+	}
+	filter, ok := jobTableFilter(job)
+	if !ok {
+		return nil, nil
+	}
+
+	for _, other := range jobs {
+		if other.ID == job.ID || other.Status == models.JobStatusDead || other.Status == models.JobStatusComplete {
+			continue
+		}
+		if _, otherDst, ok := jobEndpoints(other); !ok || otherDst != dst {
+			continue
+		}
+		otherFilter, ok := jobTableFilter(other)
+		if !ok {
+			continue
+		}
+		if tables := filter.Overlap(otherFilter); len(tables) > 0 {
+			return other, tables
+		}
+	}
+	return nil, nil
+}
+
+// jobTableFilter returns the table filter of the Src task of a job
+func jobTableFilter(job *models.Job) (*config.TableFilter, bool) {
+	t := job.LookupTask(models.TaskTypeSrc)
+	if t == nil {
+		return nil, false
+	}
+	cfg, ok := taskMySQLConfig(t)
+	if !ok {
+		return nil, false
+	}
+	filter, err := config.NewTableFilter(cfg.ReplicateDoDb, cfg.ReplicateIgnoreDb)
+	if err != nil {
+		return nil, false
+	}
+	return filter, true
+}
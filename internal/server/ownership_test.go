@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func ownershipTestJob(id, dst string, doDb ...interface{}) *models.Job {
+	job := topologyTestJob(id, "src-"+id, dst)
+	job.Tasks[0].Config["ReplicateDoDb"] = doDb
+	return job
+}
+
+func TestFindOverlappingJob(t *testing.T) {
+	db1 := map[string]interface{}{"TableSchema": "db1"}
+	db1tb1 := map[string]interface{}{"TableSchema": "db1",
+		"Tables": []interface{}{map[string]interface{}{"TableName": "tb1"}}}
+	db2 := map[string]interface{}{"TableSchema": "db2"}
+	jobs := []*models.Job{
+		ownershipTestJob("j1", "b", db1),
+		ownershipTestJob("j2", "c", db2),
+	}
+
+	other, tables := findOverlappingJob(ownershipTestJob("j3", "b", db1tb1), jobs)
+	test.S(t).ExpectTrue(other == jobs[0])
+	test.S(t).ExpectEquals(len(tables), 1)
+	test.S(t).ExpectEquals(tables[0], "db1.tb1")
+
+	// the same tables of another target
+	other, _ = findOverlappingJob(ownershipTestJob("j3", "c", db1tb1), jobs)
+	test.S(t).ExpectTrue(other == nil)
+
+	// an updated job does not overlap with its previous version
+	other, _ = findOverlappingJob(ownershipTestJob("j1", "b", db1tb1), jobs)
+	test.S(t).ExpectTrue(other == nil)
+
+	// stopped jobs are ignored
+	jobs[0].Status = models.JobStatusDead
+	other, _ = findOverlappingJob(ownershipTestJob("j3", "b", db1tb1), jobs)
+	test.S(t).ExpectTrue(other == nil)
+}
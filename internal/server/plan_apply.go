@@ -61,12 +61,18 @@ func (s *Server) planApply() {
 		}
 
 		// Evaluate the plan
+		s.planStats.Submitted()
 		result, err := evaluatePlan(pool, snap, pending.plan)
 		if err != nil {
 			s.logger.Errorf("manager: failed to evaluate plan: %v", err)
+			s.planStats.Failed()
 			pending.respond(nil, err)
 			continue
 		}
+		s.planStats.Evaluated(pending.plan, result)
+		for _, r := range result.Rejections {
+			s.logger.Debugf("manager: plan of eval %v rejected on node %v: %v: %v", r.EvalID, r.NodeID, r.Reason, r.Detail)
+		}
 
 		// Fast-path the response if there is nothing to do
 		if result.IsNoOp() {
@@ -90,6 +96,7 @@ func (s *Server) planApply() {
 		future, err := s.applyPlan(pending.plan.Job, result, snap)
 		if err != nil {
 			s.logger.Errorf("manager: failed to submit plan: %v", err)
+			s.planStats.Failed()
 			pending.respond(nil, err)
 			continue
 		}
@@ -153,9 +160,11 @@ func (s *Server) asyncPlanWait(waitCh chan struct{}, future raft.ApplyFuture,
 	// Wait for the plan to apply
 	if err := future.Error(); err != nil {
 		s.logger.Errorf("manager: failed to apply plan: %v", err)
+		s.planStats.Failed()
 		pending.respond(nil, err)
 		return
 	}
+	s.planStats.Applied()
 
 	// Respond to the plan
 	result.AllocIndex = future.Index()
@@ -204,15 +213,16 @@ func evaluatePlan(pool *EvaluatePool, snap *store.StateSnapshot, plan *models.Pl
 	partialCommit := false
 
 	// handleResult is used to process the result of evaluateNodePlan
-	handleResult := func(nodeID string, fit bool, err error) (cancel bool) {
+	handleResult := func(nodeID string, rejection *models.PlanRejection, err error) (cancel bool) {
 		// Evaluate the plan for this node
 		if err != nil {
 			mErr.Errors = append(mErr.Errors, err)
 			return true
 		}
-		if !fit {
+		if rejection != nil {
 			// Set that this is a partial commit
 			partialCommit = true
+			result.Rejections = append(result.Rejections, rejection)
 
 			// Skip this node, since it cannot be used.
 			return
@@ -247,7 +257,7 @@ func evaluatePlan(pool *EvaluatePool, snap *store.StateSnapshot, plan *models.Pl
 
 			// Handle a result that allows us to cancel evaluation,
 			// which may save time processing additional entries.
-			if cancel := handleResult(r.nodeID, r.fit, r.err); cancel {
+			if cancel := handleResult(r.nodeID, r.rejection, r.err); cancel {
 				didCancel = true
 				break
 			}
@@ -258,7 +268,7 @@ func evaluatePlan(pool *EvaluatePool, snap *store.StateSnapshot, plan *models.Pl
 	for outstanding > 0 {
 		r := <-resp
 		if !didCancel {
-			if cancel := handleResult(r.nodeID, r.fit, r.err); cancel {
+			if cancel := handleResult(r.nodeID, r.rejection, r.err); cancel {
 				didCancel = true
 			}
 		}
@@ -288,47 +298,58 @@ func evaluatePlan(pool *EvaluatePool, snap *store.StateSnapshot, plan *models.Pl
 }
 
 // evaluateNodePlan is used to evalute the plan for a single node,
-// returning if the plan is valid or if an error is encountered
-func evaluateNodePlan(snap *store.StateSnapshot, plan *models.Plan, nodeID string) (bool, error) {
+// returning why the plan is not valid, nil if it is, or if an error is
+// encountered
+func evaluateNodePlan(snap *store.StateSnapshot, plan *models.Plan, nodeID string) (*models.PlanRejection, error) {
 	// If this is an evict-only plan, it always 'fits' since we are removing things.
 	if len(plan.NodeAllocation[nodeID]) == 0 {
-		return true, nil
+		return nil, nil
 	}
 
 	// Get the node itself
 	ws := memdb.NewWatchSet()
 	node, err := snap.NodeByID(ws, nodeID)
 	if err != nil {
-		return false, fmt.Errorf("failed to get node '%s': %v", nodeID, err)
+		return nil, fmt.Errorf("failed to get node '%s': %v", nodeID, err)
 	}
 
 	// If the node does not exist or is not ready for schduling it is not fit
 	// XXX: There is a potential race between when we do this check and when
 	// the Raft commit happens.
-	if node == nil || node.Status != models.NodeStatusReady {
-		return false, nil
+	if node == nil {
+		return newPlanRejection(plan, nodeID, models.PlanRejectNodeMissing, "node is not registered"), nil
 	}
-
-	// Get the existing allocations that are non-terminal
-	existingAlloc, err := snap.AllocsByNodeTerminal(ws, nodeID, false)
-	if err != nil {
-		return false, fmt.Errorf("failed to get existing allocations for '%s': %v", nodeID, err)
+	if node.Status != models.NodeStatusReady {
+		return newPlanRejection(plan, nodeID, models.PlanRejectNodeNotReady,
+			fmt.Sprintf("node status is %q", node.Status)), nil
 	}
 
-	// Determine the proposed allocation by first removing allocations
-	// that are planned evictions and adding the new allocations.
-	proposed := existingAlloc
-	var remove []*models.Allocation
-	if update := plan.NodeUpdate[nodeID]; len(update) > 0 {
-		remove = append(remove, update...)
-	}
-	if updated := plan.NodeAllocation[nodeID]; len(updated) > 0 {
-		for _, alloc := range updated {
-			remove = append(remove, alloc)
+	// An allocation is placed on a single node. The plan is stale if one of
+	// its allocations was committed on another node meanwhile.
+	for _, alloc := range plan.NodeAllocation[nodeID] {
+		existing, err := snap.AllocByID(ws, alloc.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get allocation '%s': %v", alloc.ID, err)
+		}
+		if existing != nil && existing.NodeID != nodeID && !existing.TerminalStatus() {
+			return newPlanRejection(plan, nodeID, models.PlanRejectAllocConflict,
+				fmt.Sprintf("allocation %s is on node %s", alloc.ID, existing.NodeID)), nil
 		}
 	}
-	proposed = models.RemoveAllocs(existingAlloc, remove)
-	proposed = append(proposed, plan.NodeAllocation[nodeID]...)
 
-	return true, err
+	return nil, nil
+}
+
+func newPlanRejection(plan *models.Plan, nodeID, reason, detail string) *models.PlanRejection {
+	r := &models.PlanRejection{
+		Time:   time.Now().UTC(),
+		EvalID: plan.EvalID,
+		NodeID: nodeID,
+		Reason: reason,
+		Detail: detail,
+	}
+	if plan.Job != nil {
+		r.JobID = plan.Job.ID
+	}
+	return r
 }
@@ -35,9 +35,9 @@ type evaluateRequest struct {
 }
 
 type evaluateResult struct {
-	nodeID string
-	fit    bool
-	err    error
+	nodeID    string
+	rejection *models.PlanRejection
+	err       error
 }
 
 // NewEvaluatePool returns a pool of the given size.
@@ -108,8 +108,8 @@ func (p *EvaluatePool) run(stopCh chan struct{}) {
 	for {
 		select {
 		case req := <-p.req:
-			fit, err := evaluateNodePlan(req.snap, req.plan, req.nodeID)
-			p.res <- evaluateResult{req.nodeID, fit, err}
+			rejection, err := evaluateNodePlan(req.snap, req.plan, req.nodeID)
+			p.res <- evaluateResult{req.nodeID, rejection, err}
 
 		case <-stopCh:
 			return
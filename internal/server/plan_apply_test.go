@@ -20,7 +20,6 @@ import (
 
 	"github.com/docker/leadership"
 	"github.com/hashicorp/raft"
-	raftboltdb "github.com/hashicorp/raft-boltdb"
 	"github.com/hashicorp/serf/serf"
 )
 
@@ -33,7 +32,7 @@ func TestServer_planApply(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -115,7 +114,7 @@ func TestServer_applyPlan(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -212,7 +211,7 @@ func TestServer_asyncPlanWait(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -329,7 +328,7 @@ func Test_evaluateNodePlan(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    bool
+		want    string
 		wantErr bool
 	}{
 		// TODO: Add test cases.
@@ -341,8 +340,12 @@ func Test_evaluateNodePlan(t *testing.T) {
 				t.Errorf("evaluateNodePlan() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
-				t.Errorf("evaluateNodePlan() = %v, want %v", got, tt.want)
+			reason := ""
+			if got != nil {
+				reason = got.Reason
+			}
+			if reason != tt.want {
+				t.Errorf("evaluateNodePlan() = %v, want %v", reason, tt.want)
 			}
 		})
 	}
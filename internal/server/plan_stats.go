@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/armon/go-metrics"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// planStatsRejections is the number of recent node rejections kept
+	planStatsRejections = 100
+
+	// planStatsEvals is the number of evaluations with partial plans kept
+	planStatsEvals = 100
+)
+
+// planStats records the outcome of the plans applied by the leader. Without
+// it, an evaluation whose plans keep being rejected looks like an idle one.
+type planStats struct {
+	l sync.Mutex
+
+	stats      models.PlanStats
+	rejections []*models.PlanRejection
+	evals      map[string]*models.PlanEvalStats
+}
+
+func newPlanStats() *planStats {
+	return &planStats{
+		stats: models.PlanStats{RejectedNodes: make(map[string]uint64)},
+		evals: make(map[string]*models.PlanEvalStats),
+	}
+}
+
+// Reset forgets the stats, when the server gains leadership.
+func (p *planStats) Reset() {
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.stats = models.PlanStats{RejectedNodes: make(map[string]uint64)}
+	p.rejections = nil
+	p.evals = make(map[string]*models.PlanEvalStats)
+}
+
+func (p *planStats) Submitted() {
+	metrics.IncrCounter([]string{"server", "plan", "submitted"}, 1)
+	p.l.Lock()
+	p.stats.Submitted++
+	p.l.Unlock()
+}
+
+func (p *planStats) Failed() {
+	metrics.IncrCounter([]string{"server", "plan", "failed"}, 1)
+	p.l.Lock()
+	p.stats.Failed++
+	p.l.Unlock()
+}
+
+func (p *planStats) Applied() {
+	metrics.IncrCounter([]string{"server", "plan", "applied"}, 1)
+	p.l.Lock()
+	p.stats.Applied++
+	p.l.Unlock()
+}
+
+// Evaluated records the result of a plan, before it is applied.
+func (p *planStats) Evaluated(plan *models.Plan, result *models.PlanResult) {
+	if result.IsNoOp() {
+		metrics.IncrCounter([]string{"server", "plan", "noop"}, 1)
+	}
+	if len(result.Rejections) > 0 {
+		metrics.IncrCounter([]string{"server", "plan", "partial"}, 1)
+	}
+	for _, r := range result.Rejections {
+		metrics.IncrCounter([]string{"server", "plan", "rejected_nodes", r.Reason}, 1)
+	}
+
+	p.l.Lock()
+	defer p.l.Unlock()
+	if result.IsNoOp() {
+		p.stats.NoOp++
+	}
+	if len(result.Rejections) == 0 {
+		return
+	}
+	p.stats.Partial++
+
+	for _, r := range result.Rejections {
+		p.stats.RejectedNodes[r.Reason]++
+		p.rejections = append(p.rejections, r)
+	}
+	if n := len(p.rejections) - planStatsRejections; n > 0 {
+		p.rejections = append([]*models.PlanRejection(nil), p.rejections[n:]...)
+	}
+
+	last := result.Rejections[len(result.Rejections)-1]
+	e, ok := p.evals[plan.EvalID]
+	if !ok {
+		if len(p.evals) >= planStatsEvals {
+			p.evictEval()
+		}
+		e = &models.PlanEvalStats{EvalID: plan.EvalID, JobID: last.JobID}
+		p.evals[plan.EvalID] = e
+	}
+	e.PartialPlans++
+	e.LastReason = last.Reason
+	e.LastDetail = last.Detail
+	e.LastTime = last.Time
+}
+
+// evictEval forgets the evaluation rejected the longest ago.
+func (p *planStats) evictEval() {
+	var oldest *models.PlanEvalStats
+	for _, e := range p.evals {
+		if oldest == nil || e.LastTime.Before(oldest.LastTime) {
+			oldest = e
+		}
+	}
+	if oldest != nil {
+		delete(p.evals, oldest.EvalID)
+	}
+}
+
+// Stats returns a copy of the stats.
+func (p *planStats) Stats() *models.PlanStats {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	stats := p.stats
+	stats.RejectedNodes = make(map[string]uint64, len(p.stats.RejectedNodes))
+	for reason, n := range p.stats.RejectedNodes {
+		stats.RejectedNodes[reason] = n
+	}
+	stats.Rejections = make([]*models.PlanRejection, 0, len(p.rejections))
+	for i := len(p.rejections) - 1; i >= 0; i-- {
+		r := *p.rejections[i]
+		stats.Rejections = append(stats.Rejections, &r)
+	}
+	stats.Evals = make([]*models.PlanEvalStats, 0, len(p.evals))
+	for _, e := range p.evals {
+		c := *e
+		stats.Evals = append(stats.Evals, &c)
+	}
+	sort.Slice(stats.Evals, func(i, j int) bool {
+		return stats.Evals[i].LastTime.After(stats.Evals[j].LastTime)
+	})
+	return &stats
+}
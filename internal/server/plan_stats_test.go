@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+func TestEvaluatePlan_Rejections(t *testing.T) {
+	state, err := store.NewStateStore(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := &models.Node{ID: models.GenerateUUID(), Name: "ready", Status: models.NodeStatusReady}
+	down := &models.Node{ID: models.GenerateUUID(), Name: "down", Status: models.NodeStatusDown}
+	for i, node := range []*models.Node{ready, down} {
+		if err := state.UpsertNode(uint64(10+i), node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	placed := &models.Allocation{ID: models.GenerateUUID(), JobID: "job1", EvalID: models.GenerateUUID(),
+		NodeID: ready.ID, Task: models.TaskTypeSrc, DesiredStatus: models.AllocDesiredStatusRun}
+	if err := state.UpsertAllocs(20, []*models.Allocation{placed}); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := state.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missingID := models.GenerateUUID()
+	alloc := func(nodeID string) *models.Allocation {
+		return &models.Allocation{ID: models.GenerateUUID(), JobID: "job1", NodeID: nodeID, Task: models.TaskTypeSrc}
+	}
+	conflict := placed.Copy()
+	conflict.NodeID = down.ID
+	plan := &models.Plan{
+		EvalID: models.GenerateUUID(),
+		Job:    &models.Job{ID: "job1"},
+		NodeAllocation: map[string][]*models.Allocation{
+			ready.ID:  {alloc(ready.ID)},
+			down.ID:   {alloc(down.ID)},
+			missingID: {alloc(missingID)},
+		},
+	}
+
+	pool := NewEvaluatePool(2, workerPoolBufferSize)
+	defer pool.Shutdown()
+	result, err := evaluatePlan(pool, snap, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.NodeAllocation) != 1 || result.NodeAllocation[ready.ID] == nil {
+		t.Errorf("committed nodes = %v", result.NodeAllocation)
+	}
+	if result.RefreshIndex != 20 {
+		t.Errorf("refresh index = %d, want 20", result.RefreshIndex)
+	}
+	reasons := make(map[string]string)
+	for _, r := range result.Rejections {
+		if r.EvalID != plan.EvalID || r.JobID != "job1" {
+			t.Errorf("rejection = %+v", r)
+		}
+		reasons[r.NodeID] = r.Reason
+	}
+	if len(reasons) != 2 || reasons[down.ID] != models.PlanRejectNodeNotReady || reasons[missingID] != models.PlanRejectNodeMissing {
+		t.Errorf("reasons = %v", reasons)
+	}
+
+	// the allocation was placed on another node meanwhile
+	r, err := evaluateNodePlan(snap, &models.Plan{
+		EvalID:         plan.EvalID,
+		NodeAllocation: map[string][]*models.Allocation{ready.ID: {alloc(ready.ID), conflict}},
+	}, ready.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != nil {
+		t.Errorf("an allocation on the same node is not a conflict: %+v", r)
+	}
+	conflict.NodeID = ready.ID
+	ready2 := &models.Node{ID: models.GenerateUUID(), Name: "ready2", Status: models.NodeStatusReady}
+	if err := state.UpsertNode(30, ready2); err != nil {
+		t.Fatal(err)
+	}
+	if snap, err = state.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	r, err = evaluateNodePlan(snap, &models.Plan{
+		NodeAllocation: map[string][]*models.Allocation{ready2.ID: {conflict}},
+	}, ready2.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil || r.Reason != models.PlanRejectAllocConflict {
+		t.Errorf("rejection = %+v, want %v", r, models.PlanRejectAllocConflict)
+	}
+}
+
+func TestPlanStats(t *testing.T) {
+	p := newPlanStats()
+	evalID := models.GenerateUUID()
+	plan := &models.Plan{EvalID: evalID, Job: &models.Job{ID: "job1"}}
+	for i := 0; i < 3; i++ {
+		p.Submitted()
+		p.Evaluated(plan, &models.PlanResult{
+			NodeAllocation: map[string][]*models.Allocation{"n1": {{ID: "a"}}},
+			Rejections: []*models.PlanRejection{
+				newPlanRejection(plan, "n2", models.PlanRejectNodeNotReady, `node status is "down"`),
+			},
+		})
+		p.Applied()
+	}
+	p.Submitted()
+	p.Evaluated(&models.Plan{EvalID: models.GenerateUUID()}, &models.PlanResult{})
+
+	stats := p.Stats()
+	if stats.Submitted != 4 || stats.Applied != 3 || stats.Partial != 3 || stats.NoOp != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if stats.RejectedNodes[models.PlanRejectNodeNotReady] != 3 || len(stats.Rejections) != 3 {
+		t.Errorf("rejected = %v %v", stats.RejectedNodes, stats.Rejections)
+	}
+	if len(stats.Evals) != 1 || stats.Evals[0].EvalID != evalID || stats.Evals[0].PartialPlans != 3 ||
+		stats.Evals[0].JobID != "job1" {
+		t.Errorf("evals = %+v", stats.Evals)
+	}
+
+	// the rejections and evaluations are bounded
+	for i := 0; i < planStatsEvals+10; i++ {
+		plan := &models.Plan{EvalID: models.GenerateUUID()}
+		p.Evaluated(plan, &models.PlanResult{Rejections: []*models.PlanRejection{
+			newPlanRejection(plan, "n3", models.PlanRejectNodeMissing, ""),
+		}})
+	}
+	stats = p.Stats()
+	if len(stats.Rejections) != planStatsRejections || len(stats.Evals) != planStatsEvals {
+		t.Errorf("kept %d rejections and %d evals", len(stats.Rejections), len(stats.Evals))
+	}
+	if stats.Rejections[0].Reason != models.PlanRejectNodeMissing {
+		t.Errorf("the newest rejection is not first: %+v", stats.Rejections[0])
+	}
+
+	p.Reset()
+	if stats = p.Stats(); stats.Submitted != 0 || len(stats.Evals) != 0 {
+		t.Errorf("stats after reset = %+v", stats)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/hashicorp/serf/serf"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestServerProtocol(t *testing.T) {
+	member := func(tags map[string]string) serf.Member {
+		tags["role"] = "server"
+		tags["region"] = "global"
+		tags["port"] = "8191"
+		return serf.Member{Name: "s1.global", Addr: net.ParseIP("127.0.0.1"), Tags: tags}
+	}
+
+	// a server of a version before the negotiation
+	valid, parts := isUdupServer(member(map[string]string{}))
+	if !valid || parts.MinVersion != 1 || parts.Version != 1 || !parts.compatible() {
+		t.Errorf("old server: %v %+v", valid, parts)
+	}
+	if parts.Features[models.FeatureStateImport] {
+		t.Errorf("old server has feature %v", models.FeatureStateImport)
+	}
+
+	valid, parts = isUdupServer(member(map[string]string{
+		"vsn_min":  "1",
+		"vsn":      "1",
+		"features": "state-import,other",
+	}))
+	if !valid || !parts.compatible() || !parts.Features[models.FeatureStateImport] || !parts.Features["other"] {
+		t.Errorf("server: %v %+v", valid, parts)
+	}
+
+	valid, parts = isUdupServer(member(map[string]string{"vsn_min": "1000", "vsn": "1001"}))
+	if !valid || parts.compatible() {
+		t.Errorf("newer server: %v %+v", valid, parts)
+	}
+
+	if valid, _ = isUdupServer(member(map[string]string{"vsn": "x"})); valid {
+		t.Errorf("bad version is valid")
+	}
+}
+
+func TestCheckNodeProtocol(t *testing.T) {
+	node := &models.Node{Name: "n1", Attributes: map[string]string{}}
+	if err := models.CheckNodeProtocol(node); err != nil {
+		t.Errorf("old node: %v", err)
+	}
+	models.SetNodeProtocol(node)
+	if err := models.CheckNodeProtocol(node); err != nil {
+		t.Errorf("node: %v", err)
+	}
+	node.Attributes[models.NodeAttrProtocolMin] = "1000"
+	node.Attributes[models.NodeAttrProtocol] = "1000"
+	if err := models.CheckNodeProtocol(node); err == nil {
+		t.Errorf("newer node is compatible")
+	}
+}
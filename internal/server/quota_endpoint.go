@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	memdb "github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+// Quota endpoint is used to manage the quotas of the namespaces
+type Quota struct {
+	srv *Server
+}
+
+// Upsert is used to create or update the quota of a namespace
+func (q *Quota) Upsert(args *models.QuotaUpsertRequest, reply *models.GenericResponse) error {
+	if done, err := q.srv.forward("Quota.Upsert", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "quota", "upsert"}, time.Now())
+
+	if args.Quota == nil {
+		return fmt.Errorf("missing quota for upsert")
+	}
+	if err := args.Quota.Validate(); err != nil {
+		return err
+	}
+	if !q.srv.serversSupport(models.FeatureQuotas) {
+		return fmt.Errorf("not every server supports %v, upgrade them first", models.FeatureQuotas)
+	}
+
+	_, index, err := q.srv.raftApply(models.QuotaUpsertRequestType, args)
+	if err != nil {
+		q.srv.logger.Errorf("server.quota: Upsert failed: %v", err)
+		return err
+	}
+	reply.Index = index
+	return nil
+}
+
+// Delete is used to remove the quota of a namespace, which is then unlimited
+func (q *Quota) Delete(args *models.QuotaDeleteRequest, reply *models.GenericResponse) error {
+	if done, err := q.srv.forward("Quota.Delete", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "quota", "delete"}, time.Now())
+
+	if args.Namespace == "" {
+		return fmt.Errorf("missing namespace for quota delete")
+	}
+
+	resp, index, err := q.srv.raftApply(models.QuotaDeleteRequestType, args)
+	if respErr, ok := resp.(error); ok && err == nil {
+		err = respErr
+	}
+	if err != nil {
+		q.srv.logger.Errorf("server.quota: Delete failed: %v", err)
+		return err
+	}
+	reply.Index = index
+	return nil
+}
+
+// GetQuota is used to get the quota of a namespace and its usage
+func (q *Quota) GetQuota(args *models.QuotaSpecificRequest, reply *models.SingleQuotaResponse) error {
+	if done, err := q.srv.forward("Quota.GetQuota", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "quota", "get_quota"}, time.Now())
+
+	opts := blockingOptions{
+		queryOpts: &args.QueryOptions,
+		queryMeta: &reply.QueryMeta,
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			quota, err := state.QuotaByNamespace(ws, args.Namespace)
+			if err != nil {
+				return err
+			}
+			reply.Usage = nil
+			if quota != nil {
+				if reply.Usage, err = quotaUsage(ws, state, quota); err != nil {
+					return err
+				}
+			}
+
+			index, err := state.Index("quotas")
+			if err != nil {
+				return err
+			}
+			reply.Index = index
+			q.srv.setQueryMeta(&reply.QueryMeta)
+			return nil
+		}}
+	return q.srv.blockingRPC(&opts)
+}
+
+// List is used to list the quotas and their usage
+func (q *Quota) List(args *models.QuotaListRequest, reply *models.QuotaListResponse) error {
+	if done, err := q.srv.forward("Quota.List", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "quota", "list"}, time.Now())
+
+	opts := blockingOptions{
+		queryOpts: &args.QueryOptions,
+		queryMeta: &reply.QueryMeta,
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			iter, err := state.Quotas(ws)
+			if err != nil {
+				return err
+			}
+			var usages []*models.QuotaUsage
+			for raw := iter.Next(); raw != nil; raw = iter.Next() {
+				usage, err := quotaUsage(ws, state, raw.(*models.QuotaSpec))
+				if err != nil {
+					return err
+				}
+				usages = append(usages, usage)
+			}
+			reply.Usages = usages
+
+			index, err := state.Index("quotas")
+			if err != nil {
+				return err
+			}
+			reply.Index = index
+			q.srv.setQueryMeta(&reply.QueryMeta)
+			return nil
+		}}
+	return q.srv.blockingRPC(&opts)
+}
+
+func quotaUsage(ws memdb.WatchSet, state *store.StateStore, quota *models.QuotaSpec) (*models.QuotaUsage, error) {
+	jobs, err := state.JobsByNamespace(ws, quota.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	usage := &models.QuotaUsage{Quota: quota}
+	for _, job := range jobs {
+		usage.Add(job)
+	}
+	return usage, nil
+}
+
+// checkQuota refuses to register a job over the quota of its namespace. The
+// full copies are limited when the job is scheduled instead. The job gets
+// the throttle windows of the quota if it has none.
+func (j *Job) checkQuota(job *models.Job) error {
+	if !job.CountsAgainstQuota() {
+		return nil
+	}
+	state := j.srv.fsm.State()
+	quota, err := state.QuotaByNamespace(nil, job.Namespace)
+	if err != nil || quota == nil {
+		return err
+	}
+	job.SetThrottleWindows(quota.ThrottleWindows)
+	jobs, err := state.JobsByNamespace(nil, job.Namespace)
+	if err != nil {
+		return err
+	}
+	usage := &models.QuotaUsage{Quota: quota}
+	for _, other := range jobs {
+		if other.ID != job.ID {
+			usage.Add(other)
+		}
+	}
+
+	if quota.MaxJobs > 0 && usage.Jobs >= quota.MaxJobs {
+		return fmt.Errorf("namespace %q has %d jobs, the most of its quota", job.Namespace, usage.Jobs)
+	}
+	if quota.MaxRowsPerSecond > 0 {
+		rows := job.RowsPerSecond()
+		if rows <= 0 {
+			return fmt.Errorf("namespace %q limits the rows per second, set RowsPerSecond of the Src task", job.Namespace)
+		}
+		if usage.RowsPerSecond+rows > quota.MaxRowsPerSecond {
+			return fmt.Errorf("namespace %q has %d of %d rows per second left", job.Namespace,
+				quota.MaxRowsPerSecond-usage.RowsPerSecond, quota.MaxRowsPerSecond)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,496 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/boltdb/bolt"
+	hcodec "github.com/hashicorp/go-msgpack/codec"
+	"github.com/hashicorp/raft"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// raftStoreStatsInterval is the interval at which the size of the raft
+	// store is emitted
+	raftStoreStatsInterval = 10 * time.Second
+
+	// compactTxMaxSize bounds the size of the transactions writing a
+	// compacted raft store
+	compactTxMaxSize = 64 * 1024 * 1024
+
+	// compactMmapHeadroom is how much the raft store may grow while it is
+	// copied. BoltDB remaps a growing file once its reads are done, so the
+	// writes past it would wait for the copy.
+	compactMmapHeadroom = 1024 * 1024 * 1024
+)
+
+var (
+	// errRaftStoreClosed is returned if the raft store could not be reopened
+	// after a compaction
+	errRaftStoreClosed = errors.New("raft store is closed")
+
+	// errRaftStoreKeyNotFound is returned for a missing key of the stable
+	// store. raft tells it by its text.
+	errRaftStoreKeyNotFound = errors.New("not found")
+
+	// the buckets of the raft log and of the stable store, as raft-boltdb
+	// names them for the stores it created to be opened
+	raftStoreLogs = []byte("logs")
+	raftStoreConf = []byte("conf")
+)
+
+// raftStore is the BoltDB store of the raft log and configuration. BoltDB
+// never gives back the pages it frees, so the store can be compacted into a
+// new file, the raft reads and writes waiting only for its swap.
+type raftStore struct {
+	l    sync.RWMutex
+	path string
+	conn *bolt.DB
+
+	// jl guards the writes recorded while a compaction copies the store,
+	// to be replayed on the copy
+	jl         sync.Mutex
+	compacting bool
+	journal    []raftStoreWrite
+}
+
+// raftStoreWrite is a write of the store recorded during a compaction.
+// Replaying it sets the keys written to their current values.
+type raftStoreWrite struct {
+	// indexes of the logs stored
+	indexes []uint64
+	// the range of the logs deleted, if deleted
+	deleted  bool
+	min, max uint64
+	// key of the stable store set
+	key []byte
+}
+
+func newRaftStore(path string) (*raftStore, error) {
+	conn, err := openRaftStore(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &raftStore{path: path, conn: conn}, nil
+}
+
+// openRaftStore opens the BoltDB file of a raft store, mapping at least
+// mmapSize bytes of it, and creates its buckets
+func openRaftStore(path string, mmapSize int) (*bolt.DB, error) {
+	conn, err := bolt.Open(path, 0600, &bolt.Options{InitialMmapSize: mmapSize})
+	if err != nil {
+		return nil, err
+	}
+	err = conn.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(raftStoreLogs); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(raftStoreConf)
+		return err
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// view runs fn in a read transaction of the store
+func (s *raftStore) view(fn func(*bolt.Tx) error) error {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	if s.conn == nil {
+		return errRaftStoreClosed
+	}
+	return s.conn.View(fn)
+}
+
+// update runs fn in a write transaction of the store, recording w while a
+// compaction copies the store. A write failing is recorded too, replaying
+// it then sets the same values.
+func (s *raftStore) update(w raftStoreWrite, fn func(*bolt.Tx) error) error {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	if s.conn == nil {
+		return errRaftStoreClosed
+	}
+	s.jl.Lock()
+	if s.compacting {
+		s.journal = append(s.journal, w)
+	}
+	s.jl.Unlock()
+	return s.conn.Update(fn)
+}
+
+func (s *raftStore) FirstIndex() (index uint64, err error) {
+	err = s.view(func(tx *bolt.Tx) error {
+		if first, _ := tx.Bucket(raftStoreLogs).Cursor().First(); first != nil {
+			index = binary.BigEndian.Uint64(first)
+		}
+		return nil
+	})
+	return index, err
+}
+
+func (s *raftStore) LastIndex() (index uint64, err error) {
+	err = s.view(func(tx *bolt.Tx) error {
+		if last, _ := tx.Bucket(raftStoreLogs).Cursor().Last(); last != nil {
+			index = binary.BigEndian.Uint64(last)
+		}
+		return nil
+	})
+	return index, err
+}
+
+func (s *raftStore) GetLog(index uint64, log *raft.Log) error {
+	return s.view(func(tx *bolt.Tx) error {
+		val := tx.Bucket(raftStoreLogs).Get(uint64Bytes(index))
+		if val == nil {
+			return raft.ErrLogNotFound
+		}
+		return hcodec.NewDecoderBytes(val, &hcodec.MsgpackHandle{}).Decode(log)
+	})
+}
+
+func (s *raftStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+func (s *raftStore) StoreLogs(logs []*raft.Log) error {
+	w := raftStoreWrite{indexes: make([]uint64, len(logs))}
+	for i, log := range logs {
+		w.indexes[i] = log.Index
+	}
+	return s.update(w, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(raftStoreLogs)
+		for _, log := range logs {
+			var val []byte
+			if err := hcodec.NewEncoderBytes(&val, &hcodec.MsgpackHandle{}).Encode(log); err != nil {
+				return err
+			}
+			if err := bucket.Put(uint64Bytes(log.Index), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *raftStore) DeleteRange(min, max uint64) error {
+	return s.update(raftStoreWrite{deleted: true, min: min, max: max}, func(tx *bolt.Tx) error {
+		return deleteLogs(tx, min, max)
+	})
+}
+
+func deleteLogs(tx *bolt.Tx, min, max uint64) error {
+	curs := tx.Bucket(raftStoreLogs).Cursor()
+	for k, _ := curs.Seek(uint64Bytes(min)); k != nil && binary.BigEndian.Uint64(k) <= max; k, _ = curs.Next() {
+		if err := curs.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *raftStore) Set(key []byte, val []byte) error {
+	w := raftStoreWrite{key: append([]byte(nil), key...)}
+	return s.update(w, func(tx *bolt.Tx) error {
+		return tx.Bucket(raftStoreConf).Put(key, val)
+	})
+}
+
+func (s *raftStore) Get(key []byte) (val []byte, err error) {
+	err = s.view(func(tx *bolt.Tx) error {
+		v := tx.Bucket(raftStoreConf).Get(key)
+		if v == nil {
+			return errRaftStoreKeyNotFound
+		}
+		val = append([]byte(nil), v...)
+		return nil
+	})
+	return val, err
+}
+
+func (s *raftStore) SetUint64(key []byte, val uint64) error {
+	return s.Set(key, uint64Bytes(val))
+}
+
+func (s *raftStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
+
+func (s *raftStore) Close() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func uint64Bytes(u uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, u)
+	return buf
+}
+
+// Stats returns the size of the store and of its free pages
+func (s *raftStore) Stats() (*models.RaftStoreStats, error) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	return s.stats()
+}
+
+func (s *raftStore) stats() (*models.RaftStoreStats, error) {
+	if s.conn == nil {
+		return nil, errRaftStoreClosed
+	}
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	bs := s.conn.Stats()
+	return &models.RaftStoreStats{
+		SizeBytes:     fi.Size(),
+		FreePages:     bs.FreePageN,
+		PendingPages:  bs.PendingPageN,
+		FreeBytes:     bs.FreeAlloc,
+		FreelistBytes: bs.FreelistInuse,
+	}, nil
+}
+
+// EmitStats is used to export metrics about the raft store while enabled
+func (s *raftStore) EmitStats(period time.Duration, stopCh chan struct{}) {
+	for {
+		select {
+		case <-time.After(period):
+			stats, err := s.Stats()
+			if err != nil {
+				continue
+			}
+			metrics.SetGauge([]string{"server", "raft", "db", "size_bytes"}, float32(stats.SizeBytes))
+			metrics.SetGauge([]string{"server", "raft", "db", "free_pages"}, float32(stats.FreePages))
+			metrics.SetGauge([]string{"server", "raft", "db", "pending_pages"}, float32(stats.PendingPages))
+			metrics.SetGauge([]string{"server", "raft", "db", "free_bytes"}, float32(stats.FreeBytes))
+			metrics.SetGauge([]string{"server", "raft", "db", "freelist_bytes"}, float32(stats.FreelistBytes))
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// Compact copies the store into a new file without its free pages, and
+// replaces the store with it. The copy reads a snapshot of the store, the
+// writes since being replayed on it before the swap. It returns the stats of
+// the store before and after.
+func (s *raftStore) Compact() (before, after *models.RaftStoreStats, err error) {
+	s.l.Lock()
+	before, err = s.stats()
+	if err != nil {
+		s.l.Unlock()
+		return nil, nil, err
+	}
+	s.jl.Lock()
+	if s.compacting {
+		s.jl.Unlock()
+		s.l.Unlock()
+		return nil, nil, fmt.Errorf("the raft store is being compacted")
+	}
+	s.compacting = true
+	s.jl.Unlock()
+	err = s.reopen(int(before.SizeBytes) + compactMmapHeadroom)
+	var snapshot *bolt.Tx
+	if err == nil {
+		snapshot, err = s.conn.Begin(false)
+	}
+	s.l.Unlock()
+
+	tmp := s.path + ".compact"
+	var to *bolt.DB
+	if err == nil {
+		to, err = createBoltFile(tmp)
+		if err == nil {
+			err = copyBolt(to, snapshot, compactTxMaxSize)
+		}
+		snapshot.Rollback()
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.jl.Lock()
+	journal := s.journal
+	s.compacting, s.journal = false, nil
+	s.jl.Unlock()
+
+	if err == nil && s.conn == nil {
+		err = errRaftStoreClosed
+	}
+	if err == nil {
+		err = replayRaftStoreWrites(to, s.conn, journal)
+	}
+	if to != nil {
+		if closeErr := to.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err == nil {
+		err = s.conn.Close()
+		s.conn = nil
+		if err == nil {
+			err = replaceFile(tmp, s.path)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	if err != errRaftStoreClosed {
+		// Reopen the store, compacted or not
+		if openErr := s.reopen(0); openErr != nil {
+			return nil, nil, openErr
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compact the raft store: %v", err)
+	}
+
+	after, err = s.stats()
+	if err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+// reopen closes the store if open, and opens it again mapping at least
+// mmapSize bytes. The store is closed if it fails.
+func (s *raftStore) reopen(mmapSize int) error {
+	if s.conn != nil {
+		err := s.conn.Close()
+		s.conn = nil
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := openRaftStore(s.path, mmapSize)
+	if err != nil {
+		return fmt.Errorf("failed to reopen the raft store: %v", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// createBoltFile creates the BoltDB file path, removing the file left by a
+// previous attempt.
+func createBoltFile(path string) (*bolt.DB, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+}
+
+// copyBolt copies the buckets read by src into a database, committing every
+// txMaxSize bytes. The raft store has no nested bucket.
+func copyBolt(dst *bolt.DB, src *bolt.Tx, txMaxSize int) error {
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	size := 0
+	err = src.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return fmt.Errorf("unexpected nested bucket %q in bucket %q", k, name)
+			}
+			if size > 0 && size+len(k)+len(v) > txMaxSize {
+				if err := tx.Commit(); err != nil {
+					tx = nil
+					return err
+				}
+				next, err := dst.Begin(true)
+				if err != nil {
+					tx = nil
+					return err
+				}
+				tx, size = next, 0
+			}
+			size += len(k) + len(v)
+			return tx.Bucket(name).Put(k, v)
+		})
+	})
+	if err != nil {
+		if tx != nil {
+			tx.Rollback()
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// replayRaftStoreWrites applies the writes of the store made during its copy
+// to the copy dst, from their current values in src.
+func replayRaftStoreWrites(dst *bolt.DB, src *bolt.DB, writes []raftStoreWrite) error {
+	return dst.Update(func(dtx *bolt.Tx) error {
+		return src.View(func(stx *bolt.Tx) error {
+			set := func(bucket, key []byte) error {
+				if v := stx.Bucket(bucket).Get(key); v != nil {
+					return dtx.Bucket(bucket).Put(key, v)
+				}
+				return dtx.Bucket(bucket).Delete(key)
+			}
+			for _, w := range writes {
+				switch {
+				case w.deleted:
+					if err := deleteLogs(dtx, w.min, w.max); err != nil {
+						return err
+					}
+				case w.key != nil:
+					if err := set(raftStoreConf, w.key); err != nil {
+						return err
+					}
+				}
+				for _, index := range w.indexes {
+					if err := set(raftStoreLogs, uint64Bytes(index)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// replaceFile renames the file from over the file to, and syncs their
+// directory for the rename to be durable.
+func replaceFile(from, to string) error {
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(to))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
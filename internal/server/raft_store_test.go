@@ -0,0 +1,211 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/raft"
+)
+
+func TestRaftStore_Compact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := newRaftStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	data := bytes.Repeat([]byte("x"), 4096)
+	var logs []*raft.Log
+	for i := uint64(1); i <= 2000; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 1, Type: raft.LogCommand, Data: data})
+	}
+	if err := s.StoreLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUint64([]byte("CurrentTerm"), 1); err != nil {
+		t.Fatal(err)
+	}
+	// raft tells a missing key by the text of the error
+	if _, err := s.GetUint64([]byte("LastVoteTerm")); err == nil || err.Error() != "not found" {
+		t.Fatalf("missing key: %v", err)
+	}
+	if err := s.DeleteRange(1, 1990); err != nil {
+		t.Fatal(err)
+	}
+
+	before, after, err := s.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.FreeBytes == 0 || after.SizeBytes >= before.SizeBytes/10 {
+		t.Fatalf("before = %+v, after = %+v", before, after)
+	}
+
+	if first, err := s.FirstIndex(); err != nil || first != 1991 {
+		t.Fatalf("first index = %v, %v", first, err)
+	}
+	var log raft.Log
+	if err := s.GetLog(2000, &log); err != nil || !bytes.Equal(log.Data, data) {
+		t.Fatalf("log = %+v, %v", log, err)
+	}
+	if term, err := s.GetUint64([]byte("CurrentTerm")); err != nil || term != 1 {
+		t.Fatalf("term = %v, %v", term, err)
+	}
+	if err := s.StoreLog(&raft.Log{Index: 2001, Term: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "raft.db.compact")); !os.IsNotExist(err) {
+		t.Fatalf("compact file left: %v", err)
+	}
+}
+
+func TestRaftStore_CompactReplaysWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := newRaftStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := uint64(1); i <= 10; i++ {
+		if err := s.StoreLog(&raft.Log{Index: i, Term: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetUint64([]byte("CurrentTerm"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writes after the snapshot of a compaction
+	s.compacting = true
+	if err := s.reopen(compactMmapHeadroom); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := s.conn.Begin(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteRange(1, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreLogs([]*raft.Log{{Index: 11, Term: 2}, {Index: 12, Term: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUint64([]byte("CurrentTerm"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.journal) != 3 {
+		t.Fatalf("journal = %+v", s.journal)
+	}
+
+	to, err := createBoltFile(filepath.Join(dir, "raft.db.compact"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+	err = copyBolt(to, snapshot, 100)
+	snapshot.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replayRaftStoreWrites(to, s.conn, s.journal); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := func(db *bolt.DB) (dump []string) {
+		db.View(func(tx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				return b.ForEach(func(k, v []byte) error {
+					dump = append(dump, fmt.Sprintf("%s %x %x", name, k, v))
+					return nil
+				})
+			})
+		})
+		return dump
+	}
+	if got, want := dump(to), dump(s.conn); !reflect.DeepEqual(got, want) {
+		t.Fatalf("copy = %v, want %v", got, want)
+	}
+}
+
+func TestRaftStore_CompactWhileWriting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := newRaftStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	data := bytes.Repeat([]byte("x"), 4096)
+	for i := uint64(1); i <= 2000; i++ {
+		if err := s.StoreLog(&raft.Log{Index: i, Term: 1, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stopCh := make(chan struct{})
+	lastCh := make(chan uint64)
+	go func() {
+		index := uint64(2000)
+		defer func() { lastCh <- index }()
+		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+			if err := s.StoreLog(&raft.Log{Index: index + 1, Term: 2, Data: data}); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := s.DeleteRange(index-1999, index-1999); err != nil {
+				t.Error(err)
+				return
+			}
+			index++
+		}
+	}()
+	_, _, err = s.Compact()
+	close(stopCh)
+	last := <-lastCh
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%d logs written during the compaction", last-2000)
+
+	if first, err := s.FirstIndex(); err != nil || first != last-1999 {
+		t.Fatalf("first index = %v, %v, want %v", first, err, last-1999)
+	}
+	for i := last - 1999; i <= last; i++ {
+		var log raft.Log
+		if err := s.GetLog(i, &log); err != nil || !bytes.Equal(log.Data, data) {
+			t.Fatalf("log %v: %v", i, err)
+		}
+	}
+}
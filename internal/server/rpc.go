@@ -180,9 +180,13 @@ func (s *Server) forward(method string, info models.RPCInfo, args interface{}, r
 		return true, err
 	}
 
-	// Check if we can allow a stale read
+	// Check if we can allow a stale read, within its max staleness
 	if info.IsRead() && info.AllowStaleRead() {
-		return false, nil
+		maxStale := info.MaxStaleRead()
+		if maxStale == 0 || s.IsLeader() || time.Now().Sub(s.raft.LastContact()) <= maxStale {
+			return false, nil
+		}
+		metrics.IncrCounter([]string{"server", "rpc", "stale_forwarded"}, 1)
 	}
 
 CHECK_LEADER:
@@ -191,6 +195,9 @@ CHECK_LEADER:
 
 	// Handle the case we are the leader
 	if isLeader {
+		if info.IsRead() && info.ConsistentRead() {
+			return s.consistentRead()
+		}
 		return false, nil
 	}
 
@@ -217,6 +224,17 @@ CHECK_LEADER:
 	return true, models.ErrNoLeader
 }
 
+// consistentRead verifies the leadership before a consistent read is
+// serviced, for a deposed leader not to serve a stale state. It returns as
+// forward does.
+func (s *Server) consistentRead() (bool, error) {
+	defer metrics.MeasureSince([]string{"server", "rpc", "consistent_read"}, time.Now())
+	if err := s.raft.VerifyLeader().Error(); err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
 // getLeader returns if the current node is the leader, and if not
 // then it returns the leader which is potentially nil if the cluster
 // has not yet elected a leader.
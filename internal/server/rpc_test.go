@@ -21,7 +21,6 @@ import (
 
 	"github.com/docker/leadership"
 	"github.com/hashicorp/raft"
-	raftboltdb "github.com/hashicorp/raft-boltdb"
 	"github.com/hashicorp/serf/serf"
 )
 
@@ -74,7 +73,7 @@ func TestServer_listen(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -156,7 +155,7 @@ func TestServer_handleConn(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -242,7 +241,7 @@ func TestServer_handleMultiplex(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -328,7 +327,7 @@ func TestServer_handleUdupConn(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -414,7 +413,7 @@ func TestServer_forward(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -512,7 +511,7 @@ func TestServer_getLeader(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -602,7 +601,7 @@ func TestServer_forwardLeader(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -694,7 +693,7 @@ func TestServer_forwardRegion(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -786,7 +785,7 @@ func TestServer_raftApplyFuture(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -882,7 +881,7 @@ func TestServer_raftApply(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -982,7 +981,7 @@ func TestServer_setQueryMeta(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -1068,7 +1067,7 @@ func TestServer_blockingRPC(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
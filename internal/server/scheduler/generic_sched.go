@@ -8,9 +8,6 @@ package scheduler
 
 import (
 	"fmt"
-	"math/rand"
-
-	//"math/rand"
 
 	memdb "github.com/hashicorp/go-memdb"
 	"github.com/hashicorp/go-multierror"
@@ -40,8 +37,21 @@ const (
 	// blockedEvalFailedPlacements is the description used for blocked evals
 	// that are a result of failing to place all allocations.
 	blockedEvalFailedPlacements = "created to place remaining allocations"
+
+	// blockedEvalQuotaDesc is the description used for blocked evals waiting
+	// for the full copies of other jobs of the namespace to finish.
+	blockedEvalQuotaDesc = "waiting for a full copy slot of namespace %q"
+
+	// blockedEvalFullCopiesDesc is the description used for blocked evals
+	// waiting for the full copies of the jobs of any namespace to finish.
+	blockedEvalFullCopiesDesc = "waiting for a full copy slot of the cluster"
 )
 
+func init() {
+	RegisterScheduler(models.JobTypeSync, NewGenericScheduler)
+	RegisterScheduler(models.JobTypeMigration, NewGenericScheduler)
+}
+
 // SetStatusError is used to set the status of the evaluation to the given error
 type SetStatusError struct {
 	Err        error
@@ -71,15 +81,32 @@ type GenericScheduler struct {
 
 	blocked        *models.Evaluation
 	failedTGAllocs map[string]*models.AllocMetric
+	placedTGAllocs map[string]*models.AllocMetric
 	queuedAllocs   map[string]int
+
+	// quotaLimitReached is the namespace whose quota blocks the placements
+	quotaLimitReached string
+	// fullCopyLimitReached is set when maxFullCopies blocks the placements
+	fullCopyLimitReached bool
+
+	// algorithm is the default of the servers for placing the allocations,
+	// unless the job overrides it
+	algorithm string
+
+	// maxFullCopies is the number of the jobs of the cluster doing their
+	// full copy at once, 0 for no limit
+	maxFullCopies int
 }
 
 // NewGenericScheduler is a factory function to instantiate a new synchronous scheduler
-func NewGenericScheduler(logger *log.Logger, state State, planner Planner) Scheduler {
+func NewGenericScheduler(logger *log.Logger, state State, planner Planner, algorithm string,
+	maxFullCopies int) Scheduler {
 	s := &GenericScheduler{
-		logger:  logger,
-		state:   state,
-		planner: planner,
+		logger:        logger,
+		state:         state,
+		planner:       planner,
+		algorithm:     algorithm,
+		maxFullCopies: maxFullCopies,
 	}
 	return s
 }
@@ -99,7 +126,7 @@ func (s *GenericScheduler) Process(eval *models.Evaluation) error {
 		desc := fmt.Sprintf("scheduler cannot handle '%s' evaluation reason",
 			eval.TriggeredBy)
 		return setStatus(s.logger, s.planner, s.eval, s.nextEval, s.blocked,
-			s.failedTGAllocs, models.EvalStatusFailed, desc, s.queuedAllocs)
+			s.failedTGAllocs, s.placedTGAllocs, models.EvalStatusFailed, desc, s.queuedAllocs)
 	}
 
 	// Retry up to the maxScheduleAttempts and reset if progress is made.
@@ -113,7 +140,7 @@ func (s *GenericScheduler) Process(eval *models.Evaluation) error {
 				mErr.Errors = append(mErr.Errors, err)
 			}
 			if err := setStatus(s.logger, s.planner, s.eval, s.nextEval, s.blocked,
-				s.failedTGAllocs, statusErr.EvalStatus, err.Error(),
+				s.failedTGAllocs, s.placedTGAllocs, statusErr.EvalStatus, err.Error(),
 				s.queuedAllocs); err != nil {
 				mErr.Errors = append(mErr.Errors, err)
 			}
@@ -129,12 +156,14 @@ func (s *GenericScheduler) Process(eval *models.Evaluation) error {
 		newEval := s.eval.Copy()
 		newEval.EscapedComputedClass = e.HasEscaped()
 		newEval.ClassEligibility = e.GetClasses()
+		newEval.QuotaLimitReached = s.quotaLimitReached
+		newEval.FullCopyLimitReached = s.fullCopyLimitReached
 		return s.planner.ReblockEval(newEval)
 	}
 
 	// Update the status to complete
 	return setStatus(s.logger, s.planner, s.eval, s.nextEval, s.blocked,
-		s.failedTGAllocs, models.EvalStatusComplete, "", s.queuedAllocs)
+		s.failedTGAllocs, s.placedTGAllocs, models.EvalStatusComplete, "", s.queuedAllocs)
 }
 
 // createBlockedEval creates a blocked eval and submits it to the planner. If
@@ -153,6 +182,12 @@ func (s *GenericScheduler) createBlockedEval(planFailure bool) error {
 	if planFailure {
 		s.blocked.TriggeredBy = models.EvalTriggerMaxPlans
 		s.blocked.StatusDescription = blockedEvalMaxPlanDesc
+	} else if s.quotaLimitReached != "" {
+		s.blocked.QuotaLimitReached = s.quotaLimitReached
+		s.blocked.StatusDescription = fmt.Sprintf(blockedEvalQuotaDesc, s.quotaLimitReached)
+	} else if s.fullCopyLimitReached {
+		s.blocked.FullCopyLimitReached = true
+		s.blocked.StatusDescription = blockedEvalFullCopiesDesc
 	} else {
 		s.blocked.StatusDescription = blockedEvalFailedPlacements
 	}
@@ -185,8 +220,11 @@ func (s *GenericScheduler) process() (bool, error) {
 	// Create a plan
 	s.plan = s.eval.MakePlan(s.job)
 
-	// Reset the failed allocations
+	// Reset the failed and placed allocations
 	s.failedTGAllocs = nil
+	s.placedTGAllocs = nil
+	s.quotaLimitReached = ""
+	s.fullCopyLimitReached = false
 
 	// Create an evaluation context
 	s.ctx = NewEvalContext(s.state, s.plan, s.logger)
@@ -251,6 +289,11 @@ func (s *GenericScheduler) process() (bool, error) {
 // re-placed.
 func (s *GenericScheduler) filterCompleteAllocs(allocs []*models.Allocation) ([]*models.Allocation, map[string]*models.Allocation) {
 	filter := func(a *models.Allocation) bool {
+		// A step or a task of a group which is done is kept, not to be run
+		// again
+		if s.job.AllocDone(a) {
+			return false
+		}
 		// Filter terminal, non batch allocations
 		return a.TerminalStatus()
 	}
@@ -355,10 +398,44 @@ func (s *GenericScheduler) computeJobAllocs() error {
 		s.queuedAllocs[allocTuple.Task.Type] += 1
 	}
 
+	// A job starting its full copy waits for a slot of its namespace, then
+	// for one of the cluster
+	reached, err := s.fullCopyQuotaReached(allocs)
+	if err != nil {
+		return err
+	}
+	if reached {
+		s.quotaLimitReached = s.job.Namespace
+		s.failPlacements(diff.place, fmt.Sprintf("max full copies of namespace %q", s.job.Namespace))
+		return nil
+	}
+	reached, err = s.fullCopyLimitOfClusterReached(allocs)
+	if err != nil {
+		return err
+	}
+	if reached {
+		s.fullCopyLimitReached = true
+		s.failPlacements(diff.place, fmt.Sprintf("max full copies of the cluster (%d)", s.maxFullCopies))
+		return nil
+	}
+
 	// Compute the placements
 	return s.computePlacements(diff.place)
 }
 
+// failPlacements records the placements of place failed, as a limit was
+// exhausted.
+func (s *GenericScheduler) failPlacements(place []allocTuple, exhausted string) {
+	for _, missing := range place {
+		if s.failedTGAllocs == nil {
+			s.failedTGAllocs = make(map[string]*models.AllocMetric)
+		}
+		metric := s.ctx.Metrics()
+		metric.QuotaExhausted = exhausted
+		s.failedTGAllocs[missing.Task.Type] = metric
+	}
+}
+
 // computePlacements computes placements for allocations
 func (s *GenericScheduler) computePlacements(place []allocTuple) error {
 	// Get the base nodes
@@ -371,8 +448,7 @@ func (s *GenericScheduler) computePlacements(place []allocTuple) error {
 		return fmt.Errorf("no ready nodes")
 	}
 
-	s.ctx.Metrics().EvaluateNode()
-
+	placeStandbyLast(place)
 	for _, missing := range place {
 		// Check if this task has already failed
 		if metric, ok := s.failedTGAllocs[missing.Task.Type]; ok {
@@ -380,27 +456,52 @@ func (s *GenericScheduler) computePlacements(place []allocTuple) error {
 			continue
 		}
 
+		// Each placement has its own metrics
+		s.ctx.Reset()
+
+		// Store the available nodes by datacenter
+		s.ctx.Metrics().NodesAvailable = byDC
+
 		// Find the preferred node
 		preferredNode, err := s.findPreferredNode(&missing)
 		if err != nil {
 			return err
 		}
 
-		if preferredNode != nil {
-			// do nothing
-		} else {
-			nodeId := nodes[rand.Intn(len(nodes))].ID
-			s.logger.Debugf("sched: no preferred node. Auto selected node %v for task %v", nodeId, missing.Name)
-
-			ws := memdb.NewWatchSet() // TODO what is ws used for?
-			preferredNode, err = s.state.NodeByID(ws, nodeId)
+		candidates := nodes
+		switch missing.Task.Type {
+		case models.TaskTypeDest:
+			if preferredNode == nil {
+				if preferredNode, err = s.standbyNode(); err != nil {
+					return err
+				}
+			}
+		case models.TaskTypeDestStandby:
+			// The standby must not share the fate of the Dest task
+			destNodeID, err := s.taskNodeID(models.TaskTypeDest)
 			if err != nil {
 				return err
 			}
+			candidates = nodesExcept(nodes, destNodeID)
+			if preferredNode != nil && preferredNode.ID == destNodeID {
+				s.ctx.Metrics().FilterNode(preferredNode, "node of the Dest task")
+				preferredNode = nil
+				if missing.Task.NodeID != "" || missing.Task.NodeName != "" {
+					// pinned to the node of the Dest task
+					candidates = nil
+				}
+			}
 		}
 
-		// Store the available nodes by datacenter
-		s.ctx.Metrics().NodesAvailable = byDC
+		if preferredNode != nil {
+			s.ctx.Metrics().EvaluateNode()
+		} else if len(candidates) > 0 {
+			preferredNode, err = s.selectNode(candidates)
+			if err != nil {
+				return err
+			}
+			s.logger.Debugf("sched: no preferred node. Auto selected node %v for task %v", preferredNode.ID, missing.Name)
+		}
 
 		if preferredNode != nil {
 			// Create an allocation for this
@@ -429,6 +530,11 @@ func (s *GenericScheduler) computePlacements(place []allocTuple) error {
 				}
 			}
 			s.plan.AppendAlloc(alloc)
+
+			if s.placedTGAllocs == nil {
+				s.placedTGAllocs = make(map[string]*models.AllocMetric)
+			}
+			s.placedTGAllocs[missing.Task.Type] = s.ctx.Metrics()
 		} else {
 			// Lazy initialize the failed map
 			if s.failedTGAllocs == nil {
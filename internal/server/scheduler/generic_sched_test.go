@@ -40,9 +40,11 @@ func TestSetStatusError_Error(t *testing.T) {
 
 func TestNewGenericScheduler(t *testing.T) {
 	type args struct {
-		logger  *log.Logger
-		state   State
-		planner Planner
+		logger        *log.Logger
+		state         State
+		planner       Planner
+		algorithm     string
+		maxFullCopies int
 	}
 	tests := []struct {
 		name string
@@ -53,7 +55,8 @@ func TestNewGenericScheduler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewGenericScheduler(tt.args.logger, tt.args.state, tt.args.planner); !reflect.DeepEqual(got, tt.want) {
+			if got := NewGenericScheduler(tt.args.logger, tt.args.state, tt.args.planner, tt.args.algorithm,
+				tt.args.maxFullCopies); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewGenericScheduler() = %v, want %v", got, tt.want)
 			}
 		})
@@ -210,6 +213,25 @@ func TestGenericScheduler_process(t *testing.T) {
 }
 
 func TestGenericScheduler_filterCompleteAllocs(t *testing.T) {
+	alloc := func(task, clientStatus string, last *models.TaskEvent) *models.Allocation {
+		return &models.Allocation{
+			ID:            models.GenerateUUID(),
+			Name:          "job." + task,
+			Task:          task,
+			DesiredStatus: models.AllocDesiredStatusRun,
+			ClientStatus:  clientStatus,
+			TaskStates: map[string]*models.TaskState{
+				task: {State: models.TaskStateDead, Events: []*models.TaskEvent{last}},
+			},
+		}
+	}
+	running := alloc(models.TaskTypeSrc, models.AllocClientStatusRunning, models.NewTaskEvent(models.TaskStarted))
+	failed := alloc(models.TaskTypeDest, models.AllocClientStatusFailed, models.NewTaskEvent(models.TaskNotRestarting))
+	verified := alloc(models.TaskTypeVerify, models.AllocClientStatusComplete,
+		models.NewTaskEvent(models.TaskStepCompleted).SetMessage("2 tables match"))
+	verifyFailed := alloc(models.TaskTypeVerify, models.AllocClientStatusFailed,
+		models.NewTaskEvent(models.TaskTerminated).SetExitCode(2))
+
 	type fields struct {
 		logger         *log.Logger
 		state          State
@@ -234,7 +256,30 @@ func TestGenericScheduler_filterCompleteAllocs(t *testing.T) {
 		want   []*models.Allocation
 		want1  map[string]*models.Allocation
 	}{
-		// TODO: Add test cases.
+		{
+			name:  "running",
+			args:  args{allocs: []*models.Allocation{running}},
+			want:  []*models.Allocation{running},
+			want1: map[string]*models.Allocation{},
+		},
+		{
+			name:  "failed",
+			args:  args{allocs: []*models.Allocation{failed}},
+			want:  []*models.Allocation{},
+			want1: map[string]*models.Allocation{failed.Name: failed},
+		},
+		{
+			name:  "completed step",
+			args:  args{allocs: []*models.Allocation{verified}},
+			want:  []*models.Allocation{verified},
+			want1: map[string]*models.Allocation{},
+		},
+		{
+			name:  "failed step",
+			args:  args{allocs: []*models.Allocation{verifyFailed}},
+			want:  []*models.Allocation{},
+			want1: map[string]*models.Allocation{verifyFailed.Name: verifyFailed},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -154,7 +154,7 @@ func (h *Harness) Snapshot() State {
 // a snapshot of current store using the harness for planning.
 func (h *Harness) Scheduler(factory Factory) Scheduler {
 	logger := log.New(os.Stderr, log.InfoLevel)
-	return factory(logger, h.Snapshot(), h)
+	return factory(logger, h.Snapshot(), h, models.SchedulerAlgorithmSpread, 0)
 }
 
 // Process is used to process an evaluation given a factory
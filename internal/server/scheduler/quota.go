@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// fullCopyQuotaReached tells whether the job has to wait for other jobs of
+// its namespace to finish their full copies. allocs are the non terminal
+// allocations of the job: a job having some already holds its slot. Only the
+// jobs having allocations count, for the waiting jobs not to block each
+// other.
+func (s *GenericScheduler) fullCopyQuotaReached(allocs []*models.Allocation) (bool, error) {
+	if s.job == nil || !s.job.FullCopying() || len(allocs) > 0 {
+		return false, nil
+	}
+	quota, err := s.state.QuotaByNamespace(nil, s.job.Namespace)
+	if err != nil {
+		return false, fmt.Errorf("failed to get quota of namespace %q: %v", s.job.Namespace, err)
+	}
+	if quota == nil || quota.MaxFullCopies == 0 {
+		return false, nil
+	}
+
+	jobs, err := s.state.JobsByNamespace(nil, s.job.Namespace)
+	if err != nil {
+		return false, fmt.Errorf("failed to get jobs of namespace %q: %v", s.job.Namespace, err)
+	}
+	copying, err := s.countFullCopies(jobs)
+	if err != nil {
+		return false, err
+	}
+	return copying >= quota.MaxFullCopies, nil
+}
+
+// fullCopyLimitOfClusterReached tells whether the job has to wait for the
+// jobs of any namespace to finish their full copies, as the servers run at
+// most maxFullCopies at once. The jobs are counted as for the quota of a
+// namespace.
+func (s *GenericScheduler) fullCopyLimitOfClusterReached(allocs []*models.Allocation) (bool, error) {
+	if s.maxFullCopies == 0 || s.job == nil || !s.job.FullCopying() || len(allocs) > 0 {
+		return false, nil
+	}
+	iter, err := s.state.Jobs(nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get jobs: %v", err)
+	}
+	var jobs []*models.Job
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		jobs = append(jobs, raw.(*models.Job))
+	}
+	copying, err := s.countFullCopies(jobs)
+	if err != nil {
+		return false, err
+	}
+	return copying >= s.maxFullCopies, nil
+}
+
+// countFullCopies returns the number of the jobs, other than the job
+// scheduled, doing their full copy with allocations.
+func (s *GenericScheduler) countFullCopies(jobs []*models.Job) (int, error) {
+	copying := 0
+	for _, job := range jobs {
+		if job.ID == s.job.ID || !job.FullCopying() {
+			continue
+		}
+		jobAllocs, err := s.state.AllocsByJob(nil, job.ID, false)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get allocs for job '%s': %v", job.ID, err)
+		}
+		for _, alloc := range jobAllocs {
+			if !alloc.TerminalStatus() {
+				copying++
+				break
+			}
+		}
+	}
+	return copying, nil
+}
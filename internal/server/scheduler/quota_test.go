@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package scheduler
+
+import (
+	"os"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+func TestGenericScheduler_fullCopyQuotaReached(t *testing.T) {
+	state, err := store.NewStateStore(os.Stderr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	newJob := func(namespace, gtid string) *models.Job {
+		return &models.Job{
+			ID:        models.GenerateUUID(),
+			Namespace: namespace,
+			Type:      models.JobTypeSync,
+			Status:    models.JobStatusPending,
+			Tasks: []*models.Task{
+				{Type: models.TaskTypeSrc, Config: map[string]interface{}{"Gtid": gtid}},
+			},
+		}
+	}
+	const gtid = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	copying := newJob("team1", "")
+	other := newJob("team2", "")
+	waiting := newJob("team1", "")
+	for i, job := range []*models.Job{copying, other, waiting} {
+		if err := state.UpsertJob(uint64(10+i), job); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	alloc := &models.Allocation{
+		ID:            models.GenerateUUID(),
+		EvalID:        models.GenerateUUID(),
+		NodeID:        models.GenerateUUID(),
+		JobID:         copying.ID,
+		Job:           copying,
+		DesiredStatus: models.AllocDesiredStatusRun,
+		ClientStatus:  models.AllocClientStatusRunning,
+	}
+	if err := state.UpsertAllocs(20, []*models.Allocation{alloc}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	reached := func(job *models.Job, allocs []*models.Allocation) bool {
+		s := &GenericScheduler{state: state, job: job}
+		r, err := s.fullCopyQuotaReached(allocs)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return r
+	}
+
+	// no quota
+	if reached(waiting, nil) {
+		t.Errorf("blocked without a quota")
+	}
+
+	if err := state.UpsertQuota(30, &models.QuotaSpec{Namespace: "team1", MaxFullCopies: 1}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reached(waiting, nil) {
+		t.Errorf("not blocked by the full copy of %v", copying.ID)
+	}
+	// a job already placed keeps its slot
+	if reached(copying, []*models.Allocation{alloc}) {
+		t.Errorf("a placed job is blocked")
+	}
+	// another namespace is not limited
+	if reached(other, nil) {
+		t.Errorf("blocked by the quota of another namespace")
+	}
+	// a job replicating incrementally does not need a slot
+	if reached(newJob("team1", gtid), nil) {
+		t.Errorf("blocked without a full copy")
+	}
+
+	// the slot is freed once the copying job has the GTID
+	done := newJob("team1", gtid)
+	done.ID = copying.ID
+	if err := state.UpdateJobFromClient(40, done); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if reached(waiting, nil) {
+		t.Errorf("blocked after the full copy ended")
+	}
+}
+
+func TestGenericScheduler_fullCopyLimitOfClusterReached(t *testing.T) {
+	state, err := store.NewStateStore(os.Stderr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	newJob := func(namespace string) *models.Job {
+		return &models.Job{
+			ID:        models.GenerateUUID(),
+			Namespace: namespace,
+			Type:      models.JobTypeSync,
+			Status:    models.JobStatusPending,
+			Tasks: []*models.Task{
+				{Type: models.TaskTypeSrc, Config: map[string]interface{}{}},
+			},
+		}
+	}
+	copying := newJob("team1")
+	waiting := newJob("team2")
+	for i, job := range []*models.Job{copying, waiting} {
+		if err := state.UpsertJob(uint64(10+i), job); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	alloc := &models.Allocation{
+		ID:            models.GenerateUUID(),
+		EvalID:        models.GenerateUUID(),
+		NodeID:        models.GenerateUUID(),
+		JobID:         copying.ID,
+		Job:           copying,
+		DesiredStatus: models.AllocDesiredStatusRun,
+		ClientStatus:  models.AllocClientStatusRunning,
+	}
+	if err := state.UpsertAllocs(20, []*models.Allocation{alloc}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	reached := func(max int, job *models.Job, allocs []*models.Allocation) bool {
+		s := &GenericScheduler{state: state, job: job, maxFullCopies: max}
+		r, err := s.fullCopyLimitOfClusterReached(allocs)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return r
+	}
+
+	if reached(0, waiting, nil) {
+		t.Errorf("blocked without a limit")
+	}
+	// the jobs of all the namespaces count
+	if !reached(1, waiting, nil) {
+		t.Errorf("not blocked by the full copy of %v", copying.ID)
+	}
+	if reached(2, waiting, nil) {
+		t.Errorf("blocked under the limit")
+	}
+	// a job already placed keeps its slot
+	if reached(1, copying, []*models.Allocation{alloc}) {
+		t.Errorf("a placed job is blocked")
+	}
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package scheduler
+
+import (
+	"sort"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// utilizationStale is the age after which the utilization reported by a
+	// node is ignored, as if it reported none
+	utilizationStale = 5 * time.Minute
+
+	// unknownScore is the score of a resource whose utilization is unknown
+	unknownScore = 0.5
+
+	// maxScoredNodes is the number of best nodes whose scores are recorded
+	// in the metrics of a placement
+	maxScoredNodes = 5
+)
+
+// The scores of a ranked node, from 0 (worst) to 1 (best). The resources
+// score 1 when idle, and utilization is their mean. The algorithm of the job
+// scores the allocations on the node: spread and job-anti-affinity favor the
+// nodes with fewer allocations, of all jobs and of the job, binpack the ones
+// with more. The final score is the mean of utilization and of the scores of
+// the algorithm.
+const (
+	scoreCPU             = "cpu"
+	scoreMemory          = "memory"
+	scoreDisk            = "disk"
+	scoreNetwork         = "network"
+	scoreUtilization     = "utilization"
+	scoreSpread          = "spread"
+	scoreJobAntiAffinity = "job-anti-affinity"
+	scoreBinpack         = "binpack"
+	scoreFinal           = "final"
+)
+
+// rankedNode is a node scored for a placement.
+type rankedNode struct {
+	node   *models.Node
+	scores map[string]float64
+}
+
+// nodeAllocs is the number of allocations proposed on a node, of all jobs
+// and of the job being placed.
+type nodeAllocs struct {
+	total int
+	job   int
+}
+
+// rankNodes scores the nodes for a placement with the algorithm, the best
+// first. The network is scored relatively to the busiest node, its capacity
+// being unknown. The ties keep the order of nodes.
+func rankNodes(nodes []*models.Node, allocs map[string]nodeAllocs, algorithm string, now time.Time) []*rankedNode {
+	var maxNetwork float64
+	maxAllocs := 0
+	for _, node := range nodes {
+		if u := freshUtilization(node, now); u != nil && u.NetworkBytesPerSec > maxNetwork {
+			maxNetwork = u.NetworkBytesPerSec
+		}
+		if n := allocs[node.ID].total; n > maxAllocs {
+			maxAllocs = n
+		}
+	}
+
+	ranked := make([]*rankedNode, 0, len(nodes))
+	for _, node := range nodes {
+		scores := map[string]float64{
+			scoreCPU:     unknownScore,
+			scoreMemory:  unknownScore,
+			scoreDisk:    unknownScore,
+			scoreNetwork: unknownScore,
+		}
+		if u := freshUtilization(node, now); u != nil {
+			scores[scoreCPU] = freeScore(u.CPUPercent)
+			scores[scoreMemory] = freeScore(u.MemoryPercent)
+			scores[scoreDisk] = freeScore(u.DiskPercent)
+			scores[scoreNetwork] = 1
+			if maxNetwork > 0 {
+				scores[scoreNetwork] = 1 - u.NetworkBytesPerSec/maxNetwork
+			}
+		}
+		scores[scoreUtilization] = (scores[scoreCPU] + scores[scoreMemory] +
+			scores[scoreDisk] + scores[scoreNetwork]) / 4
+
+		// the share of the busiest node's allocations on the node
+		share := 0.0
+		if maxAllocs > 0 {
+			share = float64(allocs[node.ID].total) / float64(maxAllocs)
+		}
+		var placement float64
+		switch algorithm {
+		case models.SchedulerAlgorithmBinpack:
+			scores[scoreBinpack] = share
+			placement = scores[scoreBinpack]
+		default:
+			scores[scoreSpread] = 1 - share
+			scores[scoreJobAntiAffinity] = 1 / float64(1+allocs[node.ID].job)
+			placement = (scores[scoreSpread] + scores[scoreJobAntiAffinity]) / 2
+		}
+		scores[scoreFinal] = (scores[scoreUtilization] + placement) / 2
+		ranked = append(ranked, &rankedNode{node: node, scores: scores})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].scores[scoreFinal] > ranked[j].scores[scoreFinal]
+	})
+	return ranked
+}
+
+// freshUtilization returns the utilization of a node unless it is stale.
+func freshUtilization(node *models.Node, now time.Time) *models.NodeUtilization {
+	u := node.Utilization
+	if u == nil || now.Sub(time.Unix(u.CollectedAt, 0)) > utilizationStale {
+		return nil
+	}
+	return u
+}
+
+// freeScore returns the score of a resource used at percent.
+func freeScore(percent float64) float64 {
+	switch {
+	case percent <= 0:
+		return 1
+	case percent >= 100:
+		return 0
+	}
+	return 1 - percent/100
+}
+
+// schedulerAlgorithm returns the algorithm placing the allocations of the
+// job: its own, else the one of the servers.
+func (s *GenericScheduler) schedulerAlgorithm() string {
+	if s.job != nil && s.job.SchedulerAlgorithm != "" {
+		return s.job.SchedulerAlgorithm
+	}
+	if s.algorithm != "" {
+		return s.algorithm
+	}
+	return models.SchedulerAlgorithmSpread
+}
+
+// selectNode picks the best node for a placement, and records the scores of
+// the best nodes in the metrics of the placement. The nodes are shuffled
+// first for the ties to be broken at random.
+func (s *GenericScheduler) selectNode(nodes []*models.Node) (*models.Node, error) {
+	shuffled := make([]*models.Node, len(nodes))
+	copy(shuffled, nodes)
+	shuffleNodes(shuffled)
+
+	allocs := make(map[string]nodeAllocs, len(nodes))
+	for _, node := range shuffled {
+		proposed, err := s.ctx.ProposedAllocs(node.ID)
+		if err != nil {
+			return nil, err
+		}
+		var n nodeAllocs
+		for _, alloc := range proposed {
+			n.total++
+			if alloc.JobID == s.job.ID {
+				n.job++
+			}
+		}
+		allocs[node.ID] = n
+	}
+
+	ranked := rankNodes(shuffled, allocs, s.schedulerAlgorithm(), time.Now())
+	metrics := s.ctx.Metrics()
+	for i, r := range ranked {
+		metrics.EvaluateNode()
+		if i >= maxScoredNodes {
+			continue
+		}
+		for name, score := range r.scores {
+			metrics.ScoreNode(r.node, name, score)
+		}
+	}
+	if len(ranked) == 0 {
+		return nil, nil
+	}
+	return ranked[0].node, nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package scheduler
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+func rankedIDs(ranked []*rankedNode) []string {
+	var ids []string
+	for _, r := range ranked {
+		ids = append(ids, r.node.ID)
+	}
+	return ids
+}
+
+func TestRankNodes(t *testing.T) {
+	now := time.Now()
+	util := func(cpu, mem, disk, network float64, age time.Duration) *models.NodeUtilization {
+		return &models.NodeUtilization{CPUPercent: cpu, MemoryPercent: mem, DiskPercent: disk,
+			NetworkBytesPerSec: network, CollectedAt: now.Add(-age).Unix()}
+	}
+	busy := &models.Node{ID: "busy", Utilization: util(90, 80, 70, 1000, 0)}
+	idle := &models.Node{ID: "idle", Utilization: util(10, 20, 30, 0, 0)}
+	unknown := &models.Node{ID: "unknown"}
+	stale := &models.Node{ID: "stale", Utilization: util(0, 0, 0, 0, time.Hour)}
+
+	ranked := rankNodes([]*models.Node{busy, unknown, idle, stale}, nil, models.SchedulerAlgorithmSpread, now)
+	want := []string{"idle", "unknown", "stale", "busy"}
+	if got := rankedIDs(ranked); len(got) != 4 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+
+	scores := ranked[0].scores
+	if scores[scoreCPU] != 0.9 || scores[scoreNetwork] != 1 || scores[scoreSpread] != 1 {
+		t.Errorf("idle scores = %v", scores)
+	}
+	if got := ranked[3].scores; got[scoreNetwork] != 0 || got[scoreUtilization] > 0.2 {
+		t.Errorf("busy scores = %v", got)
+	}
+	if got := ranked[1].scores[scoreUtilization]; got != unknownScore {
+		t.Errorf("unknown utilization score = %v", got)
+	}
+}
+
+func TestRankNodes_Algorithms(t *testing.T) {
+	now := time.Now()
+	nodes := []*models.Node{{ID: "empty"}, {ID: "loaded"}, {ID: "same-job"}}
+	allocs := map[string]nodeAllocs{
+		"loaded":   {total: 4},
+		"same-job": {total: 1, job: 1},
+	}
+
+	spread := rankNodes(nodes, allocs, models.SchedulerAlgorithmSpread, now)
+	if got := rankedIDs(spread); got[0] != "empty" || got[2] != "loaded" {
+		t.Errorf("spread order = %v", got)
+	}
+	if s := spread[1].scores; s[scoreJobAntiAffinity] != 0.5 || s[scoreSpread] != 0.75 {
+		t.Errorf("same-job scores = %v", s)
+	}
+
+	binpack := rankNodes(nodes, allocs, models.SchedulerAlgorithmBinpack, now)
+	if got := rankedIDs(binpack); got[0] != "loaded" || got[2] != "empty" {
+		t.Errorf("binpack order = %v", got)
+	}
+	if _, ok := binpack[0].scores[scoreSpread]; ok {
+		t.Errorf("binpack scores = %v", binpack[0].scores)
+	}
+}
+
+func TestGenericScheduler_selectNode(t *testing.T) {
+	state, err := store.NewStateStore(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []*models.Node
+	for i := 0; i < maxScoredNodes+2; i++ {
+		nodes = append(nodes, &models.Node{ID: models.GenerateUUID(),
+			Utilization: &models.NodeUtilization{CPUPercent: 50, CollectedAt: time.Now().Unix()}})
+	}
+	job := &models.Job{ID: "job1"}
+	// the job has an allocation on every node but one
+	var existing []*models.Allocation
+	for _, node := range nodes[1:] {
+		existing = append(existing, &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), JobID: job.ID,
+			NodeID: node.ID, DesiredStatus: models.AllocDesiredStatusRun, ClientStatus: models.AllocClientStatusRunning})
+	}
+	if err := state.UpsertAllocs(10, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := log.New(ioutil.Discard, log.ErrorLevel)
+	s := &GenericScheduler{logger: logger, job: job, algorithm: models.SchedulerAlgorithmSpread,
+		ctx: NewEvalContext(state, &models.Plan{}, logger)}
+	node, err := s.selectNode(nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node != nodes[0] {
+		t.Fatalf("selected %v, want %v", node.ID, nodes[0].ID)
+	}
+	metrics := s.ctx.Metrics()
+	if metrics.NodesEvaluated != len(nodes) {
+		t.Errorf("evaluated %d nodes", metrics.NodesEvaluated)
+	}
+	if _, ok := metrics.Scores[nodes[0].ID+"."+scoreFinal]; !ok {
+		t.Errorf("no final score of the selected node: %v", metrics.Scores)
+	}
+
+	// the job overrides the algorithm of the servers
+	job.SchedulerAlgorithm = models.SchedulerAlgorithmBinpack
+	s.ctx.Reset()
+	if node, err = s.selectNode(nodes); err != nil {
+		t.Fatal(err)
+	}
+	if node == nodes[0] {
+		t.Errorf("binpack selected the empty node")
+	}
+}
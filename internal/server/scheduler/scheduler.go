@@ -8,6 +8,8 @@ package scheduler
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/hashicorp/go-memdb"
 
@@ -23,28 +25,69 @@ const (
 	SchedulerVersion uint16 = 1
 )
 
-// BuiltinSchedulers contains the built in registered schedulers
-// which are available
-var BuiltinSchedulers = map[string]Factory{
-	models.JobTypeSync: NewGenericScheduler,
+var (
+	// schedulers are the factories of the schedulers registered, by the
+	// type of the evaluations they process
+	schedulers     = make(map[string]Factory)
+	schedulersLock sync.RWMutex
+)
+
+// RegisterScheduler makes the scheduler of factory process the evaluations
+// of type name. A scheduler registers itself from the init function of its
+// package; registering a name twice panics.
+func RegisterScheduler(name string, factory Factory) {
+	schedulersLock.Lock()
+	defer schedulersLock.Unlock()
+	if factory == nil {
+		panic("scheduler: RegisterScheduler factory is nil")
+	}
+	if _, dup := schedulers[name]; dup {
+		panic("scheduler: RegisterScheduler called twice for " + name)
+	}
+	schedulers[name] = factory
+}
+
+// IsRegistered returns if a scheduler processes the evaluations of type name.
+func IsRegistered(name string) bool {
+	schedulersLock.RLock()
+	defer schedulersLock.RUnlock()
+	_, ok := schedulers[name]
+	return ok
+}
+
+// Schedulers returns the sorted names of the schedulers registered
+func Schedulers() []string {
+	schedulersLock.RLock()
+	defer schedulersLock.RUnlock()
+	names := make([]string, 0, len(schedulers))
+	for name := range schedulers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // NewScheduler is used to instantiate and return a new scheduler
-// given the scheduler name, initial store, and planner.
-func NewScheduler(name string, logger *ulog.Logger, state State, planner Planner) (Scheduler, error) {
+// given the scheduler name, initial store, and planner. The algorithm
+// places the allocations of the jobs which set none, and maxFullCopies
+// limits the full copies of all the jobs.
+func NewScheduler(name string, logger *ulog.Logger, state State, planner Planner, algorithm string,
+	maxFullCopies int) (Scheduler, error) {
 	// Lookup the factory function
-	factory, ok := BuiltinSchedulers[name]
+	schedulersLock.RLock()
+	factory, ok := schedulers[name]
+	schedulersLock.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("unknown scheduler '%s'", name)
 	}
 
 	// Instantiate the scheduler
-	sched := factory(logger, state, planner)
+	sched := factory(logger, state, planner, algorithm, maxFullCopies)
 	return sched, nil
 }
 
 // Factory is used to instantiate a new Scheduler
-type Factory func(*ulog.Logger, State, Planner) Scheduler
+type Factory func(logger *ulog.Logger, state State, planner Planner, algorithm string, maxFullCopies int) Scheduler
 
 // Scheduler is the top level instance for a scheduler. A scheduler is
 // meant to only encapsulate business logic, pushing the various plumbing
@@ -84,6 +127,16 @@ type State interface {
 
 	// GetJobByID is used to lookup a job by ID
 	JobByID(ws memdb.WatchSet, id string) (*models.Job, error)
+
+	// Jobs returns an iterator over all the jobs.
+	// The type of each result is *models.Job
+	Jobs(ws memdb.WatchSet) (memdb.ResultIterator, error)
+
+	// JobsByNamespace returns the jobs of a namespace
+	JobsByNamespace(ws memdb.WatchSet, namespace string) ([]*models.Job, error)
+
+	// QuotaByNamespace is used to lookup the quota of a namespace
+	QuotaByNamespace(ws memdb.WatchSet, namespace string) (*models.QuotaSpec, error)
 }
 
 // Planner interface is used to submit a task allocation plan.
@@ -7,17 +7,22 @@
 package scheduler
 
 import (
+	"os"
 	"reflect"
 	"testing"
+
 	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
 )
 
 func TestNewScheduler(t *testing.T) {
 	type args struct {
-		name    string
-		logger  *ulog.Logger
-		state   State
-		planner Planner
+		name          string
+		logger        *ulog.Logger
+		state         State
+		planner       Planner
+		algorithm     string
+		maxFullCopies int
 	}
 	tests := []struct {
 		name    string
@@ -29,7 +34,8 @@ func TestNewScheduler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := NewScheduler(tt.args.name, tt.args.logger, tt.args.state, tt.args.planner)
+			got, err := NewScheduler(tt.args.name, tt.args.logger, tt.args.state, tt.args.planner, tt.args.algorithm,
+				tt.args.maxFullCopies)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewScheduler() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -40,3 +46,28 @@ func TestNewScheduler(t *testing.T) {
 		})
 	}
 }
+
+func TestRegisterScheduler(t *testing.T) {
+	if !IsRegistered(models.JobTypeSync) || !IsRegistered(models.JobTypeMigration) {
+		t.Fatalf("schedulers = %v", Schedulers())
+	}
+	RegisterScheduler("test-registry", NewGenericScheduler)
+	defer func() {
+		schedulersLock.Lock()
+		delete(schedulers, "test-registry")
+		schedulersLock.Unlock()
+	}()
+	if sched, err := NewScheduler("test-registry", ulog.New(os.Stderr, ulog.ErrorLevel), nil, nil, "", 0); err != nil || sched == nil {
+		t.Errorf("NewScheduler: %v %v", sched, err)
+	}
+	if _, err := NewScheduler("unknown", nil, nil, nil, "", 0); err == nil {
+		t.Error("a scheduler of an unknown type")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("a scheduler registered twice")
+		}
+	}()
+	RegisterScheduler(models.JobTypeSync, NewGenericScheduler)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// placeStandbyLast orders the placements for the DestStandby task to come
+// after the one of the Dest task, whose node it must avoid.
+func placeStandbyLast(place []allocTuple) {
+	sort.SliceStable(place, func(i, j int) bool {
+		return place[i].Task.Type != models.TaskTypeDestStandby && place[j].Task.Type == models.TaskTypeDestStandby
+	})
+}
+
+// taskNodeID returns the node of the allocation of a task of the job, either
+// placed by the plan or running and not stopped by it, or "" if it has none.
+func (s *GenericScheduler) taskNodeID(taskType string) (string, error) {
+	for nodeID, allocs := range s.plan.NodeAllocation {
+		for _, alloc := range allocs {
+			if alloc.JobID == s.job.ID && alloc.Task == taskType {
+				return nodeID, nil
+			}
+		}
+	}
+
+	stopped := make(map[string]bool)
+	for _, allocs := range s.plan.NodeUpdate {
+		for _, alloc := range allocs {
+			stopped[alloc.ID] = true
+		}
+	}
+	allocs, err := s.state.AllocsByJob(nil, s.job.ID, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to get allocs for job '%s': %v", s.job.ID, err)
+	}
+	for _, alloc := range allocs {
+		if alloc.Task == taskType && !alloc.TerminalStatus() && !stopped[alloc.ID] {
+			return alloc.NodeID, nil
+		}
+	}
+	return "", nil
+}
+
+// standbyNode returns the node of the DestStandby task of the job if it is
+// ready. The Dest task is placed there when its node is lost, as the standby
+// applier takes over on it.
+func (s *GenericScheduler) standbyNode() (*models.Node, error) {
+	if !s.job.HasStandby() {
+		return nil, nil
+	}
+	nodeID, err := s.taskNodeID(models.TaskTypeDestStandby)
+	if err != nil || nodeID == "" {
+		return nil, err
+	}
+	node, err := s.state.NodeByID(nil, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil || !node.Ready() {
+		return nil, nil
+	}
+	return node, nil
+}
+
+// nodesExcept returns the nodes but the one of the given ID.
+func nodesExcept(nodes []*models.Node, id string) []*models.Node {
+	others := make([]*models.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.ID != id {
+			others = append(others, node)
+		}
+	}
+	return others
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package scheduler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+func TestGenericScheduler_placeStandby(t *testing.T) {
+	state, err := store.NewStateStore(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []*models.Node
+	for i := 0; i < 2; i++ {
+		node := &models.Node{ID: models.GenerateUUID(), Datacenter: "dc1", Status: models.NodeStatusReady,
+			NatsAddr: fmt.Sprintf("127.0.0.1:%d", 8193+i)}
+		if err := state.UpsertNode(uint64(10+i), node); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	job := &models.Job{ID: models.GenerateUUID(), Datacenters: []string{"dc1"}, Tasks: []*models.Task{
+		{Type: models.TaskTypeDestStandby, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{}},
+		{Type: models.TaskTypeDest, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{}},
+	}}
+	l := log.New(ioutil.Discard, log.ErrorLevel)
+	newScheduler := func() *GenericScheduler {
+		plan := &models.Plan{NodeAllocation: make(map[string][]*models.Allocation),
+			NodeUpdate: make(map[string][]*models.Allocation)}
+		return &GenericScheduler{logger: l, state: state, job: job, eval: &models.Evaluation{ID: models.GenerateUUID()},
+			plan: plan, ctx: NewEvalContext(state, plan, l), algorithm: models.SchedulerAlgorithmSpread}
+	}
+	placed := func(s *GenericScheduler) map[string]string {
+		nodeIDs := make(map[string]string)
+		for nodeID, allocs := range s.plan.NodeAllocation {
+			for _, alloc := range allocs {
+				nodeIDs[alloc.Task] = nodeID
+			}
+		}
+		return nodeIDs
+	}
+
+	// the standby is placed after the Dest task, on the other node
+	s := newScheduler()
+	place := []allocTuple{{Name: "standby", Task: job.Tasks[0]}, {Name: "dest", Task: job.Tasks[1]}}
+	if err := s.computePlacements(place); err != nil {
+		t.Fatal(err)
+	}
+	nodeIDs := placed(s)
+	if nodeIDs[models.TaskTypeDest] == "" || nodeIDs[models.TaskTypeDestStandby] == "" ||
+		nodeIDs[models.TaskTypeDest] == nodeIDs[models.TaskTypeDestStandby] {
+		t.Fatalf("placements = %v", nodeIDs)
+	}
+
+	// the Dest task replacing a lost one goes to the node of the standby
+	var allocs []*models.Allocation
+	for _, nodeAllocs := range s.plan.NodeAllocation {
+		allocs = append(allocs, nodeAllocs...)
+	}
+	if err := state.UpsertAllocs(20, allocs); err != nil {
+		t.Fatal(err)
+	}
+	var lost *models.Allocation
+	for _, alloc := range allocs {
+		if alloc.Task == models.TaskTypeDest {
+			lost = alloc
+		}
+	}
+	s = newScheduler()
+	s.plan.AppendUpdate(lost, models.AllocDesiredStatusStop, "alloc is lost", models.AllocClientStatusLost)
+	if err := s.computePlacements([]allocTuple{{Name: "dest", Task: job.Tasks[1]}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := placed(s)[models.TaskTypeDest]; got != nodeIDs[models.TaskTypeDestStandby] {
+		t.Errorf("Dest placed on %v, want the node of the standby %v", got, nodeIDs[models.TaskTypeDestStandby])
+	}
+
+	// no node is left for the standby
+	s = newScheduler()
+	job.Tasks[0].NodeID = nodeIDs[models.TaskTypeDest]
+	if err := s.computePlacements([]allocTuple{{Name: "standby", Task: job.Tasks[0]}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := placed(s)[models.TaskTypeDestStandby]; ok {
+		t.Errorf("standby placed with the Dest task")
+	}
+	if metric := s.failedTGAllocs[models.TaskTypeDestStandby]; metric == nil || metric.NodesFiltered != 1 {
+		t.Errorf("metric of the failed placement = %+v", metric)
+	}
+}
@@ -33,6 +33,10 @@ func materializeTasks(job *models.Job) map[string]*models.Task {
 	}
 
 	for _, t := range job.Tasks {
+		// the tasks of a group wait for the previous groups to complete
+		if !job.TaskGroupStarted(t.Group) {
+			continue
+		}
 		name := fmt.Sprintf("%s.%s", job.Name, t.Type)
 		out[name] = t
 	}
@@ -86,6 +90,12 @@ func diffAllocs(job *models.Job, taintedNodes map[string]*models.Node,
 			continue
 		}
 
+		// A step or a task of a group which is done has nothing left to
+		// update or migrate
+		if job.AllocDone(exist) {
+			goto IGNORE
+		}
+
 		// If we are on a tainted node, we must migrate if we are a service or
 		// if the batch allocation did not finish
 		if node, ok := taintedNodes[exist.NodeID]; ok {
@@ -297,7 +307,7 @@ func tasksUpdated(jobA, jobB *models.Job, task string) bool {
 // setStatus is used to update the status of the evaluation
 func setStatus(logger *log.Logger, planner Planner,
 	eval, nextEval, spawnedBlocked *models.Evaluation,
-	tgMetrics map[string]*models.AllocMetric, status, desc string,
+	tgMetrics, placedMetrics map[string]*models.AllocMetric, status, desc string,
 	queuedAllocs map[string]int) error {
 
 	logger.Debugf("sched: %#v: setting status to %s", eval, status)
@@ -305,6 +315,7 @@ func setStatus(logger *log.Logger, planner Planner,
 	newEval.Status = status
 	newEval.StatusDescription = desc
 	newEval.FailedTGAllocs = tgMetrics
+	newEval.PlacementMetrics = placedMetrics
 	if nextEval != nil {
 		newEval.NextEval = nextEval.ID
 	}
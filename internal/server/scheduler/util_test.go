@@ -14,6 +14,15 @@ import (
 )
 
 func Test_materializeTasks(t *testing.T) {
+	src := &models.Task{Type: models.TaskTypeSrc}
+	dest := &models.Task{Type: models.TaskTypeDest}
+	migration := &models.Task{Type: models.TaskTypeSchemaMigration, Group: "schema"}
+	grouped := func(t *models.Task) *models.Task {
+		g := *t
+		g.Group = "copy"
+		return &g
+	}
+
 	type args struct {
 		job *models.Job
 	}
@@ -22,7 +31,24 @@ func Test_materializeTasks(t *testing.T) {
 		args args
 		want map[string]*models.Task
 	}{
-		// TODO: Add test cases.
+		{
+			name: "no groups",
+			args: args{job: &models.Job{Name: "job", Tasks: []*models.Task{src, dest}}},
+			want: map[string]*models.Task{"job.Src": src, "job.Dest": dest},
+		},
+		{
+			name: "groups",
+			args: args{job: &models.Job{
+				Name:   "job",
+				Groups: []string{"schema", "copy"},
+				GroupStates: []*models.TaskGroupState{
+					{Name: "schema", Status: models.TaskGroupStatusRunning},
+					{Name: "copy", Status: models.TaskGroupStatusPending},
+				},
+				Tasks: []*models.Task{migration, grouped(src), grouped(dest)},
+			}},
+			want: map[string]*models.Task{"job.SchemaMigration": migration},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -292,7 +318,7 @@ func Test_setStatus(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := setStatus(tt.args.logger, tt.args.planner, tt.args.eval, tt.args.nextEval, tt.args.spawnedBlocked, tt.args.tgMetrics, tt.args.status, tt.args.desc, tt.args.queuedAllocs); (err != nil) != tt.wantErr {
+			if err := setStatus(tt.args.logger, tt.args.planner, tt.args.eval, tt.args.nextEval, tt.args.spawnedBlocked, tt.args.tgMetrics, nil, tt.args.status, tt.args.desc, tt.args.queuedAllocs); (err != nil) != tt.wantErr {
 				t.Errorf("setStatus() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -62,6 +62,11 @@ func (s *Server) nodeJoin(me serf.MemberEvent) {
 			s.logger.Warnf("manager: Non-server in gossip pool: %s", m.Name)
 			continue
 		}
+		if !parts.compatible() {
+			s.logger.Errorf("manager: Ignoring server %s: it speaks protocol versions %d to %d, not compatible with %d to %d",
+				parts, parts.MinVersion, parts.Version, models.ProtocolVersionMin, models.ProtocolVersion)
+			continue
+		}
 		s.logger.Printf("manager: Adding server %s", parts)
 
 		// Check if this server is known
@@ -128,7 +133,7 @@ func (s *Server) maybeBootstrap() {
 		if !valid {
 			continue
 		}
-		if p.Region != s.config.Region {
+		if p.Region != s.config.Region || !p.compatible() {
 			continue
 		}
 		if p.Expect != 0 && p.Expect != int(atomic.LoadInt32(&s.config.BootstrapExpect)) {
@@ -271,3 +276,18 @@ func (s *Server) localMemberEvent(me serf.MemberEvent) {
 		}
 	}
 }
+
+// serversSupport tells whether every alive server of the region supports a
+// feature, i.e. whether its raft messages can be written.
+func (s *Server) serversSupport(feature string) bool {
+	for _, member := range s.serf.Members() {
+		valid, parts := isUdupServer(member)
+		if !valid || parts.Region != s.config.Region || member.Status != serf.StatusAlive {
+			continue
+		}
+		if !parts.Features[feature] {
+			return false
+		}
+	}
+	return true
+}
@@ -18,7 +18,6 @@ import (
 
 	"github.com/docker/leadership"
 	"github.com/hashicorp/raft"
-	raftboltdb "github.com/hashicorp/raft-boltdb"
 	"github.com/hashicorp/serf/serf"
 )
 
@@ -31,7 +30,7 @@ func TestServer_serfEventHandler(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -113,7 +112,7 @@ func TestServer_nodeJoin(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -199,7 +198,7 @@ func TestServer_maybeBootstrap(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -281,7 +280,7 @@ func TestServer_nodeFailed(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
@@ -367,7 +366,7 @@ func TestServer_localMemberEvent(t *testing.T) {
 		leaderCh            <-chan bool
 		raft                *raft.Raft
 		raftLayer           *RaftLayer
-		raftStore           *raftboltdb.BoltStore
+		raftStore           *raftStore
 		raftInmem           *raft.InmemStore
 		raftTransport       *raft.NetworkTransport
 		fsm                 *udupFSM
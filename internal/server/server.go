@@ -18,18 +18,20 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/docker/leadership"
 	"github.com/hashicorp/raft"
-	"github.com/hashicorp/raft-boltdb"
 	"github.com/hashicorp/serf/serf"
 
 	"github.com/actiontech/dtle/internal"
 	uconf "github.com/actiontech/dtle/internal/config"
 	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/scheduler"
 	"github.com/actiontech/dtle/internal/server/store"
 )
 
@@ -70,7 +72,7 @@ type Server struct {
 	leaderCh      <-chan bool
 	raft          *raft.Raft
 	raftLayer     *RaftLayer
-	raftStore     *raftboltdb.BoltStore
+	raftStore     *raftStore
 	raftInmem     *raft.InmemStore
 	raftTransport *raft.NetworkTransport
 
@@ -115,6 +117,12 @@ type Server struct {
 	// plans that are waiting to be assessed by the leader
 	planQueue *PlanQueue
 
+	// planStats records the outcome of the applied plans
+	planStats *planStats
+
+	// admitters are the admission controllers of the registered jobs
+	admitters []jobAdmitter
+
 	// heartbeatTimers track the expiration time of each heartbeat that has
 	// a TTL. On expiration, the node status is updated to be 'down'.
 	heartbeatTimers     map[string]*time.Timer
@@ -131,13 +139,15 @@ type Server struct {
 
 // Holds the RPC endpoints
 type endpoints struct {
-	Status *Status
-	Node   *Node
-	Job    *Job
-	Order  *Order
-	Eval   *Eval
-	Plan   *Plan
-	Alloc  *Alloc
+	Status   *Status
+	Node     *Node
+	Job      *Job
+	Order    *Order
+	Eval     *Eval
+	Plan     *Plan
+	Alloc    *Alloc
+	Operator *Operator
+	Quota    *Quota
 }
 
 // NewServer is used to construct a new Udup server from the
@@ -148,6 +158,7 @@ func NewServer(config *uconf.ServerConfig, logger *ulog.Logger) (*Server, error)
 	if err != nil {
 		return nil, err
 	}
+	evalBroker.SetNamespaceWeights(config.EvalNamespaceWeights)
 
 	// Create a new blocked eval tracker.
 	blockedEvals := NewBlockedEvals(evalBroker)
@@ -158,6 +169,11 @@ func NewServer(config *uconf.ServerConfig, logger *ulog.Logger) (*Server, error)
 		return nil, err
 	}
 
+	admitters, err := newJobAdmitters(config.Admission, logger)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to setup admission controllers: %v", err)
+	}
+
 	// Create the server
 	s := &Server{
 		config:       config,
@@ -171,6 +187,8 @@ func NewServer(config *uconf.ServerConfig, logger *ulog.Logger) (*Server, error)
 		evalBroker:   evalBroker,
 		blockedEvals: blockedEvals,
 		planQueue:    planQueue,
+		planStats:    newPlanStats(),
+		admitters:    admitters,
 		shutdownCh:   make(chan struct{}),
 	}
 
@@ -239,6 +257,11 @@ func NewServer(config *uconf.ServerConfig, logger *ulog.Logger) (*Server, error)
 	// Emit metrics
 	go s.heartbeatStats()
 
+	// Emit metrics for the raft store
+	if s.raftStore != nil {
+		go s.raftStore.EmitStats(raftStoreStatsInterval, s.shutdownCh)
+	}
+
 	// Done
 	return s, nil
 }
@@ -392,6 +415,8 @@ func (s *Server) setupRPC() error {
 	s.endpoints.Node = &Node{srv: s}
 	s.endpoints.Plan = &Plan{s}
 	s.endpoints.Status = &Status{s}
+	s.endpoints.Operator = &Operator{s}
+	s.endpoints.Quota = &Quota{s}
 
 	// Register the handlers
 	s.rpcServer.Register(s.endpoints.Alloc)
@@ -401,6 +426,8 @@ func (s *Server) setupRPC() error {
 	s.rpcServer.Register(s.endpoints.Node)
 	s.rpcServer.Register(s.endpoints.Plan)
 	s.rpcServer.Register(s.endpoints.Status)
+	s.rpcServer.Register(s.endpoints.Operator)
+	s.rpcServer.Register(s.endpoints.Quota)
 
 	list, err := net.ListenTCP("tcp", s.config.RPCAddr)
 	if err != nil {
@@ -446,6 +473,7 @@ func (s *Server) setupRaft() error {
 	if err != nil {
 		return err
 	}
+	s.fsm.slowApplyThreshold = s.config.SlowApplyThreshold
 
 	// Create a transport layer
 	trans := raft.NewNetworkTransport(s.raftLayer, 3, s.config.RaftTimeout,
@@ -465,78 +493,86 @@ func (s *Server) setupRaft() error {
 	var log raft.LogStore
 	var stable raft.StableStore
 	var snap raft.SnapshotStore
-	// Create the base raft path
-	path := filepath.Join(s.config.DataDir, raftState)
-	if err := ensurePath(path, true); err != nil {
-		return err
-	}
-
-	// Create the BoltDB backend
-	store, err := raftboltdb.NewBoltStore(filepath.Join(path, "raft.db"))
-	if err != nil {
-		return err
-	}
-	s.raftStore = store
-	stable = store
-
-	// Wrap the store in a LogCache to improve performance
-	cacheStore, err := raft.NewLogCache(raftLogCacheSize, store)
-	if err != nil {
-		store.Close()
-		return err
-	}
-	log = cacheStore
-
-	// Create the snapshot store
-	snapshots, err := raft.NewFileSnapshotStore(path, snapshotsRetained, s.config.LogOutput)
-	if err != nil {
-		if s.raftStore != nil {
-			s.raftStore.Close()
-		}
-		return err
-	}
-	snap = snapshots
-
-	// For an existing cluster being upgraded to the new version of
-	// Raft, we almost never want to run recovery based on the old
-	// peers.json file. We create a peers.info file with a helpful
-	// note about where peers.json went, and use that as a sentinel
-	// to avoid ingesting the old one that first time (if we have to
-	// create the peers.info file because it's not there, we also
-	// blow away any existing peers.json file).
-	peersFile := filepath.Join(path, "peers.json")
-	peersInfoFile := filepath.Join(path, "peers.info")
-	if _, err := os.Stat(peersInfoFile); os.IsNotExist(err) {
-		if err := ioutil.WriteFile(peersInfoFile, []byte(peersInfoContent), 0755); err != nil {
-			return fmt.Errorf("failed to write peers.info file: %v", err)
+	if s.config.DevMode {
+		store := raft.NewInmemStore()
+		s.raftInmem = store
+		stable = store
+		log = store
+		snap = raft.NewDiscardSnapshotStore()
+	} else {
+		// Create the base raft path
+		path := filepath.Join(s.config.DataDir, raftState)
+		if err := ensurePath(path, true); err != nil {
+			return err
 		}
 
-		// Blow away the peers.json file if present, since the
-		// peers.info sentinel wasn't there.
-		if _, err := os.Stat(peersFile); err == nil {
-			if err := os.Remove(peersFile); err != nil {
-				return fmt.Errorf("failed to delete peers.json, please delete manually (see peers.info for details): %v", err)
-			}
-			s.logger.Printf("manager: deleted peers.json file (see peers.info for details)")
-		}
-	} else if _, err := os.Stat(peersFile); err == nil {
-		s.logger.Printf("manager: found peers.json file, recovering Raft configuration...")
-		configuration, err := raft.ReadPeersJSON(peersFile)
+		// Create the BoltDB backend
+		store, err := newRaftStore(filepath.Join(path, "raft.db"))
 		if err != nil {
-			return fmt.Errorf("recovery failed to parse peers.json: %v", err)
+			return err
 		}
-		tmpFsm, err := NewFSM(s.evalBroker, s.blockedEvals, s.config.LogOutput, s.logger)
+		s.raftStore = store
+		stable = store
+
+		// Wrap the store in a LogCache to improve performance
+		cacheStore, err := raft.NewLogCache(raftLogCacheSize, store)
 		if err != nil {
-			return fmt.Errorf("recovery failed to make temp FSM: %v", err)
+			store.Close()
+			return err
 		}
-		if err := raft.RecoverCluster(s.config.RaftConfig, tmpFsm,
-			log, stable, snap, trans, configuration); err != nil {
-			return fmt.Errorf("recovery failed: %v", err)
+		log = cacheStore
+
+		// Create the snapshot store
+		snapshots, err := raft.NewFileSnapshotStore(path, snapshotsRetained, s.config.LogOutput)
+		if err != nil {
+			if s.raftStore != nil {
+				s.raftStore.Close()
+			}
+			return err
 		}
-		if err := os.Remove(peersFile); err != nil {
-			return fmt.Errorf("recovery failed to delete peers.json, please delete manually (see peers.info for details): %v", err)
+		snap = newStreamingSnapshotStore(snapshots, s.fsm, s.logger)
+
+		// For an existing cluster being upgraded to the new version of
+		// Raft, we almost never want to run recovery based on the old
+		// peers.json file. We create a peers.info file with a helpful
+		// note about where peers.json went, and use that as a sentinel
+		// to avoid ingesting the old one that first time (if we have to
+		// create the peers.info file because it's not there, we also
+		// blow away any existing peers.json file).
+		peersFile := filepath.Join(path, "peers.json")
+		peersInfoFile := filepath.Join(path, "peers.info")
+		if _, err := os.Stat(peersInfoFile); os.IsNotExist(err) {
+			if err := ioutil.WriteFile(peersInfoFile, []byte(peersInfoContent), 0755); err != nil {
+				return fmt.Errorf("failed to write peers.info file: %v", err)
+			}
+
+			// Blow away the peers.json file if present, since the
+			// peers.info sentinel wasn't there.
+			if _, err := os.Stat(peersFile); err == nil {
+				if err := os.Remove(peersFile); err != nil {
+					return fmt.Errorf("failed to delete peers.json, please delete manually (see peers.info for details): %v", err)
+				}
+				s.logger.Printf("manager: deleted peers.json file (see peers.info for details)")
+			}
+		} else if _, err := os.Stat(peersFile); err == nil {
+			s.logger.Printf("manager: found peers.json file, recovering Raft configuration...")
+			configuration, err := raft.ReadPeersJSON(peersFile)
+			if err != nil {
+				return fmt.Errorf("recovery failed to parse peers.json: %v", err)
+			}
+			tmpFsm, err := NewFSM(s.evalBroker, s.blockedEvals, s.config.LogOutput, s.logger)
+			if err != nil {
+				return fmt.Errorf("recovery failed to make temp FSM: %v", err)
+			}
+			if err := raft.RecoverCluster(s.config.RaftConfig, tmpFsm,
+				log, stable, snap, trans, configuration); err != nil {
+				return fmt.Errorf("recovery failed: %v", err)
+			}
+			if err := os.Remove(peersFile); err != nil {
+				return fmt.Errorf("recovery failed to delete peers.json, please delete manually (see peers.info for details): %v", err)
+			}
+			s.logger.Printf("manager: deleted peers.json file after successful recovery")
 		}
-		s.logger.Printf("manager: deleted peers.json file after successful recovery")
 	}
 
 	// If we are in bootstrap or dev mode and the store is clean then we can
@@ -586,6 +622,9 @@ func (s *Server) setupSerf(conf *serf.Config, ch chan serf.Event, path string) (
 	conf.Tags["dc"] = s.config.Datacenter
 	conf.Tags["build"] = s.config.Build
 	conf.Tags["port"] = fmt.Sprintf("%d", s.rpcAdvertise.(*net.TCPAddr).Port)
+	conf.Tags["vsn_min"] = fmt.Sprintf("%d", models.ProtocolVersionMin)
+	conf.Tags["vsn"] = fmt.Sprintf("%d", models.ProtocolVersion)
+	conf.Tags["features"] = strings.Join(models.Features, ",")
 	if s.config.Bootstrap {
 		conf.Tags["bootstrap"] = "1"
 	}
@@ -598,9 +637,11 @@ func (s *Server) setupSerf(conf *serf.Config, ch chan serf.Event, path string) (
 	conf.MemberlistConfig.Logger = conf.Logger
 	conf.LogOutput = s.config.LogOutput
 	conf.EventCh = ch
-	conf.SnapshotPath = filepath.Join(s.config.DataDir, path)
-	if err := ensurePath(conf.SnapshotPath, false); err != nil {
-		return nil, err
+	if !s.config.DevMode {
+		conf.SnapshotPath = filepath.Join(s.config.DataDir, path)
+		if err := ensurePath(conf.SnapshotPath, false); err != nil {
+			return nil, err
+		}
 	}
 	conf.RejoinAfterLeave = true
 
@@ -618,6 +659,11 @@ func (s *Server) setupWorkers() error {
 		s.logger.Warnf("manager: no enabled schedulers")
 		return nil
 	}
+	for _, name := range s.config.EnabledSchedulers {
+		if !scheduler.IsRegistered(name) {
+			s.logger.Warnf("manager: no scheduler is registered for enabled scheduler %q", name)
+		}
+	}
 
 	// Start the workers
 	for i := 0; i < s.config.NumSchedulers; i++ {
@@ -764,6 +810,17 @@ func (s *Server) Stats() map[string]map[string]string {
 		"serf":    s.serf.Stats(),
 		"runtime": internal.RuntimeStats(),
 	}
+	if s.raftStore != nil {
+		if store, err := s.raftStore.Stats(); err == nil {
+			stats["raft_store"] = map[string]string{
+				"size_bytes":     strconv.FormatInt(store.SizeBytes, 10),
+				"free_pages":     strconv.Itoa(store.FreePages),
+				"pending_pages":  strconv.Itoa(store.PendingPages),
+				"free_bytes":     strconv.Itoa(store.FreeBytes),
+				"freelist_bytes": strconv.Itoa(store.FreelistBytes),
+			}
+		}
+	}
 
 	return stats
 }
@@ -0,0 +1,206 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/raft"
+
+	ulog "github.com/actiontech/dtle/internal/logger"
+)
+
+// snapshotProgressBytes is the amount of a snapshot received between two
+// progress logs
+const snapshotProgressBytes = 64 * 1024 * 1024
+
+// errSnapshotCanceled ends the restore of a canceled snapshot
+var errSnapshotCanceled = errors.New("snapshot canceled")
+
+// streamingSnapshotStore is a snapshot store restoring the snapshots it
+// receives from the leader while they are written, chunk by chunk, into a
+// new store store. When raft then opens the snapshot to restore it, the FSM
+// swaps in that store instead of reading the snapshot back from the disk.
+//
+// This overlaps the restore with the transfer only. The snapshot is still
+// written whole to the file store, as raft compacts its log up to it once
+// installed and restarts from it, so the disk needed by an install is not
+// reduced.
+type streamingSnapshotStore struct {
+	raft.SnapshotStore
+	fsm    *udupFSM
+	logger *ulog.Logger
+
+	// staged is the last snapshot restored while received, until raft
+	// opens it
+	l      sync.Mutex
+	staged *stagedSnapshot
+}
+
+func newStreamingSnapshotStore(store raft.SnapshotStore, fsm *udupFSM, logger *ulog.Logger) *streamingSnapshotStore {
+	return &streamingSnapshotStore{SnapshotStore: store, fsm: fsm, logger: logger}
+}
+
+func (s *streamingSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64,
+	configuration raft.Configuration, configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	sink, err := s.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	return &streamingSink{SnapshotSink: sink, store: s, start: time.Now()}, nil
+}
+
+// Open returns the snapshot restored while it was received if it is the one
+// opened, for the FSM to swap it in.
+func (s *streamingSnapshotStore) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+	meta, rc, err := s.SnapshotStore.Open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.l.Lock()
+	staged := s.staged
+	s.staged = nil
+	s.l.Unlock()
+
+	if staged != nil && staged.id == id {
+		staged.ReadCloser = rc
+		return meta, staged, nil
+	}
+	return meta, rc, nil
+}
+
+func (s *streamingSnapshotStore) stage(staged *stagedSnapshot) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.staged = staged
+}
+
+// stagedSnapshot is a snapshot already restored into a new store store
+type stagedSnapshot struct {
+	io.ReadCloser
+	id      string
+	restore *snapshotRestore
+}
+
+// streamingSink writes a snapshot to the file store and into the restore of
+// a new store store. Local snapshots are not restored: their Persist calls
+// skipRestore before writing.
+type streamingSink struct {
+	raft.SnapshotSink
+	store *streamingSnapshotStore
+	start time.Time
+
+	skip bool
+	pipe *io.PipeWriter
+	err  error
+
+	// done is closed when the restore ends, with restore or restoreErr
+	done       chan struct{}
+	restore    *snapshotRestore
+	restoreErr error
+
+	written int64
+	objects int64
+}
+
+// skipRestore writes the snapshot to the file store only
+func (s *streamingSink) skipRestore() {
+	s.skip = true
+}
+
+func (s *streamingSink) Write(p []byte) (int, error) {
+	n, err := s.SnapshotSink.Write(p)
+	if err != nil || s.skip {
+		return n, err
+	}
+	if s.pipe == nil {
+		s.startRestore()
+	}
+
+	// A failed restore does not fail the snapshot, which raft then restores
+	// from the disk
+	if s.err == nil {
+		if _, err := s.pipe.Write(p[:n]); err != nil {
+			s.err = err
+		}
+	}
+
+	metrics.IncrCounter([]string{"server", "raft", "snapshot", "install", "bytes"}, float32(n))
+	if s.written/snapshotProgressBytes != (s.written+int64(n))/snapshotProgressBytes {
+		s.store.logger.Printf("manager: received %d MB of snapshot %v, restored %d objects",
+			(s.written+int64(n))>>20, s.ID(), s.restoredObjects())
+	}
+	s.written += int64(n)
+	return n, nil
+}
+
+func (s *streamingSink) startRestore() {
+	pr, pw := io.Pipe()
+	s.pipe = pw
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		restore, err := s.store.fsm.decodeSnapshot(pr, func() {
+			metrics.IncrCounter([]string{"server", "raft", "snapshot", "install", "objects"}, 1)
+			atomic.AddInt64(&s.objects, 1)
+		})
+		if err != nil {
+			s.restoreErr = err
+			pr.CloseWithError(err)
+			return
+		}
+		s.restore = restore
+	}()
+}
+
+func (s *streamingSink) restoredObjects() int64 {
+	return atomic.LoadInt64(&s.objects)
+}
+
+// Close finalizes the snapshot, and stages its restore for raft to open it
+func (s *streamingSink) Close() error {
+	if err := s.SnapshotSink.Close(); err != nil {
+		s.endRestore(err)
+		return err
+	}
+	if s.pipe == nil {
+		return nil
+	}
+
+	s.pipe.Close()
+	<-s.done
+	if s.restore == nil {
+		s.store.logger.Warnf("manager: failed to restore snapshot %v while receiving it, restoring it from the disk: %v",
+			s.ID(), s.restoreErr)
+		return nil
+	}
+	metrics.MeasureSince([]string{"server", "raft", "snapshot", "install"}, s.start)
+	s.store.logger.Printf("manager: received and restored snapshot %v: %d bytes, %d objects in %v",
+		s.ID(), s.written, s.restoredObjects(), time.Since(s.start))
+	s.store.stage(&stagedSnapshot{id: s.ID(), restore: s.restore})
+	return nil
+}
+
+func (s *streamingSink) Cancel() error {
+	s.endRestore(errSnapshotCanceled)
+	return s.SnapshotSink.Cancel()
+}
+
+// endRestore stops the restore of a snapshot which is not finalized
+func (s *streamingSink) endRestore(err error) {
+	if s.pipe == nil {
+		return
+	}
+	s.pipe.CloseWithError(err)
+	<-s.done
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestStreamingSnapshotStore_Install(t *testing.T) {
+	newFSM := func() *udupFSM {
+		broker, err := NewEvalBroker(time.Minute, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsm, err := NewFSM(broker, NewBlockedEvals(broker), os.Stderr, log.New(os.Stderr, log.ErrorLevel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fsm
+	}
+	logger := log.New(os.Stderr, log.ErrorLevel)
+
+	// the snapshot of the leader, not restored locally
+	leader := newFSM()
+	job := topologyTestJob("job1", "a", "b")
+	job.Type = models.JobTypeSync
+	if err := leader.State().UpsertJob(1, job); err != nil {
+		t.Fatal(err)
+	}
+	leaderStore := newStreamingSnapshotStore(raft.NewInmemSnapshotStore(), leader, logger)
+	snap, err := leader.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := leaderStore.Create(raft.SnapshotVersionMax, 1, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if leaderStore.staged != nil {
+		t.Fatalf("local snapshot restored")
+	}
+	_, rc, err := leaderStore.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// installed on a follower in small chunks
+	follower := newFSM()
+	followerStore := newStreamingSnapshotStore(raft.NewInmemSnapshotStore(), follower, logger)
+	sink, err = followerStore.Create(raft.SnapshotVersionMax, 1, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.CopyBuffer(sink, bytes.NewReader(data), make([]byte, 7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, rc, err = followerStore.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rc.(*stagedSnapshot); !ok {
+		t.Fatalf("snapshot not restored while received")
+	}
+	if err := follower.Restore(rc); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := follower.State().JobByID(nil, "job1"); err != nil || out == nil {
+		t.Fatalf("job = %v, %v", out, err)
+	}
+
+	// a corrupted snapshot is restored from the store, and fails there
+	sink, err = followerStore.Create(raft.SnapshotVersionMax, 2, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write(data[:len(data)/2])
+	sink.Write([]byte{0xff, 0xff})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, rc, err = followerStore.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rc.(*stagedSnapshot); ok {
+		t.Fatalf("corrupted snapshot staged")
+	}
+	if err := follower.Restore(rc); err == nil {
+		t.Fatalf("corrupted snapshot restored")
+	}
+}
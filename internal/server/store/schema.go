@@ -29,6 +29,8 @@ func stateStoreSchema() *memdb.DBSchema {
 		orderTableSchema,
 		evalTableSchema,
 		allocTableSchema,
+		quotaTableSchema,
+		jobStatsTableSchema,
 	}
 
 	// Add each of the tables
@@ -108,6 +110,15 @@ func jobTableSchema() *memdb.TableSchema {
 					Lowercase: false,
 				},
 			},
+			// Meta index is used to list the jobs by their labels
+			"meta": {
+				Name:         "meta",
+				AllowMissing: true,
+				Unique:       false,
+				Indexer: &memdb.StringMapFieldIndex{
+					Field: "Meta",
+				},
+			},
 		},
 	}
 }
@@ -240,3 +251,39 @@ func allocTableSchema() *memdb.TableSchema {
 		},
 	}
 }
+
+// quotaTableSchema returns the MemDB schema for the quota table, keyed by
+// the namespace.
+func quotaTableSchema() *memdb.TableSchema {
+	return &memdb.TableSchema{
+		Name: "quotas",
+		Indexes: map[string]*memdb.IndexSchema{
+			"id": {
+				Name:         "id",
+				AllowMissing: false,
+				Unique:       true,
+				Indexer: &memdb.StringFieldIndex{
+					Field: "Namespace",
+				},
+			},
+		},
+	}
+}
+
+// jobStatsTableSchema returns the MemDB schema for the samples of the lag and
+// the throughput of the jobs, keyed by the job ID.
+func jobStatsTableSchema() *memdb.TableSchema {
+	return &memdb.TableSchema{
+		Name: "job_stats",
+		Indexes: map[string]*memdb.IndexSchema{
+			"id": {
+				Name:         "id",
+				AllowMissing: false,
+				Unique:       true,
+				Indexer: &memdb.StringFieldIndex{
+					Field: "JobID",
+				},
+			},
+		},
+	}
+}
@@ -158,6 +158,16 @@ func (s *StateStore) UpdateJobStatus(index uint64, jobID, status string) error {
 	txn := s.db.Txn(true)
 	defer txn.Abort()
 
+	if err := s.nestedUpdateJobStatus(txn, index, jobID, status); err != nil {
+		return err
+	}
+
+	txn.Commit()
+	return nil
+}
+
+// nestedUpdateJobStatus is used to nest a job status update within a transaction
+func (s *StateStore) nestedUpdateJobStatus(txn *memdb.Txn, index uint64, jobID, status string) error {
 	// Check if the job already exists
 	existing, err := txn.First("jobs", "id", jobID)
 	if err != nil {
@@ -185,13 +195,12 @@ func (s *StateStore) UpdateJobStatus(index uint64, jobID, status string) error {
 	if err := txn.Insert("index", &IndexEntry{"jobs", index}); err != nil {
 		return fmt.Errorf("index update failed: %v", err)
 	}
-
-	txn.Commit()
 	return nil
 }
 
-// UpdateNodeStatus is used to update the status of a node
-func (s *StateStore) UpdateNodeStatus(index uint64, nodeID, status string) error {
+// UpdateNodeStatus is used to update the status of a node, and its
+// utilization if not nil
+func (s *StateStore) UpdateNodeStatus(index uint64, nodeID, status string, util *models.NodeUtilization) error {
 	txn := s.db.Txn(true)
 	defer txn.Abort()
 
@@ -211,6 +220,9 @@ func (s *StateStore) UpdateNodeStatus(index uint64, nodeID, status string) error
 
 	// Update the status in the copy
 	copyNode.Status = status
+	if util != nil {
+		copyNode.Utilization = util
+	}
 	copyNode.ModifyIndex = index
 
 	// Insert the node
@@ -372,6 +384,7 @@ func (s *StateStore) UpsertJob(index uint64, job *models.Job) error {
 		job.CreateIndex = existing.(*models.Job).CreateIndex
 		job.ModifyIndex = index
 		job.JobModifyIndex = index
+		job.InitGroupStates(index, existing.(*models.Job))
 		for _, t1 := range existing.(*models.Job).Tasks {
 			for i, t2 := range job.Tasks {
 				if t1.Type == t2.Type && t2.Config["NatsAddr"] == nil {
@@ -391,6 +404,7 @@ func (s *StateStore) UpsertJob(index uint64, job *models.Job) error {
 		job.CreateIndex = index
 		job.ModifyIndex = index
 		job.JobModifyIndex = index
+		job.InitGroupStates(index, nil)
 
 		if err := s.setJobStatus(index, txn, job, false, ""); err != nil {
 			return fmt.Errorf("setting job status for %q failed: %v", job.ID, err)
@@ -494,6 +508,16 @@ func (s *StateStore) DeleteJob(index uint64, jobID string) error {
 	txn := s.db.Txn(true)
 	defer txn.Abort()
 
+	if err := s.nestedDeleteJob(txn, index, jobID); err != nil {
+		return err
+	}
+
+	txn.Commit()
+	return nil
+}
+
+// nestedDeleteJob is used to nest a job delete within a transaction
+func (s *StateStore) nestedDeleteJob(txn *memdb.Txn, index uint64, jobID string) error {
 	eval, err := txn.Get("evals", "job", jobID, models.EvalStatusComplete)
 	if err != nil {
 		return fmt.Errorf("failed to get blocked evals for job %q: %v", jobID, err)
@@ -592,6 +616,68 @@ func (s *StateStore) DeleteJob(index uint64, jobID string) error {
 		return fmt.Errorf("index update failed: %v", err)
 	}
 
+	stats, err := txn.First("job_stats", "id", jobID)
+	if err != nil {
+		return fmt.Errorf("job stats lookup failed: %v", err)
+	}
+	if stats != nil {
+		if err := txn.Delete("job_stats", stats); err != nil {
+			return fmt.Errorf("job stats delete failed: %v", err)
+		}
+		if err := txn.Insert("index", &IndexEntry{"job_stats", index}); err != nil {
+			return fmt.Errorf("index update failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// UpdateJobsBulk applies a bulk operation on jobs in a single transaction:
+// the statuses are updated, the jobs are deleted and the evaluations are
+// inserted. The jobs which do not exist anymore are skipped.
+func (s *StateStore) UpdateJobsBulk(index uint64, statuses map[string]string, deletes []string,
+	evals []*models.Evaluation) error {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	exists := func(jobID string) (bool, error) {
+		existing, err := txn.First("jobs", "id", jobID)
+		if err != nil {
+			return false, fmt.Errorf("job lookup failed: %v", err)
+		}
+		return existing != nil, nil
+	}
+	for jobID, status := range statuses {
+		if ok, err := exists(jobID); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if err := s.nestedUpdateJobStatus(txn, index, jobID, status); err != nil {
+			return err
+		}
+	}
+	for _, jobID := range deletes {
+		if ok, err := exists(jobID); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if err := s.nestedDeleteJob(txn, index, jobID); err != nil {
+			return err
+		}
+	}
+
+	jobs := make(map[string]string, len(evals))
+	for _, eval := range evals {
+		if err := s.nestedUpsertEval(txn, index, eval); err != nil {
+			return err
+		}
+		jobs[eval.JobID] = ""
+	}
+	if err := s.setJobStatuses(index, txn, jobs, false); err != nil {
+		return fmt.Errorf("setting job status failed: %v", err)
+	}
+
 	txn.Commit()
 	return nil
 }
@@ -641,6 +727,21 @@ func (s *StateStore) Jobs(ws memdb.WatchSet) (memdb.ResultIterator, error) {
 	return iter, nil
 }
 
+// JobsByMeta returns an iterator over the jobs with a meta key set to
+// the value.
+func (s *StateStore) JobsByMeta(ws memdb.WatchSet, key, value string) (memdb.ResultIterator, error) {
+	txn := s.db.Txn(false)
+
+	iter, err := txn.Get("jobs", "meta", key, value)
+	if err != nil {
+		return nil, fmt.Errorf("job lookup failed: %v", err)
+	}
+
+	ws.Add(iter.WatchCh())
+
+	return iter, nil
+}
+
 // JobsByScheduler returns an iterator over all the jobs with the specific
 // scheduler type.
 func (s *StateStore) JobsByScheduler(ws memdb.WatchSet, schedulerType string) (memdb.ResultIterator, error) {
@@ -749,6 +850,186 @@ func (s *StateStore) Orders(ws memdb.WatchSet) (memdb.ResultIterator, error) {
 
 //order end
 
+// UpsertQuota is used to create or update the quota of a namespace
+func (s *StateStore) UpsertQuota(index uint64, quota *models.QuotaSpec) error {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := txn.First("quotas", "id", quota.Namespace)
+	if err != nil {
+		return fmt.Errorf("quota lookup failed: %v", err)
+	}
+	if existing != nil {
+		quota.CreateIndex = existing.(*models.QuotaSpec).CreateIndex
+	} else {
+		quota.CreateIndex = index
+	}
+	quota.ModifyIndex = index
+
+	if err := txn.Insert("quotas", quota); err != nil {
+		return fmt.Errorf("quota insert failed: %v", err)
+	}
+	if err := txn.Insert("index", &IndexEntry{"quotas", index}); err != nil {
+		return fmt.Errorf("index update failed: %v", err)
+	}
+
+	txn.Commit()
+	return nil
+}
+
+// DeleteQuota is used to remove the quota of a namespace
+func (s *StateStore) DeleteQuota(index uint64, namespace string) error {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := txn.First("quotas", "id", namespace)
+	if err != nil {
+		return fmt.Errorf("quota lookup failed: %v", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("quota not found")
+	}
+
+	if err := txn.Delete("quotas", existing); err != nil {
+		return fmt.Errorf("quota delete failed: %v", err)
+	}
+	if err := txn.Insert("index", &IndexEntry{"quotas", index}); err != nil {
+		return fmt.Errorf("index update failed: %v", err)
+	}
+
+	txn.Commit()
+	return nil
+}
+
+// QuotaByNamespace is used to lookup the quota of a namespace
+func (s *StateStore) QuotaByNamespace(ws memdb.WatchSet, namespace string) (*models.QuotaSpec, error) {
+	txn := s.db.Txn(false)
+
+	watchCh, existing, err := txn.FirstWatch("quotas", "id", namespace)
+	if err != nil {
+		return nil, fmt.Errorf("quota lookup failed: %v", err)
+	}
+	ws.Add(watchCh)
+
+	if existing != nil {
+		return existing.(*models.QuotaSpec), nil
+	}
+	return nil, nil
+}
+
+// Quotas returns an iterator over all the quotas
+func (s *StateStore) Quotas(ws memdb.WatchSet) (memdb.ResultIterator, error) {
+	txn := s.db.Txn(false)
+
+	iter, err := txn.Get("quotas", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	ws.Add(iter.WatchCh())
+
+	return iter, nil
+}
+
+// UpsertJobStats adds the samples of the updates to the stats of their jobs.
+// The samples of the jobs which do not exist anymore are dropped. The samples
+// of the jobs with an SLA count for its compliance, the breaches they make
+// are returned.
+func (s *StateStore) UpsertJobStats(index uint64, updates []*models.JobStatsUpdate) ([]*models.SLABreach, error) {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	var breaches []*models.SLABreach
+	for _, update := range updates {
+		if update.Sample == nil {
+			continue
+		}
+		job, err := txn.First("jobs", "id", update.JobID)
+		if err != nil {
+			return nil, fmt.Errorf("job lookup failed: %v", err)
+		}
+		if job == nil {
+			continue
+		}
+		existing, err := txn.First("job_stats", "id", update.JobID)
+		if err != nil {
+			return nil, fmt.Errorf("job stats lookup failed: %v", err)
+		}
+		var stats *models.JobStats
+		if existing != nil {
+			stats = existing.(*models.JobStats).Copy()
+		} else {
+			stats = &models.JobStats{JobID: update.JobID, CreateIndex: index}
+		}
+		stats.Add(update.Sample)
+		if sla := job.(*models.Job).SLA; sla != nil {
+			if stats.SLA == nil {
+				stats.SLA = &models.SLAStatus{}
+			}
+			breaches = append(breaches, stats.SLA.Add(update.JobID, sla, update.Sample)...)
+		}
+		stats.ModifyIndex = index
+		if err := txn.Insert("job_stats", stats); err != nil {
+			return nil, fmt.Errorf("job stats insert failed: %v", err)
+		}
+	}
+	if err := txn.Insert("index", &IndexEntry{"job_stats", index}); err != nil {
+		return nil, fmt.Errorf("index update failed: %v", err)
+	}
+
+	txn.Commit()
+	return breaches, nil
+}
+
+// JobStatsByID is used to lookup the samples of a job
+func (s *StateStore) JobStatsByID(ws memdb.WatchSet, jobID string) (*models.JobStats, error) {
+	txn := s.db.Txn(false)
+
+	watchCh, existing, err := txn.FirstWatch("job_stats", "id", jobID)
+	if err != nil {
+		return nil, fmt.Errorf("job stats lookup failed: %v", err)
+	}
+	ws.Add(watchCh)
+
+	if existing != nil {
+		return existing.(*models.JobStats), nil
+	}
+	return nil, nil
+}
+
+// AllJobStats returns an iterator over the samples of all the jobs
+func (s *StateStore) AllJobStats(ws memdb.WatchSet) (memdb.ResultIterator, error) {
+	txn := s.db.Txn(false)
+
+	iter, err := txn.Get("job_stats", "id")
+	if err != nil {
+		return nil, err
+	}
+	ws.Add(iter.WatchCh())
+	return iter, nil
+}
+
+// JobsByNamespace returns the jobs of a namespace
+func (s *StateStore) JobsByNamespace(ws memdb.WatchSet, namespace string) ([]*models.Job, error) {
+	iter, err := s.Jobs(ws)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*models.Job
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		job := raw.(*models.Job)
+		ns := job.Namespace
+		if ns == "" {
+			ns = models.DefaultNamespace
+		}
+		if ns == namespace {
+			out = append(out, job)
+		}
+	}
+	return out, nil
+}
+
 // UpsertEvals is used to upsert a set of evaluations
 func (s *StateStore) UpsertEvals(index uint64, evals []*models.Evaluation) error {
 	txn := s.db.Txn(true)
@@ -973,6 +1254,58 @@ func (s *StateStore) UpdateJobFromClient(index uint64, job *models.Job) error {
 	return nil
 }
 
+// WarmRestartJob updates a running job, and the job of its allocations which
+// are not terminal, so that their clients apply it to the running tasks.
+func (s *StateStore) WarmRestartJob(index uint64, job *models.Job) error {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := txn.First("jobs", "id", job.ID)
+	if err != nil {
+		return fmt.Errorf("job lookup failed: %v", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("job %v not found", job.ID)
+	}
+	job.CreateIndex = existing.(*models.Job).CreateIndex
+	job.ModifyIndex = index
+	job.JobModifyIndex = index
+	if err := txn.Insert("jobs", job); err != nil {
+		return fmt.Errorf("job insert failed: %v", err)
+	}
+	if err := txn.Insert("index", &IndexEntry{"jobs", index}); err != nil {
+		return fmt.Errorf("index update failed: %v", err)
+	}
+
+	iter, err := txn.Get("allocs", "job", job.ID)
+	if err != nil {
+		return fmt.Errorf("alloc lookup failed: %v", err)
+	}
+	var allocs []*models.Allocation
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		alloc := raw.(*models.Allocation)
+		if alloc.TerminalStatus() {
+			continue
+		}
+		copyAlloc := alloc.Copy()
+		copyAlloc.Job = job
+		copyAlloc.ModifyIndex = index
+		copyAlloc.AllocModifyIndex = index
+		allocs = append(allocs, copyAlloc)
+	}
+	for _, alloc := range allocs {
+		if err := txn.Insert("allocs", alloc); err != nil {
+			return fmt.Errorf("alloc insert failed: %v", err)
+		}
+	}
+	if err := txn.Insert("index", &IndexEntry{"allocs", index}); err != nil {
+		return fmt.Errorf("index update failed: %v", err)
+	}
+
+	txn.Commit()
+	return nil
+}
+
 // UpdateAllocsFromClient is used to update an allocation based on input
 // from a client. While the schedulers are the authority on the allocation for
 // most things, some updates are authoritative from the client. Specifically,
@@ -1019,7 +1352,7 @@ func (s *StateStore) nestedUpdateAllocFromClient(txn *memdb.Txn, index uint64, a
 	//if exist.DesiredStatus != models.AllocDesiredStatusPause {
 	copyAlloc.ClientStatus = alloc.ClientStatus
 	copyAlloc.ClientDescription = alloc.ClientDescription
-	copyAlloc.TaskStates = alloc.TaskStates
+	copyAlloc.TaskStates = models.MergeTaskStates(exist.TaskStates, alloc.TaskStates)
 	//}
 
 	// Update the modify index
@@ -1030,6 +1363,16 @@ func (s *StateStore) nestedUpdateAllocFromClient(txn *memdb.Txn, index uint64, a
 		return fmt.Errorf("alloc insert failed: %v", err)
 	}
 
+	if failure := models.AnalyzeAllocFailures(copyAlloc); failure != nil {
+		if err := s.setJobFailure(index, txn, exist.JobID, failure); err != nil {
+			return err
+		}
+	}
+
+	if err := s.advanceTaskGroups(index, txn, exist.JobID); err != nil {
+		return err
+	}
+
 	// Set the job's status
 	forceStatus := ""
 	if !copyAlloc.ClientTerminalStatus() {
@@ -1039,7 +1382,7 @@ func (s *StateStore) nestedUpdateAllocFromClient(txn *memdb.Txn, index uint64, a
 		default:
 			forceStatus = models.JobStatusRunning
 		}
-	} else {
+	} else if !exist.Job.AllocDone(copyAlloc) {
 		forceStatus = models.JobStatusDead
 	}
 	jobs := map[string]string{exist.JobID: forceStatus}
@@ -1049,6 +1392,80 @@ func (s *StateStore) nestedUpdateAllocFromClient(txn *memdb.Txn, index uint64, a
 	return nil
 }
 
+// advanceTaskGroups completes the running task group of the job once all
+// its tasks completed successfully, starting the next group.
+func (s *StateStore) advanceTaskGroups(index uint64, txn *memdb.Txn, jobID string) error {
+	existing, err := txn.First("jobs", "id", jobID)
+	if err != nil {
+		return fmt.Errorf("job lookup failed: %v", err)
+	}
+	if existing == nil {
+		return nil
+	}
+	job := existing.(*models.Job)
+	group := job.RunningTaskGroup()
+	if group == nil {
+		return nil
+	}
+
+	allocs, err := txn.Get("allocs", "job", jobID)
+	if err != nil {
+		return fmt.Errorf("alloc lookup failed: %v", err)
+	}
+	done := make(map[string]bool)
+	for raw := allocs.Next(); raw != nil; raw = allocs.Next() {
+		alloc := raw.(*models.Allocation)
+		// only the allocations placed since the group started count
+		if alloc.CreateIndex >= group.ModifyIndex && alloc.RanSuccessfully() {
+			done[alloc.Task] = true
+		}
+	}
+	for _, t := range job.Tasks {
+		if t.Group == group.Name && !done[t.Type] {
+			return nil
+		}
+	}
+
+	updated := job.Copy()
+	updated.CompleteTaskGroup(index)
+	updated.ModifyIndex = index
+	if err := txn.Insert("jobs", updated); err != nil {
+		return fmt.Errorf("job insert failed: %v", err)
+	}
+	if err := txn.Insert("index", &IndexEntry{"jobs", index}); err != nil {
+		return fmt.Errorf("index update failed: %v", err)
+	}
+	return nil
+}
+
+// setJobFailure attaches the analysis of a repeatedly failing allocation to
+// its job, unless it is already there.
+func (s *StateStore) setJobFailure(index uint64, txn *memdb.Txn, jobID string, failure *models.FailureAnalysis) error {
+	existing, err := txn.First("jobs", "id", jobID)
+	if err != nil {
+		return fmt.Errorf("job lookup failed: %v", err)
+	}
+	if existing == nil {
+		return nil
+	}
+	job := existing.(*models.Job)
+	if old := job.Failure; old != nil && old.AllocID == failure.AllocID &&
+		old.Failures == failure.Failures && old.Error == failure.Error {
+		return nil
+	}
+
+	updated := job.Copy()
+	updated.Failure = failure
+	updated.ModifyIndex = index
+	if err := txn.Insert("jobs", updated); err != nil {
+		return fmt.Errorf("job insert failed: %v", err)
+	}
+	if err := txn.Insert("index", &IndexEntry{"jobs", index}); err != nil {
+		return fmt.Errorf("index update failed: %v", err)
+	}
+	return nil
+}
+
 // UpsertAllocs is used to evict a set of allocations
 // and allocate new ones at the same time.
 func (s *StateStore) UpsertAllocs(index uint64, allocs []*models.Allocation) error {
@@ -1508,6 +1925,10 @@ func (s *StateStore) getJobStatus(txn *memdb.Txn, job *models.Job, evalDelete bo
 	// The job is dead if all the allocations and evals are terminal or if there
 	// are no evals because of garbage collection.
 	if evalDelete || hasEval || hasAlloc {
+		// the next task group is about to be scheduled
+		if job.TaskGroupsPending() {
+			return models.JobStatusRunning, nil
+		}
 		return models.JobStatusComplete, nil
 	}
 
@@ -1568,6 +1989,22 @@ func (r *StateRestore) AllocRestore(alloc *models.Allocation) error {
 	return nil
 }
 
+// JobStatsRestore is used to restore the samples of a job
+func (r *StateRestore) JobStatsRestore(stats *models.JobStats) error {
+	if err := r.txn.Insert("job_stats", stats); err != nil {
+		return fmt.Errorf("job stats insert failed: %v", err)
+	}
+	return nil
+}
+
+// QuotaRestore is used to restore a quota
+func (r *StateRestore) QuotaRestore(quota *models.QuotaSpec) error {
+	if err := r.txn.Insert("quotas", quota); err != nil {
+		return fmt.Errorf("quota insert failed: %v", err)
+	}
+	return nil
+}
+
 // IndexRestore is used to restore an index
 func (r *StateRestore) IndexRestore(idx *IndexEntry) error {
 	if err := r.txn.Insert("index", idx); err != nil {
@@ -62,12 +62,17 @@ func (t *TimeTable) Deserialize(dec *codec.Decoder) error {
 		return err
 	}
 
-	// Witness from oldest to newest
+	t.witnessAll(table)
+	return nil
+}
+
+// witnessAll witnesses the entries of a serialized table, from oldest to
+// newest
+func (t *TimeTable) witnessAll(table []TimeTableEntry) {
 	n := len(table)
 	for i := n - 1; i >= 0; i-- {
 		t.Witness(table[i].Index, table[i].Time)
 	}
-	return nil
 }
 
 // Witness is used to witness a new index and time.
@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-memdb"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// validateTopology rejects a job which would close a replication cycle
+// (e.g. A->B->C->A) with the other active jobs, unless it allows so.
+func (j *Job) validateTopology(job *models.Job) error {
+	for _, t := range job.Tasks {
+		if cfg, ok := taskMySQLConfig(t); ok && cfg.AllowCycle {
+			return nil
+		}
+	}
+
+	jobs, err := j.listJobs()
+	if err != nil {
+		return err
+	}
+	if cycle := findReplicationCycle(job, jobs); len(cycle) > 0 {
+		return fmt.Errorf("job %v closes a replication cycle: %v. set AllowCycle to accept it",
+			job.ID, strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// listJobs returns all the jobs of the state
+func (j *Job) listJobs() ([]*models.Job, error) {
+	snap, err := j.srv.fsm.State().Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	iter, err := snap.Jobs(memdb.NewWatchSet())
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*models.Job
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		jobs = append(jobs, raw.(*models.Job))
+	}
+	return jobs, nil
+}
+
+// findReplicationCycle returns the MySQL instances of a cycle closed by job,
+// starting and ending with its source. Stopped jobs and the previous version
+// of job are not taken into account.
+func findReplicationCycle(job *models.Job, jobs []*models.Job) []string {
+	src, dst, ok := jobEndpoints(job)
+	if !ok || src == dst {
+		// a job within one instance copies between schemas
+		return nil
+	}
+
+	edges := make(map[string][]string)
+	for _, other := range jobs {
+		if other.ID == job.ID || other.Status == models.JobStatusDead || other.Status == models.JobStatusComplete {
+			continue
+		}
+		if s, d, ok := jobEndpoints(other); ok {
+			edges[s] = append(edges[s], d)
+		}
+	}
+
+	// breadth first search for a path dst -> src
+	parent := map[string]string{dst: ""}
+	queue := []string{dst}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if node == src {
+			var path []string
+			for n := src; n != ""; n = parent[n] {
+				path = append([]string{n}, path...)
+			}
+			return append([]string{src}, path...)
+		}
+		for _, next := range edges[node] {
+			if _, seen := parent[next]; !seen {
+				parent[next] = node
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// jobEndpoints returns the source and target MySQL instances of a job.
+func jobEndpoints(job *models.Job) (src, dst string, ok bool) {
+	for _, t := range job.Tasks {
+		cfg, isMySQL := taskMySQLConfig(t)
+		if !isMySQL {
+			continue
+		}
+		endpoint := strings.ToLower(fmt.Sprintf("%s:%d", cfg.ConnectionConfig.Host, cfg.ConnectionConfig.Port))
+		switch t.Type {
+		case models.TaskTypeSrc:
+			src = endpoint
+		case models.TaskTypeDest:
+			dst = endpoint
+		}
+	}
+	return src, dst, src != "" && dst != ""
+}
+
+func taskMySQLConfig(t *models.Task) (*config.MySQLDriverConfig, bool) {
+	if t.Driver != "" && t.Driver != models.TaskDriverMySQL {
+		return nil, false
+	}
+	var cfg config.MySQLDriverConfig
+	if err := mapstructure.WeakDecode(t.Config, &cfg); err != nil || cfg.ConnectionConfig == nil {
+		return nil, false
+	}
+	return &cfg, true
+}
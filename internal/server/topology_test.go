@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	test "github.com/outbrain/golib/tests"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func topologyTestJob(id, src, dst string) *models.Job {
+	task := func(tp, host string) *models.Task {
+		return &models.Task{
+			Type:   tp,
+			Driver: models.TaskDriverMySQL,
+			Config: map[string]interface{}{
+				"ConnectionConfig": map[string]interface{}{"Host": host, "Port": 3306},
+			},
+		}
+	}
+	return &models.Job{
+		ID:     id,
+		Status: models.JobStatusRunning,
+		Tasks:  []*models.Task{task(models.TaskTypeSrc, src), task(models.TaskTypeDest, dst)},
+	}
+}
+
+func TestFindReplicationCycle(t *testing.T) {
+	jobs := []*models.Job{
+		topologyTestJob("ab", "a", "b"),
+		topologyTestJob("bc", "b", "c"),
+	}
+
+	cycle := findReplicationCycle(topologyTestJob("ca", "c", "a"), jobs)
+	test.S(t).ExpectEquals(len(cycle), 4)
+	test.S(t).ExpectEquals(cycle[0], "c:3306")
+	test.S(t).ExpectEquals(cycle[1], "a:3306")
+	test.S(t).ExpectEquals(cycle[2], "b:3306")
+	test.S(t).ExpectEquals(cycle[3], "c:3306")
+
+	// a chain is fine
+	test.S(t).ExpectEquals(len(findReplicationCycle(topologyTestJob("cd", "c", "d"), jobs)), 0)
+
+	// an updated job does not conflict with its previous version
+	test.S(t).ExpectEquals(len(findReplicationCycle(topologyTestJob("bc", "b", "c"), jobs)), 0)
+
+	// stopped jobs are ignored
+	jobs[1].Status = models.JobStatusDead
+	test.S(t).ExpectEquals(len(findReplicationCycle(topologyTestJob("ca", "c", "a"), jobs)), 0)
+}
+
+// testLeaderServer returns a server leading a single node raft in memory,
+// for the RPC endpoints to handle the requests locally.
+func testLeaderServer(t *testing.T) (*Server, func()) {
+	broker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(os.Stderr, log.ErrorLevel)
+	fsm, err := NewFSM(broker, NewBlockedEvals(broker), os.Stderr, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = "server1"
+	conf.HeartbeatTimeout = 50 * time.Millisecond
+	conf.ElectionTimeout = 50 * time.Millisecond
+	conf.LeaderLeaseTimeout = 50 * time.Millisecond
+	conf.CommitTimeout = 5 * time.Millisecond
+	conf.LogOutput = ioutil.Discard
+	addr, trans := raft.NewInmemTransport("")
+	store, snaps := raft.NewInmemStore(), raft.NewInmemSnapshotStore()
+	if err := raft.BootstrapCluster(conf, store, store, snaps, trans, raft.Configuration{
+		Servers: []raft.Server{{ID: conf.LocalID, Address: addr}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := raft.NewRaft(conf, fsm, store, store, snaps, trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); r.State() != raft.Leader; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			r.Shutdown()
+			t.Fatal("no leader")
+		}
+	}
+
+	srv := &Server{
+		config: &uconf.ServerConfig{Region: uconf.DefaultRegion},
+		logger: logger,
+		raft:   r,
+		fsm:    fsm,
+	}
+	return srv, func() { r.Shutdown().Error() }
+}
+
+func TestJob_ValidateCycle(t *testing.T) {
+	srv, shutdown := testLeaderServer(t)
+	defer shutdown()
+	for i, job := range []*models.Job{topologyTestJob("ab", "a", "b"), topologyTestJob("bc", "b", "c")} {
+		job.Type = models.JobTypeSync
+		if err := srv.fsm.State().UpsertJob(uint64(i+1), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job := topologyTestJob("ca", "c", "a")
+	job.Region, job.Name, job.Type, job.Datacenters = uconf.DefaultRegion, "ca", models.JobTypeSync, []string{"dc1"}
+	req := &models.JobValidateRequest{Job: job, WriteRequest: models.WriteRequest{Region: uconf.DefaultRegion}}
+	err := (&Job{srv: srv}).Validate(req, &models.JobValidateResponse{})
+	if err == nil || !strings.Contains(err.Error(), "closes a replication cycle: c:3306 -> a:3306 -> b:3306 -> c:3306") {
+		t.Errorf("Validate() of a cyclic job = %v", err)
+	}
+}
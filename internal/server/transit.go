@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// validateTransit rejects a job with EncryptTransit which the servers have
+// no keys for, or whose messages would be sent or received by a driver
+// other than MySQL, which does not encrypt them.
+func (j *Job) validateTransit(job *models.Job) error {
+	if !job.EncryptTransit {
+		return nil
+	}
+	if len(j.srv.config.TransitKeyring) == 0 {
+		return fmt.Errorf("job %v has EncryptTransit, but the managers have no transit_keyring", job.ID)
+	}
+	for _, t := range job.Tasks {
+		switch t.Type {
+		case models.TaskTypeSrc, models.TaskTypeDest, models.TaskTypeDestStandby:
+			if t.Driver != "" && t.Driver != models.TaskDriverMySQL {
+				return fmt.Errorf("EncryptTransit needs tasks of driver %v, task %v is of driver %v",
+					models.TaskDriverMySQL, t.Type, t.Driver)
+			}
+		}
+	}
+	return nil
+}
+
+// withTransitKeys returns the allocations to send to an agent, with the keys
+// of their jobs with EncryptTransit. Those are set on copies, so that they
+// are not stored.
+func (s *Server) withTransitKeys(allocs []*models.Allocation) []*models.Allocation {
+	out := make([]*models.Allocation, len(allocs))
+	for i, alloc := range allocs {
+		out[i] = alloc
+		if alloc.Job == nil || !alloc.Job.EncryptTransit {
+			continue
+		}
+		out[i] = alloc.Copy()
+		out[i].TransitKeys = config.DeriveTransitKeys(s.config.TransitKeyring, alloc.JobID)
+	}
+	return out
+}
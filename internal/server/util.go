@@ -15,6 +15,8 @@ import (
 	"strconv"
 
 	"github.com/hashicorp/serf/serf"
+
+	"github.com/actiontech/dtle/internal/models"
 )
 
 // ensurePath is used to make sure a path exists
@@ -34,6 +36,11 @@ type serverParts struct {
 	Bootstrap  bool
 	Expect     int
 	Addr       net.Addr
+
+	// protocol versions and features told by the server
+	MinVersion int
+	Version    int
+	Features   map[string]bool
 }
 
 func (s *serverParts) String() string {
@@ -68,6 +75,11 @@ func isUdupServer(m serf.Member) (bool, *serverParts) {
 		return false, nil
 	}
 
+	minVersion, version, err := models.ParseProtocol(m.Tags["vsn_min"], m.Tags["vsn"])
+	if err != nil {
+		return false, nil
+	}
+
 	addr := &net.TCPAddr{IP: m.Addr, Port: port}
 	parts := &serverParts{
 		Name:       m.Name,
@@ -77,10 +89,19 @@ func isUdupServer(m serf.Member) (bool, *serverParts) {
 		Bootstrap:  bootstrap,
 		Expect:     expect,
 		Addr:       addr,
+		MinVersion: minVersion,
+		Version:    version,
+		Features:   models.ParseFeatures(m.Tags["features"]),
 	}
 	return true, parts
 }
 
+// compatible tells whether the server speaks a protocol version of this
+// server.
+func (s *serverParts) compatible() bool {
+	return models.ProtocolCompatible(s.MinVersion, s.Version)
+}
+
 // shuffleStrings randomly shuffles the list of strings
 func shuffleStrings(list []string) {
 	for i := range list {
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// warmRestart changes the filters of a running job to the ones of the job of
+// args. The allocations of the job get the new job without an evaluation, so
+// that they are not replaced, and their tasks apply the filters in place.
+func (j *Job) warmRestart(args *models.JobRegisterRequest, reply *models.JobResponse) error {
+	job, err := j.warmRestartedJob(args.Job)
+	if err != nil {
+		reply.Success = false
+		return err
+	}
+	if err := j.validateTableOwnership(job); err != nil {
+		reply.Success = false
+		return err
+	}
+
+	req := &models.JobRegisterRequest{
+		Job:          job,
+		WarmRestart:  true,
+		WriteRequest: args.WriteRequest,
+	}
+	_, index, err := j.srv.raftApply(models.JobRegisterRequestType, req)
+	if err != nil {
+		j.srv.logger.Errorf("server.job: warm restart failed: %v", err)
+		reply.Success = false
+		return err
+	}
+	j.srv.logger.Printf("server.job: warm restart of job %v", job.ID)
+
+	reply.Success = true
+	reply.Index = index
+	return nil
+}
+
+// warmRestartedJob returns the running job with the WarmRestartConfig and the
+// TunableConfig of its tasks taken from next, or an error if next changes
+// more.
+func (j *Job) warmRestartedJob(next *models.Job) (*models.Job, error) {
+	snap, err := j.srv.fsm.State().Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := snap.JobByID(memdb.NewWatchSet(), next.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("job %v not found", next.ID)
+	}
+	if existing.Status != models.JobStatusRunning {
+		return nil, fmt.Errorf("job %v is %v, only a running job is restarted warm", next.ID, existing.Status)
+	}
+	if len(next.Tasks) != len(existing.Tasks) {
+		return nil, fmt.Errorf("a warm restart cannot add or remove the tasks of job %v", next.ID)
+	}
+
+	job := existing.Copy()
+	for _, t := range job.Tasks {
+		nextTask := next.LookupTask(t.Type)
+		if nextTask == nil {
+			return nil, fmt.Errorf("a warm restart cannot remove task %v of job %v", t.Type, next.ID)
+		}
+		if err := t.CheckWarmRestart(nextTask); err != nil {
+			return nil, err
+		}
+		tunables := nextTask.Tunables()
+		if len(tunables) > 0 {
+			if err := t.CheckTunables(tunables); err != nil {
+				return nil, err
+			}
+		}
+		t.SetWarmRestartConfig(nextTask)
+		t.SetTunables(tunables)
+	}
+	return job, nil
+}
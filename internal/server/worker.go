@@ -75,6 +75,13 @@ type Worker struct {
 	// first envoked. It is used to mark the SnapshotIndex of evaluations
 	// Created, Updated or Reblocked.
 	snapshotIndex uint64
+
+	// deadline is closed once the deadline of the evaluation passed, on the
+	// copy of the worker planning for it
+	deadline chan struct{}
+
+	// state is the state of the scheduler, refreshed after a plan
+	state *evalState
 }
 
 // NewWorker starts a new worker associated with the given server
@@ -131,7 +138,7 @@ func (w *Worker) run() {
 
 		// Invoke the scheduler to determine placements
 		if err := w.invokeScheduler(eval, token); err != nil {
-			w.sendAck(eval.ID, token, false)
+			w.sendNack(eval.ID, token, err.Error())
 			continue
 		}
 
@@ -198,11 +205,22 @@ REQ:
 // sendAck makes a best effort to ack or nack the evaluation.
 // Any errors are logged but swallowed.
 func (w *Worker) sendAck(evalID, token string, ack bool) {
+	w.ackEval(evalID, token, ack, "")
+}
+
+// sendNack makes a best effort to nack the evaluation, with the reason for
+// the leader to log.
+func (w *Worker) sendNack(evalID, token, reason string) {
+	w.ackEval(evalID, token, false, reason)
+}
+
+func (w *Worker) ackEval(evalID, token string, ack bool, reason string) {
 	defer metrics.MeasureSince([]string{"server", "worker", "send_ack"}, time.Now())
 	// Setup the request
 	req := models.EvalAckRequest{
 		EvalID: evalID,
 		Token:  token,
+		Reason: reason,
 		WriteRequest: models.WriteRequest{
 			Region: w.srv.config.Region,
 		},
@@ -267,34 +285,70 @@ CHECK:
 // invokeScheduler is used to invoke the business logic of the scheduler
 func (w *Worker) invokeScheduler(eval *models.Evaluation, token string) error {
 	defer metrics.MeasureSince([]string{"server", "worker", "invoke_scheduler", eval.Type}, time.Now())
-	// Store the evaluation token
-	w.evalToken = token
-
 	// Snapshot the current state
 	snap, err := w.srv.fsm.State().Snapshot()
 	if err != nil {
 		return fmt.Errorf("failed to snapshot state: %v", err)
 	}
 
-	// Store the snapshot's index
-	w.snapshotIndex, err = snap.LatestIndex()
+	// The scheduler plans through a copy of the worker with the token of the
+	// evaluation and the snapshot's index, its own once the deadline passed
+	planner := &Worker{
+		srv:       w.srv,
+		logger:    w.logger,
+		start:     w.start,
+		evalToken: token,
+		deadline:  make(chan struct{}),
+		state:     newEvalState(snap),
+	}
+	planner.snapshotIndex, err = snap.LatestIndex()
 	if err != nil {
 		return fmt.Errorf("failed to determine snapshot's index: %v", err)
 	}
 
 	// Create the scheduler, or use the special system scheduler
 	var sched scheduler.Scheduler
-	sched, err = scheduler.NewScheduler(eval.Type, w.logger, snap, w)
+	sched, err = scheduler.NewScheduler(eval.Type, w.logger, planner.state, planner, w.srv.config.SchedulerAlgorithm,
+		w.srv.config.MaxFullCopies)
 	if err != nil {
 		return fmt.Errorf("failed to instantiate scheduler: %v", err)
 	}
 
-	// Process the evaluation
-	err = sched.Process(eval)
-	if err != nil {
-		return fmt.Errorf("failed to process evaluation: %v", err)
+	// Process the evaluation, up to its deadline
+	done := make(chan error, 1)
+	go func() {
+		done <- sched.Process(eval)
+	}()
+	var timeout <-chan time.Time
+	if deadline := w.srv.config.EvalDeadline; deadline > 0 {
+		timer := time.NewTimer(deadline)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			return fmt.Errorf("failed to process evaluation: %v", err)
+		}
+		return nil
+	case <-timeout:
+		close(planner.deadline)
+		planner.state.release()
+		metrics.IncrCounter([]string{"server", "worker", "eval_deadline", eval.Type}, 1)
+		w.logger.Errorf("worker: evaluation %s of job %s not processed within %v, nacking it",
+			eval.ID, eval.JobID, w.srv.config.EvalDeadline)
+		return errEvalDeadline
+	}
+}
+
+// expired tells if the deadline of the evaluation the worker plans for passed
+func (w *Worker) expired() bool {
+	select {
+	case <-w.deadline:
+		return true
+	default:
+		return false
 	}
-	return nil
 }
 
 // SubmitPlan is used to submit a plan for consideration. This allows
@@ -304,6 +358,9 @@ func (w *Worker) SubmitPlan(plan *models.Plan) (*models.PlanResult, scheduler.St
 	if w.srv.IsShutdown() {
 		return nil, nil, fmt.Errorf("shutdown while planning")
 	}
+	if w.expired() {
+		return nil, nil, errEvalDeadline
+	}
 	defer metrics.MeasureSince([]string{"server", "worker", "submit_plan"}, time.Now())
 
 	// Add the evaluation token to the plan
@@ -356,6 +413,10 @@ SUBMIT:
 			return nil, nil, fmt.Errorf("failed to snapshot state: %v", err)
 		}
 		state = snap
+		if w.state != nil {
+			w.state.set(snap)
+			state = w.state
+		}
 	}
 
 	// Return the result and potential state update
@@ -369,6 +430,9 @@ func (w *Worker) UpdateEval(eval *models.Evaluation) error {
 	if w.srv.IsShutdown() {
 		return fmt.Errorf("shutdown while planning")
 	}
+	if w.expired() {
+		return errEvalDeadline
+	}
 	defer metrics.MeasureSince([]string{"server", "worker", "update_eval"}, time.Now())
 
 	// Store the snapshot index in the eval
@@ -407,6 +471,9 @@ func (w *Worker) CreateEval(eval *models.Evaluation) error {
 	if w.srv.IsShutdown() {
 		return fmt.Errorf("shutdown while planning")
 	}
+	if w.expired() {
+		return errEvalDeadline
+	}
 	defer metrics.MeasureSince([]string{"server", "worker", "create_eval"}, time.Now())
 
 	// Store the snapshot index in the eval
@@ -445,6 +512,9 @@ func (w *Worker) ReblockEval(eval *models.Evaluation) error {
 	if w.srv.IsShutdown() {
 		return fmt.Errorf("shutdown while planning")
 	}
+	if w.expired() {
+		return errEvalDeadline
+	}
 	defer metrics.MeasureSince([]string{"server", "worker", "reblock_eval"}, time.Now())
 
 	// Store the snapshot index in the eval
@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/scheduler"
+)
+
+// errEvalDeadline is returned to a scheduler still processing an evaluation
+// past its deadline
+var errEvalDeadline = errors.New("evaluation processing deadline exceeded")
+
+// evalState is the state a worker gives to the scheduler of an evaluation.
+// At the deadline of the evaluation the snapshot is released, and the calls
+// of the scheduler fail for it to return.
+type evalState struct {
+	l     sync.RWMutex
+	state scheduler.State
+}
+
+func newEvalState(state scheduler.State) *evalState {
+	return &evalState{state: state}
+}
+
+// set replaces the snapshot, refreshed after a plan, unless it was released
+func (s *evalState) set(state scheduler.State) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.state != nil {
+		s.state = state
+	}
+}
+
+// release drops the snapshot
+func (s *evalState) release() {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.state = nil
+}
+
+func (s *evalState) get() (scheduler.State, error) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	if s.state == nil {
+		return nil, errEvalDeadline
+	}
+	return s.state, nil
+}
+
+func (s *evalState) Nodes(ws memdb.WatchSet) (memdb.ResultIterator, error) {
+	state, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return state.Nodes(ws)
+}
+
+func (s *evalState) AllocsByJob(ws memdb.WatchSet, jobID string, all bool) ([]*models.Allocation, error) {
+	state, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return state.AllocsByJob(ws, jobID, all)
+}
+
+func (s *evalState) AllocsByNode(ws memdb.WatchSet, node string) ([]*models.Allocation, error) {
+	state, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return state.AllocsByNode(ws, node)
+}
+
+func (s *evalState) AllocsByNodeTerminal(ws memdb.WatchSet, node string, terminal bool) ([]*models.Allocation, error) {
+	state, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return state.AllocsByNodeTerminal(ws, node, terminal)
+}
+
+func (s *evalState) NodeByID(ws memdb.WatchSet, nodeID string) (*models.Node, error) {
+	state, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return state.NodeByID(ws, nodeID)
+}
+
+func (s *evalState) JobByID(ws memdb.WatchSet, id string) (*models.Job, error) {
+	state, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return state.JobByID(ws, id)
+}
+
+func (s *evalState) Jobs(ws memdb.WatchSet) (memdb.ResultIterator, error) {
+	state, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return state.Jobs(ws)
+}
+
+func (s *evalState) JobsByNamespace(ws memdb.WatchSet, namespace string) ([]*models.Job, error) {
+	state, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return state.JobsByNamespace(ws, namespace)
+}
+
+func (s *evalState) QuotaByNamespace(ws memdb.WatchSet, namespace string) (*models.QuotaSpec, error) {
+	state, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return state.QuotaByNamespace(ws, namespace)
+}
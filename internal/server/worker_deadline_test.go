@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+func TestEvalState_Release(t *testing.T) {
+	state, err := store.NewStateStore(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Worker{srv: &Server{}, deadline: make(chan struct{}), state: newEvalState(state)}
+	if job, err := w.state.JobByID(nil, "job1"); err != nil || job != nil {
+		t.Fatalf("JobByID: %v %v", job, err)
+	}
+	if w.expired() {
+		t.Fatal("expired before the deadline")
+	}
+
+	close(w.deadline)
+	w.state.release()
+	if !w.expired() {
+		t.Error("not expired after the deadline")
+	}
+	if err := w.UpdateEval(&models.Evaluation{ID: "eval1"}); err != errEvalDeadline {
+		t.Errorf("UpdateEval: %v", err)
+	}
+	w.state.set(state)
+	if _, err := w.state.Nodes(nil); err != errEvalDeadline {
+		t.Errorf("the snapshot was not released: %v", err)
+	}
+	if (&Worker{}).expired() {
+		t.Error("a worker without deadline expired")
+	}
+}